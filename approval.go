@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hansmi/s3-object-cleanup/internal/client"
+)
+
+// Object in the persistence bucket holding the hex-encoded SHA-256 digest of
+// the token which approves runs other than dry runs. It's shared by all
+// shards.
+const approvalTokenKey = "approval-token"
+
+// Maximum size of a stored approval token.
+const approvalTokenMaxSize = 4096
+
+var errApprovalMissing = errors.New("no approval token stored")
+var errApprovalMismatch = errors.New("approval token mismatch")
+
+type approvalTokenClient interface {
+	OpenObject(context.Context, string) (io.ReadCloser, client.ObjectInfo, error)
+}
+
+// readApprovalToken returns the approval token digest stored in the
+// persistence bucket without surrounding whitespace. An empty string is
+// returned if none is stored.
+func readApprovalToken(ctx context.Context, c approvalTokenClient, key string) (string, error) {
+	body, _, err := c.OpenObject(ctx, key)
+	if err != nil {
+		if client.IsNotFound(err) {
+			return "", nil
+		}
+
+		return "", err
+	}
+
+	defer body.Close()
+
+	buf, err := io.ReadAll(io.LimitReader(body, approvalTokenMaxSize+1))
+	if err != nil {
+		return "", fmt.Errorf("object %q: %w", key, err)
+	}
+
+	if len(buf) > approvalTokenMaxSize {
+		return "", fmt.Errorf("%w: object %q exceeds %d bytes", os.ErrInvalid, key, approvalTokenMaxSize)
+	}
+
+	return string(bytes.TrimSpace(buf)), nil
+}
+
+// approvalTokenDigest returns the hex-encoded SHA-256 digest of a token as
+// stored by administrators.
+func approvalTokenDigest(token string) string {
+	digest := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(digest[:])
+}
+
+// checkApproval verifies that the digest of the given token matches the one
+// stored by an administrator. Approval is only required once a digest is
+// stored or a token is given. Errors wrapping [errApprovalMissing] or
+// [errApprovalMismatch] signal a run which isn't approved.
+func checkApproval(ctx context.Context, c approvalTokenClient, key, token string) error {
+	stored, err := readApprovalToken(ctx, c, key)
+	if err != nil {
+		return err
+	}
+
+	if stored == "" {
+		if token == "" {
+			return nil
+		}
+
+		return fmt.Errorf("%w in object %q", errApprovalMissing, key)
+	}
+
+	want, err := hex.DecodeString(stored)
+	if err != nil || len(want) != sha256.Size {
+		return fmt.Errorf("%w: object %q must hold the hex-encoded SHA-256 digest of the approval token", os.ErrInvalid, key)
+	}
+
+	got := sha256.Sum256([]byte(token))
+
+	if token == "" || subtle.ConstantTimeCompare(want, got[:]) != 1 {
+		return fmt.Errorf("%w for object %q", errApprovalMismatch, key)
+	}
+
+	return nil
+}
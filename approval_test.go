@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/hansmi/s3-object-cleanup/internal/client"
+)
+
+type fakeApprovalTokenClient map[string]string
+
+func (c fakeApprovalTokenClient) OpenObject(_ context.Context, key string) (io.ReadCloser, client.ObjectInfo, error) {
+	content, ok := c[key]
+	if !ok {
+		return nil, client.ObjectInfo{}, &types.NoSuchKey{}
+	}
+
+	return io.NopCloser(strings.NewReader(content)), client.ObjectInfo{}, nil
+}
+
+type failingApprovalTokenClient struct{}
+
+func (failingApprovalTokenClient) OpenObject(context.Context, string) (io.ReadCloser, client.ObjectInfo, error) {
+	return nil, client.ObjectInfo{}, os.ErrPermission
+}
+
+func TestCheckApproval(t *testing.T) {
+	digest := approvalTokenDigest("secret")
+
+	for _, tc := range []struct {
+		name    string
+		client  approvalTokenClient
+		token   string
+		wantErr error
+	}{
+		{
+			name:   "not enabled",
+			client: fakeApprovalTokenClient{},
+		},
+		{
+			name:    "not stored",
+			client:  fakeApprovalTokenClient{},
+			token:   "secret",
+			wantErr: errApprovalMissing,
+		},
+		{
+			name:    "not given",
+			client:  fakeApprovalTokenClient{approvalTokenKey: digest},
+			wantErr: errApprovalMismatch,
+		},
+		{
+			name:    "mismatch",
+			client:  fakeApprovalTokenClient{approvalTokenKey: digest},
+			token:   "other",
+			wantErr: errApprovalMismatch,
+		},
+		{
+			name:   "match",
+			client: fakeApprovalTokenClient{approvalTokenKey: digest + "\n"},
+			token:  "secret",
+		},
+		{
+			name:   "uppercase digest",
+			client: fakeApprovalTokenClient{approvalTokenKey: strings.ToUpper(digest)},
+			token:  "secret",
+		},
+		{
+			name:    "plaintext stored",
+			client:  fakeApprovalTokenClient{approvalTokenKey: "secret"},
+			token:   "secret",
+			wantErr: os.ErrInvalid,
+		},
+		{
+			name:    "digest given as token",
+			client:  fakeApprovalTokenClient{approvalTokenKey: digest},
+			token:   digest,
+			wantErr: errApprovalMismatch,
+		},
+		{
+			name:    "too large",
+			client:  fakeApprovalTokenClient{approvalTokenKey: strings.Repeat("x", approvalTokenMaxSize+1)},
+			token:   "secret",
+			wantErr: os.ErrInvalid,
+		},
+		{
+			name:    "read error",
+			client:  failingApprovalTokenClient{},
+			wantErr: os.ErrPermission,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkApproval(t.Context(), tc.client, approvalTokenKey, tc.token)
+
+			if diff := cmp.Diff(tc.wantErr, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("checkApproval() error diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestApprovalTokenDigest(t *testing.T) {
+	// printf %s secret | sha256sum
+	const want = "2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b"
+
+	if got := approvalTokenDigest("secret"); got != want {
+		t.Errorf("approvalTokenDigest() = %q, want %q", got, want)
+	}
+}
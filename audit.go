@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/hansmi/s3-object-cleanup/internal/state"
+)
+
+// writeDeleteAudit prints a table with the recorded outcome of each deleted
+// object version.
+func writeDeleteAudit(w io.Writer, b *state.Bucket) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "Attempted\tKey\tVersion\tSize\tOutcome")
+
+	if err := b.ForEachDeleteAudit(func(a state.DeleteAudit) error {
+		size := humanize.IBytes(uint64(max(0, a.Size)))
+
+		if a.DeleteMarker {
+			size = "delete marker"
+		}
+
+		outcome := "deleted"
+
+		if !a.Success() {
+			outcome = fmt.Sprintf("%s: %s", a.ErrorCode, a.ErrorMessage)
+		}
+
+		_, err := fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			a.At.UTC().Format(time.DateTime),
+			a.Key,
+			a.VersionID,
+			size,
+			outcome,
+		)
+
+		return err
+	}); err != nil {
+		return fmt.Errorf("reading delete audit: %w", err)
+	}
+
+	return tw.Flush()
+}
+
+// statsDeletions prints the recorded deletion outcomes of the given buckets
+// from the persisted state.
+func (p *program) statsDeletions(ctx context.Context, bucketNames []string) error {
+	return p.printBucketStates(ctx, "stats deletions", bucketNames, writeDeleteAudit)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hansmi/s3-object-cleanup/internal/state"
+)
+
+func TestWriteDeleteAudit(t *testing.T) {
+	s, err := state.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	t.Cleanup(func() {
+		s.Close()
+	})
+
+	b, err := s.Bucket("test")
+	if err != nil {
+		t.Fatalf("Bucket() failed: %v", err)
+	}
+
+	at := time.Date(2020, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, a := range []state.DeleteAudit{
+		{Key: "a", VersionID: "v1", Size: 2048, At: at},
+		{Key: "a", VersionID: "v2", DeleteMarker: true, At: at},
+		{Key: "b", VersionID: "v1", Size: 10, At: at.Add(time.Hour), ErrorCode: "AccessDenied", ErrorMessage: "Access Denied"},
+	} {
+		if err := b.PutDeleteAudit(a); err != nil {
+			t.Fatalf("PutDeleteAudit() failed: %v", err)
+		}
+	}
+
+	var buf strings.Builder
+
+	if err := writeDeleteAudit(&buf, b); err != nil {
+		t.Errorf("writeDeleteAudit() failed: %v", err)
+	}
+
+	want := []string{
+		"Attempted            Key  Version  Size           Outcome",
+		"2020-03-01 12:00:00  a    v1       2.0 KiB        deleted",
+		"2020-03-01 12:00:00  a    v2       delete marker  deleted",
+		"2020-03-01 13:00:00  b    v1       10 B           AccessDenied: Access Denied",
+	}
+
+	if diff := cmp.Diff(want, strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")); diff != "" {
+		t.Errorf("writeDeleteAudit() diff (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/hansmi/s3-object-cleanup/cleanup"
+	"github.com/hansmi/s3-object-cleanup/internal/client"
+	"github.com/hansmi/s3-object-cleanup/internal/fakes3"
+	"github.com/hansmi/s3-object-cleanup/internal/state"
+)
+
+const benchBucket = "bench"
+
+type benchDataOptions struct {
+	keys        int
+	maxVersions int
+
+	// Versions are spread over the given amount of time before now.
+	age time.Duration
+
+	// Retention applied to some of the versions.
+	retention time.Duration
+
+	seed uint64
+	now  time.Time
+}
+
+// generateBenchVersions adds a synthetic version history to the fake bucket.
+// Every key has between one and maxVersions versions. Some keys end in a
+// delete marker and some versions already have retention configured. The
+// result is deterministic for a given seed.
+func generateBenchVersions(s *fakes3.Server, opts benchDataOptions) int {
+	rng := rand.New(rand.NewPCG(opts.seed, opts.seed))
+
+	var count int
+
+	for i := range opts.keys {
+		key := fmt.Sprintf("data/%03d/object-%08d", i%1000, i)
+		versions := 1 + rng.IntN(max(1, opts.maxVersions))
+
+		// Versions are evenly spaced between the first and now.
+		first := opts.now.Add(-time.Duration(rng.Int64N(int64(opts.age)) + 1))
+		step := opts.now.Sub(first) / time.Duration(versions)
+
+		for j := range versions {
+			modTime := first.Add(step * time.Duration(j))
+
+			v := fakes3.Version{
+				Key:          key,
+				VersionID:    fmt.Sprintf("%016x", rng.Uint64()),
+				LastModified: modTime,
+				Size:         rng.Int64N(1 << 20),
+				DeleteMarker: j == versions-1 && versions > 1 && rng.IntN(20) == 0,
+			}
+
+			if v.DeleteMarker {
+				v.Size = 0
+			} else if rng.IntN(2) == 0 {
+				v.RetainUntil = modTime.Add(opts.retention)
+			}
+
+			s.Add(v)
+			count++
+		}
+	}
+
+	return count
+}
+
+// bench runs the cleanup pipeline against an in-process fake S3 bucket with
+// synthetic object versions and reports the throughput.
+func (p *program) bench(ctx context.Context, _ []string) (err error) {
+	if p.benchKeys < 1 || p.benchMaxVersions < 1 {
+		return fmt.Errorf("bench_keys (%d) and bench_max_versions (%d) must be at least 1", p.benchKeys, p.benchMaxVersions)
+	}
+
+	logger := slog.Default()
+
+	if err := p.validate(logger); err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	fake := fakes3.New(fakes3.Options{
+		Bucket:  benchBucket,
+		Latency: p.benchLatency,
+	})
+
+	total := generateBenchVersions(fake, benchDataOptions{
+		keys:        p.benchKeys,
+		maxVersions: p.benchMaxVersions,
+		age:         2 * max(p.minDeletionAge, p.minRetention),
+		retention:   p.minRetention,
+		seed:        uint64(p.benchSeed),
+		now:         now,
+	})
+
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	stats := cleanup.NewStats()
+
+	cfg := aws.Config{
+		Region:      "us-east-1",
+		Credentials: aws.AnonymousCredentials{},
+		HTTPClient: newHTTPClient(httpClientOptions{
+			maxIdleConns:          p.httpMaxIdleConns,
+			connectTimeout:        p.httpConnectTimeout,
+			responseHeaderTimeout: p.httpResponseHeaderTimeout,
+		}),
+		APIOptions: []func(*middleware.Stack) error{
+			cleanup.NewRequestCounter(stats.AddAPIRequest),
+		},
+	}
+
+	if chaos := p.chaosOption(logger); chaos != nil {
+		cfg.APIOptions = append(cfg.APIOptions, chaos)
+	}
+
+	c, err := client.NewFromName(cfg, server.URL+"/"+benchBucket, p.parsed.retries.apply)
+	if err != nil {
+		return err
+	}
+
+	tmpdir, err := os.MkdirTemp("", "")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err = errors.Join(err, os.RemoveAll(tmpdir))
+	}()
+
+	store, err := state.New(tmpdir)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err = errors.Join(err, store.Close())
+	}()
+
+	opts := cleanup.Options{
+		Logger:                logger,
+		Stats:                 stats,
+		State:                 store,
+		Client:                c,
+		MinDeletionAge:        p.minDeletionAge,
+		MinRetention:          p.minRetention,
+		MinRetentionThreshold: p.minRetentionThreshold,
+		MaxNoncurrentVersions: p.maxNoncurrentVersions,
+		AgeFromNoncurrent:     p.ageFromNoncurrent,
+		Seed:                  p.seed,
+		ListPageSize:          int32(p.listPageSize),
+		ListPageRetries:       p.listPageRetries,
+		ChannelCapacity:       p.channelCapacity,
+		VersionFilter:         p.stateFilter,
+		RetentionViaHead:      p.retentionViaHead,
+		MaxWorkers:            p.maxWorkers,
+		ProgressInterval:      p.progressInterval,
+	}
+
+	if p.spillVersions {
+		opts.SpillDir = tmpdir
+	}
+
+	logger.InfoContext(ctx, "Running benchmark",
+		slog.Int("keys", p.benchKeys),
+		slog.Int("versions", total),
+		slog.Duration("latency", p.benchLatency))
+
+	start := time.Now()
+
+	if err := cleanup.Run(ctx, opts); err != nil {
+		return fmt.Errorf("cleanup: %w", err)
+	}
+
+	elapsed := time.Since(start)
+
+	attrs := []any{
+		slog.Int("versions", total),
+		slog.Int("remaining", len(fake.Versions())),
+		slog.Any("elapsed", cleanup.DurationStats(elapsed)),
+		slog.Float64("versions_per_second", float64(total)/elapsed.Seconds()),
+	}
+	attrs = append(attrs, stats.Attrs()...)
+
+	logger.InfoContext(ctx, "Benchmark results", attrs...)
+
+	return nil
+}
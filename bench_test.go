@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hansmi/s3-object-cleanup/cleanup"
+	"github.com/hansmi/s3-object-cleanup/internal/fakes3"
+)
+
+func TestGenerateBenchVersions(t *testing.T) {
+	opts := benchDataOptions{
+		keys:        100,
+		maxVersions: 5,
+		age:         30 * 24 * time.Hour,
+		retention:   7 * 24 * time.Hour,
+		seed:        7,
+		now:         time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	generate := func() []fakes3.Version {
+		s := fakes3.New(fakes3.Options{Bucket: benchBucket})
+
+		if count := generateBenchVersions(s, opts); count < opts.keys || count > opts.keys*opts.maxVersions {
+			t.Errorf("generateBenchVersions() created %d versions for %d keys", count, opts.keys)
+		}
+
+		return s.Versions()
+	}
+
+	first := generate()
+
+	if diff := cmp.Diff(first, generate()); diff != "" {
+		t.Errorf("Versions differ for the same seed (-first +second):\n%s", diff)
+	}
+
+	for _, v := range first {
+		if v.LastModified.After(opts.now) || v.LastModified.Before(opts.now.Add(-opts.age)) {
+			t.Errorf("Version %+v modified outside of the configured age", v)
+		}
+	}
+}
+
+func TestBench(t *testing.T) {
+	p := newValidProgram()
+	p.benchKeys = 200
+	p.benchMaxVersions = 5
+	p.benchSeed = 1
+	p.minDeletionAge = 7 * 24 * time.Hour
+	p.minRetention = 7 * 24 * time.Hour
+	p.minRetentionThreshold = 24 * time.Hour
+	p.channelCapacity = cleanup.DefaultChannelCapacity
+
+	if err := p.bench(t.Context(), nil); err != nil {
+		t.Errorf("bench() failed: %v", err)
+	}
+}
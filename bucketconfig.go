@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/hansmi/s3-object-cleanup/internal/client"
+)
+
+// bucketConfig holds the connection settings of a single bucket. Unset
+// values use the defaults from the command line and the environment.
+type bucketConfig struct {
+	// URL of an S3-compatible endpoint, e.g. "https://s3.wasabisys.com".
+	Endpoint string `json:"endpoint"`
+
+	Region string `json:"region"`
+
+	// Address the bucket as part of the path instead of the hostname.
+	PathStyle bool `json:"path_style"`
+
+	// Names of the environment variables holding the credentials. The keys
+	// themselves are never stored in the file.
+	AccessKeyIDEnv     string `json:"access_key_id_env"`
+	SecretAccessKeyEnv string `json:"secret_access_key_env"`
+	SessionTokenEnv    string `json:"session_token_env"`
+
+	// Overrides -s3_flavor.
+	Flavor string `json:"flavor"`
+
+	// Credentials given directly, e.g. in an rclone configuration. Take
+	// precedence over the environment variables.
+	credentialsProvider aws.CredentialsProvider
+}
+
+func (c bucketConfig) validate() error {
+	if c.Endpoint != "" {
+		if u, err := url.Parse(c.Endpoint); err != nil {
+			return fmt.Errorf("endpoint: %w", err)
+		} else if !u.IsAbs() || u.Host == "" || strings.Trim(u.Path, "/") != "" {
+			return fmt.Errorf("%w: endpoint must be an absolute URL without path: %s", os.ErrInvalid, u.Redacted())
+		}
+	}
+
+	if (c.AccessKeyIDEnv == "") != (c.SecretAccessKeyEnv == "") {
+		return fmt.Errorf("%w: access_key_id_env and secret_access_key_env must be given together", os.ErrInvalid)
+	}
+
+	if c.SessionTokenEnv != "" && c.AccessKeyIDEnv == "" {
+		return fmt.Errorf("%w: session_token_env requires access_key_id_env", os.ErrInvalid)
+	}
+
+	if _, err := client.ParseFlavor(c.Flavor); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c bucketConfig) credentials() (aws.CredentialsProvider, error) {
+	if c.credentialsProvider != nil {
+		return c.credentialsProvider, nil
+	}
+
+	accessKeyID := os.Getenv(c.AccessKeyIDEnv)
+	secretAccessKey := os.Getenv(c.SecretAccessKeyEnv)
+
+	if accessKeyID == "" || secretAccessKey == "" {
+		return nil, fmt.Errorf("credentials: $%s and $%s must be set", c.AccessKeyIDEnv, c.SecretAccessKeyEnv)
+	}
+
+	var sessionToken string
+
+	if c.SessionTokenEnv != "" {
+		sessionToken = os.Getenv(c.SessionTokenEnv)
+	}
+
+	return aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(accessKeyID, secretAccessKey, sessionToken)), nil
+}
+
+// newClient returns a client for the named bucket with the settings applied.
+// The default flavor is used unless the configuration selects another.
+// Additional options are applied last.
+func (c bucketConfig) newClient(cfg aws.Config, name string, flavor client.Flavor, optFns ...func(*s3.Options)) (*client.Client, error) {
+	input := name
+
+	if c.Endpoint != "" {
+		input = strings.TrimSuffix(c.Endpoint, "/") + "/" + name
+	}
+
+	var config []func(*s3.Options)
+
+	if c.Region != "" {
+		config = append(config, func(o *s3.Options) {
+			o.Region = c.Region
+		})
+	}
+
+	if c.PathStyle {
+		config = append(config, func(o *s3.Options) {
+			o.UsePathStyle = true
+		})
+	}
+
+	if c.AccessKeyIDEnv != "" || c.credentialsProvider != nil {
+		creds, err := c.credentials()
+		if err != nil {
+			return nil, fmt.Errorf("bucket %q: %w", name, err)
+		}
+
+		config = append(config, func(o *s3.Options) {
+			o.Credentials = creds
+		})
+	}
+
+	if c.Flavor != "" {
+		var err error
+
+		if flavor, err = client.ParseFlavor(c.Flavor); err != nil {
+			return nil, fmt.Errorf("bucket %q: %w", name, err)
+		}
+	}
+
+	result, err := client.NewFromName(cfg, input, append(config, optFns...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	result.SetFlavor(flavor)
+
+	return result, nil
+}
+
+// bucketConfigs maps bucket names to their connection settings.
+type bucketConfigs map[string]bucketConfig
+
+// parseBucketConfigs reads a JSON document with the settings of each bucket
+// below "buckets":
+//
+//	{
+//	  "buckets": {
+//	    "example": {
+//	      "endpoint": "https://s3.wasabisys.com",
+//	      "region": "us-east-1",
+//	      "access_key_id_env": "WASABI_ACCESS_KEY_ID",
+//	      "secret_access_key_env": "WASABI_SECRET_ACCESS_KEY"
+//	    }
+//	  }
+//	}
+func parseBucketConfigs(r io.Reader) (bucketConfigs, error) {
+	var doc struct {
+		Buckets bucketConfigs `json:"buckets"`
+	}
+
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	for name, c := range doc.Buckets {
+		if name == "" {
+			return nil, fmt.Errorf("%w: empty bucket name", os.ErrInvalid)
+		}
+
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("bucket %q: %w", name, err)
+		}
+	}
+
+	return doc.Buckets, nil
+}
+
+func loadBucketConfigs(path string) (bucketConfigs, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer fh.Close()
+
+	result, err := parseBucketConfigs(fh)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return result, nil
+}
+
+// names returns the configured bucket names in sorted order.
+func (c bucketConfigs) names() []string {
+	result := make([]string, 0, len(c))
+
+	for name := range c {
+		result = append(result, name)
+	}
+
+	slices.Sort(result)
+
+	return result
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/hansmi/s3-object-cleanup/internal/client"
+)
+
+func TestParseBucketConfigs(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		input   string
+		want    bucketConfigs
+		wantErr bool
+	}{
+		{name: "empty", input: `{}`},
+		{
+			name: "buckets",
+			input: `{"buckets": {
+				"aws": {},
+				"wasabi": {
+					"endpoint": "https://s3.wasabisys.com",
+					"region": "eu-central-1",
+					"access_key_id_env": "WASABI_KEY",
+					"secret_access_key_env": "WASABI_SECRET"
+				},
+				"minio": {"endpoint": "http://localhost:9000", "path_style": true, "flavor": "minio"}
+			}}`,
+			want: bucketConfigs{
+				"aws": {},
+				"wasabi": {
+					Endpoint:           "https://s3.wasabisys.com",
+					Region:             "eu-central-1",
+					AccessKeyIDEnv:     "WASABI_KEY",
+					SecretAccessKeyEnv: "WASABI_SECRET",
+				},
+				"minio": {Endpoint: "http://localhost:9000", PathStyle: true, Flavor: "minio"},
+			},
+		},
+		{name: "unknown field", input: `{"buckets": {"a": {"access_key_id": "secret"}}}`, wantErr: true},
+		{name: "endpoint with path", input: `{"buckets": {"a": {"endpoint": "https://example.com/a"}}}`, wantErr: true},
+		{name: "relative endpoint", input: `{"buckets": {"a": {"endpoint": "example.com"}}}`, wantErr: true},
+		{name: "partial credentials", input: `{"buckets": {"a": {"access_key_id_env": "KEY"}}}`, wantErr: true},
+		{name: "unknown flavor", input: `{"buckets": {"a": {"flavor": "unknown"}}}`, wantErr: true},
+		{name: "empty name", input: `{"buckets": {"": {}}}`, wantErr: true},
+		{name: "syntax", input: `{`, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseBucketConfigs(strings.NewReader(tc.input))
+
+			if (err != nil) != tc.wantErr {
+				t.Errorf("parseBucketConfigs() error = %v, want error %t", err, tc.wantErr)
+			}
+
+			if diff := cmp.Diff(tc.want, got, cmpopts.IgnoreUnexported(bucketConfig{})); err == nil && diff != "" {
+				t.Errorf("Config diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestBucketConfigsNames(t *testing.T) {
+	c := bucketConfigs{"b": {}, "c": {}, "a": {}}
+
+	if diff := cmp.Diff([]string{"a", "b", "c"}, c.names()); diff != "" {
+		t.Errorf("names() diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestBucketConfigNewClient(t *testing.T) {
+	t.Setenv("TEST_ACCESS_KEY_ID", "id")
+	t.Setenv("TEST_SECRET_ACCESS_KEY", "secret")
+
+	var got s3.Options
+
+	c, err := bucketConfig{
+		Endpoint:           "https://s3.example.com/",
+		Region:             "eu-west-1",
+		PathStyle:          true,
+		AccessKeyIDEnv:     "TEST_ACCESS_KEY_ID",
+		SecretAccessKeyEnv: "TEST_SECRET_ACCESS_KEY",
+		Flavor:             "ceph",
+	}.newClient(aws.Config{}, "bucket", client.FlavorAWS, func(o *s3.Options) {
+		got = o.Copy()
+	})
+	if err != nil {
+		t.Fatalf("newClient() failed: %v", err)
+	}
+
+	if c.Name() != "bucket" {
+		t.Errorf("Name() = %q, want %q", c.Name(), "bucket")
+	}
+
+	if name := c.Flavor().Name; name != client.FlavorCeph.Name {
+		t.Errorf("Flavor is %q, want %q", name, client.FlavorCeph.Name)
+	}
+
+	if got.Region != "eu-west-1" || !got.UsePathStyle || aws.ToString(got.BaseEndpoint) != "https://s3.example.com" {
+		t.Errorf("Unexpected options: region %q, path style %t, endpoint %q", got.Region, got.UsePathStyle, aws.ToString(got.BaseEndpoint))
+	}
+
+	creds, err := got.Credentials.Retrieve(t.Context())
+	if err != nil {
+		t.Errorf("Retrieving credentials failed: %v", err)
+	} else if creds.AccessKeyID != "id" || creds.SecretAccessKey != "secret" {
+		t.Errorf("Unexpected credentials: %+v", creds)
+	}
+}
+
+func TestBucketConfigNewClientMissingCredentials(t *testing.T) {
+	if _, err := (bucketConfig{
+		AccessKeyIDEnv:     "TEST_UNSET_ACCESS_KEY_ID",
+		SecretAccessKeyEnv: "TEST_UNSET_SECRET_ACCESS_KEY",
+	}).newClient(aws.Config{}, "bucket", client.FlavorAWS); err == nil {
+		t.Errorf("newClient() without credentials succeeded")
+	}
+}
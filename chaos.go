@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/aws/smithy-go/middleware"
+	"github.com/hansmi/s3-object-cleanup/internal/client"
+)
+
+// chaosFlagName is the name of the flag enabling fault injection. It's left
+// out of the usage message.
+const chaosFlagName = "chaos"
+
+// chaosSeedStream separates the random numbers of fault injection from other
+// users of the run seed.
+const chaosSeedStream = 0xc4a05
+
+// chaosOption returns the API option injecting faults into S3 requests, or nil
+// if fault injection is disabled.
+func (p *program) chaosOption(logger *slog.Logger) func(*middleware.Stack) error {
+	opts := p.parsed.chaos
+
+	if !opts.Enabled() {
+		return nil
+	}
+
+	// Faults are derived from the run seed, though the concurrency of
+	// requests still affects which request receives which fault.
+	opts.Rand = rand.New(rand.NewPCG(p.seed, chaosSeedStream))
+
+	logger.Warn("Injecting faults into S3 requests",
+		slog.Float64("error_rate", opts.ErrorRate),
+		slog.Float64("latency_rate", opts.LatencyRate),
+		slog.Duration("max_latency", opts.MaxLatency))
+
+	return client.NewChaos(opts)
+}
+
+// printVisibleDefaults prints the defaults of all flags in the set except the
+// hidden ones.
+func printVisibleDefaults(fs *flag.FlagSet, hidden ...string) {
+	visible := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	visible.SetOutput(fs.Output())
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if !slices.Contains(hidden, f.Name) {
+			visible.Var(f.Value, f.Name, f.Usage)
+			visible.Lookup(f.Name).DefValue = f.DefValue
+		}
+	})
+
+	visible.PrintDefaults()
+}
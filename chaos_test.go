@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestPrintVisibleDefaults(t *testing.T) {
+	var buf bytes.Buffer
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(&buf)
+	fs.String("visible", "value", "Shown in the usage.")
+	fs.String(chaosFlagName, "", "Left out of the usage.")
+
+	printVisibleDefaults(fs, chaosFlagName)
+
+	if got := buf.String(); !strings.Contains(got, "-visible") || !strings.Contains(got, `(default "value")`) {
+		t.Errorf("Usage %q lacks visible flag", got)
+	}
+
+	if got := buf.String(); strings.Contains(got, chaosFlagName) {
+		t.Errorf("Usage %q contains hidden flag", got)
+	}
+}
@@ -0,0 +1,214 @@
+package cleanup
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/aws/smithy-go"
+)
+
+const (
+	actionList   = "list"
+	actionDelete = "delete"
+	actionExtend = "extend"
+	actionSkip   = "skip"
+)
+
+const (
+	actionReasonExpiredVersion      = "expired_version"
+	actionReasonExpiredDeleteMarker = "expired_delete_marker"
+	actionReasonRetentionMissing    = "retention_missing"
+	actionReasonRetentionBelow      = "retention_below_threshold"
+
+	actionReasonExcludedKey      = "excluded_key"
+	actionReasonUnchanged        = "unchanged_not_due"
+	actionReasonExcludedMetadata = "excluded_metadata"
+	actionReasonKMSKeyMismatch   = "kms_key_mismatch"
+	actionReasonQuarantined      = "quarantined"
+	actionReasonRetentionLonger  = "retention_longer"
+	actionReasonRetentionEnough  = "retention_sufficient"
+	actionReasonMinVersions      = "min_surviving_versions"
+	actionReasonProtected        = "protected_prefix"
+	actionReasonRetentionFailed  = "retention_failed"
+	actionReasonPlanDrift        = "plan_drift"
+)
+
+// actionRecord is a single line of the action log. Deletions and retention
+// extensions are recorded once their request finished, with the error if it
+// failed.
+type actionRecord struct {
+	Time         time.Time `json:"time"`
+	Bucket       string    `json:"bucket"`
+	Action       string    `json:"action"`
+	Reason       string    `json:"reason,omitempty"`
+	Key          string    `json:"key"`
+	VersionID    string    `json:"version_id,omitempty"`
+	Size         int64     `json:"size,omitempty"`
+	LastModified time.Time `json:"last_modified,omitzero"`
+	IsLatest     bool      `json:"is_latest,omitempty"`
+	DeleteMarker bool      `json:"delete_marker,omitempty"`
+	RetainUntil  time.Time `json:"retain_until,omitzero"`
+	Until        time.Time `json:"until,omitzero"`
+	DryRun       bool      `json:"dry_run,omitempty"`
+	ErrorCode    string    `json:"error_code,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// actionError describes why a request for an action failed.
+type actionError struct {
+	code    string
+	message string
+}
+
+// newActionError returns the error code and message of a failed request.
+// The code is empty for errors not returned by the API.
+func newActionError(err error) *actionError {
+	var errApi smithy.APIError
+
+	if errors.As(err, &errApi) {
+		return &actionError{
+			code:    errApi.ErrorCode(),
+			message: errApi.ErrorMessage(),
+		}
+	}
+
+	return &actionError{message: err.Error()}
+}
+
+func (e *actionError) apply(record *actionRecord) {
+	if e != nil {
+		record.ErrorCode = e.code
+		record.Error = e.message
+	}
+}
+
+// ActionLog writes every decision of a run as newline-delimited JSON, one
+// object per line, for ingestion into log pipelines such as OpenSearch or
+// Loki. Unlike a [Plan] it's written while the run progresses and includes
+// listed and skipped versions. Lines aren't ordered.
+type ActionLog struct {
+	mu  sync.Mutex
+	w   *bufio.Writer
+	enc *json.Encoder
+	err error
+	now func() time.Time
+}
+
+func NewActionLog(w io.Writer) *ActionLog {
+	bw := bufio.NewWriter(w)
+
+	return &ActionLog{
+		w:   bw,
+		enc: json.NewEncoder(bw),
+		now: time.Now,
+	}
+}
+
+func (l *ActionLog) write(r actionRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.err != nil {
+		return
+	}
+
+	r.Time = l.now().UTC()
+
+	l.err = l.enc.Encode(r)
+}
+
+// Flush writes buffered lines to the underlying writer. The first error
+// encountered while writing is returned.
+func (l *ActionLog) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.err == nil {
+		l.err = l.w.Flush()
+	}
+
+	return l.err
+}
+
+// ForBucket returns a recorder adding lines for the given bucket.
+func (l *ActionLog) ForBucket(name string) *ActionRecorder {
+	return &ActionRecorder{
+		log:    l,
+		bucket: name,
+	}
+}
+
+// ActionRecorder adds the decisions of a single bucket to an action log.
+type ActionRecorder struct {
+	log    *ActionLog
+	bucket string
+}
+
+func (r *ActionRecorder) add(action, reason string, ov objectVersion, fn func(*actionRecord)) {
+	record := actionRecord{
+		Bucket:       r.bucket,
+		Action:       action,
+		Reason:       reason,
+		Key:          ov.key,
+		VersionID:    ov.versionID,
+		Size:         ov.size,
+		LastModified: ov.lastModified,
+		IsLatest:     ov.isLatest,
+		DeleteMarker: ov.deleteMarker,
+		RetainUntil:  ov.retainUntil,
+	}
+
+	if fn != nil {
+		fn(&record)
+	}
+
+	r.log.write(record)
+}
+
+func (r *ActionRecorder) addList(ov objectVersion) {
+	r.add(actionList, "", ov, nil)
+}
+
+func (r *ActionRecorder) addSkip(ov objectVersion, reason string) {
+	r.add(actionSkip, reason, ov, nil)
+}
+
+// addSkipKey records that all versions of a key were skipped.
+func (r *ActionRecorder) addSkipKey(key, reason string) {
+	r.add(actionSkip, reason, objectVersion{key: key}, nil)
+}
+
+// addDelete records the outcome of deleting a version. A nil failure
+// signifies success.
+func (r *ActionRecorder) addDelete(ov objectVersion, dryRun bool, failure *actionError) {
+	reason := actionReasonExpiredVersion
+
+	if ov.deleteMarker {
+		reason = actionReasonExpiredDeleteMarker
+	}
+
+	r.add(actionDelete, reason, ov, func(record *actionRecord) {
+		record.DryRun = dryRun
+		failure.apply(record)
+	})
+}
+
+// addRetention records the outcome of extending the retention of a version.
+// A nil failure signifies success.
+func (r *ActionRecorder) addRetention(req retentionExtenderRequest, dryRun bool, failure *actionError) {
+	reason := actionReasonRetentionBelow
+
+	if req.object.retainUntil.IsZero() {
+		reason = actionReasonRetentionMissing
+	}
+
+	r.add(actionExtend, reason, req.object, func(record *actionRecord) {
+		record.Until = req.until
+		record.DryRun = dryRun
+		failure.apply(record)
+	})
+}
@@ -0,0 +1,318 @@
+package cleanup
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func newActionLogForTest(w io.Writer) *ActionLog {
+	l := NewActionLog(w)
+	l.now = func() time.Time {
+		return time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	return l
+}
+
+// parseActionLog returns the action and reason of every line.
+func parseActionLog(t *testing.T, l *ActionLog, buf *bytes.Buffer) []string {
+	t.Helper()
+
+	if err := l.Flush(); err != nil {
+		t.Fatalf("Flush() failed: %v", err)
+	}
+
+	var result []string
+
+	scanner := bufio.NewScanner(buf)
+
+	for scanner.Scan() {
+		var record actionRecord
+
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Unmarshal(%q) failed: %v", scanner.Text(), err)
+		}
+
+		entry := record.Action + " " + record.Key + "@" + record.VersionID
+
+		if record.Reason != "" {
+			entry += " " + record.Reason
+		}
+
+		if record.ErrorCode != "" {
+			entry += " error=" + record.ErrorCode
+		}
+
+		result = append(result, entry)
+	}
+
+	return result
+}
+
+func TestActionLog(t *testing.T) {
+	var buf bytes.Buffer
+
+	l := newActionLogForTest(&buf)
+	r := l.ForBucket("bucket")
+
+	lastModified := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	ov := objectVersion{
+		key:          "key",
+		versionID:    "v1",
+		size:         123,
+		lastModified: lastModified,
+	}
+
+	r.addList(ov)
+	r.addDelete(ov, true, nil)
+	r.addRetention(retentionExtenderRequest{
+		object: ov,
+		until:  lastModified.Add(48 * time.Hour),
+	}, false, nil)
+	r.addDelete(ov, false, newActionError(&smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied"}))
+	r.addSkipKey("other", actionReasonUnchanged)
+
+	if err := l.Flush(); err != nil {
+		t.Fatalf("Flush() failed: %v", err)
+	}
+
+	want := `{"time":"2024-03-01T00:00:00Z","bucket":"bucket","action":"list","key":"key","version_id":"v1","size":123,"last_modified":"2024-01-01T00:00:00Z"}
+{"time":"2024-03-01T00:00:00Z","bucket":"bucket","action":"delete","reason":"expired_version","key":"key","version_id":"v1","size":123,"last_modified":"2024-01-01T00:00:00Z","dry_run":true}
+{"time":"2024-03-01T00:00:00Z","bucket":"bucket","action":"extend","reason":"retention_missing","key":"key","version_id":"v1","size":123,"last_modified":"2024-01-01T00:00:00Z","until":"2024-01-03T00:00:00Z"}
+{"time":"2024-03-01T00:00:00Z","bucket":"bucket","action":"delete","reason":"expired_version","key":"key","version_id":"v1","size":123,"last_modified":"2024-01-01T00:00:00Z","error_code":"AccessDenied","error":"Access Denied"}
+{"time":"2024-03-01T00:00:00Z","bucket":"bucket","action":"skip","reason":"unchanged_not_due","key":"other"}
+`
+
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Output diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestProcessorActions(t *testing.T) {
+	now := time.Now()
+
+	var buf bytes.Buffer
+
+	l := newActionLogForTest(&buf)
+
+	excludeKeys := NewKeyManifest()
+	excludeKeys.add("excluded")
+
+	p := newProcessor(processorOptions{
+		stats:          NewStats(),
+		actions:        l.ForBucket("bucket"),
+		minDeletionAge: 24 * time.Hour,
+		excludeKeys:    excludeKeys,
+	})
+
+	in := make(chan objectVersion, 8)
+	retentionCh := make(chan retentionExtenderRequest, 8)
+	deleteCh := make(chan objectVersion, 8)
+
+	in <- objectVersion{key: "excluded", versionID: "a", lastModified: now.Add(-72 * time.Hour)}
+	in <- objectVersion{key: "key", versionID: "old", lastModified: now.Add(-72 * time.Hour)}
+	in <- objectVersion{key: "key", versionID: "new", lastModified: now.Add(-48 * time.Hour), isLatest: true}
+	close(in)
+
+	if err := p.run(in, retentionCh, deleteCh); err != nil {
+		t.Errorf("run() failed: %v", err)
+	}
+
+	want := []string{
+		"list excluded@a",
+		"skip excluded@a excluded_key",
+		"list key@old",
+		"list key@new",
+	}
+
+	if diff := cmp.Diff(want, parseActionLog(t, l, &buf)); diff != "" {
+		t.Errorf("Actions diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestBatchDeleterActions(t *testing.T) {
+	var c fakeDeleteObjectsClient
+
+	var buf bytes.Buffer
+
+	l := newActionLogForTest(&buf)
+
+	m, err := ParseMetadataMatcher("hold=true")
+	if err != nil {
+		t.Fatalf("ParseMetadataMatcher() failed: %v", err)
+	}
+
+	d := newBatchDeleter(batchDeleterOptions{
+		logger:  slog.New(slog.DiscardHandler),
+		stats:   NewStats(),
+		state:   fakeBatchDeleterState{},
+		client:  &c,
+		bucket:  "test",
+		actions: l.ForBucket("test"),
+
+		excludeMetadata: m,
+		metadataClient: fakeMetadataClient{
+			"held": {"hold": "true"},
+		},
+	})
+
+	if err := d.deleteBatch(t.Context(), []objectVersion{
+		{key: "held", versionID: "1"},
+		{key: "plain", versionID: "2"},
+		{key: "marker", versionID: "3", deleteMarker: true},
+	}); err != nil {
+		t.Errorf("deleteBatch() failed: %v", err)
+	}
+
+	want := []string{
+		"skip held@1 excluded_metadata",
+		"delete plain@2 expired_version",
+		"delete marker@3 expired_delete_marker",
+	}
+
+	if diff := cmp.Diff(want, parseActionLog(t, l, &buf)); diff != "" {
+		t.Errorf("Actions diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestBatchDeleterActionOutcome(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		client *fakeDeleteObjectsClient
+		dryRun bool
+		want   []string
+	}{
+		{
+			name:   "success",
+			client: &fakeDeleteObjectsClient{},
+			want: []string{
+				"delete a@1 expired_version",
+				"delete b@2 expired_version",
+			},
+		},
+		{
+			name: "dry run",
+			client: &fakeDeleteObjectsClient{
+				err: os.ErrPermission,
+			},
+			dryRun: true,
+			want: []string{
+				"delete a@1 expired_version",
+				"delete b@2 expired_version",
+			},
+		},
+		{
+			name: "key failure",
+			client: &fakeDeleteObjectsClient{
+				failures: map[string]int{"b": 1},
+				code:     "AccessDenied",
+			},
+			want: []string{
+				"delete a@1 expired_version",
+				"delete b@2 expired_version error=AccessDenied",
+			},
+		},
+		{
+			name: "request failure",
+			client: &fakeDeleteObjectsClient{
+				err: &smithy.GenericAPIError{Code: "InvalidRequest"},
+			},
+			want: []string{
+				"delete a@1 expired_version error=InvalidRequest",
+				"delete b@2 expired_version error=InvalidRequest",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			l := newActionLogForTest(&buf)
+
+			d := newBatchDeleter(batchDeleterOptions{
+				logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+				stats:   NewStats(),
+				state:   fakeBatchDeleterState{},
+				client:  tc.client,
+				bucket:  "test",
+				dryRun:  tc.dryRun,
+				actions: l.ForBucket("test"),
+			})
+
+			// Errors of whole requests are returned.
+			_ = d.deleteBatch(t.Context(), []objectVersion{
+				{key: "a", versionID: "1"},
+				{key: "b", versionID: "2"},
+			})
+
+			got := parseActionLog(t, l, &buf)
+
+			if diff := cmp.Diff(tc.want, got, cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+				t.Errorf("Action log diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRetentionActionOutcome(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name   string
+		err    error
+		dryRun bool
+		want   []string
+	}{
+		{
+			name: "success",
+			want: []string{"extend key@v1 retention_missing"},
+		},
+		{
+			name:   "dry run",
+			err:    os.ErrPermission,
+			dryRun: true,
+			want:   []string{"extend key@v1 retention_missing"},
+		},
+		{
+			name: "failure",
+			err:  &smithy.GenericAPIError{Code: "AccessDenied"},
+			want: []string{"extend key@v1 retention_missing error=AccessDenied"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			l := newActionLogForTest(&buf)
+
+			e := newRetentionExtender(retentionExtenderOptions{
+				logger:  slog.New(slog.DiscardHandler),
+				stats:   NewStats(),
+				state:   newRetentionStateForTest(t),
+				client:  &fakeExtenderClient{err: tc.err},
+				now:     now,
+				dryRun:  tc.dryRun,
+				actions: l.ForBucket("test"),
+			})
+
+			// Failed requests are returned as errors.
+			_ = e.process(t.Context(), retentionExtenderRequest{
+				object: objectVersion{key: "key", versionID: "v1"},
+				until:  now.Add(time.Hour),
+			})
+
+			if diff := cmp.Diff(tc.want, parseActionLog(t, l, &buf)); diff != "" {
+				t.Errorf("Action log diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
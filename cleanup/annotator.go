@@ -0,0 +1,367 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/hansmi/s3-object-cleanup/internal/state"
+	"golang.org/x/sync/errgroup"
+)
+
+type retentionAnnotatorState interface {
+	GetObjectRetention(string, string) (time.Time, bool, error)
+	SetObjectRetention(string, string, time.Time) error
+}
+
+type retentionAnnotatorInventory interface {
+	GetInventoryVersion(string, string) (state.InventoryVersion, bool, error)
+	PutInventoryVersion(state.InventoryVersion, time.Time) error
+}
+
+type retentionAnnotatorHeadClient interface {
+	HeadObject(context.Context, string, string) (*s3.HeadObjectOutput, error)
+}
+
+type retentionAnnotatorFilter interface {
+	MayContain(string, string) bool
+	Add(string, string)
+	ObjectRetention(string, string) (time.Time, bool)
+	InventoryVersion(string, string) (state.InventoryVersion, bool)
+}
+
+type retentionAnnotatorClient interface {
+	GetObjectRetention(context.Context, string, string) (time.Time, error)
+}
+
+type retentionAnnotatorOptions struct {
+	logger *slog.Logger
+	stats  *Stats
+	state  retentionAnnotatorState
+	client retentionAnnotatorClient
+
+	// Shared backoff for API requests. A private instance is used if nil.
+	backoff *adaptiveBackoff
+
+	errorGuard *errorRatioGuard
+
+	// Versions already in the inventory with unchanged modification time
+	// are marked as unchanged. All annotated versions are recorded. Disabled
+	// if nil.
+	inventory retentionAnnotatorInventory
+
+	// Time at which versions are recorded as seen in the inventory.
+	now time.Time
+
+	// Versions not contained in the filter skip the state lookups. Records
+	// loaded with the filter are used instead of reading them from the state.
+	// Versions recorded in the state are added. Disabled if nil.
+	filter retentionAnnotatorFilter
+
+	// Determine retention using HeadObject instead of GetObjectRetention.
+	// The response is kept with the version for reuse by later stages.
+	// Disabled if nil.
+	headClient retentionAnnotatorHeadClient
+
+	// Versions can't have retention, e.g. because Object Lock isn't enabled
+	// for the bucket. Only the inventory is maintained.
+	noRetention bool
+
+	// Adapts the number of concurrently active workers. A fixed number of
+	// workers is used if nil.
+	tuner *workerTuner
+
+	// Measures the time spent processing items. Disabled if nil.
+	timer *stageTimer
+
+	// Tracks the processing of listed keys for resuming the listing.
+	// Disabled if nil.
+	watermark *listWatermark
+}
+
+type retentionAnnotator struct {
+	logger      *slog.Logger
+	stats       *Stats
+	state       retentionAnnotatorState
+	client      retentionAnnotatorClient
+	backoff     *adaptiveBackoff
+	errorGuard  *errorRatioGuard
+	inventory   retentionAnnotatorInventory
+	now         time.Time
+	filter      retentionAnnotatorFilter
+	headClient  retentionAnnotatorHeadClient
+	noRetention bool
+
+	workers   int
+	tuner     *workerTuner
+	timer     *stageTimer
+	watermark *listWatermark
+}
+
+func newRetentionAnnotator(opts retentionAnnotatorOptions) *retentionAnnotator {
+	if opts.backoff == nil {
+		opts.backoff = newAdaptiveBackoff(opts.stats)
+	}
+
+	if opts.now.IsZero() {
+		opts.now = time.Now()
+	}
+
+	return &retentionAnnotator{
+		logger:      opts.logger,
+		stats:       opts.stats,
+		state:       opts.state,
+		client:      opts.client,
+		backoff:     opts.backoff,
+		errorGuard:  opts.errorGuard,
+		inventory:   opts.inventory,
+		now:         opts.now,
+		filter:      opts.filter,
+		headClient:  opts.headClient,
+		noRetention: opts.noRetention,
+
+		workers:   opts.tuner.workers(),
+		tuner:     opts.tuner,
+		timer:     opts.timer,
+		watermark: opts.watermark,
+	}
+}
+
+// inState reports whether a version may be recorded in the state.
+func (a *retentionAnnotator) inState(ov objectVersion) bool {
+	if a.filter == nil || a.filter.MayContain(ov.key, ov.stateVersionID()) {
+		return true
+	}
+
+	a.stats.addStateFilterSkip()
+
+	return false
+}
+
+func (a *retentionAnnotator) annotate(ctx context.Context, ov objectVersion) (objectVersion, error) {
+	inState := a.inState(ov)
+
+	unchanged, err := a.fromInventory(ov, inState)
+	if err != nil {
+		return ov, err
+	}
+
+	ov.unchanged = unchanged
+
+	if a.noRetention {
+		return ov, nil
+	}
+
+	if until := ov.retainUntil; until.IsZero() {
+		var found bool
+
+		if inState {
+			until, found, err = a.stateRetention(ov)
+			if err != nil {
+				return ov, err
+			}
+		}
+
+		// Versions without retention are recorded too, avoiding repeated
+		// lookups until the record is pruned. The record is ignored if the
+		// inventory reports the version as changed.
+		if found && until.IsZero() && a.inventory != nil && !unchanged {
+			found = false
+		}
+
+		if found {
+			a.stats.addStateCacheHit()
+		}
+
+		// Delete markers don't support retention periods. The retention
+		// recorded in the inventory isn't used for unchanged versions as
+		// extensions only update the state.
+		if !found && !ov.deleteMarker {
+			a.stats.addStateCacheMiss()
+
+			err = a.backoff.do(ctx, func() (err error) {
+				until, err = a.lookupRetention(ctx, &ov)
+				return err
+			})
+			if err != nil {
+				return ov, fmt.Errorf("getting object retention from API: %w", err)
+			}
+
+			if err := a.state.SetObjectRetention(ov.key, ov.stateVersionID(), until); err != nil {
+				return ov, fmt.Errorf("setting object retention in state: %w", err)
+			}
+
+			a.addToFilter(ov)
+		}
+
+		if !until.IsZero() {
+			ov.retainUntil = until
+		}
+	}
+
+	return ov, nil
+}
+
+// stateRetention returns the retention recorded in the state, preferring the
+// records loaded with the filter.
+func (a *retentionAnnotator) stateRetention(ov objectVersion) (time.Time, bool, error) {
+	if a.filter != nil {
+		if until, found := a.filter.ObjectRetention(ov.key, ov.stateVersionID()); found {
+			return until, true, nil
+		}
+	}
+
+	until, found, err := a.state.GetObjectRetention(ov.key, ov.stateVersionID())
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("getting object retention from state: %w", err)
+	}
+
+	return until, found, nil
+}
+
+func (a *retentionAnnotator) addToFilter(ov objectVersion) {
+	if a.filter != nil {
+		a.filter.Add(ov.key, ov.stateVersionID())
+	}
+}
+
+// lookupRetention queries the retention of a version from the API.
+func (a *retentionAnnotator) lookupRetention(ctx context.Context, ov *objectVersion) (time.Time, error) {
+	if a.headClient == nil {
+		return a.client.GetObjectRetention(ctx, ov.key, ov.versionID)
+	}
+
+	output, err := a.headClient.HeadObject(ctx, ov.key, ov.versionID)
+	if err != nil || output == nil {
+		// Version may have been deleted.
+		return time.Time{}, err
+	}
+
+	ov.head = output
+
+	return aws.ToTime(output.ObjectLockRetainUntilDate), nil
+}
+
+// fromInventory reports whether a version is recorded in the inventory with
+// unchanged modification time and latest status. The lookup is skipped for
+// versions known not to be in the state.
+func (a *retentionAnnotator) fromInventory(ov objectVersion, inState bool) (bool, error) {
+	if a.inventory == nil {
+		return false, nil
+	}
+
+	var known state.InventoryVersion
+	var found bool
+
+	if inState && a.filter != nil {
+		known, found = a.filter.InventoryVersion(ov.key, ov.stateVersionID())
+	}
+
+	if inState && !found {
+		var err error
+
+		known, found, err = a.inventory.GetInventoryVersion(ov.key, ov.stateVersionID())
+		if err != nil {
+			return false, fmt.Errorf("getting version from inventory: %w", err)
+		}
+	}
+
+	if !found || !known.LastModified.Equal(ov.lastModified) || known.IsLatest != ov.isLatest {
+		a.stats.addInventoryNew()
+		return false, nil
+	}
+
+	a.stats.addInventoryUnchanged()
+
+	return true, nil
+}
+
+func (a *retentionAnnotator) record(ov objectVersion) error {
+	if a.inventory == nil {
+		return nil
+	}
+
+	if err := a.inventory.PutInventoryVersion(state.InventoryVersion{
+		Key:          ov.key,
+		VersionID:    ov.stateVersionID(),
+		LastModified: ov.lastModified,
+		Size:         ov.size,
+		DeleteMarker: ov.deleteMarker,
+		IsLatest:     ov.isLatest,
+		RetainUntil:  ov.retainUntil,
+	}, a.now); err != nil {
+		return fmt.Errorf("recording version in inventory: %w", err)
+	}
+
+	a.addToFilter(ov)
+
+	return nil
+}
+
+// run sets the retention configuration on all objects received from the
+// incoming channel before forwarding them to the output channel.
+func (a *retentionAnnotator) run(ctx context.Context, in <-chan objectVersion, out chan<- objectVersion) error {
+	g, ctx := errgroup.WithContext(ctx)
+
+	var panicked workerPanic
+
+	for range max(1, a.workers) {
+		g.Go(func() error {
+			for ov := range in {
+				if ctx.Err() != nil {
+					// Drain input after cancellation.
+					continue
+				}
+
+				a.errorGuard.addProcessed()
+
+				release, err := a.tuner.acquire(ctx)
+				if err != nil {
+					// Cancelled while waiting.
+					continue
+				}
+
+				done := a.timer.track(stageAnnotation)
+
+				err = recoverItem(a.logger, stageAnnotation, func() (err error) {
+					ov, err = a.annotate(ctx, ov)
+					if err == nil {
+						err = a.record(ov)
+					}
+
+					return err
+				})
+
+				done()
+				release()
+
+				if err != nil {
+					a.logger.Error("Retention annotation failed",
+						slog.Any("object", ov),
+						slog.Any("error", err))
+					a.stats.addRetentionAnnotationError()
+					a.stats.addError(err)
+					a.errorGuard.addErrors(1)
+					panicked.add(err)
+
+					if ctx.Err() == nil {
+						// The key is evaluated without the
+						// version.
+						a.watermark.done(ov.key, 1)
+					}
+
+					continue
+				}
+
+				out <- ov
+			}
+
+			return nil
+		})
+	}
+
+	return panicked.wait(g)
+}
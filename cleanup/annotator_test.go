@@ -0,0 +1,487 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/go-cmp/cmp"
+	"github.com/hansmi/s3-object-cleanup/internal/state"
+	"golang.org/x/sync/errgroup"
+)
+
+func newRetentionStateForTest(t *testing.T) *state.Bucket {
+	t.Helper()
+
+	s, err := state.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	b, err := s.Bucket(t.Name())
+	if err != nil {
+		t.Fatalf("Bucket() failed: %v", err)
+	}
+
+	return b
+}
+
+type fakeRetentionClient struct {
+	until time.Time
+	err   error
+}
+
+func (c *fakeRetentionClient) GetObjectRetention(context.Context, string, string) (time.Time, error) {
+	return c.until, c.err
+}
+
+func TestRetentionAnnotator(t *testing.T) {
+	ctx := context.Background()
+
+	want := time.Date(2001, time.January, 1, 2, 3, 0, 0, time.UTC)
+
+	client := fakeRetentionClient{
+		until: want,
+	}
+
+	stats := NewStats()
+
+	a := newRetentionAnnotator(retentionAnnotatorOptions{
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		stats:  stats,
+		state:  newRetentionStateForTest(t),
+		client: &client,
+	})
+
+	for range 5 {
+		got, err := a.annotate(ctx, objectVersion{})
+		if err != nil {
+			t.Errorf("annotate() failed: %v", err)
+		}
+
+		if diff := cmp.Diff(want, got.retainUntil); diff != "" {
+			t.Errorf("annotate() diff (-want +got):\n%s", diff)
+		}
+
+		// Value is cached after the first call.
+		client.err = os.ErrInvalid
+	}
+
+	if stats.stateCacheHitCount != 4 || stats.stateCacheMissCount != 1 {
+		t.Errorf("State cache counts: hit=%d, miss=%d; want 4 and 1",
+			stats.stateCacheHitCount, stats.stateCacheMissCount)
+	}
+}
+
+func TestRetentionAnnotatorWithoutRetention(t *testing.T) {
+	ctx := context.Background()
+
+	client := fakeRetentionClient{}
+	stats := NewStats()
+
+	a := newRetentionAnnotator(retentionAnnotatorOptions{
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		stats:  stats,
+		state:  newRetentionStateForTest(t),
+		client: &client,
+	})
+
+	for range 3 {
+		got, err := a.annotate(ctx, objectVersion{key: "key", versionID: "v1"})
+		if err != nil {
+			t.Errorf("annotate() failed: %v", err)
+		}
+
+		if !got.retainUntil.IsZero() {
+			t.Errorf("annotate() returned retention %v, want zero", got.retainUntil)
+		}
+
+		// Absence of retention is cached after the first call.
+		client.err = os.ErrInvalid
+	}
+
+	if stats.stateCacheHitCount != 2 || stats.stateCacheMissCount != 1 {
+		t.Errorf("State cache counts: hit=%d, miss=%d; want 2 and 1",
+			stats.stateCacheHitCount, stats.stateCacheMissCount)
+	}
+}
+
+type countingRetentionState struct {
+	retentionAnnotatorState
+	gets int
+}
+
+func (s *countingRetentionState) GetObjectRetention(key, versionID string) (time.Time, bool, error) {
+	s.gets++
+	return s.retentionAnnotatorState.GetObjectRetention(key, versionID)
+}
+
+func TestRetentionAnnotatorFilter(t *testing.T) {
+	ctx := context.Background()
+
+	known := time.Date(2002, time.January, 1, 0, 0, 0, 0, time.UTC)
+	fromAPI := time.Date(2003, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	b := newRetentionStateForTest(t)
+
+	if err := b.SetObjectRetention("known", "v1", known); err != nil {
+		t.Fatalf("SetObjectRetention() failed: %v", err)
+	}
+
+	filter, _, err := b.VersionFilter(10, 0.0001)
+	if err != nil {
+		t.Fatalf("VersionFilter() failed: %v", err)
+	}
+
+	st := countingRetentionState{retentionAnnotatorState: b}
+	stats := NewStats()
+
+	a := newRetentionAnnotator(retentionAnnotatorOptions{
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		stats:  stats,
+		state:  &st,
+		client: &fakeRetentionClient{until: fromAPI},
+		filter: filter,
+	})
+
+	for _, tc := range []struct {
+		key      string
+		want     time.Time
+		wantGets int
+	}{
+		// Loaded with the filter.
+		{key: "known", want: known},
+		{key: "new", want: fromAPI},
+		// Added to the filter after the first lookup.
+		{key: "new", want: fromAPI, wantGets: 1},
+	} {
+		got, err := a.annotate(ctx, objectVersion{key: tc.key, versionID: "v1"})
+		if err != nil {
+			t.Errorf("annotate(%q) failed: %v", tc.key, err)
+		}
+
+		if !got.retainUntil.Equal(tc.want) {
+			t.Errorf("annotate(%q) returned retention %v, want %v", tc.key, got.retainUntil, tc.want)
+		}
+
+		if st.gets != tc.wantGets {
+			t.Errorf("State lookups after %q: %d, want %d", tc.key, st.gets, tc.wantGets)
+		}
+	}
+
+	if stats.stateFilterSkipCount != 1 {
+		t.Errorf("Filter skipped %d lookups, want 1", stats.stateFilterSkipCount)
+	}
+}
+
+type fakeHeadClient struct {
+	outputs map[string]*s3.HeadObjectOutput
+	calls   int
+}
+
+func (c *fakeHeadClient) HeadObject(_ context.Context, key, _ string) (*s3.HeadObjectOutput, error) {
+	c.calls++
+	return c.outputs[key], nil
+}
+
+func TestRetentionAnnotatorHeadObject(t *testing.T) {
+	ctx := context.Background()
+
+	until := time.Date(2004, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	head := fakeHeadClient{
+		outputs: map[string]*s3.HeadObjectOutput{
+			"locked": {ObjectLockRetainUntilDate: aws.Time(until)},
+			"plain":  {},
+		},
+	}
+
+	a := newRetentionAnnotator(retentionAnnotatorOptions{
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		stats:      NewStats(),
+		state:      newRetentionStateForTest(t),
+		client:     &fakeRetentionClient{err: os.ErrInvalid},
+		headClient: &head,
+	})
+
+	for _, tc := range []struct {
+		key      string
+		want     time.Time
+		wantHead bool
+	}{
+		{key: "locked", want: until, wantHead: true},
+		{key: "plain", wantHead: true},
+		{key: "missing"},
+		// Cached in the state.
+		{key: "locked", want: until},
+	} {
+		got, err := a.annotate(ctx, objectVersion{key: tc.key, versionID: "v1"})
+		if err != nil {
+			t.Errorf("annotate(%q) failed: %v", tc.key, err)
+		}
+
+		if !got.retainUntil.Equal(tc.want) {
+			t.Errorf("annotate(%q) returned retention %v, want %v", tc.key, got.retainUntil, tc.want)
+		}
+
+		if (got.head != nil) != tc.wantHead {
+			t.Errorf("annotate(%q) returned HeadObject response %v, want %t", tc.key, got.head, tc.wantHead)
+		}
+	}
+
+	if head.calls != 3 {
+		t.Errorf("HeadObject called %d times, want 3", head.calls)
+	}
+}
+
+func TestRetentionAnnotatorNoRetention(t *testing.T) {
+	ctx := context.Background()
+
+	st := countingRetentionState{retentionAnnotatorState: newRetentionStateForTest(t)}
+
+	a := newRetentionAnnotator(retentionAnnotatorOptions{
+		logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		stats:       NewStats(),
+		state:       &st,
+		client:      &fakeRetentionClient{err: os.ErrInvalid},
+		noRetention: true,
+	})
+
+	got, err := a.annotate(ctx, objectVersion{key: "key", versionID: "v1"})
+	if err != nil {
+		t.Errorf("annotate() failed: %v", err)
+	}
+
+	if !got.retainUntil.IsZero() {
+		t.Errorf("annotate() returned retention %v, want zero", got.retainUntil)
+	}
+
+	if st.gets != 0 {
+		t.Errorf("State lookups: %d, want none", st.gets)
+	}
+}
+
+func TestRetentionAnnotatorRun(t *testing.T) {
+	ctx := context.Background()
+
+	in := make(chan objectVersion)
+	out := make(chan objectVersion)
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		defer close(in)
+
+		for i := range 10 {
+			in <- objectVersion{
+				key: fmt.Sprint(i),
+			}
+		}
+
+		return nil
+	})
+	g.Go(func() error {
+		defer close(out)
+
+		client := fakeRetentionClient{
+			until: time.Date(2003, time.June, 1, 2, 3, 0, 0, time.UTC),
+		}
+
+		a := newRetentionAnnotator(retentionAnnotatorOptions{
+			logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+			stats:  NewStats(),
+			state:  newRetentionStateForTest(t),
+			client: &client,
+		})
+
+		if err := a.run(ctx, in, out); err != nil {
+			t.Errorf("run() failed: %v", err)
+			return err
+		}
+
+		return nil
+	})
+	g.Go(func() error {
+		var got []string
+
+		for ov := range out {
+			got = append(got, ov.key)
+		}
+
+		sort.Strings(got)
+
+		want := strings.Split("0123456789", "")
+
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("run() output diff (-want +got):\n%s", diff)
+		}
+
+		return nil
+	})
+
+	if err := g.Wait(); err != nil {
+		t.Errorf("Test failed: %v", err)
+	}
+}
+
+func TestRetentionAnnotatorRunError(t *testing.T) {
+	errTest := errors.New("test")
+
+	in := make(chan objectVersion)
+	out := make(chan objectVersion)
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for range out {
+		}
+	}()
+
+	finished := make(chan struct{})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(in)
+
+		// Send objects until we're told to stop.
+		for range 100 {
+			select {
+			case <-finished:
+				return
+
+			case in <- objectVersion{}:
+			}
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(finished)
+		defer close(out)
+
+		client := fakeRetentionClient{
+			err: errTest,
+		}
+
+		a := newRetentionAnnotator(retentionAnnotatorOptions{
+			logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+			stats:  NewStats(),
+			state:  newRetentionStateForTest(t),
+			client: &client,
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		t.Cleanup(cancel)
+
+		if err := a.run(ctx, in, out); err != nil {
+			t.Errorf("run() failed: %v", err)
+		}
+	}()
+
+	wg.Wait()
+}
+
+func TestRetentionAnnotatorInventory(t *testing.T) {
+	ctx := context.Background()
+
+	b := newRetentionStateForTest(t)
+	stats := NewStats()
+	client := fakeRetentionClient{}
+
+	a := newRetentionAnnotator(retentionAnnotatorOptions{
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		stats:     stats,
+		state:     b,
+		client:    &client,
+		inventory: b,
+	})
+
+	ov := objectVersion{
+		key:          "key",
+		versionID:    "v1",
+		lastModified: time.Date(2002, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	for range 2 {
+		got, err := a.annotate(ctx, ov)
+		if err != nil {
+			t.Errorf("annotate() failed: %v", err)
+		}
+
+		if err := a.record(got); err != nil {
+			t.Errorf("record() failed: %v", err)
+		}
+
+		// Unchanged versions are not looked up again.
+		client.err = os.ErrInvalid
+	}
+
+	changed := ov
+	changed.lastModified = changed.lastModified.Add(time.Hour)
+
+	if _, err := a.annotate(ctx, changed); !errors.Is(err, os.ErrInvalid) {
+		t.Errorf("annotate() for changed version returned %v, want %v", err, os.ErrInvalid)
+	}
+
+	if stats.inventoryNewCount != 2 || stats.inventoryUnchangedCount != 1 {
+		t.Errorf("Inventory counts: new=%d, unchanged=%d; want 2 and 1",
+			stats.inventoryNewCount, stats.inventoryUnchangedCount)
+	}
+}
+
+func TestRetentionAnnotatorInventoryWithoutState(t *testing.T) {
+	ctx := context.Background()
+
+	inventory := newRetentionStateForTest(t)
+	until := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	ov := objectVersion{
+		key:          "key",
+		versionID:    "v1",
+		lastModified: time.Date(2002, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	if err := inventory.PutInventoryVersion(state.InventoryVersion{
+		Key:          ov.key,
+		VersionID:    ov.versionID,
+		LastModified: ov.lastModified,
+		RetainUntil:  until.Add(-time.Hour),
+	}, time.Now()); err != nil {
+		t.Fatalf("PutInventoryVersion() failed: %v", err)
+	}
+
+	client := fakeRetentionClient{until: until}
+
+	a := newRetentionAnnotator(retentionAnnotatorOptions{
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		stats:     NewStats(),
+		state:     newRetentionStateForTest(t),
+		client:    &client,
+		inventory: inventory,
+	})
+
+	got, err := a.annotate(ctx, ov)
+	if err != nil {
+		t.Errorf("annotate() failed: %v", err)
+	}
+
+	// The retention recorded in the inventory may predate an extension.
+	if !got.unchanged || !got.retainUntil.Equal(until) {
+		t.Errorf("annotate() returned unchanged=%v, retainUntil=%v; want true and %v",
+			got.unchanged, got.retainUntil, until)
+	}
+}
@@ -0,0 +1,60 @@
+package cleanup
+
+import (
+	"context"
+
+	"github.com/aws/smithy-go/middleware"
+)
+
+// Approximate request prices in USD per 1000 requests for S3 Standard in
+// us-east-1. Prices differ between regions and storage classes.
+const (
+	// PUT, COPY, POST and LIST requests.
+	requestPriceClassA = 0.005
+
+	// GET, HEAD and all other requests.
+	requestPriceClassB = 0.0004
+)
+
+// requestPrice returns the approximate price of a single request for the
+// given S3 operation.
+func requestPrice(operation string) float64 {
+	switch operation {
+	case "DeleteObject", "DeleteObjects", "AbortMultipartUpload":
+		// DELETE requests are free.
+		return 0
+
+	case "ListObjectVersions", "ListObjectsV2", "ListObjects",
+		"PutObject", "PutObjectRetention", "PutObjectLegalHold",
+		"CopyObject", "CreateMultipartUpload", "UploadPart",
+		"UploadPartCopy", "CompleteMultipartUpload":
+		return requestPriceClassA / 1000
+	}
+
+	return requestPriceClassB / 1000
+}
+
+type requestStatsKey struct{}
+
+// WithRequestStats returns a context whose API requests are counted in the
+// given statistics instead of those passed to [NewRequestCounter].
+func WithRequestStats(ctx context.Context, s *Stats) context.Context {
+	return context.WithValue(ctx, requestStatsKey{}, s)
+}
+
+// NewRequestCounter returns an API option counting every request attempt,
+// including retries, by operation name.
+func NewRequestCounter(count func(operation string)) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("CountRequests",
+			func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+				if s, ok := ctx.Value(requestStatsKey{}).(*Stats); ok {
+					s.AddAPIRequest(middleware.GetOperationName(ctx))
+				} else {
+					count(middleware.GetOperationName(ctx))
+				}
+
+				return next.HandleFinalize(ctx, in)
+			}), middleware.After)
+	}
+}
@@ -0,0 +1,103 @@
+package cleanup
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/google/go-cmp/cmp"
+)
+
+type fakeHTTPClient struct {
+	statusCodes []int
+}
+
+func (c *fakeHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	code := http.StatusOK
+
+	if len(c.statusCodes) > 0 {
+		code, c.statusCodes = c.statusCodes[0], c.statusCodes[1:]
+	}
+
+	return &http.Response{
+		StatusCode: code,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
+
+func TestRequestPrice(t *testing.T) {
+	for _, tc := range []struct {
+		operation string
+		want      float64
+	}{
+		{"DeleteObjects", 0},
+		{"DeleteObject", 0},
+		{"ListObjectVersions", requestPriceClassA / 1000},
+		{"PutObjectRetention", requestPriceClassA / 1000},
+		{"GetObjectRetention", requestPriceClassB / 1000},
+		{"HeadObject", requestPriceClassB / 1000},
+		{"", requestPriceClassB / 1000},
+	} {
+		t.Run(tc.operation, func(t *testing.T) {
+			if got := requestPrice(tc.operation); got != tc.want {
+				t.Errorf("requestPrice(%q) = %v, want %v", tc.operation, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRequestCounter(t *testing.T) {
+	got := map[string]int{}
+
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String("http://localhost"),
+		UsePathStyle: true,
+		Credentials:  aws.AnonymousCredentials{},
+		Retryer: retry.NewStandard(func(o *retry.StandardOptions) {
+			o.Backoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) {
+				return 0, nil
+			})
+		}),
+		HTTPClient: &fakeHTTPClient{
+			statusCodes: []int{http.StatusServiceUnavailable},
+		},
+		APIOptions: []func(*middleware.Stack) error{
+			NewRequestCounter(func(operation string) {
+				got[operation]++
+			}),
+		},
+	})
+
+	if _, err := client.DeleteObject(t.Context(), &s3.DeleteObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("key"),
+	}); err != nil {
+		t.Errorf("DeleteObject() failed: %v", err)
+	}
+
+	if _, err := client.GetObjectRetention(t.Context(), &s3.GetObjectRetentionInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("key"),
+	}); err != nil {
+		t.Errorf("GetObjectRetention() failed: %v", err)
+	}
+
+	// Retried attempts are billed and counted too.
+	want := map[string]int{
+		"DeleteObject":       2,
+		"GetObjectRetention": 1,
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Request counts diff (-want +got):\n%s", diff)
+	}
+}
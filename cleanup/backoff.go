@@ -0,0 +1,106 @@
+package cleanup
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hansmi/s3-object-cleanup/internal/client"
+)
+
+// adaptiveBackoff slows down all API callers of a pipeline once S3 signals
+// throttling. The delay inserted before each request doubles with every
+// throttled response and decays again with successful requests.
+type adaptiveBackoff struct {
+	mu    sync.Mutex
+	stats *Stats
+	delay time.Duration
+
+	minDelay    time.Duration
+	maxDelay    time.Duration
+	maxAttempts int
+}
+
+func newAdaptiveBackoff(stats *Stats) *adaptiveBackoff {
+	return &adaptiveBackoff{
+		stats:       stats,
+		minDelay:    100 * time.Millisecond,
+		maxDelay:    30 * time.Second,
+		maxAttempts: 10,
+	}
+}
+
+func (b *adaptiveBackoff) current() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.delay
+}
+
+func (b *adaptiveBackoff) throttled() {
+	b.mu.Lock()
+	b.delay = min(b.maxDelay, max(b.minDelay, 2*b.delay))
+	b.mu.Unlock()
+
+	if b.stats != nil {
+		b.stats.addThrottled()
+	}
+}
+
+func (b *adaptiveBackoff) succeeded() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.delay > 0 {
+		b.delay -= b.delay / 4
+
+		if b.delay < b.minDelay {
+			b.delay = 0
+		}
+	}
+}
+
+func (b *adaptiveBackoff) wait(ctx context.Context) error {
+	delay := b.current()
+
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+	}
+
+	return nil
+}
+
+// do invokes fn until it succeeds, fails with an error other than throttling
+// or the maximum number of attempts is reached.
+func (b *adaptiveBackoff) do(ctx context.Context, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		if err := b.wait(ctx); err != nil {
+			return err
+		}
+
+		err := fn()
+
+		if !client.IsThrottling(err) {
+			if err == nil {
+				b.succeeded()
+			}
+
+			return err
+		}
+
+		b.throttled()
+
+		if attempt >= b.maxAttempts {
+			return err
+		}
+	}
+}
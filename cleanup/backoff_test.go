@@ -0,0 +1,109 @@
+package cleanup
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAdaptiveBackoff(t *testing.T) {
+	errSlowDown := &smithy.GenericAPIError{Code: "SlowDown"}
+
+	for _, tc := range []struct {
+		name          string
+		errors        []error
+		wantErr       error
+		wantCalls     int
+		wantThrottled int64
+	}{
+		{
+			name:      "success",
+			errors:    []error{nil},
+			wantCalls: 1,
+		},
+		{
+			name:      "other error",
+			errors:    []error{os.ErrInvalid},
+			wantErr:   os.ErrInvalid,
+			wantCalls: 1,
+		},
+		{
+			name:          "throttled once",
+			errors:        []error{errSlowDown, nil},
+			wantCalls:     2,
+			wantThrottled: 1,
+		},
+		{
+			name:          "throttled until limit",
+			errors:        []error{errSlowDown, errSlowDown, errSlowDown, errSlowDown},
+			wantErr:       errSlowDown,
+			wantCalls:     3,
+			wantThrottled: 3,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stats := NewStats()
+
+			b := newAdaptiveBackoff(stats)
+			b.minDelay = time.Millisecond
+			b.maxDelay = 10 * time.Millisecond
+			b.maxAttempts = 3
+
+			var calls int
+
+			err := b.do(context.Background(), func() error {
+				err := tc.errors[calls]
+				calls++
+				return err
+			})
+
+			if diff := cmp.Diff(tc.wantErr, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("Error diff (-want +got):\n%s", diff)
+			}
+
+			if calls != tc.wantCalls {
+				t.Errorf("Function called %d times, want %d", calls, tc.wantCalls)
+			}
+
+			if got := stats.throttledCount; got != tc.wantThrottled {
+				t.Errorf("throttledCount=%d, want %d", got, tc.wantThrottled)
+			}
+		})
+	}
+}
+
+func TestAdaptiveBackoffDelay(t *testing.T) {
+	b := newAdaptiveBackoff(nil)
+	b.minDelay = time.Second
+	b.maxDelay = 5 * time.Second
+
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second} {
+		b.throttled()
+
+		if got := b.current(); got != want {
+			t.Errorf("Delay after throttling is %v, want %v", got, want)
+		}
+	}
+
+	for range 10 {
+		b.succeeded()
+	}
+
+	if got := b.current(); got != 0 {
+		t.Errorf("Delay after successes is %v, want zero", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	b.throttled()
+
+	if err := b.wait(ctx); err != context.Canceled {
+		t.Errorf("wait() with cancelled context returned %v", err)
+	}
+}
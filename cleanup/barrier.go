@@ -0,0 +1,97 @@
+package cleanup
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// retentionBarrier holds back the deletions of a key until the retention
+// extensions for its remaining versions have completed. Deleting versions
+// while the extension of the retained ones fails would leave the key with
+// neither protection nor cleanup, so the deletions are skipped in that case
+// and made by a later run.
+type retentionBarrier struct {
+	mu      sync.Mutex
+	key     string
+	pending int
+	failed  bool
+	expired []objectVersion
+	release func(*retentionBarrier)
+}
+
+// complete records the outcome of one retention extension. The deletions are
+// released once all extensions have completed.
+func (b *retentionBarrier) complete(err error) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	b.pending--
+	b.failed = b.failed || err != nil
+	last := b.pending == 0
+	b.mu.Unlock()
+
+	if last {
+		b.release(b)
+	}
+}
+
+// retentionBarriers tracks the barriers of a run. All of them must have been
+// released before the deletion channel is closed.
+type retentionBarriers struct {
+	logger   *slog.Logger
+	stats    *Stats
+	actions  *ActionRecorder
+	deleteCh chan<- objectVersion
+	wg       sync.WaitGroup
+
+	// Skipped deletions are reported as processed if set.
+	watermark *listWatermark
+}
+
+// add returns a barrier holding back the expired versions until the given
+// number of retention extensions have completed.
+func (g *retentionBarriers) add(key string, extensions int, expired []objectVersion) *retentionBarrier {
+	g.wg.Add(1)
+
+	return &retentionBarrier{
+		key:     key,
+		pending: extensions,
+		expired: expired,
+		release: g.release,
+	}
+}
+
+func (g *retentionBarriers) release(b *retentionBarrier) {
+	defer g.wg.Done()
+
+	if !b.failed {
+		for _, ov := range b.expired {
+			g.deleteCh <- ov
+		}
+
+		return
+	}
+
+	g.logger.Warn("Deletions skipped after retention extension failed",
+		slog.String("key", b.key),
+		slog.Int("expired", len(b.expired)),
+	)
+
+	g.stats.addRetentionBarrierSkipped(len(b.expired))
+	g.watermark.done(b.key, len(b.expired))
+
+	if g.actions != nil {
+		for _, ov := range b.expired {
+			g.actions.addSkip(ov, actionReasonRetentionFailed)
+		}
+	}
+}
+
+// wait blocks until all barriers have been released.
+func (g *retentionBarriers) wait() {
+	if g != nil {
+		g.wg.Wait()
+	}
+}
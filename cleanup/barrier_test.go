@@ -0,0 +1,131 @@
+package cleanup
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRetentionBarrier(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		errs        []error
+		wantDeleted []string
+		wantActions []string
+		wantSkipped int64
+	}{
+		{
+			name:        "success",
+			errs:        []error{nil, nil},
+			wantDeleted: []string{"key@old1", "key@old2"},
+		},
+		{
+			name: "failure",
+			errs: []error{nil, os.ErrInvalid},
+			wantActions: []string{
+				"skip key@old1 retention_failed",
+				"skip key@old2 retention_failed",
+			},
+			wantSkipped: 2,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			l := newActionLogForTest(&buf)
+			stats := NewStats()
+			deleteCh := make(chan objectVersion, 8)
+
+			g := &retentionBarriers{
+				logger:   slog.New(slog.DiscardHandler),
+				stats:    stats,
+				actions:  l.ForBucket("bucket"),
+				deleteCh: deleteCh,
+			}
+
+			b := g.add("key", len(tc.errs), []objectVersion{
+				{key: "key", versionID: "old1"},
+				{key: "key", versionID: "old2"},
+			})
+
+			for _, err := range tc.errs {
+				if len(deleteCh) != 0 {
+					t.Errorf("Deletions released before all extensions completed")
+				}
+
+				b.complete(err)
+			}
+
+			g.wait()
+			close(deleteCh)
+
+			var deleted []string
+
+			for ov := range deleteCh {
+				deleted = append(deleted, ov.key+"@"+ov.versionID)
+			}
+
+			if diff := cmp.Diff(tc.wantDeleted, deleted); diff != "" {
+				t.Errorf("Deleted versions diff (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tc.wantActions, parseActionLog(t, l, &buf)); diff != "" {
+				t.Errorf("Action log diff (-want +got):\n%s", diff)
+			}
+
+			if got := stats.retentionBarrierSkippedCount; got != tc.wantSkipped {
+				t.Errorf("Skipped %d deletions, want %d", got, tc.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestProcessorRetentionBarrier(t *testing.T) {
+	now := time.Now()
+
+	p := newProcessor(processorOptions{
+		logger:           slog.New(slog.DiscardHandler),
+		stats:            NewStats(),
+		minRetention:     24 * time.Hour,
+		minDeletionAge:   24 * time.Hour,
+		retentionBarrier: true,
+	})
+
+	in := make(chan objectVersion, 8)
+	retentionCh := make(chan retentionExtenderRequest, 8)
+	deleteCh := make(chan objectVersion, 8)
+
+	in <- objectVersion{key: "key", versionID: "old", lastModified: now.Add(-72 * time.Hour)}
+	in <- objectVersion{key: "key", versionID: "new", lastModified: now.Add(-48 * time.Hour), isLatest: true}
+	close(in)
+
+	done := make(chan error)
+
+	go func() {
+		done <- p.run(in, retentionCh, deleteCh)
+	}()
+
+	req := <-retentionCh
+
+	if req.barrier == nil {
+		t.Fatalf("Retention request without barrier")
+	}
+
+	if len(deleteCh) != 0 {
+		t.Errorf("Deletion sent before retention extension completed")
+	}
+
+	req.barrier.complete(nil)
+
+	if err := <-done; err != nil {
+		t.Errorf("run() failed: %v", err)
+	}
+
+	if got := <-deleteCh; got.key != "key" || got.versionID != "old" {
+		t.Errorf("Expired version %s/%s, want key/old", got.key, got.versionID)
+	}
+}
@@ -0,0 +1,91 @@
+package cleanup
+
+import "sync"
+
+type watermarkKey struct {
+	key     string
+	pending int
+}
+
+// listWatermark tracks the processing of listed keys across the pipeline
+// stages. Every stage finishing with a version of a key reports it, and the
+// low-water mark is the last key up to which all keys in listing order have
+// been processed completely. Resuming a listing after that key never skips a
+// version which hasn't been annotated, evaluated, extended and deleted yet.
+//
+// A nil value is valid and ignores all reports.
+type listWatermark struct {
+	mu    sync.Mutex
+	keys  map[string]*watermarkKey
+	order []*watermarkKey
+
+	// Invoked with the position after the low-water mark whenever it
+	// advances. Called with the lock held.
+	record func(listMarker)
+}
+
+// newListWatermark returns a tracker reporting the low-water mark to the given
+// function. Nil is returned if the function is nil.
+func newListWatermark(record func(listMarker)) *listWatermark {
+	if record == nil {
+		return nil
+	}
+
+	return &listWatermark{
+		keys:   map[string]*watermarkKey{},
+		record: record,
+	}
+}
+
+// add records outstanding work for the versions of a key. Keys must first be
+// added in listing order.
+func (w *listWatermark) add(key string, count int) {
+	if w == nil || count == 0 {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	k, ok := w.keys[key]
+	if !ok {
+		k = &watermarkKey{key: key}
+		w.keys[key] = k
+		w.order = append(w.order, k)
+	}
+
+	k.pending += count
+}
+
+// done records the completion of work previously added for a key.
+func (w *listWatermark) done(key string, count int) {
+	if w == nil || count == 0 {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	k, ok := w.keys[key]
+	if !ok {
+		return
+	}
+
+	k.pending -= count
+
+	var last *watermarkKey
+
+	for len(w.order) > 0 && w.order[0].pending <= 0 {
+		last = w.order[0]
+
+		delete(w.keys, last.key)
+		w.order[0] = nil
+		w.order = w.order[1:]
+	}
+
+	if last != nil {
+		// Without a version ID marker the listing continues with the
+		// next key.
+		w.record(listMarker{keyMarker: last.key})
+	}
+}
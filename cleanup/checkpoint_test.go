@@ -0,0 +1,57 @@
+package cleanup
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestListWatermark(t *testing.T) {
+	var got []string
+
+	w := newListWatermark(func(m listMarker) {
+		if m.versionIDMarker != "" {
+			t.Errorf("Marker %+v has version ID", m)
+		}
+
+		got = append(got, m.keyMarker)
+	})
+
+	w.add("a", 2)
+	w.add("b", 1)
+	w.add("c", 3)
+
+	// Evaluation of "b" requests a deletion.
+	w.add("b", 1)
+	w.done("b", 1)
+
+	// Keys after the first unfinished key don't advance the mark.
+	w.done("c", 3)
+	w.done("a", 1)
+
+	if len(got) != 0 {
+		t.Errorf("Marks %q recorded before first key was processed", got)
+	}
+
+	w.done("a", 1)
+	w.done("unknown", 1)
+
+	w.add("d", 1)
+
+	// The deletion of "b" completes.
+	w.done("b", 1)
+	w.done("d", 1)
+
+	if diff := cmp.Diff([]string{"a", "c", "d"}, got); diff != "" {
+		t.Errorf("Marks diff (-want +got):\n%s", diff)
+	}
+
+	var disabled *listWatermark
+
+	disabled.add("a", 1)
+	disabled.done("a", 1)
+
+	if newListWatermark(nil) != nil {
+		t.Errorf("newListWatermark(nil) returned tracker")
+	}
+}
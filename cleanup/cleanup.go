@@ -0,0 +1,1630 @@
+package cleanup
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hansmi/s3-object-cleanup/internal/client"
+	"github.com/hansmi/s3-object-cleanup/internal/state"
+	"golang.org/x/sync/errgroup"
+)
+
+type versionSeriesResult struct {
+	expired   []objectVersion
+	retention []retentionExtenderRequest
+
+	// Earliest time at which evaluating the unchanged series again may lead
+	// to actions. Zero if the series must be evaluated on every run.
+	due time.Time
+
+	// Rules which fired for each version of the series, in the same order.
+	// Only recorded for the decision trace.
+	rules versionRules
+}
+
+// dueTracker determines the earliest of a number of points in time.
+type dueTracker struct {
+	earliest time.Time
+	set      bool
+	always   bool
+}
+
+func (t *dueTracker) add(at time.Time) {
+	if at.IsZero() {
+		t.always = true
+	} else if !t.set || at.Before(t.earliest) {
+		t.earliest = at
+		t.set = true
+	}
+}
+
+// addRetention takes into account when the retention of a version needs to be
+// extended.
+func (t *dueTracker) addRetention(ov objectVersion, threshold time.Duration) {
+	if ov.deleteMarker {
+		return
+	}
+
+	if ov.retainUntil.IsZero() {
+		t.always = true
+	} else {
+		t.add(ov.retainUntil.Add(-threshold))
+	}
+}
+
+func (t *dueTracker) result() time.Time {
+	if t.always || !t.set {
+		return time.Time{}
+	}
+
+	return t.earliest
+}
+
+// unchanged reports whether the versions of the series have not changed
+// since the previous run.
+func (s *versionSeries) unchanged() bool {
+	if !s.haveLatest {
+		return false
+	}
+
+	for _, ov := range s.items {
+		if !ov.unchanged {
+			return false
+		}
+	}
+
+	return true
+}
+
+type versionSeries struct {
+	items      []objectVersion
+	haveLatest bool
+}
+
+func (s *versionSeries) add(v objectVersion) {
+	s.haveLatest = s.haveLatest || v.isLatest
+
+	if len(s.items) == 0 {
+		s.items = append(s.items, v)
+		return
+	}
+
+	// Maintain a sorted list of items. Versions with identical modification
+	// times keep the order in which they were listed, newest first.
+	pos, _ := slices.BinarySearchFunc(s.items, v, func(a, b objectVersion) int {
+		return cmp.Or(
+			a.lastModified.Compare(b.lastModified),
+			cmp.Compare(b.listOrder, a.listOrder),
+			cmp.Compare(a.versionID, b.versionID),
+		)
+	})
+
+	s.items = slices.Insert(s.items, pos, v)
+}
+
+type versionSeriesFinalizeOptions struct {
+	now            time.Time
+	minRetention   time.Duration
+	minDeletionAge time.Duration
+
+	// Noncurrent versions beyond the given number of most recent ones expire
+	// regardless of their age. Disabled if zero.
+	maxNoncurrentVersions int
+
+	// Measure the age of a version from the time its successor was created,
+	// i.e. when it became noncurrent, instead of its own creation time.
+	ageFromNoncurrent bool
+
+	// Retention is extended once the remaining duration drops below the
+	// threshold. Only used for determining the due time.
+	minRetentionThreshold time.Duration
+
+	// Handling of keys whose latest version is a delete marker.
+	deleteMarkers DeleteMarkerStrategy
+
+	// Record the rules which fired for the decision trace.
+	trace bool
+}
+
+func (o *versionSeriesFinalizeOptions) extendFromNow(ov objectVersion) (retentionExtenderRequest, bool) {
+	origin := o.now
+
+	if origin.Before(ov.lastModified) {
+		origin = ov.lastModified
+	}
+
+	return o.extend(ov, origin.Add(o.minRetention))
+}
+
+func (o *versionSeriesFinalizeOptions) extend(ov objectVersion, until time.Time) (retentionExtenderRequest, bool) {
+	req := retentionExtenderRequest{
+		object: ov,
+		until:  until,
+	}
+
+	return req, (ov.retainUntil.IsZero() || ov.retainUntil.Before(req.until)) && !ov.deleteMarker
+}
+
+func (s *versionSeries) finalize(opts versionSeriesFinalizeOptions) (result versionSeriesResult) {
+	var due dueTracker
+
+	rules := newVersionRules(opts.trace, len(s.items))
+
+	defer func() {
+		if len(result.expired) > 0 {
+			// Deletions may fail.
+			due.always = true
+		}
+
+		result.due = due.result()
+		result.rules = rules
+	}()
+
+	// Apply the default retention extension and avoid deletions unless the
+	// latest version is known.
+	if !s.haveLatest {
+		due.always = true
+
+		for idx, ov := range s.items {
+			if req, ok := opts.extendFromNow(ov); ok {
+				result.retention = append(result.retention, req)
+			}
+
+			rules.set(idx, ruleLatestUnknown, time.Time{})
+		}
+
+		return
+	}
+
+	pos := len(s.items) - 1
+
+	// Number of noncurrent versions up to and including the version at pos.
+	noncurrentOffset := 0
+
+	// Look for latest version and extend all versions until there.
+	for ; pos >= 0; pos-- {
+		ov := s.items[pos]
+
+		if ov.isLatest {
+			switch {
+			case !ov.deleteMarker:
+				if req, ok := opts.extendFromNow(ov); ok {
+					result.retention = append(result.retention, req)
+				}
+
+				due.addRetention(ov, opts.minRetentionThreshold)
+				rules.set(pos, ruleLatest, time.Time{})
+
+			case opts.deleteMarkers == DeleteMarkerSkip:
+				result = versionSeriesResult{}
+				due = dueTracker{}
+				rules.setRange(0, len(s.items), ruleDeleteMarkerSkip, time.Time{})
+				return
+
+			case opts.deleteMarkers == DeleteMarkerExpire:
+				// The marker is deleted once no older versions remain.
+				pos++
+				noncurrentOffset = -1
+
+			case opts.deleteMarkers == DeleteMarkerKeep:
+				// All versions preceding the marker are noncurrent.
+				rules.set(pos, ruleDeleteMarkerKeep, time.Time{})
+
+			default:
+				// Delete markers don't support retention periods.
+				expires := ov.lastModified.Add(opts.minDeletionAge)
+
+				if expires.Before(opts.now) {
+					// Already expired
+					pos++
+					noncurrentOffset = -1
+					break
+				}
+
+				due.add(expires)
+				rules.set(pos, ruleDeleteMarkerPending, expires)
+
+				// The version preserved below is noncurrent.
+				noncurrentOffset = 1
+
+				// Extend retention of the most recent regular version
+				// preceding the delete marker.
+				for pos--; pos >= 0; pos-- {
+					ov = s.items[pos]
+
+					rules.set(pos, rulePrecedesDeleteMarker, expires)
+
+					if ov.deleteMarker {
+						continue
+					}
+
+					if req, ok := opts.extend(ov, expires); ok {
+						result.retention = append(result.retention, req)
+						due.addRetention(ov, opts.minRetentionThreshold)
+					}
+
+					break
+				}
+			}
+
+			break
+		}
+
+		if req, ok := opts.extendFromNow(ov); ok {
+			result.retention = append(result.retention, req)
+		}
+
+		due.addRetention(ov, opts.minRetentionThreshold)
+		rules.set(pos, ruleNewerThanLatest, time.Time{})
+	}
+
+	if pos >= 0 {
+		cutoff := opts.now.Add(-opts.minDeletionAge)
+
+		// Versions before this index exceed the maximum number of noncurrent
+		// versions.
+		countCutoff := -1
+
+		if opts.maxNoncurrentVersions > 0 {
+			countCutoff = pos + noncurrentOffset - opts.maxNoncurrentVersions
+		}
+
+		for idx, ov := range s.items[:pos] {
+			if ov.isLatest && opts.deleteMarkers == DeleteMarkerExpire {
+				result.expired = append(result.expired, ov)
+				rules.set(idx, ruleDeleteMarkerExpire, time.Time{})
+				break
+			}
+
+			since := ov.lastModified
+
+			if opts.ageFromNoncurrent && idx+1 < len(s.items) {
+				since = s.items[idx+1].lastModified
+			}
+
+			eligible := since.Add(opts.minDeletionAge)
+
+			if idx >= countCutoff && !since.Before(cutoff) {
+				at := eligible
+
+				if ov.retainUntil.After(at) {
+					at = ov.retainUntil
+				}
+
+				due.add(at)
+				rules.set(idx, ruleMinAge, eligible)
+				rules.setRange(idx+1, pos, ruleNewerThanKept, time.Time{})
+				break
+			}
+
+			if !(ov.retainUntil.IsZero() || ov.retainUntil.Before(opts.now)) {
+				due.add(ov.retainUntil)
+				rules.set(idx, ruleRetentionActive, ov.retainUntil)
+				rules.setRange(idx+1, pos, ruleNewerThanKept, time.Time{})
+				break
+			}
+
+			result.expired = append(result.expired, ov)
+
+			if since.Before(cutoff) {
+				rules.set(idx, ruleExpired, eligible)
+			} else {
+				rules.set(idx, ruleMaxNoncurrent, time.Time{})
+			}
+		}
+	}
+
+	return
+}
+
+type processorKeyDueState interface {
+	GetKeyDue(string) (time.Time, bool, error)
+	SetKeyDue(string, time.Time, time.Time) error
+}
+
+type processor struct {
+	logger         *slog.Logger
+	stats          *Stats
+	report         *ReportBuilder
+	actions        *ActionRecorder
+	excludeKeys    *KeyManifest
+	minDeletionAge time.Duration
+	policy         Policy
+	keyDue         processorKeyDueState
+	incremental    bool
+	staging        versionSeriesStaging
+	noRetention    bool
+	deleteFraction *deleteFractionGuard
+	clockOffset    time.Duration
+	traceDecisions bool
+	barriers       *retentionBarriers
+	watermark      *listWatermark
+
+	minSurvivingVersions int
+	protectedPrefixes    []string
+}
+
+type processorOptions struct {
+	logger                *slog.Logger
+	stats                 *Stats
+	report                *ReportBuilder
+	actions               *ActionRecorder
+	minDeletionAge        time.Duration
+	minRetention          time.Duration
+	maxNoncurrentVersions int
+	ageFromNoncurrent     bool
+	minRetentionThreshold time.Duration
+	deleteMarkers         DeleteMarkerStrategy
+
+	// Decides the actions for each version series. Built from the retention
+	// and deletion settings if nil.
+	policy Policy
+
+	// Versions of matching keys are never touched.
+	excludeKeys *KeyManifest
+
+	// Record when keys need to be evaluated again. Disabled if nil.
+	keyDue processorKeyDueState
+
+	// Skip keys whose versions are unchanged and which aren't due yet.
+	// Requires keyDue.
+	incremental bool
+
+	// Versions of keys not yet finalized. Kept in memory if nil.
+	staging versionSeriesStaging
+
+	// Versions can't have retention, e.g. because Object Lock isn't enabled
+	// for the bucket. No retention extensions are requested.
+	noRetention bool
+
+	// Counts the discovered versions for limiting deletions. Disabled if
+	// nil.
+	deleteFraction *deleteFractionGuard
+
+	// Keys left with fewer versions after deleting the expired ones are
+	// skipped. Disabled if zero.
+	minSurvivingVersions int
+
+	// Versions of keys with any of the prefixes are never touched,
+	// regardless of other settings.
+	protectedPrefixes []string
+
+	// Added to the local time to correct for clock skew.
+	clockOffset time.Duration
+
+	// Log the decision for every version at debug level.
+	traceDecisions bool
+
+	// Hold back the deletions of a key until the retention extensions for
+	// its other versions have completed and skip them if any failed.
+	// Requires the retention requests to be processed.
+	retentionBarrier bool
+
+	// Tracks the processing of listed keys for resuming the listing.
+	// Disabled if nil.
+	watermark *listWatermark
+}
+
+func newProcessor(opts processorOptions) *processor {
+	if opts.logger == nil {
+		opts.logger = slog.Default()
+	}
+
+	if opts.policy == nil {
+		opts.policy = defaultPolicy{
+			opts: versionSeriesFinalizeOptions{
+				minDeletionAge:        opts.minDeletionAge,
+				minRetention:          opts.minRetention,
+				maxNoncurrentVersions: opts.maxNoncurrentVersions,
+				ageFromNoncurrent:     opts.ageFromNoncurrent,
+				minRetentionThreshold: opts.minRetentionThreshold,
+				deleteMarkers:         opts.deleteMarkers,
+				trace:                 opts.traceDecisions,
+			},
+		}
+	}
+
+	p := &processor{
+		logger:         opts.logger,
+		stats:          opts.stats,
+		report:         opts.report,
+		actions:        opts.actions,
+		excludeKeys:    opts.excludeKeys,
+		minDeletionAge: opts.minDeletionAge,
+		policy:         opts.policy,
+		keyDue:         opts.keyDue,
+		incremental:    opts.incremental && opts.keyDue != nil,
+		staging:        opts.staging,
+		noRetention:    opts.noRetention,
+		deleteFraction: opts.deleteFraction,
+		clockOffset:    opts.clockOffset,
+		traceDecisions: opts.traceDecisions,
+		watermark:      opts.watermark,
+
+		minSurvivingVersions: opts.minSurvivingVersions,
+		protectedPrefixes:    opts.protectedPrefixes,
+	}
+
+	if opts.retentionBarrier {
+		p.barriers = &retentionBarriers{
+			logger:    opts.logger,
+			stats:     opts.stats,
+			actions:   opts.actions,
+			watermark: opts.watermark,
+		}
+	}
+
+	return p
+}
+
+// excluded reports whether a version must not be touched and records the
+// reason.
+func (p *processor) excluded(ov objectVersion) bool {
+	reason := ""
+
+	switch {
+	case slices.ContainsFunc(p.protectedPrefixes, func(prefix string) bool {
+		return strings.HasPrefix(ov.key, prefix)
+	}):
+		p.stats.addProtected()
+		reason = actionReasonProtected
+
+	case p.excludeKeys != nil && p.excludeKeys.match(ov.key):
+		p.stats.addExcluded()
+		reason = actionReasonExcludedKey
+
+	default:
+		return false
+	}
+
+	if p.actions != nil {
+		p.actions.addSkip(ov, reason)
+	}
+
+	p.watermark.done(ov.key, 1)
+
+	return true
+}
+
+// skip reports whether evaluating the versions of a key can be skipped in an
+// incremental run.
+func (p *processor) skip(key string, s *versionSeries, now time.Time) bool {
+	if !(p.incremental && s.unchanged()) {
+		return false
+	}
+
+	due, found, err := p.keyDue.GetKeyDue(key)
+	if err != nil {
+		p.logger.Warn("Getting due time from state failed", slog.String("key", key), slog.Any("error", err))
+		return false
+	}
+
+	return found && !due.IsZero() && now.Before(due)
+}
+
+func (p *processor) recordDue(key string, due, now time.Time) {
+	if p.keyDue == nil {
+		return
+	}
+
+	if err := p.keyDue.SetKeyDue(key, due, now); err != nil {
+		p.logger.Warn("Setting due time in state failed", slog.String("key", key), slog.Any("error", err))
+	}
+}
+
+func (p *processor) finalize(key string, s *versionSeries, now time.Time, retentionCh chan<- retentionExtenderRequest, deleteCh chan<- objectVersion) error {
+	// The requested actions are added as outstanding work before the
+	// versions are reported as evaluated.
+	defer p.watermark.done(key, len(s.items))
+
+	if p.skip(key, s, now) {
+		p.stats.addIncrementalSkipped()
+
+		if p.actions != nil {
+			p.actions.addSkipKey(key, actionReasonUnchanged)
+		}
+
+		if p.traceDecisions {
+			p.logger.Debug("Decision trace", slog.String("key", key), slog.String("rule", actionReasonUnchanged))
+		}
+
+		return nil
+	}
+
+	series := newSeries(key, s, now)
+
+	result, err := p.policy.Decide(series).result(series)
+	if err != nil {
+		return err
+	}
+
+	if p.noRetention {
+		result.retention = nil
+	}
+
+	p.recordDue(key, result.due, now)
+
+	keepExpired := p.minSurvivingVersions > 0 && len(result.expired) > 0 &&
+		len(s.items)-len(result.expired) < p.minSurvivingVersions
+
+	p.traceDecision(key, s, now, result, keepExpired)
+
+	if keepExpired {
+		p.logger.Info("Deletions skipped to retain minimum number of versions",
+			slog.String("key", key),
+			slog.Int("versions", len(s.items)),
+			slog.Int("expired", len(result.expired)),
+		)
+
+		p.stats.addMinVersionsSkipped()
+
+		if p.actions != nil {
+			for _, i := range result.expired {
+				p.actions.addSkip(i, actionReasonMinVersions)
+			}
+		}
+
+		result.expired = nil
+	}
+
+	if p.report != nil {
+		p.report.addExpired(result.expired)
+		p.report.addRetention(result.retention)
+	}
+
+	p.watermark.add(key, len(result.expired)+len(result.retention))
+
+	if p.barriers != nil && len(result.expired) > 0 && len(result.retention) > 0 {
+		barrier := p.barriers.add(key, len(result.retention), result.expired)
+
+		for _, i := range result.retention {
+			i.barrier = barrier
+			retentionCh <- i
+		}
+
+		return nil
+	}
+
+	for _, i := range result.expired {
+		deleteCh <- i
+	}
+
+	for _, i := range result.retention {
+		retentionCh <- i
+	}
+
+	return nil
+}
+
+// run groups versions by key. A key is finalized as soon as all of its
+// versions have arrived, bounding memory use to the keys in flight. Keys whose
+// version count is unknown, or missing versions due to errors, are finalized
+// once the input ends. The input is consumed entirely even if staging fails.
+func (p *processor) run(in <-chan objectVersion, retentionCh chan<- retentionExtenderRequest, deleteCh chan<- objectVersion) error {
+	now := time.Now().Add(p.clockOffset)
+
+	if p.barriers != nil {
+		p.barriers.deleteCh = deleteCh
+
+		// Deletions held back by barriers are sent after the input ended.
+		defer p.barriers.wait()
+	}
+
+	staging := p.staging
+
+	if staging == nil {
+		staging = memoryVersionSeriesStaging{}
+	}
+
+	var err error
+
+	for ov := range in {
+		if err != nil {
+			continue
+		}
+
+		p.stats.discovered(ov)
+		p.deleteFraction.addDiscovered()
+
+		if p.report != nil {
+			p.report.discovered(ov)
+		}
+
+		if p.actions != nil {
+			p.actions.addList(ov)
+		}
+
+		if p.excluded(ov) {
+			continue
+		}
+
+		count, addErr := staging.add(ov)
+		if addErr != nil {
+			err = fmt.Errorf("staging version: %w", addErr)
+			continue
+		}
+
+		if ov.keyVersionCount > 0 && count >= ov.keyVersionCount {
+			s, takeErr := staging.take(ov.key)
+			if takeErr != nil {
+				err = fmt.Errorf("reading staged versions: %w", takeErr)
+				continue
+			}
+
+			err = p.finalize(ov.key, s, now, retentionCh, deleteCh)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := staging.forEach(func(key string, s *versionSeries) error {
+		return p.finalize(key, s, now, retentionCh, deleteCh)
+	}); err != nil {
+		if errors.Is(err, ErrInvalidDecision) {
+			return err
+		}
+
+		return fmt.Errorf("reading staged versions: %w", err)
+	}
+
+	return nil
+}
+
+// runUnversioned forwards objects of a bucket without versioning for deletion
+// once they're older than the minimum deletion age.
+func (p *processor) runUnversioned(in <-chan objectVersion, deleteCh chan<- objectVersion) {
+	cutoff := time.Now().Add(p.clockOffset - p.minDeletionAge)
+
+	for ov := range in {
+		p.stats.discovered(ov)
+		p.deleteFraction.addDiscovered()
+
+		if p.report != nil {
+			p.report.discovered(ov)
+		}
+
+		if p.actions != nil {
+			p.actions.addList(ov)
+		}
+
+		if p.excluded(ov) {
+			continue
+		}
+
+		if !ov.lastModified.Before(cutoff) {
+			continue
+		}
+
+		if p.report != nil {
+			p.report.addExpired([]objectVersion{ov})
+		}
+
+		deleteCh <- ov
+	}
+}
+
+const (
+	// Versions added to the filter during a run beyond those loaded from the
+	// state before the false positive rate degrades.
+	versionFilterHeadroom          = 100_000
+	versionFilterFalsePositiveRate = 0.01
+)
+
+// ErrObjectLockDisabled is returned for destructive runs on buckets without
+// Object Lock unless permitted by Options.AllowUnlocked.
+var ErrObjectLockDisabled = errors.New("object lock not enabled")
+
+// Number of items buffered between pipeline stages by default.
+const DefaultChannelCapacity = 8
+
+// Options configures the cleanup of a single bucket. Only State and Client
+// are required.
+type Options struct {
+	// Uses slog.Default if nil.
+	Logger *slog.Logger
+
+	// Statistics are added to the given value. May be shared between the
+	// runs of multiple buckets.
+	Stats *Stats
+
+	// Retention records and the listing position are kept in the state.
+	// Runs using the same state for a bucket avoid redundant lookups.
+	State *State
+
+	Report *ReportBuilder
+	Plan   *PlanRecorder
+	Client *Client
+	DryRun bool
+
+	// Delete versions in buckets without Object Lock. Their versions can't
+	// be protected by retention, so deletions by mistake or by other
+	// parties are irreversible.
+	AllowUnlocked bool
+
+	// Probe the permissions needed for the bucket with one request each
+	// before processing starts and fail with [ErrPermissionDenied] if any is
+	// missing.
+	ProbePermissions bool
+
+	// Records every listed, skipped, deleted and extended version if set.
+	Actions *ActionRecorder
+
+	// Collects the largest deleted versions if set.
+	LargestDeletions *LargestDeletionsRecorder
+
+	ExcludeKeys *KeyManifest
+	OnlyKeys    *KeyManifest
+
+	// Versions of keys starting with any of the prefixes are neither
+	// deleted nor have their retention modified, regardless of other
+	// settings.
+	ProtectedPrefixes []string
+
+	// Only list the versions of the given sorted keys instead of the whole
+	// bucket, e.g. keys from event notifications. The stored listing marker
+	// is neither used nor updated.
+	Keys []string
+
+	// Only process the keys in the shard. The state must be specific to the
+	// shard.
+	Shard KeyShard
+
+	MaxDeleteRate float64
+
+	// Abort when the ratio of errors to processed object versions exceeds
+	// the given value. Disabled if zero.
+	MaxErrorRatio float64
+
+	// Abort when the deletions exceed the given fraction of the object
+	// versions in the bucket, e.g. due to a misconfigured policy. The
+	// versions discovered so far or those seen by the previous complete run
+	// are counted, whichever is more. Disabled if zero.
+	MaxDeleteFraction float64
+
+	// Continue as a dry run instead of aborting once MaxDeleteFraction is
+	// exceeded.
+	DeleteFractionDryRun bool
+
+	// Dry runs record their deletions in the state for review. Other runs
+	// require such a plan and abort once the deletions not part of it exceed
+	// MaxPlanDeviation as a fraction of the reviewed deletions, e.g. because
+	// the configuration changed after the review. The plan is consumed by a
+	// successful run.
+	RequireReviewedPlan bool
+	MaxPlanDeviation    float64
+
+	// Abort when the local clock differs from the time reported by the
+	// server by more than the given duration. Retention and ages are
+	// computed from the local time. Disabled if zero.
+	MaxClockSkew time.Duration
+
+	// Use the server time for computations instead of aborting once
+	// MaxClockSkew is exceeded.
+	AdjustClockSkew bool
+
+	QuarantinePeriod time.Duration
+	ExcludeMetadata  *MetadataMatcher
+	OnlyKMSKey       *KMSKeyMatcher
+
+	// Minimum age of noncurrent versions before they're deleted. Zero
+	// deletes them on the first run after they became noncurrent.
+	MinDeletionAge time.Duration
+
+	// Set or extend the retention of object versions to be at least the
+	// given amount of time.
+	MinRetention          time.Duration
+	MinRetentionThreshold time.Duration
+	RetentionJitter       time.Duration
+	MaxNoncurrentVersions int
+	AgeFromNoncurrent     bool
+
+	// Seed for randomized decisions such as the retention jitter. Runs with
+	// the same seed make the same decisions for the same versions. Zero
+	// selects a random seed.
+	Seed uint64
+
+	// Reject retention dates further than the given duration in the future
+	// as the likely result of a misconfiguration. Disabled if zero.
+	MaxRetentionHorizon time.Duration
+
+	// Shorten retention dates beyond MaxRetentionHorizon to the horizon
+	// instead of rejecting them.
+	ClampRetentionHorizon bool
+
+	// Handling of keys whose latest version is a delete marker.
+	DeleteMarkers DeleteMarkerStrategy
+
+	// Log the version timeline of every key at debug level together with
+	// the rule deciding about each version.
+	TraceDecisions bool
+
+	// Decides the actions for each version series of versioned buckets.
+	// Uses [DefaultPolicy] if nil.
+	Policy Policy
+
+	// Skip the deletions for keys of versioned buckets which would be left
+	// with fewer than the given number of versions, delete markers
+	// included. Disabled if zero.
+	MinSurvivingVersions int
+
+	// Delete objects by age in buckets without versioning.
+	ExpireUnversioned bool
+
+	// Listing object versions stops at the deadline. The position is stored
+	// in the state and the next run resumes from there. Disabled if zero.
+	ListDeadline time.Time
+
+	// Closing the channel stops listing like reaching ListDeadline, e.g. on
+	// a termination signal. The versions listed until then are still
+	// processed, including their deletion. Disabled if nil.
+	Stop <-chan struct{}
+
+	// Maximum number of entries per listing request. Uses the server default
+	// if zero.
+	ListPageSize int32
+
+	// Record the listing position in the state at the given interval so that
+	// an interrupted run can be resumed. Disabled if zero.
+	ListCheckpointInterval time.Duration
+
+	// Number of items buffered between pipeline stages. Deeper buffers absorb
+	// latency spikes of individual stages. Uses defaultChannelCapacity if
+	// zero.
+	ChannelCapacity int
+
+	// Number of times a listing request failing with a transient error is
+	// retried before giving up on the bucket.
+	ListPageRetries int
+
+	// Keep an inventory of all listed versions in the state. Unchanged
+	// versions skip the retention lookup on subsequent runs.
+	Inventory bool
+
+	// Retention records in the state are removed once the retention period
+	// ended more than the given duration ago. Disabled if zero.
+	StateRecordTTL time.Duration
+
+	// Only evaluate keys with versions changed according to the inventory
+	// or which are due for actions. All keys are evaluated if the last full
+	// run started longer ago than the given duration. Requires the
+	// inventory. Disabled if zero.
+	Incremental time.Duration
+
+	// Record the outcome of deletions in the state and keep them for the
+	// given duration. Disabled if zero.
+	DeleteAuditTTL time.Duration
+
+	// Determine retention using HeadObject instead of GetObjectRetention,
+	// allowing the response to be reused for metadata checks before
+	// deletion.
+	RetentionViaHead bool
+
+	// Log the progress at the given interval. Disabled if zero.
+	ProgressInterval time.Duration
+
+	// Adapt the number of concurrent workers per stage up to the given
+	// number based on latency and throttling. A fixed number of workers is
+	// used if zero.
+	MaxWorkers int
+
+	// Skip state lookups for versions not contained in an in-memory filter
+	// of the versions recorded in the state.
+	VersionFilter bool
+
+	// Stage the versions of keys not yet finalized in a temporary database
+	// within the given directory instead of memory. Disabled if empty.
+	SpillDir string
+}
+
+// useUnversioned reports whether the bucket must be processed without
+// versioning.
+func useUnversioned(ctx context.Context, opts Options) (bool, error) {
+	versioned, err := opts.Client.VersioningEnabled(ctx)
+	if err != nil {
+		if opts.ExpireUnversioned {
+			return false, fmt.Errorf("bucket versioning: %w", err)
+		}
+
+		opts.Logger.WarnContext(ctx, "Checking bucket versioning failed", slog.Any("error", err))
+
+		return false, nil
+	}
+
+	if !versioned && !opts.ExpireUnversioned {
+		opts.Logger.WarnContext(ctx, "Versioning is not enabled for bucket, only existing noncurrent versions are deleted")
+	}
+
+	return !versioned && opts.ExpireUnversioned, nil
+}
+
+// detectCapabilities probes the optional features available for the bucket.
+// Object Lock is assumed to be enabled if the check fails.
+func detectCapabilities(ctx context.Context, opts Options) client.Capabilities {
+	caps, err := opts.Client.DetectCapabilities(ctx)
+	if err != nil {
+		// Unknown Object Lock status is treated like a bucket without
+		// Object Lock, so destructive runs are refused.
+		opts.Logger.WarnContext(ctx, "Checking Object Lock configuration failed, assuming it's disabled", slog.Any("error", err))
+
+		caps.ObjectLock = false
+	}
+
+	opts.Logger.DebugContext(ctx, "Detected bucket capabilities",
+		slog.Bool("object_lock", caps.ObjectLock),
+		slog.Int("max_delete_objects", caps.MaxDeleteObjects),
+	)
+
+	return caps
+}
+
+// Run lists the object versions of the bucket, extends the retention of
+// versions which are still needed and deletes the expired ones. With DryRun no
+// changes are made to the bucket.
+func Run(ctx context.Context, opts Options) error {
+	if opts.State == nil || opts.Client == nil {
+		return fmt.Errorf("%w: state and client are required", os.ErrInvalid)
+	}
+
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+
+	if opts.Stats == nil {
+		opts.Stats = NewStats()
+	}
+
+	if opts.Seed == 0 {
+		opts.Seed = rand.Uint64()
+	}
+
+	bucketState, err := opts.State.Bucket(opts.Client.Name())
+	if err != nil {
+		return fmt.Errorf("bucket state: %w", err)
+	}
+
+	unversioned, err := useUnversioned(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	marker, err := bucketState.GetListingMarker()
+	if err != nil {
+		return fmt.Errorf("listing marker: %w", err)
+	}
+
+	targeted := len(opts.Keys) > 0
+
+	if !marker.IsZero() && !unversioned && !targeted {
+		opts.Logger.InfoContext(ctx, "Resuming listing from stored marker",
+			slog.String("key_marker", marker.KeyMarker),
+			slog.String("version_id_marker", marker.VersionIDMarker),
+			slog.Time("stored_at", marker.MTime),
+		)
+	}
+
+	var resume listMarker
+
+	if opts.ProbePermissions {
+		if err := checkPermissions(ctx, permissionCheckOptions{
+			logger: opts.Logger,
+			stats:  opts.Stats,
+			client: opts.Client,
+			dryRun: opts.DryRun,
+		}); err != nil {
+			return err
+		}
+	}
+
+	caps := detectCapabilities(ctx, opts)
+	objectLock := !unversioned && caps.ObjectLock
+
+	if !caps.ObjectLock {
+		if !opts.DryRun && !opts.AllowUnlocked {
+			return fmt.Errorf("%w: refusing to delete versions without retention safeguard", ErrObjectLockDisabled)
+		}
+
+		opts.Logger.WarnContext(ctx, "Running in degraded safety mode, versions in buckets without Object Lock are not protected by retention")
+	}
+
+	if !unversioned && !objectLock {
+		opts.Logger.InfoContext(ctx, "Object Lock is not enabled for bucket, skipping retention lookups and extensions")
+	}
+
+	if objectLock && opts.MinRetention > 0 {
+		checkLifecycleConflicts(ctx, lifecycleCheckOptions{
+			logger:         opts.Logger,
+			client:         opts.Client,
+			prefix:         opts.Client.Prefix(),
+			minRetention:   opts.MinRetention,
+			minDeletionAge: opts.MinDeletionAge,
+		})
+	}
+
+	clockOffset, err := checkClockSkew(ctx, clockSkewCheckOptions{
+		logger:  opts.Logger,
+		client:  opts.Client,
+		maxSkew: opts.MaxClockSkew,
+		adjust:  opts.AdjustClockSkew,
+	})
+	if err != nil {
+		return err
+	}
+
+	var inventory retentionAnnotatorInventory
+
+	if opts.Inventory && !unversioned {
+		inventory = bucketState
+	}
+
+	var filter retentionAnnotatorFilter
+
+	if opts.VersionFilter && !unversioned {
+		f, count, err := bucketState.VersionFilter(versionFilterHeadroom, versionFilterFalsePositiveRate)
+		if err != nil {
+			return fmt.Errorf("version filter: %w", err)
+		}
+
+		opts.Logger.InfoContext(ctx, "Loaded version filter from state", slog.Int("count", count))
+
+		filter = f
+	}
+
+	runStart := time.Now()
+
+	var keyDue processorKeyDueState
+	var incremental bool
+
+	if opts.Incremental > 0 && inventory != nil {
+		keyDue = bucketState
+
+		lastFullRun, err := bucketState.GetLastFullRun()
+		if err != nil {
+			return fmt.Errorf("last full run: %w", err)
+		}
+
+		incremental = !lastFullRun.IsZero() && runStart.Sub(lastFullRun) < opts.Incremental
+
+		if incremental {
+			opts.Logger.InfoContext(ctx, "Only evaluating changed or due keys",
+				slog.Time("last_full_run", lastFullRun))
+		}
+	}
+
+	stopProgress := startProgress(ctx, opts, bucketState)
+
+	channelCapacity := cmp.Or(opts.ChannelCapacity, DefaultChannelCapacity)
+
+	annotateCh := make(chan objectVersion, channelCapacity)
+	handleCh := make(chan objectVersion, channelCapacity)
+	retentionCh := make(chan retentionExtenderRequest, channelCapacity)
+	deleteCh := make(chan objectVersion, channelCapacity)
+
+	backoff := newAdaptiveBackoff(opts.Stats)
+
+	newTuner := func(name string) *workerTuner {
+		return newWorkerTuner(workerTunerOptions{
+			logger:     opts.Logger,
+			name:       name,
+			backoff:    backoff,
+			maxWorkers: opts.MaxWorkers,
+		})
+	}
+
+	timer := newStageTimer()
+
+	// timeStage records the wall-clock time of a stage once it returns.
+	timeStage := func(stage pipelineStage, fn func() error) func() error {
+		return func() error {
+			defer timer.finished(stage)
+
+			return fn()
+		}
+	}
+
+	guardCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	errorGuard := newErrorRatioGuard(opts.MaxErrorRatio, cancel)
+
+	var deleteFraction *deleteFractionGuard
+
+	if opts.MaxDeleteFraction > 0 {
+		deleteFraction = newDeleteFractionGuard(deleteFractionGuardOptions{
+			logger:      opts.Logger,
+			maxFraction: opts.MaxDeleteFraction,
+			dryRun:      opts.DeleteFractionDryRun,
+			cancel:      cancel,
+			estimate:    estimateBucketVersions(ctx, opts, bucketState),
+		})
+	}
+
+	var review *planReview
+
+	if opts.RequireReviewedPlan {
+		var reviewed *state.ReviewedPlan
+
+		if !opts.DryRun {
+			plan, found, err := bucketState.GetReviewedPlan()
+			if err != nil {
+				return fmt.Errorf("reviewed plan: %w", err)
+			}
+
+			if !found {
+				return fmt.Errorf("%w: no plan recorded, a dry run is required first", ErrPlanChanged)
+			}
+
+			opts.Logger.InfoContext(ctx, "Comparing deletions with reviewed plan",
+				slog.String("digest", plan.Digest),
+				slog.Int("deletions", len(plan.Deletions)),
+				slog.Time("created_at", plan.CreatedAt))
+
+			reviewed = &plan
+		}
+
+		review = newPlanReview(planReviewOptions{
+			logger:       opts.Logger,
+			cancel:       cancel,
+			reviewed:     reviewed,
+			maxDeviation: opts.MaxPlanDeviation,
+		})
+	}
+
+	var watermark *listWatermark
+
+	if !(unversioned || targeted) {
+		// Checkpoints only advance past keys processed by all stages.
+		watermark = newListWatermark(newListCheckpointer(opts.Logger, bucketState, opts.ListCheckpointInterval))
+	}
+
+	g, ctx := errgroup.WithContext(guardCtx)
+
+	if unversioned {
+		opts.Logger.InfoContext(ctx, "Deleting objects by age in bucket without versioning")
+
+		close(retentionCh)
+
+		g.Go(timeStage(stageListing, func() error {
+			defer close(handleCh)
+			defer timer.track(stageListing)()
+
+			if targeted {
+				return listKeys(ctx, listKeysOptions{
+					client:      opts.Client.S3(),
+					bucket:      opts.Client.Name(),
+					prefix:      opts.Client.Prefix(),
+					keys:        opts.Keys,
+					unversioned: true,
+					onlyKeys:    opts.OnlyKeys,
+					shard:       opts.Shard,
+					stats:       opts.Stats,
+					retry:       newPageRetry(opts.Logger, opts.Stats, opts.ListPageRetries),
+				}, handleCh)
+			}
+
+			return listObjects(ctx, listObjectsOptions{
+				client:   opts.Client.S3(),
+				bucket:   opts.Client.Name(),
+				prefix:   opts.Client.Prefix(),
+				pageSize: opts.ListPageSize,
+				onlyKeys: opts.OnlyKeys,
+				shard:    opts.Shard,
+				stats:    opts.Stats,
+				retry:    newPageRetry(opts.Logger, opts.Stats, opts.ListPageRetries),
+				stop: func() bool {
+					return stopRequested(opts.Stop)
+				},
+			}, handleCh)
+		}))
+		g.Go(func() error {
+			defer close(deleteCh)
+
+			p := newProcessor(processorOptions{
+				stats:          opts.Stats,
+				report:         opts.Report,
+				actions:        opts.Actions,
+				minDeletionAge: opts.MinDeletionAge,
+				excludeKeys:    opts.ExcludeKeys,
+				deleteFraction: deleteFraction,
+				clockOffset:    clockOffset,
+
+				protectedPrefixes: opts.ProtectedPrefixes,
+			})
+			p.runUnversioned(handleCh, deleteCh)
+
+			return nil
+		})
+	} else {
+		listCh := annotateCh
+
+		// Without retention the annotator is only needed for maintaining
+		// the inventory.
+		annotate := objectLock || inventory != nil
+
+		if !annotate {
+			listCh = handleCh
+		}
+
+		g.Go(timeStage(stageListing, func() error {
+			defer close(listCh)
+			defer timer.track(stageListing)()
+
+			if targeted {
+				return listKeys(ctx, listKeysOptions{
+					client:   opts.Client.S3(),
+					bucket:   opts.Client.Name(),
+					prefix:   opts.Client.Prefix(),
+					keys:     opts.Keys,
+					onlyKeys: opts.OnlyKeys,
+					shard:    opts.Shard,
+					stats:    opts.Stats,
+					retry:    newPageRetry(opts.Logger, opts.Stats, opts.ListPageRetries),
+
+					duplicateLatest: opts.Client.Flavor().DuplicateLatest(),
+				}, listCh)
+			}
+
+			var err error
+
+			resume, err = listObjectVersions(ctx, listObjectVersionsOptions{
+				client:   opts.Client.S3(),
+				bucket:   opts.Client.Name(),
+				prefix:   opts.Client.Prefix(),
+				pageSize: opts.ListPageSize,
+				onlyKeys: opts.OnlyKeys,
+				shard:    opts.Shard,
+				stats:    opts.Stats,
+				retry:    newPageRetry(opts.Logger, opts.Stats, opts.ListPageRetries),
+
+				duplicateLatest: opts.Client.Flavor().DuplicateLatest(),
+
+				start: listMarker{
+					keyMarker:       marker.KeyMarker,
+					versionIDMarker: marker.VersionIDMarker,
+				},
+				stop: func() bool {
+					return stopRequested(opts.Stop) ||
+						(!opts.ListDeadline.IsZero() && !time.Now().Before(opts.ListDeadline))
+				},
+				watermark: watermark,
+			}, listCh)
+
+			return err
+		}))
+
+		if annotate {
+			g.Go(timeStage(stageAnnotation, func() error {
+				defer close(handleCh)
+
+				var headClient retentionAnnotatorHeadClient
+
+				if opts.RetentionViaHead {
+					headClient = opts.Client
+				}
+
+				a := newRetentionAnnotator(retentionAnnotatorOptions{
+					logger:     opts.Logger,
+					stats:      opts.Stats,
+					state:      bucketState,
+					client:     opts.Client,
+					backoff:    backoff,
+					errorGuard: errorGuard,
+					inventory:  inventory,
+					now:        runStart,
+					filter:     filter,
+					headClient: headClient,
+
+					noRetention: !objectLock,
+					tuner:       newTuner("annotator"),
+					timer:       timer,
+					watermark:   watermark,
+				})
+
+				return a.run(ctx, annotateCh, handleCh)
+			}))
+		}
+		g.Go(func() (err error) {
+			defer close(deleteCh)
+			defer close(retentionCh)
+
+			var staging versionSeriesStaging
+
+			if opts.SpillDir != "" {
+				db, err := state.NewStaging(opts.SpillDir)
+				if err != nil {
+					// Unblock the annotator.
+					for range handleCh {
+					}
+
+					return fmt.Errorf("version staging: %w", err)
+				}
+
+				defer func() {
+					err = errors.Join(err, db.Close())
+				}()
+
+				staging = newDiskVersionSeriesStaging(db)
+			}
+
+			p := newProcessor(processorOptions{
+				logger:         opts.Logger,
+				stats:          opts.Stats,
+				report:         opts.Report,
+				actions:        opts.Actions,
+				minRetention:   opts.MinRetention,
+				minDeletionAge: opts.MinDeletionAge,
+				excludeKeys:    opts.ExcludeKeys,
+
+				maxNoncurrentVersions: opts.MaxNoncurrentVersions,
+				ageFromNoncurrent:     opts.AgeFromNoncurrent,
+				minRetentionThreshold: opts.MinRetentionThreshold,
+				deleteMarkers:         opts.DeleteMarkers,
+				policy:                opts.Policy,
+
+				keyDue:         keyDue,
+				incremental:    incremental,
+				staging:        staging,
+				noRetention:    !objectLock,
+				deleteFraction: deleteFraction,
+				clockOffset:    clockOffset,
+				traceDecisions: opts.TraceDecisions,
+
+				// The retention extender only runs with Object Lock.
+				retentionBarrier: objectLock,
+
+				minSurvivingVersions: opts.MinSurvivingVersions,
+				protectedPrefixes:    opts.ProtectedPrefixes,
+				watermark:            watermark,
+			})
+
+			return p.run(handleCh, retentionCh, deleteCh)
+		})
+	}
+
+	// Without Object Lock no retention extensions are requested.
+	if objectLock {
+		g.Go(timeStage(stageRetention, func() error {
+			e := newRetentionExtender(retentionExtenderOptions{
+				logger:       opts.Logger,
+				stats:        opts.Stats,
+				state:        bucketState,
+				client:       opts.Client,
+				minRemaining: opts.MinRetentionThreshold,
+				jitter:       opts.RetentionJitter,
+				seed:         opts.Seed,
+				maxHorizon:   opts.MaxRetentionHorizon,
+				clampHorizon: opts.ClampRetentionHorizon,
+				now:          time.Now().Add(clockOffset),
+				dryRun:       opts.DryRun,
+				plan:         opts.Plan,
+				actions:      opts.Actions,
+				backoff:      backoff,
+				errorGuard:   errorGuard,
+				tuner:        newTuner("retention"),
+				timer:        timer,
+				watermark:    watermark,
+			})
+
+			return e.run(ctx, retentionCh)
+		}))
+	}
+	g.Go(timeStage(stageDeletion, func() error {
+		var audit batchDeleterAudit
+
+		if opts.DeleteAuditTTL > 0 {
+			audit = bucketState
+		}
+
+		deleter := newBatchDeleter(batchDeleterOptions{
+			logger:  opts.Logger,
+			stats:   opts.Stats,
+			state:   bucketState,
+			client:  opts.Client.S3(),
+			bucket:  opts.Client.Name(),
+			dryRun:  opts.DryRun,
+			plan:    opts.Plan,
+			actions: opts.Actions,
+			largest: opts.LargestDeletions,
+
+			batchSize:  caps.MaxDeleteObjects,
+			maxRate:    opts.MaxDeleteRate,
+			backoff:    backoff,
+			errorGuard: errorGuard,
+
+			deleteFraction: deleteFraction,
+			planReview:     review,
+
+			now:              time.Now().Add(clockOffset),
+			quarantinePeriod: opts.QuarantinePeriod,
+			excludeMetadata:  opts.ExcludeMetadata,
+			onlyKMSKey:       opts.OnlyKMSKey,
+			metadataClient:   opts.Client,
+			audit:            audit,
+			tuner:            newTuner("deleter"),
+			timer:            timer,
+			watermark:        watermark,
+		})
+
+		return deleter.run(ctx, deleteCh)
+	}))
+
+	err = g.Wait()
+
+	stopProgress()
+
+	timings := timer.result()
+
+	opts.Stats.addStageTimings(timings)
+	opts.Logger.InfoContext(ctx, "Pipeline stage timings", stageTimingAttrs(timings)...)
+
+	if err == nil && !unversioned && !targeted {
+		err = storeListingMarker(ctx, opts.Logger, bucketState, resume)
+	}
+
+	if err == nil && opts.StateRecordTTL > 0 {
+		if count, pruneErr := bucketState.PruneObjectRetention(runStart.Add(-opts.StateRecordTTL)); pruneErr != nil {
+			err = fmt.Errorf("pruning retention records: %w", pruneErr)
+		} else {
+			opts.Stats.addStatePruned(count)
+		}
+	}
+
+	if err == nil && opts.DeleteAuditTTL > 0 {
+		if count, pruneErr := bucketState.PruneDeleteAudit(runStart.Add(-opts.DeleteAuditTTL)); pruneErr != nil {
+			err = fmt.Errorf("pruning deletion records: %w", pruneErr)
+		} else {
+			opts.Stats.addStatePruned(count)
+		}
+	}
+
+	complete := marker.IsZero() && resume.isZero() && opts.OnlyKeys == nil && !targeted
+
+	if !complete || incremental || opts.Shard.enabled() {
+		opts.Stats.addPartial()
+	}
+
+	// Versions not seen during a complete listing no longer exist.
+	if err == nil && inventory != nil && complete {
+		if count, pruneErr := bucketState.PruneInventory(runStart); pruneErr != nil {
+			err = fmt.Errorf("pruning inventory: %w", pruneErr)
+		} else {
+			opts.Stats.addInventoryRemoved(count)
+		}
+	}
+
+	// Skipped keys keep their records from earlier runs, so only full runs
+	// can determine the keys which are gone.
+	if err == nil && keyDue != nil && complete && !incremental {
+		if count, pruneErr := bucketState.PruneKeyDue(runStart); pruneErr != nil {
+			err = fmt.Errorf("pruning due times: %w", pruneErr)
+		} else {
+			opts.Stats.addStatePruned(count)
+		}
+
+		if err == nil {
+			if setErr := bucketState.SetLastFullRun(runStart); setErr != nil {
+				err = fmt.Errorf("recording full run: %w", setErr)
+			}
+		}
+	}
+
+	if cause := context.Cause(guardCtx); errors.Is(cause, ErrErrorRatioExceeded) || errors.Is(cause, ErrDeleteFractionExceeded) || errors.Is(cause, ErrPlanChanged) {
+		err = cause
+	}
+
+	if err == nil {
+		if finishErr := review.finish(ctx, bucketState, runStart); finishErr != nil {
+			err = fmt.Errorf("reviewed plan: %w", finishErr)
+		}
+	}
+
+	return err
+}
+
+// startProgress starts logging the progress if enabled. The remaining time is
+// estimated from the size of the bucket during previous runs.
+func startProgress(ctx context.Context, opts Options, bucketState *state.Bucket) func() {
+	if opts.ProgressInterval <= 0 {
+		return func() {}
+	}
+
+	history, err := bucketState.RunStatsHistory()
+	if err != nil {
+		opts.Logger.WarnContext(ctx, "Reading statistics history failed", slog.Any("error", err))
+	}
+
+	return newProgressReporter(progressReporterOptions{
+		logger:   opts.Logger,
+		stats:    opts.Stats,
+		interval: opts.ProgressInterval,
+		estimate: estimateVersionCount(history),
+	}).start(ctx)
+}
+
+// estimateBucketVersions returns the number of object versions seen by the
+// previous complete run of the bucket. Zero is returned if unknown.
+func estimateBucketVersions(ctx context.Context, opts Options, bucketState *state.Bucket) int64 {
+	history, err := bucketState.RunStatsHistory()
+	if err != nil {
+		opts.Logger.WarnContext(ctx, "Reading statistics history failed", slog.Any("error", err))
+	}
+
+	return estimateVersionCount(history)
+}
+
+// stopRequested reports whether the channel is closed.
+func stopRequested(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// storeListingMarker records where listing stopped early or removes the
+// marker once the whole bucket has been listed.
+func storeListingMarker(ctx context.Context, logger *slog.Logger, bucketState *state.Bucket, resume listMarker) error {
+	if resume.isZero() {
+		if err := bucketState.DeleteListingMarker(); err != nil {
+			return fmt.Errorf("deleting listing marker: %w", err)
+		}
+
+		return nil
+	}
+
+	logger.InfoContext(ctx, "Listing stopped early, next run resumes from marker",
+		slog.String("key_marker", resume.keyMarker),
+		slog.String("version_id_marker", resume.versionIDMarker),
+	)
+
+	if err := bucketState.SetListingMarker(state.ListingMarker{
+		KeyMarker:       resume.keyMarker,
+		VersionIDMarker: resume.versionIDMarker,
+	}); err != nil {
+		return fmt.Errorf("setting listing marker: %w", err)
+	}
+
+	return nil
+}
+
+// newListCheckpointer returns a function recording the listing position in the
+// state at most once per interval. Nil is returned if the interval is zero.
+// Successfully completed runs replace the checkpoint via [storeListingMarker].
+func newListCheckpointer(logger *slog.Logger, bucketState *state.Bucket, interval time.Duration) func(listMarker) {
+	if interval <= 0 {
+		return nil
+	}
+
+	last := time.Now()
+
+	return func(m listMarker) {
+		if time.Since(last) < interval {
+			return
+		}
+
+		last = time.Now()
+
+		if err := bucketState.SetListingMarker(state.ListingMarker{
+			KeyMarker:       m.keyMarker,
+			VersionIDMarker: m.versionIDMarker,
+		}); err != nil {
+			logger.Warn("Recording listing checkpoint failed", slog.Any("error", err))
+			return
+		}
+
+		logger.Debug("Recorded listing checkpoint",
+			slog.String("key_marker", m.keyMarker),
+			slog.String("version_id_marker", m.versionIDMarker),
+		)
+	}
+}
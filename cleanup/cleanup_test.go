@@ -0,0 +1,1459 @@
+package cleanup
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	set "github.com/deckarep/golang-set/v2"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/hansmi/s3-object-cleanup/internal/fakes3"
+	"github.com/hansmi/s3-object-cleanup/internal/state"
+	"gonum.org/v1/gonum/stat/combin"
+)
+
+func TestVersionSeriesAdd(t *testing.T) {
+	versions := []objectVersion{
+		{
+			lastModified: time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC),
+			versionID:    "jan-1",
+		},
+		{
+			lastModified: time.Date(2000, time.February, 1, 0, 0, 0, 0, time.UTC),
+			versionID:    "feb-1",
+		},
+		{
+			lastModified: time.Date(2000, time.February, 2, 0, 0, 0, 0, time.UTC),
+			versionID:    "feb-2-del",
+			deleteMarker: true,
+		},
+		{
+			lastModified: time.Date(2000, time.March, 1, 0, 0, 0, 0, time.UTC),
+			versionID:    "mar-1",
+		},
+		{
+			lastModified: time.Date(2000, time.April, 1, 0, 0, 0, 0, time.UTC),
+			versionID:    "apr-1-del",
+			deleteMarker: true,
+			isLatest:     true,
+		},
+	}
+
+	for _, order := range combin.Permutations(len(versions), len(versions)) {
+		t.Run(fmt.Sprint(order), func(t *testing.T) {
+			t.Parallel()
+
+			var selected []objectVersion
+
+			for _, i := range order {
+				selected = append(selected, versions[i])
+			}
+
+			for count := range len(selected) {
+				var s versionSeries
+
+				for _, ov := range selected[:count] {
+					s.add(ov)
+				}
+
+				var want []objectVersion
+
+				for _, i := range slices.Sorted(slices.Values(order[:count])) {
+					want = append(want, versions[i])
+				}
+
+				if diff := cmp.Diff(want, s.items, cmpopts.EquateEmpty(), cmp.AllowUnexported(objectVersion{})); diff != "" {
+					t.Errorf("Versions diff (-want +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestVersionSeriesAddIdenticalTimes(t *testing.T) {
+	lastModified := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	// Listed newest first. Sorting by version ID would reverse the order.
+	versions := []objectVersion{
+		{lastModified: lastModified, versionID: "a-del", deleteMarker: true, isLatest: true},
+		{lastModified: lastModified, versionID: "b", listOrder: 1},
+		{lastModified: lastModified, versionID: "c", listOrder: 2},
+	}
+
+	for _, order := range combin.Permutations(len(versions), len(versions)) {
+		var s versionSeries
+
+		for _, i := range order {
+			s.add(versions[i])
+		}
+
+		want := []objectVersion{versions[2], versions[1], versions[0]}
+
+		if diff := cmp.Diff(want, s.items, cmp.AllowUnexported(objectVersion{})); diff != "" {
+			t.Errorf("Versions added in order %v diff (-want +got):\n%s", order, diff)
+		}
+	}
+}
+
+func TestVersionSeriesFinalize(t *testing.T) {
+	for _, tc := range []struct {
+		name                  string
+		items                 []objectVersion
+		now                   time.Time
+		minRetention          time.Duration
+		minDeletionAge        time.Duration
+		maxNoncurrentVersions int
+		ageFromNoncurrent     bool
+		wantRetention         map[string]time.Time
+		wantExpired           []string
+	}{
+		{name: "empty"},
+		{
+			name: "no latest",
+			items: []objectVersion{
+				{
+					lastModified: time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-1",
+				},
+				{
+					lastModified: time.Date(2001, time.March, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "mar-1",
+					retainUntil:  time.Date(2001, time.July, 1, 0, 0, 0, 0, time.UTC),
+				},
+				{
+					lastModified: time.Date(2001, time.April, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "apr-1",
+				},
+			},
+			now:            time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC),
+			minRetention:   10 * 24 * time.Hour,
+			minDeletionAge: 999 * 24 * time.Hour,
+			wantRetention: map[string]time.Time{
+				"jan-1": time.Date(2001, time.January, 11, 0, 0, 0, 0, time.UTC),
+				"apr-1": time.Date(2001, time.April, 11, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "no latest with delete marker",
+			items: []objectVersion{
+				{
+					lastModified: time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-1",
+					retainUntil:  time.Date(2001, time.July, 1, 0, 0, 0, 0, time.UTC),
+				},
+				{
+					lastModified: time.Date(2001, time.March, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "mar-1-del",
+					deleteMarker: true,
+				},
+				{
+					lastModified: time.Date(2001, time.April, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "apr-1",
+				},
+				{
+					lastModified: time.Date(2001, time.May, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "may-1",
+					retainUntil:  time.Date(2001, time.May, 7, 0, 0, 0, 0, time.UTC),
+				},
+			},
+			now:            time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC),
+			minRetention:   11 * 24 * time.Hour,
+			minDeletionAge: 999 * 24 * time.Hour,
+			wantRetention: map[string]time.Time{
+				"apr-1": time.Date(2001, time.April, 12, 0, 0, 0, 0, time.UTC),
+				"may-1": time.Date(2001, time.May, 12, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "one",
+			items: []objectVersion{
+				{
+					lastModified: time.Date(2003, time.January, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-1",
+					isLatest:     true,
+				},
+			},
+			now:            time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC),
+			minRetention:   100 * 24 * time.Hour,
+			minDeletionAge: 999 * 24 * time.Hour,
+			wantRetention: map[string]time.Time{
+				"jan-1": time.Date(2003, time.April, 11, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "current delete marker",
+			items: []objectVersion{
+				{
+					lastModified: time.Date(2003, time.January, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-1-del",
+					isLatest:     true,
+					deleteMarker: true,
+				},
+			},
+			now:            time.Date(2003, time.January, 14, 0, 0, 0, 0, time.UTC),
+			minRetention:   10 * 24 * time.Hour,
+			minDeletionAge: 20 * 24 * time.Hour,
+		},
+		{
+			name: "expired delete marker",
+			items: []objectVersion{
+				{
+					lastModified: time.Date(2003, time.January, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-1-del",
+					isLatest:     true,
+					deleteMarker: true,
+				},
+			},
+			now:            time.Date(2003, time.March, 1, 0, 0, 0, 0, time.UTC),
+			minRetention:   10 * 24 * time.Hour,
+			minDeletionAge: 20 * 24 * time.Hour,
+			wantExpired:    []string{"jan-1-del"},
+		},
+		{
+			name: "expired delete marker before latest",
+			items: []objectVersion{
+				{
+					lastModified: time.Date(2002, time.January, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-1-del",
+					deleteMarker: true,
+				},
+				{
+					lastModified: time.Date(2002, time.February, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "feb-1",
+					isLatest:     true,
+				},
+			},
+			now:            time.Date(2002, time.September, 1, 0, 0, 0, 0, time.UTC),
+			minRetention:   10 * 24 * time.Hour,
+			minDeletionAge: 20 * 24 * time.Hour,
+			wantRetention: map[string]time.Time{
+				"feb-1": time.Date(2002, time.September, 11, 0, 0, 0, 0, time.UTC),
+			},
+			wantExpired: []string{"jan-1-del"},
+		},
+		{
+			name: "versions before recent delete marker",
+			items: []objectVersion{
+				{
+					lastModified: time.Date(2003, time.January, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-1",
+				},
+				{
+					lastModified: time.Date(2003, time.February, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "feb-1",
+				},
+				{
+					lastModified: time.Date(2003, time.March, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "mar-1-del",
+					deleteMarker: true,
+					isLatest:     true,
+				},
+			},
+			now:            time.Date(2003, time.March, 15, 0, 0, 0, 0, time.UTC),
+			minRetention:   10 * 24 * time.Hour,
+			minDeletionAge: 20 * 24 * time.Hour,
+			wantRetention: map[string]time.Time{
+				"feb-1": time.Date(2003, time.March, 21, 0, 0, 0, 0, time.UTC),
+			},
+			wantExpired: []string{"jan-1"},
+		},
+		{
+			name: "versions before expired delete marker",
+			items: []objectVersion{
+				{
+					lastModified: time.Date(2003, time.January, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-1",
+				},
+				{
+					lastModified: time.Date(2003, time.February, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "feb-1",
+				},
+				{
+					lastModified: time.Date(2003, time.March, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "mar-1-del",
+					deleteMarker: true,
+					isLatest:     true,
+				},
+			},
+			now:            time.Date(2003, time.March, 21, 1, 0, 0, 0, time.UTC),
+			minRetention:   10 * 24 * time.Hour,
+			minDeletionAge: 20 * 24 * time.Hour,
+			wantExpired:    []string{"jan-1", "feb-1", "mar-1-del"},
+		},
+		{
+			name: "two versions",
+			items: []objectVersion{
+				{
+					lastModified: time.Date(2004, time.January, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-1",
+					retainUntil:  time.Date(2008, time.March, 1, 0, 0, 0, 0, time.UTC),
+				},
+				{
+					lastModified: time.Date(2004, time.February, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "feb-1",
+					isLatest:     true,
+				},
+			},
+			now:            time.Date(2010, time.January, 1, 0, 0, 0, 0, time.UTC),
+			minRetention:   10 * 24 * time.Hour,
+			minDeletionAge: 20 * 24 * time.Hour,
+			wantRetention: map[string]time.Time{
+				"feb-1": time.Date(2010, time.January, 11, 0, 0, 0, 0, time.UTC),
+			},
+			wantExpired: []string{"jan-1"},
+		},
+		{
+			name: "two versions and delete marker",
+			items: []objectVersion{
+				{
+					lastModified: time.Date(2004, time.January, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-1",
+				},
+				{
+					lastModified: time.Date(2004, time.February, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "feb-1",
+				},
+				{
+					lastModified: time.Date(2004, time.March, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "mar-1-del",
+					deleteMarker: true,
+					isLatest:     true,
+				},
+			},
+			now:            time.Date(2004, time.June, 1, 0, 0, 0, 0, time.UTC),
+			minRetention:   12 * 24 * time.Hour,
+			minDeletionAge: 20 * 24 * time.Hour,
+			wantExpired:    []string{"jan-1", "feb-1", "mar-1-del"},
+		},
+		{
+			name: "two versions with retention and delete marker",
+			items: []objectVersion{
+				{
+					lastModified: time.Date(2004, time.January, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-1",
+					retainUntil:  time.Date(2004, time.January, 15, 0, 0, 0, 0, time.UTC),
+				},
+				{
+					lastModified: time.Date(2004, time.February, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "feb-1",
+					retainUntil:  time.Date(2004, time.February, 15, 0, 0, 0, 0, time.UTC),
+				},
+				{
+					lastModified: time.Date(2004, time.March, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "mar-1-del",
+					deleteMarker: true,
+					isLatest:     true,
+				},
+			},
+			now:            time.Date(2004, time.March, 2, 0, 0, 0, 0, time.UTC),
+			minRetention:   10 * 24 * time.Hour,
+			minDeletionAge: 20 * 24 * time.Hour,
+			wantRetention: map[string]time.Time{
+				"feb-1": time.Date(2004, time.March, 21, 0, 0, 0, 0, time.UTC),
+			},
+			wantExpired: []string{"jan-1"},
+		},
+		{
+			name: "retention not yet expired",
+			items: []objectVersion{
+				{
+					lastModified: time.Date(2004, time.January, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-1",
+					retainUntil:  time.Date(2004, time.April, 1, 0, 0, 0, 0, time.UTC),
+				},
+				{
+					lastModified: time.Date(2004, time.February, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "feb-1",
+					isLatest:     true,
+				},
+			},
+			now:            time.Date(2004, time.March, 28, 0, 0, 0, 0, time.UTC),
+			minRetention:   12 * 24 * time.Hour,
+			minDeletionAge: 20 * 24 * time.Hour,
+			wantRetention: map[string]time.Time{
+				"feb-1": time.Date(2004, time.April, 9, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "retention before delete marker not yet expired",
+			items: []objectVersion{
+				{
+					lastModified: time.Date(2004, time.January, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-1",
+					retainUntil:  time.Date(2004, time.April, 1, 0, 0, 0, 0, time.UTC),
+				},
+				{
+					lastModified: time.Date(2004, time.February, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "feb-1-del",
+					deleteMarker: true,
+					isLatest:     true,
+				},
+			},
+			now:            time.Date(2004, time.March, 28, 0, 0, 0, 0, time.UTC),
+			minRetention:   3 * 24 * time.Hour,
+			minDeletionAge: 4 * 24 * time.Hour,
+		},
+		{
+			name: "version after delete marker",
+			items: []objectVersion{
+				{
+					lastModified: time.Date(2004, time.January, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-1-del",
+					deleteMarker: true,
+				},
+				{
+					lastModified: time.Date(2004, time.February, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "feb-1",
+					isLatest:     true,
+				},
+			},
+			now:            time.Date(2004, time.March, 28, 0, 0, 0, 0, time.UTC),
+			minRetention:   10 * 24 * time.Hour,
+			minDeletionAge: 20 * 24 * time.Hour,
+			wantRetention: map[string]time.Time{
+				"feb-1": time.Date(2004, time.April, 7, 0, 0, 0, 0, time.UTC),
+			},
+			wantExpired: []string{"jan-1-del"},
+		},
+		{
+			name: "version and delete marker",
+			items: []objectVersion{
+				{
+					lastModified: time.Date(2025, time.August, 29, 0, 0, 0, 0, time.UTC),
+					versionID:    "aug-29",
+					retainUntil:  time.Date(2025, time.October, 16, 0, 0, 0, 0, time.UTC),
+				},
+				{
+					lastModified: time.Date(2025, time.August, 30, 0, 0, 0, 0, time.UTC),
+					versionID:    "aug-30-del",
+					deleteMarker: true,
+					isLatest:     true,
+				},
+			},
+			now:            time.Date(2025, time.October, 22, 0, 0, 0, 0, time.UTC),
+			minRetention:   10 * 24 * time.Hour,
+			minDeletionAge: 20 * 24 * time.Hour,
+			wantExpired:    []string{"aug-29", "aug-30-del"},
+		},
+		{
+			name: "max noncurrent versions",
+			items: []objectVersion{
+				{
+					lastModified: time.Date(2005, time.January, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-1",
+				},
+				{
+					lastModified: time.Date(2005, time.January, 2, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-2",
+				},
+				{
+					lastModified: time.Date(2005, time.January, 3, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-3",
+				},
+				{
+					lastModified: time.Date(2005, time.January, 4, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-4",
+					isLatest:     true,
+				},
+			},
+			now:                   time.Date(2005, time.January, 5, 0, 0, 0, 0, time.UTC),
+			minRetention:          10 * 24 * time.Hour,
+			minDeletionAge:        20 * 24 * time.Hour,
+			maxNoncurrentVersions: 1,
+			wantRetention: map[string]time.Time{
+				"jan-4": time.Date(2005, time.January, 15, 0, 0, 0, 0, time.UTC),
+			},
+			wantExpired: []string{"jan-1", "jan-2"},
+		},
+		{
+			name: "max noncurrent versions not exceeded",
+			items: []objectVersion{
+				{
+					lastModified: time.Date(2005, time.January, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-1",
+				},
+				{
+					lastModified: time.Date(2005, time.January, 2, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-2",
+					isLatest:     true,
+				},
+			},
+			now:                   time.Date(2005, time.January, 5, 0, 0, 0, 0, time.UTC),
+			minRetention:          10 * 24 * time.Hour,
+			minDeletionAge:        20 * 24 * time.Hour,
+			maxNoncurrentVersions: 1,
+			wantRetention: map[string]time.Time{
+				"jan-2": time.Date(2005, time.January, 15, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "max noncurrent versions with retention",
+			items: []objectVersion{
+				{
+					lastModified: time.Date(2005, time.January, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-1",
+				},
+				{
+					lastModified: time.Date(2005, time.January, 2, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-2",
+					retainUntil:  time.Date(2005, time.February, 1, 0, 0, 0, 0, time.UTC),
+				},
+				{
+					lastModified: time.Date(2005, time.January, 3, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-3",
+				},
+				{
+					lastModified: time.Date(2005, time.January, 4, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-4",
+					isLatest:     true,
+				},
+			},
+			now:                   time.Date(2005, time.January, 5, 0, 0, 0, 0, time.UTC),
+			minRetention:          10 * 24 * time.Hour,
+			minDeletionAge:        20 * 24 * time.Hour,
+			maxNoncurrentVersions: 1,
+			wantRetention: map[string]time.Time{
+				"jan-4": time.Date(2005, time.January, 15, 0, 0, 0, 0, time.UTC),
+			},
+			wantExpired: []string{"jan-1"},
+		},
+		{
+			name: "max noncurrent versions with delete marker",
+			items: []objectVersion{
+				{
+					lastModified: time.Date(2005, time.January, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-1",
+				},
+				{
+					lastModified: time.Date(2005, time.January, 2, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-2",
+				},
+				{
+					lastModified: time.Date(2005, time.January, 3, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-3",
+				},
+				{
+					lastModified: time.Date(2005, time.January, 4, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-4-del",
+					deleteMarker: true,
+					isLatest:     true,
+				},
+			},
+			now:                   time.Date(2005, time.January, 5, 0, 0, 0, 0, time.UTC),
+			minRetention:          10 * 24 * time.Hour,
+			minDeletionAge:        20 * 24 * time.Hour,
+			maxNoncurrentVersions: 2,
+			wantRetention: map[string]time.Time{
+				"jan-3": time.Date(2005, time.January, 24, 0, 0, 0, 0, time.UTC),
+			},
+			wantExpired: []string{"jan-1"},
+		},
+		{
+			name: "max noncurrent versions with expired delete marker",
+			items: []objectVersion{
+				{
+					lastModified: time.Date(2005, time.January, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-1",
+				},
+				{
+					lastModified: time.Date(2005, time.January, 2, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-2",
+				},
+				{
+					lastModified: time.Date(2005, time.January, 3, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-3-del",
+					deleteMarker: true,
+					isLatest:     true,
+				},
+			},
+			now:                   time.Date(2005, time.January, 10, 0, 0, 0, 0, time.UTC),
+			minRetention:          10 * 24 * time.Hour,
+			minDeletionAge:        5 * 24 * time.Hour,
+			maxNoncurrentVersions: 1,
+			wantExpired:           []string{"jan-1", "jan-2", "jan-3-del"},
+		},
+		{
+			name: "age from noncurrent",
+			items: []objectVersion{
+				{
+					lastModified: time.Date(2006, time.January, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-1",
+				},
+				{
+					lastModified: time.Date(2006, time.February, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "feb-1",
+				},
+				{
+					lastModified: time.Date(2006, time.June, 15, 0, 0, 0, 0, time.UTC),
+					versionID:    "jun-15",
+				},
+				{
+					lastModified: time.Date(2006, time.June, 25, 0, 0, 0, 0, time.UTC),
+					versionID:    "jun-25",
+					isLatest:     true,
+				},
+			},
+			now:               time.Date(2006, time.July, 1, 0, 0, 0, 0, time.UTC),
+			minRetention:      10 * 24 * time.Hour,
+			minDeletionAge:    20 * 24 * time.Hour,
+			ageFromNoncurrent: true,
+			wantRetention: map[string]time.Time{
+				"jun-25": time.Date(2006, time.July, 11, 0, 0, 0, 0, time.UTC),
+			},
+			wantExpired: []string{"jan-1"},
+		},
+		{
+			name: "age from noncurrent with expired delete marker",
+			items: []objectVersion{
+				{
+					lastModified: time.Date(2006, time.January, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "jan-1",
+				},
+				{
+					lastModified: time.Date(2006, time.June, 1, 0, 0, 0, 0, time.UTC),
+					versionID:    "jun-1-del",
+					deleteMarker: true,
+					isLatest:     true,
+				},
+			},
+			now:               time.Date(2006, time.July, 1, 0, 0, 0, 0, time.UTC),
+			minRetention:      10 * 24 * time.Hour,
+			minDeletionAge:    20 * 24 * time.Hour,
+			ageFromNoncurrent: true,
+			wantExpired:       []string{"jan-1", "jun-1-del"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var s versionSeries
+
+			for _, i := range tc.items {
+				s.add(i)
+			}
+
+			got := s.finalize(versionSeriesFinalizeOptions{
+				now:            tc.now,
+				minRetention:   tc.minRetention,
+				minDeletionAge: tc.minDeletionAge,
+
+				maxNoncurrentVersions: tc.maxNoncurrentVersions,
+				ageFromNoncurrent:     tc.ageFromNoncurrent,
+			})
+
+			gotRetention := map[string]time.Time{}
+
+			for _, req := range got.retention {
+				gotRetention[req.object.versionID] = req.until
+			}
+
+			var gotExpired []string
+
+			for _, ov := range got.expired {
+				gotExpired = append(gotExpired, ov.versionID)
+			}
+
+			if intersection := set.NewSet(gotExpired...).Intersect(
+				set.NewSetFromMapKeys(gotRetention),
+			); !intersection.IsEmpty() {
+				t.Errorf("Retained and deleted versions intersect: %q", set.Sorted(intersection))
+			}
+
+			if diff := cmp.Diff(tc.wantRetention, gotRetention, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("Retention diff (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tc.wantExpired, gotExpired, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("Expired versions diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestProcessorRunUnversioned(t *testing.T) {
+	now := time.Now()
+
+	excludeKeys := NewKeyManifest()
+	excludeKeys.add("excluded")
+
+	p := newProcessor(processorOptions{
+		stats:          NewStats(),
+		minDeletionAge: 24 * time.Hour,
+		excludeKeys:    excludeKeys,
+	})
+
+	in := make(chan objectVersion, 8)
+	in <- objectVersion{key: "old", lastModified: now.Add(-48 * time.Hour), isLatest: true}
+	in <- objectVersion{key: "new", lastModified: now.Add(-time.Hour), isLatest: true}
+	in <- objectVersion{key: "excluded", lastModified: now.Add(-48 * time.Hour), isLatest: true}
+	close(in)
+
+	deleteCh := make(chan objectVersion, 8)
+
+	p.runUnversioned(in, deleteCh)
+
+	close(deleteCh)
+
+	var got []string
+
+	for i := range deleteCh {
+		got = append(got, i.key)
+	}
+
+	if diff := cmp.Diff([]string{"old"}, got); diff != "" {
+		t.Errorf("Expired objects diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestProcessorStreaming(t *testing.T) {
+	now := time.Now()
+
+	p := newProcessor(processorOptions{
+		stats:          NewStats(),
+		minRetention:   24 * time.Hour,
+		minDeletionAge: 24 * time.Hour,
+	})
+
+	in := make(chan objectVersion)
+	retentionCh := make(chan retentionExtenderRequest, 8)
+	deleteCh := make(chan objectVersion)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		p.run(in, retentionCh, deleteCh)
+	}()
+
+	in <- objectVersion{key: "complete", versionID: "old", lastModified: now.Add(-72 * time.Hour), keyVersionCount: 2}
+	in <- objectVersion{key: "unknown", versionID: "old", lastModified: now.Add(-72 * time.Hour)}
+	in <- objectVersion{key: "unknown", versionID: "new", lastModified: now.Add(-48 * time.Hour), isLatest: true}
+	in <- objectVersion{key: "complete", versionID: "new", lastModified: now.Add(-48 * time.Hour), isLatest: true, keyVersionCount: 2}
+
+	// The key is finalized before the input ends.
+	if got := <-deleteCh; got.key != "complete" || got.versionID != "old" {
+		t.Errorf("Expired version %s/%s, want complete/old", got.key, got.versionID)
+	}
+
+	close(in)
+
+	// Keys with unknown version counts are finalized at the end.
+	if got := <-deleteCh; got.key != "unknown" || got.versionID != "old" {
+		t.Errorf("Expired version %s/%s, want unknown/old", got.key, got.versionID)
+	}
+
+	<-done
+}
+
+func TestProcessorNoRetention(t *testing.T) {
+	now := time.Now()
+
+	p := newProcessor(processorOptions{
+		stats:          NewStats(),
+		minRetention:   24 * time.Hour,
+		minDeletionAge: 24 * time.Hour,
+		noRetention:    true,
+	})
+
+	in := make(chan objectVersion, 8)
+	retentionCh := make(chan retentionExtenderRequest, 8)
+	deleteCh := make(chan objectVersion, 8)
+
+	in <- objectVersion{key: "key", versionID: "old", lastModified: now.Add(-72 * time.Hour)}
+	in <- objectVersion{key: "key", versionID: "new", lastModified: now.Add(-48 * time.Hour), isLatest: true}
+	close(in)
+
+	if err := p.run(in, retentionCh, deleteCh); err != nil {
+		t.Errorf("run() failed: %v", err)
+	}
+
+	if len(retentionCh) != 0 {
+		t.Errorf("Got %d retention requests, want none", len(retentionCh))
+	}
+
+	if len(deleteCh) != 1 {
+		t.Errorf("Got %d expired versions, want 1", len(deleteCh))
+	}
+}
+
+func TestProcessorMinSurvivingVersions(t *testing.T) {
+	now := time.Now()
+
+	stats := NewStats()
+
+	p := newProcessor(processorOptions{
+		stats:          stats,
+		minDeletionAge: 24 * time.Hour,
+		noRetention:    true,
+
+		minSurvivingVersions: 2,
+	})
+
+	in := make(chan objectVersion, 8)
+	retentionCh := make(chan retentionExtenderRequest, 8)
+	deleteCh := make(chan objectVersion, 8)
+
+	in <- objectVersion{key: "short", versionID: "old", lastModified: now.Add(-72 * time.Hour)}
+	in <- objectVersion{key: "short", versionID: "new", lastModified: now.Add(-48 * time.Hour), isLatest: true}
+	in <- objectVersion{key: "long", versionID: "old", lastModified: now.Add(-72 * time.Hour)}
+	in <- objectVersion{key: "long", versionID: "recent", lastModified: now.Add(-time.Hour)}
+	in <- objectVersion{key: "long", versionID: "new", lastModified: now.Add(-time.Minute), isLatest: true}
+	close(in)
+
+	if err := p.run(in, retentionCh, deleteCh); err != nil {
+		t.Errorf("run() failed: %v", err)
+	}
+
+	close(deleteCh)
+
+	var got []string
+
+	for i := range deleteCh {
+		got = append(got, i.key+"@"+i.versionID)
+	}
+
+	if diff := cmp.Diff([]string{"long@old"}, got); diff != "" {
+		t.Errorf("Expired versions diff (-want +got):\n%s", diff)
+	}
+
+	if stats.minVersionsKeyCount != 1 {
+		t.Errorf("Skipped %d keys, want 1", stats.minVersionsKeyCount)
+	}
+}
+
+func TestProcessorProtectedPrefixes(t *testing.T) {
+	now := time.Now()
+
+	stats := NewStats()
+
+	excludeKeys := NewKeyManifest()
+	excludeKeys.add("excluded")
+	excludeKeys.add("keep/excluded")
+
+	p := newProcessor(processorOptions{
+		stats:          stats,
+		minRetention:   24 * time.Hour,
+		minDeletionAge: 24 * time.Hour,
+		excludeKeys:    excludeKeys,
+
+		protectedPrefixes: []string{"keep/", "config"},
+	})
+
+	in := make(chan objectVersion, 16)
+	retentionCh := make(chan retentionExtenderRequest, 16)
+	deleteCh := make(chan objectVersion, 16)
+
+	for _, key := range []string{"keep/a", "keep/excluded", "config", "excluded", "other"} {
+		in <- objectVersion{key: key, versionID: "old", lastModified: now.Add(-72 * time.Hour)}
+		in <- objectVersion{key: key, versionID: "new", lastModified: now.Add(-48 * time.Hour), isLatest: true}
+	}
+
+	close(in)
+
+	if err := p.run(in, retentionCh, deleteCh); err != nil {
+		t.Errorf("run() failed: %v", err)
+	}
+
+	close(retentionCh)
+	close(deleteCh)
+
+	keys := map[string]bool{}
+
+	for req := range retentionCh {
+		keys[req.object.key] = true
+	}
+
+	for ov := range deleteCh {
+		keys[ov.key] = true
+	}
+
+	if diff := cmp.Diff(map[string]bool{"other": true}, keys); diff != "" {
+		t.Errorf("Touched keys diff (-want +got):\n%s", diff)
+	}
+
+	if stats.protectedCount != 6 || stats.excludedCount != 2 {
+		t.Errorf("Got %d protected and %d excluded versions, want 6 and 2", stats.protectedCount, stats.excludedCount)
+	}
+}
+
+func TestVersionSeriesFinalizeDeleteMarkers(t *testing.T) {
+	items := func(second time.Time) []objectVersion {
+		return []objectVersion{
+			{lastModified: time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC), versionID: "first"},
+			{lastModified: second, versionID: "second"},
+			{lastModified: time.Date(2001, time.March, 1, 0, 0, 0, 0, time.UTC), versionID: "del", deleteMarker: true, isLatest: true},
+		}
+	}
+
+	old := time.Date(2001, time.February, 1, 0, 0, 0, 0, time.UTC)
+	young := time.Date(2001, time.February, 25, 0, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name          string
+		strategy      DeleteMarkerStrategy
+		items         []objectVersion
+		wantExpired   []string
+		wantRetention []string
+	}{
+		{
+			name:          "default",
+			items:         items(old),
+			wantExpired:   []string{"first"},
+			wantRetention: []string{"second"},
+		},
+		{
+			name:        "expire",
+			strategy:    DeleteMarkerExpire,
+			items:       items(old),
+			wantExpired: []string{"first", "second", "del"},
+		},
+		{
+			name:        "expire with young version",
+			strategy:    DeleteMarkerExpire,
+			items:       items(young),
+			wantExpired: []string{"first"},
+		},
+		{
+			name:        "keep",
+			strategy:    DeleteMarkerKeep,
+			items:       items(old),
+			wantExpired: []string{"first", "second"},
+		},
+		{
+			name:     "skip",
+			strategy: DeleteMarkerSkip,
+			items:    items(old),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := versionSeries{
+				items:      tc.items,
+				haveLatest: true,
+			}
+
+			result := s.finalize(versionSeriesFinalizeOptions{
+				now:            time.Date(2001, time.March, 10, 0, 0, 0, 0, time.UTC),
+				minRetention:   10 * 24 * time.Hour,
+				minDeletionAge: 20 * 24 * time.Hour,
+				deleteMarkers:  tc.strategy,
+			})
+
+			var expired, retention []string
+
+			for _, ov := range result.expired {
+				expired = append(expired, ov.versionID)
+			}
+
+			for _, req := range result.retention {
+				retention = append(retention, req.object.versionID)
+			}
+
+			if diff := cmp.Diff(tc.wantExpired, expired); diff != "" {
+				t.Errorf("Expired versions diff (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tc.wantRetention, retention); diff != "" {
+				t.Errorf("Retention diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestListCheckpointer(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	s, err := state.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("state.New() failed: %v", err)
+	}
+
+	b, err := s.Bucket("test")
+	if err != nil {
+		t.Fatalf("Bucket() failed: %v", err)
+	}
+
+	if fn := newListCheckpointer(logger, b, 0); fn != nil {
+		t.Errorf("newListCheckpointer() returned function for zero interval")
+	}
+
+	fn := newListCheckpointer(logger, b, time.Nanosecond)
+
+	time.Sleep(time.Millisecond)
+
+	fn(listMarker{keyMarker: "key", versionIDMarker: "ver"})
+
+	if got, err := b.GetListingMarker(); err != nil {
+		t.Errorf("GetListingMarker() failed: %v", err)
+	} else if got.KeyMarker != "key" || got.VersionIDMarker != "ver" {
+		t.Errorf("GetListingMarker() returned %+v", got)
+	}
+
+	// Completed listings remove the checkpoint.
+	if err := storeListingMarker(t.Context(), logger, b, listMarker{}); err != nil {
+		t.Errorf("storeListingMarker() failed: %v", err)
+	}
+
+	if got, err := b.GetListingMarker(); err != nil {
+		t.Errorf("GetListingMarker() failed: %v", err)
+	} else if !got.IsZero() {
+		t.Errorf("GetListingMarker() returned %+v after completion", got)
+	}
+}
+
+func TestVersionSeriesFinalizeDue(t *testing.T) {
+	now := time.Date(2010, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name  string
+		items []objectVersion
+		want  time.Time
+	}{
+		{name: "empty"},
+		{
+			name: "no latest",
+			items: []objectVersion{
+				{
+					lastModified: time.Date(2010, time.January, 1, 0, 0, 0, 0, time.UTC),
+					retainUntil:  time.Date(2011, time.January, 1, 0, 0, 0, 0, time.UTC),
+				},
+			},
+		},
+		{
+			name: "latest with retention",
+			items: []objectVersion{
+				{
+					lastModified: time.Date(2010, time.January, 1, 0, 0, 0, 0, time.UTC),
+					retainUntil:  time.Date(2010, time.July, 1, 0, 0, 0, 0, time.UTC),
+					isLatest:     true,
+				},
+			},
+			want: time.Date(2010, time.June, 21, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "latest without retention",
+			items: []objectVersion{
+				{
+					lastModified: time.Date(2010, time.January, 1, 0, 0, 0, 0, time.UTC),
+					isLatest:     true,
+				},
+			},
+		},
+		{
+			name: "noncurrent version expires later",
+			items: []objectVersion{
+				{
+					versionID:    "may-10",
+					lastModified: time.Date(2010, time.May, 10, 0, 0, 0, 0, time.UTC),
+					retainUntil:  time.Date(2010, time.May, 15, 0, 0, 0, 0, time.UTC),
+				},
+				{
+					versionID:    "may-20",
+					lastModified: time.Date(2010, time.May, 20, 0, 0, 0, 0, time.UTC),
+					retainUntil:  time.Date(2011, time.January, 1, 0, 0, 0, 0, time.UTC),
+					isLatest:     true,
+				},
+			},
+			want: time.Date(2010, time.June, 9, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "noncurrent version retained",
+			items: []objectVersion{
+				{
+					versionID:    "jan-1",
+					lastModified: time.Date(2010, time.January, 1, 0, 0, 0, 0, time.UTC),
+					retainUntil:  time.Date(2010, time.June, 5, 0, 0, 0, 0, time.UTC),
+				},
+				{
+					versionID:    "may-20",
+					lastModified: time.Date(2010, time.May, 20, 0, 0, 0, 0, time.UTC),
+					retainUntil:  time.Date(2011, time.January, 1, 0, 0, 0, 0, time.UTC),
+					isLatest:     true,
+				},
+			},
+			want: time.Date(2010, time.June, 5, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "delete marker expires",
+			items: []objectVersion{
+				{
+					versionID:    "jan-1",
+					lastModified: time.Date(2010, time.January, 1, 0, 0, 0, 0, time.UTC),
+					retainUntil:  time.Date(2011, time.January, 1, 0, 0, 0, 0, time.UTC),
+				},
+				{
+					versionID:    "may-25-del",
+					lastModified: time.Date(2010, time.May, 25, 0, 0, 0, 0, time.UTC),
+					deleteMarker: true,
+					isLatest:     true,
+				},
+			},
+			want: time.Date(2010, time.June, 24, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "expired",
+			items: []objectVersion{
+				{
+					versionID:    "jan-1",
+					lastModified: time.Date(2010, time.January, 1, 0, 0, 0, 0, time.UTC),
+				},
+				{
+					versionID:    "may-20",
+					lastModified: time.Date(2010, time.May, 20, 0, 0, 0, 0, time.UTC),
+					retainUntil:  time.Date(2011, time.January, 1, 0, 0, 0, 0, time.UTC),
+					isLatest:     true,
+				},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var s versionSeries
+
+			for _, i := range tc.items {
+				s.add(i)
+			}
+
+			got := s.finalize(versionSeriesFinalizeOptions{
+				now:                   now,
+				minRetention:          30 * 24 * time.Hour,
+				minDeletionAge:        30 * 24 * time.Hour,
+				minRetentionThreshold: 10 * 24 * time.Hour,
+			})
+
+			if !got.due.Equal(tc.want) {
+				t.Errorf("finalize() due at %v, want %v", got.due, tc.want)
+			}
+		})
+	}
+}
+
+type fakeKeyDueState map[string]time.Time
+
+func (s fakeKeyDueState) GetKeyDue(key string) (time.Time, bool, error) {
+	due, ok := s[key]
+	return due, ok, nil
+}
+
+func (s fakeKeyDueState) SetKeyDue(key string, due, _ time.Time) error {
+	s[key] = due
+	return nil
+}
+
+func TestProcessorIncremental(t *testing.T) {
+	now := time.Now()
+
+	keyDue := fakeKeyDueState{
+		"unchanged":     now.Add(time.Hour),
+		"changed":       now.Add(time.Hour),
+		"due":           now.Add(-time.Hour),
+		"always":        {},
+		"different-key": now.Add(time.Hour),
+	}
+
+	stats := NewStats()
+
+	p := newProcessor(processorOptions{
+		stats:          stats,
+		minRetention:   24 * time.Hour,
+		minDeletionAge: 24 * time.Hour,
+		keyDue:         keyDue,
+		incremental:    true,
+	})
+
+	in := make(chan objectVersion, 8)
+
+	for _, key := range []string{"unchanged", "due", "always", "new"} {
+		in <- objectVersion{key: key, lastModified: now.Add(-time.Hour), isLatest: true, unchanged: true}
+	}
+
+	in <- objectVersion{key: "changed", lastModified: now.Add(-48 * time.Hour), versionID: "old", unchanged: true}
+	in <- objectVersion{key: "changed", lastModified: now.Add(-time.Hour), versionID: "new", isLatest: true}
+	close(in)
+
+	retentionCh := make(chan retentionExtenderRequest, 16)
+	deleteCh := make(chan objectVersion, 16)
+
+	p.run(in, retentionCh, deleteCh)
+
+	close(retentionCh)
+	close(deleteCh)
+
+	var got []string
+
+	for req := range retentionCh {
+		got = append(got, req.object.key)
+	}
+
+	slices.Sort(got)
+
+	if diff := cmp.Diff([]string{"always", "changed", "due", "new"}, got); diff != "" {
+		t.Errorf("Evaluated keys diff (-want +got):\n%s", diff)
+	}
+
+	if stats.incrementalSkippedCount != 1 {
+		t.Errorf("Skipped %d keys, want 1", stats.incrementalSkippedCount)
+	}
+
+	if _, ok := keyDue["new"]; !ok {
+		t.Errorf("Due time not recorded for new key")
+	}
+}
+
+func TestRunUnlockedBucket(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		dryRun        bool
+		allowUnlocked bool
+		unknown       bool
+		wantErr       error
+		wantRemaining int
+	}{
+		{name: "refused", wantErr: ErrObjectLockDisabled, wantRemaining: 2},
+		{name: "dry run", dryRun: true, wantRemaining: 2},
+		{name: "allowed", allowUnlocked: true, wantRemaining: 1},
+		{name: "unknown refused", unknown: true, wantErr: ErrObjectLockDisabled, wantRemaining: 2},
+		{name: "unknown dry run", unknown: true, dryRun: true, wantRemaining: 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := fakes3.Options{
+				Bucket:       "bucket",
+				NoObjectLock: true,
+			}
+
+			if tc.unknown {
+				// Object Lock is configured, but the configuration
+				// can't be read.
+				opts.NoObjectLock = false
+				opts.Deny = []string{"GetObjectLockConfiguration"}
+			}
+
+			fake := fakes3.New(opts)
+
+			for i := range 2 {
+				fake.Add(fakes3.Version{
+					Key:          "key",
+					VersionID:    fmt.Sprint(i),
+					LastModified: time.Date(2024, time.January, 1+i, 0, 0, 0, 0, time.UTC),
+				})
+			}
+
+			server := httptest.NewServer(fake)
+			t.Cleanup(server.Close)
+
+			c, err := NewClient(aws.Config{
+				Region:      "us-east-1",
+				Credentials: aws.AnonymousCredentials{},
+			}, server.URL+"/bucket")
+			if err != nil {
+				t.Fatalf("NewClient() failed: %v", err)
+			}
+
+			store, err := state.New(t.TempDir())
+			if err != nil {
+				t.Fatalf("state.New() failed: %v", err)
+			}
+
+			t.Cleanup(func() { store.Close() })
+
+			err = Run(t.Context(), Options{
+				Logger:        slog.New(slog.DiscardHandler),
+				State:         store,
+				Client:        c,
+				DryRun:        tc.dryRun,
+				AllowUnlocked: tc.allowUnlocked,
+			})
+
+			if diff := cmp.Diff(tc.wantErr, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("Run() error diff (-want +got):\n%s", diff)
+			}
+
+			if got := len(fake.Versions()); got != tc.wantRemaining {
+				t.Errorf("%d versions remain, want %d", got, tc.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestObjectVersionStateVersionID(t *testing.T) {
+	base := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	if got := (objectVersion{versionID: "v1", lastModified: base}).stateVersionID(); got != "v1" {
+		t.Errorf("stateVersionID() = %q, want %q", got, "v1")
+	}
+
+	first := objectVersion{versionID: nullVersionID, lastModified: base}
+	replaced := objectVersion{versionID: nullVersionID, lastModified: base.Add(time.Millisecond)}
+
+	if first.stateVersionID() == replaced.stateVersionID() {
+		t.Errorf("Replaced null versions share state version ID %q", first.stateVersionID())
+	}
+
+	if got, want := first.stateVersionID(), "null@2024-01-01T00:00:00Z"; got != want {
+		t.Errorf("stateVersionID() = %q, want %q", got, want)
+	}
+}
+
+func TestRunNullVersions(t *testing.T) {
+	base := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	fake := fakes3.New(fakes3.Options{
+		Bucket: "bucket",
+	})
+
+	// Written before versioning was enabled and since overwritten.
+	fake.Add(fakes3.Version{Key: "a", VersionID: nullVersionID, LastModified: base})
+	fake.Add(fakes3.Version{Key: "a", VersionID: "v1", LastModified: base.Add(time.Hour)})
+
+	// Never overwritten.
+	fake.Add(fakes3.Version{Key: "b", VersionID: nullVersionID, LastModified: base})
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	c, err := NewClient(aws.Config{
+		Region:      "us-east-1",
+		Credentials: aws.AnonymousCredentials{},
+	}, server.URL+"/bucket")
+	if err != nil {
+		t.Fatalf("NewClient() failed: %v", err)
+	}
+
+	store, err := state.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("state.New() failed: %v", err)
+	}
+
+	t.Cleanup(func() { store.Close() })
+
+	stats := NewStats()
+
+	if err := Run(t.Context(), Options{
+		Logger:       slog.New(slog.DiscardHandler),
+		Stats:        stats,
+		State:        store,
+		Client:       c,
+		MinRetention: 24 * time.Hour,
+	}); err != nil {
+		t.Errorf("Run() failed: %v", err)
+	}
+
+	var got []string
+
+	for _, v := range fake.Versions() {
+		got = append(got, fmt.Sprintf("%s/%s/%t", v.Key, v.VersionID, v.RetainUntil.IsZero()))
+	}
+
+	if diff := cmp.Diff([]string{"a/v1/false", "b/null/false"}, got); diff != "" {
+		t.Errorf("Remaining versions diff (-want +got):\n%s", diff)
+	}
+
+	if got := stats.Counters()["delete.success_count"]; got != 1 {
+		t.Errorf("Deleted %d versions, want 1", got)
+	}
+
+	bucketState, err := store.Bucket(c.Name())
+	if err != nil {
+		t.Fatalf("Bucket() failed: %v", err)
+	}
+
+	b := objectVersion{key: "b", versionID: nullVersionID, lastModified: base}
+
+	if _, found, err := bucketState.GetObjectRetention(b.key, b.stateVersionID()); err != nil {
+		t.Errorf("GetObjectRetention() failed: %v", err)
+	} else if !found {
+		t.Errorf("No retention recorded for %q", b.stateVersionID())
+	}
+}
+
+func TestRunStop(t *testing.T) {
+	base := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	fake := fakes3.New(fakes3.Options{
+		Bucket: "bucket",
+	})
+
+	for _, key := range []string{"a", "b", "c"} {
+		fake.Add(fakes3.Version{Key: key, VersionID: "v1", LastModified: base})
+		fake.Add(fakes3.Version{Key: key, VersionID: "v2", LastModified: base.Add(time.Hour)})
+	}
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	c, err := NewClient(aws.Config{
+		Region:      "us-east-1",
+		Credentials: aws.AnonymousCredentials{},
+	}, server.URL+"/bucket")
+	if err != nil {
+		t.Fatalf("NewClient() failed: %v", err)
+	}
+
+	store, err := state.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("state.New() failed: %v", err)
+	}
+
+	t.Cleanup(func() { store.Close() })
+
+	stop := make(chan struct{})
+	close(stop)
+
+	stats := NewStats()
+
+	if err := Run(t.Context(), Options{
+		Logger:       slog.New(slog.DiscardHandler),
+		Stats:        stats,
+		State:        store,
+		Client:       c,
+		MinRetention: 24 * time.Hour,
+		ListPageSize: 2,
+		Stop:         stop,
+	}); err != nil {
+		t.Errorf("Run() failed: %v", err)
+	}
+
+	// Only the first page was listed and processed.
+	if got := stats.Counters()["delete.success_count"]; got != 1 {
+		t.Errorf("Deleted %d versions, want 1", got)
+	}
+
+	bucketState, err := store.Bucket(c.Name())
+	if err != nil {
+		t.Fatalf("Bucket() failed: %v", err)
+	}
+
+	if marker, err := bucketState.GetListingMarker(); err != nil {
+		t.Errorf("GetListingMarker() failed: %v", err)
+	} else if marker.KeyMarker != "a" {
+		t.Errorf("Listing marker %+v, want key marker %q", marker, "a")
+	}
+
+	if stats.Complete() {
+		t.Errorf("Stopped run is complete")
+	}
+
+	// The resumed run only lists the remaining keys while the following one
+	// starts from the beginning.
+	for _, want := range []bool{false, true} {
+		stats := NewStats()
+
+		if err := Run(t.Context(), Options{
+			Logger:       slog.New(slog.DiscardHandler),
+			Stats:        stats,
+			State:        store,
+			Client:       c,
+			MinRetention: 24 * time.Hour,
+			ListPageSize: 2,
+		}); err != nil {
+			t.Errorf("Run() failed: %v", err)
+		}
+
+		if got := stats.Complete(); got != want {
+			t.Errorf("Complete() = %t, want %t", got, want)
+		}
+	}
+}
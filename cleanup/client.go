@@ -0,0 +1,38 @@
+package cleanup
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/hansmi/s3-object-cleanup/internal/client"
+	"github.com/hansmi/s3-object-cleanup/internal/state"
+)
+
+// Client provides access to the bucket being cleaned up.
+type Client = client.Client
+
+// Flavor describes how an S3-compatible service deviates from AWS S3.
+type Flavor = client.Flavor
+
+// State stores retention records, the inventory and the listing position of
+// one or more buckets.
+type State = state.Store
+
+// NewClient returns a client for a bucket given either by name or as an URL to
+// an S3-compatible endpoint, optionally followed by a key prefix
+// ("https://host/bucket/prefix"). The client assumes AWS S3 until another
+// flavor is set with [Client.SetFlavor].
+func NewClient(cfg aws.Config, bucket string, optFns ...func(*s3.Options)) (*Client, error) {
+	return client.NewFromName(cfg, bucket, optFns...)
+}
+
+// ParseFlavor returns the flavor with the given name, e.g. "aws", "b2",
+// "minio" or "ceph". An empty name selects AWS S3.
+func ParseFlavor(name string) (Flavor, error) {
+	return client.ParseFlavor(name)
+}
+
+// OpenState opens or creates the state database at the given path. The
+// caller must close it once done.
+func OpenState(path string) (*State, error) {
+	return state.Open(path)
+}
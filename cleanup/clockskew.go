@@ -0,0 +1,57 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// ErrClockSkew is returned when the local clock deviates from the server by
+// more than Options.MaxClockSkew.
+var ErrClockSkew = errors.New("clock skew exceeded")
+
+type clockSkewClient interface {
+	ClockSkew(context.Context) (time.Duration, error)
+}
+
+type clockSkewCheckOptions struct {
+	logger  *slog.Logger
+	client  clockSkewClient
+	maxSkew time.Duration
+
+	// Return the skew as an offset for the local time instead of failing.
+	adjust bool
+}
+
+// checkClockSkew compares the local time with the server. Retention and ages
+// are computed from the local time, so a wrong clock would silently shorten or
+// extend them. The returned offset must be added to the local time. Failing to
+// determine the skew is not fatal.
+func checkClockSkew(ctx context.Context, opts clockSkewCheckOptions) (time.Duration, error) {
+	if opts.maxSkew <= 0 {
+		return 0, nil
+	}
+
+	skew, err := opts.client.ClockSkew(ctx)
+	if err != nil {
+		opts.logger.WarnContext(ctx, "Checking clock skew failed", slog.Any("error", err))
+		return 0, nil
+	}
+
+	if skew.Abs() <= opts.maxSkew {
+		opts.logger.DebugContext(ctx, "Checked clock skew", slog.Duration("skew", skew))
+		return 0, nil
+	}
+
+	if !opts.adjust {
+		return 0, fmt.Errorf("%w: server time differs by %v from local time (limit %v)", ErrClockSkew, skew, opts.maxSkew)
+	}
+
+	opts.logger.WarnContext(ctx, "Adjusting for clock skew, local clock differs from server",
+		slog.Duration("skew", skew),
+		slog.Duration("limit", opts.maxSkew))
+
+	return skew, nil
+}
@@ -0,0 +1,77 @@
+package cleanup
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+type fakeClockSkewClient struct {
+	skew time.Duration
+	err  error
+}
+
+func (c fakeClockSkewClient) ClockSkew(context.Context) (time.Duration, error) {
+	return c.skew, c.err
+}
+
+func TestCheckClockSkew(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		client  fakeClockSkewClient
+		maxSkew time.Duration
+		adjust  bool
+		want    time.Duration
+		wantErr error
+	}{
+		{
+			name:   "disabled",
+			client: fakeClockSkewClient{skew: time.Hour},
+		},
+		{
+			name:    "within limit",
+			client:  fakeClockSkewClient{skew: -time.Minute},
+			maxSkew: 5 * time.Minute,
+		},
+		{
+			name:    "exceeded",
+			client:  fakeClockSkewClient{skew: -time.Hour},
+			maxSkew: 5 * time.Minute,
+			wantErr: ErrClockSkew,
+		},
+		{
+			name:    "adjusted",
+			client:  fakeClockSkewClient{skew: -time.Hour},
+			maxSkew: 5 * time.Minute,
+			adjust:  true,
+			want:    -time.Hour,
+		},
+		{
+			name:    "check failed",
+			client:  fakeClockSkewClient{err: os.ErrPermission},
+			maxSkew: 5 * time.Minute,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := checkClockSkew(t.Context(), clockSkewCheckOptions{
+				logger:  slog.New(slog.DiscardHandler),
+				client:  tc.client,
+				maxSkew: tc.maxSkew,
+				adjust:  tc.adjust,
+			})
+
+			if diff := cmp.Diff(tc.wantErr, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("checkClockSkew() error diff (-want +got):\n%s", diff)
+			}
+
+			if got != tc.want {
+				t.Errorf("checkClockSkew() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// ErrDeleteFractionExceeded is the cause of runs aborted by
+// Options.MaxDeleteFraction.
+var ErrDeleteFractionExceeded = errors.New("delete fraction exceeded")
+
+// deleteFractionGuard limits the deletions in a bucket to a fraction of its
+// object versions. The versions discovered so far are compared against the
+// number of versions seen by the previous complete run, whichever is larger.
+// Once tripped the run is either cancelled or the remaining deletions become a
+// dry run. A nil guard is valid and never trips.
+//
+// Deletions are streamed while listing, so without a previous run the total
+// is unknown and a few old versions discovered early would make up a large
+// fraction. All deletions then become a dry run, and the run provides the
+// estimate for the next one.
+type deleteFractionGuard struct {
+	mu          sync.Mutex
+	logger      *slog.Logger
+	maxFraction float64
+	dryRun      bool
+	cancel      context.CancelCauseFunc
+	estimate    int64
+	discovered  int64
+	deleted     int64
+	tripped     bool
+}
+
+type deleteFractionGuardOptions struct {
+	logger      *slog.Logger
+	maxFraction float64
+
+	// Turn the remaining deletions into a dry run instead of cancelling.
+	dryRun bool
+
+	cancel context.CancelCauseFunc
+
+	// Expected number of object versions, e.g. from the previous run.
+	// Unknown if zero.
+	estimate int64
+}
+
+func newDeleteFractionGuard(opts deleteFractionGuardOptions) *deleteFractionGuard {
+	if opts.maxFraction <= 0 {
+		return nil
+	}
+
+	return &deleteFractionGuard{
+		logger:      opts.logger,
+		maxFraction: opts.maxFraction,
+		dryRun:      opts.dryRun,
+		cancel:      opts.cancel,
+		estimate:    opts.estimate,
+	}
+}
+
+func (g *deleteFractionGuard) addDiscovered() {
+	if g == nil {
+		return
+	}
+
+	g.mu.Lock()
+	g.discovered++
+	g.mu.Unlock()
+}
+
+// admit reports whether the given number of versions may be deleted. Versions
+// not admitted must only be handled as in a dry run.
+func (g *deleteFractionGuard) admit(ctx context.Context, count int) bool {
+	if g == nil {
+		return true
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.tripped {
+		return false
+	}
+
+	if g.estimate <= 0 {
+		g.tripped = true
+
+		g.logger.WarnContext(ctx, "Continuing as dry run, the deleted fraction can't be checked without a previous complete run")
+
+		return false
+	}
+
+	total := max(g.discovered, g.estimate)
+	deleted := g.deleted + int64(count)
+
+	if float64(deleted) <= g.maxFraction*float64(total) {
+		g.deleted = deleted
+		return true
+	}
+
+	g.tripped = true
+
+	cause := fmt.Errorf("%w: %d deletions for %d object versions (%.1f%%, limit %.1f%%)",
+		ErrDeleteFractionExceeded, deleted, total, 100*float64(deleted)/float64(total), 100*g.maxFraction)
+
+	if g.dryRun {
+		g.logger.WarnContext(ctx, "Continuing as dry run", slog.Any("error", cause))
+	} else {
+		g.cancel(cause)
+	}
+
+	return false
+}
@@ -0,0 +1,107 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+)
+
+func TestDeleteFractionGuard(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		maxFraction float64
+		dryRun      bool
+		estimate    int64
+		discovered  int
+		deletes     []int
+		wantAdmit   []bool
+		wantTripped bool
+	}{
+		{
+			name:       "disabled",
+			discovered: 1000,
+			deletes:    []int{1000},
+			wantAdmit:  []bool{true},
+		},
+		{
+			name:        "no estimate",
+			maxFraction: 0.1,
+			discovered:  1000,
+			deletes:     []int{1, 1},
+			wantAdmit:   []bool{false, false},
+		},
+		{
+			name:        "small bucket",
+			maxFraction: 0.5,
+			estimate:    10,
+			discovered:  4,
+			deletes:     []int{3, 2, 1},
+			wantAdmit:   []bool{true, true, false},
+			wantTripped: true,
+		},
+		{
+			name:        "below limit",
+			maxFraction: 0.1,
+			estimate:    500,
+			discovered:  1000,
+			deletes:     []int{50, 50},
+			wantAdmit:   []bool{true, true},
+		},
+		{
+			name:        "exceeded",
+			maxFraction: 0.1,
+			estimate:    500,
+			discovered:  1000,
+			deletes:     []int{50, 51, 1},
+			wantAdmit:   []bool{true, false, false},
+			wantTripped: true,
+		},
+		{
+			name:        "estimate",
+			maxFraction: 0.1,
+			estimate:    10000,
+			discovered:  200,
+			deletes:     []int{150},
+			wantAdmit:   []bool{true},
+		},
+		{
+			name:        "dry run",
+			maxFraction: 0.5,
+			dryRun:      true,
+			estimate:    200,
+			discovered:  200,
+			deletes:     []int{101, 1},
+			wantAdmit:   []bool{false, false},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancelCause(context.Background())
+			t.Cleanup(func() { cancel(nil) })
+
+			g := newDeleteFractionGuard(deleteFractionGuardOptions{
+				logger:      slog.New(slog.DiscardHandler),
+				maxFraction: tc.maxFraction,
+				dryRun:      tc.dryRun,
+				cancel:      cancel,
+				estimate:    tc.estimate,
+			})
+
+			for range tc.discovered {
+				g.addDiscovered()
+			}
+
+			for idx, count := range tc.deletes {
+				if got := g.admit(ctx, count); got != tc.wantAdmit[idx] {
+					t.Errorf("admit(%d) = %v, want %v", count, got, tc.wantAdmit[idx])
+				}
+			}
+
+			tripped := errors.Is(context.Cause(ctx), ErrDeleteFractionExceeded)
+
+			if tripped != tc.wantTripped {
+				t.Errorf("Guard tripped=%v, want %v (cause %v)", tripped, tc.wantTripped, context.Cause(ctx))
+			}
+		})
+	}
+}
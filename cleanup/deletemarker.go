@@ -0,0 +1,63 @@
+package cleanup
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DeleteMarkerStrategy selects how keys whose latest version is a delete
+// marker are handled. Backup tools differ in what they expect.
+type DeleteMarkerStrategy int
+
+const (
+	// The most recent version preceding the marker is retained until the
+	// marker is older than the minimum deletion age. Afterwards the marker
+	// is deleted together with the older versions.
+	DeleteMarkerDefault DeleteMarkerStrategy = iota
+
+	// Versions preceding the marker are deleted by their own age like other
+	// noncurrent versions. The marker is deleted as soon as no older
+	// versions remain.
+	DeleteMarkerExpire
+
+	// The marker is never deleted. Versions preceding it are deleted by
+	// their own age like other noncurrent versions.
+	DeleteMarkerKeep
+
+	// Keys are left untouched, neither deleting versions nor extending their
+	// retention.
+	DeleteMarkerSkip
+)
+
+var deleteMarkerStrategyNames = []string{
+	DeleteMarkerDefault: "default",
+	DeleteMarkerExpire:  "expire",
+	DeleteMarkerKeep:    "keep",
+	DeleteMarkerSkip:    "skip",
+}
+
+func (s DeleteMarkerStrategy) String() string {
+	if int(s) < len(deleteMarkerStrategyNames) {
+		return deleteMarkerStrategyNames[s]
+	}
+
+	return fmt.Sprintf("DeleteMarkerStrategy(%d)", int(s))
+}
+
+// ParseDeleteMarkerStrategy returns the strategy with the given name. An
+// empty name selects [DeleteMarkerDefault].
+func ParseDeleteMarkerStrategy(name string) (DeleteMarkerStrategy, error) {
+	if name == "" {
+		return DeleteMarkerDefault, nil
+	}
+
+	for idx, n := range deleteMarkerStrategyNames {
+		if strings.EqualFold(n, name) {
+			return DeleteMarkerStrategy(idx), nil
+		}
+	}
+
+	return DeleteMarkerDefault, fmt.Errorf("%w: unknown delete marker strategy %q (known: %s)",
+		os.ErrInvalid, name, strings.Join(deleteMarkerStrategyNames, ", "))
+}
@@ -0,0 +1,25 @@
+package cleanup
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestParseDeleteMarkerStrategy(t *testing.T) {
+	for _, want := range []DeleteMarkerStrategy{DeleteMarkerDefault, DeleteMarkerExpire, DeleteMarkerKeep, DeleteMarkerSkip} {
+		if got, err := ParseDeleteMarkerStrategy(want.String()); err != nil {
+			t.Errorf("ParseDeleteMarkerStrategy(%q) failed: %v", want, err)
+		} else if got != want {
+			t.Errorf("ParseDeleteMarkerStrategy(%q) = %v, want %v", want, got, want)
+		}
+	}
+
+	if got, err := ParseDeleteMarkerStrategy(""); err != nil || got != DeleteMarkerDefault {
+		t.Errorf("ParseDeleteMarkerStrategy(\"\") = (%v, %v), want default", got, err)
+	}
+
+	if _, err := ParseDeleteMarkerStrategy("unknown"); !errors.Is(err, os.ErrInvalid) {
+		t.Errorf("ParseDeleteMarkerStrategy() error %v, want %v", err, os.ErrInvalid)
+	}
+}
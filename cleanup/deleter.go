@@ -0,0 +1,742 @@
+package cleanup
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/hansmi/s3-object-cleanup/internal/client"
+	"github.com/hansmi/s3-object-cleanup/internal/state"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
+)
+
+const batchSize = 250
+
+type batchDeleterState interface {
+	DeleteObjectRetention(string, string) error
+	GetDeletionSchedule(string, string) (time.Time, error)
+	SetDeletionSchedule(string, string, time.Time) error
+	DeleteDeletionSchedule(string, string) error
+}
+
+type batchDeleterClient interface {
+	DeleteObjects(context.Context, *s3.DeleteObjectsInput, ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+}
+
+type batchDeleterAudit interface {
+	PutDeleteAudit(state.DeleteAudit) error
+}
+
+type batchDeleterCheckFunc func(objectVersion) bool
+
+type batchDeleterMetadataClient interface {
+	HeadObject(context.Context, string, string) (*s3.HeadObjectOutput, error)
+}
+
+type batchDeleterOptions struct {
+	logger *slog.Logger
+	stats  *Stats
+	state  batchDeleterState
+	client batchDeleterClient
+	bucket string
+	dryRun bool
+
+	// Records planned deletions if set.
+	plan *PlanRecorder
+
+	// Records deleted and skipped versions if set.
+	actions *ActionRecorder
+
+	// Collects the largest deletions if set.
+	largest *LargestDeletionsRecorder
+
+	// Maximum number of object versions per DeleteObjects request. Limited
+	// to batchSize.
+	batchSize int
+
+	// Maximum number of object versions deleted per second. Unlimited if
+	// zero or negative.
+	maxRate float64
+
+	// Shared backoff for API requests. A private instance is used if nil.
+	backoff *adaptiveBackoff
+
+	errorGuard *errorRatioGuard
+
+	// Limits the deletions to a fraction of the discovered versions.
+	// Disabled if nil.
+	deleteFraction *deleteFractionGuard
+
+	// Compares deletions with a reviewed plan. Disabled if nil.
+	planReview *planReview
+
+	// Current time for computations. Defaults to [time.Now()].
+	now time.Time
+
+	// Expired versions are only deleted once they have been eligible for
+	// deletion for at least the given duration, measured across runs via
+	// the state. Disabled if zero.
+	quarantinePeriod time.Duration
+
+	// Versions carrying matching user metadata are never deleted. Requires
+	// metadataClient.
+	excludeMetadata *MetadataMatcher
+
+	// Only versions encrypted with the matching KMS key are deleted. Delete
+	// markers carry no data and are left alone. Requires metadataClient.
+	onlyKMSKey *KMSKeyMatcher
+
+	metadataClient batchDeleterMetadataClient
+
+	// Records the outcome of deletions. Disabled if nil.
+	audit batchDeleterAudit
+
+	// Adapts the number of concurrently active workers. A fixed number of
+	// workers is used if nil.
+	tuner *workerTuner
+
+	// Measures the time spent processing items. Disabled if nil.
+	timer *stageTimer
+
+	// Tracks the processing of listed keys for resuming the listing.
+	// Disabled if nil.
+	watermark *listWatermark
+}
+
+type batchDeleter struct {
+	logger     *slog.Logger
+	stats      *Stats
+	state      batchDeleterState
+	actions    *ActionRecorder
+	plan       *PlanRecorder
+	largest    *LargestDeletionsRecorder
+	dryRun     bool
+	client     batchDeleterClient
+	bucket     string
+	workers    int
+	batchSize  int
+	tuner      *workerTuner
+	timer      *stageTimer
+	watermark  *listWatermark
+	limiter    *rate.Limiter
+	backoff    *adaptiveBackoff
+	errorGuard *errorRatioGuard
+
+	deleteFraction *deleteFractionGuard
+	planReview     *planReview
+
+	now              time.Time
+	quarantinePeriod time.Duration
+
+	excludeMetadata *MetadataMatcher
+	onlyKMSKey      *KMSKeyMatcher
+	metadataClient  batchDeleterMetadataClient
+	audit           batchDeleterAudit
+
+	// Number of times failed versions are retried as a batch before being
+	// deleted individually.
+	retries    int
+	retryDelay time.Duration
+}
+
+func newBatchDeleter(opts batchDeleterOptions) *batchDeleter {
+	if opts.now.IsZero() {
+		opts.now = time.Now()
+	}
+
+	if opts.backoff == nil {
+		opts.backoff = newAdaptiveBackoff(opts.stats)
+	}
+
+	if opts.batchSize < 1 || opts.batchSize > batchSize {
+		opts.batchSize = batchSize
+	}
+
+	return &batchDeleter{
+		logger:     opts.logger,
+		stats:      opts.stats,
+		state:      opts.state,
+		plan:       opts.plan,
+		actions:    opts.actions,
+		largest:    opts.largest,
+		dryRun:     opts.dryRun,
+		client:     opts.client,
+		bucket:     opts.bucket,
+		workers:    opts.tuner.workers(),
+		batchSize:  opts.batchSize,
+		tuner:      opts.tuner,
+		timer:      opts.timer,
+		watermark:  opts.watermark,
+		limiter:    newDeleteLimiter(opts.maxRate, opts.batchSize),
+		backoff:    opts.backoff,
+		errorGuard: opts.errorGuard,
+
+		deleteFraction: opts.deleteFraction,
+		planReview:     opts.planReview,
+
+		now:              opts.now,
+		quarantinePeriod: opts.quarantinePeriod,
+
+		excludeMetadata: opts.excludeMetadata,
+		onlyKMSKey:      opts.onlyKMSKey,
+		metadataClient:  opts.metadataClient,
+		audit:           opts.audit,
+
+		retries:    2,
+		retryDelay: time.Second,
+	}
+}
+
+func newDeleteLimiter(maxRate float64, burst int) *rate.Limiter {
+	if maxRate <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+
+	// Allow for full batches.
+	return rate.NewLimiter(rate.Limit(maxRate), burst)
+}
+
+type deleteFailure struct {
+	// Zero value if the error can't be attributed to a requested version.
+	object objectVersion
+	err    types.Error
+}
+
+// deleteObjects issues a single DeleteObjects request and returns the
+// per-version failures.
+func (d *batchDeleter) deleteObjects(ctx context.Context, items []objectVersion) ([]deleteFailure, error) {
+	input := &s3.DeleteObjectsInput{
+		Bucket: aws.String(d.bucket),
+		Delete: &types.Delete{},
+	}
+
+	pending := map[reportObjectKey]objectVersion{}
+
+	for _, i := range items {
+		input.Delete.Objects = append(input.Delete.Objects, i.identifier())
+
+		pending[i.reportKey()] = i
+	}
+
+	if err := d.limiter.WaitN(ctx, len(items)); err != nil {
+		return nil, fmt.Errorf("delete rate limit: %w", err)
+	}
+
+	var output *s3.DeleteObjectsOutput
+
+	if err := d.backoff.do(ctx, func() (err error) {
+		start := time.Now()
+		output, err = d.client.DeleteObjects(ctx, input)
+		d.tuner.observe(time.Since(start))
+
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	d.stats.addDeleteResults(len(output.Deleted), 0)
+
+	for _, i := range output.Deleted {
+		key := aws.ToString(i.Key)
+		versionID := aws.ToString(i.VersionId)
+
+		ov, ok := pending[reportObjectKey{
+			key:       key,
+			versionID: versionID,
+		}]
+		if ok {
+			versionID = ov.stateVersionID()
+
+			if d.actions != nil {
+				d.actions.addDelete(ov, false, nil)
+			}
+		}
+
+		if err := d.recordAudit(ov, nil); err != nil {
+			return nil, err
+		}
+
+		if err := d.state.DeleteObjectRetention(key, versionID); err != nil {
+			return nil, fmt.Errorf("deleting object retention from state: %w", err)
+		}
+
+		if d.quarantinePeriod > 0 {
+			if err := d.state.DeleteDeletionSchedule(key, versionID); err != nil {
+				return nil, fmt.Errorf("deleting deletion schedule from state: %w", err)
+			}
+		}
+	}
+
+	var failures []deleteFailure
+
+	for _, i := range output.Errors {
+		failures = append(failures, deleteFailure{
+			object: pending[reportObjectKey{
+				key:       aws.ToString(i.Key),
+				versionID: aws.ToString(i.VersionId),
+			}],
+			err: i,
+		})
+	}
+
+	return failures, nil
+}
+
+// recordAudit records the outcome of deleting a version. A nil error
+// signifies success.
+func (d *batchDeleter) recordAudit(ov objectVersion, e *types.Error) error {
+	if d.audit == nil || ov.key == "" {
+		return nil
+	}
+
+	a := state.DeleteAudit{
+		Key:          ov.key,
+		VersionID:    ov.stateVersionID(),
+		LastModified: ov.lastModified,
+		Size:         ov.size,
+		DeleteMarker: ov.deleteMarker,
+		At:           time.Now(),
+	}
+
+	if e != nil {
+		a.ErrorCode = cmp.Or(aws.ToString(e.Code), "Unknown")
+		a.ErrorMessage = aws.ToString(e.Message)
+	}
+
+	if err := d.audit.PutDeleteAudit(a); err != nil {
+		return fmt.Errorf("recording deletion in state: %w", err)
+	}
+
+	return nil
+}
+
+// retryableDeleteError reports whether a per-object error returned by
+// DeleteObjects may succeed when retried.
+func retryableDeleteError(e types.Error) bool {
+	switch aws.ToString(e.Code) {
+	case "InternalError", "ServiceUnavailable", "SlowDown", "RequestTimeout":
+		return true
+	}
+
+	return false
+}
+
+func (d *batchDeleter) sleep(ctx context.Context, delay time.Duration) error {
+	t := time.NewTimer(delay)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+	}
+
+	return nil
+}
+
+// deleteWithRetry deletes the given versions. Failures with a transient cause
+// are retried as a smaller batch containing only the failed versions before
+// falling back to deleting them one by one.
+func (d *batchDeleter) deleteWithRetry(ctx context.Context, items []objectVersion) error {
+	var errs []deleteFailure
+
+	delay := d.retryDelay
+
+	for attempt := 0; len(items) > 0; attempt++ {
+		if attempt > 0 {
+			d.stats.addDeleteRetries(len(items))
+
+			if err := d.sleep(ctx, delay); err != nil {
+				d.failedActions(items, err)
+
+				return errors.Join(err, d.reportFailures(ctx, errs))
+			}
+
+			delay *= 2
+		}
+
+		var batches [][]objectVersion
+
+		if attempt > d.retries {
+			// Last resort: delete versions individually.
+			for _, i := range items {
+				batches = append(batches, []objectVersion{i})
+			}
+		} else {
+			batches = append(batches, items)
+		}
+
+		var retry []objectVersion
+
+		for idx, batch := range batches {
+			failures, err := d.deleteObjects(ctx, batch)
+			if err != nil {
+				// Neither the remaining batches nor the versions
+				// awaiting a retry were deleted.
+				d.failedActions(slices.Concat(retry, slices.Concat(batches[idx:]...)), err)
+
+				return errors.Join(err, d.reportFailures(ctx, errs))
+			}
+
+			for _, f := range failures {
+				if aws.ToString(f.err.Code) == "SlowDown" {
+					d.backoff.throttled()
+				}
+
+				if attempt <= d.retries && f.object.key != "" && retryableDeleteError(f.err) {
+					retry = append(retry, f.object)
+				} else {
+					errs = append(errs, f)
+				}
+			}
+		}
+
+		items = retry
+	}
+
+	return d.reportFailures(ctx, errs)
+}
+
+// failedActions records versions whose deletion request failed as a whole in
+// the action log.
+func (d *batchDeleter) failedActions(items []objectVersion, err error) {
+	if d.actions == nil {
+		return
+	}
+
+	failure := newActionError(err)
+
+	for _, i := range items {
+		d.actions.addDelete(i, false, failure)
+	}
+}
+
+// reportFailures counts, logs and records versions which couldn't be deleted.
+func (d *batchDeleter) reportFailures(ctx context.Context, errs []deleteFailure) error {
+	d.stats.addDeleteResults(0, len(errs))
+	d.errorGuard.addErrors(len(errs))
+
+	for _, f := range errs {
+		i := f.err
+
+		class := client.ClassifyErrorCode(aws.ToString(i.Code), aws.ToString(i.Message))
+
+		d.stats.addErrorClass(class)
+
+		d.logger.ErrorContext(ctx, "Delete failed",
+			slog.String("key", aws.ToString(i.Key)),
+			slog.String("version", aws.ToString(i.VersionId)),
+			slog.String("code", aws.ToString(i.Code)),
+			slog.String("msg", aws.ToString(i.Message)),
+			slog.String("error_class", class.String()),
+		)
+
+		if d.actions != nil && f.object.key != "" {
+			d.actions.addDelete(f.object, false, &actionError{
+				code:    aws.ToString(i.Code),
+				message: aws.ToString(i.Message),
+			})
+		}
+
+		if err := d.recordAudit(f.object, &i); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// quarantined reports whether the deletion of a version must be delayed. The
+// first time a version is found to be eligible for deletion the time is
+// recorded in the state.
+func (d *batchDeleter) quarantined(ov objectVersion) (bool, error) {
+	if d.quarantinePeriod <= 0 {
+		return false, nil
+	}
+
+	scheduled, err := d.state.GetDeletionSchedule(ov.key, ov.stateVersionID())
+	if err != nil {
+		return false, fmt.Errorf("getting deletion schedule from state: %w", err)
+	}
+
+	if scheduled.IsZero() {
+		if !d.dryRun {
+			if err := d.state.SetDeletionSchedule(ov.key, ov.stateVersionID(), d.now); err != nil {
+				return false, fmt.Errorf("setting deletion schedule in state: %w", err)
+			}
+		}
+
+		return true, nil
+	}
+
+	return d.now.Before(scheduled.Add(d.quarantinePeriod)), nil
+}
+
+// needHead reports whether eligibility checks require the object metadata.
+func (d *batchDeleter) needHead() bool {
+	return d.excludeMetadata != nil || d.onlyKMSKey != nil
+}
+
+// headObject returns the metadata of a version, reusing the response from
+// annotation if available.
+func (d *batchDeleter) headObject(ctx context.Context, ov objectVersion) (*s3.HeadObjectOutput, error) {
+	if ov.head != nil {
+		return ov.head, nil
+	}
+
+	var output *s3.HeadObjectOutput
+
+	if err := d.backoff.do(ctx, func() (err error) {
+		output, err = d.metadataClient.HeadObject(ctx, ov.key, ov.versionID)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("getting object metadata: %w", err)
+	}
+
+	return output, nil
+}
+
+// skipped records an expired version not deleted in this run.
+func (d *batchDeleter) skipped(ov objectVersion, reason string) {
+	if d.actions != nil {
+		d.actions.addSkip(ov, reason)
+	}
+}
+
+// eligible reports whether an expired version may be deleted in this run.
+func (d *batchDeleter) eligible(ctx context.Context, ov objectVersion) (bool, error) {
+	if d.onlyKMSKey != nil && ov.deleteMarker {
+		d.stats.addEncryptionExcluded()
+		d.skipped(ov, actionReasonKMSKeyMismatch)
+
+		return false, nil
+	}
+
+	// Delete markers have no metadata.
+	if d.needHead() && !ov.deleteMarker {
+		output, err := d.headObject(ctx, ov)
+		if err != nil {
+			return false, err
+		}
+
+		if d.excludeMetadata != nil && output != nil && d.excludeMetadata.match(output.Metadata) {
+			d.logger.InfoContext(ctx, "Deletion prevented by object metadata",
+				slog.Any("object", ov),
+				slog.String("metadata", d.excludeMetadata.String()),
+			)
+
+			d.stats.addMetadataExcluded()
+			d.skipped(ov, actionReasonExcludedMetadata)
+
+			return false, nil
+		}
+
+		if d.onlyKMSKey != nil && !d.onlyKMSKey.match(output) {
+			d.logger.DebugContext(ctx, "Deletion skipped for object not encrypted with KMS key",
+				slog.Any("object", ov),
+				slog.String("kms_key", d.onlyKMSKey.String()),
+			)
+
+			d.stats.addEncryptionExcluded()
+			d.skipped(ov, actionReasonKMSKeyMismatch)
+
+			return false, nil
+		}
+	}
+
+	// The deletion was reviewed for the version as it was at the time, so
+	// its current state is compared before deleting it.
+	if d.planReview.verifies() && !ov.deleteMarker {
+		output, err := d.headObject(ctx, ov)
+		if err != nil {
+			return false, err
+		}
+
+		if output != nil && d.planReview.drifted(ov, aws.ToTime(output.LastModified), aws.ToTime(output.ObjectLockRetainUntilDate)) {
+			d.logger.WarnContext(ctx, "Deletion skipped for version changed since plan review",
+				slog.Any("object", ov),
+				slog.Any("last_modified", output.LastModified),
+				slog.Any("retain_until", output.ObjectLockRetainUntilDate),
+			)
+
+			d.stats.addPlanDrift()
+			d.skipped(ov, actionReasonPlanDrift)
+
+			return false, nil
+		}
+	}
+
+	if q, err := d.quarantined(ov); err != nil {
+		return false, err
+	} else if q {
+		d.logger.DebugContext(ctx, "Deletion delayed by quarantine",
+			slog.Any("object", ov),
+		)
+
+		d.stats.addQuarantined()
+		d.skipped(ov, actionReasonQuarantined)
+
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (d *batchDeleter) deleteBatch(ctx context.Context, items []objectVersion) error {
+	if d.needHead() || d.quarantinePeriod > 0 || d.planReview.verifies() {
+		// The caller reports the whole batch to the watermark, so the
+		// items must not be modified.
+		ready := make([]objectVersion, 0, len(items))
+
+		for _, i := range items {
+			if ok, err := d.eligible(ctx, i); err != nil {
+				d.logger.ErrorContext(ctx, "Deletion eligibility check failed",
+					slog.Any("object", i),
+					slog.Any("error", err))
+				d.stats.addDeleteResults(0, 1)
+				d.stats.addError(err)
+				d.errorGuard.addErrors(1)
+			} else if ok {
+				ready = append(ready, i)
+			}
+		}
+
+		if len(ready) == 0 {
+			return nil
+		}
+
+		items = ready
+	}
+
+	if !d.planReview.admit(ctx, items) {
+		// The review cancelled the run.
+		return nil
+	}
+
+	dryRun := d.dryRun
+
+	if !d.deleteFraction.admit(ctx, len(items)) {
+		if ctx.Err() != nil {
+			// The guard cancelled the run.
+			return nil
+		}
+
+		dryRun = true
+	}
+
+	for _, i := range items {
+		d.logger.InfoContext(ctx, "Delete",
+			slog.Bool("dry_run", dryRun),
+			slog.Any("object", i),
+		)
+
+		d.stats.addDelete(i)
+
+		if d.plan != nil {
+			d.plan.addDelete(i)
+		}
+
+		if dryRun && d.actions != nil {
+			d.actions.addDelete(i, true, nil)
+		}
+
+		d.largest.addDelete(i)
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	return d.deleteWithRetry(ctx, items)
+}
+
+func collectDeletes(ch <-chan objectVersion, size int) []objectVersion {
+	pending := make([]objectVersion, 0, size)
+
+	for ov := range ch {
+		pending = append(pending, ov)
+
+		if len(pending) >= size {
+			break
+		}
+	}
+
+	return pending
+}
+
+func (d *batchDeleter) run(ctx context.Context, in <-chan objectVersion) error {
+	g, ctx := errgroup.WithContext(ctx)
+
+	var panicked workerPanic
+
+	ch := make(chan []objectVersion, 8)
+
+	for range max(1, d.workers) {
+		g.Go(func() error {
+			for items := range ch {
+				if ctx.Err() != nil {
+					// Drain input after cancellation.
+					continue
+				}
+
+				// Only the latency of the requests is observed,
+				// excluding rate limit waits.
+				release, err := d.tuner.acquireSlot(ctx)
+				if err != nil {
+					// Cancelled while waiting.
+					continue
+				}
+
+				done := d.timer.track(stageDeletion)
+				err = recoverItem(d.logger, stageDeletion, func() error {
+					return d.deleteBatch(ctx, items)
+				})
+				done()
+				release()
+
+				if ctx.Err() == nil {
+					// Versions of cancelled batches may not have
+					// been deleted.
+					for _, i := range items {
+						d.watermark.done(i.key, 1)
+					}
+				}
+
+				if err != nil {
+					d.logger.Error("Batch deletion failed", slog.Any("error", err))
+					d.stats.addDeleteResults(0, 1)
+					d.stats.addError(err)
+					d.errorGuard.addErrors(len(items))
+					panicked.add(err)
+					continue
+				}
+			}
+
+			return nil
+		})
+	}
+
+	g.Go(func() error {
+		defer close(ch)
+
+		for {
+			items := collectDeletes(in, d.batchSize)
+
+			if len(items) == 0 {
+				return nil
+			}
+
+			ch <- items
+		}
+	})
+
+	return panicked.wait(g)
+}
@@ -0,0 +1,628 @@
+package cleanup
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/hansmi/s3-object-cleanup/internal/client"
+	"github.com/hansmi/s3-object-cleanup/internal/state"
+)
+
+type fakeDeleteObjectsClient struct {
+	mu    sync.Mutex
+	calls int
+	sizes []int
+
+	// Number of times deleting a key fails with the given error code.
+	failures map[string]int
+	code     string
+
+	// Error of the whole request.
+	err error
+}
+
+func (c *fakeDeleteObjectsClient) DeleteObjects(_ context.Context, input *s3.DeleteObjectsInput, _ ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls++
+	c.sizes = append(c.sizes, len(input.Delete.Objects))
+
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	output := &s3.DeleteObjectsOutput{}
+
+	for _, i := range input.Delete.Objects {
+		if c.failures[*i.Key] > 0 {
+			c.failures[*i.Key]--
+
+			output.Errors = append(output.Errors, types.Error{
+				Key:       i.Key,
+				VersionId: i.VersionId,
+				Code:      aws.String(c.code),
+			})
+			continue
+		}
+
+		output.Deleted = append(output.Deleted, types.DeletedObject{
+			Key:       i.Key,
+			VersionId: i.VersionId,
+		})
+	}
+
+	return output, nil
+}
+
+type fakeBatchDeleterState struct{}
+
+func (fakeBatchDeleterState) DeleteObjectRetention(string, string) error {
+	return nil
+}
+
+func (fakeBatchDeleterState) GetDeletionSchedule(string, string) (time.Time, error) {
+	return time.Time{}, nil
+}
+
+func (fakeBatchDeleterState) SetDeletionSchedule(string, string, time.Time) error {
+	return nil
+}
+
+func (fakeBatchDeleterState) DeleteDeletionSchedule(string, string) error {
+	return nil
+}
+
+func TestBatchDeleter(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	for _, tc := range []struct {
+		name     string
+		versions []objectVersion
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "three",
+			versions: []objectVersion{
+				{key: "a"},
+				{key: "b"},
+				{key: "c"},
+			},
+		},
+		{
+			name: "many",
+			versions: func() []objectVersion {
+				var result []objectVersion
+
+				for i := range (100 * batchSize) + (batchSize / 3) {
+					result = append(result, objectVersion{
+						key: strconv.Itoa(i),
+					})
+				}
+
+				return result
+			}(),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			t.Cleanup(cancel)
+
+			stats := NewStats()
+
+			b, err := client.NewFromName(aws.Config{}, "test")
+			if err != nil {
+				t.Fatalf("NewFromName() failed: %v", err)
+			}
+
+			d := newBatchDeleter(batchDeleterOptions{
+				logger: logger,
+				stats:  stats,
+				client: b.S3(),
+				bucket: b.Name(),
+				dryRun: true,
+			})
+
+			ch := make(chan objectVersion)
+
+			go func() {
+				defer close(ch)
+
+				for _, i := range tc.versions {
+					select {
+					case <-ctx.Done():
+						break
+					case ch <- i:
+					}
+				}
+			}()
+
+			if err := d.run(ctx, ch); err != nil {
+				t.Errorf("run() failed %v", err)
+			}
+
+			if got, want := stats.deleteCount, int64(len(tc.versions)); got != want {
+				t.Errorf("deleteCount=%d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestBatchDeleterMaxRate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	var c fakeDeleteObjectsClient
+
+	stats := NewStats()
+
+	d := newBatchDeleter(batchDeleterOptions{
+		logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+		stats:   stats,
+		state:   fakeBatchDeleterState{},
+		client:  &c,
+		bucket:  "test",
+		maxRate: 2 * batchSize,
+	})
+
+	ch := make(chan objectVersion)
+
+	go func() {
+		defer close(ch)
+
+		for i := range 3 * batchSize {
+			ch <- objectVersion{key: strconv.Itoa(i)}
+		}
+	}()
+
+	start := time.Now()
+
+	if err := d.run(ctx, ch); err != nil {
+		t.Errorf("run() failed %v", err)
+	}
+
+	// The first batch uses the initial burst.
+	if elapsed, want := time.Since(start), 900*time.Millisecond; elapsed < want {
+		t.Errorf("Deletion took %v, want at least %v", elapsed, want)
+	}
+
+	if got, want := stats.deleteSuccessCount, int64(3*batchSize); got != want {
+		t.Errorf("deleteSuccessCount=%d, want %d", got, want)
+	}
+}
+
+func TestBatchDeleterBatchSize(t *testing.T) {
+	var c fakeDeleteObjectsClient
+
+	d := newBatchDeleter(batchDeleterOptions{
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		stats:     NewStats(),
+		state:     fakeBatchDeleterState{},
+		client:    &c,
+		bucket:    "test",
+		batchSize: 40,
+	})
+
+	ch := make(chan objectVersion)
+
+	go func() {
+		defer close(ch)
+
+		for i := range 100 {
+			ch <- objectVersion{key: strconv.Itoa(i)}
+		}
+	}()
+
+	if err := d.run(t.Context(), ch); err != nil {
+		t.Errorf("run() failed %v", err)
+	}
+
+	if diff := cmp.Diff([]int{40, 40, 20}, c.sizes, cmpopts.SortSlices(func(a, b int) bool { return a < b })); diff != "" {
+		t.Errorf("Request sizes diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestBatchDeleterWatermark(t *testing.T) {
+	st := newRetentionStateForTest(t)
+
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	// Only "b" has completed its quarantine.
+	if err := st.SetDeletionSchedule("b", "", now.Add(-2*time.Hour)); err != nil {
+		t.Fatalf("SetDeletionSchedule() failed: %v", err)
+	}
+
+	var got []string
+
+	watermark := newListWatermark(func(m listMarker) {
+		got = append(got, m.keyMarker)
+	})
+
+	var c fakeDeleteObjectsClient
+
+	d := newBatchDeleter(batchDeleterOptions{
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		stats:     NewStats(),
+		state:     st,
+		client:    &c,
+		bucket:    "test",
+		now:       now,
+		watermark: watermark,
+
+		quarantinePeriod: time.Hour,
+	})
+
+	ch := make(chan objectVersion, 2)
+
+	for _, key := range []string{"a", "b"} {
+		watermark.add(key, 1)
+		ch <- objectVersion{key: key}
+	}
+
+	close(ch)
+
+	if err := d.run(t.Context(), ch); err != nil {
+		t.Errorf("run() failed: %v", err)
+	}
+
+	if diff := cmp.Diff([]int{1}, c.sizes); diff != "" {
+		t.Errorf("Request sizes diff (-want +got):\n%s", diff)
+	}
+
+	// The quarantined version of "a" is done as well.
+	if diff := cmp.Diff([]string{"a", "b"}, got); diff != "" {
+		t.Errorf("Marks diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestBatchDeleterRetry(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		code        string
+		failures    map[string]int
+		wantSizes   []int
+		wantSuccess int64
+		wantErrors  int64
+		wantRetries int64
+	}{
+		{
+			name:        "no failures",
+			wantSizes:   []int{4},
+			wantSuccess: 4,
+		},
+		{
+			name:        "retry subset",
+			code:        "InternalError",
+			failures:    map[string]int{"a": 1, "c": 2},
+			wantSizes:   []int{4, 2, 1},
+			wantSuccess: 4,
+			wantRetries: 3,
+		},
+		{
+			name:        "singly",
+			code:        "InternalError",
+			failures:    map[string]int{"a": 3, "b": 3},
+			wantSizes:   []int{4, 2, 2, 1, 1},
+			wantSuccess: 4,
+			wantRetries: 6,
+		},
+		{
+			name:        "persistent",
+			code:        "SlowDown",
+			failures:    map[string]int{"d": 100},
+			wantSizes:   []int{4, 1, 1, 1},
+			wantSuccess: 3,
+			wantErrors:  1,
+			wantRetries: 3,
+		},
+		{
+			name:        "not retryable",
+			code:        "AccessDenied",
+			failures:    map[string]int{"a": 1, "b": 1},
+			wantSizes:   []int{4},
+			wantSuccess: 2,
+			wantErrors:  2,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := fakeDeleteObjectsClient{
+				failures: tc.failures,
+				code:     tc.code,
+			}
+
+			stats := NewStats()
+
+			backoff := newAdaptiveBackoff(nil)
+			backoff.minDelay = time.Microsecond
+			backoff.maxDelay = time.Microsecond
+
+			d := newBatchDeleter(batchDeleterOptions{
+				logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+				stats:   stats,
+				state:   fakeBatchDeleterState{},
+				client:  &c,
+				bucket:  "test",
+				backoff: backoff,
+			})
+			d.retryDelay = time.Millisecond
+
+			if err := d.deleteBatch(context.Background(), []objectVersion{
+				{key: "a"}, {key: "b"}, {key: "c"}, {key: "d"},
+			}); err != nil {
+				t.Errorf("deleteBatch() failed: %v", err)
+			}
+
+			if diff := cmp.Diff(tc.wantSizes, c.sizes); diff != "" {
+				t.Errorf("Request sizes diff (-want +got):\n%s", diff)
+			}
+
+			if got := stats.deleteSuccessCount; got != tc.wantSuccess {
+				t.Errorf("deleteSuccessCount=%d, want %d", got, tc.wantSuccess)
+			}
+
+			if got := stats.deleteErrorCount; got != tc.wantErrors {
+				t.Errorf("deleteErrorCount=%d, want %d", got, tc.wantErrors)
+			}
+
+			if got := stats.deleteRetryCount; got != tc.wantRetries {
+				t.Errorf("deleteRetryCount=%d, want %d", got, tc.wantRetries)
+			}
+		})
+	}
+}
+
+type fakeDeleteAudit struct {
+	mu      sync.Mutex
+	entries map[string]string
+}
+
+func (a *fakeDeleteAudit) PutDeleteAudit(e state.DeleteAudit) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.entries == nil {
+		a.entries = map[string]string{}
+	}
+
+	a.entries[e.Key+"@"+e.VersionID] = e.ErrorCode
+
+	return nil
+}
+
+func TestBatchDeleterAudit(t *testing.T) {
+	c := fakeDeleteObjectsClient{
+		failures: map[string]int{"b": 1},
+		code:     "AccessDenied",
+	}
+
+	var audit fakeDeleteAudit
+
+	d := newBatchDeleter(batchDeleterOptions{
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		stats:  NewStats(),
+		state:  fakeBatchDeleterState{},
+		client: &c,
+		bucket: "test",
+		audit:  &audit,
+	})
+
+	if err := d.deleteBatch(t.Context(), []objectVersion{
+		{key: "a", versionID: "1"},
+		{key: "b", versionID: "2"},
+	}); err != nil {
+		t.Errorf("deleteBatch() failed: %v", err)
+	}
+
+	want := map[string]string{
+		"a@1": "",
+		"b@2": "AccessDenied",
+	}
+
+	if diff := cmp.Diff(want, audit.entries); diff != "" {
+		t.Errorf("Audit diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestBatchDeleterQuarantine(t *testing.T) {
+	ctx := context.Background()
+
+	st := newRetentionStateForTest(t)
+
+	start := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		now             time.Time
+		dryRun          bool
+		wantDeleted     []int
+		wantQuarantined int64
+	}{
+		// Nothing is recorded in dry-run mode.
+		{now: start.Add(-time.Hour), dryRun: true, wantQuarantined: 2},
+		{now: start, wantQuarantined: 2},
+		{now: start.Add(24 * time.Hour), wantQuarantined: 2},
+		{now: start.Add(26 * time.Hour), wantDeleted: []int{2}},
+		// Schedule is removed after successful deletion.
+		{now: start.Add(27 * time.Hour), wantQuarantined: 2},
+	} {
+		var c fakeDeleteObjectsClient
+
+		stats := NewStats()
+
+		d := newBatchDeleter(batchDeleterOptions{
+			logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+			stats:  stats,
+			state:  st,
+			client: &c,
+			bucket: "test",
+			dryRun: tc.dryRun,
+			now:    tc.now,
+
+			quarantinePeriod: 25 * time.Hour,
+		})
+
+		if err := d.deleteBatch(ctx, []objectVersion{{key: "a"}, {key: "b"}}); err != nil {
+			t.Errorf("deleteBatch() failed: %v", err)
+		}
+
+		if diff := cmp.Diff(tc.wantDeleted, c.sizes, cmpopts.EquateEmpty()); diff != "" {
+			t.Errorf("Request sizes at %v diff (-want +got):\n%s", tc.now, diff)
+		}
+
+		if got := stats.quarantinedCount; got != tc.wantQuarantined {
+			t.Errorf("quarantinedCount at %v is %d, want %d", tc.now, got, tc.wantQuarantined)
+		}
+	}
+}
+
+type fakeMetadataClient map[string]map[string]string
+
+func (c fakeMetadataClient) HeadObject(_ context.Context, key, _ string) (*s3.HeadObjectOutput, error) {
+	return &s3.HeadObjectOutput{
+		Metadata: c[key],
+	}, nil
+}
+
+func TestBatchDeleterExcludeMetadata(t *testing.T) {
+	var c fakeDeleteObjectsClient
+
+	stats := NewStats()
+
+	m, err := ParseMetadataMatcher("hold=true")
+	if err != nil {
+		t.Fatalf("parseMetadataMatcher() failed: %v", err)
+	}
+
+	d := newBatchDeleter(batchDeleterOptions{
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		stats:  stats,
+		state:  fakeBatchDeleterState{},
+		client: &c,
+		bucket: "test",
+
+		excludeMetadata: m,
+		metadataClient: fakeMetadataClient{
+			"held":  {"hold": "true"},
+			"other": {"hold": "false"},
+		},
+	})
+
+	if err := d.deleteBatch(t.Context(), []objectVersion{
+		{key: "held"},
+		{key: "held", deleteMarker: true},
+		{key: "other"},
+		{key: "plain"},
+	}); err != nil {
+		t.Errorf("deleteBatch() failed: %v", err)
+	}
+
+	if diff := cmp.Diff([]int{3}, c.sizes); diff != "" {
+		t.Errorf("Request sizes diff (-want +got):\n%s", diff)
+	}
+
+	if got := stats.metadataExcludedCount; got != 1 {
+		t.Errorf("metadataExcludedCount=%d, want 1", got)
+	}
+}
+
+func TestBatchDeleterReuseHead(t *testing.T) {
+	var c fakeDeleteObjectsClient
+
+	stats := NewStats()
+
+	m, err := ParseMetadataMatcher("hold=true")
+	if err != nil {
+		t.Fatalf("parseMetadataMatcher() failed: %v", err)
+	}
+
+	d := newBatchDeleter(batchDeleterOptions{
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		stats:  stats,
+		state:  fakeBatchDeleterState{},
+		client: &c,
+		bucket: "test",
+
+		excludeMetadata: m,
+		metadataClient:  fakeMetadataClient{},
+	})
+
+	// The response from annotation takes precedence over a new request.
+	if err := d.deleteBatch(t.Context(), []objectVersion{
+		{key: "held", head: &s3.HeadObjectOutput{Metadata: map[string]string{"hold": "true"}}},
+		{key: "other", head: &s3.HeadObjectOutput{}},
+		{key: "plain"},
+	}); err != nil {
+		t.Errorf("deleteBatch() failed: %v", err)
+	}
+
+	if diff := cmp.Diff([]int{2}, c.sizes); diff != "" {
+		t.Errorf("Request sizes diff (-want +got):\n%s", diff)
+	}
+
+	if got := stats.metadataExcludedCount; got != 1 {
+		t.Errorf("metadataExcludedCount=%d, want 1", got)
+	}
+}
+
+type fakeEncryptionClient map[string]string
+
+func (c fakeEncryptionClient) HeadObject(_ context.Context, key, _ string) (*s3.HeadObjectOutput, error) {
+	output := &s3.HeadObjectOutput{
+		ServerSideEncryption: types.ServerSideEncryptionAes256,
+	}
+
+	if keyID, ok := c[key]; ok {
+		output.ServerSideEncryption = types.ServerSideEncryptionAwsKms
+		output.SSEKMSKeyId = aws.String(keyID)
+	}
+
+	return output, nil
+}
+
+func TestBatchDeleterOnlyKMSKey(t *testing.T) {
+	var c fakeDeleteObjectsClient
+
+	stats := NewStats()
+
+	d := newBatchDeleter(batchDeleterOptions{
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		stats:  stats,
+		state:  fakeBatchDeleterState{},
+		client: &c,
+		bucket: "test",
+
+		onlyKMSKey: NewKMSKeyMatcher("arn:aws:kms:us-east-1:111122223333:key/old"),
+		metadataClient: fakeEncryptionClient{
+			"old":   "arn:aws:kms:us-east-1:111122223333:key/old",
+			"other": "arn:aws:kms:us-east-1:111122223333:key/new",
+		},
+	})
+
+	if err := d.deleteBatch(t.Context(), []objectVersion{
+		{key: "old"},
+		{key: "old", deleteMarker: true},
+		{key: "other"},
+		{key: "plain"},
+	}); err != nil {
+		t.Errorf("deleteBatch() failed: %v", err)
+	}
+
+	if diff := cmp.Diff([]int{1}, c.sizes); diff != "" {
+		t.Errorf("Request sizes diff (-want +got):\n%s", diff)
+	}
+
+	if got := stats.encryptionExcludedCount; got != 3 {
+		t.Errorf("encryptionExcludedCount=%d, want 3", got)
+	}
+}
@@ -0,0 +1,39 @@
+// Package cleanup implements the engine of s3-object-cleanup for embedding in
+// other programs. [Run] processes a single bucket: object versions are
+// listed, annotated with their retention, grouped into version series per key
+// and either get their retention extended or are deleted once expired.
+//
+// A minimal embedding:
+//
+//	c, err := cleanup.NewClient(cfg, "bucket")
+//	if err != nil {
+//		return err
+//	}
+//
+//	store, err := cleanup.OpenState("/var/lib/cleanup/state.db")
+//	if err != nil {
+//		return err
+//	}
+//
+//	defer store.Close()
+//
+//	stats := cleanup.NewStats()
+//
+//	err = cleanup.Run(ctx, cleanup.Options{
+//		State:          store,
+//		Client:         c,
+//		Stats:          stats,
+//		MinDeletionAge: 30 * 24 * time.Hour,
+//		MinRetention:   30 * 24 * time.Hour,
+//	})
+//
+//	slog.Info("Statistics", stats.Attrs()...)
+//
+// The actions for each version series are decided by a [Policy]. Custom
+// policies can wrap [DefaultPolicy] or replace it entirely.
+//
+// Buckets without Object Lock skip the retention lookups and extensions.
+// Without retention nothing protects the versions from deletion, so
+// destructive runs on such buckets fail with [ErrObjectLockDisabled] unless
+// [Options].AllowUnlocked is set.
+package cleanup
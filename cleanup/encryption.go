@@ -0,0 +1,55 @@
+package cleanup
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// KMSKeyMatcher matches objects encrypted with a specific KMS key. The key
+// may be given as a full ARN or as a bare key ID or alias name, in which case
+// only the resource part of the ARN reported by S3 is compared.
+type KMSKeyMatcher struct {
+	key string
+}
+
+func NewKMSKeyMatcher(key string) *KMSKeyMatcher {
+	key = strings.TrimSpace(key)
+
+	if key == "" {
+		return nil
+	}
+
+	return &KMSKeyMatcher{key: key}
+}
+
+func (m *KMSKeyMatcher) String() string {
+	return m.key
+}
+
+func (m *KMSKeyMatcher) match(output *s3.HeadObjectOutput) bool {
+	if output == nil {
+		return false
+	}
+
+	switch output.ServerSideEncryption {
+	case types.ServerSideEncryptionAwsKms, types.ServerSideEncryptionAwsKmsDsse:
+	default:
+		return false
+	}
+
+	got := aws.ToString(output.SSEKMSKeyId)
+
+	if got == m.key {
+		return true
+	}
+
+	// "arn:aws:kms:region:account:key/1234abcd-…"
+	if _, resource, ok := strings.Cut(got, ":key/"); ok && resource == strings.TrimPrefix(m.key, "key/") {
+		return true
+	}
+
+	return false
+}
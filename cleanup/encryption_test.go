@@ -0,0 +1,64 @@
+package cleanup
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestKMSKeyMatcher(t *testing.T) {
+	const arn = "arn:aws:kms:eu-central-1:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+
+	for _, tc := range []struct {
+		name   string
+		key    string
+		output *s3.HeadObjectOutput
+		want   bool
+	}{
+		{
+			name: "missing output",
+			key:  arn,
+		},
+		{
+			name: "unencrypted",
+			key:  arn,
+			output: &s3.HeadObjectOutput{
+				ServerSideEncryption: types.ServerSideEncryptionAes256,
+			},
+		},
+		{
+			name: "full arn",
+			key:  arn,
+			output: &s3.HeadObjectOutput{
+				ServerSideEncryption: types.ServerSideEncryptionAwsKms,
+				SSEKMSKeyId:          aws.String(arn),
+			},
+			want: true,
+		},
+		{
+			name: "key id",
+			key:  "1234abcd-12ab-34cd-56ef-1234567890ab",
+			output: &s3.HeadObjectOutput{
+				ServerSideEncryption: types.ServerSideEncryptionAwsKmsDsse,
+				SSEKMSKeyId:          aws.String(arn),
+			},
+			want: true,
+		},
+		{
+			name: "other key",
+			key:  "ffffffff-12ab-34cd-56ef-1234567890ab",
+			output: &s3.HeadObjectOutput{
+				ServerSideEncryption: types.ServerSideEncryptionAwsKms,
+				SSEKMSKeyId:          aws.String(arn),
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := NewKMSKeyMatcher(tc.key).match(tc.output); got != tc.want {
+				t.Errorf("match() returned %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
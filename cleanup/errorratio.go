@@ -0,0 +1,69 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrErrorRatioExceeded is the cause of runs aborted by Options.MaxErrorRatio.
+var ErrErrorRatioExceeded = errors.New("error ratio exceeded")
+
+// Minimum number of processed object versions before the error ratio is
+// evaluated. Avoids aborting on the very first error.
+const errorRatioMinProcessed = 100
+
+// errorRatioGuard cancels a bucket cleanup when the ratio of errors to
+// processed object versions exceeds a limit. A nil guard is valid and never
+// trips.
+type errorRatioGuard struct {
+	mu        sync.Mutex
+	maxRatio  float64
+	cancel    context.CancelCauseFunc
+	processed int64
+	errors    int64
+	tripped   bool
+}
+
+func newErrorRatioGuard(maxRatio float64, cancel context.CancelCauseFunc) *errorRatioGuard {
+	if maxRatio <= 0 {
+		return nil
+	}
+
+	return &errorRatioGuard{
+		maxRatio: maxRatio,
+		cancel:   cancel,
+	}
+}
+
+func (g *errorRatioGuard) addProcessed() {
+	if g == nil {
+		return
+	}
+
+	g.mu.Lock()
+	g.processed++
+	g.mu.Unlock()
+}
+
+func (g *errorRatioGuard) addErrors(count int) {
+	if g == nil || count < 1 {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.errors += int64(count)
+
+	if g.tripped || g.processed < errorRatioMinProcessed {
+		return
+	}
+
+	if ratio := float64(g.errors) / float64(g.processed); ratio > g.maxRatio {
+		g.tripped = true
+		g.cancel(fmt.Errorf("%w: %d errors for %d object versions (%.1f%%, limit %.1f%%)",
+			ErrErrorRatioExceeded, g.errors, g.processed, 100*ratio, 100*g.maxRatio))
+	}
+}
@@ -0,0 +1,63 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestErrorRatioGuard(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		maxRatio    float64
+		processed   int
+		errors      int
+		wantTripped bool
+	}{
+		{
+			name:      "disabled",
+			processed: 1000,
+			errors:    1000,
+		},
+		{
+			name:      "below minimum",
+			maxRatio:  0.01,
+			processed: errorRatioMinProcessed - 1,
+			errors:    50,
+		},
+		{
+			name:      "below limit",
+			maxRatio:  0.1,
+			processed: 1000,
+			errors:    100,
+		},
+		{
+			name:        "exceeded",
+			maxRatio:    0.1,
+			processed:   1000,
+			errors:      101,
+			wantTripped: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancelCause(context.Background())
+			t.Cleanup(func() { cancel(nil) })
+
+			g := newErrorRatioGuard(tc.maxRatio, cancel)
+
+			for range tc.processed {
+				g.addProcessed()
+			}
+
+			for range tc.errors {
+				g.addErrors(1)
+			}
+
+			tripped := errors.Is(context.Cause(ctx), ErrErrorRatioExceeded)
+
+			if tripped != tc.wantTripped {
+				t.Errorf("Guard tripped=%v, want %v (cause %v)", tripped, tc.wantTripped, context.Cause(ctx))
+			}
+		})
+	}
+}
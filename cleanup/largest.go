@@ -0,0 +1,144 @@
+package cleanup
+
+import (
+	"cmp"
+	"container/heap"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// LargestDeletion is one of the largest versions deleted by a run, or to be
+// deleted in a dry run.
+type LargestDeletion struct {
+	Bucket       string    `json:"bucket"`
+	Key          string    `json:"key"`
+	VersionID    string    `json:"version_id"`
+	Size         int64     `json:"size"`
+	SizeText     string    `json:"size_text"`
+	LastModified time.Time `json:"last_modified"`
+	AgeDays      int64     `json:"age_days"`
+}
+
+// largestDeletionHeap is a min-heap by size, keeping the smallest of the
+// collected deletions at the top for replacement.
+type largestDeletionHeap []LargestDeletion
+
+func (h largestDeletionHeap) Len() int           { return len(h) }
+func (h largestDeletionHeap) Less(i, j int) bool { return h[i].Size < h[j].Size }
+func (h largestDeletionHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *largestDeletionHeap) Push(x any) {
+	*h = append(*h, x.(LargestDeletion))
+}
+
+func (h *largestDeletionHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+
+	return x
+}
+
+// LargestDeletions collects the largest deleted versions across buckets so
+// that reviewers of a dry run see the most significant deletions first. Its
+// safe for concurrent use.
+type LargestDeletions struct {
+	mu    sync.Mutex
+	limit int
+	items largestDeletionHeap
+	now   func() time.Time
+}
+
+var _ slog.LogValuer = (*LargestDeletions)(nil)
+
+// NewLargestDeletions returns a collector keeping the given number of
+// deletions.
+func NewLargestDeletions(limit int) *LargestDeletions {
+	return &LargestDeletions{
+		limit: max(0, limit),
+		now:   time.Now,
+	}
+}
+
+func (l *LargestDeletions) add(bucket string, ov objectVersion) {
+	if ov.deleteMarker {
+		// Delete markers occupy no storage.
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit == 0 || (len(l.items) >= l.limit && ov.size <= l.items[0].Size) {
+		return
+	}
+
+	entry := LargestDeletion{
+		Bucket:       bucket,
+		Key:          ov.key,
+		VersionID:    ov.versionID,
+		Size:         ov.size,
+		SizeText:     humanize.IBytes(uint64(max(0, ov.size))),
+		LastModified: ov.lastModified,
+	}
+
+	if !ov.lastModified.IsZero() {
+		entry.AgeDays = int64(l.now().Sub(ov.lastModified) / (24 * time.Hour))
+	}
+
+	if len(l.items) >= l.limit {
+		l.items[0] = entry
+		heap.Fix(&l.items, 0)
+	} else {
+		heap.Push(&l.items, entry)
+	}
+}
+
+// Sorted returns the collected deletions, largest first.
+func (l *LargestDeletions) Sorted() []LargestDeletion {
+	l.mu.Lock()
+	result := slices.Clone(l.items)
+	l.mu.Unlock()
+
+	slices.SortFunc(result, func(a, b LargestDeletion) int {
+		return cmp.Or(
+			cmp.Compare(b.Size, a.Size),
+			cmp.Compare(a.Bucket, b.Bucket),
+			cmp.Compare(a.Key, b.Key),
+			cmp.Compare(a.VersionID, b.VersionID),
+		)
+	})
+
+	return result
+}
+
+func (l *LargestDeletions) LogValue() slog.Value {
+	return slog.AnyValue(l.Sorted())
+}
+
+// ForBucket returns a recorder adding the deletions of the given bucket.
+func (l *LargestDeletions) ForBucket(name string) *LargestDeletionsRecorder {
+	return &LargestDeletionsRecorder{
+		largest: l,
+		bucket:  name,
+	}
+}
+
+// LargestDeletionsRecorder adds the deletions of a single bucket to a
+// collection of the largest deletions. A nil value is valid and ignores all
+// deletions.
+type LargestDeletionsRecorder struct {
+	largest *LargestDeletions
+	bucket  string
+}
+
+func (r *LargestDeletionsRecorder) addDelete(ov objectVersion) {
+	if r != nil {
+		r.largest.add(r.bucket, ov)
+	}
+}
@@ -0,0 +1,121 @@
+package cleanup
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLargestDeletions(t *testing.T) {
+	now := time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC)
+	lastModified := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name  string
+		limit int
+		sizes []int64
+		want  []int64
+	}{
+		{name: "disabled", sizes: []int64{1, 2, 3}},
+		{name: "empty", limit: 3},
+		{name: "fewer", limit: 3, sizes: []int64{5, 20}, want: []int64{20, 5}},
+		{
+			name:  "more",
+			limit: 3,
+			sizes: []int64{5, 100, 1, 30, 30, 2, 50},
+			want:  []int64{100, 50, 30},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l := NewLargestDeletions(tc.limit)
+			l.now = func() time.Time { return now }
+
+			r := l.ForBucket("bucket")
+
+			for _, size := range tc.sizes {
+				r.addDelete(objectVersion{key: "key", versionID: "v", size: size, lastModified: lastModified})
+			}
+
+			r.addDelete(objectVersion{key: "marker", deleteMarker: true})
+
+			var got []int64
+
+			for _, i := range l.Sorted() {
+				got = append(got, i.Size)
+
+				if i.AgeDays != 152 {
+					t.Errorf("Age of %+v is %d days, want 152", i, i.AgeDays)
+				}
+			}
+
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Sizes diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	var disabled *LargestDeletionsRecorder
+
+	disabled.addDelete(objectVersion{size: 1})
+}
+
+func TestLargestDeletionsLogValue(t *testing.T) {
+	var buf bytes.Buffer
+
+	l := NewLargestDeletions(2)
+	l.now = func() time.Time {
+		return time.Date(2020, time.January, 11, 0, 0, 0, 0, time.UTC)
+	}
+
+	l.ForBucket("first").addDelete(objectVersion{
+		key:          "small",
+		versionID:    "v1",
+		size:         1024,
+		lastModified: time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+	})
+	l.ForBucket("second").addDelete(objectVersion{
+		key:          "large",
+		versionID:    "v2",
+		size:         3 * 1024 * 1024,
+		lastModified: time.Date(2019, time.January, 11, 0, 0, 0, 0, time.UTC),
+	})
+
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("test", slog.Any("largest", l))
+
+	var got struct {
+		Largest []LargestDeletion `json:"largest"`
+	}
+
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+
+	want := []LargestDeletion{
+		{
+			Bucket:       "second",
+			Key:          "large",
+			VersionID:    "v2",
+			Size:         3 * 1024 * 1024,
+			SizeText:     "3.0 MiB",
+			LastModified: time.Date(2019, time.January, 11, 0, 0, 0, 0, time.UTC),
+			AgeDays:      365,
+		},
+		{
+			Bucket:       "first",
+			Key:          "small",
+			VersionID:    "v1",
+			Size:         1024,
+			SizeText:     "1.0 KiB",
+			LastModified: time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+			AgeDays:      10,
+		},
+	}
+
+	if diff := cmp.Diff(want, got.Largest); diff != "" {
+		t.Errorf("Logged deletions diff (-want +got):\n%s", diff)
+	}
+}
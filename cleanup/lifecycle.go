@@ -0,0 +1,142 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+type lifecycleRulesClient interface {
+	LifecycleRules(context.Context) ([]types.LifecycleRule, error)
+}
+
+// lifecycleRulePrefix returns the key prefix to which a rule applies.
+func lifecycleRulePrefix(rule types.LifecycleRule) string {
+	if f := rule.Filter; f != nil {
+		if f.And != nil {
+			return aws.ToString(f.And.Prefix)
+		}
+
+		return aws.ToString(f.Prefix)
+	}
+
+	return aws.ToString(rule.Prefix)
+}
+
+// lifecycleNoncurrentDays returns the number of days after which a rule first
+// expires or transitions noncurrent versions. The second return value is false
+// if the rule doesn't act on noncurrent versions.
+func lifecycleNoncurrentDays(rule types.LifecycleRule) (int32, bool) {
+	var days []int32
+
+	if e := rule.NoncurrentVersionExpiration; e != nil {
+		days = append(days, aws.ToInt32(e.NoncurrentDays))
+	}
+
+	for _, t := range rule.NoncurrentVersionTransitions {
+		days = append(days, aws.ToInt32(t.NoncurrentDays))
+	}
+
+	if len(days) == 0 {
+		return 0, false
+	}
+
+	return slices.Min(days), true
+}
+
+// lifecycleConflicts returns the enabled rules which expire or transition
+// noncurrent versions of keys with the given prefix before the horizon has
+// passed since they became noncurrent. Filters other than the prefix, e.g.
+// tags or object sizes, are not evaluated.
+func lifecycleConflicts(rules []types.LifecycleRule, prefix string, horizon time.Duration) []types.LifecycleRule {
+	var result []types.LifecycleRule
+
+	for _, rule := range rules {
+		if rule.Status != types.ExpirationStatusEnabled {
+			continue
+		}
+
+		if days, ok := lifecycleNoncurrentDays(rule); !ok || time.Duration(days)*24*time.Hour >= horizon {
+			continue
+		}
+
+		rulePrefix := lifecycleRulePrefix(rule)
+
+		if strings.HasPrefix(rulePrefix, prefix) || strings.HasPrefix(prefix, rulePrefix) {
+			result = append(result, rule)
+		}
+	}
+
+	return result
+}
+
+func lifecycleRuleAttrs(rule types.LifecycleRule) []any {
+	attrs := []any{
+		slog.String("rule_id", aws.ToString(rule.ID)),
+		slog.String("rule_prefix", lifecycleRulePrefix(rule)),
+	}
+
+	if f := rule.Filter; f != nil && (f.Tag != nil || f.ObjectSizeGreaterThan != nil || f.ObjectSizeLessThan != nil ||
+		(f.And != nil && (len(f.And.Tags) > 0 || f.And.ObjectSizeGreaterThan != nil || f.And.ObjectSizeLessThan != nil))) {
+		attrs = append(attrs, slog.Bool("additional_filters", true))
+	}
+
+	if e := rule.NoncurrentVersionExpiration; e != nil {
+		attrs = append(attrs, slog.Group("noncurrent_expiration",
+			slog.Int("days", int(aws.ToInt32(e.NoncurrentDays))),
+			slog.Int("newer_noncurrent_versions", int(aws.ToInt32(e.NewerNoncurrentVersions))),
+		))
+	}
+
+	var transitions []string
+
+	for _, t := range rule.NoncurrentVersionTransitions {
+		transitions = append(transitions, fmt.Sprintf("%s after %d days", t.StorageClass, aws.ToInt32(t.NoncurrentDays)))
+	}
+
+	if len(transitions) > 0 {
+		attrs = append(attrs, slog.Any("noncurrent_transitions", transitions))
+	}
+
+	return attrs
+}
+
+type lifecycleCheckOptions struct {
+	logger         *slog.Logger
+	client         lifecycleRulesClient
+	prefix         string
+	minRetention   time.Duration
+	minDeletionAge time.Duration
+}
+
+// checkLifecycleConflicts warns about lifecycle rules acting on noncurrent
+// versions before their extended retention may have ended or before they
+// reach the minimum deletion age. Expiring locked versions fails until the
+// retention ends and retention extended on transitioned versions may be
+// wasted. Errors are only logged as reading lifecycle rules is optional.
+func checkLifecycleConflicts(ctx context.Context, opts lifecycleCheckOptions) {
+	rules, err := opts.client.LifecycleRules(ctx)
+	if err != nil {
+		opts.logger.DebugContext(ctx, "Reading lifecycle rules failed", slog.Any("error", err))
+		return
+	}
+
+	// Retention of a version is extended until it becomes noncurrent, so it
+	// may remain locked for up to the minimum retention afterwards.
+	horizon := max(opts.minRetention, opts.minDeletionAge)
+
+	for _, rule := range lifecycleConflicts(rules, opts.prefix, horizon) {
+		attrs := append(lifecycleRuleAttrs(rule),
+			slog.String("prefix", opts.prefix),
+			slog.Duration("min_retention", opts.minRetention),
+			slog.Duration("min_age", opts.minDeletionAge))
+
+		opts.logger.WarnContext(ctx, "Lifecycle rule acts on noncurrent versions with extended retention", attrs...)
+	}
+}
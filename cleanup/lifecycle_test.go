@@ -0,0 +1,159 @@
+package cleanup
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+type fakeLifecycleRulesClient struct {
+	rules []types.LifecycleRule
+	err   error
+}
+
+func (c fakeLifecycleRulesClient) LifecycleRules(context.Context) ([]types.LifecycleRule, error) {
+	return c.rules, c.err
+}
+
+func TestLifecycleConflicts(t *testing.T) {
+	rules := []types.LifecycleRule{
+		{
+			ID:     aws.String("disabled"),
+			Status: types.ExpirationStatusDisabled,
+			NoncurrentVersionExpiration: &types.NoncurrentVersionExpiration{
+				NoncurrentDays: aws.Int32(1),
+			},
+		},
+		{
+			ID:     aws.String("current only"),
+			Status: types.ExpirationStatusEnabled,
+			Expiration: &types.LifecycleExpiration{
+				Days: aws.Int32(1),
+			},
+		},
+		{
+			ID:     aws.String("all"),
+			Status: types.ExpirationStatusEnabled,
+			Filter: &types.LifecycleRuleFilter{},
+			NoncurrentVersionExpiration: &types.NoncurrentVersionExpiration{
+				NoncurrentDays: aws.Int32(30),
+			},
+		},
+		{
+			ID:     aws.String("logs"),
+			Status: types.ExpirationStatusEnabled,
+			Filter: &types.LifecycleRuleFilter{
+				And: &types.LifecycleRuleAndOperator{
+					Prefix: aws.String("logs/"),
+					Tags:   []types.Tag{{Key: aws.String("k"), Value: aws.String("v")}},
+				},
+			},
+			NoncurrentVersionTransitions: []types.NoncurrentVersionTransition{
+				{NoncurrentDays: aws.Int32(7), StorageClass: types.TransitionStorageClassGlacier},
+			},
+		},
+		{
+			ID:     aws.String("late"),
+			Status: types.ExpirationStatusEnabled,
+			Filter: &types.LifecycleRuleFilter{},
+			NoncurrentVersionExpiration: &types.NoncurrentVersionExpiration{
+				NoncurrentDays: aws.Int32(365),
+			},
+		},
+		{
+			ID:     aws.String("legacy"),
+			Status: types.ExpirationStatusEnabled,
+			Prefix: aws.String("data/archive/"),
+			NoncurrentVersionExpiration: &types.NoncurrentVersionExpiration{
+				NewerNoncurrentVersions: aws.Int32(3),
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		name    string
+		prefix  string
+		horizon time.Duration
+		want    []string
+	}{
+		{name: "all", horizon: 90 * 24 * time.Hour, want: []string{"all", "logs", "legacy"}},
+		{name: "logs", prefix: "logs/app/", horizon: 90 * 24 * time.Hour, want: []string{"all", "logs"}},
+		{name: "data", prefix: "data/", horizon: 90 * 24 * time.Hour, want: []string{"all", "legacy"}},
+		{name: "other", prefix: "other/", horizon: 90 * 24 * time.Hour, want: []string{"all"}},
+		{name: "short horizon", horizon: 7 * 24 * time.Hour, want: []string{"legacy"}},
+		{name: "long horizon", horizon: 400 * 24 * time.Hour, want: []string{"all", "logs", "late", "legacy"}},
+		{name: "no horizon"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+
+			for _, rule := range lifecycleConflicts(rules, tc.prefix, tc.horizon) {
+				got = append(got, aws.ToString(rule.ID))
+			}
+
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("lifecycleConflicts() diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCheckLifecycleConflicts(t *testing.T) {
+	var buf bytes.Buffer
+
+	checkLifecycleConflicts(t.Context(), lifecycleCheckOptions{
+		logger: slog.New(slog.NewJSONHandler(&buf, nil)),
+		client: fakeLifecycleRulesClient{
+			rules: []types.LifecycleRule{
+				{
+					ID:     aws.String("late"),
+					Status: types.ExpirationStatusEnabled,
+					NoncurrentVersionExpiration: &types.NoncurrentVersionExpiration{
+						NoncurrentDays: aws.Int32(90),
+					},
+				},
+				{
+					ID:     aws.String("expire"),
+					Status: types.ExpirationStatusEnabled,
+					NoncurrentVersionExpiration: &types.NoncurrentVersionExpiration{
+						NoncurrentDays: aws.Int32(30),
+					},
+					NoncurrentVersionTransitions: []types.NoncurrentVersionTransition{
+						{NoncurrentDays: aws.Int32(7), StorageClass: types.TransitionStorageClassGlacierIr},
+					},
+				},
+			},
+		},
+		minRetention:   24 * time.Hour,
+		minDeletionAge: 30 * 24 * time.Hour,
+	})
+
+	for _, want := range []string{`"level":"WARN"`, `"rule_id":"expire"`, `"days":30`, `"GLACIER_IR after 7 days"`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Log %q doesn't contain %q", buf.String(), want)
+		}
+	}
+
+	if strings.Contains(buf.String(), `"rule_id":"late"`) {
+		t.Errorf("Log %q warns about rule acting after the minimum age", buf.String())
+	}
+
+	buf.Reset()
+
+	checkLifecycleConflicts(t.Context(), lifecycleCheckOptions{
+		logger: slog.New(slog.NewJSONHandler(&buf, nil)),
+		client: fakeLifecycleRulesClient{err: os.ErrPermission},
+	})
+
+	if buf.Len() != 0 {
+		t.Errorf("Unexpected log output: %s", buf.String())
+	}
+}
@@ -0,0 +1,575 @@
+package cleanup
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+	"unique"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"golang.org/x/sync/errgroup"
+)
+
+type listHandler struct {
+	out chan<- objectVersion
+
+	// Only versions of keys matching the manifest are forwarded if set.
+	onlyKeys *KeyManifest
+
+	// Only versions of keys in the shard are forwarded.
+	shard KeyShard
+
+	// Counts forwarded versions if set.
+	stats *Stats
+
+	// More than one entry of a key may be flagged as the latest. Only the
+	// most recent of them is forwarded as such.
+	duplicateLatest bool
+
+	// Versions of the current key. They're forwarded once the listing moves
+	// on to another key so that their number is known.
+	pending []objectVersion
+
+	// Tracks the processing of forwarded versions if set.
+	watermark *listWatermark
+}
+
+func newListHandler(out chan<- objectVersion) *listHandler {
+	return &listHandler{
+		out: out,
+	}
+}
+
+// Best-effort string interning. Object keys occur multiple times if there are
+// versions.
+func (h *listHandler) internString(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return unique.Make(*s).Value()
+}
+
+func (h *listHandler) skip(key *string) bool {
+	k := aws.ToString(key)
+
+	return (h.onlyKeys != nil && !h.onlyKeys.match(k)) || !h.shard.contains(k)
+}
+
+// add buffers a version of a key. The versions of the previous key are
+// forwarded if the key differs.
+func (h *listHandler) add(ov objectVersion) {
+	if len(h.pending) > 0 && h.pending[0].key != ov.key {
+		h.flush()
+	}
+
+	h.pending = append(h.pending, ov)
+}
+
+func (h *listHandler) addListed(count int) {
+	if h.stats != nil {
+		h.stats.addListed(count)
+	}
+}
+
+// resolveLatest keeps the latest flag only on the most recent of the pending
+// versions claiming it. Entries are listed newest first, so the earlier entry
+// wins ties.
+func (h *listHandler) resolveLatest() {
+	latest := -1
+
+	for idx, ov := range h.pending {
+		if ov.isLatest && (latest < 0 || ov.lastModified.After(h.pending[latest].lastModified)) {
+			latest = idx
+		}
+	}
+
+	for idx := range h.pending {
+		h.pending[idx].isLatest = idx == latest
+	}
+}
+
+// flush forwards the buffered versions.
+func (h *listHandler) flush() {
+	if h.duplicateLatest {
+		h.resolveLatest()
+	}
+
+	h.addListed(len(h.pending))
+
+	if len(h.pending) > 0 {
+		h.watermark.add(h.pending[0].key, len(h.pending))
+	}
+
+	for idx, ov := range h.pending {
+		ov.keyVersionCount = len(h.pending)
+		ov.listOrder = idx
+
+		h.out <- ov
+	}
+
+	h.pending = h.pending[:0]
+}
+
+// versionListedFirst reports whether a version precedes a delete marker in the
+// listing. Entries are sorted by key and newest first within a key.
+func versionListedFirst(v types.ObjectVersion, m types.DeleteMarkerEntry) bool {
+	if vk, mk := aws.ToString(v.Key), aws.ToString(m.Key); vk != mk {
+		return vk < mk
+	}
+
+	if c := aws.ToTime(v.LastModified).Compare(aws.ToTime(m.LastModified)); c != 0 {
+		return c > 0
+	}
+
+	// The latest entry is the most recent one.
+	return aws.ToBool(v.IsLatest) || !aws.ToBool(m.IsLatest)
+}
+
+// handlePage buffers the versions and delete markers of a page in listing
+// order. Both lists are sorted by key and newest first, but returned
+// separately. The order within each list is kept as modification times may be
+// identical.
+func (h *listHandler) handlePage(page *s3.ListObjectVersionsOutput) {
+	versions := page.Versions
+	markers := page.DeleteMarkers
+
+	for len(versions) > 0 || len(markers) > 0 {
+		if len(markers) == 0 || (len(versions) > 0 && versionListedFirst(versions[0], markers[0])) {
+			h.handleVersion(versions[0])
+			versions = versions[1:]
+		} else {
+			h.handleDeleteMarker(markers[0])
+			markers = markers[1:]
+		}
+	}
+}
+
+// listedVersionID returns the ID of a listed version. Some services omit the
+// ID of versions written before versioning was enabled. Deleting them without
+// ID would add a delete marker instead.
+func listedVersionID(id *string) string {
+	if v := aws.ToString(id); v != "" {
+		return v
+	}
+
+	return nullVersionID
+}
+
+func (h *listHandler) handleVersion(ov types.ObjectVersion) {
+	if h.skip(ov.Key) {
+		return
+	}
+
+	h.add(objectVersion{
+		key:          h.internString(ov.Key),
+		versionID:    listedVersionID(ov.VersionId),
+		lastModified: aws.ToTime(ov.LastModified),
+		isLatest:     aws.ToBool(ov.IsLatest),
+		size:         aws.ToInt64(ov.Size),
+	})
+}
+
+func (h *listHandler) handleDeleteMarker(marker types.DeleteMarkerEntry) {
+	if h.skip(marker.Key) {
+		return
+	}
+
+	h.add(objectVersion{
+		key:          h.internString(marker.Key),
+		versionID:    listedVersionID(marker.VersionId),
+		lastModified: aws.ToTime(marker.LastModified),
+		isLatest:     aws.ToBool(marker.IsLatest),
+		deleteMarker: true,
+	})
+}
+
+// handleObject forwards an object listed in a bucket without versioning. Such
+// objects are always the latest version.
+func (h *listHandler) handleObject(obj types.Object) {
+	if h.skip(obj.Key) {
+		return
+	}
+
+	h.addListed(1)
+
+	h.out <- objectVersion{
+		key:          h.internString(obj.Key),
+		lastModified: aws.ToTime(obj.LastModified),
+		isLatest:     true,
+		size:         aws.ToInt64(obj.Size),
+	}
+}
+
+// pageRetry retries listing requests which failed with a transient error
+// after the SDK exhausted its own attempts. Paginators only advance after a
+// successful request, so a retry fetches the same page again and the listing
+// continues where it left off.
+type pageRetry struct {
+	logger *slog.Logger
+	stats  *Stats
+
+	// Number of additional attempts. Disabled if zero.
+	retries int
+
+	minDelay time.Duration
+	maxDelay time.Duration
+}
+
+func newPageRetry(logger *slog.Logger, stats *Stats, retries int) *pageRetry {
+	return &pageRetry{
+		logger:   logger,
+		stats:    stats,
+		retries:  retries,
+		minDelay: time.Second,
+		maxDelay: 30 * time.Second,
+	}
+}
+
+func isTransientListError(err error) bool {
+	return retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err).Bool() ||
+		retry.IsErrorTimeouts(retry.DefaultTimeouts).IsErrorTimeout(err).Bool()
+}
+
+// do invokes fn until it succeeds, fails with a permanent error or the
+// retries are exhausted.
+func (r *pageRetry) do(ctx context.Context, fn func() error) error {
+	if r == nil {
+		return fn()
+	}
+
+	delay := r.minDelay
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+
+		if err != nil && ctx.Err() == nil && r.stats != nil {
+			r.stats.addError(err)
+		}
+
+		if err == nil || attempt > r.retries || ctx.Err() != nil || !isTransientListError(err) {
+			return err
+		}
+
+		r.logger.WarnContext(ctx, "Retrying failed listing request",
+			slog.Int("attempt", attempt),
+			slog.Duration("delay", delay),
+			slog.Any("error", err))
+
+		if r.stats != nil {
+			r.stats.addListPageRetry()
+		}
+
+		t := time.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+
+		delay = min(r.maxDelay, 2*delay)
+	}
+}
+
+// listMarker is a position within a listing of object versions.
+type listMarker struct {
+	keyMarker       string
+	versionIDMarker string
+}
+
+func (m listMarker) isZero() bool {
+	return m.keyMarker == "" && m.versionIDMarker == ""
+}
+
+type listObjectVersionsOptions struct {
+	client s3.ListObjectVersionsAPIClient
+	bucket string
+	prefix string
+
+	// Maximum number of entries per page. Uses the server default if zero.
+	pageSize int32
+
+	// Restrict listing to keys matching the manifest.
+	onlyKeys *KeyManifest
+
+	// Restrict listing to keys in the shard.
+	shard KeyShard
+
+	// Counts listed versions if set.
+	stats *Stats
+
+	// Retries failed listing requests if set.
+	retry *pageRetry
+
+	// More than one entry of a key may be flagged as the latest.
+	duplicateLatest bool
+
+	// Position at which to start listing.
+	start listMarker
+
+	// Listing ends early when stop returns true. Checked before every page
+	// once there's a position to resume from. A zero position would signal
+	// a complete listing.
+	stop func() bool
+
+	// Tracks the processing of the listed keys to record a position from
+	// which an interrupted run can resume.
+	watermark *listWatermark
+}
+
+// listObjectVersions lists all object versions. The position at which the
+// listing was stopped early is returned; it's zero if the listing completed.
+func listObjectVersions(ctx context.Context, opts listObjectVersionsOptions, out chan<- objectVersion) (listMarker, error) {
+	input := &s3.ListObjectVersionsInput{
+		Bucket: aws.String(opts.bucket),
+		Prefix: aws.String(opts.prefix),
+	}
+
+	if opts.pageSize > 0 {
+		input.MaxKeys = aws.Int32(opts.pageSize)
+	}
+
+	if !opts.start.isZero() {
+		input.KeyMarker = aws.String(opts.start.keyMarker)
+
+		if opts.start.versionIDMarker != "" {
+			input.VersionIdMarker = aws.String(opts.start.versionIDMarker)
+		}
+	}
+
+	paginator := s3.NewListObjectVersionsPaginator(opts.client, input)
+
+	ch := make(chan *s3.ListObjectVersionsOutput, 1)
+
+	var resume listMarker
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		defer close(ch)
+
+		next := opts.start
+
+		for paginator.HasMorePages() {
+			if opts.stop != nil && !next.isZero() && opts.stop() {
+				resume = next
+				return nil
+			}
+
+			var page *s3.ListObjectVersionsOutput
+
+			if err := opts.retry.do(ctx, func() (err error) {
+				page, err = paginator.NextPage(ctx)
+				return err
+			}); err != nil {
+				return err
+			}
+
+			next = listMarker{
+				keyMarker:       aws.ToString(page.NextKeyMarker),
+				versionIDMarker: aws.ToString(page.NextVersionIdMarker),
+			}
+
+			ch <- page
+		}
+
+		return nil
+	})
+	g.Go(func() error {
+		handler := newListHandler(out)
+		handler.onlyKeys = opts.onlyKeys
+		handler.shard = opts.shard
+		handler.stats = opts.stats
+		handler.duplicateLatest = opts.duplicateLatest
+		handler.watermark = opts.watermark
+
+		defer handler.flush()
+
+		for page := range ch {
+			handler.handlePage(page)
+		}
+
+		return nil
+	})
+
+	if err := g.Wait(); err != nil {
+		return listMarker{}, err
+	}
+
+	return resume, nil
+}
+
+type listObjectsOptions struct {
+	client s3.ListObjectsV2APIClient
+	bucket string
+	prefix string
+
+	// Maximum number of entries per page. Uses the server default if zero.
+	pageSize int32
+
+	// Restrict listing to keys matching the manifest.
+	onlyKeys *KeyManifest
+
+	// Restrict listing to keys in the shard.
+	shard KeyShard
+
+	// Counts listed versions if set.
+	stats *Stats
+
+	// Retries failed listing requests if set.
+	retry *pageRetry
+
+	// Listing ends early when stop returns true. Checked before every page.
+	stop func() bool
+}
+
+// listObjects lists the objects of a bucket without versioning.
+func listObjects(ctx context.Context, opts listObjectsOptions, out chan<- objectVersion) error {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(opts.bucket),
+		Prefix: aws.String(opts.prefix),
+	}
+
+	if opts.pageSize > 0 {
+		input.MaxKeys = aws.Int32(opts.pageSize)
+	}
+
+	paginator := s3.NewListObjectsV2Paginator(opts.client, input)
+
+	handler := newListHandler(out)
+	handler.onlyKeys = opts.onlyKeys
+	handler.shard = opts.shard
+	handler.stats = opts.stats
+
+	for paginator.HasMorePages() {
+		if opts.stop != nil && opts.stop() {
+			break
+		}
+
+		var page *s3.ListObjectsV2Output
+
+		if err := opts.retry.do(ctx, func() (err error) {
+			page, err = paginator.NextPage(ctx)
+			return err
+		}); err != nil {
+			return err
+		}
+
+		for _, i := range page.Contents {
+			handler.handleObject(i)
+		}
+	}
+
+	return nil
+}
+
+type listKeysOptions struct {
+	client interface {
+		s3.ListObjectVersionsAPIClient
+		s3.ListObjectsV2APIClient
+	}
+	bucket string
+	prefix string
+
+	// Sorted keys to list. Keys outside the prefix are ignored.
+	keys []string
+
+	// List current objects of a bucket without versioning.
+	unversioned bool
+
+	// Restrict listing to keys matching the manifest.
+	onlyKeys *KeyManifest
+
+	// Restrict listing to keys in the shard.
+	shard KeyShard
+
+	// Counts listed versions if set.
+	stats *Stats
+
+	// Retries failed listing requests if set.
+	retry *pageRetry
+
+	// More than one entry of a key may be flagged as the latest.
+	duplicateLatest bool
+}
+
+// listKeys lists the versions of individual keys. S3 can't filter by exact
+// key, so each key is used as a prefix. A key sorts before all longer keys
+// sharing it as a prefix, so listing a key stops at the first other key.
+func listKeys(ctx context.Context, opts listKeysOptions, out chan<- objectVersion) error {
+	handler := newListHandler(out)
+	handler.onlyKeys = opts.onlyKeys
+	handler.shard = opts.shard
+	handler.stats = opts.stats
+	handler.duplicateLatest = opts.duplicateLatest
+
+	defer handler.flush()
+
+	for _, key := range opts.keys {
+		if !strings.HasPrefix(key, opts.prefix) || handler.skip(&key) {
+			continue
+		}
+
+		if opts.unversioned {
+			var page *s3.ListObjectsV2Output
+
+			if err := opts.retry.do(ctx, func() (err error) {
+				page, err = opts.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+					Bucket:  aws.String(opts.bucket),
+					Prefix:  aws.String(key),
+					MaxKeys: aws.Int32(1),
+				})
+				return err
+			}); err != nil {
+				return err
+			}
+
+			for _, obj := range page.Contents {
+				if aws.ToString(obj.Key) == key {
+					handler.handleObject(obj)
+				}
+			}
+
+			continue
+		}
+
+		paginator := s3.NewListObjectVersionsPaginator(opts.client, &s3.ListObjectVersionsInput{
+			Bucket: aws.String(opts.bucket),
+			Prefix: aws.String(key),
+		})
+
+		for done := false; !done && paginator.HasMorePages(); {
+			var page *s3.ListObjectVersionsOutput
+
+			if err := opts.retry.do(ctx, func() (err error) {
+				page, err = paginator.NextPage(ctx)
+				return err
+			}); err != nil {
+				return err
+			}
+
+			for _, v := range page.Versions {
+				if aws.ToString(v.Key) == key {
+					handler.handleVersion(v)
+				} else {
+					done = true
+				}
+			}
+
+			for _, m := range page.DeleteMarkers {
+				if aws.ToString(m.Key) == key {
+					handler.handleDeleteMarker(m)
+				} else {
+					done = true
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,850 @@
+package cleanup
+
+import (
+	stdcmp "cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/hansmi/s3-object-cleanup/internal/fakes3"
+)
+
+func sortObjectVersions(versions []objectVersion) {
+	slices.SortFunc(versions, func(a, b objectVersion) int {
+		return stdcmp.Or(
+			strings.Compare(a.key, b.key),
+			strings.Compare(a.versionID, b.versionID),
+		)
+	})
+}
+
+func formatMiB(b int64) string {
+	return fmt.Sprintf("%.1f MiB", float64(b)/1024/1024)
+}
+
+func TestListHandler(t *testing.T) {
+	ch := make(chan objectVersion)
+
+	var wg sync.WaitGroup
+	var got []objectVersion
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for i := range ch {
+			got = append(got, i)
+		}
+	}()
+
+	h := newListHandler(ch)
+	h.handleVersion(types.ObjectVersion{
+		Key:       aws.String("k1"),
+		VersionId: aws.String("v2"),
+	})
+	h.handleDeleteMarker(types.DeleteMarkerEntry{
+		Key:       aws.String("k1"),
+		VersionId: aws.String("del"),
+	})
+	h.handleVersion(types.ObjectVersion{
+		Key:       aws.String("k2"),
+		VersionId: aws.String("v2"),
+	})
+	h.handleVersion(types.ObjectVersion{
+		Key:       aws.String("k2"),
+		VersionId: aws.String("v1"),
+	})
+	h.flush()
+
+	close(ch)
+
+	wg.Wait()
+
+	sortObjectVersions(got)
+
+	want := []objectVersion{
+		{key: "k1", versionID: "del", deleteMarker: true, keyVersionCount: 2, listOrder: 1},
+		{key: "k1", versionID: "v2", keyVersionCount: 2},
+		{key: "k2", versionID: "v1", keyVersionCount: 2, listOrder: 1},
+		{key: "k2", versionID: "v2", keyVersionCount: 2},
+	}
+
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(objectVersion{})); diff != "" {
+		t.Errorf("ListHandler diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestListHandlerOnlyKeys(t *testing.T) {
+	ch := make(chan objectVersion, 8)
+
+	h := newListHandler(ch)
+	h.onlyKeys = NewKeyManifest()
+	h.onlyKeys.add("k1")
+	h.onlyKeys.add("dir/*")
+
+	for _, key := range []string{"k1", "k2", "dir/a", "dir"} {
+		h.handleVersion(types.ObjectVersion{Key: aws.String(key)})
+		h.handleDeleteMarker(types.DeleteMarkerEntry{Key: aws.String(key)})
+	}
+
+	h.flush()
+
+	close(ch)
+
+	var got []string
+
+	for i := range ch {
+		got = append(got, i.key)
+	}
+
+	want := []string{"k1", "k1", "dir/a", "dir/a"}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Forwarded keys diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestListHandlerPage(t *testing.T) {
+	ch := make(chan objectVersion, 16)
+
+	h := newListHandler(ch)
+	h.handlePage(&s3.ListObjectVersionsOutput{
+		Versions: []types.ObjectVersion{
+			{Key: aws.String("a"), VersionId: aws.String("a1")},
+			{Key: aws.String("c"), VersionId: aws.String("c1")},
+			{Key: aws.String("c"), VersionId: aws.String("c2")},
+		},
+		DeleteMarkers: []types.DeleteMarkerEntry{
+			{Key: aws.String("b"), VersionId: aws.String("b1")},
+			{Key: aws.String("c"), VersionId: aws.String("c3")},
+		},
+	})
+
+	// Versions of the last key are held back as it may continue on the
+	// next page.
+	if got := len(ch); got != 2 {
+		t.Errorf("Forwarded %d versions, want 2", got)
+	}
+
+	h.handlePage(&s3.ListObjectVersionsOutput{
+		Versions: []types.ObjectVersion{
+			{Key: aws.String("c"), VersionId: aws.String("c4")},
+			{Key: aws.String("d"), VersionId: aws.String("d1")},
+		},
+	})
+	h.flush()
+
+	close(ch)
+
+	var got []string
+
+	for i := range ch {
+		got = append(got, fmt.Sprintf("%s/%d", i.versionID, i.keyVersionCount))
+	}
+
+	want := []string{"a1/1", "b1/1", "c1/4", "c2/4", "c3/4", "c4/4", "d1/1"}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Forwarded versions diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestListHandlerIdenticalTimes(t *testing.T) {
+	lastModified := aws.Time(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	ch := make(chan objectVersion, 8)
+
+	h := newListHandler(ch)
+	h.handlePage(&s3.ListObjectVersionsOutput{
+		Versions: []types.ObjectVersion{
+			{Key: aws.String("a"), VersionId: aws.String("z"), LastModified: lastModified},
+			{Key: aws.String("a"), VersionId: aws.String("m"), LastModified: lastModified},
+			{Key: aws.String("b"), VersionId: aws.String("b2"), LastModified: lastModified, IsLatest: aws.Bool(true)},
+		},
+		DeleteMarkers: []types.DeleteMarkerEntry{
+			{Key: aws.String("a"), VersionId: aws.String("del"), LastModified: lastModified, IsLatest: aws.Bool(true)},
+			{Key: aws.String("b"), VersionId: aws.String("b1"), LastModified: lastModified},
+		},
+	})
+	h.flush()
+
+	close(ch)
+
+	var got []string
+
+	for i := range ch {
+		got = append(got, fmt.Sprintf("%s/%d", i.versionID, i.listOrder))
+	}
+
+	want := []string{"del/0", "z/1", "m/2", "b2/0", "b1/1"}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Forwarded versions diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestListHandlerDuplicateLatest(t *testing.T) {
+	base := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, duplicateLatest := range []bool{false, true} {
+		t.Run(fmt.Sprint(duplicateLatest), func(t *testing.T) {
+			ch := make(chan objectVersion, 8)
+
+			h := newListHandler(ch)
+			h.duplicateLatest = duplicateLatest
+			h.handlePage(&s3.ListObjectVersionsOutput{
+				Versions: []types.ObjectVersion{
+					{Key: aws.String("a"), VersionId: aws.String("a2"), LastModified: aws.Time(base.Add(time.Hour)), IsLatest: aws.Bool(true)},
+					{Key: aws.String("a"), VersionId: aws.String("a1"), LastModified: aws.Time(base), IsLatest: aws.Bool(true)},
+					{Key: aws.String("b"), VersionId: aws.String("b1"), LastModified: aws.Time(base), IsLatest: aws.Bool(true)},
+				},
+				DeleteMarkers: []types.DeleteMarkerEntry{
+					{Key: aws.String("a"), VersionId: aws.String("a3"), LastModified: aws.Time(base.Add(2 * time.Hour)), IsLatest: aws.Bool(true)},
+					{Key: aws.String("c"), VersionId: aws.String("c1"), LastModified: aws.Time(base)},
+				},
+			})
+			h.flush()
+
+			close(ch)
+
+			var got []string
+
+			for i := range ch {
+				if i.isLatest {
+					got = append(got, i.versionID)
+				}
+			}
+
+			want := []string{"a3", "a2", "a1", "b1"}
+
+			if duplicateLatest {
+				want = []string{"a3", "b1"}
+			}
+
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("Latest versions diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestListHandlerNullVersion(t *testing.T) {
+	ch := make(chan objectVersion, 8)
+
+	h := newListHandler(ch)
+	h.handlePage(&s3.ListObjectVersionsOutput{
+		Versions: []types.ObjectVersion{
+			{Key: aws.String("a"), VersionId: aws.String("v1")},
+			{Key: aws.String("a"), VersionId: aws.String("null")},
+			{Key: aws.String("b")},
+		},
+		DeleteMarkers: []types.DeleteMarkerEntry{
+			{Key: aws.String("c"), VersionId: aws.String("")},
+		},
+	})
+	h.flush()
+
+	close(ch)
+
+	var got []string
+
+	for i := range ch {
+		got = append(got, i.key+"/"+i.versionID+"/"+aws.ToString(i.identifier().VersionId))
+	}
+
+	want := []string{"a/v1/v1", "a/null/null", "b/null/null", "c/null/null"}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Forwarded versions diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestListHandlerInternString(t *testing.T) {
+	var before, after runtime.MemStats
+
+	const distinctValues = 1000
+	const repetitions = 100
+
+	stringSize := int64(reflect.TypeOf("").Size())
+	got := make([]string, distinctValues*repetitions)
+	h := newListHandler(nil)
+
+	var heapOriginal int64
+	var heapEstimate int64
+
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	{
+		want := make([]string, distinctValues*repetitions)
+
+		// Generate unique strings.
+		for idx := range distinctValues {
+			value := strings.Repeat(strconv.Itoa(idx), 100)
+			heapEstimate += stringSize + int64(len(value))
+
+			want[idx] = value
+		}
+
+		// Intern strings.
+		for idx := range len(want) {
+			value := want[idx%distinctValues]
+			heapOriginal += stringSize + int64(len(value))
+
+			want[idx] = value
+
+			// Values must have a unique memory location.
+			value = strings.Clone(value)
+
+			got[idx] = h.internString(&value)
+		}
+
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("Result diff (-want +got):\n%s", diff)
+		}
+	}
+
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+
+	runtime.KeepAlive(h)
+	runtime.KeepAlive(got)
+
+	heapDiff := int64(after.HeapAlloc) - int64(before.HeapAlloc)
+
+	t.Logf("Heap before: %s, after: %s, diff: %s, estimate for actual: %s, original strings: %s",
+		formatMiB(int64(before.HeapAlloc)),
+		formatMiB(int64(after.HeapAlloc)),
+		formatMiB(heapDiff),
+		formatMiB(heapEstimate),
+		formatMiB(heapOriginal))
+
+	if wantMax := max(5*heapEstimate, heapOriginal/4); heapDiff > 0 && heapDiff > wantMax {
+		t.Errorf("Heap increase of %s is more than the upper estimated bound of %s",
+			formatMiB(heapDiff),
+			formatMiB(wantMax))
+	}
+}
+
+type fakeListObjectVersionsAPIClient struct {
+	offset  int
+	results []*s3.ListObjectVersionsOutput
+	inputs  []*s3.ListObjectVersionsInput
+}
+
+func (c *fakeListObjectVersionsAPIClient) ListObjectVersions(_ context.Context, input *s3.ListObjectVersionsInput, _ ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+	var result *s3.ListObjectVersionsOutput
+
+	c.inputs = append(c.inputs, input)
+
+	if c.offset < len(c.results) {
+		result = c.results[c.offset]
+		c.offset++
+	}
+
+	if result == nil {
+		result = &s3.ListObjectVersionsOutput{
+			IsTruncated: aws.Bool(false),
+		}
+	}
+
+	return result, nil
+}
+
+func TestListObjectVersions(t *testing.T) {
+	ctx := context.Background()
+
+	var c fakeListObjectVersionsAPIClient
+
+	var want []objectVersion
+
+	for pageIdx := range 10 {
+		page := &s3.ListObjectVersionsOutput{
+			IsTruncated:   aws.Bool(true),
+			KeyMarker:     aws.String(fmt.Sprint(pageIdx)),
+			NextKeyMarker: aws.String(fmt.Sprint(pageIdx + 1)),
+		}
+
+		for i := range 100 {
+			key := fmt.Sprintf("key%d", i)
+			version := fmt.Sprintf("v%d", pageIdx+i)
+
+			if i%17 == 0 {
+				page.DeleteMarkers = append(page.DeleteMarkers, types.DeleteMarkerEntry{
+					Key:       aws.String(key),
+					VersionId: aws.String(version),
+				})
+				want = append(want, objectVersion{
+					key:          key,
+					versionID:    version,
+					deleteMarker: true,
+				})
+			} else {
+				page.Versions = append(page.Versions, types.ObjectVersion{
+					Key:       aws.String(key),
+					VersionId: aws.String(version),
+				})
+				want = append(want, objectVersion{
+					key:       key,
+					versionID: version,
+				})
+			}
+		}
+
+		c.results = append(c.results, page)
+	}
+
+	ch := make(chan objectVersion)
+
+	var wg sync.WaitGroup
+	var got []objectVersion
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for i := range ch {
+			got = append(got, i)
+		}
+	}()
+
+	if resume, err := listObjectVersions(ctx, listObjectVersionsOptions{
+		client: &c,
+		bucket: "bucket",
+		prefix: "prefix",
+	}, ch); err != nil {
+		t.Errorf("listObjectversions() failed: %v", err)
+	} else if !resume.isZero() {
+		t.Errorf("listObjectVersions() returned marker %+v for complete listing", resume)
+	}
+
+	close(ch)
+
+	wg.Wait()
+
+	sortObjectVersions(want)
+	sortObjectVersions(got)
+
+	// Keys are repeated across pages, so their version counts are
+	// meaningless.
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(objectVersion{}), cmpopts.IgnoreFields(objectVersion{}, "keyVersionCount")); diff != "" {
+		t.Errorf("ListHandler diff (-want +got):\n%s", diff)
+	}
+}
+
+type fakeListObjectsV2APIClient struct {
+	offset  int
+	results []*s3.ListObjectsV2Output
+}
+
+func (c *fakeListObjectsV2APIClient) ListObjectsV2(_ context.Context, _ *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	var result *s3.ListObjectsV2Output
+
+	if c.offset < len(c.results) {
+		result = c.results[c.offset]
+		c.offset++
+	}
+
+	if result == nil {
+		result = &s3.ListObjectsV2Output{
+			IsTruncated: aws.Bool(false),
+		}
+	}
+
+	return result, nil
+}
+
+func TestListObjects(t *testing.T) {
+	var c fakeListObjectsV2APIClient
+
+	var want []objectVersion
+
+	for pageIdx := range 3 {
+		page := &s3.ListObjectsV2Output{
+			IsTruncated:           aws.Bool(true),
+			NextContinuationToken: aws.String(fmt.Sprint(pageIdx + 1)),
+		}
+
+		for i := range 10 {
+			key := fmt.Sprintf("key%d-%d", pageIdx, i)
+
+			page.Contents = append(page.Contents, types.Object{
+				Key:  aws.String(key),
+				Size: aws.Int64(int64(i)),
+			})
+			want = append(want, objectVersion{
+				key:      key,
+				size:     int64(i),
+				isLatest: true,
+			})
+		}
+
+		c.results = append(c.results, page)
+	}
+
+	ch := make(chan objectVersion, len(want))
+
+	if err := listObjects(t.Context(), listObjectsOptions{
+		client: &c,
+		bucket: "bucket",
+	}, ch); err != nil {
+		t.Errorf("listObjects() failed: %v", err)
+	}
+
+	close(ch)
+
+	var got []objectVersion
+
+	for i := range ch {
+		got = append(got, i)
+	}
+
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(objectVersion{})); diff != "" {
+		t.Errorf("listObjects() diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestListObjectVersionsStop(t *testing.T) {
+	var c fakeListObjectVersionsAPIClient
+
+	for pageIdx := range 5 {
+		c.results = append(c.results, &s3.ListObjectVersionsOutput{
+			IsTruncated:         aws.Bool(true),
+			NextKeyMarker:       aws.String(fmt.Sprintf("key%d", pageIdx)),
+			NextVersionIdMarker: aws.String(fmt.Sprintf("v%d", pageIdx)),
+			Versions: []types.ObjectVersion{
+				{
+					Key:       aws.String(fmt.Sprintf("key%d", pageIdx)),
+					VersionId: aws.String(fmt.Sprintf("v%d", pageIdx)),
+				},
+			},
+		})
+	}
+
+	ch := make(chan objectVersion, 8)
+
+	pages := 0
+
+	var checkpoints []listMarker
+
+	watermark := newListWatermark(func(m listMarker) {
+		checkpoints = append(checkpoints, m)
+	})
+
+	resume, err := listObjectVersions(t.Context(), listObjectVersionsOptions{
+		client: &c,
+		bucket: "bucket",
+		start: listMarker{
+			keyMarker:       "start",
+			versionIDMarker: "vstart",
+		},
+		stop: func() bool {
+			pages++
+			return pages > 2
+		},
+		watermark: watermark,
+	}, ch)
+	if err != nil {
+		t.Errorf("listObjectVersions() failed: %v", err)
+	}
+
+	close(ch)
+
+	var got []string
+
+	for i := range ch {
+		got = append(got, i.key)
+	}
+
+	if diff := cmp.Diff([]string{"key0", "key1"}, got); diff != "" {
+		t.Errorf("Listed keys diff (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(listMarker{keyMarker: "key1", versionIDMarker: "v1"}, resume, cmp.AllowUnexported(listMarker{})); diff != "" {
+		t.Errorf("Resume marker diff (-want +got):\n%s", diff)
+	}
+
+	if len(checkpoints) != 0 {
+		t.Errorf("Checkpoints %+v recorded before processing", checkpoints)
+	}
+
+	// Keys are only passed once they have been processed.
+	watermark.done("key0", 1)
+
+	if diff := cmp.Diff([]listMarker{
+		{keyMarker: "key0"},
+	}, checkpoints, cmp.AllowUnexported(listMarker{})); diff != "" {
+		t.Errorf("Checkpoints diff (-want +got):\n%s", diff)
+	}
+
+	if len(c.inputs) == 0 {
+		t.Fatalf("No requests made")
+	}
+
+	if got := c.inputs[0]; aws.ToString(got.KeyMarker) != "start" || aws.ToString(got.VersionIdMarker) != "vstart" {
+		t.Errorf("First request started at %q/%q, want start/vstart",
+			aws.ToString(got.KeyMarker), aws.ToString(got.VersionIdMarker))
+	}
+}
+
+func TestListObjectVersionsStopBeforeFirstPage(t *testing.T) {
+	var c fakeListObjectVersionsAPIClient
+
+	for pageIdx := range 3 {
+		c.results = append(c.results, &s3.ListObjectVersionsOutput{
+			IsTruncated:         aws.Bool(true),
+			NextKeyMarker:       aws.String(fmt.Sprintf("key%d", pageIdx)),
+			NextVersionIdMarker: aws.String(fmt.Sprintf("v%d", pageIdx)),
+			Versions: []types.ObjectVersion{
+				{
+					Key:       aws.String(fmt.Sprintf("key%d", pageIdx)),
+					VersionId: aws.String(fmt.Sprintf("v%d", pageIdx)),
+				},
+			},
+		})
+	}
+
+	ch := make(chan objectVersion, 8)
+
+	// Stopping without any page listed would return a zero marker, which
+	// signals a complete listing.
+	resume, err := listObjectVersions(t.Context(), listObjectVersionsOptions{
+		client: &c,
+		bucket: "bucket",
+		stop: func() bool {
+			return true
+		},
+	}, ch)
+	if err != nil {
+		t.Errorf("listObjectVersions() failed: %v", err)
+	}
+
+	close(ch)
+
+	if diff := cmp.Diff(listMarker{keyMarker: "key0", versionIDMarker: "v0"}, resume, cmp.AllowUnexported(listMarker{})); diff != "" {
+		t.Errorf("Resume marker diff (-want +got):\n%s", diff)
+	}
+
+	if got := len(c.inputs); got != 1 {
+		t.Errorf("Made %d requests, want 1", got)
+	}
+}
+
+func TestListObjectVersionsPageSize(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		pageSize int32
+		want     *int32
+	}{
+		{name: "default"},
+		{
+			name:     "custom",
+			pageSize: 250,
+			want:     aws.Int32(250),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var c fakeListObjectVersionsAPIClient
+
+			if _, err := listObjectVersions(t.Context(), listObjectVersionsOptions{
+				client:   &c,
+				bucket:   "bucket",
+				pageSize: tc.pageSize,
+			}, make(chan objectVersion)); err != nil {
+				t.Errorf("listObjectVersions() failed: %v", err)
+			}
+
+			if len(c.inputs) != 1 {
+				t.Fatalf("Made %d requests, want 1", len(c.inputs))
+			}
+
+			if diff := cmp.Diff(tc.want, c.inputs[0].MaxKeys); diff != "" {
+				t.Errorf("MaxKeys diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+type flakyListObjectVersionsAPIClient struct {
+	fakeListObjectVersionsAPIClient
+
+	// Returned by the first requests.
+	errs []error
+}
+
+func (c *flakyListObjectVersionsAPIClient) ListObjectVersions(ctx context.Context, input *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+	if len(c.errs) > 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+
+		return nil, err
+	}
+
+	return c.fakeListObjectVersionsAPIClient.ListObjectVersions(ctx, input, optFns...)
+}
+
+func TestListObjectVersionsRetry(t *testing.T) {
+	errTransient := &retry.MaxAttemptsError{
+		Attempt: 3,
+		Err: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{
+				Response: &http.Response{StatusCode: http.StatusInternalServerError},
+			},
+			Err: errors.New("internal error"),
+		},
+	}
+	errPermanent := errors.New("access denied")
+
+	for _, tc := range []struct {
+		name        string
+		errs        []error
+		retries     int
+		wantErr     error
+		wantRetries int64
+		wantCount   int
+	}{
+		{
+			name:      "success",
+			retries:   2,
+			wantCount: 3,
+		},
+		{
+			name:        "transient",
+			errs:        []error{errTransient, errTransient},
+			retries:     2,
+			wantRetries: 2,
+			wantCount:   3,
+		},
+		{
+			name:        "exhausted",
+			errs:        []error{errTransient, errTransient},
+			retries:     1,
+			wantErr:     errTransient,
+			wantRetries: 1,
+		},
+		{
+			name:    "permanent",
+			errs:    []error{errPermanent},
+			retries: 2,
+			wantErr: errPermanent,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := flakyListObjectVersionsAPIClient{errs: tc.errs}
+
+			for i := range 3 {
+				c.results = append(c.results, &s3.ListObjectVersionsOutput{
+					IsTruncated:   aws.Bool(i < 2),
+					NextKeyMarker: aws.String(fmt.Sprint(i)),
+					Versions: []types.ObjectVersion{{
+						Key:       aws.String(fmt.Sprint(i)),
+						VersionId: aws.String("v"),
+					}},
+				})
+			}
+
+			stats := NewStats()
+
+			r := newPageRetry(slog.Default(), stats, tc.retries)
+			r.minDelay = time.Millisecond
+
+			ch := make(chan objectVersion, len(c.results))
+
+			_, err := listObjectVersions(t.Context(), listObjectVersionsOptions{
+				client: &c,
+				bucket: "bucket",
+				retry:  r,
+			}, ch)
+
+			if diff := cmp.Diff(tc.wantErr, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("Error diff (-want +got):\n%s", diff)
+			}
+
+			close(ch)
+
+			if got := len(ch); err == nil && got != tc.wantCount {
+				t.Errorf("Listed %d versions, want %d", got, tc.wantCount)
+			}
+
+			if got := stats.listedPageRetryCount; got != tc.wantRetries {
+				t.Errorf("Page retry count is %d, want %d", got, tc.wantRetries)
+			}
+		})
+	}
+}
+
+func TestListKeys(t *testing.T) {
+	fake := fakes3.New(fakes3.Options{Bucket: "bucket"})
+
+	for _, key := range []string{"a", "a/b", "ab", "b", "c"} {
+		for i := range 3 {
+			fake.Add(fakes3.Version{
+				Key:          key,
+				VersionID:    fmt.Sprintf("%s@%d", key, i),
+				LastModified: time.Date(2024, time.January, 1+i, 0, 0, 0, 0, time.UTC),
+				DeleteMarker: key == "b" && i == 2,
+			})
+		}
+	}
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials:  aws.AnonymousCredentials{},
+	})
+
+	ch := make(chan objectVersion, 32)
+
+	if err := listKeys(t.Context(), listKeysOptions{
+		client: client,
+		bucket: "bucket",
+		keys:   []string{"a", "b", "missing"},
+	}, ch); err != nil {
+		t.Fatalf("listKeys() failed: %v", err)
+	}
+
+	close(ch)
+
+	var got []string
+
+	for ov := range ch {
+		got = append(got, fmt.Sprintf("%s/%d latest=%t", ov.versionID, ov.keyVersionCount, ov.isLatest))
+	}
+
+	slices.Sort(got)
+
+	want := []string{
+		"a@0/3 latest=false",
+		"a@1/3 latest=false",
+		"a@2/3 latest=true",
+		"b@0/3 latest=false",
+		"b@1/3 latest=false",
+		"b@2/3 latest=true",
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Listed versions diff (-want +got):\n%s", diff)
+	}
+}
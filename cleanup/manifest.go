@@ -0,0 +1,163 @@
+package cleanup
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/hansmi/s3-object-cleanup/internal/client"
+	"github.com/hansmi/s3-object-cleanup/internal/state"
+	"github.com/klauspost/compress/gzip"
+)
+
+// KeyManifest is a set of object keys and key prefixes. Entries ending in an
+// asterisk ("*") match all keys beginning with the preceding text, all other
+// entries must match a key exactly.
+type KeyManifest struct {
+	keys     map[string]struct{}
+	prefixes []string
+
+	// Entries matched against the trailing path components of keys, e.g.
+	// "index/*" matches "repo/index/abc". Nil if there are none.
+	nested *KeyManifest
+}
+
+func NewKeyManifest() *KeyManifest {
+	return &KeyManifest{
+		keys: map[string]struct{}{},
+	}
+}
+
+func (m *KeyManifest) add(entry string) {
+	if prefix, found := strings.CutSuffix(entry, "*"); found {
+		m.prefixes = append(m.prefixes, prefix)
+	} else {
+		m.keys[entry] = struct{}{}
+	}
+}
+
+func (m *KeyManifest) match(key string) bool {
+	if _, ok := m.keys[key]; ok {
+		return true
+	}
+
+	if slices.ContainsFunc(m.prefixes, func(prefix string) bool {
+		return strings.HasPrefix(key, prefix)
+	}) {
+		return true
+	}
+
+	if m.nested != nil {
+		for rest, found := key, true; found; _, rest, found = strings.Cut(rest, "/") {
+			if m.nested.match(rest) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ParseKeyManifest reads one entry per line. Empty lines and lines starting
+// with "#" are ignored. Gzip-compressed input is detected automatically.
+func ParseKeyManifest(r io.Reader) (*KeyManifest, error) {
+	br := bufio.NewReader(r)
+
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("decompression: %w", err)
+		}
+
+		defer zr.Close()
+
+		r = zr
+	} else {
+		r = br
+	}
+
+	m := NewKeyManifest()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		m.add(line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// openKeyManifestObject downloads a key manifest from an S3 object given as
+// "s3://bucket/key".
+func openKeyManifestObject(ctx context.Context, cfg aws.Config, tmpdir string, u *url.URL) (*os.File, error) {
+	key := strings.TrimLeft(u.Path, "/")
+
+	if u.Host == "" || key == "" {
+		return nil, fmt.Errorf("%w: missing bucket or key: %s", os.ErrInvalid, u.Redacted())
+	}
+
+	c, err := client.NewFromName(cfg, u.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := state.CreateUnlinkedTemp(tmpdir, "manifest*")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.DownloadObject(ctx, f, key); err != nil {
+		return nil, errors.Join(fmt.Errorf("download: %w", err), f.Close())
+	}
+
+	if _, err := f.Seek(0, os.SEEK_SET); err != nil {
+		return nil, errors.Join(err, f.Close())
+	}
+
+	return f, nil
+}
+
+// LoadKeyManifest reads a key manifest from a local file or, if the location
+// is given as "s3://bucket/key", from an S3 object.
+func LoadKeyManifest(ctx context.Context, cfg aws.Config, tmpdir, location string) (_ *KeyManifest, err error) {
+	var f *os.File
+
+	if u, parseErr := url.Parse(location); parseErr == nil && u.Scheme == "s3" {
+		f, err = openKeyManifestObject(ctx, cfg, tmpdir, u)
+	} else {
+		f, err = os.Open(location)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("manifest %q: %w", location, err)
+	}
+
+	defer func() {
+		err = errors.Join(err, f.Close())
+	}()
+
+	m, err := ParseKeyManifest(f)
+	if err != nil {
+		return nil, fmt.Errorf("manifest %q: %w", location, err)
+	}
+
+	return m, nil
+}
@@ -0,0 +1,165 @@
+package cleanup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestKeyManifest(t *testing.T) {
+	const content = `# Comment
+exact
+dir/*
+
+with space
+`
+
+	for _, tc := range []struct {
+		name     string
+		compress bool
+	}{
+		{name: "plain"},
+		{name: "gzip", compress: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			if tc.compress {
+				zw := gzip.NewWriter(&buf)
+				io.WriteString(zw, content)
+
+				if err := zw.Close(); err != nil {
+					t.Fatalf("Close() failed: %v", err)
+				}
+			} else {
+				buf.WriteString(content)
+			}
+
+			m, err := ParseKeyManifest(&buf)
+			if err != nil {
+				t.Fatalf("parseKeyManifest() failed: %v", err)
+			}
+
+			got := map[string]bool{}
+
+			for _, key := range []string{
+				"",
+				"# Comment",
+				"exact",
+				"exact/",
+				"dir",
+				"dir/",
+				"dir/file",
+				"with space",
+			} {
+				got[key] = m.match(key)
+			}
+
+			want := map[string]bool{
+				"":           false,
+				"# Comment":  false,
+				"exact":      true,
+				"exact/":     false,
+				"dir":        false,
+				"dir/":       true,
+				"dir/file":   true,
+				"with space": true,
+			}
+
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("Match diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLoadKeyManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.txt")
+
+	if err := os.WriteFile(path, []byte("a\nb/*\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := LoadKeyManifest(context.Background(), aws.Config{}, t.TempDir(), path)
+	if err != nil {
+		t.Fatalf("loadKeyManifest() failed: %v", err)
+	}
+
+	if !m.match("a") || !m.match("b/c") || m.match("c") {
+		t.Errorf("loadKeyManifest() returned unexpected manifest: %+v", m)
+	}
+
+	if _, err := LoadKeyManifest(context.Background(), aws.Config{}, t.TempDir(), "s3://bucket-only"); err == nil || !strings.Contains(err.Error(), "missing bucket or key") {
+		t.Errorf("loadKeyManifest() with missing key returned %v", err)
+	}
+}
+
+func TestKeyManifestPreset(t *testing.T) {
+	m := NewKeyManifest()
+	m.add("exact")
+
+	if err := m.AddPreset("Restic"); err != nil {
+		t.Fatalf("AddPreset() failed: %v", err)
+	}
+
+	if err := m.AddPreset("pgbackrest"); err != nil {
+		t.Fatalf("AddPreset() failed: %v", err)
+	}
+
+	got := map[string]bool{}
+
+	for _, key := range []string{
+		"exact",
+		"config",
+		"repo/config",
+		"a/b/keys/0123",
+		"index/abcd",
+		"repo/data/ab/abcdef",
+		"repo/configuration",
+		"repo/snapshots",
+		"backup/db/backup.info",
+		"backup/db/20240101-000000F/backup.manifest.copy",
+		"archive/db/16-1/000000010000000000000001",
+	} {
+		got[key] = m.match(key)
+	}
+
+	want := map[string]bool{
+		"exact":                 true,
+		"config":                true,
+		"repo/config":           true,
+		"a/b/keys/0123":         true,
+		"index/abcd":            true,
+		"repo/data/ab/abcdef":   false,
+		"repo/configuration":    false,
+		"repo/snapshots":        false,
+		"backup/db/backup.info": true,
+		"backup/db/20240101-000000F/backup.manifest.copy": true,
+		"archive/db/16-1/000000010000000000000001":        false,
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Match diff (-want +got):\n%s", diff)
+	}
+
+	if err := m.AddPreset("unknown"); !errors.Is(err, os.ErrInvalid) {
+		t.Errorf("AddPreset() for unknown preset returned %v, want %v", err, os.ErrInvalid)
+	}
+}
+
+func TestPresetNames(t *testing.T) {
+	for _, name := range PresetNames() {
+		if err := NewKeyManifest().AddPreset(name); err != nil {
+			t.Errorf("AddPreset(%q) failed: %v", name, err)
+		}
+	}
+}
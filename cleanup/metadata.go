@@ -0,0 +1,54 @@
+package cleanup
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const userMetadataHeaderPrefix = "x-amz-meta-"
+
+// MetadataMatcher matches user-defined object metadata, e.g. a
+// "x-amz-meta-hold: true" header.
+type MetadataMatcher struct {
+	name string
+
+	// Any value matches if empty.
+	value string
+}
+
+// ParseMetadataMatcher parses a "name=value" or "name" specification. The
+// "x-amz-meta-" header prefix is optional.
+func ParseMetadataMatcher(spec string) (*MetadataMatcher, error) {
+	name, value, _ := strings.Cut(spec, "=")
+
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.TrimPrefix(name, userMetadataHeaderPrefix)
+
+	if name == "" {
+		return nil, fmt.Errorf("%w: missing metadata name: %q", os.ErrInvalid, spec)
+	}
+
+	return &MetadataMatcher{
+		name:  name,
+		value: strings.TrimSpace(value),
+	}, nil
+}
+
+func (m *MetadataMatcher) String() string {
+	if m.value == "" {
+		return userMetadataHeaderPrefix + m.name
+	}
+
+	return userMetadataHeaderPrefix + m.name + "=" + m.value
+}
+
+func (m *MetadataMatcher) match(metadata map[string]string) bool {
+	for name, value := range metadata {
+		if strings.EqualFold(name, m.name) {
+			return m.value == "" || strings.EqualFold(value, m.value)
+		}
+	}
+
+	return false
+}
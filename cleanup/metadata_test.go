@@ -0,0 +1,71 @@
+package cleanup
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestMetadataMatcher(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		spec     string
+		wantErr  error
+		metadata map[string]string
+		want     bool
+	}{
+		{
+			name:    "empty",
+			wantErr: os.ErrInvalid,
+		},
+		{
+			name:    "missing name",
+			spec:    "=true",
+			wantErr: os.ErrInvalid,
+		},
+		{
+			name:     "no metadata",
+			spec:     "hold=true",
+			metadata: nil,
+		},
+		{
+			name:     "match",
+			spec:     "hold=true",
+			metadata: map[string]string{"hold": "true"},
+			want:     true,
+		},
+		{
+			name:     "header prefix and case",
+			spec:     "X-Amz-Meta-Hold=TRUE",
+			metadata: map[string]string{"Hold": "true"},
+			want:     true,
+		},
+		{
+			name:     "different value",
+			spec:     "hold=true",
+			metadata: map[string]string{"hold": "false"},
+		},
+		{
+			name:     "any value",
+			spec:     "hold",
+			metadata: map[string]string{"other": "x", "hold": ""},
+			want:     true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := ParseMetadataMatcher(tc.spec)
+
+			if diff := cmp.Diff(tc.wantErr, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("Error diff (-want +got):\n%s", diff)
+			}
+
+			if err == nil {
+				if got := m.match(tc.metadata); got != tc.want {
+					t.Errorf("match(%v) = %v, want %v", tc.metadata, got, tc.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/hansmi/s3-object-cleanup/internal/client"
+	"github.com/hansmi/s3-object-cleanup/internal/env"
+	"github.com/hansmi/s3-object-cleanup/internal/state"
+)
+
+// Integration tests against a MinIO server run only if its URL is given, e.g.
+// "http://localhost:9000". See contrib/minio-test.
+const minioEndpointEnv = "S3_OBJECT_CLEANUP_TEST_MINIO_ENDPOINT"
+
+type minioHarness struct {
+	endpoint string
+	cfg      aws.Config
+	s3       *s3.Client
+}
+
+func newMinioHarness(t *testing.T) *minioHarness {
+	t.Helper()
+
+	endpoint := strings.TrimSuffix(os.Getenv(minioEndpointEnv), "/")
+	if endpoint == "" {
+		t.Skipf("$%s not set", minioEndpointEnv)
+	}
+
+	accessKey := env.GetWithFallback("S3_OBJECT_CLEANUP_TEST_MINIO_ACCESS_KEY", "minioadmin")
+	secretKey := env.GetWithFallback("S3_OBJECT_CLEANUP_TEST_MINIO_SECRET_KEY", "minioadmin")
+
+	cfg := aws.Config{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider(accessKey, secretKey, ""),
+	}
+
+	return &minioHarness{
+		endpoint: endpoint,
+		cfg:      cfg,
+		s3: s3.NewFromConfig(cfg, func(o *s3.Options) {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}),
+	}
+}
+
+// createBucket creates a versioned bucket removed with all of its versions at
+// the end of the test.
+func (h *minioHarness) createBucket(t *testing.T, objectLock bool) string {
+	t.Helper()
+
+	name := fmt.Sprintf("cleanup-test-%d", time.Now().UnixNano())
+
+	if _, err := h.s3.CreateBucket(t.Context(), &s3.CreateBucketInput{
+		Bucket:                     aws.String(name),
+		ObjectLockEnabledForBucket: aws.Bool(objectLock),
+	}); err != nil {
+		t.Fatalf("CreateBucket(%q) failed: %v", name, err)
+	}
+
+	t.Cleanup(func() {
+		// The test context is already cancelled.
+		ctx := context.Background()
+
+		for _, v := range h.listVersions(ctx, t, name) {
+			if _, err := h.s3.DeleteObject(ctx, &s3.DeleteObjectInput{
+				Bucket:    aws.String(name),
+				Key:       aws.String(v.key),
+				VersionId: aws.String(v.versionID),
+			}); err != nil {
+				t.Errorf("DeleteObject(%q, %q) failed: %v", v.key, v.versionID, err)
+			}
+		}
+
+		if _, err := h.s3.DeleteBucket(ctx, &s3.DeleteBucketInput{
+			Bucket: aws.String(name),
+		}); err != nil {
+			t.Errorf("DeleteBucket(%q) failed: %v", name, err)
+		}
+	})
+
+	if !objectLock {
+		if _, err := h.s3.PutBucketVersioning(t.Context(), &s3.PutBucketVersioningInput{
+			Bucket: aws.String(name),
+			VersioningConfiguration: &types.VersioningConfiguration{
+				Status: types.BucketVersioningStatusEnabled,
+			},
+		}); err != nil {
+			t.Fatalf("PutBucketVersioning(%q) failed: %v", name, err)
+		}
+	}
+
+	return name
+}
+
+func (h *minioHarness) put(t *testing.T, bucket, key string) string {
+	t.Helper()
+
+	output, err := h.s3.PutObject(t.Context(), &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   strings.NewReader(key),
+	})
+	if err != nil {
+		t.Fatalf("PutObject(%q) failed: %v", key, err)
+	}
+
+	return aws.ToString(output.VersionId)
+}
+
+func (h *minioHarness) delete(t *testing.T, bucket, key string) {
+	t.Helper()
+
+	if _, err := h.s3.DeleteObject(t.Context(), &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}); err != nil {
+		t.Fatalf("DeleteObject(%q) failed: %v", key, err)
+	}
+}
+
+type minioVersion struct {
+	key          string
+	versionID    string
+	deleteMarker bool
+}
+
+func (h *minioHarness) listVersions(ctx context.Context, t *testing.T, bucket string) []minioVersion {
+	t.Helper()
+
+	var result []minioVersion
+
+	paginator := s3.NewListObjectVersionsPaginator(h.s3, &s3.ListObjectVersionsInput{
+		Bucket: aws.String(bucket),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			t.Fatalf("ListObjectVersions(%q) failed: %v", bucket, err)
+		}
+
+		for _, v := range page.Versions {
+			result = append(result, minioVersion{aws.ToString(v.Key), aws.ToString(v.VersionId), false})
+		}
+
+		for _, m := range page.DeleteMarkers {
+			result = append(result, minioVersion{aws.ToString(m.Key), aws.ToString(m.VersionId), true})
+		}
+	}
+
+	return result
+}
+
+func (h *minioHarness) client(t *testing.T, bucket string) *client.Client {
+	t.Helper()
+
+	c, err := client.NewFromName(h.cfg, h.endpoint+"/"+bucket)
+	if err != nil {
+		t.Fatalf("NewFromName() failed: %v", err)
+	}
+
+	c.SetFlavor(client.FlavorMinIO)
+
+	return c
+}
+
+func TestMinioCapabilities(t *testing.T) {
+	h := newMinioHarness(t)
+
+	for _, objectLock := range []bool{false, true} {
+		t.Run(fmt.Sprint(objectLock), func(t *testing.T) {
+			c := h.client(t, h.createBucket(t, objectLock))
+
+			caps, err := c.DetectCapabilities(t.Context())
+			if err != nil {
+				t.Fatalf("DetectCapabilities() failed: %v", err)
+			}
+
+			if caps.ObjectLock != objectLock {
+				t.Errorf("Object Lock detected as %t, want %t", caps.ObjectLock, objectLock)
+			}
+		})
+	}
+}
+
+func TestMinioCleanup(t *testing.T) {
+	h := newMinioHarness(t)
+	bucket := h.createBucket(t, false)
+
+	h.put(t, bucket, "a")
+	h.put(t, bucket, "a")
+	latest := h.put(t, bucket, "a")
+
+	h.put(t, bucket, "b")
+	h.delete(t, bucket, "b")
+
+	// Last-modified timestamps have a resolution of one second.
+	time.Sleep(time.Second)
+
+	store, err := state.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("state.New() failed: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if err := store.Close(); err != nil {
+			t.Errorf("Close() failed: %v", err)
+		}
+	})
+
+	stats := NewStats()
+
+	if err := Run(t.Context(), Options{
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Stats:  stats,
+		State:  store,
+		Client: h.client(t, bucket),
+
+		AllowUnlocked: true,
+	}); err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+
+	for _, v := range h.listVersions(t.Context(), t, bucket) {
+		switch {
+		case v.key == "a" && v.versionID == latest:
+		case v.key == "b" && v.deleteMarker:
+		default:
+			t.Errorf("Version %+v was not deleted", v)
+		}
+	}
+
+	if stats.deleteErrorCount != 0 {
+		t.Errorf("deleteErrorCount=%d, want 0", stats.deleteErrorCount)
+	}
+}
@@ -0,0 +1,82 @@
+package cleanup
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Version ID of objects written while versioning wasn't enabled for the
+// bucket. Writing an object while versioning is suspended replaces the null
+// version instead of adding another version.
+const nullVersionID = "null"
+
+type objectVersion struct {
+	lastModified time.Time
+	retainUntil  time.Time
+
+	key       string
+	versionID string
+
+	size int64
+
+	isLatest     bool
+	deleteMarker bool
+
+	// The version was recorded in the inventory by a previous run and hasn't
+	// changed since.
+	unchanged bool
+
+	// Number of versions of the key forwarded by the listing, allowing the
+	// key to be processed once all of them have arrived. Zero if unknown.
+	keyVersionCount int
+
+	// Position among the versions of the key in listing order, newest first.
+	// Breaks ties between versions with identical modification times.
+	listOrder int
+
+	// Response of a HeadObject request made while annotating the version.
+	// Nil if none was made.
+	head *s3.HeadObjectOutput
+}
+
+var _ slog.LogValuer = (*objectVersion)(nil)
+
+func (v objectVersion) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("key", v.key),
+		slog.String("version", v.versionID),
+		slog.Time("last_modified", v.lastModified),
+		slog.Bool("delete_marker", v.deleteMarker),
+		slog.Time("retain_until", v.retainUntil),
+	)
+}
+
+// stateVersionID returns the version ID under which the version is recorded in
+// the state. Null versions are qualified by their modification time so that
+// records of a replaced null version don't apply to its successor.
+func (v objectVersion) stateVersionID() string {
+	if v.versionID != nullVersionID {
+		return v.versionID
+	}
+
+	return nullVersionID + "@" + v.lastModified.UTC().Format(time.RFC3339Nano)
+}
+
+func (v objectVersion) identifier() types.ObjectIdentifier {
+	id := types.ObjectIdentifier{
+		Key:              aws.String(v.key),
+		LastModifiedTime: aws.Time(v.lastModified),
+		Size:             aws.Int64(v.size),
+	}
+
+	// Objects in unversioned buckets have no version ID.
+	if v.versionID != "" {
+		id.VersionId = aws.String(v.versionID)
+	}
+
+	return id
+}
@@ -0,0 +1,65 @@
+package cleanup
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// ErrWorkerPanic is wrapped by errors of pipeline workers which recovered from
+// a panic while processing an item.
+var ErrWorkerPanic = errors.New("worker panic")
+
+// recoverItem invokes fn and converts a panic into an error wrapping
+// [ErrWorkerPanic]. The stack trace is logged as it's lost afterwards. Workers
+// treat such errors like any other failure of an item and continue with the
+// next one, so that upstream stages never block on a dead worker.
+func recoverItem(logger *slog.Logger, stage pipelineStage, fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Recovered from panic",
+				slog.String("stage", stage.String()),
+				slog.Any("panic", r),
+				slog.String("stack", string(debug.Stack())))
+
+			err = fmt.Errorf("%w in %s stage: %v", ErrWorkerPanic, stage, r)
+		}
+	}()
+
+	return fn()
+}
+
+// workerPanic remembers the first panic recovered by the workers of a stage.
+// It's only returned once all workers have exhausted their input, as an error
+// returned by one worker would cancel the others and make them drop the items
+// they already received.
+type workerPanic struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (p *workerPanic) add(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err == nil && errors.Is(err, ErrWorkerPanic) {
+		p.err = err
+	}
+}
+
+// wait waits for the workers and returns the first error of the group or the
+// first recorded panic.
+func (p *workerPanic) wait(g *errgroup.Group) error {
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.err
+}
@@ -0,0 +1,131 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestRecoverItem(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+
+	for _, tc := range []struct {
+		name    string
+		fn      func() error
+		wantErr error
+	}{
+		{
+			name: "success",
+			fn:   func() error { return nil },
+		},
+		{
+			name:    "error",
+			fn:      func() error { return os.ErrInvalid },
+			wantErr: os.ErrInvalid,
+		},
+		{
+			name:    "panic",
+			fn:      func() error { panic("malformed") },
+			wantErr: ErrWorkerPanic,
+		},
+		{
+			name: "nil pointer",
+			fn: func() error {
+				var ov *objectVersion
+				return fmt.Errorf("%s", ov.key)
+			},
+			wantErr: ErrWorkerPanic,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := recoverItem(logger, stageDeletion, tc.fn)
+
+			if diff := cmp.Diff(tc.wantErr, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("recoverItem() error diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+type panickingExtenderClient struct {
+	count atomic.Int64
+
+	// Closed once the bad key panicked.
+	panicked chan struct{}
+}
+
+func (c *panickingExtenderClient) PutObjectRetention(_ context.Context, key string, _ string, _ time.Time) error {
+	if key == "bad" {
+		defer close(c.panicked)
+		panic("malformed object")
+	}
+
+	// Keep the other workers busy until the panic has happened.
+	<-c.panicked
+
+	c.count.Add(1)
+
+	return nil
+}
+
+func TestExtenderRunPanic(t *testing.T) {
+	client := panickingExtenderClient{
+		panicked: make(chan struct{}),
+	}
+
+	stats := NewStats()
+
+	e := newRetentionExtender(retentionExtenderOptions{
+		logger: slog.New(slog.DiscardHandler),
+		stats:  stats,
+		state:  newRetentionStateForTest(t),
+		client: &client,
+	})
+
+	ch := make(chan retentionExtenderRequest)
+
+	go func() {
+		defer close(ch)
+
+		for idx := range 20 {
+			key := fmt.Sprintf("key%d", idx)
+
+			if idx == 0 {
+				key = "bad"
+			}
+
+			ch <- retentionExtenderRequest{
+				object: objectVersion{key: key, versionID: "v1"},
+				until:  time.Now().Add(time.Hour),
+			}
+		}
+	}()
+
+	if err := e.run(t.Context(), ch); !errors.Is(err, ErrWorkerPanic) {
+		t.Errorf("run() returned %v, want %v", err, ErrWorkerPanic)
+	}
+
+	if got := client.count.Load(); got != 19 {
+		t.Errorf("Extended %d versions, want 19", got)
+	}
+
+	counters := stats.Counters()
+
+	for name, want := range map[string]int64{
+		"errors.panic_count":    1,
+		"errors.other_count":    0,
+		"retention.error_count": 1,
+	} {
+		if got := counters[name]; got != want {
+			t.Errorf("Counter %q is %d, want %d", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/hansmi/s3-object-cleanup/internal/client"
+)
+
+// ErrPermissionDenied is returned when probing the permissions at the start
+// of a bucket finds a required one missing.
+var ErrPermissionDenied = errors.New("permission denied")
+
+type permissionProbeClient interface {
+	Preflight(context.Context, client.PreflightOptions) []client.PermissionProbe
+}
+
+type permissionCheckOptions struct {
+	logger *slog.Logger
+	client permissionProbeClient
+	dryRun bool
+
+	// Counts denied permissions if set.
+	stats *Stats
+}
+
+// CheckPermissions issues one representative request per permission needed
+// for cleaning up the bucket, e.g. before any bucket of a run is processed.
+// Outside of dry runs the permissions for extending retention and deleting
+// versions are included. An error wrapping [ErrPermissionDenied] lists the
+// denied actions. The client caches the results, so runs with
+// ProbePermissions don't probe the bucket again.
+func CheckPermissions(ctx context.Context, logger *slog.Logger, c *Client, dryRun bool) error {
+	return checkPermissions(ctx, permissionCheckOptions{
+		logger: logger,
+		client: c,
+		dryRun: dryRun,
+	})
+}
+
+// checkPermissions probes the permissions needed for the bucket. A missing
+// permission is reported once instead of failing for every object version.
+func checkPermissions(ctx context.Context, opts permissionCheckOptions) error {
+	var denied []string
+
+	for _, probe := range opts.client.Preflight(ctx, client.PreflightOptions{
+		Delete:          !opts.dryRun,
+		ExtendRetention: !opts.dryRun,
+	}) {
+		attrs := []any{
+			slog.String("action", probe.Action),
+			slog.String("status", probe.Status.String()),
+		}
+
+		if probe.Err != nil {
+			attrs = append(attrs, slog.Any("error", probe.Err))
+		}
+
+		if probe.Status != client.PermissionDenied {
+			opts.logger.DebugContext(ctx, "Probed permission", attrs...)
+			continue
+		}
+
+		opts.logger.ErrorContext(ctx, "Missing permission", attrs...)
+
+		if opts.stats != nil {
+			opts.stats.addErrorClass(client.ErrorClassAccessDenied)
+		}
+
+		denied = append(denied, probe.Action)
+	}
+
+	if len(denied) > 0 {
+		return fmt.Errorf("%w: %s", ErrPermissionDenied, strings.Join(denied, ", "))
+	}
+
+	return nil
+}
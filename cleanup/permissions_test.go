@@ -0,0 +1,144 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/hansmi/s3-object-cleanup/internal/client"
+	"github.com/hansmi/s3-object-cleanup/internal/fakes3"
+	"github.com/hansmi/s3-object-cleanup/internal/state"
+)
+
+type fakePermissionProbeClient struct {
+	probes []client.PermissionProbe
+	opts   []client.PreflightOptions
+}
+
+func (c *fakePermissionProbeClient) Preflight(_ context.Context, opts client.PreflightOptions) []client.PermissionProbe {
+	c.opts = append(c.opts, opts)
+
+	return c.probes
+}
+
+func TestCheckPermissions(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		dryRun   bool
+		probes   []client.PermissionProbe
+		wantOpts client.PreflightOptions
+		wantErr  error
+	}{
+		{
+			name:   "dry run",
+			dryRun: true,
+			probes: []client.PermissionProbe{
+				{Action: "s3:ListBucketVersions", Status: client.PermissionGranted},
+			},
+		},
+		{
+			name: "unknown",
+			probes: []client.PermissionProbe{
+				{Action: "s3:DeleteObjectVersion", Status: client.PermissionUnknown},
+			},
+			wantOpts: client.PreflightOptions{Delete: true, ExtendRetention: true},
+		},
+		{
+			name: "denied",
+			probes: []client.PermissionProbe{
+				{Action: "s3:ListBucketVersions", Status: client.PermissionGranted},
+				{Action: "s3:PutObjectRetention", Status: client.PermissionDenied},
+			},
+			wantOpts: client.PreflightOptions{Delete: true, ExtendRetention: true},
+			wantErr:  ErrPermissionDenied,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := fakePermissionProbeClient{probes: tc.probes}
+			stats := NewStats()
+
+			err := checkPermissions(t.Context(), permissionCheckOptions{
+				logger: slog.New(slog.DiscardHandler),
+				stats:  stats,
+				client: &c,
+				dryRun: tc.dryRun,
+			})
+
+			if diff := cmp.Diff(tc.wantErr, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("Error diff (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff([]client.PreflightOptions{tc.wantOpts}, c.opts); diff != "" {
+				t.Errorf("Probe options diff (-want +got):\n%s", diff)
+			}
+
+			wantDenied := int64(0)
+
+			if tc.wantErr != nil {
+				wantDenied = 1
+			}
+
+			if got := stats.Counters()["errors.access_denied_count"]; got != wantDenied {
+				t.Errorf("Counted %d denied permissions, want %d", got, wantDenied)
+			}
+		})
+	}
+}
+
+func TestRunProbePermissions(t *testing.T) {
+	base := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	fake := fakes3.New(fakes3.Options{
+		Bucket: "bucket",
+		Deny:   []string{"PutObjectRetention"},
+	})
+	fake.Add(fakes3.Version{Key: "a", VersionID: "v1", LastModified: base})
+	fake.Add(fakes3.Version{Key: "a", VersionID: "v2", LastModified: base.Add(time.Hour)})
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	c, err := NewClient(aws.Config{
+		Region:      "us-east-1",
+		Credentials: aws.AnonymousCredentials{},
+	}, server.URL+"/bucket")
+	if err != nil {
+		t.Fatalf("NewClient() failed: %v", err)
+	}
+
+	store, err := state.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("state.New() failed: %v", err)
+	}
+
+	t.Cleanup(func() { store.Close() })
+
+	stats := NewStats()
+
+	err = Run(t.Context(), Options{
+		Logger:           slog.New(slog.DiscardHandler),
+		Stats:            stats,
+		State:            store,
+		Client:           c,
+		MinRetention:     24 * time.Hour,
+		ProbePermissions: true,
+	})
+
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Run() returned %v, want %v", err, ErrPermissionDenied)
+	}
+
+	if got := len(fake.Versions()); got != 2 {
+		t.Errorf("Bucket has %d versions, want 2", got)
+	}
+
+	if got := stats.Counters()["retention.error_count"]; got != 0 {
+		t.Errorf("Got %d retention errors, want none", got)
+	}
+}
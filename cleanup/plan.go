@@ -0,0 +1,279 @@
+package cleanup
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PlanFormat selects the file format of a plan.
+type PlanFormat string
+
+const (
+	PlanFormatCSV  PlanFormat = "csv"
+	PlanFormatJSON PlanFormat = "json"
+)
+
+// Version of the JSON plan format. The minor version is incremented for
+// backwards-compatible additions, the major version for all other changes.
+// See plan.schema.json.
+const planFormatVersion = "1.0"
+
+// ParsePlanFormat returns the plan format with the given name.
+func ParsePlanFormat(name string) (PlanFormat, error) {
+	switch f := PlanFormat(strings.ToLower(name)); f {
+	case PlanFormatCSV, PlanFormatJSON:
+		return f, nil
+	}
+
+	return "", fmt.Errorf("%w: unknown plan format %q (known: %s, %s)", os.ErrInvalid, name, PlanFormatCSV, PlanFormatJSON)
+}
+
+const (
+	planActionDelete = "DELETE"
+	planActionExtend = "EXTEND"
+)
+
+const (
+	planReasonExpiredVersion      = "noncurrent version older than min_age"
+	planReasonExpiredDeleteMarker = "expired delete marker"
+	planReasonRetentionMissing    = "retention missing"
+	planReasonRetentionBelow      = "remaining retention below threshold"
+)
+
+var planFields = []string{
+	"Bucket",
+	"Key",
+	"Version ID",
+	"Action",
+	"Reason",
+	"Size",
+	"Until",
+}
+
+type planEntry struct {
+	bucket    string
+	key       string
+	versionID string
+	action    string
+	reason    string
+	size      int64
+	until     time.Time
+}
+
+// Plan collects the actions a run would take. Entries are sorted when
+// written so that plans of different runs can be compared.
+type Plan struct {
+	mu      sync.Mutex
+	entries []planEntry
+}
+
+func NewPlan() *Plan {
+	return &Plan{}
+}
+
+func (p *Plan) add(e planEntry) {
+	p.mu.Lock()
+	p.entries = append(p.entries, e)
+	p.mu.Unlock()
+}
+
+// ForBucket returns a recorder adding entries for the given bucket.
+func (p *Plan) ForBucket(name string) *PlanRecorder {
+	return &PlanRecorder{
+		plan:   p,
+		bucket: name,
+	}
+}
+
+// sorted returns the entries ordered by bucket, key and version.
+func (p *Plan) sorted() []planEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	slices.SortFunc(p.entries, func(a, b planEntry) int {
+		return cmp.Or(
+			strings.Compare(a.bucket, b.bucket),
+			strings.Compare(a.key, b.key),
+			strings.Compare(a.versionID, b.versionID),
+			strings.Compare(a.action, b.action),
+		)
+	})
+
+	return slices.Clone(p.entries)
+}
+
+func (p *Plan) writeTo(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write(planFields)
+
+	var fields []string
+
+	for _, e := range p.sorted() {
+		fields = append(fields[:0],
+			e.bucket,
+			e.key,
+			e.versionID,
+			e.action,
+			e.reason,
+			strconv.FormatInt(e.size, 10),
+			formatReportTime(e.until),
+		)
+
+		if err := cw.Write(fields); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+type planSummary struct {
+	Delete      int   `json:"delete"`
+	DeleteBytes int64 `json:"delete_bytes"`
+	Extend      int   `json:"extend"`
+}
+
+func (s *planSummary) add(e planEntry) {
+	switch e.action {
+	case planActionDelete:
+		s.Delete++
+		s.DeleteBytes += e.size
+	case planActionExtend:
+		s.Extend++
+	}
+}
+
+type planAction struct {
+	Bucket    string     `json:"bucket"`
+	Key       string     `json:"key"`
+	VersionID string     `json:"version_id"`
+	Action    string     `json:"action"`
+	Reason    string     `json:"reason"`
+	Size      int64      `json:"size"`
+	Until     *time.Time `json:"until,omitempty"`
+}
+
+// planDocument is the JSON representation of a plan described by
+// plan.schema.json.
+type planDocument struct {
+	FormatVersion string                 `json:"format_version"`
+	Summary       planSummary            `json:"summary"`
+	Buckets       map[string]planSummary `json:"buckets"`
+	Actions       []planAction           `json:"actions"`
+}
+
+// writeJSON writes the plan as a single JSON document. Automation can gate
+// on the summary, e.g. the number of deletions, before applying it.
+func (p *Plan) writeJSON(w io.Writer) error {
+	doc := planDocument{
+		FormatVersion: planFormatVersion,
+		Buckets:       map[string]planSummary{},
+		Actions:       []planAction{},
+	}
+
+	for _, e := range p.sorted() {
+		action := planAction{
+			Bucket:    e.bucket,
+			Key:       e.key,
+			VersionID: e.versionID,
+			Action:    strings.ToLower(e.action),
+			Reason:    e.reason,
+			Size:      e.size,
+		}
+
+		if !e.until.IsZero() {
+			until := e.until.UTC()
+			action.Until = &until
+		}
+
+		doc.Actions = append(doc.Actions, action)
+		doc.Summary.add(e)
+
+		bucket := doc.Buckets[e.bucket]
+		bucket.add(e)
+		doc.Buckets[e.bucket] = bucket
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(doc)
+}
+
+// WriteFile writes the plan in the given format. A path of "-" refers to
+// standard output.
+func (p *Plan) WriteFile(path string, format PlanFormat) (err error) {
+	write := p.writeTo
+
+	if format == PlanFormatJSON {
+		write = p.writeJSON
+	}
+
+	if path == "-" {
+		return write(os.Stdout)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err = errors.Join(err, f.Close())
+	}()
+
+	return write(f)
+}
+
+// PlanRecorder adds the actions of a single bucket to a plan.
+type PlanRecorder struct {
+	plan   *Plan
+	bucket string
+}
+
+func (r *PlanRecorder) addDelete(ov objectVersion) {
+	reason := planReasonExpiredVersion
+
+	if ov.deleteMarker {
+		reason = planReasonExpiredDeleteMarker
+	}
+
+	r.plan.add(planEntry{
+		bucket:    r.bucket,
+		key:       ov.key,
+		versionID: ov.versionID,
+		action:    planActionDelete,
+		reason:    reason,
+		size:      ov.size,
+	})
+}
+
+func (r *PlanRecorder) addRetention(req retentionExtenderRequest) {
+	reason := planReasonRetentionBelow
+
+	if req.object.retainUntil.IsZero() {
+		reason = planReasonRetentionMissing
+	}
+
+	r.plan.add(planEntry{
+		bucket:    r.bucket,
+		key:       req.object.key,
+		versionID: req.object.versionID,
+		action:    planActionExtend,
+		reason:    reason,
+		size:      req.object.size,
+		until:     req.until,
+	})
+}
@@ -0,0 +1,218 @@
+package cleanup
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestPlan(t *testing.T) {
+	p := NewPlan()
+
+	b := p.ForBucket("second")
+	b.addDelete(objectVersion{key: "k2", versionID: "v1", size: 100})
+	b.addDelete(objectVersion{key: "k1", versionID: "del", deleteMarker: true})
+
+	a := p.ForBucket("first")
+	a.addRetention(retentionExtenderRequest{
+		object: objectVersion{key: "k1", versionID: "v2", size: 10},
+		until:  time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+	})
+	a.addRetention(retentionExtenderRequest{
+		object: objectVersion{
+			key:         "k1",
+			versionID:   "v1",
+			retainUntil: time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC),
+		},
+		until: time.Date(2020, time.February, 1, 0, 0, 0, 0, time.UTC),
+	})
+
+	var buf bytes.Buffer
+
+	if err := p.writeTo(&buf); err != nil {
+		t.Fatalf("writeTo() failed: %v", err)
+	}
+
+	got, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll() failed: %v", err)
+	}
+
+	want := [][]string{
+		planFields,
+		{"first", "k1", "v1", planActionExtend, planReasonRetentionBelow, "0", "2020-02-01 00:00:00"},
+		{"first", "k1", "v2", planActionExtend, planReasonRetentionMissing, "10", "2020-01-01 00:00:00"},
+		{"second", "k1", "del", planActionDelete, planReasonExpiredDeleteMarker, "0", ""},
+		{"second", "k2", "v1", planActionDelete, planReasonExpiredVersion, "100", ""},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Plan diff (-want +got):\n%s", diff)
+	}
+
+	if err := p.WriteFile(filepath.Join(t.TempDir(), "plan.csv"), PlanFormatCSV); err != nil {
+		t.Errorf("WriteFile() failed: %v", err)
+	}
+}
+
+func TestPlanJSON(t *testing.T) {
+	p := NewPlan()
+
+	b := p.ForBucket("second")
+	b.addDelete(objectVersion{key: "k2", versionID: "v1", size: 100})
+	b.addDelete(objectVersion{key: "k1", versionID: "del", deleteMarker: true})
+
+	a := p.ForBucket("first")
+	a.addRetention(retentionExtenderRequest{
+		object: objectVersion{key: "k1", versionID: "v2", size: 10},
+		until:  time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+	})
+
+	var buf bytes.Buffer
+
+	if err := p.writeJSON(&buf); err != nil {
+		t.Fatalf("writeJSON() failed: %v", err)
+	}
+
+	var got any
+
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+
+	want := map[string]any{
+		"format_version": planFormatVersion,
+		"summary":        map[string]any{"delete": 2.0, "delete_bytes": 100.0, "extend": 1.0},
+		"buckets": map[string]any{
+			"first":  map[string]any{"delete": 0.0, "delete_bytes": 0.0, "extend": 1.0},
+			"second": map[string]any{"delete": 2.0, "delete_bytes": 100.0, "extend": 0.0},
+		},
+		"actions": []any{
+			map[string]any{
+				"bucket": "first", "key": "k1", "version_id": "v2", "action": "extend",
+				"reason": planReasonRetentionMissing, "size": 10.0, "until": "2020-01-01T00:00:00Z",
+			},
+			map[string]any{
+				"bucket": "second", "key": "k1", "version_id": "del", "action": "delete",
+				"reason": planReasonExpiredDeleteMarker, "size": 0.0,
+			},
+			map[string]any{
+				"bucket": "second", "key": "k2", "version_id": "v1", "action": "delete",
+				"reason": planReasonExpiredVersion, "size": 100.0,
+			},
+		},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Plan diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestPlanJSONEmpty(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := NewPlan().writeJSON(&buf); err != nil {
+		t.Fatalf("writeJSON() failed: %v", err)
+	}
+
+	if !strings.Contains(buf.String(), `"actions": []`) {
+		t.Errorf("Empty plan lacks actions array:\n%s", buf.String())
+	}
+}
+
+// TestPlanSchema ensures the schema stays in sync with the written documents.
+func TestPlanSchema(t *testing.T) {
+	content, err := os.ReadFile("plan.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var schema struct {
+		Required   []string       `json:"required"`
+		Properties map[string]any `json:"properties"`
+		Defs       map[string]struct {
+			Required   []string       `json:"required"`
+			Properties map[string]any `json:"properties"`
+		} `json:"$defs"`
+	}
+
+	if err := json.Unmarshal(content, &schema); err != nil {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name       string
+		value      any
+		required   []string
+		properties map[string]any
+	}{
+		{"document", planDocument{}, schema.Required, schema.Properties},
+		{"summary", planSummary{}, schema.Defs["summary"].Required, schema.Defs["summary"].Properties},
+		{"action", planAction{}, schema.Defs["action"].Required, schema.Defs["action"].Properties},
+	} {
+		var names, required []string
+
+		typ := reflect.TypeOf(tc.value)
+
+		for i := range typ.NumField() {
+			name, opts, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+
+			names = append(names, name)
+
+			if opts != "omitempty" {
+				required = append(required, name)
+			}
+		}
+
+		var properties []string
+
+		for name := range tc.properties {
+			properties = append(properties, name)
+		}
+
+		if diff := cmp.Diff(names, properties, cmpopts.SortSlices(strings.Compare)); diff != "" {
+			t.Errorf("%s: properties diff (-want +got):\n%s", tc.name, diff)
+		}
+
+		if diff := cmp.Diff(required, tc.required, cmpopts.SortSlices(strings.Compare)); diff != "" {
+			t.Errorf("%s: required properties diff (-want +got):\n%s", tc.name, diff)
+		}
+	}
+
+	if got := schema.Properties["format_version"].(map[string]any)["pattern"]; !regexp.MustCompile(got.(string)).MatchString(planFormatVersion) {
+		t.Errorf("Format version %q doesn't match schema pattern %q", planFormatVersion, got)
+	}
+}
+
+func TestParsePlanFormat(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		want    PlanFormat
+		wantErr error
+	}{
+		{name: "csv", want: PlanFormatCSV},
+		{name: "JSON", want: PlanFormatJSON},
+		{name: "", wantErr: os.ErrInvalid},
+		{name: "yaml", wantErr: os.ErrInvalid},
+	} {
+		got, err := ParsePlanFormat(tc.name)
+
+		if diff := cmp.Diff(tc.wantErr, err, cmpopts.EquateErrors()); diff != "" {
+			t.Errorf("ParsePlanFormat(%q) error diff (-want +got):\n%s", tc.name, diff)
+		}
+
+		if got != tc.want {
+			t.Errorf("ParsePlanFormat(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package cleanup
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// ErrInvalidDecision is wrapped by the error failing a run whose policy
+// returned a decision referring to versions outside the evaluated series or
+// deleting versions which must be kept.
+var ErrInvalidDecision = errors.New("invalid policy decision")
+
+// Version is a single object version or delete marker as seen by a [Policy].
+type Version struct {
+	ov objectVersion
+}
+
+var _ slog.LogValuer = (*Version)(nil)
+
+func (v Version) Key() string             { return v.ov.key }
+func (v Version) VersionID() string       { return v.ov.versionID }
+func (v Version) LastModified() time.Time { return v.ov.lastModified }
+func (v Version) Size() int64             { return v.ov.size }
+func (v Version) IsLatest() bool          { return v.ov.isLatest }
+func (v Version) DeleteMarker() bool      { return v.ov.deleteMarker }
+
+// RetainUntil returns the end of the retention period. Zero if the version
+// has no retention or the bucket doesn't use Object Lock.
+func (v Version) RetainUntil() time.Time { return v.ov.retainUntil }
+
+func (v Version) LogValue() slog.Value {
+	return v.ov.LogValue()
+}
+
+// Series holds all listed versions of a single key.
+type Series struct {
+	Key string
+
+	// Versions sorted by modification time, oldest first.
+	Versions []Version
+
+	// Whether the latest version is part of the series. It may be missing
+	// if listing or annotating it failed, in which case nothing should be
+	// deleted.
+	HaveLatest bool
+
+	// Start of the run. Ages are measured relative to it.
+	Now time.Time
+}
+
+// Extension requests the retention of a version to be extended.
+type Extension struct {
+	Version Version
+	Until   time.Time
+}
+
+// Decision lists the actions to take for a version series. Versions not
+// mentioned are retained as they are.
+type Decision struct {
+	Delete []Version
+
+	// Extensions for delete markers and to times before the current end of
+	// the retention are ignored.
+	Extend []Extension
+
+	// Earliest time at which evaluating the unchanged series again may lead
+	// to actions. Zero if the series must be evaluated on every run. Only
+	// used by incremental runs.
+	Due time.Time
+
+	// Rules which fired for each version, for the decision trace.
+	rules versionRules
+}
+
+// Policy decides which versions of a key to retain, extend or delete.
+// Decisions may only refer to versions of the given series, each version
+// being deleted at most once and not also extended. The latest version may
+// only be deleted if it's a delete marker, and nothing may be deleted from a
+// series without its latest version. Other decisions fail the run. Policies
+// are called from a single goroutine per run.
+type Policy interface {
+	Decide(Series) Decision
+}
+
+// PolicyFunc adapts a function to the [Policy] interface.
+type PolicyFunc func(Series) Decision
+
+func (f PolicyFunc) Decide(s Series) Decision {
+	return f(s)
+}
+
+type defaultPolicy struct {
+	opts versionSeriesFinalizeOptions
+}
+
+// DefaultPolicy returns the built-in policy configured by MinDeletionAge,
+// MinRetention, MinRetentionThreshold, MaxNoncurrentVersions,
+// AgeFromNoncurrent and DeleteMarkers. Noncurrent versions are deleted once
+// they're older than the minimum deletion age and their retention has ended.
+// The retention of the versions still needed is extended to at least the
+// minimum retention.
+func DefaultPolicy(opts Options) Policy {
+	return defaultPolicy{
+		opts: versionSeriesFinalizeOptions{
+			minDeletionAge:        opts.MinDeletionAge,
+			minRetention:          opts.MinRetention,
+			maxNoncurrentVersions: opts.MaxNoncurrentVersions,
+			ageFromNoncurrent:     opts.AgeFromNoncurrent,
+			minRetentionThreshold: opts.MinRetentionThreshold,
+			deleteMarkers:         opts.DeleteMarkers,
+			trace:                 opts.TraceDecisions,
+		},
+	}
+}
+
+func (p defaultPolicy) Decide(s Series) Decision {
+	series := versionSeries{
+		items:      make([]objectVersion, len(s.Versions)),
+		haveLatest: s.HaveLatest,
+	}
+
+	for idx, v := range s.Versions {
+		series.items[idx] = v.ov
+	}
+
+	opts := p.opts
+	opts.now = s.Now
+
+	result := series.finalize(opts)
+
+	d := Decision{
+		Due:   result.due,
+		rules: result.rules,
+	}
+
+	for _, ov := range result.expired {
+		d.Delete = append(d.Delete, Version{ov})
+	}
+
+	for _, req := range result.retention {
+		d.Extend = append(d.Extend, Extension{
+			Version: Version{req.object},
+			Until:   req.until,
+		})
+	}
+
+	return d
+}
+
+// newSeries returns the policy view of a version series.
+func newSeries(key string, s *versionSeries, now time.Time) Series {
+	result := Series{
+		Key:        key,
+		Versions:   make([]Version, len(s.items)),
+		HaveLatest: s.haveLatest,
+		Now:        now,
+	}
+
+	for idx, ov := range s.items {
+		result.Versions[idx] = Version{ov}
+	}
+
+	return result
+}
+
+// result converts a decision for the series into the requests for the
+// pipeline. Versions are looked up in the series so that the requests are
+// based on the listed versions.
+func (d Decision) result(s Series) (versionSeriesResult, error) {
+	result := versionSeriesResult{
+		due:   d.Due,
+		rules: d.rules,
+	}
+
+	versions := make(map[string]objectVersion, len(s.Versions))
+
+	for _, v := range s.Versions {
+		versions[v.ov.versionID] = v.ov
+	}
+
+	lookup := func(v Version) (objectVersion, error) {
+		ov, ok := versions[v.ov.versionID]
+		if !ok || v.ov.key != s.Key {
+			return ov, fmt.Errorf("%w: version %q of key %q is not part of the series of %q", ErrInvalidDecision, v.ov.versionID, v.ov.key, s.Key)
+		}
+
+		return ov, nil
+	}
+
+	if len(d.Delete) > 0 && !s.HaveLatest {
+		return versionSeriesResult{}, fmt.Errorf("%w: versions of key %q are deleted without knowing its latest version", ErrInvalidDecision, s.Key)
+	}
+
+	deleted := map[string]bool{}
+
+	for _, v := range d.Delete {
+		ov, err := lookup(v)
+		if err != nil {
+			return versionSeriesResult{}, err
+		}
+
+		if deleted[ov.versionID] {
+			return versionSeriesResult{}, fmt.Errorf("%w: version %q of key %q is deleted more than once", ErrInvalidDecision, ov.versionID, ov.key)
+		}
+
+		// Deleting a latest delete marker restores the preceding version.
+		if ov.isLatest && !ov.deleteMarker {
+			return versionSeriesResult{}, fmt.Errorf("%w: version %q of key %q is deleted, but it's the latest version", ErrInvalidDecision, ov.versionID, ov.key)
+		}
+
+		deleted[ov.versionID] = true
+
+		result.expired = append(result.expired, ov)
+	}
+
+	for _, e := range d.Extend {
+		ov, err := lookup(e.Version)
+		if err != nil {
+			return versionSeriesResult{}, err
+		}
+
+		if deleted[ov.versionID] {
+			return versionSeriesResult{}, fmt.Errorf("%w: version %q of key %q is both deleted and extended", ErrInvalidDecision, ov.versionID, ov.key)
+		}
+
+		if ov.deleteMarker || !(ov.retainUntil.IsZero() || ov.retainUntil.Before(e.Until)) {
+			continue
+		}
+
+		result.retention = append(result.retention, retentionExtenderRequest{
+			object: ov,
+			until:  e.Until,
+		})
+	}
+
+	if len(result.expired) > 0 {
+		// Deletions may fail.
+		result.due = time.Time{}
+	}
+
+	return result, nil
+}
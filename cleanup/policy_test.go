@@ -0,0 +1,261 @@
+package cleanup
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestDefaultPolicy(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	var s versionSeries
+
+	s.add(objectVersion{key: "key", versionID: "old", lastModified: now.Add(-72 * time.Hour)})
+	s.add(objectVersion{key: "key", versionID: "mid", lastModified: now.Add(-48 * time.Hour)})
+	s.add(objectVersion{key: "key", versionID: "new", lastModified: now.Add(-time.Hour), isLatest: true})
+
+	opts := versionSeriesFinalizeOptions{
+		now:            now,
+		minDeletionAge: 24 * time.Hour,
+		minRetention:   24 * time.Hour,
+	}
+
+	want := s.finalize(opts)
+
+	series := newSeries("key", &s, now)
+
+	got, err := DefaultPolicy(Options{
+		MinDeletionAge: opts.minDeletionAge,
+		MinRetention:   opts.minRetention,
+	}).Decide(series).result(series)
+	if err != nil {
+		t.Fatalf("result() failed: %v", err)
+	}
+
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(versionSeriesResult{}, objectVersion{}, retentionExtenderRequest{}), cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("Result diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestDecisionResult(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	marker := Version{objectVersion{key: "key", versionID: "marker", deleteMarker: true, isLatest: true}}
+	retained := Version{objectVersion{key: "key", versionID: "retained", retainUntil: now.Add(time.Hour)}}
+	plain := Version{objectVersion{key: "key", versionID: "plain"}}
+
+	series := Series{
+		Key:        "key",
+		Versions:   []Version{plain, retained, marker},
+		HaveLatest: true,
+	}
+
+	got, err := Decision{
+		Delete: []Version{plain},
+		Extend: []Extension{
+			{Version: marker, Until: now},
+			{Version: retained, Until: now},
+			{Version: retained, Until: now.Add(2 * time.Hour)},
+		},
+		Due: now,
+	}.result(series)
+	if err != nil {
+		t.Fatalf("result() failed: %v", err)
+	}
+
+	var gotExtended []string
+
+	for _, req := range got.retention {
+		gotExtended = append(gotExtended, req.object.versionID)
+	}
+
+	if diff := cmp.Diff([]string{"retained"}, gotExtended); diff != "" {
+		t.Errorf("Extended versions diff (-want +got):\n%s", diff)
+	}
+
+	if !got.due.IsZero() {
+		t.Errorf("Due time %v with pending deletions, want zero", got.due)
+	}
+}
+
+func TestDecisionResultLatestDeleteMarker(t *testing.T) {
+	marker := Version{objectVersion{key: "key", versionID: "marker", deleteMarker: true, isLatest: true}}
+
+	got, err := Decision{Delete: []Version{marker}}.result(Series{
+		Key:        "key",
+		Versions:   []Version{marker},
+		HaveLatest: true,
+	})
+	if err != nil {
+		t.Fatalf("result() failed: %v", err)
+	}
+
+	if len(got.expired) != 1 {
+		t.Errorf("Expired %d versions, want the delete marker", len(got.expired))
+	}
+}
+
+func TestDecisionResultInvalid(t *testing.T) {
+	listed := Version{objectVersion{key: "key", versionID: "listed"}}
+	latest := Version{objectVersion{key: "key", versionID: "latest", isLatest: true}}
+
+	series := Series{
+		Key:        "key",
+		Versions:   []Version{listed, latest},
+		HaveLatest: true,
+	}
+
+	for _, tc := range []struct {
+		name          string
+		decision      Decision
+		withoutLatest bool
+	}{
+		{
+			name: "unknown version",
+			decision: Decision{
+				Delete: []Version{{objectVersion{key: "key", versionID: "other"}}},
+			},
+		},
+		{
+			name: "other key",
+			decision: Decision{
+				Delete: []Version{{objectVersion{key: "other", versionID: "listed"}}},
+			},
+		},
+		{
+			name: "extension of unknown version",
+			decision: Decision{
+				Extend: []Extension{{Version: Version{objectVersion{key: "key", versionID: "other"}}}},
+			},
+		},
+		{
+			name: "repeated deletion",
+			decision: Decision{
+				Delete: []Version{listed, listed},
+			},
+		},
+		{
+			name: "deleted and extended",
+			decision: Decision{
+				Delete: []Version{listed},
+				Extend: []Extension{{Version: listed, Until: time.Now().Add(time.Hour)}},
+			},
+		},
+		{
+			name: "latest version",
+			decision: Decision{
+				Delete: []Version{latest},
+			},
+		},
+		{
+			name: "without latest",
+			decision: Decision{
+				Delete: []Version{listed},
+			},
+			withoutLatest: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := series
+
+			if tc.withoutLatest {
+				s.Versions = []Version{listed}
+				s.HaveLatest = false
+			}
+
+			if _, err := tc.decision.result(s); !errors.Is(err, ErrInvalidDecision) {
+				t.Errorf("result() returned %v, want %v", err, ErrInvalidDecision)
+			}
+		})
+	}
+}
+
+func TestProcessorPolicy(t *testing.T) {
+	now := time.Now()
+
+	var gotSeries []Series
+
+	// Delete all noncurrent versions regardless of their age.
+	policy := PolicyFunc(func(s Series) Decision {
+		gotSeries = append(gotSeries, s)
+
+		var d Decision
+
+		for _, v := range s.Versions {
+			if !v.IsLatest() {
+				d.Delete = append(d.Delete, v)
+			}
+		}
+
+		return d
+	})
+
+	p := newProcessor(processorOptions{
+		stats:          NewStats(),
+		minDeletionAge: 24 * time.Hour,
+		policy:         policy,
+	})
+
+	in := make(chan objectVersion, 8)
+	retentionCh := make(chan retentionExtenderRequest, 8)
+	deleteCh := make(chan objectVersion, 8)
+
+	in <- objectVersion{key: "key", versionID: "new", lastModified: now.Add(-time.Minute), isLatest: true}
+	in <- objectVersion{key: "key", versionID: "old", lastModified: now.Add(-time.Hour)}
+	close(in)
+
+	if err := p.run(in, retentionCh, deleteCh); err != nil {
+		t.Errorf("run() failed: %v", err)
+	}
+
+	if len(gotSeries) != 1 {
+		t.Fatalf("Policy called %d times, want 1", len(gotSeries))
+	}
+
+	if s := gotSeries[0]; s.Key != "key" || !s.HaveLatest || len(s.Versions) != 2 || s.Versions[0].VersionID() != "old" {
+		t.Errorf("Unexpected series %+v", s)
+	}
+
+	if len(deleteCh) != 1 {
+		t.Fatalf("Got %d expired versions, want 1", len(deleteCh))
+	}
+
+	if got := <-deleteCh; got.versionID != "old" {
+		t.Errorf("Expired version %q, want old", got.versionID)
+	}
+}
+
+func TestProcessorPolicyInvalidDecision(t *testing.T) {
+	now := time.Now()
+
+	// Refers to a version of another key.
+	policy := PolicyFunc(func(s Series) Decision {
+		return Decision{
+			Delete: []Version{{objectVersion{key: "other", versionID: "v1"}}},
+		}
+	})
+
+	p := newProcessor(processorOptions{
+		stats:  NewStats(),
+		policy: policy,
+	})
+
+	in := make(chan objectVersion, 8)
+	retentionCh := make(chan retentionExtenderRequest, 8)
+	deleteCh := make(chan objectVersion, 8)
+
+	in <- objectVersion{key: "key", versionID: "v1", lastModified: now.Add(-time.Hour), isLatest: true}
+	close(in)
+
+	if err := p.run(in, retentionCh, deleteCh); !errors.Is(err, ErrInvalidDecision) {
+		t.Errorf("run() returned %v, want %v", err, ErrInvalidDecision)
+	}
+
+	if len(deleteCh) != 0 {
+		t.Errorf("Got %d expired versions, want none", len(deleteCh))
+	}
+}
@@ -0,0 +1,108 @@
+package cleanup
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// backupPreset lists the structural keys of a backup repository layout.
+// Losing older versions of them can render a repository unusable even if all
+// data blobs survive, e.g. after an attacker or a faulty client overwrote
+// them.
+type backupPreset struct {
+	name    string
+	entries []string
+}
+
+var (
+	resticPresetEntries = []string{
+		"config",
+		"keys/*",
+		"index/*",
+		"snapshots/*",
+	}
+
+	kopiaPresetEntries = []string{
+		"kopia.repository",
+		"kopia.blobcfg",
+		"kopia.maintenance",
+	}
+)
+
+var backupPresets = []backupPreset{
+	{
+		name:    "restic",
+		entries: resticPresetEntries,
+	},
+	{
+		// Both the borg 1.x repository format, usually synchronized to S3
+		// using rclone, and the borgstore layout of borg 2.
+		name: "borg",
+		entries: []string{
+			"README",
+			"config",
+			"nonce",
+			"hints.*",
+			"index.*",
+			"integrity.*",
+			"config/*",
+			"keys/*",
+			"index/*",
+		},
+	},
+	{
+		// Backup metadata and the file-system backup repositories managed
+		// by Velero using either kopia or restic.
+		name: "velero",
+		entries: slices.Concat([]string{
+			"velero-backup.json",
+			"metadata/revision",
+		}, kopiaPresetEntries, resticPresetEntries),
+	},
+	{
+		name: "pgbackrest",
+		entries: []string{
+			"archive.info",
+			"archive.info.copy",
+			"backup.info",
+			"backup.info.copy",
+			"backup.manifest",
+			"backup.manifest.copy",
+		},
+	},
+}
+
+// PresetNames returns the names of all backup repository presets.
+func PresetNames() []string {
+	var names []string
+
+	for _, p := range backupPresets {
+		names = append(names, p.name)
+	}
+
+	return names
+}
+
+// AddPreset adds the structural keys of a backup repository layout. Preset
+// entries match at any depth, allowing for repositories below a prefix.
+func (m *KeyManifest) AddPreset(name string) error {
+	for _, p := range backupPresets {
+		if !strings.EqualFold(p.name, name) {
+			continue
+		}
+
+		if m.nested == nil {
+			m.nested = NewKeyManifest()
+		}
+
+		for _, entry := range p.entries {
+			m.nested.add(entry)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("%w: unknown preset %q (known: %s)", os.ErrInvalid, name, strings.Join(PresetNames(), ", "))
+}
@@ -0,0 +1,122 @@
+package cleanup
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/hansmi/s3-object-cleanup/internal/state"
+)
+
+// estimateVersionCount returns the number of object versions processed by the
+// most recent complete run. Zero is returned if there is none.
+func estimateVersionCount(history []state.RunStats) int64 {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Complete {
+			return history[i].Counters["total.count"]
+		}
+	}
+
+	return 0
+}
+
+type progressReporterOptions struct {
+	logger *slog.Logger
+	stats  *Stats
+
+	// Time between progress records.
+	interval time.Duration
+
+	// Expected number of object versions, e.g. from a previous run. Used
+	// for estimating the remaining time. Unknown if zero.
+	estimate int64
+}
+
+// progressReporter periodically logs the progress of a cleanup run.
+type progressReporter struct {
+	logger   *slog.Logger
+	stats    *Stats
+	interval time.Duration
+	estimate int64
+
+	started time.Time
+	before  map[string]int64
+}
+
+func newProgressReporter(opts progressReporterOptions) *progressReporter {
+	if opts.logger == nil {
+		opts.logger = slog.Default()
+	}
+
+	return &progressReporter{
+		logger:   opts.logger,
+		stats:    opts.stats,
+		interval: opts.interval,
+		estimate: opts.estimate,
+		started:  time.Now(),
+		before:   opts.stats.Counters(),
+	}
+}
+
+func (r *progressReporter) attrs(now time.Time) []slog.Attr {
+	counters := r.stats.CountersSince(r.before)
+	elapsed := now.Sub(r.started)
+	processed := counters["total.count"]
+
+	var rate float64
+
+	if elapsed > 0 {
+		rate = float64(processed) / elapsed.Seconds()
+	}
+
+	attrs := []slog.Attr{
+		slog.Int64("listed", counters["listed.count"]),
+		slog.Int64("processed", processed),
+		slog.Int64("deleted", counters["delete.success_count"]),
+		slog.Int64("retention_extended", counters["retention.success_count"]),
+		slog.Duration("elapsed", elapsed.Round(time.Second)),
+		slog.Float64("rate_per_second", rate),
+	}
+
+	if r.estimate > 0 {
+		attrs = append(attrs,
+			slog.Int64("estimate", r.estimate),
+			slog.Float64("percent", min(100, 100*float64(processed)/float64(r.estimate))),
+		)
+
+		if remaining := r.estimate - processed; remaining > 0 && rate > 0 {
+			eta := time.Duration(float64(remaining) / rate * float64(time.Second))
+
+			attrs = append(attrs, slog.Duration("eta", eta.Round(time.Second)))
+		}
+	}
+
+	return attrs
+}
+
+// start logs progress records until the returned function is invoked.
+func (r *progressReporter) start(ctx context.Context) func() {
+	ctx, cancel := context.WithCancel(ctx)
+
+	var wg sync.WaitGroup
+
+	wg.Go(func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				r.logger.LogAttrs(ctx, slog.LevelInfo, "Progress", r.attrs(now)...)
+			}
+		}
+	})
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
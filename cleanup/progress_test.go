@@ -0,0 +1,134 @@
+package cleanup
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hansmi/s3-object-cleanup/internal/state"
+)
+
+func TestEstimateVersionCount(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		history []state.RunStats
+		want    int64
+	}{
+		{name: "empty"},
+		{
+			name: "latest",
+			history: []state.RunStats{
+				{Counters: map[string]int64{"total.count": 10}, Complete: true},
+				{Counters: map[string]int64{"total.count": 20}, Complete: true},
+			},
+			want: 20,
+		},
+		{
+			name: "skip failed",
+			history: []state.RunStats{
+				{Counters: map[string]int64{"total.count": 10}, Complete: true},
+				{Counters: map[string]int64{"total.count": 3}, Failed: true},
+			},
+			want: 10,
+		},
+		{
+			name: "skip partial",
+			history: []state.RunStats{
+				{Counters: map[string]int64{"total.count": 10}, Complete: true},
+				{Counters: map[string]int64{"total.count": 4}},
+			},
+			want: 10,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := estimateVersionCount(tc.history); got != tc.want {
+				t.Errorf("estimateVersionCount() = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestProgressReporterAttrs(t *testing.T) {
+	stats := NewStats()
+
+	// Counted before the reporter started.
+	stats.discovered(objectVersion{})
+
+	r := newProgressReporter(progressReporterOptions{
+		stats:    stats,
+		estimate: 40,
+	})
+
+	stats.addListed(12)
+
+	for range 10 {
+		stats.discovered(objectVersion{})
+	}
+
+	stats.addDeleteResults(3, 1)
+
+	got := map[string]string{}
+
+	for _, attr := range r.attrs(r.started.Add(5 * time.Second)) {
+		got[attr.Key] = attr.Value.String()
+	}
+
+	want := map[string]string{
+		"listed":             "12",
+		"processed":          "10",
+		"deleted":            "3",
+		"retention_extended": "0",
+		"elapsed":            "5s",
+		"rate_per_second":    "2",
+		"estimate":           "40",
+		"percent":            "25",
+		"eta":                "15s",
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("attrs() diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestProgressReporterStart(t *testing.T) {
+	var buf syncBuffer
+
+	r := newProgressReporter(progressReporterOptions{
+		logger:   slog.New(slog.NewTextHandler(&buf, nil)),
+		stats:    NewStats(),
+		interval: time.Millisecond,
+	})
+
+	stop := r.start(t.Context())
+
+	time.Sleep(20 * time.Millisecond)
+
+	stop()
+
+	if got := buf.String(); !strings.Contains(got, "msg=Progress") {
+		t.Errorf("No progress record logged: %q", got)
+	}
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
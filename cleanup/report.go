@@ -1,4 +1,4 @@
-package main
+package cleanup
 
 import (
 	"archive/tar"
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path/filepath"
 	"slices"
@@ -70,17 +71,19 @@ type reportObject struct {
 	actionData string
 }
 
-type reportBuilder struct {
+// ReportBuilder collects all discovered versions of a bucket together with
+// the actions taken.
+type ReportBuilder struct {
 	objects map[reportObjectKey]*reportObject
 }
 
-func newReportBuilder() *reportBuilder {
-	return &reportBuilder{
+func NewReportBuilder() *ReportBuilder {
+	return &ReportBuilder{
 		objects: map[reportObjectKey]*reportObject{},
 	}
 }
 
-func (b *reportBuilder) discovered(ov objectVersion) error {
+func (b *ReportBuilder) discovered(ov objectVersion) error {
 	key := ov.reportKey()
 
 	if _, ok := b.objects[key]; ok {
@@ -100,7 +103,7 @@ func (b *reportBuilder) discovered(ov objectVersion) error {
 	return nil
 }
 
-func (b *reportBuilder) addExpired(versions []objectVersion) {
+func (b *ReportBuilder) addExpired(versions []objectVersion) {
 	for _, ov := range versions {
 		key := ov.reportKey()
 
@@ -108,7 +111,7 @@ func (b *reportBuilder) addExpired(versions []objectVersion) {
 	}
 }
 
-func (b *reportBuilder) addRetention(versions []retentionExtenderRequest) {
+func (b *ReportBuilder) addRetention(versions []retentionExtenderRequest) {
 	for _, req := range versions {
 		key := req.object.reportKey()
 
@@ -118,7 +121,7 @@ func (b *reportBuilder) addRetention(versions []retentionExtenderRequest) {
 	}
 }
 
-func (b *reportBuilder) writeTo(w io.Writer) error {
+func (b *ReportBuilder) writeTo(w io.Writer) error {
 	type row struct {
 		*reportObjectKey
 		*reportObject
@@ -169,23 +172,26 @@ func (b *reportBuilder) writeTo(w io.Writer) error {
 	return cw.Error()
 }
 
-type reportGroup struct {
+// ReportGroup writes the reports of multiple buckets to a temporary
+// directory for archiving.
+type ReportGroup struct {
 	dir string
 }
 
-func newReportGroup(parent string) (*reportGroup, error) {
+func NewReportGroup(parent string) (*ReportGroup, error) {
 	dir, err := os.MkdirTemp(parent, "report*")
 	if err != nil {
 		return nil, err
 	}
 
-	return &reportGroup{
+	return &ReportGroup{
 		dir: dir,
 	}, nil
 }
 
-func (g *reportGroup) add(name string, b *reportBuilder) (err error) {
-	dest := filepath.Join(g.dir, fmt.Sprintf("%s.csv", name))
+func (g *ReportGroup) Add(name string, b *ReportBuilder) (err error) {
+	// Access point ARNs contain slashes.
+	dest := filepath.Join(g.dir, fmt.Sprintf("%s.csv", url.PathEscape(name)))
 
 	f, err := os.Create(dest)
 	if err != nil {
@@ -199,7 +205,7 @@ func (g *reportGroup) add(name string, b *reportBuilder) (err error) {
 	return b.writeTo(f)
 }
 
-func (g *reportGroup) writeArchive(tmpdir string) (io.ReadCloser, error) {
+func (g *ReportGroup) writeArchive(tmpdir string) (io.ReadCloser, error) {
 	tmpfile, err := state.CreateUnlinkedTemp(tmpdir, "report*")
 	if err != nil {
 		return nil, err
@@ -230,7 +236,8 @@ func (g *reportGroup) writeArchive(tmpdir string) (io.ReadCloser, error) {
 	return tmpfile, nil
 }
 
-func uploadReportsToBucket(ctx context.Context, g *reportGroup, tmpdir string, c *client.Client, key string) (err error) {
+// UploadReportsToBucket uploads a gzip-compressed tar archive of the reports.
+func UploadReportsToBucket(ctx context.Context, g *ReportGroup, tmpdir string, c *client.Client, key string) (err error) {
 	f, err := g.writeArchive(tmpdir)
 	if err != nil {
 		return err
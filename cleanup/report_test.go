@@ -1,4 +1,4 @@
-package main
+package cleanup
 
 import (
 	"archive/tar"
@@ -56,7 +56,7 @@ func TestReport(t *testing.T) {
 		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
-			b := newReportBuilder()
+			b := NewReportBuilder()
 
 			for _, ov := range tc.objects {
 				if err := b.discovered(ov); err != nil {
@@ -83,7 +83,7 @@ func TestReport(t *testing.T) {
 }
 
 func TestReportGroup(t *testing.T) {
-	g, err := newReportGroup(t.TempDir())
+	g, err := NewReportGroup(t.TempDir())
 	if err != nil {
 		t.Errorf("newReportBuilder(): %v", err)
 	}
@@ -98,11 +98,15 @@ func TestReportGroup(t *testing.T) {
 	}
 
 	for i := range 10 {
-		if err := g.add(fmt.Sprintf("report%d", i), newReportBuilder()); err != nil {
+		if err := g.Add(fmt.Sprintf("report%d", i), NewReportBuilder()); err != nil {
 			t.Errorf("add(): %v", err)
 		}
 	}
 
+	if err := g.Add("arn:aws:s3:us-west-2:123456789012:accesspoint/ap", NewReportBuilder()); err != nil {
+		t.Errorf("add(): %v", err)
+	}
+
 	f, err = g.writeArchive(t.TempDir())
 	if err != nil {
 		t.Errorf("writeArchive(): %v", err)
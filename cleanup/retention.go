@@ -0,0 +1,322 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// ErrRetentionBeyondHorizon is returned for retention dates further in the
+// future than the configured horizon.
+var ErrRetentionBeyondHorizon = errors.New("retention beyond horizon")
+
+type retentionExtenderState interface {
+	SetObjectRetention(string, string, time.Time) error
+}
+
+type retentionExtenderClient interface {
+	PutObjectRetention(context.Context, string, string, time.Time) error
+}
+
+type retentionExtenderRequest struct {
+	object objectVersion
+	until  time.Time
+
+	// Notified once the request has been processed, successfully or not.
+	// Optional.
+	barrier *retentionBarrier
+}
+
+type retentionExtender struct {
+	logger       *slog.Logger
+	stats        *Stats
+	state        retentionExtenderState
+	client       retentionExtenderClient
+	plan         *PlanRecorder
+	actions      *ActionRecorder
+	backoff      *adaptiveBackoff
+	errorGuard   *errorRatioGuard
+	workers      int
+	tuner        *workerTuner
+	timer        *stageTimer
+	watermark    *listWatermark
+	now          time.Time
+	minRemaining time.Duration
+	jitter       time.Duration
+	seed         uint64
+	maxHorizon   time.Duration
+	clampHorizon bool
+	dryRun       bool
+}
+
+type retentionExtenderOptions struct {
+	logger *slog.Logger
+	stats  *Stats
+	state  retentionExtenderState
+	client retentionExtenderClient
+	dryRun bool
+
+	// Records planned retention extensions if set.
+	plan *PlanRecorder
+
+	// Records extended and skipped versions if set.
+	actions *ActionRecorder
+
+	// Shared backoff for API requests. A private instance is used if nil.
+	backoff *adaptiveBackoff
+
+	errorGuard *errorRatioGuard
+
+	// Current time for computations. Defaults to [time.Now()].
+	now time.Time
+
+	// Update retention when it's missing or the remaining duration is less
+	// than minRemaining.
+	minRemaining time.Duration
+
+	// Extend retention by a random amount of time up to the given duration
+	// beyond the requested time. Spreads the expiration of versions
+	// extended in the same run.
+	jitter time.Duration
+
+	// Seed from which the jitter of each version is derived. The same seed
+	// reproduces the same retention dates regardless of the order in which
+	// versions are processed.
+	seed uint64
+
+	// Retention dates beyond the given duration from now are rejected. A
+	// mistake in the configuration or the computation could otherwise lock
+	// versions for practically forever, which can't be undone in compliance
+	// mode. Disabled if zero.
+	maxHorizon time.Duration
+
+	// Shorten retention dates beyond maxHorizon to the horizon instead of
+	// rejecting them.
+	clampHorizon bool
+
+	// Adapts the number of concurrently active workers. A fixed number of
+	// workers is used if nil.
+	tuner *workerTuner
+
+	// Measures the time spent processing items. Disabled if nil.
+	timer *stageTimer
+
+	// Tracks the processing of listed keys for resuming the listing.
+	// Disabled if nil.
+	watermark *listWatermark
+}
+
+func newRetentionExtender(opts retentionExtenderOptions) *retentionExtender {
+	if opts.now.IsZero() {
+		opts.now = time.Now()
+	}
+
+	if opts.backoff == nil {
+		opts.backoff = newAdaptiveBackoff(opts.stats)
+	}
+
+	return &retentionExtender{
+		logger:       opts.logger,
+		stats:        opts.stats,
+		state:        opts.state,
+		client:       opts.client,
+		plan:         opts.plan,
+		actions:      opts.actions,
+		backoff:      opts.backoff,
+		errorGuard:   opts.errorGuard,
+		dryRun:       opts.dryRun,
+		now:          opts.now,
+		minRemaining: max(0, opts.minRemaining),
+		jitter:       max(0, opts.jitter),
+		seed:         opts.seed,
+		maxHorizon:   max(0, opts.maxHorizon),
+		clampHorizon: opts.clampHorizon,
+		workers:      opts.tuner.workers(),
+		tuner:        opts.tuner,
+		timer:        opts.timer,
+		watermark:    opts.watermark,
+	}
+}
+
+// jitterFor returns the random extension of the given version, derived from
+// the seed and the identity of the version.
+func (e *retentionExtender) jitterFor(ov objectVersion) time.Duration {
+	h := fnv.New64a()
+	h.Write([]byte(ov.key))
+	h.Write([]byte{0})
+	h.Write([]byte(ov.versionID))
+
+	r := rand.New(rand.NewPCG(e.seed, h.Sum64()))
+
+	return time.Duration(r.Int64N(int64(e.jitter)))
+}
+
+func (e *retentionExtender) process(ctx context.Context, req retentionExtenderRequest) error {
+	if req.object.deleteMarker {
+		// Delete markers don't support retention periods.
+		return nil
+	}
+
+	if req.until.IsZero() {
+		return fmt.Errorf("%w: missing retention time", os.ErrInvalid)
+	}
+
+	if e.jitter > 0 {
+		req.until = req.until.Add(e.jitterFor(req.object)).Truncate(time.Second)
+	}
+
+	if e.maxHorizon > 0 {
+		if horizon := e.now.Add(e.maxHorizon); req.until.After(horizon) {
+			e.stats.addRetentionBeyondHorizon()
+
+			if !e.clampHorizon {
+				return fmt.Errorf("%w: retention until %v exceeds %v", ErrRetentionBeyondHorizon,
+					req.until.Format(time.RFC3339), horizon.Format(time.RFC3339))
+			}
+
+			e.logger.WarnContext(ctx, "Retention clamped to horizon",
+				slog.Any("object", req.object),
+				slog.Time("requested", req.until),
+				slog.Time("horizon", horizon))
+
+			req.until = horizon
+		}
+	}
+
+	logAttr := []any{
+		slog.Any("object", req.object),
+		slog.Time("until", req.until),
+	}
+
+	if !req.object.retainUntil.IsZero() {
+		remaining := req.object.retainUntil.Sub(e.now).Truncate(time.Second)
+
+		if req.until.Before(req.object.retainUntil) {
+			// Avoid shortening retention period.
+			if e.actions != nil {
+				e.actions.addSkip(req.object, actionReasonRetentionLonger)
+			}
+
+			return nil
+		}
+
+		if remaining > e.minRemaining {
+			// Enough retention left.
+			if e.actions != nil {
+				e.actions.addSkip(req.object, actionReasonRetentionEnough)
+			}
+
+			return nil
+		}
+
+		after := req.until.Sub(e.now).Truncate(time.Second)
+
+		logAttr = append(logAttr, slog.Group("remaining",
+			slog.String("original", remaining.String()),
+			slog.String("after", after.String()),
+		))
+	}
+
+	e.logger.InfoContext(ctx, "Retain", logAttr...)
+
+	e.stats.addRetention(req.object)
+
+	if e.plan != nil {
+		e.plan.addRetention(req)
+	}
+
+	if e.dryRun {
+		if e.actions != nil {
+			e.actions.addRetention(req, true, nil)
+		}
+
+		return nil
+	}
+
+	ov := req.object
+
+	err := e.backoff.do(ctx, func() error {
+		return e.client.PutObjectRetention(ctx, ov.key, ov.versionID, req.until)
+	})
+
+	if e.actions != nil {
+		var failure *actionError
+
+		if err != nil {
+			failure = newActionError(err)
+		}
+
+		e.actions.addRetention(req, false, failure)
+	}
+
+	if err != nil {
+		return fmt.Errorf("setting object retention via API: %w", err)
+	}
+
+	if err := e.state.SetObjectRetention(ov.key, ov.stateVersionID(), req.until); err != nil {
+		return fmt.Errorf("setting object retention in state: %w", err)
+	}
+
+	return nil
+}
+
+// run sets the retention time on objects received via the incoming channel.
+func (e *retentionExtender) run(ctx context.Context, in <-chan retentionExtenderRequest) error {
+	g, ctx := errgroup.WithContext(ctx)
+
+	var panicked workerPanic
+
+	for range max(1, e.workers) {
+		g.Go(func() error {
+			for req := range in {
+				if err := ctx.Err(); err != nil {
+					// Drain input after cancellation.
+					req.barrier.complete(err)
+					continue
+				}
+
+				release, err := e.tuner.acquire(ctx)
+				if err != nil {
+					// Cancelled while waiting.
+					req.barrier.complete(err)
+					continue
+				}
+
+				done := e.timer.track(stageRetention)
+				err = recoverItem(e.logger, stageRetention, func() error {
+					return e.process(ctx, req)
+				})
+				done()
+				release()
+
+				req.barrier.complete(err)
+
+				if ctx.Err() == nil {
+					e.watermark.done(req.object.key, 1)
+				}
+
+				if err != nil {
+					e.logger.Error("Retention extension failed",
+						slog.Any("request", req),
+						slog.Any("error", err))
+					e.stats.addRetentionError()
+					e.stats.addError(err)
+					e.errorGuard.addErrors(1)
+					panicked.add(err)
+					continue
+				}
+			}
+
+			return nil
+		})
+	}
+
+	return panicked.wait(g)
+}
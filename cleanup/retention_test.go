@@ -1,7 +1,8 @@
-package main
+package cleanup
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"log/slog"
 	"os"
@@ -37,6 +38,8 @@ func TestRetentionProcess(t *testing.T) {
 		name         string
 		req          retentionExtenderRequest
 		minRemaining time.Duration
+		maxHorizon   time.Duration
+		clampHorizon bool
 		want         []time.Time
 		wantErr      error
 	}{
@@ -103,6 +106,35 @@ func TestRetentionProcess(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "within horizon",
+			req: retentionExtenderRequest{
+				until: time.Date(2015, time.January, 10, 0, 0, 0, 0, time.UTC),
+			},
+			maxHorizon: 10 * 24 * time.Hour,
+			want: []time.Time{
+				time.Date(2015, time.January, 10, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "beyond horizon",
+			req: retentionExtenderRequest{
+				until: time.Date(2115, time.January, 10, 0, 0, 0, 0, time.UTC),
+			},
+			maxHorizon: 10 * 365 * 24 * time.Hour,
+			wantErr:    ErrRetentionBeyondHorizon,
+		},
+		{
+			name: "clamped to horizon",
+			req: retentionExtenderRequest{
+				until: time.Date(2115, time.January, 10, 0, 0, 0, 0, time.UTC),
+			},
+			maxHorizon:   10 * 24 * time.Hour,
+			clampHorizon: true,
+			want: []time.Time{
+				time.Date(2015, time.January, 11, 0, 0, 0, 0, time.UTC),
+			},
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			state := newRetentionStateForTest(t)
@@ -110,11 +142,13 @@ func TestRetentionProcess(t *testing.T) {
 
 			opts := retentionExtenderOptions{
 				logger:       logger,
-				stats:        newCleanupStats(),
+				stats:        NewStats(),
 				state:        state,
 				client:       &client,
 				now:          now,
 				minRemaining: tc.minRemaining,
+				maxHorizon:   tc.maxHorizon,
+				clampHorizon: tc.clampHorizon,
 			}
 
 			err := newRetentionExtender(opts).process(t.Context(), tc.req)
@@ -134,7 +168,7 @@ func TestRetentionProcess(t *testing.T) {
 					wantState = tc.want[len(tc.want)-1]
 				}
 
-				if gotState, err := state.GetObjectRetention(tc.req.object.key, tc.req.object.versionID); err != nil {
+				if gotState, _, err := state.GetObjectRetention(tc.req.object.key, tc.req.object.versionID); err != nil {
 					t.Errorf("GetObjectRetention() failed: %v", err)
 				} else if diff := cmp.Diff(wantState, gotState); diff != "" {
 					t.Errorf("GetObjectRetention() diff (-want +got):\n%s", diff)
@@ -152,7 +186,7 @@ func TestExtenderRun(t *testing.T) {
 
 	opts := retentionExtenderOptions{
 		logger: logger,
-		stats:  newCleanupStats(),
+		stats:  NewStats(),
 		state:  state,
 		client: &client,
 	}
@@ -184,3 +218,75 @@ func TestExtenderRun(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestRetentionProcessJitter(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	const jitter = time.Hour
+
+	until := time.Date(2015, time.January, 10, 0, 0, 0, 0, time.UTC)
+
+	var client fakeExtenderClient
+
+	e := newRetentionExtender(retentionExtenderOptions{
+		logger: logger,
+		stats:  NewStats(),
+		state:  newRetentionStateForTest(t),
+		client: &client,
+		now:    time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC),
+		jitter: jitter,
+	})
+
+	for i := range 100 {
+		if err := e.process(t.Context(), retentionExtenderRequest{
+			object: objectVersion{key: fmt.Sprint(i)},
+			until:  until,
+		}); err != nil {
+			t.Errorf("process() failed: %v", err)
+		}
+	}
+
+	distinct := map[time.Time]struct{}{}
+
+	for _, got := range client.requests {
+		if got.Before(until) || !got.Before(until.Add(jitter)) {
+			t.Errorf("Retention %v outside of [%v, %v)", got, until, until.Add(jitter))
+		}
+
+		distinct[got] = struct{}{}
+	}
+
+	if len(distinct) < 2 {
+		t.Errorf("Jitter produced %d distinct values, want more", len(distinct))
+	}
+}
+
+func TestRetentionJitterSeed(t *testing.T) {
+	newExtender := func(seed uint64) *retentionExtender {
+		return newRetentionExtender(retentionExtenderOptions{
+			jitter: time.Hour,
+			seed:   seed,
+		})
+	}
+
+	first := objectVersion{key: "a", versionID: "v1"}
+	second := objectVersion{key: "a", versionID: "v2"}
+
+	e := newExtender(1)
+
+	if got, want := newExtender(1).jitterFor(first), e.jitterFor(first); got != want {
+		t.Errorf("jitterFor() with same seed = %v, want %v", got, want)
+	}
+
+	// Processing other versions in between doesn't change the result.
+	want := e.jitterFor(second)
+	e.jitterFor(first)
+
+	if got := e.jitterFor(second); got != want {
+		t.Errorf("jitterFor() = %v, want %v", got, want)
+	}
+
+	if e.jitterFor(first) == newExtender(2).jitterFor(first) && e.jitterFor(second) == newExtender(2).jitterFor(second) {
+		t.Errorf("jitterFor() independent of seed")
+	}
+}
@@ -0,0 +1,214 @@
+package cleanup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/hansmi/s3-object-cleanup/internal/state"
+)
+
+// ErrPlanChanged is the cause of runs aborted by Options.RequireReviewedPlan.
+var ErrPlanChanged = errors.New("deletions differ from reviewed plan")
+
+// planDeletionHash returns a hash identifying the deletion of a version. It
+// must remain stable across releases as the hashes are kept in the state.
+func planDeletionHash(ov objectVersion) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(ov.key))
+	h.Write([]byte{0})
+	h.Write([]byte(ov.stateVersionID()))
+
+	return h.Sum64()
+}
+
+// planDigest returns a digest of a sorted set of deletion hashes.
+func planDigest(hashes []uint64) string {
+	h := sha256.New()
+
+	for _, v := range hashes {
+		h.Write(binary.BigEndian.AppendUint64(nil, v))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// planReview collects the deletions of a run. Dry runs only record them. Other
+// runs compare them with the plan reviewed in a dry run and cancel the run
+// once too many deletions weren't part of it. A nil value is valid and admits
+// all deletions.
+type planReview struct {
+	mu           sync.Mutex
+	logger       *slog.Logger
+	cancel       context.CancelCauseFunc
+	reviewed     *state.ReviewedPlan
+	known        map[uint64]struct{}
+	maxDeviation float64
+	planned      []uint64
+	versions     map[uint64]state.ReviewedVersion
+	deviations   int
+	tripped      bool
+}
+
+type planReviewOptions struct {
+	logger *slog.Logger
+	cancel context.CancelCauseFunc
+
+	// Plan recorded by a dry run. Deletions are only recorded if nil.
+	reviewed *state.ReviewedPlan
+
+	// Fraction of the reviewed deletions which may be replaced by other
+	// deletions.
+	maxDeviation float64
+}
+
+func newPlanReview(opts planReviewOptions) *planReview {
+	r := &planReview{
+		logger:       opts.logger,
+		cancel:       opts.cancel,
+		reviewed:     opts.reviewed,
+		maxDeviation: opts.maxDeviation,
+	}
+
+	if opts.reviewed != nil {
+		r.known = make(map[uint64]struct{}, len(opts.reviewed.Deletions))
+
+		for _, h := range opts.reviewed.Deletions {
+			r.known[h] = struct{}{}
+		}
+	} else {
+		r.versions = map[uint64]state.ReviewedVersion{}
+	}
+
+	return r
+}
+
+// verifies reports whether the state of the versions recorded in the reviewed
+// plan is available for detecting drift.
+func (r *planReview) verifies() bool {
+	return r != nil && r.reviewed != nil && r.reviewed.Versions != nil
+}
+
+// drifted reports whether a version changed since its deletion was planned,
+// given its current modification and retention time. Either the version was
+// replaced, e.g. a null version, or its retention was extended in between.
+// Versions not part of the reviewed plan never drift.
+func (r *planReview) drifted(ov objectVersion, lastModified, retainUntil time.Time) bool {
+	if !r.verifies() {
+		return false
+	}
+
+	planned, ok := r.reviewed.Versions[planDeletionHash(ov)]
+	if !ok {
+		return false
+	}
+
+	// Listings report times in milliseconds, headers only in seconds.
+	return !lastModified.Truncate(time.Second).Equal(planned.LastModified.Truncate(time.Second)) ||
+		retainUntil.Truncate(time.Second).After(planned.RetainUntil.Truncate(time.Second))
+}
+
+// admit reports whether the given versions may be deleted.
+func (r *planReview) admit(ctx context.Context, items []objectVersion) bool {
+	if r == nil {
+		return true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.tripped {
+		return false
+	}
+
+	deviations := r.deviations
+
+	for _, ov := range items {
+		h := planDeletionHash(ov)
+
+		r.planned = append(r.planned, h)
+
+		if r.known == nil {
+			r.versions[h] = state.ReviewedVersion{
+				LastModified: ov.lastModified,
+				RetainUntil:  ov.retainUntil,
+			}
+
+			continue
+		}
+
+		if _, ok := r.known[h]; !ok {
+			deviations++
+		}
+	}
+
+	r.deviations = deviations
+
+	if r.reviewed == nil || float64(deviations) <= r.maxDeviation*float64(len(r.reviewed.Deletions)) {
+		return true
+	}
+
+	r.tripped = true
+
+	r.cancel(fmt.Errorf("%w: %d deletions not part of the %d reviewed at %s, run a dry run to review the changes",
+		ErrPlanChanged, deviations, len(r.reviewed.Deletions), r.reviewed.CreatedAt.Format(time.RFC3339)))
+
+	return false
+}
+
+// result returns the deletions collected so far.
+func (r *planReview) result(now time.Time) state.ReviewedPlan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hashes := slices.Clone(r.planned)
+
+	slices.Sort(hashes)
+	hashes = slices.Compact(hashes)
+
+	return state.ReviewedPlan{
+		Digest:    planDigest(hashes),
+		Deletions: hashes,
+		Versions:  maps.Clone(r.versions),
+		CreatedAt: now,
+	}
+}
+
+// finish records the plan of a dry run or consumes the reviewed plan after
+// it was applied.
+func (r *planReview) finish(ctx context.Context, bucketState *state.Bucket, now time.Time) error {
+	if r == nil {
+		return nil
+	}
+
+	plan := r.result(now)
+
+	if r.reviewed == nil {
+		if err := bucketState.SetReviewedPlan(plan); err != nil {
+			return err
+		}
+
+		r.logger.InfoContext(ctx, "Recorded plan for review",
+			slog.String("digest", plan.Digest),
+			slog.Int("deletions", len(plan.Deletions)))
+
+		return nil
+	}
+
+	r.logger.InfoContext(ctx, "Applied reviewed plan",
+		slog.String("digest", plan.Digest),
+		slog.String("reviewed_digest", r.reviewed.Digest),
+		slog.Bool("identical", plan.Digest == r.reviewed.Digest),
+		slog.Int("deviations", r.deviations))
+
+	return bucketState.DeleteReviewedPlan()
+}
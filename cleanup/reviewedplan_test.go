@@ -0,0 +1,327 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/hansmi/s3-object-cleanup/internal/fakes3"
+	"github.com/hansmi/s3-object-cleanup/internal/state"
+)
+
+func TestPlanReview(t *testing.T) {
+	versions := func(keys ...string) []objectVersion {
+		var result []objectVersion
+
+		for _, key := range keys {
+			result = append(result, objectVersion{key: key, versionID: "v1"})
+		}
+
+		return result
+	}
+
+	var cause error
+
+	recorder := newPlanReview(planReviewOptions{
+		logger: slog.New(slog.DiscardHandler),
+	})
+
+	for _, items := range [][]objectVersion{versions("a", "b"), versions("c", "d", "a")} {
+		if !recorder.admit(t.Context(), items) {
+			t.Errorf("Recording plan didn't admit %v", items)
+		}
+	}
+
+	now := time.Date(2001, time.February, 3, 4, 5, 6, 0, time.UTC)
+	reviewed := recorder.result(now)
+
+	if got := len(reviewed.Deletions); got != 4 {
+		t.Errorf("Plan contains %d deletions, want 4", got)
+	}
+
+	if got := recorder.result(now); got.Digest != reviewed.Digest {
+		t.Errorf("Digest %q differs from %q", got.Digest, reviewed.Digest)
+	}
+
+	r := newPlanReview(planReviewOptions{
+		logger: slog.New(slog.DiscardHandler),
+		cancel: func(err error) {
+			cause = err
+		},
+		reviewed:     &reviewed,
+		maxDeviation: 0.25,
+	})
+
+	for _, tc := range []struct {
+		items []objectVersion
+		want  bool
+	}{
+		{items: versions("a", "b", "c"), want: true},
+		{items: versions("x"), want: true},
+		{items: versions("d", "y"), want: false},
+		{items: versions("d"), want: false},
+	} {
+		if got := r.admit(t.Context(), tc.items); got != tc.want {
+			t.Errorf("admit(%v) = %v, want %v", tc.items, got, tc.want)
+		}
+	}
+
+	if !errors.Is(cause, ErrPlanChanged) {
+		t.Errorf("Cancellation cause %v, want %v", cause, ErrPlanChanged)
+	}
+
+	var disabled *planReview
+
+	if !disabled.admit(t.Context(), versions("a")) {
+		t.Errorf("Disabled review didn't admit deletion")
+	}
+}
+
+func TestPlanReviewDrifted(t *testing.T) {
+	lastModified := time.Date(2024, time.January, 1, 0, 0, 0, int(123*time.Millisecond), time.UTC)
+	retainUntil := time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)
+
+	planned := objectVersion{key: "a", versionID: "v1", lastModified: lastModified, retainUntil: retainUntil}
+	unplanned := objectVersion{key: "b", versionID: "v1"}
+
+	recorder := newPlanReview(planReviewOptions{
+		logger: slog.New(slog.DiscardHandler),
+	})
+
+	recorder.admit(t.Context(), []objectVersion{planned})
+
+	if recorder.verifies() {
+		t.Errorf("Recording plan verifies versions")
+	}
+
+	reviewed := recorder.result(time.Now())
+
+	r := newPlanReview(planReviewOptions{
+		logger:   slog.New(slog.DiscardHandler),
+		reviewed: &reviewed,
+	})
+
+	if !r.verifies() {
+		t.Fatalf("Reviewed plan doesn't verify versions")
+	}
+
+	for _, tc := range []struct {
+		name         string
+		ov           objectVersion
+		lastModified time.Time
+		retainUntil  time.Time
+		want         bool
+	}{
+		{
+			name:         "unchanged",
+			ov:           planned,
+			lastModified: lastModified.Truncate(time.Second),
+			retainUntil:  retainUntil,
+		},
+		{
+			name:         "retention shortened",
+			ov:           planned,
+			lastModified: lastModified,
+		},
+		{
+			name:         "retention extended",
+			ov:           planned,
+			lastModified: lastModified,
+			retainUntil:  retainUntil.Add(time.Hour),
+			want:         true,
+		},
+		{
+			name:         "replaced",
+			ov:           planned,
+			lastModified: lastModified.Add(time.Minute),
+			retainUntil:  retainUntil,
+			want:         true,
+		},
+		{
+			name:        "not planned",
+			ov:          unplanned,
+			retainUntil: retainUntil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := r.drifted(tc.ov, tc.lastModified, tc.retainUntil); got != tc.want {
+				t.Errorf("drifted() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	// Plans recorded by older releases lack the state of the versions.
+	reviewed.Versions = nil
+
+	if newPlanReview(planReviewOptions{reviewed: &reviewed}).verifies() {
+		t.Errorf("Plan without versions verifies them")
+	}
+}
+
+func TestRunReviewedPlanDrift(t *testing.T) {
+	fake := fakes3.New(fakes3.Options{
+		Bucket:       "bucket",
+		NoObjectLock: true,
+	})
+
+	for _, key := range []string{"first", "second"} {
+		for i := range 2 {
+			fake.Add(fakes3.Version{
+				Key:          key,
+				VersionID:    fmt.Sprint(i),
+				LastModified: time.Date(2024, time.January, 1+i, 0, 0, 0, 0, time.UTC),
+			})
+		}
+	}
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	c, err := NewClient(aws.Config{
+		Region:      "us-east-1",
+		Credentials: aws.AnonymousCredentials{},
+	}, server.URL+"/bucket")
+	if err != nil {
+		t.Fatalf("NewClient() failed: %v", err)
+	}
+
+	store, err := state.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("state.New() failed: %v", err)
+	}
+
+	t.Cleanup(func() { store.Close() })
+
+	stats := NewStats()
+
+	run := func(dryRun bool) error {
+		return Run(t.Context(), Options{
+			Logger:              slog.New(slog.DiscardHandler),
+			Stats:               stats,
+			State:               store,
+			Client:              c,
+			DryRun:              dryRun,
+			AllowUnlocked:       true,
+			RequireReviewedPlan: true,
+		})
+	}
+
+	if err := run(true); err != nil {
+		t.Fatalf("Run() as dry run failed: %v", err)
+	}
+
+	// Re-protect one of the planned versions after the review.
+	if err := c.PutObjectRetention(t.Context(), "first", "0", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("PutObjectRetention() failed: %v", err)
+	}
+
+	if err := run(false); err != nil {
+		t.Errorf("Run() failed: %v", err)
+	}
+
+	if got := stats.Counters()["delete.plan_drift_count"]; got != 1 {
+		t.Errorf("Drift count %d, want 1", got)
+	}
+
+	var remaining []string
+
+	for _, v := range fake.Versions() {
+		remaining = append(remaining, v.Key+"/"+v.VersionID)
+	}
+
+	if diff := cmp.Diff([]string{"first/1", "first/0", "second/1"}, remaining); diff != "" {
+		t.Errorf("Remaining versions diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestRunReviewedPlan(t *testing.T) {
+	fake := fakes3.New(fakes3.Options{
+		Bucket:       "bucket",
+		NoObjectLock: true,
+	})
+
+	addVersions := func(key string) {
+		for i := range 2 {
+			fake.Add(fakes3.Version{
+				Key:          key,
+				VersionID:    fmt.Sprint(i),
+				LastModified: time.Date(2024, time.January, 1+i, 0, 0, 0, 0, time.UTC),
+			})
+		}
+	}
+
+	addVersions("first")
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	c, err := NewClient(aws.Config{
+		Region:      "us-east-1",
+		Credentials: aws.AnonymousCredentials{},
+	}, server.URL+"/bucket")
+	if err != nil {
+		t.Fatalf("NewClient() failed: %v", err)
+	}
+
+	store, err := state.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("state.New() failed: %v", err)
+	}
+
+	t.Cleanup(func() { store.Close() })
+
+	run := func(ctx context.Context, dryRun bool) error {
+		return Run(ctx, Options{
+			Logger:              slog.New(slog.DiscardHandler),
+			State:               store,
+			Client:              c,
+			DryRun:              dryRun,
+			AllowUnlocked:       true,
+			RequireReviewedPlan: true,
+		})
+	}
+
+	if err := run(t.Context(), false); !errors.Is(err, ErrPlanChanged) {
+		t.Errorf("Run() without reviewed plan returned %v, want %v", err, ErrPlanChanged)
+	}
+
+	if err := run(t.Context(), true); err != nil {
+		t.Errorf("Run() as dry run failed: %v", err)
+	}
+
+	addVersions("second")
+
+	if err := run(t.Context(), false); !errors.Is(err, ErrPlanChanged) {
+		t.Errorf("Run() with changed plan returned %v, want %v", err, ErrPlanChanged)
+	}
+
+	if err := run(t.Context(), true); err != nil {
+		t.Errorf("Run() as dry run failed: %v", err)
+	}
+
+	if diff := cmp.Diff(nil, run(t.Context(), false), cmpopts.EquateErrors()); diff != "" {
+		t.Errorf("Run() error diff (-want +got):\n%s", diff)
+	}
+
+	if got := len(fake.Versions()); got != 2 {
+		t.Errorf("%d versions remain, want 2", got)
+	}
+
+	bucketState, err := store.Bucket(c.Name())
+	if err != nil {
+		t.Fatalf("Bucket() failed: %v", err)
+	}
+
+	if _, found, err := bucketState.GetReviewedPlan(); err != nil {
+		t.Errorf("GetReviewedPlan() failed: %v", err)
+	} else if found {
+		t.Errorf("Reviewed plan wasn't consumed")
+	}
+}
@@ -0,0 +1,121 @@
+package cleanup
+
+import (
+	"fmt"
+	"hash/fnv"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// KeyShard is a deterministic subset of the object keys of a bucket. Keys are
+// assigned by hash so that independent processes can divide a bucket without
+// coordination. All versions of a key belong to the same shard. The zero value
+// contains all keys.
+type KeyShard struct {
+	index int
+	count int
+}
+
+// ParseKeyShard parses a shard specification of the form "i/N" with a
+// zero-based index i smaller than the number of shards N.
+func ParseKeyShard(value string) (KeyShard, error) {
+	if value == "" {
+		return KeyShard{}, nil
+	}
+
+	indexStr, countStr, found := strings.Cut(value, "/")
+	if !found {
+		return KeyShard{}, fmt.Errorf("shard %q is not of the form i/N", value)
+	}
+
+	index, err := strconv.Atoi(indexStr)
+	if err != nil {
+		return KeyShard{}, fmt.Errorf("shard index: %w", err)
+	}
+
+	count, err := strconv.Atoi(countStr)
+	if err != nil {
+		return KeyShard{}, fmt.Errorf("shard count: %w", err)
+	}
+
+	if count < 1 || index < 0 || index >= count {
+		return KeyShard{}, fmt.Errorf("shard %q requires 0 <= i < N", value)
+	}
+
+	return KeyShard{index: index, count: count}, nil
+}
+
+func (s KeyShard) enabled() bool {
+	return s.count > 1
+}
+
+func (s KeyShard) String() string {
+	if !s.enabled() {
+		return ""
+	}
+
+	return fmt.Sprintf("%d/%d", s.index, s.count)
+}
+
+// contains reports whether the key belongs to the shard.
+func (s KeyShard) contains(key string) bool {
+	if !s.enabled() {
+		return true
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(key))
+
+	return h.Sum64()%uint64(s.count) == uint64(s.index)
+}
+
+// ObjectKey returns the name of a per-shard object in the persistence bucket
+// by inserting the shard before the extension, e.g. "state/bucket.gz" becomes
+// "state/bucket.shard-1-of-4.gz". Names are unchanged without sharding.
+func (s KeyShard) ObjectKey(key string) string {
+	if !s.enabled() {
+		return key
+	}
+
+	ext := path.Ext(key)
+
+	return fmt.Sprintf("%s.shard-%d-of-%d%s", strings.TrimSuffix(key, ext), s.index, s.count, ext)
+}
+
+// ObjectKeyPrefix returns a prefix shared by the per-shard objects of all
+// shards derived from a key, including the key itself.
+func (s KeyShard) ObjectKeyPrefix(key string) string {
+	return strings.TrimSuffix(key, path.Ext(key))
+}
+
+// OverlapsObjectKey reports whether a per-shard object derived from a key, as
+// returned by [KeyShard.ObjectKey] for any shard, belongs to a shard sharing
+// object keys with s. Objects of runs without sharding overlap with all
+// shards, as do those of shards of a different count.
+func (s KeyShard) OverlapsObjectKey(key, other string) bool {
+	if other == key {
+		return true
+	}
+
+	ext := path.Ext(key)
+
+	spec, found := strings.CutPrefix(other, strings.TrimSuffix(key, ext)+".shard-")
+	if !found || !strings.HasSuffix(spec, ext) {
+		return false
+	}
+
+	indexStr, countStr, found := strings.Cut(strings.TrimSuffix(spec, ext), "-of-")
+	if !found {
+		return false
+	}
+
+	index, indexErr := strconv.Atoi(indexStr)
+	count, countErr := strconv.Atoi(countStr)
+
+	if indexErr != nil || countErr != nil {
+		return false
+	}
+
+	return !s.enabled() || count != s.count || index == s.index
+}
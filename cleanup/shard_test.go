@@ -0,0 +1,148 @@
+package cleanup
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestParseKeyShard(t *testing.T) {
+	for _, tc := range []struct {
+		value   string
+		want    KeyShard
+		wantErr bool
+	}{
+		{value: ""},
+		{value: "0/1", want: KeyShard{index: 0, count: 1}},
+		{value: "2/4", want: KeyShard{index: 2, count: 4}},
+		{value: "4/4", wantErr: true},
+		{value: "-1/4", wantErr: true},
+		{value: "1/0", wantErr: true},
+		{value: "1", wantErr: true},
+		{value: "a/b", wantErr: true},
+	} {
+		t.Run(tc.value, func(t *testing.T) {
+			got, err := ParseKeyShard(tc.value)
+
+			if (err != nil) != tc.wantErr {
+				t.Errorf("parseKeyShard(%q) error = %v, want error %t", tc.value, err, tc.wantErr)
+			}
+
+			if err == nil && got != tc.want {
+				t.Errorf("parseKeyShard(%q) = %+v, want %+v", tc.value, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestKeyShardContains(t *testing.T) {
+	const count = 4
+	const keys = 10000
+
+	var sizes [count]int
+
+	for i := range keys {
+		key := fmt.Sprintf("dir/key%d", i)
+
+		if !(KeyShard{}).contains(key) {
+			t.Errorf("Disabled shard doesn't contain %q", key)
+		}
+
+		var matches int
+
+		for index := range count {
+			if (KeyShard{index: index, count: count}).contains(key) {
+				sizes[index]++
+				matches++
+			}
+		}
+
+		if matches != 1 {
+			t.Errorf("Key %q is contained in %d shards, want 1", key, matches)
+		}
+	}
+
+	for index, size := range sizes {
+		if size < keys/count/2 || size > 2*keys/count {
+			t.Errorf("Shard %d contains %d of %d keys", index, size, keys)
+		}
+	}
+}
+
+func TestKeyShardObjectKey(t *testing.T) {
+	for _, tc := range []struct {
+		shard KeyShard
+		key   string
+		want  string
+	}{
+		{key: "state/bucket.gz", want: "state/bucket.gz"},
+		{shard: KeyShard{index: 0, count: 1}, key: "lock.json", want: "lock.json"},
+		{shard: KeyShard{index: 1, count: 4}, key: "state/bucket.gz", want: "state/bucket.shard-1-of-4.gz"},
+		{shard: KeyShard{index: 3, count: 4}, key: "reports.tar.gz", want: "reports.tar.shard-3-of-4.gz"},
+		{shard: KeyShard{index: 0, count: 2}, key: "lock", want: "lock.shard-0-of-2"},
+	} {
+		if got := tc.shard.ObjectKey(tc.key); got != tc.want {
+			t.Errorf("%+v.ObjectKey(%q) = %q, want %q", tc.shard, tc.key, got, tc.want)
+		}
+	}
+}
+
+func TestKeyShardOverlapsObjectKey(t *testing.T) {
+	for _, tc := range []struct {
+		shard KeyShard
+		other string
+		want  bool
+	}{
+		{other: "lock.json", want: true},
+		{other: "lock.shard-1-of-4.json", want: true},
+		{other: "lock.backup", want: false},
+		{other: "lock.shard-x-of-4.json", want: false},
+		{shard: KeyShard{index: 1, count: 4}, other: "lock.json", want: true},
+		{shard: KeyShard{index: 1, count: 4}, other: "lock.shard-1-of-4.json", want: true},
+		{shard: KeyShard{index: 1, count: 4}, other: "lock.shard-2-of-4.json", want: false},
+		{shard: KeyShard{index: 1, count: 4}, other: "lock.shard-0-of-2.json", want: true},
+	} {
+		if got := tc.shard.OverlapsObjectKey("lock.json", tc.other); got != tc.want {
+			t.Errorf("%+v.OverlapsObjectKey(%q) = %t, want %t", tc.shard, tc.other, got, tc.want)
+		}
+	}
+
+	if got, want := (KeyShard{index: 1, count: 4}).ObjectKeyPrefix("lock.json"), "lock"; got != want {
+		t.Errorf("ObjectKeyPrefix() = %q, want %q", got, want)
+	}
+}
+
+func TestListHandlerShard(t *testing.T) {
+	shard := KeyShard{index: 1, count: 3}
+
+	ch := make(chan objectVersion, 100)
+
+	h := newListHandler(ch)
+	h.shard = shard
+
+	for i := range 100 {
+		h.handleVersion(types.ObjectVersion{
+			Key:       aws.String(fmt.Sprint(i)),
+			VersionId: aws.String("v"),
+		})
+	}
+
+	h.flush()
+	close(ch)
+
+	var count int
+
+	for ov := range ch {
+		if !shard.contains(ov.key) {
+			t.Errorf("Forwarded key %q outside of shard", ov.key)
+		}
+
+		count++
+	}
+
+	if count == 0 {
+		t.Errorf("No keys forwarded")
+	}
+}
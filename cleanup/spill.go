@@ -0,0 +1,206 @@
+package cleanup
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/hansmi/s3-object-cleanup/internal/state"
+)
+
+// versionSeriesStaging holds the versions of keys which haven't been
+// finalized yet.
+type versionSeriesStaging interface {
+	// add stages a version and returns the number of versions staged for
+	// its key.
+	add(objectVersion) (int, error)
+
+	// take removes and returns the staged versions of a key.
+	take(key string) (*versionSeries, error)
+
+	// forEach invokes a function with the versions of every staged key.
+	forEach(func(string, *versionSeries) error) error
+}
+
+type memoryVersionSeriesStaging map[string]*versionSeries
+
+var _ versionSeriesStaging = (memoryVersionSeriesStaging)(nil)
+
+func (m memoryVersionSeriesStaging) add(ov objectVersion) (int, error) {
+	s := m[ov.key]
+
+	if s == nil {
+		s = &versionSeries{}
+
+		m[ov.key] = s
+	}
+
+	s.add(ov)
+
+	return len(s.items), nil
+}
+
+func (m memoryVersionSeriesStaging) take(key string) (*versionSeries, error) {
+	s := m[key]
+
+	delete(m, key)
+
+	if s == nil {
+		s = &versionSeries{}
+	}
+
+	return s, nil
+}
+
+func (m memoryVersionSeriesStaging) forEach(fn func(string, *versionSeries) error) error {
+	for key, s := range m {
+		if err := fn(key, s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// spilledVersion is the serialized form of an object version staged on disk.
+type spilledVersion struct {
+	LastModified time.Time
+	RetainUntil  time.Time
+	VersionID    string
+	Size         int64
+	IsLatest     bool
+	DeleteMarker bool
+	Unchanged    bool
+	ListOrder    int
+	Head         *spilledHead `json:",omitempty"`
+}
+
+// spilledHead keeps the fields of a HeadObject response used by the deletion
+// eligibility checks, avoiding another request for spilled versions.
+type spilledHead struct {
+	LastModified         *time.Time
+	RetainUntil          *time.Time
+	Metadata             map[string]string
+	ServerSideEncryption types.ServerSideEncryption
+	SSEKMSKeyID          *string
+}
+
+func newSpilledHead(output *s3.HeadObjectOutput) *spilledHead {
+	if output == nil {
+		return nil
+	}
+
+	return &spilledHead{
+		LastModified:         output.LastModified,
+		RetainUntil:          output.ObjectLockRetainUntilDate,
+		Metadata:             output.Metadata,
+		ServerSideEncryption: output.ServerSideEncryption,
+		SSEKMSKeyID:          output.SSEKMSKeyId,
+	}
+}
+
+func (h *spilledHead) output() *s3.HeadObjectOutput {
+	if h == nil {
+		return nil
+	}
+
+	return &s3.HeadObjectOutput{
+		LastModified:              h.LastModified,
+		ObjectLockRetainUntilDate: h.RetainUntil,
+		Metadata:                  h.Metadata,
+		ServerSideEncryption:      h.ServerSideEncryption,
+		SSEKMSKeyId:               h.SSEKMSKeyID,
+	}
+}
+
+// diskVersionSeriesStaging keeps staged versions in a temporary database so
+// that memory use doesn't grow with the number of versions in flight. Only
+// the per-key counts are kept in memory.
+type diskVersionSeriesStaging struct {
+	db     *state.Staging
+	counts map[string]int
+}
+
+var _ versionSeriesStaging = (*diskVersionSeriesStaging)(nil)
+
+func newDiskVersionSeriesStaging(db *state.Staging) *diskVersionSeriesStaging {
+	return &diskVersionSeriesStaging{
+		db:     db,
+		counts: map[string]int{},
+	}
+}
+
+func (d *diskVersionSeriesStaging) add(ov objectVersion) (int, error) {
+	buf, err := json.Marshal(spilledVersion{
+		LastModified: ov.lastModified,
+		RetainUntil:  ov.retainUntil,
+		VersionID:    ov.versionID,
+		Size:         ov.size,
+		IsLatest:     ov.isLatest,
+		DeleteMarker: ov.deleteMarker,
+		Unchanged:    ov.unchanged,
+		ListOrder:    ov.listOrder,
+		Head:         newSpilledHead(ov.head),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := d.db.Append(ov.key, buf); err != nil {
+		return 0, err
+	}
+
+	d.counts[ov.key]++
+
+	return d.counts[ov.key], nil
+}
+
+func decodeSpilledVersions(key string, values [][]byte) (*versionSeries, error) {
+	s := &versionSeries{}
+
+	for _, buf := range values {
+		var v spilledVersion
+
+		if err := json.Unmarshal(buf, &v); err != nil {
+			return nil, err
+		}
+
+		s.add(objectVersion{
+			lastModified: v.LastModified,
+			retainUntil:  v.RetainUntil,
+			key:          key,
+			versionID:    v.VersionID,
+			size:         v.Size,
+			isLatest:     v.IsLatest,
+			deleteMarker: v.DeleteMarker,
+			unchanged:    v.Unchanged,
+			listOrder:    v.ListOrder,
+			head:         v.Head.output(),
+		})
+	}
+
+	return s, nil
+}
+
+func (d *diskVersionSeriesStaging) take(key string) (*versionSeries, error) {
+	delete(d.counts, key)
+
+	values, err := d.db.Take(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeSpilledVersions(key, values)
+}
+
+func (d *diskVersionSeriesStaging) forEach(fn func(string, *versionSeries) error) error {
+	return d.db.ForEach(func(key string, values [][]byte) error {
+		s, err := decodeSpilledVersions(key, values)
+		if err != nil {
+			return err
+		}
+
+		return fn(key, s)
+	})
+}
@@ -0,0 +1,170 @@
+package cleanup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/hansmi/s3-object-cleanup/internal/state"
+)
+
+func newDiskVersionSeriesStagingForTest(t *testing.T) *diskVersionSeriesStaging {
+	t.Helper()
+
+	db, err := state.NewStaging(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStaging() failed: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("Close() failed: %v", err)
+		}
+	})
+
+	return newDiskVersionSeriesStaging(db)
+}
+
+func TestVersionSeriesStaging(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	versions := []objectVersion{
+		{key: "a", versionID: "a2", lastModified: now.Add(-time.Hour), isLatest: true, size: 20},
+		{key: "b", versionID: "b1", lastModified: now.Add(-3 * time.Hour), deleteMarker: true},
+		{key: "a", versionID: "a1", lastModified: now.Add(-2 * time.Hour), retainUntil: now.Add(time.Hour), size: 10, unchanged: true, listOrder: 1},
+	}
+
+	for _, tc := range []struct {
+		name    string
+		staging versionSeriesStaging
+	}{
+		{name: "memory", staging: memoryVersionSeriesStaging{}},
+		{name: "disk", staging: newDiskVersionSeriesStagingForTest(t)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var counts []int
+
+			for _, ov := range versions {
+				count, err := tc.staging.add(ov)
+				if err != nil {
+					t.Fatalf("add() failed: %v", err)
+				}
+
+				counts = append(counts, count)
+			}
+
+			if diff := cmp.Diff([]int{1, 1, 2}, counts); diff != "" {
+				t.Errorf("Counts diff (-want +got):\n%s", diff)
+			}
+
+			s, err := tc.staging.take("a")
+			if err != nil {
+				t.Fatalf("take() failed: %v", err)
+			}
+
+			want := &versionSeries{
+				items:      []objectVersion{versions[2], versions[0]},
+				haveLatest: true,
+			}
+
+			if diff := cmp.Diff(want, s, cmp.AllowUnexported(versionSeries{}, objectVersion{})); diff != "" {
+				t.Errorf("take() diff (-want +got):\n%s", diff)
+			}
+
+			remaining := map[string]*versionSeries{}
+
+			if err := tc.staging.forEach(func(key string, s *versionSeries) error {
+				remaining[key] = s
+				return nil
+			}); err != nil {
+				t.Errorf("forEach() failed: %v", err)
+			}
+
+			if diff := cmp.Diff(map[string]*versionSeries{
+				"b": {items: []objectVersion{versions[1]}},
+			}, remaining, cmp.AllowUnexported(versionSeries{}, objectVersion{})); diff != "" {
+				t.Errorf("forEach() diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestVersionSeriesStagingHead(t *testing.T) {
+	staging := newDiskVersionSeriesStagingForTest(t)
+
+	modified := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	head := &s3.HeadObjectOutput{
+		LastModified:              aws.Time(modified),
+		ObjectLockRetainUntilDate: aws.Time(modified.Add(time.Hour)),
+		Metadata:                  map[string]string{"keep": "yes"},
+		ServerSideEncryption:      types.ServerSideEncryptionAwsKms,
+		SSEKMSKeyId:               aws.String("key-id"),
+	}
+
+	for _, ov := range []objectVersion{
+		{key: "a", versionID: "a1", lastModified: modified, head: head},
+		{key: "a", versionID: "a2", lastModified: modified.Add(time.Minute)},
+	} {
+		if _, err := staging.add(ov); err != nil {
+			t.Fatalf("add() failed: %v", err)
+		}
+	}
+
+	s, err := staging.take("a")
+	if err != nil {
+		t.Fatalf("take() failed: %v", err)
+	}
+
+	var got []*s3.HeadObjectOutput
+
+	for _, ov := range s.items {
+		got = append(got, ov.head)
+	}
+
+	// Only the fields used by the deletion checks are restored.
+	if diff := cmp.Diff([]*s3.HeadObjectOutput{head, nil}, got, cmpopts.IgnoreUnexported(s3.HeadObjectOutput{}), cmpopts.IgnoreFields(s3.HeadObjectOutput{}, "ResultMetadata")); diff != "" {
+		t.Errorf("Spilled HeadObject responses diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestProcessorSpill(t *testing.T) {
+	now := time.Now()
+
+	p := newProcessor(processorOptions{
+		stats:          NewStats(),
+		minRetention:   24 * time.Hour,
+		minDeletionAge: 24 * time.Hour,
+		staging:        newDiskVersionSeriesStagingForTest(t),
+	})
+
+	in := make(chan objectVersion, 8)
+	retentionCh := make(chan retentionExtenderRequest, 8)
+	deleteCh := make(chan objectVersion, 8)
+
+	in <- objectVersion{key: "complete", versionID: "new", lastModified: now.Add(-48 * time.Hour), isLatest: true, keyVersionCount: 2}
+	in <- objectVersion{key: "unknown", versionID: "old", lastModified: now.Add(-72 * time.Hour)}
+	in <- objectVersion{key: "complete", versionID: "old", lastModified: now.Add(-72 * time.Hour), keyVersionCount: 2}
+	in <- objectVersion{key: "unknown", versionID: "new", lastModified: now.Add(-48 * time.Hour), isLatest: true}
+	close(in)
+
+	if err := p.run(in, retentionCh, deleteCh); err != nil {
+		t.Errorf("run() failed: %v", err)
+	}
+
+	close(deleteCh)
+
+	var got []string
+
+	for ov := range deleteCh {
+		got = append(got, ov.key+"/"+ov.versionID)
+	}
+
+	if diff := cmp.Diff([]string{"complete/old", "unknown/old"}, got); diff != "" {
+		t.Errorf("Expired versions diff (-want +got):\n%s", diff)
+	}
+}
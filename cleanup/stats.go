@@ -0,0 +1,793 @@
+package cleanup
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/hansmi/s3-object-cleanup/internal/client"
+)
+
+type timeRange struct {
+	lower, upper time.Time
+}
+
+var _ slog.LogValuer = (*timeRange)(nil)
+
+func (r *timeRange) update(t time.Time) {
+	if t.IsZero() {
+		return
+	}
+
+	if r.lower.IsZero() || t.Before(r.lower) {
+		r.lower = t
+	}
+
+	if r.upper.IsZero() || t.After(r.upper) {
+		r.upper = t
+	}
+}
+
+func (r *timeRange) merge(other timeRange) {
+	r.update(other.lower)
+	r.update(other.upper)
+}
+
+func (r timeRange) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Time("lower", r.lower),
+		slog.Time("upper", r.upper),
+	)
+}
+
+type sizeStats int64
+
+var _ slog.LogValuer = (*sizeStats)(nil)
+
+func (s *sizeStats) add(bytes int64) {
+	*(*int64)(s) += bytes
+}
+
+func (s sizeStats) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int64("bytes", int64(s)),
+		slog.String("text", humanize.IBytes(uint64(s))),
+	)
+}
+
+// ageHistogramBounds are the upper bounds of the buckets of version ages,
+// chosen to match common minimum ages.
+var ageHistogramBounds = [...]time.Duration{
+	1 * 24 * time.Hour,
+	7 * 24 * time.Hour,
+	30 * 24 * time.Hour,
+	90 * 24 * time.Hour,
+	180 * 24 * time.Hour,
+	365 * 24 * time.Hour,
+	730 * 24 * time.Hour,
+}
+
+// ageHistogram counts versions by the time since their last modification.
+// The last bucket holds the versions at least as old as the largest bound.
+type ageHistogram [len(ageHistogramBounds) + 1]int64
+
+var _ slog.LogValuer = (*ageHistogram)(nil)
+
+func (h *ageHistogram) add(age time.Duration) {
+	idx := len(ageHistogramBounds)
+
+	for i, bound := range ageHistogramBounds {
+		if age < bound {
+			idx = i
+			break
+		}
+	}
+
+	h[idx]++
+}
+
+// names returns the name of each bucket, e.g. "lt_7d" or "ge_730d".
+func (h ageHistogram) names() [len(ageHistogramBounds) + 1]string {
+	var names [len(ageHistogramBounds) + 1]string
+
+	days := func(d time.Duration) int64 {
+		return int64(d / (24 * time.Hour))
+	}
+
+	for i, bound := range ageHistogramBounds {
+		names[i] = fmt.Sprintf("lt_%dd", days(bound))
+	}
+
+	names[len(ageHistogramBounds)] = fmt.Sprintf("ge_%dd", days(ageHistogramBounds[len(ageHistogramBounds)-1]))
+
+	return names
+}
+
+// counts returns the number of versions by bucket name.
+func (h ageHistogram) counts() map[string]int64 {
+	result := make(map[string]int64, len(h))
+
+	for i, name := range h.names() {
+		result[name] = h[i]
+	}
+
+	return result
+}
+
+func (h *ageHistogram) merge(other ageHistogram) {
+	for i, count := range other {
+		h[i] += count
+	}
+}
+
+func (h ageHistogram) LogValue() slog.Value {
+	attrs := make([]slog.Attr, 0, len(h))
+
+	for i, name := range h.names() {
+		attrs = append(attrs, slog.Int64(name, h[i]))
+	}
+
+	return slog.GroupValue(attrs...)
+}
+
+// Stats counts the versions and requests processed by one or more runs. Its
+// safe for concurrent use.
+type Stats struct {
+	mu sync.Mutex
+
+	// Reference time for version ages.
+	now func() time.Time
+
+	retentionAnnotationErrorCount int64
+
+	listedCount          int64
+	listedPageRetryCount int64
+
+	// Number of runs which didn't cover all keys of the bucket, e.g. due to
+	// the list deadline, incremental runs or shards.
+	listedPartialCount int64
+
+	// Number of API requests by operation name.
+	apiRequests map[string]int64
+
+	stageTimings [stageCount]stageTiming
+
+	totalCount             int64
+	totalSize              sizeStats
+	totalNoncurrentSize    sizeStats
+	totalModTime           timeRange
+	totalRetainUntil       timeRange
+	totalLatestModTime     timeRange
+	totalLatestRetainUntil timeRange
+	totalAge               ageHistogram
+
+	excludedCount           int64
+	metadataExcludedCount   int64
+	encryptionExcludedCount int64
+	minVersionsKeyCount     int64
+	protectedCount          int64
+
+	throttledCount int64
+
+	// Number of failed requests by error class.
+	errorClassCounts map[client.ErrorClass]int64
+
+	// Number of panics recovered by pipeline workers.
+	workerPanicCount int64
+
+	inventoryNewCount       int64
+	inventoryUnchangedCount int64
+	inventoryRemovedCount   int64
+
+	incrementalSkippedCount int64
+
+	statePrunedCount     int64
+	stateCacheHitCount   int64
+	stateCacheMissCount  int64
+	stateFilterSkipCount int64
+	stateLoadedCount     int64
+	stateWrittenCount    int64
+	stateSnapshotSize    sizeStats
+
+	retentionSuccessCount   int64
+	retentionErrorCount     int64
+	retentionHorizonCount   int64
+	retentionModTime        timeRange
+	retentionOriginal       timeRange
+	retentionLatestModTime  timeRange
+	retentionLatestOriginal timeRange
+
+	deleteCount       int64
+	deleteSize        sizeStats
+	deleteModTime     timeRange
+	deleteRetainUntil timeRange
+	deleteAge         ageHistogram
+
+	deleteSuccessCount int64
+	deleteErrorCount   int64
+	deleteRetryCount   int64
+
+	// Deletions skipped because retention extensions for other versions of
+	// the same key failed.
+	retentionBarrierSkippedCount int64
+
+	quarantinedCount int64
+
+	// Deletions skipped because the version changed since the plan was
+	// reviewed.
+	planDriftCount int64
+}
+
+func NewStats() *Stats {
+	return &Stats{
+		now:              time.Now,
+		apiRequests:      map[string]int64{},
+		errorClassCounts: map[client.ErrorClass]int64{},
+	}
+}
+
+func (s *Stats) addRetentionAnnotationError() {
+	s.mu.Lock()
+	s.retentionAnnotationErrorCount++
+	s.mu.Unlock()
+}
+
+func (s *Stats) addListed(count int) {
+	s.mu.Lock()
+	s.listedCount += int64(count)
+	s.mu.Unlock()
+}
+
+// addPartial records a run which didn't cover all keys of the bucket.
+func (s *Stats) addPartial() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.listedPartialCount++
+}
+
+// Complete reports whether all runs covered every key of their bucket. Runs
+// aborted by an error are only known to be partial if they got far enough.
+func (s *Stats) Complete() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.listedPartialCount == 0
+}
+
+func (s *Stats) addListPageRetry() {
+	s.mu.Lock()
+	s.listedPageRetryCount++
+	s.mu.Unlock()
+}
+
+func (s *Stats) discovered(v objectVersion) {
+	s.mu.Lock()
+	s.totalCount++
+	s.totalSize.add(v.size)
+	s.totalModTime.update(v.lastModified)
+	s.totalRetainUntil.update(v.retainUntil)
+	s.addAge(&s.totalAge, v)
+	if v.isLatest {
+		s.totalLatestModTime.update(v.lastModified)
+		s.totalLatestRetainUntil.update(v.retainUntil)
+	} else {
+		s.totalNoncurrentSize.add(v.size)
+	}
+	s.mu.Unlock()
+}
+
+func (s *Stats) addExcluded() {
+	s.mu.Lock()
+	s.excludedCount++
+	s.mu.Unlock()
+}
+
+func (s *Stats) addMetadataExcluded() {
+	s.mu.Lock()
+	s.metadataExcludedCount++
+	s.mu.Unlock()
+}
+
+func (s *Stats) addEncryptionExcluded() {
+	s.mu.Lock()
+	s.encryptionExcludedCount++
+	s.mu.Unlock()
+}
+
+func (s *Stats) addThrottled() {
+	s.mu.Lock()
+	s.throttledCount++
+	s.mu.Unlock()
+}
+
+// addError counts a failed request by the class of its error. Panics of
+// pipeline workers are counted separately.
+func (s *Stats) addError(err error) {
+	if errors.Is(err, ErrWorkerPanic) {
+		s.mu.Lock()
+		s.workerPanicCount++
+		s.mu.Unlock()
+		return
+	}
+
+	s.addErrorClass(client.ClassifyError(err))
+}
+
+func (s *Stats) addErrorClass(class client.ErrorClass) {
+	s.mu.Lock()
+	s.errorClassCounts[class]++
+	s.mu.Unlock()
+}
+
+func (s *Stats) addInventoryNew() {
+	s.mu.Lock()
+	s.inventoryNewCount++
+	s.mu.Unlock()
+}
+
+func (s *Stats) addInventoryUnchanged() {
+	s.mu.Lock()
+	s.inventoryUnchangedCount++
+	s.mu.Unlock()
+}
+
+func (s *Stats) addInventoryRemoved(count int) {
+	s.mu.Lock()
+	s.inventoryRemovedCount += int64(count)
+	s.mu.Unlock()
+}
+
+func (s *Stats) addProtected() {
+	s.mu.Lock()
+	s.protectedCount++
+	s.mu.Unlock()
+}
+
+func (s *Stats) addMinVersionsSkipped() {
+	s.mu.Lock()
+	s.minVersionsKeyCount++
+	s.mu.Unlock()
+}
+
+func (s *Stats) addIncrementalSkipped() {
+	s.mu.Lock()
+	s.incrementalSkippedCount++
+	s.mu.Unlock()
+}
+
+func (s *Stats) addStatePruned(count int) {
+	s.mu.Lock()
+	s.statePrunedCount += int64(count)
+	s.mu.Unlock()
+}
+
+func (s *Stats) addStateCacheHit() {
+	s.mu.Lock()
+	s.stateCacheHitCount++
+	s.mu.Unlock()
+}
+
+func (s *Stats) addStateCacheMiss() {
+	s.mu.Lock()
+	s.stateCacheMissCount++
+	s.mu.Unlock()
+}
+
+func (s *Stats) addStateFilterSkip() {
+	s.mu.Lock()
+	s.stateFilterSkipCount++
+	s.mu.Unlock()
+}
+
+func (s *Stats) AddStateLoaded(count int64) {
+	s.mu.Lock()
+	s.stateLoadedCount += count
+	s.mu.Unlock()
+}
+
+func (s *Stats) AddStateWritten(count int64) {
+	s.mu.Lock()
+	s.stateWrittenCount += count
+	s.mu.Unlock()
+}
+
+func (s *Stats) AddStateSnapshot(size int64) {
+	s.mu.Lock()
+	s.stateSnapshotSize.add(size)
+	s.mu.Unlock()
+}
+
+func (s *Stats) addRetention(v objectVersion) {
+	s.mu.Lock()
+	s.retentionSuccessCount++
+	s.retentionModTime.update(v.lastModified)
+	s.retentionOriginal.update(v.retainUntil)
+	if v.isLatest {
+		s.retentionLatestModTime.update(v.lastModified)
+		s.retentionLatestOriginal.update(v.retainUntil)
+	}
+	s.mu.Unlock()
+}
+
+func (s *Stats) addRetentionBeyondHorizon() {
+	s.mu.Lock()
+	s.retentionHorizonCount++
+	s.mu.Unlock()
+}
+
+func (s *Stats) addRetentionError() {
+	s.mu.Lock()
+	s.retentionErrorCount++
+	s.mu.Unlock()
+}
+
+func (s *Stats) addDelete(v objectVersion) {
+	s.mu.Lock()
+	s.deleteCount++
+	s.deleteSize.add(v.size)
+	s.deleteModTime.update(v.lastModified)
+	s.deleteRetainUntil.update(v.retainUntil)
+	s.addAge(&s.deleteAge, v)
+	s.mu.Unlock()
+}
+
+// addAge adds the age of a version to a histogram. Must be called with the
+// lock held.
+func (s *Stats) addAge(h *ageHistogram, v objectVersion) {
+	if !v.lastModified.IsZero() {
+		h.add(s.now().Sub(v.lastModified))
+	}
+}
+
+func (s *Stats) addDeleteResults(successCount, errorCount int) {
+	if successCount == 0 && errorCount == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	s.deleteSuccessCount += int64(successCount)
+	s.deleteErrorCount += int64(errorCount)
+	s.mu.Unlock()
+}
+
+func (s *Stats) addDeleteRetries(count int) {
+	s.mu.Lock()
+	s.deleteRetryCount += int64(count)
+	s.mu.Unlock()
+}
+
+func (s *Stats) addRetentionBarrierSkipped(count int) {
+	s.mu.Lock()
+	s.retentionBarrierSkippedCount += int64(count)
+	s.mu.Unlock()
+}
+
+func (s *Stats) addQuarantined() {
+	s.mu.Lock()
+	s.quarantinedCount++
+	s.mu.Unlock()
+}
+
+func (s *Stats) addPlanDrift() {
+	s.mu.Lock()
+	s.planDriftCount++
+	s.mu.Unlock()
+}
+
+func (s *Stats) AddAPIRequest(operation string) {
+	s.mu.Lock()
+	s.apiRequests[operation]++
+	s.mu.Unlock()
+}
+
+func (s *Stats) apiAttrs() []any {
+	var total int64
+	var cost float64
+
+	var requests []any
+
+	for _, operation := range slices.Sorted(maps.Keys(s.apiRequests)) {
+		count := s.apiRequests[operation]
+
+		total += count
+		cost += float64(count) * requestPrice(operation)
+
+		requests = append(requests, slog.Int64(operation, count))
+	}
+
+	return []any{
+		slog.Int64("request_count", total),
+		slog.Float64("estimated_cost_usd", cost),
+		slog.Group("requests", requests...),
+	}
+}
+
+const workerPanicCounterName = "errors.panic_count"
+
+func errorClassCounterName(class client.ErrorClass) string {
+	return "errors." + class.String() + "_count"
+}
+
+func (s *Stats) errorAttrs() []any {
+	var result []any
+
+	for _, class := range client.ErrorClasses {
+		result = append(result, slog.Int64(class.String()+"_count", s.errorClassCounts[class]))
+	}
+
+	result = append(result, slog.Int64("panic_count", s.workerPanicCount))
+
+	return result
+}
+
+// ErrorAttrs returns the number of errors by class from counters as returned
+// by [Stats.Counters] or [Stats.CountersSince], e.g. for the runs of a single
+// bucket. Classes without errors are omitted.
+func ErrorAttrs(counters map[string]int64) []any {
+	var result []any
+
+	for _, class := range client.ErrorClasses {
+		if count := counters[errorClassCounterName(class)]; count != 0 {
+			result = append(result, slog.Int64(class.String()+"_count", count))
+		}
+	}
+
+	if count := counters[workerPanicCounterName]; count != 0 {
+		result = append(result, slog.Int64("panic_count", count))
+	}
+
+	return result
+}
+
+// addStageTimings adds the time taken by the pipeline stages of a bucket.
+func (s *Stats) addStageTimings(timings [stageCount]stageTiming) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for stage, timing := range timings {
+		s.stageTimings[stage].wall += timing.wall
+		s.stageTimings[stage].busy += timing.busy
+	}
+}
+
+// Merge adds the counters of other statistics, e.g. those of a single bucket.
+func (s *Stats) Merge(other *Stats) {
+	other.mu.Lock()
+	defer other.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.retentionAnnotationErrorCount += other.retentionAnnotationErrorCount
+
+	s.listedCount += other.listedCount
+	s.listedPageRetryCount += other.listedPageRetryCount
+	s.listedPartialCount += other.listedPartialCount
+
+	for operation, count := range other.apiRequests {
+		s.apiRequests[operation] += count
+	}
+
+	for stage, timing := range other.stageTimings {
+		s.stageTimings[stage].wall += timing.wall
+		s.stageTimings[stage].busy += timing.busy
+	}
+
+	s.totalCount += other.totalCount
+	s.totalSize += other.totalSize
+	s.totalNoncurrentSize += other.totalNoncurrentSize
+	s.totalModTime.merge(other.totalModTime)
+	s.totalRetainUntil.merge(other.totalRetainUntil)
+	s.totalLatestModTime.merge(other.totalLatestModTime)
+	s.totalLatestRetainUntil.merge(other.totalLatestRetainUntil)
+	s.totalAge.merge(other.totalAge)
+
+	s.excludedCount += other.excludedCount
+	s.metadataExcludedCount += other.metadataExcludedCount
+	s.encryptionExcludedCount += other.encryptionExcludedCount
+	s.minVersionsKeyCount += other.minVersionsKeyCount
+	s.protectedCount += other.protectedCount
+
+	s.throttledCount += other.throttledCount
+
+	for class, count := range other.errorClassCounts {
+		s.errorClassCounts[class] += count
+	}
+
+	s.workerPanicCount += other.workerPanicCount
+
+	s.inventoryNewCount += other.inventoryNewCount
+	s.inventoryUnchangedCount += other.inventoryUnchangedCount
+	s.inventoryRemovedCount += other.inventoryRemovedCount
+
+	s.incrementalSkippedCount += other.incrementalSkippedCount
+
+	s.statePrunedCount += other.statePrunedCount
+	s.stateCacheHitCount += other.stateCacheHitCount
+	s.stateCacheMissCount += other.stateCacheMissCount
+	s.stateFilterSkipCount += other.stateFilterSkipCount
+	s.stateLoadedCount += other.stateLoadedCount
+	s.stateWrittenCount += other.stateWrittenCount
+	s.stateSnapshotSize += other.stateSnapshotSize
+
+	s.retentionSuccessCount += other.retentionSuccessCount
+	s.retentionErrorCount += other.retentionErrorCount
+	s.retentionHorizonCount += other.retentionHorizonCount
+	s.retentionModTime.merge(other.retentionModTime)
+	s.retentionOriginal.merge(other.retentionOriginal)
+	s.retentionLatestModTime.merge(other.retentionLatestModTime)
+	s.retentionLatestOriginal.merge(other.retentionLatestOriginal)
+
+	s.deleteCount += other.deleteCount
+	s.deleteSize += other.deleteSize
+	s.deleteModTime.merge(other.deleteModTime)
+	s.deleteRetainUntil.merge(other.deleteRetainUntil)
+	s.deleteAge.merge(other.deleteAge)
+
+	s.deleteSuccessCount += other.deleteSuccessCount
+	s.deleteErrorCount += other.deleteErrorCount
+	s.deleteRetryCount += other.deleteRetryCount
+
+	s.retentionBarrierSkippedCount += other.retentionBarrierSkippedCount
+	s.quarantinedCount += other.quarantinedCount
+	s.planDriftCount += other.planDriftCount
+}
+
+func (s *Stats) Attrs() []any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return []any{
+		slog.Group("listed",
+			slog.Int64("count", s.listedCount),
+			slog.Int64("page_retry_count", s.listedPageRetryCount),
+			slog.Int64("partial_count", s.listedPartialCount),
+		),
+		slog.Group("total",
+			slog.Int64("count", s.totalCount),
+			slog.Any("size", s.totalSize),
+			slog.Any("noncurrent_size", s.totalNoncurrentSize),
+			slog.Any("mod_time", s.totalModTime),
+			slog.Any("retain_until", s.totalRetainUntil),
+			slog.Any("latest_mod_time", s.totalLatestModTime),
+			slog.Any("latest_retain_until", s.totalLatestRetainUntil),
+			slog.Any("age", s.totalAge),
+		),
+		slog.Group("excluded",
+			slog.Int64("count", s.excludedCount),
+			slog.Int64("metadata_count", s.metadataExcludedCount),
+			slog.Int64("encryption_count", s.encryptionExcludedCount),
+			slog.Int64("min_versions_key_count", s.minVersionsKeyCount),
+			slog.Int64("protected_count", s.protectedCount),
+		),
+		slog.Group("throttled",
+			slog.Int64("count", s.throttledCount),
+		),
+		slog.Group("errors", s.errorAttrs()...),
+		slog.Group("inventory",
+			slog.Int64("new_count", s.inventoryNewCount),
+			slog.Int64("unchanged_count", s.inventoryUnchangedCount),
+			slog.Int64("removed_count", s.inventoryRemovedCount),
+		),
+		slog.Group("incremental",
+			slog.Int64("skipped_key_count", s.incrementalSkippedCount),
+		),
+		slog.Group("state",
+			slog.Int64("pruned_count", s.statePrunedCount),
+			slog.Int64("cache_hit_count", s.stateCacheHitCount),
+			slog.Int64("cache_miss_count", s.stateCacheMissCount),
+			slog.Int64("filter_skip_count", s.stateFilterSkipCount),
+			slog.Int64("loaded_count", s.stateLoadedCount),
+			slog.Int64("written_count", s.stateWrittenCount),
+			slog.Any("snapshot_size", s.stateSnapshotSize),
+		),
+		slog.Group("retention_annotation",
+			slog.Int64("error_count", s.retentionAnnotationErrorCount),
+		),
+		slog.Group("retention",
+			slog.Int64("success_count", s.retentionSuccessCount),
+			slog.Int64("error_count", s.retentionErrorCount),
+			slog.Int64("beyond_horizon_count", s.retentionHorizonCount),
+			slog.Any("mod_time", s.retentionModTime),
+			slog.Any("original", s.retentionOriginal),
+			slog.Any("latest_mod_time", s.retentionLatestModTime),
+			slog.Any("latest_original", s.retentionLatestOriginal),
+		),
+		slog.Group("delete",
+			slog.Int64("count", s.deleteCount),
+			slog.Any("size", s.deleteSize),
+			slog.Any("mod_time", s.deleteModTime),
+			slog.Any("retain_until", s.deleteRetainUntil),
+			slog.Any("age", s.deleteAge),
+			slog.Int64("success_count", s.deleteSuccessCount),
+			slog.Int64("error_count", s.deleteErrorCount),
+			slog.Int64("retry_count", s.deleteRetryCount),
+			slog.Int64("quarantined_count", s.quarantinedCount),
+			slog.Int64("barrier_skipped_count", s.retentionBarrierSkippedCount),
+			slog.Int64("plan_drift_count", s.planDriftCount),
+		),
+		slog.Group("stages", stageTimingAttrs(s.stageTimings)...),
+		slog.Group("api", s.apiAttrs()...),
+	}
+}
+
+// Counters returns the current values of all counters by name.
+func (s *Stats) Counters() map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := map[string]int64{
+		"total.count":                      s.totalCount,
+		"total.bytes":                      int64(s.totalSize),
+		"total.noncurrent_bytes":           int64(s.totalNoncurrentSize),
+		"excluded.count":                   s.excludedCount,
+		"excluded.metadata_count":          s.metadataExcludedCount,
+		"excluded.encryption_count":        s.encryptionExcludedCount,
+		"excluded.min_versions_key_count":  s.minVersionsKeyCount,
+		"excluded.protected_count":         s.protectedCount,
+		"listed.count":                     s.listedCount,
+		"listed.page_retry_count":          s.listedPageRetryCount,
+		"listed.partial_count":             s.listedPartialCount,
+		"throttled.count":                  s.throttledCount,
+		"inventory.new_count":              s.inventoryNewCount,
+		"inventory.unchanged_count":        s.inventoryUnchangedCount,
+		"inventory.removed_count":          s.inventoryRemovedCount,
+		"incremental.skipped_key_count":    s.incrementalSkippedCount,
+		"state.cache_hit_count":            s.stateCacheHitCount,
+		"state.cache_miss_count":           s.stateCacheMissCount,
+		"state.filter_skip_count":          s.stateFilterSkipCount,
+		"state.loaded_count":               s.stateLoadedCount,
+		"state.written_count":              s.stateWrittenCount,
+		"state.snapshot_bytes":             int64(s.stateSnapshotSize),
+		"state.pruned_count":               s.statePrunedCount,
+		"retention_annotation.error_count": s.retentionAnnotationErrorCount,
+		"retention.success_count":          s.retentionSuccessCount,
+		"retention.error_count":            s.retentionErrorCount,
+		"retention.beyond_horizon_count":   s.retentionHorizonCount,
+		"delete.count":                     s.deleteCount,
+		"delete.bytes":                     int64(s.deleteSize),
+		"delete.success_count":             s.deleteSuccessCount,
+		"delete.error_count":               s.deleteErrorCount,
+		"delete.retry_count":               s.deleteRetryCount,
+		"delete.quarantined_count":         s.quarantinedCount,
+		"delete.barrier_skipped_count":     s.retentionBarrierSkippedCount,
+		"delete.plan_drift_count":          s.planDriftCount,
+	}
+
+	for operation, count := range s.apiRequests {
+		result["api."+operation+".count"] = count
+	}
+
+	for _, class := range client.ErrorClasses {
+		result[errorClassCounterName(class)] = s.errorClassCounts[class]
+	}
+
+	result[workerPanicCounterName] = s.workerPanicCount
+
+	for stage, timing := range s.stageTimings {
+		name := pipelineStage(stage).String()
+
+		result["stage."+name+".wall_ms"] = time.Duration(timing.wall).Milliseconds()
+		result["stage."+name+".busy_ms"] = time.Duration(timing.busy).Milliseconds()
+	}
+
+	return result
+}
+
+// CountersSince returns the difference between the current counter values and
+// an earlier snapshot.
+func (s *Stats) CountersSince(before map[string]int64) map[string]int64 {
+	result := s.Counters()
+
+	for name, value := range before {
+		result[name] -= value
+	}
+
+	return result
+}
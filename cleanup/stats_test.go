@@ -0,0 +1,686 @@
+package cleanup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/google/go-cmp/cmp"
+	"github.com/hansmi/s3-object-cleanup/internal/client"
+)
+
+func TestTimeRange(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		values    []time.Time
+		wantLower time.Time
+		wantUpper time.Time
+	}{
+		{name: "empty"},
+		{
+			name:   "zeroes",
+			values: []time.Time{{}, {}, {}},
+		},
+		{
+			name: "one",
+			values: []time.Time{
+				time.Date(2020, time.December, 1, 2, 3, 4, 0, time.UTC),
+			},
+			wantLower: time.Date(2020, time.December, 1, 2, 3, 4, 0, time.UTC),
+			wantUpper: time.Date(2020, time.December, 1, 2, 3, 4, 0, time.UTC),
+		},
+		{
+			name: "three",
+			values: []time.Time{
+				time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2020, time.December, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+				time.Date(2020, time.April, 1, 0, 0, 0, 0, time.UTC),
+			},
+			wantLower: time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+			wantUpper: time.Date(2020, time.December, 1, 0, 0, 0, 0, time.UTC),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var r timeRange
+
+			for _, i := range tc.values {
+				r.update(i)
+			}
+
+			want := slog.GroupValue(
+				slog.Time("lower", tc.wantLower),
+				slog.Time("upper", tc.wantUpper),
+			)
+
+			if diff := cmp.Diff(want, r.LogValue()); diff != "" {
+				t.Errorf("timeRange diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAgeHistogram(t *testing.T) {
+	var h ageHistogram
+
+	for _, age := range []time.Duration{
+		-time.Hour,
+		0,
+		24*time.Hour - 1,
+		24 * time.Hour,
+		45 * 24 * time.Hour,
+		730 * 24 * time.Hour,
+		5000 * 24 * time.Hour,
+	} {
+		h.add(age)
+	}
+
+	if diff := cmp.Diff(ageHistogram{3, 1, 0, 1, 0, 0, 0, 2}, h); diff != "" {
+		t.Errorf("ageHistogram diff (-want +got):\n%s", diff)
+	}
+
+	want := slog.GroupValue(
+		slog.Int64("lt_1d", 3),
+		slog.Int64("lt_7d", 1),
+		slog.Int64("lt_30d", 0),
+		slog.Int64("lt_90d", 1),
+		slog.Int64("lt_180d", 0),
+		slog.Int64("lt_365d", 0),
+		slog.Int64("lt_730d", 0),
+		slog.Int64("ge_730d", 2),
+	)
+
+	if diff := cmp.Diff(want, h.LogValue()); diff != "" {
+		t.Errorf("LogValue() diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestStats(t *testing.T) {
+	type timeRangeStructure struct {
+		Lower *time.Time `json:"lower"`
+		Upper *time.Time `json:"upper"`
+	}
+
+	type sizeStatsStructure struct {
+		Bytes *int64  `json:"bytes"`
+		Text  *string `json:"text"`
+	}
+
+	type durationStatsStructure struct {
+		Seconds *float64 `json:"seconds"`
+		Text    *string  `json:"text"`
+	}
+
+	type stageTimingStructure struct {
+		Wall *durationStatsStructure `json:"wall"`
+		Busy *durationStatsStructure `json:"busy"`
+	}
+
+	// Missing attributes are detected via the use of pointers.
+	type structure struct {
+		Listed *struct {
+			Count          *int64 `json:"count"`
+			PageRetryCount *int64 `json:"page_retry_count"`
+			PartialCount   *int64 `json:"partial_count"`
+		} `json:"listed"`
+		Total *struct {
+			Count             *int64              `json:"count"`
+			Size              *sizeStatsStructure `json:"size"`
+			NoncurrentSize    *sizeStatsStructure `json:"noncurrent_size"`
+			ModTime           *timeRangeStructure `json:"mod_time"`
+			RetainUntil       *timeRangeStructure `json:"retain_until"`
+			LatestModTime     *timeRangeStructure `json:"latest_mod_time"`
+			LatestRetainUntil *timeRangeStructure `json:"latest_retain_until"`
+			Age               map[string]int64    `json:"age"`
+		} `json:"total"`
+		Excluded *struct {
+			Count           *int64 `json:"count"`
+			MetadataCount   *int64 `json:"metadata_count"`
+			EncryptionCount *int64 `json:"encryption_count"`
+			MinVersionsKeys *int64 `json:"min_versions_key_count"`
+			ProtectedCount  *int64 `json:"protected_count"`
+		} `json:"excluded"`
+		Throttled *struct {
+			Count *int64 `json:"count"`
+		} `json:"throttled"`
+		Errors *struct {
+			Throttling    *int64 `json:"throttling_count"`
+			AccessDenied  *int64 `json:"access_denied_count"`
+			NotFound      *int64 `json:"not_found_count"`
+			LockViolation *int64 `json:"lock_violation_count"`
+			Network       *int64 `json:"network_count"`
+			Other         *int64 `json:"other_count"`
+			Panic         *int64 `json:"panic_count"`
+		} `json:"errors"`
+		Inventory *struct {
+			NewCount       *int64 `json:"new_count"`
+			UnchangedCount *int64 `json:"unchanged_count"`
+			RemovedCount   *int64 `json:"removed_count"`
+		} `json:"inventory"`
+		Incremental *struct {
+			SkippedKeyCount *int64 `json:"skipped_key_count"`
+		} `json:"incremental"`
+		State *struct {
+			PrunedCount     *int64              `json:"pruned_count"`
+			CacheHitCount   *int64              `json:"cache_hit_count"`
+			CacheMissCount  *int64              `json:"cache_miss_count"`
+			FilterSkipCount *int64              `json:"filter_skip_count"`
+			LoadedCount     *int64              `json:"loaded_count"`
+			WrittenCount    *int64              `json:"written_count"`
+			SnapshotSize    *sizeStatsStructure `json:"snapshot_size"`
+		} `json:"state"`
+		RetentionAnnotation *struct {
+			ErrorCount *int64 `json:"error_count"`
+		} `json:"retention_annotation"`
+		Retention *struct {
+			SuccessCount   *int64              `json:"success_count"`
+			ErrorCount     *int64              `json:"error_count"`
+			BeyondHorizon  *int64              `json:"beyond_horizon_count"`
+			ModTime        *timeRangeStructure `json:"mod_time"`
+			Original       *timeRangeStructure `json:"original"`
+			LatestModTime  *timeRangeStructure `json:"latest_mod_time"`
+			LatestOriginal *timeRangeStructure `json:"latest_original"`
+		} `json:"retention"`
+		Delete *struct {
+			Count        *int64              `json:"count"`
+			Size         *sizeStatsStructure `json:"size"`
+			SuccessCount *int64              `json:"success_count"`
+			ErrorCount   *int64              `json:"error_count"`
+			RetryCount   *int64              `json:"retry_count"`
+			Quarantined  *int64              `json:"quarantined_count"`
+			BarrierSkip  *int64              `json:"barrier_skipped_count"`
+			PlanDrift    *int64              `json:"plan_drift_count"`
+			ModTime      *timeRangeStructure `json:"mod_time"`
+			RetainUntil  *timeRangeStructure `json:"retain_until"`
+			Age          map[string]int64    `json:"age"`
+		} `json:"delete"`
+		Stages *struct {
+			Listing    *stageTimingStructure `json:"listing"`
+			Annotation *stageTimingStructure `json:"annotation"`
+			Retention  *stageTimingStructure `json:"retention"`
+			Deletion   *stageTimingStructure `json:"deletion"`
+		} `json:"stages"`
+		API *struct {
+			RequestCount     *int64           `json:"request_count"`
+			EstimatedCostUSD *float64         `json:"estimated_cost_usd"`
+			Requests         map[string]int64 `json:"requests"`
+		} `json:"api"`
+	}
+
+	for _, tc := range []struct {
+		name    string
+		prepare func(t *testing.T, s *Stats)
+		want    string
+	}{
+		{
+			name: "empty",
+			want: `{
+				"listed": {
+					"count": 0,
+					"page_retry_count": 0,
+					"partial_count": 0
+				},
+				"total": {
+					"count": 0,
+					"size": {
+						"bytes": 0,
+						"text": "0 B"
+					},
+					"noncurrent_size": {
+						"bytes": 0,
+						"text": "0 B"
+					},
+					"mod_time": {
+						"lower": "0001-01-01T00:00:00Z",
+						"upper": "0001-01-01T00:00:00Z"
+					},
+					"retain_until": {
+						"lower": "0001-01-01T00:00:00Z",
+						"upper": "0001-01-01T00:00:00Z"
+					},
+					"latest_mod_time": {
+						"lower": "0001-01-01T00:00:00Z",
+						"upper": "0001-01-01T00:00:00Z"
+					},
+					"latest_retain_until": {
+						"lower": "0001-01-01T00:00:00Z",
+						"upper": "0001-01-01T00:00:00Z"
+					},
+					"age": {"lt_1d": 0, "lt_7d": 0, "lt_30d": 0, "lt_90d": 0, "lt_180d": 0, "lt_365d": 0, "lt_730d": 0, "ge_730d": 0}
+				},
+				"excluded": {
+					"count": 0,
+					"metadata_count": 0,
+					"encryption_count": 0,
+					"min_versions_key_count": 0,
+					"protected_count": 0
+				},
+				"throttled": {
+					"count": 0
+				},
+				"errors": {
+					"throttling_count": 0,
+					"access_denied_count": 0,
+					"not_found_count": 0,
+					"lock_violation_count": 0,
+					"network_count": 0,
+					"other_count": 0,
+					"panic_count": 0
+				},
+				"inventory": {
+					"new_count": 0,
+					"unchanged_count": 0,
+					"removed_count": 0
+				},
+				"incremental": {
+					"skipped_key_count": 0
+				},
+				"state": {
+					"pruned_count": 0,
+					"cache_hit_count": 0,
+					"cache_miss_count": 0,
+					"filter_skip_count": 0,
+					"loaded_count": 0,
+					"written_count": 0,
+					"snapshot_size": {
+						"bytes": 0,
+						"text": "0 B"
+					}
+				},
+				"retention_annotation": {
+					"error_count": 0
+				},
+				"retention": {
+					"success_count": 0,
+					"error_count": 0,
+					"beyond_horizon_count": 0,
+					"mod_time": {
+						"lower": "0001-01-01T00:00:00Z",
+						"upper": "0001-01-01T00:00:00Z"
+					},
+					"original": {
+						"lower": "0001-01-01T00:00:00Z",
+						"upper": "0001-01-01T00:00:00Z"
+					},
+					"latest_mod_time": {
+						"lower": "0001-01-01T00:00:00Z",
+						"upper": "0001-01-01T00:00:00Z"
+					},
+					"latest_original": {
+						"lower": "0001-01-01T00:00:00Z",
+						"upper": "0001-01-01T00:00:00Z"
+					}
+				},
+				"delete": {
+					"count": 0,
+					"size": {
+						"bytes": 0,
+						"text": "0 B"
+					},
+					"success_count": 0,
+					"error_count": 0,
+					"retry_count": 0,
+					"quarantined_count": 0,
+					"barrier_skipped_count": 0,
+					"plan_drift_count": 0,
+					"mod_time": {
+						"lower": "0001-01-01T00:00:00Z",
+						"upper": "0001-01-01T00:00:00Z"
+					},
+					"retain_until": {
+						"lower": "0001-01-01T00:00:00Z",
+						"upper": "0001-01-01T00:00:00Z"
+					},
+					"age": {"lt_1d": 0, "lt_7d": 0, "lt_30d": 0, "lt_90d": 0, "lt_180d": 0, "lt_365d": 0, "lt_730d": 0, "ge_730d": 0}
+				},
+				"stages": {
+					"listing": {"wall": {"seconds": 0, "text": "0s"}, "busy": {"seconds": 0, "text": "0s"}},
+					"annotation": {"wall": {"seconds": 0, "text": "0s"}, "busy": {"seconds": 0, "text": "0s"}},
+					"retention": {"wall": {"seconds": 0, "text": "0s"}, "busy": {"seconds": 0, "text": "0s"}},
+					"deletion": {"wall": {"seconds": 0, "text": "0s"}, "busy": {"seconds": 0, "text": "0s"}}
+				},
+				"api": {"request_count": 0, "estimated_cost_usd": 0}
+			}`,
+		},
+		{
+			name: "populated",
+			prepare: func(_ *testing.T, s *Stats) {
+				s.now = func() time.Time {
+					return time.Date(2021, time.March, 31, 0, 0, 0, 0, time.UTC)
+				}
+				s.discovered(objectVersion{
+					size:         2 * 1024 * 1024,
+					lastModified: time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC),
+					retainUntil:  time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC),
+				})
+				s.discovered(objectVersion{
+					size:         5 * 1024 * 1024,
+					lastModified: time.Date(2011, time.October, 1, 0, 0, 0, 0, time.UTC),
+					retainUntil:  time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC),
+				})
+				s.discovered(objectVersion{
+					isLatest:     true,
+					lastModified: time.Date(2013, time.January, 1, 0, 0, 0, 0, time.UTC),
+					retainUntil:  time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC),
+				})
+				s.addExcluded()
+				s.addMetadataExcluded()
+				s.addEncryptionExcluded()
+				s.addThrottled()
+				s.addThrottled()
+				s.addError(&smithy.GenericAPIError{Code: "SlowDown"})
+				s.addError(os.ErrInvalid)
+				s.addError(fmt.Errorf("%w: test", ErrWorkerPanic))
+				s.addErrorClass(client.ErrorClassLockViolation)
+				s.addErrorClass(client.ErrorClassLockViolation)
+				s.addListed(4)
+				s.addListPageRetry()
+				s.addPartial()
+				s.AddAPIRequest("ListObjectVersions")
+				s.AddAPIRequest("ListObjectVersions")
+				s.AddAPIRequest("GetObjectRetention")
+				s.AddAPIRequest("DeleteObjects")
+				s.AddAPIRequest("DeleteObjects")
+				s.addStageTimings([stageCount]stageTiming{
+					stageListing:    {wall: DurationStats(time.Second), busy: DurationStats(time.Second)},
+					stageAnnotation: {wall: DurationStats(3 * time.Second), busy: DurationStats(10 * time.Second)},
+					stageRetention:  {wall: DurationStats(3 * time.Second)},
+					stageDeletion:   {wall: DurationStats(4 * time.Second), busy: DurationStats(time.Second)},
+				})
+				s.addStageTimings([stageCount]stageTiming{
+					stageListing:    {wall: DurationStats(time.Second), busy: DurationStats(time.Second)},
+					stageAnnotation: {busy: DurationStats(500 * time.Millisecond)},
+				})
+				s.addInventoryNew()
+				s.addInventoryUnchanged()
+				s.addInventoryRemoved(3)
+				s.addIncrementalSkipped()
+				s.addStatePruned(4)
+				s.addStateCacheHit()
+				s.addStateCacheHit()
+				s.addStateCacheMiss()
+				s.addStateFilterSkip()
+				s.addStateFilterSkip()
+				s.AddStateLoaded(100)
+				s.AddStateWritten(120)
+				s.AddStateSnapshot(2048)
+				s.addRetention(objectVersion{
+					lastModified: time.Date(2012, time.October, 1, 0, 0, 0, 0, time.UTC),
+					retainUntil:  time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC),
+				})
+				s.addRetention(objectVersion{
+					isLatest:     true,
+					lastModified: time.Date(2014, time.April, 1, 0, 0, 0, 0, time.UTC),
+					retainUntil:  time.Date(2020, time.May, 1, 0, 0, 0, 0, time.UTC),
+				})
+				s.addDelete(objectVersion{
+					size:         3 * 1024 * 1024,
+					lastModified: time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC),
+					retainUntil:  time.Date(2023, time.February, 1, 0, 0, 0, 0, time.UTC),
+				})
+				s.addDeleteResults(10, 20)
+				s.addDeleteRetries(5)
+				s.addQuarantined()
+				s.addRetentionBarrierSkipped(2)
+				s.addPlanDrift()
+				s.addRetentionBeyondHorizon()
+				s.addMinVersionsSkipped()
+				s.addProtected()
+			},
+			want: `{
+				"listed": {
+					"count": 4,
+					"page_retry_count": 1,
+					"partial_count": 1
+				},
+				"total": {
+					"count": 3,
+					"size": {
+						"bytes": 7340032,
+						"text": "7.0 MiB"
+					},
+					"noncurrent_size": {
+						"bytes": 7340032,
+						"text": "7.0 MiB"
+					},
+					"mod_time": {
+						"lower": "2011-10-01T00:00:00Z",
+						"upper": "2015-01-01T00:00:00Z"
+					},
+					"retain_until": {
+						"lower": "2018-01-01T00:00:00Z",
+						"upper": "2019-01-01T00:00:00Z"
+					},
+					"latest_mod_time": {
+						"lower": "2013-01-01T00:00:00Z",
+						"upper": "2013-01-01T00:00:00Z"
+					},
+					"latest_retain_until": {
+						"lower": "2018-01-01T00:00:00Z",
+						"upper": "2018-01-01T00:00:00Z"
+					},
+					"age": {"lt_1d": 0, "lt_7d": 0, "lt_30d": 0, "lt_90d": 0, "lt_180d": 0, "lt_365d": 0, "lt_730d": 0, "ge_730d": 3}
+				},
+				"excluded": {
+					"count": 1,
+					"metadata_count": 1,
+					"encryption_count": 1,
+					"min_versions_key_count": 1,
+					"protected_count": 1
+				},
+				"throttled": {
+					"count": 2
+				},
+				"errors": {
+					"throttling_count": 1,
+					"access_denied_count": 0,
+					"not_found_count": 0,
+					"lock_violation_count": 2,
+					"network_count": 0,
+					"other_count": 1,
+					"panic_count": 1
+				},
+				"inventory": {
+					"new_count": 1,
+					"unchanged_count": 1,
+					"removed_count": 3
+				},
+				"incremental": {
+					"skipped_key_count": 1
+				},
+				"state": {
+					"pruned_count": 4,
+					"cache_hit_count": 2,
+					"cache_miss_count": 1,
+					"filter_skip_count": 2,
+					"loaded_count": 100,
+					"written_count": 120,
+					"snapshot_size": {
+						"bytes": 2048,
+						"text": "2.0 KiB"
+					}
+				},
+				"retention_annotation": {
+					"error_count": 0
+				},
+				"retention": {
+					"success_count": 2,
+					"error_count": 0,
+					"beyond_horizon_count": 1,
+					"mod_time": {
+						"lower": "2012-10-01T00:00:00Z",
+						"upper": "2014-04-01T00:00:00Z"
+					},
+					"original": {
+						"lower": "2019-01-01T00:00:00Z",
+						"upper": "2020-05-01T00:00:00Z"
+					},
+					"latest_mod_time": {
+						"lower": "2014-04-01T00:00:00Z",
+						"upper": "2014-04-01T00:00:00Z"
+					},
+					"latest_original": {
+						"lower": "2020-05-01T00:00:00Z",
+						"upper": "2020-05-01T00:00:00Z"
+					}
+				},
+				"delete": {
+					"count": 1,
+					"size": {
+						"bytes": 3145728,
+						"text": "3.0 MiB"
+					},
+					"success_count": 10,
+					"error_count": 20,
+					"retry_count": 5,
+					"quarantined_count": 1,
+					"barrier_skipped_count": 2,
+					"plan_drift_count": 1,
+					"mod_time": {
+						"lower": "2021-03-01T00:00:00Z",
+						"upper": "2021-03-01T00:00:00Z"
+					},
+					"retain_until": {
+						"lower": "2023-02-01T00:00:00Z",
+						"upper": "2023-02-01T00:00:00Z"
+					},
+					"age": {"lt_1d": 0, "lt_7d": 0, "lt_30d": 0, "lt_90d": 1, "lt_180d": 0, "lt_365d": 0, "lt_730d": 0, "ge_730d": 0}
+				},
+				"stages": {
+					"listing": {"wall": {"seconds": 2, "text": "2s"}, "busy": {"seconds": 2, "text": "2s"}},
+					"annotation": {"wall": {"seconds": 3, "text": "3s"}, "busy": {"seconds": 10.5, "text": "10.5s"}},
+					"retention": {"wall": {"seconds": 3, "text": "3s"}, "busy": {"seconds": 0, "text": "0s"}},
+					"deletion": {"wall": {"seconds": 4, "text": "4s"}, "busy": {"seconds": 1, "text": "1s"}}
+				},
+				"api": {"request_count": 5, "estimated_cost_usd": 0.0000104, "requests": {"DeleteObjects": 2, "GetObjectRetention": 1, "ListObjectVersions": 2}}
+			}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			s := NewStats()
+
+			if tc.prepare != nil {
+				tc.prepare(t, s)
+			}
+
+			h := slog.New(slog.NewJSONHandler(&buf, nil))
+			h.Info("test", s.Attrs()...)
+
+			var got structure
+
+			if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatalf("Unmarshal() failed: %v", err)
+			}
+
+			var want structure
+
+			if err := json.Unmarshal([]byte(tc.want), &want); err != nil {
+				t.Fatalf("Unmarshal(%q) failed: %v", tc.want, err)
+			}
+
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("Log message diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCountersSince(t *testing.T) {
+	s := NewStats()
+	s.discovered(objectVersion{size: 100})
+
+	before := s.Counters()
+
+	s.discovered(objectVersion{size: 20})
+	s.addDelete(objectVersion{size: 20})
+	s.addDeleteResults(1, 0)
+
+	got := s.CountersSince(before)
+
+	for name, want := range map[string]int64{
+		"total.count":          1,
+		"total.bytes":          20,
+		"delete.count":         1,
+		"delete.bytes":         20,
+		"delete.success_count": 1,
+		"delete.error_count":   0,
+	} {
+		if got[name] != want {
+			t.Errorf("Counter %q is %d, want %d", name, got[name], want)
+		}
+	}
+}
+
+func TestStatsMerge(t *testing.T) {
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	first := NewStats()
+	first.discovered(objectVersion{size: 100, isLatest: true})
+	first.AddAPIRequest("ListObjectVersions")
+	first.addErrorClass(client.ErrorClassNetwork)
+
+	second := NewStats()
+	second.now = func() time.Time { return now }
+	second.discovered(objectVersion{size: 20, lastModified: now.Add(-48 * time.Hour)})
+	second.addDelete(objectVersion{size: 20, lastModified: now.Add(-48 * time.Hour)})
+	second.addDeleteResults(1, 0)
+	second.AddAPIRequest("ListObjectVersions")
+	second.AddStateWritten(3)
+
+	s := NewStats()
+	s.Merge(first)
+	s.Merge(second)
+
+	got := s.Counters()
+
+	for name, want := range map[string]int64{
+		"total.count":                  2,
+		"total.bytes":                  120,
+		"total.noncurrent_bytes":       20,
+		"delete.count":                 1,
+		"delete.bytes":                 20,
+		"delete.success_count":         1,
+		"api.ListObjectVersions.count": 2,
+		"errors.network_count":         1,
+		"state.written_count":          3,
+	} {
+		if got[name] != want {
+			t.Errorf("Counter %q is %d, want %d", name, got[name], want)
+		}
+	}
+
+	if want := now.Add(-48 * time.Hour); !s.deleteModTime.lower.Equal(want) {
+		t.Errorf("Lower deletion modification time is %v, want %v", s.deleteModTime.lower, want)
+	}
+
+	if s.deleteAge[1] != 1 {
+		t.Errorf("Deletion age histogram is %v, want one version below 7 days", s.deleteAge)
+	}
+}
+
+func TestErrorAttrs(t *testing.T) {
+	s := NewStats()
+	s.addErrorClass(client.ErrorClassNetwork)
+
+	before := s.Counters()
+
+	s.addErrorClass(client.ErrorClassAccessDenied)
+	s.addErrorClass(client.ErrorClassAccessDenied)
+	s.addErrorClass(client.ErrorClassNotFound)
+
+	want := []any{
+		slog.Int64("access_denied_count", 2),
+		slog.Int64("not_found_count", 1),
+	}
+
+	if diff := cmp.Diff(want, ErrorAttrs(s.CountersSince(before))); diff != "" {
+		t.Errorf("ErrorAttrs() diff (-want +got):\n%s", diff)
+	}
+}
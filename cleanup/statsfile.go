@@ -0,0 +1,152 @@
+package cleanup
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"os"
+	"time"
+)
+
+// Version of the statistics file format. The minor version is incremented for
+// backwards-compatible additions, the major version for all other changes.
+// See stats.schema.json.
+const statsFormatVersion = "1.0"
+
+// StatsBucket describes the processing of a single bucket within a run.
+type StatsBucket struct {
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Failed     bool
+
+	// Counters of the bucket as returned by [Stats.Counters] for the
+	// statistics of the bucket alone.
+	Counters map[string]int64
+}
+
+// StatsRun describes the run whose statistics are written to a file.
+type StatsRun struct {
+	RunID       string
+	DryRun      bool
+	Interrupted bool
+	StartedAt   time.Time
+	FinishedAt  time.Time
+
+	Buckets map[string]StatsBucket
+
+	// Largest deletions of the run. Written as an empty list if nil.
+	LargestDeletions *LargestDeletions
+}
+
+type statsTimeRange struct {
+	Lower time.Time `json:"lower"`
+	Upper time.Time `json:"upper"`
+}
+
+type statsBucket struct {
+	StartedAt  time.Time        `json:"started_at"`
+	FinishedAt time.Time        `json:"finished_at"`
+	Failed     bool             `json:"failed"`
+	Counters   map[string]int64 `json:"counters"`
+}
+
+// statsDocument is the JSON representation of the statistics described by
+// stats.schema.json. Unlike the log message it doesn't change with the
+// formatting of log attributes.
+type statsDocument struct {
+	FormatVersion    string                      `json:"format_version"`
+	RunID            string                      `json:"run_id"`
+	DryRun           bool                        `json:"dry_run"`
+	Interrupted      bool                        `json:"interrupted"`
+	StartedAt        time.Time                   `json:"started_at"`
+	FinishedAt       time.Time                   `json:"finished_at"`
+	Counters         map[string]int64            `json:"counters"`
+	TimeRanges       map[string]statsTimeRange   `json:"time_ranges"`
+	AgeHistograms    map[string]map[string]int64 `json:"age_histograms"`
+	Buckets          map[string]statsBucket      `json:"buckets"`
+	LargestDeletions []LargestDeletion           `json:"largest_deletions"`
+}
+
+func (s *Stats) document(run StatsRun) statsDocument {
+	doc := statsDocument{
+		FormatVersion:    statsFormatVersion,
+		RunID:            run.RunID,
+		DryRun:           run.DryRun,
+		Interrupted:      run.Interrupted,
+		StartedAt:        run.StartedAt.UTC(),
+		FinishedAt:       run.FinishedAt.UTC(),
+		Counters:         s.Counters(),
+		TimeRanges:       map[string]statsTimeRange{},
+		Buckets:          map[string]statsBucket{},
+		LargestDeletions: []LargestDeletion{},
+	}
+
+	s.mu.Lock()
+
+	for name, r := range map[string]timeRange{
+		"total.mod_time":            s.totalModTime,
+		"total.retain_until":        s.totalRetainUntil,
+		"total.latest_mod_time":     s.totalLatestModTime,
+		"total.latest_retain_until": s.totalLatestRetainUntil,
+		"retention.mod_time":        s.retentionModTime,
+		"retention.original":        s.retentionOriginal,
+		"retention.latest_mod_time": s.retentionLatestModTime,
+		"retention.latest_original": s.retentionLatestOriginal,
+		"delete.mod_time":           s.deleteModTime,
+		"delete.retain_until":       s.deleteRetainUntil,
+	} {
+		// Ranges without any value are omitted.
+		if !r.lower.IsZero() {
+			doc.TimeRanges[name] = statsTimeRange{Lower: r.lower.UTC(), Upper: r.upper.UTC()}
+		}
+	}
+
+	doc.AgeHistograms = map[string]map[string]int64{
+		"total":  s.totalAge.counts(),
+		"delete": s.deleteAge.counts(),
+	}
+
+	s.mu.Unlock()
+
+	for name, b := range run.Buckets {
+		doc.Buckets[name] = statsBucket{
+			StartedAt:  b.StartedAt.UTC(),
+			FinishedAt: b.FinishedAt.UTC(),
+			Failed:     b.Failed,
+			Counters:   maps.Clone(b.Counters),
+		}
+	}
+
+	if run.LargestDeletions != nil {
+		doc.LargestDeletions = append(doc.LargestDeletions, run.LargestDeletions.Sorted()...)
+	}
+
+	return doc
+}
+
+func (s *Stats) writeJSON(w io.Writer, run StatsRun) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(s.document(run))
+}
+
+// WriteFile writes the statistics of a run as a JSON document for ingestion
+// by reporting jobs. A path of "-" refers to standard output.
+func (s *Stats) WriteFile(path string, run StatsRun) (err error) {
+	if path == "-" {
+		return s.writeJSON(os.Stdout, run)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err = errors.Join(err, f.Close())
+	}()
+
+	return s.writeJSON(f, run)
+}
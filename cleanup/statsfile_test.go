@@ -0,0 +1,198 @@
+package cleanup
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestStatsJSON(t *testing.T) {
+	now := time.Date(2021, time.March, 31, 0, 0, 0, 0, time.UTC)
+	lastModified := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	s := NewStats()
+	s.now = func() time.Time { return now }
+
+	ov := objectVersion{key: "key", versionID: "v1", size: 2048, lastModified: lastModified}
+
+	s.discovered(ov)
+	s.discovered(objectVersion{key: "key", versionID: "v2", size: 10, lastModified: now})
+	s.addDelete(ov)
+
+	largest := NewLargestDeletions(1)
+	largest.now = s.now
+	largest.ForBucket("bucket").addDelete(ov)
+
+	var buf bytes.Buffer
+
+	if err := s.writeJSON(&buf, StatsRun{
+		RunID:      "run",
+		DryRun:     true,
+		StartedAt:  now,
+		FinishedAt: now.Add(time.Minute),
+		Buckets: map[string]StatsBucket{
+			"bucket": {
+				StartedAt:  now,
+				FinishedAt: now.Add(time.Minute),
+				Counters:   map[string]int64{"delete.count": 1},
+			},
+		},
+		LargestDeletions: largest,
+	}); err != nil {
+		t.Fatalf("writeJSON() failed: %v", err)
+	}
+
+	var got map[string]any
+
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+
+	counters := got["counters"].(map[string]any)
+
+	for name, want := range map[string]float64{
+		"total.count":  2,
+		"total.bytes":  2058,
+		"delete.count": 1,
+		"delete.bytes": 2048,
+	} {
+		if counters[name] != want {
+			t.Errorf("Counter %q is %v, want %v", name, counters[name], want)
+		}
+	}
+
+	delete(got, "counters")
+
+	want := map[string]any{
+		"format_version": statsFormatVersion,
+		"run_id":         "run",
+		"dry_run":        true,
+		"interrupted":    false,
+		"started_at":     "2021-03-31T00:00:00Z",
+		"finished_at":    "2021-03-31T00:01:00Z",
+		"time_ranges": map[string]any{
+			"total.mod_time":  map[string]any{"lower": "2021-03-01T00:00:00Z", "upper": "2021-03-31T00:00:00Z"},
+			"delete.mod_time": map[string]any{"lower": "2021-03-01T00:00:00Z", "upper": "2021-03-01T00:00:00Z"},
+		},
+		"age_histograms": map[string]any{
+			"total": map[string]any{
+				"lt_1d": 1.0, "lt_7d": 0.0, "lt_30d": 0.0, "lt_90d": 1.0,
+				"lt_180d": 0.0, "lt_365d": 0.0, "lt_730d": 0.0, "ge_730d": 0.0,
+			},
+			"delete": map[string]any{
+				"lt_1d": 0.0, "lt_7d": 0.0, "lt_30d": 0.0, "lt_90d": 1.0,
+				"lt_180d": 0.0, "lt_365d": 0.0, "lt_730d": 0.0, "ge_730d": 0.0,
+			},
+		},
+		"buckets": map[string]any{
+			"bucket": map[string]any{
+				"started_at":  "2021-03-31T00:00:00Z",
+				"finished_at": "2021-03-31T00:01:00Z",
+				"failed":      false,
+				"counters":    map[string]any{"delete.count": 1.0},
+			},
+		},
+		"largest_deletions": []any{
+			map[string]any{
+				"bucket": "bucket", "key": "key", "version_id": "v1", "size": 2048.0,
+				"size_text": "2.0 KiB", "last_modified": "2021-03-01T00:00:00Z", "age_days": 30.0,
+			},
+		},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Statistics diff (-want +got):\n%s", diff)
+	}
+
+	if err := s.WriteFile(filepath.Join(t.TempDir(), "stats.json"), StatsRun{}); err != nil {
+		t.Errorf("WriteFile() failed: %v", err)
+	}
+}
+
+func TestStatsJSONEmpty(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := NewStats().writeJSON(&buf, StatsRun{}); err != nil {
+		t.Fatalf("writeJSON() failed: %v", err)
+	}
+
+	for _, want := range []string{`"largest_deletions": []`, `"buckets": {}`, `"time_ranges": {}`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Empty statistics lack %s:\n%s", want, buf.String())
+		}
+	}
+}
+
+// TestStatsSchema ensures the schema stays in sync with the written documents.
+func TestStatsSchema(t *testing.T) {
+	content, err := os.ReadFile("stats.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var schema struct {
+		Required   []string       `json:"required"`
+		Properties map[string]any `json:"properties"`
+		Defs       map[string]struct {
+			Required   []string       `json:"required"`
+			Properties map[string]any `json:"properties"`
+		} `json:"$defs"`
+	}
+
+	if err := json.Unmarshal(content, &schema); err != nil {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name       string
+		value      any
+		required   []string
+		properties map[string]any
+	}{
+		{"document", statsDocument{}, schema.Required, schema.Properties},
+		{"time_range", statsTimeRange{}, schema.Defs["time_range"].Required, schema.Defs["time_range"].Properties},
+		{"bucket", statsBucket{}, schema.Defs["bucket"].Required, schema.Defs["bucket"].Properties},
+		{"largest_deletion", LargestDeletion{}, schema.Defs["largest_deletion"].Required, schema.Defs["largest_deletion"].Properties},
+	} {
+		var names, required []string
+
+		typ := reflect.TypeOf(tc.value)
+
+		for i := range typ.NumField() {
+			name, opts, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+
+			names = append(names, name)
+
+			if opts != "omitempty" {
+				required = append(required, name)
+			}
+		}
+
+		var properties []string
+
+		for name := range tc.properties {
+			properties = append(properties, name)
+		}
+
+		if diff := cmp.Diff(names, properties, cmpopts.SortSlices(strings.Compare)); diff != "" {
+			t.Errorf("%s: properties diff (-want +got):\n%s", tc.name, diff)
+		}
+
+		if diff := cmp.Diff(required, tc.required, cmpopts.SortSlices(strings.Compare)); diff != "" {
+			t.Errorf("%s: required properties diff (-want +got):\n%s", tc.name, diff)
+		}
+	}
+
+	if got := schema.Properties["format_version"].(map[string]any)["pattern"]; !regexp.MustCompile(got.(string)).MatchString(statsFormatVersion) {
+		t.Errorf("Format version %q doesn't match schema pattern %q", statsFormatVersion, got)
+	}
+}
@@ -0,0 +1,117 @@
+package cleanup
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type pipelineStage int
+
+const (
+	stageListing pipelineStage = iota
+	stageAnnotation
+	stageRetention
+	stageDeletion
+
+	stageCount
+)
+
+var pipelineStageNames = [stageCount]string{
+	stageListing:    "listing",
+	stageAnnotation: "annotation",
+	stageRetention:  "retention",
+	stageDeletion:   "deletion",
+}
+
+func (s pipelineStage) String() string {
+	return pipelineStageNames[s]
+}
+
+// DurationStats logs a duration in seconds and a human-readable form.
+type DurationStats time.Duration
+
+var _ slog.LogValuer = (*DurationStats)(nil)
+
+func (d DurationStats) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Float64("seconds", time.Duration(d).Seconds()),
+		slog.String("text", time.Duration(d).Round(time.Millisecond).String()),
+	)
+}
+
+// stageTiming is the time taken by a pipeline stage.
+type stageTiming struct {
+	// Time from the start of the pipeline until the stage finished.
+	wall DurationStats
+
+	// Time spent processing items, summed across all workers.
+	busy DurationStats
+}
+
+func (t stageTiming) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Any("wall", t.wall),
+		slog.Any("busy", t.busy),
+	)
+}
+
+// stageTimer measures the stages of the pipeline processing a bucket. A nil
+// timer ignores all measurements.
+type stageTimer struct {
+	mu      sync.Mutex
+	started time.Time
+	timings [stageCount]stageTiming
+}
+
+func newStageTimer() *stageTimer {
+	return &stageTimer{
+		started: time.Now(),
+	}
+}
+
+// finished records the wall-clock time of a stage.
+func (t *stageTimer) finished(stage pipelineStage) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	t.timings[stage].wall = DurationStats(time.Since(t.started))
+	t.mu.Unlock()
+}
+
+// track measures the time until the returned function is invoked as busy
+// time of the stage.
+func (t *stageTimer) track(stage pipelineStage) func() {
+	if t == nil {
+		return func() {}
+	}
+
+	start := time.Now()
+
+	return func() {
+		elapsed := time.Since(start)
+
+		t.mu.Lock()
+		t.timings[stage].busy += DurationStats(elapsed)
+		t.mu.Unlock()
+	}
+}
+
+func (t *stageTimer) result() [stageCount]stageTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.timings
+}
+
+func stageTimingAttrs(timings [stageCount]stageTiming) []any {
+	var attrs []any
+
+	for stage, timing := range timings {
+		attrs = append(attrs, slog.Any(pipelineStage(stage).String(), timing))
+	}
+
+	return attrs
+}
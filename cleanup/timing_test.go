@@ -0,0 +1,37 @@
+package cleanup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStageTimer(t *testing.T) {
+	var nilTimer *stageTimer
+
+	nilTimer.finished(stageListing)
+	nilTimer.track(stageDeletion)()
+
+	timer := newStageTimer()
+
+	for range 2 {
+		done := timer.track(stageAnnotation)
+		time.Sleep(time.Millisecond)
+		done()
+	}
+
+	timer.finished(stageAnnotation)
+
+	got := timer.result()
+
+	if busy := time.Duration(got[stageAnnotation].busy); busy < 2*time.Millisecond {
+		t.Errorf("Annotation busy time is %v, want at least 2ms", busy)
+	}
+
+	if wall := time.Duration(got[stageAnnotation].wall); wall < time.Duration(got[stageAnnotation].busy) {
+		t.Errorf("Annotation wall time %v is less than busy time", wall)
+	}
+
+	if got[stageListing] != (stageTiming{}) {
+		t.Errorf("Listing timing is %+v, want zero", got[stageListing])
+	}
+}
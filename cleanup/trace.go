@@ -0,0 +1,130 @@
+package cleanup
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Rules explaining the decision for a single version in the decision trace.
+const (
+	ruleLatestUnknown        = "latest_unknown"
+	ruleNewerThanLatest      = "newer_than_latest"
+	ruleLatest               = "latest"
+	ruleDeleteMarkerSkip     = "delete_marker_skip"
+	ruleDeleteMarkerKeep     = "delete_marker_keep"
+	ruleDeleteMarkerExpire   = "delete_marker_expire"
+	ruleDeleteMarkerPending  = "delete_marker_pending"
+	rulePrecedesDeleteMarker = "precedes_delete_marker"
+	ruleMinAge               = "min_age"
+	ruleRetentionActive      = "retention_active"
+	ruleNewerThanKept        = "newer_than_kept"
+	ruleExpired              = "expired"
+	ruleMaxNoncurrent        = "max_noncurrent_versions"
+
+	// Decided by a custom policy.
+	rulePolicy = "policy"
+)
+
+// versionRule is the rule which fired for a version and the point in time it
+// was evaluated against, e.g. the end of the minimum age.
+type versionRule struct {
+	name string
+	at   time.Time
+}
+
+// versionRules records the rules per version of a series. A nil value is
+// valid and records nothing.
+type versionRules []versionRule
+
+func newVersionRules(enabled bool, count int) versionRules {
+	if !enabled {
+		return nil
+	}
+
+	return make(versionRules, count)
+}
+
+func (r versionRules) set(idx int, name string, at time.Time) {
+	if r != nil {
+		r[idx] = versionRule{name: name, at: at}
+	}
+}
+
+// setRange sets the rule for all versions in the half-open range [from, to).
+func (r versionRules) setRange(from, to int, name string, at time.Time) {
+	for idx := from; idx < to; idx++ {
+		r.set(idx, name, at)
+	}
+}
+
+// traceDecision logs the timeline of a key at debug level with the action and
+// the rule for each version, oldest first. Expired versions are reported as
+// retained if keepExpired is set, i.e. to leave the minimum number of
+// versions.
+func (p *processor) traceDecision(key string, s *versionSeries, now time.Time, result versionSeriesResult, keepExpired bool) {
+	ctx := context.Background()
+
+	if !(p.traceDecisions && p.logger.Enabled(ctx, slog.LevelDebug)) {
+		return
+	}
+
+	expired := map[string]bool{}
+
+	for _, ov := range result.expired {
+		expired[ov.stateVersionID()] = true
+	}
+
+	extended := map[string]time.Time{}
+
+	for _, req := range result.retention {
+		extended[req.object.stateVersionID()] = req.until
+	}
+
+	p.logger.DebugContext(ctx, "Decision trace",
+		slog.String("key", key),
+		slog.Int("versions", len(s.items)),
+		slog.Bool("have_latest", s.haveLatest),
+		slog.Time("now", now),
+		slog.Time("min_age_cutoff", now.Add(-p.minDeletionAge)),
+	)
+
+	for idx, ov := range s.items {
+		rule := versionRule{name: rulePolicy}
+
+		if idx < len(result.rules) {
+			rule = result.rules[idx]
+		}
+
+		attrs := []any{
+			slog.String("key", key),
+			slog.Int("index", idx),
+			slog.String("version", ov.versionID),
+			slog.Time("last_modified", ov.lastModified),
+			slog.Bool("latest", ov.isLatest),
+			slog.Bool("delete_marker", ov.deleteMarker),
+			slog.Time("retain_until", ov.retainUntil),
+		}
+
+		id := ov.stateVersionID()
+
+		if until, ok := extended[id]; ok {
+			attrs = append(attrs, slog.String("action", actionExtend), slog.Time("until", until))
+		} else if !expired[id] {
+			attrs = append(attrs, slog.String("action", "retain"))
+		} else if keepExpired {
+			attrs = append(attrs, slog.String("action", "retain"))
+			rule = versionRule{name: actionReasonMinVersions}
+		} else {
+			attrs = append(attrs, slog.String("action", actionDelete))
+		}
+
+		attrs = append(attrs, slog.String("rule", rule.name))
+
+		if !rule.at.IsZero() {
+			attrs = append(attrs, slog.Time("rule_time", rule.at))
+		}
+
+		p.logger.DebugContext(ctx, "Decision trace version", attrs...)
+	}
+}
@@ -0,0 +1,209 @@
+package cleanup
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestVersionSeriesFinalizeRules(t *testing.T) {
+	now := time.Date(2001, time.March, 10, 0, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name     string
+		items    []objectVersion
+		strategy DeleteMarkerStrategy
+		maxCount int
+		want     []string
+	}{
+		{
+			name: "latest unknown",
+			items: []objectVersion{
+				{lastModified: now.AddDate(0, -2, 0)},
+			},
+			want: []string{ruleLatestUnknown},
+		},
+		{
+			name: "ages",
+			items: []objectVersion{
+				{lastModified: now.AddDate(0, -3, 0)},
+				{lastModified: now.AddDate(0, -2, 0)},
+				{lastModified: now.AddDate(0, 0, -5)},
+				{lastModified: now.AddDate(0, 0, -4)},
+				{lastModified: now.AddDate(0, 0, -3), isLatest: true},
+			},
+			want: []string{ruleExpired, ruleExpired, ruleMinAge, ruleNewerThanKept, ruleLatest},
+		},
+		{
+			name: "retention",
+			items: []objectVersion{
+				{lastModified: now.AddDate(0, -3, 0), retainUntil: now.AddDate(0, 0, 1)},
+				{lastModified: now.AddDate(0, -2, 0)},
+				{lastModified: now.AddDate(0, -1, 0), isLatest: true},
+			},
+			want: []string{ruleRetentionActive, ruleNewerThanKept, ruleLatest},
+		},
+		{
+			name: "max noncurrent",
+			items: []objectVersion{
+				{lastModified: now.AddDate(0, 0, -5)},
+				{lastModified: now.AddDate(0, 0, -4)},
+				{lastModified: now.AddDate(0, 0, -3), isLatest: true},
+			},
+			maxCount: 1,
+			want:     []string{ruleMaxNoncurrent, ruleMinAge, ruleLatest},
+		},
+		{
+			name: "pending delete marker",
+			items: []objectVersion{
+				{lastModified: now.AddDate(0, -3, 0)},
+				{lastModified: now.AddDate(0, -2, 0)},
+				{lastModified: now.AddDate(0, 0, -1), deleteMarker: true, isLatest: true},
+			},
+			want: []string{ruleExpired, rulePrecedesDeleteMarker, ruleDeleteMarkerPending},
+		},
+		{
+			name: "expire delete marker",
+			items: []objectVersion{
+				{lastModified: now.AddDate(0, -3, 0)},
+				{lastModified: now.AddDate(0, 0, -1), deleteMarker: true, isLatest: true},
+			},
+			strategy: DeleteMarkerExpire,
+			want:     []string{ruleExpired, ruleDeleteMarkerExpire},
+		},
+		{
+			name: "keep delete marker",
+			items: []objectVersion{
+				{lastModified: now.AddDate(0, -3, 0)},
+				{lastModified: now.AddDate(0, 0, -1), deleteMarker: true, isLatest: true},
+			},
+			strategy: DeleteMarkerKeep,
+			want:     []string{ruleExpired, ruleDeleteMarkerKeep},
+		},
+		{
+			name: "skip delete marker",
+			items: []objectVersion{
+				{lastModified: now.AddDate(0, -3, 0)},
+				{lastModified: now.AddDate(0, 0, -1), deleteMarker: true, isLatest: true},
+			},
+			strategy: DeleteMarkerSkip,
+			want:     []string{ruleDeleteMarkerSkip, ruleDeleteMarkerSkip},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var s versionSeries
+
+			for _, ov := range tc.items {
+				s.add(ov)
+			}
+
+			result := s.finalize(versionSeriesFinalizeOptions{
+				now:                   now,
+				minRetention:          24 * time.Hour,
+				minDeletionAge:        30 * 24 * time.Hour,
+				maxNoncurrentVersions: tc.maxCount,
+				deleteMarkers:         tc.strategy,
+				trace:                 true,
+			})
+
+			var got []string
+
+			for _, r := range result.rules {
+				got = append(got, r.name)
+			}
+
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Rules diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestVersionSeriesFinalizeRulesDisabled(t *testing.T) {
+	s := versionSeries{
+		items:      []objectVersion{{lastModified: time.Now(), isLatest: true}},
+		haveLatest: true,
+	}
+
+	if result := s.finalize(versionSeriesFinalizeOptions{now: time.Now()}); result.rules != nil {
+		t.Errorf("Rules recorded without trace: %v", result.rules)
+	}
+}
+
+func TestProcessorTraceDecision(t *testing.T) {
+	now := time.Now()
+
+	var buf bytes.Buffer
+
+	p := newProcessor(processorOptions{
+		logger: slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{
+			Level: slog.LevelDebug,
+		})),
+		stats:                NewStats(),
+		minDeletionAge:       24 * time.Hour,
+		minSurvivingVersions: 2,
+		traceDecisions:       true,
+	})
+
+	in := make(chan objectVersion, 8)
+	retentionCh := make(chan retentionExtenderRequest, 8)
+	deleteCh := make(chan objectVersion, 8)
+
+	in <- objectVersion{key: "key", versionID: "old", lastModified: now.Add(-72 * time.Hour)}
+	in <- objectVersion{key: "key", versionID: "new", lastModified: now.Add(-48 * time.Hour), isLatest: true}
+	in <- objectVersion{key: "other", versionID: "a", lastModified: now.Add(-96 * time.Hour)}
+	in <- objectVersion{key: "other", versionID: "b", lastModified: now.Add(-72 * time.Hour)}
+	in <- objectVersion{key: "other", versionID: "c", lastModified: now.Add(-12 * time.Hour)}
+	in <- objectVersion{key: "other", versionID: "d", lastModified: now.Add(-time.Hour), isLatest: true}
+	close(in)
+
+	if err := p.run(in, retentionCh, deleteCh); err != nil {
+		t.Errorf("run() failed: %v", err)
+	}
+
+	type record struct {
+		Msg     string `json:"msg"`
+		Key     string `json:"key"`
+		Version string `json:"version"`
+		Action  string `json:"action"`
+		Rule    string `json:"rule"`
+	}
+
+	var got []record
+
+	for dec := json.NewDecoder(&buf); dec.More(); {
+		var r record
+
+		if err := dec.Decode(&r); err != nil {
+			t.Fatalf("Decode() failed: %v", err)
+		}
+
+		if r.Msg == "Decision trace version" {
+			got = append(got, r)
+		}
+	}
+
+	want := []record{
+		{"Decision trace version", "key", "old", "retain", actionReasonMinVersions},
+		{"Decision trace version", "key", "new", "extend", ruleLatest},
+		{"Decision trace version", "other", "a", "delete", ruleExpired},
+		{"Decision trace version", "other", "b", "delete", ruleExpired},
+		{"Decision trace version", "other", "c", "retain", ruleMinAge},
+		{"Decision trace version", "other", "d", "extend", ruleLatest},
+	}
+
+	// Keys are finalized in no particular order once the input ends.
+	slices.SortStableFunc(got, func(a, b record) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Trace diff (-want +got):\n%s", diff)
+	}
+}
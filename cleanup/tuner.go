@@ -0,0 +1,203 @@
+package cleanup
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Number of workers per stage unless adjusted by Options.MaxWorkers.
+const DefaultWorkers = 4
+
+type workerTunerOptions struct {
+	logger *slog.Logger
+
+	// Name of the pipeline stage for logging.
+	name string
+
+	// Throttling signalled via the backoff reduces concurrency.
+	backoff *adaptiveBackoff
+
+	// Upper bound for concurrently active workers.
+	maxWorkers int
+}
+
+// workerTuner limits the number of concurrently active workers of a pipeline
+// stage. The limit grows while the average latency stays close to the lowest
+// latency observed and shrinks when latency rises or S3 signals throttling.
+type workerTuner struct {
+	logger  *slog.Logger
+	name    string
+	backoff *adaptiveBackoff
+	max     int
+
+	mu     sync.Mutex
+	limit  int
+	active int
+
+	// Closed and replaced whenever workers may become active.
+	wake chan struct{}
+
+	samples  int
+	total    time.Duration
+	baseline time.Duration
+}
+
+// newWorkerTuner returns a tuner or nil if tuning is disabled.
+func newWorkerTuner(opts workerTunerOptions) *workerTuner {
+	if opts.maxWorkers <= 0 {
+		return nil
+	}
+
+	if opts.logger == nil {
+		opts.logger = slog.Default()
+	}
+
+	t := &workerTuner{
+		logger:  opts.logger,
+		name:    opts.name,
+		backoff: opts.backoff,
+		max:     opts.maxWorkers,
+		limit:   min(DefaultWorkers, opts.maxWorkers),
+		wake:    make(chan struct{}),
+	}
+
+	return t
+}
+
+// workers returns the number of workers to start. It's the default number if
+// the tuner is nil.
+func (t *workerTuner) workers() int {
+	if t == nil {
+		return DefaultWorkers
+	}
+
+	return t.max
+}
+
+func (t *workerTuner) currentLimit() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.limit
+}
+
+// acquire blocks until the worker may become active. The returned function
+// must be invoked once the work item has been processed and the time in
+// between is observed as latency. An error is returned if the context is
+// cancelled while waiting.
+func (t *workerTuner) acquire(ctx context.Context) (func(), error) {
+	release, err := t.acquireSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+
+	return func() {
+		release()
+		t.observe(time.Since(start))
+	}, nil
+}
+
+// acquireSlot is like acquire, but leaves observing the latency to the
+// caller, e.g. to exclude time spent waiting for rate limits.
+func (t *workerTuner) acquireSlot(ctx context.Context) (func(), error) {
+	if t == nil {
+		return func() {}, nil
+	}
+
+	for {
+		t.mu.Lock()
+
+		if t.active < t.limit {
+			t.active++
+			t.mu.Unlock()
+
+			return t.release, nil
+		}
+
+		wake := t.wake
+
+		t.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, context.Cause(ctx)
+		case <-wake:
+		}
+	}
+}
+
+// broadcast wakes up all waiting workers. The lock must be held.
+func (t *workerTuner) broadcast() {
+	close(t.wake)
+	t.wake = make(chan struct{})
+}
+
+func (t *workerTuner) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.active--
+	t.broadcast()
+}
+
+// observe records the latency of a request.
+func (t *workerTuner) observe(latency time.Duration) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.samples++
+	t.total += latency
+
+	// Adjust once enough samples at the current limit have been observed.
+	if t.samples >= max(8, 2*t.limit) {
+		previous := t.limit
+
+		t.adjust(t.total / time.Duration(t.samples))
+
+		t.samples = 0
+		t.total = 0
+
+		if t.limit > previous {
+			t.broadcast()
+		}
+	}
+}
+
+func (t *workerTuner) adjust(avg time.Duration) {
+	previous := t.limit
+
+	switch {
+	case t.backoff != nil && t.backoff.current() > 0:
+		t.limit = max(1, t.limit/2)
+
+	case t.baseline == 0 || avg <= t.baseline*3/2:
+		t.limit = min(t.max, t.limit+1)
+
+	case avg > 2*t.baseline:
+		t.limit = max(1, t.limit-1)
+	}
+
+	if t.baseline == 0 || avg < t.baseline {
+		t.baseline = avg
+	} else {
+		// Follow lasting latency increases slowly, e.g. due to larger
+		// objects.
+		t.baseline += (avg - t.baseline) / 8
+	}
+
+	if t.limit != previous {
+		t.logger.Debug("Adjusted worker limit",
+			slog.String("stage", t.name),
+			slog.Int("limit", t.limit),
+			slog.Duration("latency", avg),
+		)
+	}
+}
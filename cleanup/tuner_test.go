@@ -0,0 +1,140 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWorkerTunerDisabled(t *testing.T) {
+	tuner := newWorkerTuner(workerTunerOptions{})
+
+	if tuner != nil {
+		t.Fatalf("newWorkerTuner() returned tuner without maximum")
+	}
+
+	if got := tuner.workers(); got != DefaultWorkers {
+		t.Errorf("workers() = %d, want %d", got, DefaultWorkers)
+	}
+
+	release, err := tuner.acquire(t.Context())
+	if err != nil {
+		t.Fatalf("acquire() failed: %v", err)
+	}
+
+	release()
+	tuner.observe(time.Second)
+}
+
+func TestWorkerTunerAdjust(t *testing.T) {
+	backoff := newAdaptiveBackoff(nil)
+
+	tuner := newWorkerTuner(workerTunerOptions{
+		backoff:    backoff,
+		maxWorkers: 8,
+	})
+
+	if got := tuner.workers(); got != 8 {
+		t.Errorf("workers() = %d, want 8", got)
+	}
+
+	for _, step := range []struct {
+		latency   time.Duration
+		throttled bool
+		want      int
+	}{
+		{latency: 10 * time.Millisecond, want: 5},
+		{latency: 12 * time.Millisecond, want: 6},
+		{latency: 10 * time.Millisecond, want: 7},
+		{latency: 10 * time.Millisecond, want: 8},
+		{latency: 10 * time.Millisecond, want: 8},
+		// Moderately slower
+		{latency: 18 * time.Millisecond, want: 8},
+		{latency: 40 * time.Millisecond, want: 7},
+		{latency: 10 * time.Millisecond, throttled: true, want: 3},
+		{latency: 10 * time.Millisecond, throttled: true, want: 1},
+		{latency: 10 * time.Millisecond, throttled: true, want: 1},
+		{latency: 10 * time.Millisecond, want: 2},
+	} {
+		if step.throttled {
+			backoff.throttled()
+		} else {
+			backoff.delay = 0
+		}
+
+		tuner.mu.Lock()
+		tuner.adjust(step.latency)
+		tuner.mu.Unlock()
+
+		if got := tuner.currentLimit(); got != step.want {
+			t.Errorf("Limit after %v (throttled %t) is %d, want %d", step.latency, step.throttled, got, step.want)
+		}
+	}
+}
+
+func TestWorkerTunerLimit(t *testing.T) {
+	tuner := newWorkerTuner(workerTunerOptions{
+		maxWorkers: 2,
+	})
+
+	var mu sync.Mutex
+	var active, peak int
+
+	var wg sync.WaitGroup
+
+	for range 16 {
+		wg.Go(func() {
+			release, err := tuner.acquire(t.Context())
+			if err != nil {
+				t.Errorf("acquire() failed: %v", err)
+				return
+			}
+
+			defer release()
+
+			mu.Lock()
+			active++
+			peak = max(peak, active)
+			mu.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mu.Lock()
+			active--
+			mu.Unlock()
+		})
+	}
+
+	wg.Wait()
+
+	if peak > 2 {
+		t.Errorf("Up to %d workers were active, want at most 2", peak)
+	}
+}
+
+func TestWorkerTunerCancel(t *testing.T) {
+	tuner := newWorkerTuner(workerTunerOptions{
+		maxWorkers: 1,
+	})
+
+	release, err := tuner.acquire(t.Context())
+	if err != nil {
+		t.Fatalf("acquire() failed: %v", err)
+	}
+
+	defer release()
+
+	ctx, cancel := context.WithCancelCause(t.Context())
+	cause := errors.New("test")
+
+	time.AfterFunc(time.Millisecond, func() {
+		cancel(cause)
+	})
+
+	// Blocks until cancelled as the only worker is active.
+	if _, err := tuner.acquireSlot(ctx); !errors.Is(err, cause) {
+		t.Errorf("acquireSlot() returned %v, want %v", err, cause)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	"github.com/hansmi/s3-object-cleanup/internal/state"
+)
+
+// Credentials are refreshed this long before they expire. Requests signed
+// shortly before the expiry, e.g. long multipart uploads or retried
+// requests, would fail otherwise.
+const credentialExpiryWindow = 5 * time.Minute
+
+// Time reserved at the end of a credential session for processing the
+// versions listed so far and persisting the state.
+const credentialSessionMargin = 15 * time.Minute
+
+func setCredentialsCacheOptions(o *aws.CredentialsCacheOptions) {
+	o.ExpiryWindow = credentialExpiryWindow
+}
+
+// ssoCachedToken is the part of an SSO access token cached by the AWS CLI and
+// SDKs relevant for refreshing credentials.
+type ssoCachedToken struct {
+	ExpiresAt time.Time `json:"expiresAt"`
+
+	// Only tokens of an "sso-session" configuration come with a refresh
+	// token. The SDK renews them automatically.
+	RefreshToken string `json:"refreshToken"`
+}
+
+func readSSOCachedToken(path string) (ssoCachedToken, error) {
+	var result ssoCachedToken
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return result, err
+	}
+
+	if err := json.Unmarshal(content, &result); err != nil {
+		return result, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return result, nil
+}
+
+// ssoTokenCacheKey returns the key of the cached SSO access token used by a
+// profile. Empty if the profile doesn't use SSO.
+func ssoTokenCacheKey(c config.SharedConfig) string {
+	if c.SSOSession != nil {
+		return c.SSOSession.Name
+	}
+
+	return c.SSOStartURL
+}
+
+// loadedSharedConfig returns the shared configuration profile the
+// configuration was loaded with, i.e. the one selected by AWS_PROFILE,
+// AWS_DEFAULT_PROFILE or an explicit option.
+func loadedSharedConfig(cfg aws.Config) (config.SharedConfig, bool) {
+	for _, src := range cfg.ConfigSources {
+		switch c := src.(type) {
+		case config.SharedConfig:
+			return c, true
+		case *config.SharedConfig:
+			return *c, true
+		}
+	}
+
+	return config.SharedConfig{}, false
+}
+
+// credentialSession describes how long the credentials of a run remain
+// usable.
+type credentialSession struct {
+	source string
+
+	// Expiry of the current credentials. Zero if they don't expire.
+	expires time.Time
+
+	// Time after which the credentials can no longer be refreshed without
+	// user interaction, e.g. because the SSO access token expires and "aws
+	// sso login" must be run again. Zero if unlimited or unknown.
+	end time.Time
+}
+
+// inspectCredentials retrieves the default credentials ahead of the run and
+// determines until when they can be refreshed.
+func inspectCredentials(ctx context.Context, cfg aws.Config) (credentialSession, error) {
+	var result credentialSession
+
+	if cfg.Credentials == nil {
+		return result, nil
+	}
+
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	result.source = creds.Source
+
+	if creds.CanExpire {
+		result.expires = creds.Expires
+	}
+
+	if creds.Source != ssocreds.ProviderName {
+		return result, nil
+	}
+
+	profile, ok := loadedSharedConfig(cfg)
+	if !ok {
+		return result, nil
+	}
+
+	key := ssoTokenCacheKey(profile)
+	if key == "" {
+		return result, nil
+	}
+
+	path, err := ssocreds.StandardCachedTokenFilepath(key)
+	if err != nil {
+		return result, err
+	}
+
+	token, err := readSSOCachedToken(path)
+	if err != nil {
+		return result, fmt.Errorf("SSO token cache: %w", err)
+	}
+
+	if token.RefreshToken == "" {
+		result.end = token.ExpiresAt
+	}
+
+	return result, nil
+}
+
+// listDeadline returns the time at which listing must stop for the
+// credentials to outlast the run. The given deadline is returned if it's
+// earlier or the session doesn't end.
+func (s credentialSession) listDeadline(deadline time.Time) time.Time {
+	if s.end.IsZero() {
+		return deadline
+	}
+
+	limit := s.end.Add(-credentialSessionMargin)
+
+	if deadline.IsZero() || limit.Before(deadline) {
+		return limit
+	}
+
+	return deadline
+}
+
+// estimateRunDuration returns the duration of the most recent complete run.
+// Zero if there is none.
+func estimateRunDuration(history []state.RunStats) time.Duration {
+	for idx := len(history) - 1; idx >= 0; idx-- {
+		if s := history[idx]; s.Complete && s.FinishedAt.After(s.StartedAt) {
+			return s.FinishedAt.Sub(s.StartedAt)
+		}
+	}
+
+	return 0
+}
+
+// checkRunDuration warns if the previous run of a bucket took longer than the
+// remaining credential session. Listing is then likely to reach the deadline
+// derived from the session, leaving the remaining keys to the next run.
+func (s credentialSession) checkRunDuration(logger *slog.Logger, history []state.RunStats, now time.Time) {
+	if s.end.IsZero() {
+		return
+	}
+
+	estimate := estimateRunDuration(history)
+
+	if estimate == 0 || now.Add(estimate).Before(s.end) {
+		return
+	}
+
+	logger.Warn("Estimated run duration exceeds remaining credential session; listing may not complete before the list deadline",
+		slog.Duration("estimate", estimate),
+		slog.Time("session_end", s.end),
+		slog.Duration("remaining", s.end.Sub(now)))
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/google/go-cmp/cmp"
+	"github.com/hansmi/s3-object-cleanup/internal/state"
+)
+
+func TestReadSSOCachedToken(t *testing.T) {
+	path := writeTestFile(t, "token.json", `{
+  "startUrl": "https://example.awsapps.com/start",
+  "region": "eu-west-1",
+  "accessToken": "secret",
+  "expiresAt": "2024-03-01T08:00:00Z",
+  "refreshToken": "refresh"
+}`)
+
+	got, err := readSSOCachedToken(path)
+	if err != nil {
+		t.Fatalf("readSSOCachedToken() failed: %v", err)
+	}
+
+	want := ssoCachedToken{
+		ExpiresAt:    time.Date(2024, time.March, 1, 8, 0, 0, 0, time.UTC),
+		RefreshToken: "refresh",
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Token diff (-want +got):\n%s", diff)
+	}
+
+	if _, err := readSSOCachedToken(writeTestFile(t, "bad.json", "{")); err == nil {
+		t.Error("readSSOCachedToken() succeeded for malformed file")
+	}
+}
+
+func TestSSOTokenCacheKey(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		cfg  config.SharedConfig
+		want string
+	}{
+		{name: "no sso"},
+		{
+			name: "legacy",
+			cfg:  config.SharedConfig{SSOStartURL: "https://example.awsapps.com/start"},
+			want: "https://example.awsapps.com/start",
+		},
+		{
+			name: "session",
+			cfg: config.SharedConfig{
+				SSOSessionName: "corp",
+				SSOSession:     &config.SSOSession{Name: "corp", SSOStartURL: "https://example.awsapps.com/start"},
+			},
+			want: "corp",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ssoTokenCacheKey(tc.cfg); got != tc.want {
+				t.Errorf("ssoTokenCacheKey() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadedSharedConfig(t *testing.T) {
+	if _, ok := loadedSharedConfig(aws.Config{}); ok {
+		t.Errorf("loadedSharedConfig() found profile in empty configuration")
+	}
+
+	cfg := aws.Config{
+		ConfigSources: []any{
+			config.EnvConfig{SharedConfigProfile: "work"},
+			config.SharedConfig{Profile: "work", SSOStartURL: "https://example.awsapps.com/start"},
+		},
+	}
+
+	got, ok := loadedSharedConfig(cfg)
+	if !ok {
+		t.Fatalf("loadedSharedConfig() found no profile")
+	}
+
+	if got.Profile != "work" || ssoTokenCacheKey(got) != "https://example.awsapps.com/start" {
+		t.Errorf("loadedSharedConfig() returned %+v", got)
+	}
+}
+
+func TestInspectCredentials(t *testing.T) {
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	got, err := inspectCredentials(t.Context(), aws.Config{
+		Credentials: credentials.StaticCredentialsProvider{
+			Value: aws.Credentials{
+				AccessKeyID:     "AKID",
+				SecretAccessKey: "secret",
+				Source:          "test",
+				CanExpire:       true,
+				Expires:         expires,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("inspectCredentials() failed: %v", err)
+	}
+
+	want := credentialSession{
+		source:  "test",
+		expires: expires,
+	}
+
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(credentialSession{})); diff != "" {
+		t.Errorf("Session diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestCredentialSessionListDeadline(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	end := now.Add(time.Hour)
+	limit := end.Add(-credentialSessionMargin)
+
+	for _, tc := range []struct {
+		name     string
+		end      time.Time
+		deadline time.Time
+		want     time.Time
+	}{
+		{name: "unlimited"},
+		{
+			name:     "unlimited session",
+			deadline: now,
+			want:     now,
+		},
+		{
+			name: "session only",
+			end:  end,
+			want: limit,
+		},
+		{
+			name:     "earlier deadline",
+			end:      end,
+			deadline: now.Add(time.Minute),
+			want:     now.Add(time.Minute),
+		},
+		{
+			name:     "later deadline",
+			end:      end,
+			deadline: end,
+			want:     limit,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := credentialSession{end: tc.end}.listDeadline(tc.deadline)
+
+			if !got.Equal(tc.want) {
+				t.Errorf("listDeadline() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCredentialSessionCheckRunDuration(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	history := []state.RunStats{
+		{StartedAt: now.Add(-72 * time.Hour), FinishedAt: now.Add(-70 * time.Hour), Complete: true},
+		{StartedAt: now.Add(-48 * time.Hour), FinishedAt: now.Add(-48*time.Hour + 30*time.Minute), Complete: true},
+		{StartedAt: now.Add(-24 * time.Hour), FinishedAt: now.Add(-21 * time.Hour), Failed: true},
+		{StartedAt: now.Add(-12 * time.Hour), FinishedAt: now.Add(-12*time.Hour + 5*time.Minute)},
+	}
+
+	if got := estimateRunDuration(history); got != 30*time.Minute {
+		t.Errorf("estimateRunDuration() = %v, want 30m", got)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		end      time.Time
+		history  []state.RunStats
+		wantWarn bool
+	}{
+		{name: "unlimited", history: history},
+		{name: "no history", end: now.Add(time.Minute)},
+		{name: "sufficient", end: now.Add(time.Hour), history: history},
+		{name: "insufficient", end: now.Add(20 * time.Minute), history: history, wantWarn: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			credentialSession{end: tc.end}.checkRunDuration(slog.New(slog.NewTextHandler(&buf, nil)), tc.history, now)
+
+			if got := strings.Contains(buf.String(), "level=WARN"); got != tc.wantWarn {
+				t.Errorf("checkRunDuration() warned %t, want %t:\n%s", got, tc.wantWarn, buf.String())
+			}
+		})
+	}
+}
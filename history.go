@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/hansmi/s3-object-cleanup/internal/state"
+)
+
+// Number of runs kept in the statistics history of each bucket.
+const statsHistoryKeep = 1000
+
+// recordRunStats appends the statistics of a cleanup run to the history in
+// the bucket state.
+func recordRunStats(s *state.Store, bucket string, stats state.RunStats) error {
+	bucketState, err := s.Bucket(bucket)
+	if err != nil {
+		return err
+	}
+
+	if err := bucketState.AppendRunStats(stats, statsHistoryKeep); err != nil {
+		return fmt.Errorf("recording statistics history: %w", err)
+	}
+
+	return nil
+}
+
+// bucketRunStatsHistory returns the recorded statistics of previous runs.
+func bucketRunStatsHistory(s *state.Store, bucket string) ([]state.RunStats, error) {
+	bucketState, err := s.Bucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return bucketState.RunStatsHistory()
+}
+
+func formatSizeChange(delta int64) string {
+	if delta < 0 {
+		return "-" + humanize.IBytes(uint64(-delta))
+	}
+
+	return "+" + humanize.IBytes(uint64(delta))
+}
+
+// writeStatsHistory prints a table with one line per run. The size change is
+// relative to the previous complete run.
+func writeStatsHistory(w io.Writer, history []state.RunStats) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "Started\tDuration\tMode\tVersions\tSize\tChange\tDeleted\tDeleted size\tErrors")
+
+	var previous *state.RunStats
+
+	for idx, i := range history {
+		mode := "delete"
+
+		if i.DryRun {
+			mode = "dry-run"
+		}
+
+		if i.Failed {
+			mode += " (failed)"
+		}
+
+		change := "-"
+
+		if previous != nil {
+			change = formatSizeChange(i.Counters["total.bytes"] - previous.Counters["total.bytes"])
+		}
+
+		if i.Complete {
+			previous = &history[idx]
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%d\t%s\t%d\n",
+			i.StartedAt.UTC().Format(time.DateTime),
+			i.FinishedAt.Sub(i.StartedAt).Round(time.Second),
+			mode,
+			i.Counters["total.count"],
+			humanize.IBytes(uint64(max(0, i.Counters["total.bytes"]))),
+			change,
+			i.Counters["delete.success_count"],
+			humanize.IBytes(uint64(max(0, i.Counters["delete.bytes"]))),
+			i.Counters["retention.error_count"]+i.Counters["delete.error_count"],
+		)
+	}
+
+	return tw.Flush()
+}
+
+// statsHistory prints the statistics history of the given buckets from the
+// persisted state.
+func (p *program) statsHistory(ctx context.Context, bucketNames []string) error {
+	return p.printBucketStates(ctx, "stats history", bucketNames, func(w io.Writer, b *state.Bucket) error {
+		history, err := b.RunStatsHistory()
+		if err != nil {
+			return err
+		}
+
+		return writeStatsHistory(w, history)
+	})
+}
+
+// printBucketStates prints a section for each of the given buckets, or those
+// of the bucket config file, with the output of fn for its persisted state.
+func (p *program) printBucketStates(ctx context.Context, command string, bucketNames []string, fn func(io.Writer, *state.Bucket) error) error {
+	idx := 0
+
+	return p.forEachBucketState(ctx, command, bucketNames, func(bucket string, b *state.Bucket) error {
+		if idx > 0 {
+			fmt.Println()
+		}
+
+		idx++
+
+		fmt.Printf("Bucket %s:\n", bucket)
+
+		if err := fn(os.Stdout, b); err != nil {
+			return fmt.Errorf("%s: %w", bucket, err)
+		}
+
+		return nil
+	})
+}
+
+// forEachBucketState opens the persisted state of the given buckets, or those
+// of the bucket config file, and invokes fn for each of them. The state is
+// discarded afterwards.
+func (p *program) forEachBucketState(ctx context.Context, command string, bucketNames []string, fn func(string, *state.Bucket) error) (err error) {
+	if err := p.validate(slog.Default()); err != nil {
+		return err
+	}
+
+	if p.persistenceBucket == "" {
+		return fmt.Errorf("%s requires persistence_bucket", command)
+	}
+
+	cfg, err := p.loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Buckets are resolved like in cleanup runs for their state to be found
+	// under the same name.
+	clients, err := p.bucketClients(cfg, bucketNames)
+	if err != nil {
+		return err
+	}
+
+	if len(clients) == 0 {
+		return fmt.Errorf("no buckets specified")
+	}
+
+	c, err := p.persistenceClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	var encKey *state.EncryptionKey
+
+	if p.stateEncryptionKeyFile != "" {
+		if encKey, err = state.ReadEncryptionKeyFile(p.stateEncryptionKeyFile); err != nil {
+			return fmt.Errorf("state_encryption_key_file: %w", err)
+		}
+	}
+
+	tmpdir, err := os.MkdirTemp("", "")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err = errors.Join(err, os.RemoveAll(tmpdir))
+	}()
+
+	states := newStateManager(stateManagerOptions{
+		logger: slog.Default(),
+		tmpdir: tmpdir,
+		client: c,
+		encKey: encKey,
+		shard:  p.parsed.shard,
+	})
+
+	defer func() {
+		err = errors.Join(err, states.release())
+	}()
+
+	for _, bc := range clients {
+		if err := withBucketState(ctx, states, bc.Name(), fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func withBucketState(ctx context.Context, states *stateManager, bucket string, fn func(string, *state.Bucket) error) (err error) {
+	h, err := states.open(ctx, bucket, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", bucket, err)
+	}
+
+	defer func() {
+		err = errors.Join(err, states.discard(h))
+	}()
+
+	bucketState, err := h.store.Bucket(bucket)
+	if err != nil {
+		return fmt.Errorf("%s: %w", bucket, err)
+	}
+
+	return fn(bucket, bucketState)
+}
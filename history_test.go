@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hansmi/s3-object-cleanup/internal/state"
+)
+
+func TestWriteStatsHistory(t *testing.T) {
+	base := time.Date(2020, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	var buf strings.Builder
+
+	if err := writeStatsHistory(&buf, []state.RunStats{
+		{
+			StartedAt:  base,
+			FinishedAt: base.Add(time.Minute),
+			DryRun:     true,
+			Complete:   true,
+			Counters: map[string]int64{
+				"total.count": 10,
+				"total.bytes": 2048,
+			},
+		},
+		{
+			StartedAt:  base.Add(24 * time.Hour),
+			FinishedAt: base.Add(24*time.Hour + 2*time.Second),
+			Failed:     true,
+			Counters: map[string]int64{
+				"total.count":        3,
+				"total.bytes":        10,
+				"delete.error_count": 1,
+			},
+		},
+		{
+			StartedAt:  base.Add(48 * time.Hour),
+			FinishedAt: base.Add(48*time.Hour + time.Hour),
+			Counters: map[string]int64{
+				"total.count":          12,
+				"total.bytes":          1024,
+				"delete.success_count": 2,
+				"delete.bytes":         512,
+			},
+		},
+		{
+			StartedAt:  base.Add(72 * time.Hour),
+			FinishedAt: base.Add(72*time.Hour + time.Hour),
+			Complete:   true,
+			Counters: map[string]int64{
+				"total.count": 11,
+				"total.bytes": 512,
+			},
+		},
+	}); err != nil {
+		t.Errorf("writeStatsHistory() failed: %v", err)
+	}
+
+	want := []string{
+		"Started              Duration  Mode             Versions  Size     Change    Deleted  Deleted size  Errors",
+		"2020-03-01 12:00:00  1m0s      dry-run          10        2.0 KiB  -         0        0 B           0",
+		"2020-03-02 12:00:00  2s        delete (failed)  3         10 B     -2.0 KiB  0        0 B           1",
+		"2020-03-03 12:00:00  1h0m0s    delete           12        1.0 KiB  -1.0 KiB  2        512 B         0",
+		"2020-03-04 12:00:00  1h0m0s    delete           11        512 B    -1.5 KiB  0        0 B           0",
+	}
+
+	var got []string
+
+	for _, line := range strings.Split(strings.TrimRight(buf.String(), "\n"), "\n") {
+		got = append(got, strings.TrimRight(line, " "))
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("writeStatsHistory() diff (-want +got):\n%s", diff)
+	}
+}
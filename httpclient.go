@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+)
+
+// Networks tried in order when connecting, by address family name.
+var addressFamilyNetworks = map[string][]string{
+	"any":         nil,
+	"ipv4":        {"tcp4"},
+	"ipv6":        {"tcp6"},
+	"prefer_ipv4": {"tcp4", "tcp6"},
+	"prefer_ipv6": {"tcp6", "tcp4"},
+}
+
+// parseAddressFamily returns the networks for an address family. All
+// addresses are used in the order determined by the resolver if empty.
+func parseAddressFamily(name string) ([]string, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	networks, ok := addressFamilyNetworks[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown address family %q", name)
+	}
+
+	return networks, nil
+}
+
+// parseDNSServer validates the address of a DNS server, using the default
+// port if none is given.
+func parseDNSServer(addr string) (string, error) {
+	if addr == "" {
+		return "", nil
+	}
+
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr, nil
+	}
+
+	host := strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+
+	if strings.Contains(host, ":") && net.ParseIP(host) == nil {
+		return "", fmt.Errorf("invalid DNS server address %q", addr)
+	}
+
+	return net.JoinHostPort(host, "53"), nil
+}
+
+type httpClientOptions struct {
+	// Maximum number of idle connections kept open, both in total and per
+	// host. Uses the SDK default if zero.
+	maxIdleConns int
+
+	// Maximum amount of time for establishing a connection. Uses the SDK
+	// default if zero.
+	connectTimeout time.Duration
+
+	// Maximum amount of time to wait for the response headers after sending
+	// a request. Unlimited if zero.
+	responseHeaderTimeout time.Duration
+
+	// Address of a DNS server ("host:port") used instead of the system
+	// resolver.
+	dnsServer string
+
+	// Networks tried in order until a connection is established, e.g.
+	// "tcp6" before "tcp4". Uses all address families if empty.
+	networks []string
+}
+
+// newResolver returns a resolver sending all queries to the given server.
+func newResolver(server string, dialer *net.Dialer) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+}
+
+type dialContextFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// dialNetworks wraps a dial function to try the given networks in order
+// instead of the requested one.
+func dialNetworks(dial dialContextFunc, networks []string) dialContextFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if network != "tcp" {
+			return dial(ctx, network, addr)
+		}
+
+		var errs []error
+
+		for _, n := range networks {
+			conn, err := dial(ctx, n, addr)
+			if err == nil {
+				return conn, nil
+			}
+
+			errs = append(errs, err)
+
+			if ctx.Err() != nil {
+				break
+			}
+		}
+
+		return nil, errors.Join(errs...)
+	}
+}
+
+// newHTTPClient returns an HTTP client for the AWS SDK with the connection
+// pool, timeouts and name resolution adjusted according to the options.
+func newHTTPClient(opts httpClientOptions) *awshttp.BuildableClient {
+	c := awshttp.NewBuildableClient().
+		WithTransportOptions(func(t *http.Transport) {
+			if opts.maxIdleConns > 0 {
+				t.MaxIdleConns = opts.maxIdleConns
+				t.MaxIdleConnsPerHost = opts.maxIdleConns
+			}
+
+			if opts.responseHeaderTimeout > 0 {
+				t.ResponseHeaderTimeout = opts.responseHeaderTimeout
+			}
+		}).
+		WithDialerOptions(func(d *net.Dialer) {
+			if opts.connectTimeout > 0 {
+				d.Timeout = opts.connectTimeout
+			}
+
+			if opts.dnsServer != "" {
+				d.Resolver = newResolver(opts.dnsServer, &net.Dialer{
+					Timeout: d.Timeout,
+				})
+			}
+		})
+
+	if len(opts.networks) > 0 {
+		// Must come after the dialer options as they replace the dial
+		// function.
+		c = c.WithTransportOptions(func(t *http.Transport) {
+			t.DialContext = dialNetworks(t.DialContext, opts.networks)
+		})
+	}
+
+	return c
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewHTTPClient(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		c := newHTTPClient(httpClientOptions{})
+
+		if got, want := c.GetTransport().MaxIdleConnsPerHost, awshttp.DefaultHTTPTransportMaxIdleConnsPerHost; got != want {
+			t.Errorf("MaxIdleConnsPerHost = %d, want %d", got, want)
+		}
+
+		if got, want := c.GetDialer().Timeout, awshttp.DefaultDialConnectTimeout; got != want {
+			t.Errorf("Dialer timeout = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("tuned", func(t *testing.T) {
+		c := newHTTPClient(httpClientOptions{
+			maxIdleConns:          256,
+			connectTimeout:        3 * time.Second,
+			responseHeaderTimeout: 20 * time.Second,
+		})
+
+		tr := c.GetTransport()
+
+		if tr.MaxIdleConns != 256 || tr.MaxIdleConnsPerHost != 256 {
+			t.Errorf("MaxIdleConns = %d, MaxIdleConnsPerHost = %d, want 256", tr.MaxIdleConns, tr.MaxIdleConnsPerHost)
+		}
+
+		if got, want := tr.ResponseHeaderTimeout, 20*time.Second; got != want {
+			t.Errorf("ResponseHeaderTimeout = %v, want %v", got, want)
+		}
+
+		if got, want := c.GetDialer().Timeout, 3*time.Second; got != want {
+			t.Errorf("Dialer timeout = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestParseAddressFamily(t *testing.T) {
+	for _, tc := range []struct {
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{input: ""},
+		{input: "any"},
+		{input: "ipv4", want: []string{"tcp4"}},
+		{input: "IPv6", want: []string{"tcp6"}},
+		{input: "prefer_ipv6", want: []string{"tcp6", "tcp4"}},
+		{input: "ipv5", wantErr: true},
+	} {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := parseAddressFamily(tc.input)
+
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("parseAddressFamily() error = %v, want error %t", err, tc.wantErr)
+			}
+
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Networks diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseDNSServer(t *testing.T) {
+	for _, tc := range []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: ""},
+		{input: "192.0.2.53", want: "192.0.2.53:53"},
+		{input: "192.0.2.53:5353", want: "192.0.2.53:5353"},
+		{input: "2001:db8::53", want: "[2001:db8::53]:53"},
+		{input: "[2001:db8::53]", want: "[2001:db8::53]:53"},
+		{input: "[2001:db8::53]:5353", want: "[2001:db8::53]:5353"},
+		{input: "dns.example.com", want: "dns.example.com:53"},
+		{input: "dns.example.com:a:b", wantErr: true},
+	} {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := parseDNSServer(tc.input)
+
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("parseDNSServer() error = %v, want error %t", err, tc.wantErr)
+			}
+
+			if got != tc.want {
+				t.Errorf("parseDNSServer() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewHTTPClientDNSServer(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("Listening on UDP failed: %v", err)
+	}
+
+	t.Cleanup(func() { pc.Close() })
+
+	received := make(chan struct{}, 1)
+
+	go func() {
+		buf := make([]byte, 512)
+
+		if _, _, err := pc.ReadFrom(buf); err == nil {
+			received <- struct{}{}
+		}
+	}()
+
+	c := newHTTPClient(httpClientOptions{
+		dnsServer: pc.LocalAddr().String(),
+	})
+
+	ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+
+	// The fake server never responds.
+	c.GetDialer().Resolver.LookupHost(ctx, "s3.example.com")
+
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Error("DNS server received no query")
+	}
+}
+
+func TestDialNetworks(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { ln.Close() })
+
+	var gotNetworks []string
+
+	var d net.Dialer
+
+	dial := dialNetworks(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		gotNetworks = append(gotNetworks, network)
+
+		return d.DialContext(ctx, network, addr)
+	}, []string{"tcp6", "tcp4"})
+
+	conn, err := dial(t.Context(), "tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+
+	conn.Close()
+
+	if diff := cmp.Diff([]string{"tcp6", "tcp4"}, gotNetworks); diff != "" {
+		t.Errorf("Networks diff (-want +got):\n%s", diff)
+	}
+
+	if _, err := dialNetworks(dial, []string{"tcp6"})(t.Context(), "tcp", ln.Addr().String()); err == nil {
+		t.Error("Dialing IPv4 address via tcp6 succeeded")
+	}
+}
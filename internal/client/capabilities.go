@@ -0,0 +1,35 @@
+package client
+
+import (
+	"context"
+)
+
+// Maximum number of keys per DeleteObjects request as documented for AWS S3.
+const defaultMaxDeleteObjects = 1000
+
+// Capabilities describes the optional S3 features available for a bucket.
+type Capabilities struct {
+	// Object Lock is enabled for the bucket.
+	ObjectLock bool
+
+	// Maximum number of versions per DeleteObjects request.
+	MaxDeleteObjects int
+}
+
+func detectCapabilitiesImpl(ctx context.Context, c getObjectLockConfigurationClient, flavor Flavor, bucket string) (Capabilities, error) {
+	result := Capabilities{
+		MaxDeleteObjects: flavor.MaxDeleteObjects(),
+	}
+
+	var err error
+
+	result.ObjectLock, err = objectLockEnabledImpl(ctx, c, flavor, bucket)
+
+	return result, err
+}
+
+// DetectCapabilities probes the features available for the bucket. Object
+// Lock detection errors are returned together with the remaining results.
+func (c *Client) DetectCapabilities(ctx context.Context) (Capabilities, error) {
+	return detectCapabilitiesImpl(ctx, c.client, c.flavor, c.name)
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestDetectCapabilities(t *testing.T) {
+	lockEnabled := fakeGetObjectLockConfigurationClient{
+		output: &s3.GetObjectLockConfigurationOutput{
+			ObjectLockConfiguration: &types.ObjectLockConfiguration{
+				ObjectLockEnabled: types.ObjectLockEnabledEnabled,
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		name    string
+		client  fakeGetObjectLockConfigurationClient
+		flavor  Flavor
+		want    Capabilities
+		wantErr error
+	}{
+		{
+			name: "defaults",
+			want: Capabilities{
+				MaxDeleteObjects: 1000,
+			},
+		},
+		{
+			name:   "object lock",
+			client: lockEnabled,
+			want: Capabilities{
+				ObjectLock:       true,
+				MaxDeleteObjects: 1000,
+			},
+		},
+		{
+			name: "minio single drive",
+			client: fakeGetObjectLockConfigurationClient{
+				err: &smithy.GenericAPIError{Code: "NotImplemented"},
+			},
+			flavor: FlavorMinIO,
+			want: Capabilities{
+				MaxDeleteObjects: 1000,
+			},
+		},
+		{
+			name: "object lock error",
+			client: fakeGetObjectLockConfigurationClient{
+				err: os.ErrPermission,
+			},
+			want: Capabilities{
+				MaxDeleteObjects: 1000,
+			},
+			wantErr: os.ErrPermission,
+		},
+		{
+			name:   "flavor delete limit",
+			flavor: Flavor{maxDeleteObjects: 100},
+			want: Capabilities{
+				MaxDeleteObjects: 100,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.client.output == nil && tc.client.err == nil {
+				tc.client.output = &s3.GetObjectLockConfigurationOutput{}
+			}
+
+			got, err := detectCapabilitiesImpl(t.Context(), &tc.client, tc.flavor, "bucket")
+
+			if diff := cmp.Diff(tc.wantErr, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("Error diff (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Capabilities diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// ChaosOptions configures the injection of faults into requests. It's meant
+// for rehearsing the behaviour under partial S3 failures and must never be
+// enabled in regular operation.
+type ChaosOptions struct {
+	// Probability of failing a request attempt with a server error instead
+	// of sending it.
+	ErrorRate float64
+
+	// Probability of delaying a request attempt by up to MaxLatency.
+	LatencyRate float64
+	MaxLatency  time.Duration
+
+	// Source of randomness. Uses the global source if nil.
+	Rand *rand.Rand
+}
+
+// Enabled reports whether any fault is injected.
+func (o ChaosOptions) Enabled() bool {
+	return o.ErrorRate > 0 || (o.LatencyRate > 0 && o.MaxLatency > 0)
+}
+
+// ParseChaos parses a comma-separated list of settings, e.g.
+// "errors=0.05,latency=0.2,max_latency=2s". An empty string disables fault
+// injection.
+func ParseChaos(spec string) (ChaosOptions, error) {
+	var opts ChaosOptions
+
+	parseRate := func(name, value string) (float64, error) {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err == nil && !(rate >= 0 && rate <= 1) {
+			err = fmt.Errorf("%s (%v) must be between 0 and 1", name, rate)
+		}
+
+		return rate, err
+	}
+
+	for item := range strings.SplitSeq(spec, ",") {
+		item = strings.TrimSpace(item)
+
+		if item == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return ChaosOptions{}, fmt.Errorf("chaos setting %q is not of the form name=value", item)
+		}
+
+		var err error
+
+		switch name {
+		case "errors":
+			opts.ErrorRate, err = parseRate(name, value)
+		case "latency":
+			opts.LatencyRate, err = parseRate(name, value)
+		case "max_latency":
+			opts.MaxLatency, err = time.ParseDuration(value)
+			if err == nil && opts.MaxLatency < 0 {
+				err = fmt.Errorf("max_latency (%v) must not be negative", opts.MaxLatency)
+			}
+		default:
+			err = fmt.Errorf("unknown chaos setting %q", name)
+		}
+
+		if err != nil {
+			return ChaosOptions{}, err
+		}
+	}
+
+	if opts.LatencyRate > 0 && opts.MaxLatency == 0 {
+		opts.MaxLatency = time.Second
+	}
+
+	return opts, nil
+}
+
+// chaosFaults are the errors injected into requests. Both are retried by the
+// SDK like their real counterparts.
+var chaosFaults = []struct {
+	status int
+	code   string
+}{
+	{http.StatusServiceUnavailable, "SlowDown"},
+	{http.StatusInternalServerError, "InternalError"},
+}
+
+type chaosInjector struct {
+	opts ChaosOptions
+	mu   sync.Mutex
+}
+
+func (c *chaosInjector) float64() float64 {
+	if c.opts.Rand == nil {
+		return rand.Float64()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.opts.Rand.Float64()
+}
+
+// delay returns the latency to add to a request attempt, if any.
+func (c *chaosInjector) delay() time.Duration {
+	if c.opts.MaxLatency <= 0 || c.float64() >= c.opts.LatencyRate {
+		return 0
+	}
+
+	return time.Duration(c.float64() * float64(c.opts.MaxLatency))
+}
+
+// fault returns the error to fail a request attempt with, if any.
+func (c *chaosInjector) fault(operation string) error {
+	if c.float64() >= c.opts.ErrorRate {
+		return nil
+	}
+
+	f := chaosFaults[int(c.float64()*float64(len(chaosFaults)))%len(chaosFaults)]
+
+	return &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{
+			Response: &http.Response{
+				StatusCode: f.status,
+				Status:     http.StatusText(f.status),
+				Header:     http.Header{},
+			},
+		},
+		Err: &smithy.GenericAPIError{
+			Code:    f.code,
+			Message: fmt.Sprintf("injected fault in %s", operation),
+			Fault:   smithy.FaultServer,
+		},
+	}
+}
+
+// NewChaos returns an API option injecting latency and server errors into
+// request attempts according to the options. Faults are injected after the
+// retry middleware, so that retries and error statistics behave as with real
+// failures. Failed attempts are never sent.
+func NewChaos(opts ChaosOptions) func(*middleware.Stack) error {
+	c := &chaosInjector{opts: opts}
+
+	return func(stack *middleware.Stack) error {
+		return stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("InjectChaos",
+			func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+				if d := c.delay(); d > 0 {
+					t := time.NewTimer(d)
+
+					select {
+					case <-ctx.Done():
+						t.Stop()
+
+						return middleware.FinalizeOutput{}, middleware.Metadata{}, ctx.Err()
+					case <-t.C:
+					}
+				}
+
+				if err := c.fault(middleware.GetOperationName(ctx)); err != nil {
+					return middleware.FinalizeOutput{}, middleware.Metadata{}, err
+				}
+
+				return next.HandleFinalize(ctx, in)
+			}), middleware.After)
+	}
+}
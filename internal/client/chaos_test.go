@@ -0,0 +1,124 @@
+package client
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/hansmi/s3-object-cleanup/internal/fakes3"
+)
+
+func TestParseChaos(t *testing.T) {
+	for _, tc := range []struct {
+		spec    string
+		want    ChaosOptions
+		wantErr bool
+	}{
+		{spec: ""},
+		{spec: " , "},
+		{
+			spec: "errors=0.05",
+			want: ChaosOptions{ErrorRate: 0.05},
+		},
+		{
+			spec: "errors=0.1, latency=0.5,max_latency=2s",
+			want: ChaosOptions{ErrorRate: 0.1, LatencyRate: 0.5, MaxLatency: 2 * time.Second},
+		},
+		{
+			spec: "latency=1",
+			want: ChaosOptions{LatencyRate: 1, MaxLatency: time.Second},
+		},
+		{spec: "errors", wantErr: true},
+		{spec: "errors=1.5", wantErr: true},
+		{spec: "latency=-0.1", wantErr: true},
+		{spec: "max_latency=-1s", wantErr: true},
+		{spec: "max_latency=soon", wantErr: true},
+		{spec: "timeouts=0.1", wantErr: true},
+	} {
+		t.Run(tc.spec, func(t *testing.T) {
+			got, err := ParseChaos(tc.spec)
+
+			if (err != nil) != tc.wantErr {
+				t.Errorf("ParseChaos() error %v, want error %t", err, tc.wantErr)
+			}
+
+			if err == nil {
+				if diff := cmp.Diff(tc.want, got, cmpopts.IgnoreUnexported(rand.Rand{})); diff != "" {
+					t.Errorf("ParseChaos() diff (-want +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestChaos(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		opts         ChaosOptions
+		wantErr      bool
+		wantRequests int32
+	}{
+		{
+			name:         "disabled",
+			wantRequests: 1,
+		},
+		{
+			name:    "errors",
+			opts:    ChaosOptions{ErrorRate: 1},
+			wantErr: true,
+		},
+		{
+			name:         "latency",
+			opts:         ChaosOptions{LatencyRate: 1, MaxLatency: 10 * time.Millisecond},
+			wantRequests: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests atomic.Int32
+
+			fake := fakes3.New(fakes3.Options{Bucket: "bucket"})
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				fake.ServeHTTP(w, r)
+			}))
+			t.Cleanup(server.Close)
+
+			tc.opts.Rand = rand.New(rand.NewPCG(1, 2))
+
+			c, err := NewFromName(aws.Config{
+				Region:      "us-east-1",
+				Credentials: aws.AnonymousCredentials{},
+				APIOptions:  []func(*middleware.Stack) error{NewChaos(tc.opts)},
+			}, server.URL+"/bucket", func(o *s3.Options) {
+				o.RetryMaxAttempts = 1
+			})
+			if err != nil {
+				t.Fatalf("NewFromName() failed: %v", err)
+			}
+
+			_, err = c.VersioningEnabled(t.Context())
+
+			if (err != nil) != tc.wantErr {
+				t.Errorf("VersioningEnabled() error %v, want error %t", err, tc.wantErr)
+			}
+
+			if err != nil && !retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err).Bool() {
+				t.Errorf("Injected error %v is not retryable", err)
+			}
+
+			if got := requests.Load(); got != tc.wantRequests {
+				t.Errorf("Server received %d requests, want %d", got, tc.wantRequests)
+			}
+		})
+	}
+}
@@ -5,19 +5,29 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 )
 
 const errorCodeNoSuchKey = "NoSuchKey"
+const errorCodeNotFound = "NotFound"
+const errorCodePreconditionFailed = "PreconditionFailed"
+const errorCodeConditionalRequestConflict = "ConditionalRequestConflict"
+const errorCodeNoSuchObjectLockConfiguration = "NoSuchObjectLockConfiguration"
+const errorCodeObjectLockConfigurationNotFound = "ObjectLockConfigurationNotFoundError"
 
 func annotateError(err *error, format string, args ...any) {
 	if *err != nil {
@@ -41,20 +51,223 @@ func IsNoSuchKey(err error) bool {
 	return false
 }
 
+// IsNotFound reports whether the error signals a missing object, either via
+// NoSuchKey or, for HEAD requests without a body, NotFound.
+func IsNotFound(err error) bool {
+	var errNotFound *types.NotFound
+	var errApi smithy.APIError
+
+	switch {
+	case IsNoSuchKey(err):
+		return true
+	case errors.As(err, &errNotFound):
+		return true
+	case errors.As(err, &errApi) && errApi.ErrorCode() == errorCodeNotFound:
+		return true
+	}
+
+	return false
+}
+
+// IsNoObjectLockConfiguration reports whether the error signals that an object
+// version has no retention configured.
+func IsNoObjectLockConfiguration(err error) bool {
+	var errApi smithy.APIError
+
+	return errors.As(err, &errApi) && errApi.ErrorCode() == errorCodeNoSuchObjectLockConfiguration
+}
+
+// IsPreconditionFailed reports whether a conditional request was rejected
+// because the object changed, either with "PreconditionFailed" (HTTP 412) or,
+// for conflicting concurrent writes, "ConditionalRequestConflict" (HTTP 409).
+func IsPreconditionFailed(err error) bool {
+	var errApi smithy.APIError
+	var errResponse *smithyhttp.ResponseError
+
+	switch {
+	case errors.As(err, &errApi) && (errApi.ErrorCode() == errorCodePreconditionFailed ||
+		errApi.ErrorCode() == errorCodeConditionalRequestConflict):
+		return true
+	case errors.As(err, &errResponse) && errResponse.HTTPStatusCode() == http.StatusPreconditionFailed:
+		return true
+	}
+
+	return false
+}
+
+// IsThrottling reports whether the error signals that requests should be
+// slowed down, e.g. "SlowDown" or an HTTP 503 response.
+func IsThrottling(err error) bool {
+	var errResponse *smithyhttp.ResponseError
+
+	switch {
+	case err == nil:
+		return false
+	case retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err).Bool():
+		return true
+	case errors.As(err, &errResponse) && errResponse.HTTPStatusCode() == http.StatusServiceUnavailable:
+		return true
+	}
+
+	return false
+}
+
+// UploadEncryption configures the server-side encryption of uploaded objects.
+// The zero value uses the bucket default.
+type UploadEncryption struct {
+	Algorithm types.ServerSideEncryption
+
+	// KMS key ID or ARN for the KMS-based algorithms. The AWS managed key is
+	// used if empty.
+	KMSKeyID string
+}
+
+// ParseUploadEncryption validates a server-side encryption algorithm such as
+// "AES256" or "aws:kms". A KMS key without algorithm implies "aws:kms".
+func ParseUploadEncryption(algorithm, kmsKeyID string) (UploadEncryption, error) {
+	result := UploadEncryption{
+		Algorithm: types.ServerSideEncryption(algorithm),
+		KMSKeyID:  kmsKeyID,
+	}
+
+	switch result.Algorithm {
+	case "":
+		if kmsKeyID != "" {
+			result.Algorithm = types.ServerSideEncryptionAwsKms
+		}
+
+	case types.ServerSideEncryptionAwsKms, types.ServerSideEncryptionAwsKmsDsse:
+
+	case types.ServerSideEncryptionAes256:
+		if kmsKeyID != "" {
+			return UploadEncryption{}, fmt.Errorf("%w: KMS key not supported with %s encryption", os.ErrInvalid, algorithm)
+		}
+
+	default:
+		return UploadEncryption{}, fmt.Errorf("%w: unsupported server-side encryption %q", os.ErrInvalid, algorithm)
+	}
+
+	return result, nil
+}
+
+func (e UploadEncryption) apply(input *s3.PutObjectInput) {
+	input.ServerSideEncryption = e.Algorithm
+
+	if e.KMSKeyID != "" {
+		input.SSEKMSKeyId = aws.String(e.KMSKeyID)
+	}
+}
+
+// UploadCondition makes an upload conditional on the current state of the
+// object. The zero value uploads unconditionally.
+type UploadCondition struct {
+	// Only replace the object if its entity tag matches.
+	IfMatch string
+
+	// Only upload if the object doesn't exist.
+	IfNoneMatch bool
+}
+
+func (c UploadCondition) apply(input *s3.PutObjectInput) {
+	if c.IfMatch != "" {
+		input.IfMatch = aws.String(c.IfMatch)
+	}
+
+	if c.IfNoneMatch {
+		input.IfNoneMatch = aws.String("*")
+	}
+}
+
 type Client struct {
 	client *s3.Client
 	name   string
 	prefix string
+
+	uploadEncryption UploadEncryption
+	flavor           Flavor
+
+	// Results of permission probes by options.
+	probeMu sync.Mutex
+	probes  map[PreflightOptions][]PermissionProbe
+}
+
+// parseBucketARN extracts the bucket name and an optional prefix from an S3
+// bucket ARN. Access point ARNs, including those of S3 on Outposts, are
+// returned unchanged as the SDK accepts them in place of a bucket name.
+func parseBucketARN(input string) (name, prefix string, accessPoint bool, err error) {
+	a, err := arn.Parse(input)
+	if err != nil {
+		return "", "", false, fmt.Errorf("%w: %w", os.ErrInvalid, err)
+	}
+
+	resource := strings.Split(strings.ReplaceAll(a.Resource, ":", "/"), "/")
+
+	switch a.Service {
+	case "s3":
+		if a.Region == "" && a.AccountID == "" {
+			name, prefix, _ = strings.Cut(a.Resource, "/")
+
+			return name, prefix, false, nil
+		}
+
+		if len(resource) == 2 && resource[0] == "accesspoint" {
+			return input, "", true, nil
+		}
+
+	case "s3-outposts":
+		if len(resource) == 4 && resource[0] == "outpost" {
+			switch resource[2] {
+			case "accesspoint":
+				return input, "", true, nil
+			case "bucket":
+				// The S3 API on Outposts doesn't accept bucket ARNs.
+				return "", "", false, fmt.Errorf("%w: S3 on Outposts buckets must be given as an access point ARN: %s", os.ErrInvalid, input)
+			}
+		}
+	}
+
+	return "", "", false, fmt.Errorf("%w: unsupported ARN: %s", os.ErrInvalid, input)
+}
+
+// IsEndpointURL reports whether a bucket is given as URL of an S3-compatible
+// endpoint.
+func IsEndpointURL(input string) bool {
+	if arn.IsARN(input) {
+		return false
+	}
+
+	u, err := url.Parse(input)
+
+	return err == nil && u.IsAbs()
 }
 
-func NewFromName(cfg aws.Config, input string) (*Client, error) {
+// NewFromName returns a client for a bucket given either by name, as an ARN
+// or as an URL to an S3-compatible endpoint. Additional options are applied
+// after the endpoint configuration.
+func NewFromName(cfg aws.Config, input string, optFns ...func(*s3.Options)) (*Client, error) {
 	result := &Client{
-		name: input,
+		name:   input,
+		flavor: FlavorAWS,
 	}
 
 	var config []func(*s3.Options)
 
-	if u, err := url.Parse(input); err == nil && u.IsAbs() {
+	if arn.IsARN(input) {
+		name, prefix, accessPoint, err := parseBucketARN(input)
+		if err != nil {
+			return nil, err
+		}
+
+		result.name = name
+		result.prefix = prefix
+
+		if accessPoint {
+			config = append(config, func(opts *s3.Options) {
+				// Access points are regional resources.
+				opts.UseARNRegion = true
+			})
+		}
+	} else if u, err := url.Parse(input); err == nil && u.IsAbs() {
 		switch u.Scheme {
 		case "http", "https":
 		default:
@@ -77,6 +290,11 @@ func NewFromName(cfg aws.Config, input string) (*Client, error) {
 			opts.Region = "us-east-1"
 			opts.BaseEndpoint = aws.String(endpoint)
 			opts.EndpointOptions.DisableHTTPS = u.Scheme == "http"
+
+			// Custom endpoints can't be combined with the dual-stack or FIPS
+			// variants of the AWS endpoints.
+			opts.EndpointOptions.UseDualStackEndpoint = aws.DualStackEndpointStateUnset
+			opts.EndpointOptions.UseFIPSEndpoint = aws.FIPSEndpointStateUnset
 		})
 	}
 
@@ -84,6 +302,8 @@ func NewFromName(cfg aws.Config, input string) (*Client, error) {
 		return nil, fmt.Errorf("%w: missing bucket name: %s", os.ErrInvalid, input)
 	}
 
+	config = append(config, optFns...)
+
 	result.client = s3.NewFromConfig(cfg, config...)
 
 	return result, nil
@@ -93,6 +313,10 @@ func (c *Client) Name() string {
 	return c.name
 }
 
+func (c *Client) Flavor() Flavor {
+	return c.flavor
+}
+
 func (c *Client) Prefix() string {
 	return c.prefix
 }
@@ -101,6 +325,17 @@ func (c *Client) S3() *s3.Client {
 	return c.client
 }
 
+// SetFlavor adapts the client to the deviations of an S3-compatible service.
+func (c *Client) SetFlavor(f Flavor) {
+	c.flavor = f
+}
+
+// SetUploadEncryption configures the server-side encryption used by
+// [Client.UploadObject].
+func (c *Client) SetUploadEncryption(e UploadEncryption) {
+	c.uploadEncryption = e
+}
+
 func (c *Client) DownloadObject(ctx context.Context, w io.WriterAt, key string) (err error) {
 	defer annotateError(&err, "key %q", key)
 
@@ -114,30 +349,78 @@ func (c *Client) DownloadObject(ctx context.Context, w io.WriterAt, key string)
 	return err
 }
 
-func (c *Client) UploadObject(ctx context.Context, r io.Reader, key string) (err error) {
-	defer annotateError(&err, "key %q", key)
+// ObjectInfo describes a downloaded object.
+type ObjectInfo struct {
+	// Entity tag for use with [UploadCondition].
+	ETag string
 
-	uploader := manager.NewUploader(c.client)
+	// User-defined metadata.
+	Metadata map[string]string
+}
+
+// OpenObject starts downloading an object and returns its body together with
+// its entity tag and metadata. Callers must close the body.
+func (c *Client) OpenObject(ctx context.Context, key string) (_ io.ReadCloser, _ ObjectInfo, err error) {
+	defer annotateError(&err, "key %q", key)
 
-	if _, err := uploader.Upload(ctx, &s3.PutObjectInput{
+	output, err := c.client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(c.name),
 		Key:    aws.String(key),
-		Body:   r,
-	}); err != nil {
-		return err
+	})
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	return output.Body, ObjectInfo{
+		ETag:     aws.ToString(output.ETag),
+		Metadata: output.Metadata,
+	}, nil
+}
+
+func (c *Client) UploadObject(ctx context.Context, r io.Reader, key string) error {
+	_, err := c.UploadObjectConditional(ctx, r, key, UploadCondition{}, nil)
+
+	return err
+}
+
+// UploadObjectConditional uploads an object with the given user-defined
+// metadata if the condition is met and returns the entity tag of the new
+// object. Use [IsPreconditionFailed] to detect a mismatch.
+func (c *Client) UploadObjectConditional(ctx context.Context, r io.Reader, key string, cond UploadCondition, metadata map[string]string) (_ string, err error) {
+	defer annotateError(&err, "key %q", key)
+
+	uploader := manager.NewUploader(c.client)
+
+	input := &s3.PutObjectInput{
+		Bucket:   aws.String(c.name),
+		Key:      aws.String(key),
+		Body:     r,
+		Metadata: metadata,
 	}
 
-	return s3.NewObjectExistsWaiter(c.client).Wait(ctx, &s3.HeadObjectInput{
+	c.uploadEncryption.apply(input)
+	cond.apply(input)
+
+	output, err := uploader.Upload(ctx, input)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s3.NewObjectExistsWaiter(c.client).Wait(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(c.name),
 		Key:    aws.String(key),
-	}, time.Minute)
+	}, time.Minute); err != nil {
+		return "", err
+	}
+
+	return aws.ToString(output.ETag), nil
 }
 
 type GetObjectRetentionClient interface {
 	GetObjectRetention(context.Context, *s3.GetObjectRetentionInput, ...func(*s3.Options)) (*s3.GetObjectRetentionOutput, error)
 }
 
-func getObjectRetentionImpl(ctx context.Context, c GetObjectRetentionClient, bucket, key, versionID string) (_ time.Time, err error) {
+func getObjectRetentionImpl(ctx context.Context, c GetObjectRetentionClient, flavor Flavor, bucket, key, versionID string) (_ time.Time, err error) {
 	defer annotateError(&err, "key %q, version %q", key, versionID)
 
 	result, err := c.GetObjectRetention(ctx, &s3.GetObjectRetentionInput{
@@ -146,19 +429,23 @@ func getObjectRetentionImpl(ctx context.Context, c GetObjectRetentionClient, buc
 		VersionId: aws.String(versionID),
 	})
 	if err != nil {
-		if IsNoSuchKey(err) {
-			// Version may have been deleted.
+		if IsNoSuchKey(err) || flavor.isRetentionNotFound(err) || flavor.isObjectLockUnsupported(err) {
+			// Version may have been deleted or has no retention.
 			err = nil
 		}
 
 		return time.Time{}, err
 	}
 
+	if result.Retention == nil {
+		return time.Time{}, nil
+	}
+
 	return aws.ToTime(result.Retention.RetainUntilDate), nil
 }
 
 func (c *Client) GetObjectRetention(ctx context.Context, key, versionID string) (time.Time, error) {
-	return getObjectRetentionImpl(ctx, c.client, c.name, key, versionID)
+	return getObjectRetentionImpl(ctx, c.client, c.flavor, c.name, key, versionID)
 }
 
 type putObjectRetentionClient interface {
@@ -192,3 +479,88 @@ func putObjectRetentionImpl(ctx context.Context, c putObjectRetentionClient, buc
 func (c *Client) PutObjectRetention(ctx context.Context, key, versionID string, until time.Time) (err error) {
 	return putObjectRetentionImpl(ctx, c.client, c.name, key, versionID, until)
 }
+
+type headObjectClient interface {
+	HeadObject(context.Context, *s3.HeadObjectInput, ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+}
+
+func headObjectImpl(ctx context.Context, c headObjectClient, bucket, key, versionID string) (_ *s3.HeadObjectOutput, err error) {
+	defer annotateError(&err, "key %q, version %q", key, versionID)
+
+	result, err := c.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:    aws.String(bucket),
+		Key:       aws.String(key),
+		VersionId: aws.String(versionID),
+	})
+	if err != nil {
+		if IsNotFound(err) {
+			// Version may have been deleted.
+			err = nil
+		}
+
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// HeadObject retrieves the metadata of an object version. Nil is returned if
+// the version doesn't exist.
+func (c *Client) HeadObject(ctx context.Context, key, versionID string) (*s3.HeadObjectOutput, error) {
+	return headObjectImpl(ctx, c.client, c.name, key, versionID)
+}
+
+type getBucketVersioningClient interface {
+	GetBucketVersioning(context.Context, *s3.GetBucketVersioningInput, ...func(*s3.Options)) (*s3.GetBucketVersioningOutput, error)
+}
+
+func versioningEnabledImpl(ctx context.Context, c getBucketVersioningClient, bucket string) (_ bool, err error) {
+	defer annotateError(&err, "bucket %q", bucket)
+
+	result, err := c.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return result.Status == types.BucketVersioningStatusEnabled, nil
+}
+
+// VersioningEnabled reports whether versioning is enabled for the bucket.
+// Buckets where versioning was never enabled or has been suspended return
+// false.
+func (c *Client) VersioningEnabled(ctx context.Context) (bool, error) {
+	return versioningEnabledImpl(ctx, c.client, c.name)
+}
+
+type getObjectLockConfigurationClient interface {
+	GetObjectLockConfiguration(context.Context, *s3.GetObjectLockConfigurationInput, ...func(*s3.Options)) (*s3.GetObjectLockConfigurationOutput, error)
+}
+
+func objectLockEnabledImpl(ctx context.Context, c getObjectLockConfigurationClient, flavor Flavor, bucket string) (_ bool, err error) {
+	defer annotateError(&err, "bucket %q", bucket)
+
+	result, err := c.GetObjectLockConfiguration(ctx, &s3.GetObjectLockConfigurationInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		var errApi smithy.APIError
+
+		if (errors.As(err, &errApi) && errApi.ErrorCode() == errorCodeObjectLockConfigurationNotFound) ||
+			flavor.isObjectLockUnsupported(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return result.ObjectLockConfiguration != nil &&
+		result.ObjectLockConfiguration.ObjectLockEnabled == types.ObjectLockEnabledEnabled, nil
+}
+
+// ObjectLockEnabled reports whether Object Lock is enabled for the bucket.
+// Object versions in buckets without Object Lock can't have retention.
+func (c *Client) ObjectLockEnabled(ctx context.Context) (bool, error) {
+	return objectLockEnabledImpl(ctx, c.client, c.flavor, c.name)
+}
@@ -1,13 +1,19 @@
 package client
 
 import (
+	"context"
+	"net/http"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 )
@@ -71,6 +77,419 @@ func TestIsNoSuchKey(t *testing.T) {
 	}
 }
 
+func TestIsNotFound(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil"},
+		{
+			name: "invalid",
+			err:  os.ErrInvalid,
+		},
+		{
+			name: "NoSuchKey",
+			err:  &types.NoSuchKey{},
+			want: true,
+		},
+		{
+			name: "NotFound",
+			err:  &types.NotFound{},
+			want: true,
+		},
+		{
+			name: "API error",
+			err: &smithy.GenericAPIError{
+				Code: errorCodeNotFound,
+			},
+			want: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := IsNotFound(tc.err)
+
+			if got != tc.want {
+				t.Errorf("IsNotFound(%#v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+type fakeHeadObjectClient struct {
+	output *s3.HeadObjectOutput
+	err    error
+}
+
+func (c *fakeHeadObjectClient) HeadObject(context.Context, *s3.HeadObjectInput, ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return c.output, c.err
+}
+
+func TestIsEndpointURL(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		want  bool
+	}{
+		{input: "bucket"},
+		{input: "bucket/prefix"},
+		{input: "arn:aws:s3:::bucket"},
+		{input: "arn:aws:s3:us-east-1:123456789012:accesspoint/name"},
+		{input: "https://s3.example.com/bucket", want: true},
+		{input: "http://localhost:9000/bucket/prefix", want: true},
+	} {
+		if got := IsEndpointURL(tc.input); got != tc.want {
+			t.Errorf("IsEndpointURL(%q) = %t, want %t", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestHeadObject(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		client  fakeHeadObjectClient
+		want    map[string]string
+		wantErr error
+	}{
+		{
+			name: "success",
+			client: fakeHeadObjectClient{
+				output: &s3.HeadObjectOutput{
+					Metadata: map[string]string{"hold": "true"},
+				},
+			},
+			want: map[string]string{"hold": "true"},
+		},
+		{
+			name: "not found",
+			client: fakeHeadObjectClient{
+				err: &types.NotFound{},
+			},
+		},
+		{
+			name: "error",
+			client: fakeHeadObjectClient{
+				err: os.ErrPermission,
+			},
+			wantErr: os.ErrPermission,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := headObjectImpl(t.Context(), &tc.client, "bucket", "key", "version")
+
+			if diff := cmp.Diff(tc.wantErr, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("Error diff (-want +got):\n%s", diff)
+			}
+
+			var gotMetadata map[string]string
+
+			if got != nil {
+				gotMetadata = got.Metadata
+			}
+
+			if diff := cmp.Diff(tc.want, gotMetadata); diff != "" {
+				t.Errorf("HeadObject() diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+type fakeGetObjectRetentionClient struct {
+	output *s3.GetObjectRetentionOutput
+	err    error
+}
+
+func (c *fakeGetObjectRetentionClient) GetObjectRetention(context.Context, *s3.GetObjectRetentionInput, ...func(*s3.Options)) (*s3.GetObjectRetentionOutput, error) {
+	return c.output, c.err
+}
+
+func TestGetObjectRetention(t *testing.T) {
+	until := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name    string
+		client  fakeGetObjectRetentionClient
+		flavor  Flavor
+		want    time.Time
+		wantErr error
+	}{
+		{
+			name: "success",
+			client: fakeGetObjectRetentionClient{
+				output: &s3.GetObjectRetentionOutput{
+					Retention: &types.ObjectLockRetention{
+						RetainUntilDate: aws.Time(until),
+					},
+				},
+			},
+			want: until,
+		},
+		{
+			name: "empty",
+			client: fakeGetObjectRetentionClient{
+				output: &s3.GetObjectRetentionOutput{},
+			},
+		},
+		{
+			name: "no retention",
+			client: fakeGetObjectRetentionClient{
+				err: &smithy.GenericAPIError{Code: errorCodeNoSuchObjectLockConfiguration},
+			},
+		},
+		{
+			name: "not found",
+			client: fakeGetObjectRetentionClient{
+				err: &types.NoSuchKey{},
+			},
+		},
+		{
+			name: "ceph no retention",
+			client: fakeGetObjectRetentionClient{
+				err: &smithy.GenericAPIError{Code: "ObjectLockConfigurationNotFoundError"},
+			},
+			flavor: FlavorCeph,
+		},
+		{
+			name: "b2 not implemented",
+			client: fakeGetObjectRetentionClient{
+				err: &smithy.GenericAPIError{Code: "NotImplemented"},
+			},
+			flavor: FlavorB2,
+		},
+		{
+			name: "b2 file lock disabled",
+			client: fakeGetObjectRetentionClient{
+				err: &smithy.GenericAPIError{Code: "InvalidRequest", Message: "File lock is not enabled for this bucket"},
+			},
+			flavor: FlavorB2,
+		},
+		{
+			name: "error",
+			client: fakeGetObjectRetentionClient{
+				err: os.ErrPermission,
+			},
+			wantErr: os.ErrPermission,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := getObjectRetentionImpl(t.Context(), &tc.client, tc.flavor, "bucket", "key", "version")
+
+			if diff := cmp.Diff(tc.wantErr, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("Error diff (-want +got):\n%s", diff)
+			}
+
+			if !got.Equal(tc.want) {
+				t.Errorf("GetObjectRetention() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+type fakeGetBucketVersioningClient struct {
+	output *s3.GetBucketVersioningOutput
+	err    error
+}
+
+func (c *fakeGetBucketVersioningClient) GetBucketVersioning(context.Context, *s3.GetBucketVersioningInput, ...func(*s3.Options)) (*s3.GetBucketVersioningOutput, error) {
+	return c.output, c.err
+}
+
+func TestVersioningEnabled(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		client  fakeGetBucketVersioningClient
+		want    bool
+		wantErr error
+	}{
+		{
+			name: "enabled",
+			client: fakeGetBucketVersioningClient{
+				output: &s3.GetBucketVersioningOutput{
+					Status: types.BucketVersioningStatusEnabled,
+				},
+			},
+			want: true,
+		},
+		{
+			name: "suspended",
+			client: fakeGetBucketVersioningClient{
+				output: &s3.GetBucketVersioningOutput{
+					Status: types.BucketVersioningStatusSuspended,
+				},
+			},
+		},
+		{
+			name: "never enabled",
+			client: fakeGetBucketVersioningClient{
+				output: &s3.GetBucketVersioningOutput{},
+			},
+		},
+		{
+			name: "error",
+			client: fakeGetBucketVersioningClient{
+				err: os.ErrPermission,
+			},
+			wantErr: os.ErrPermission,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := versioningEnabledImpl(t.Context(), &tc.client, "bucket")
+
+			if diff := cmp.Diff(tc.wantErr, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("Error diff (-want +got):\n%s", diff)
+			}
+
+			if got != tc.want {
+				t.Errorf("VersioningEnabled() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+type fakeGetObjectLockConfigurationClient struct {
+	output *s3.GetObjectLockConfigurationOutput
+	err    error
+}
+
+func (c *fakeGetObjectLockConfigurationClient) GetObjectLockConfiguration(context.Context, *s3.GetObjectLockConfigurationInput, ...func(*s3.Options)) (*s3.GetObjectLockConfigurationOutput, error) {
+	return c.output, c.err
+}
+
+func TestObjectLockEnabled(t *testing.T) {
+	errUnrelated := &smithy.GenericAPIError{Code: "InvalidRequest", Message: "Invalid argument"}
+
+	for _, tc := range []struct {
+		name    string
+		client  fakeGetObjectLockConfigurationClient
+		flavor  Flavor
+		want    bool
+		wantErr error
+	}{
+		{
+			name: "enabled",
+			client: fakeGetObjectLockConfigurationClient{
+				output: &s3.GetObjectLockConfigurationOutput{
+					ObjectLockConfiguration: &types.ObjectLockConfiguration{
+						ObjectLockEnabled: types.ObjectLockEnabledEnabled,
+					},
+				},
+			},
+			want: true,
+		},
+		{
+			name: "empty",
+			client: fakeGetObjectLockConfigurationClient{
+				output: &s3.GetObjectLockConfigurationOutput{},
+			},
+		},
+		{
+			name: "not found",
+			client: fakeGetObjectLockConfigurationClient{
+				err: &smithy.GenericAPIError{Code: "ObjectLockConfigurationNotFoundError"},
+			},
+		},
+		{
+			name: "b2 invalid request",
+			client: fakeGetObjectLockConfigurationClient{
+				err: &smithy.GenericAPIError{Code: "InvalidRequest", Message: "Bucket is missing Object Lock Configuration"},
+			},
+			flavor: FlavorB2,
+		},
+		{
+			name: "b2 unrelated invalid request",
+			client: fakeGetObjectLockConfigurationClient{
+				err: errUnrelated,
+			},
+			flavor:  FlavorB2,
+			wantErr: errUnrelated,
+		},
+		{
+			name: "b2 error",
+			client: fakeGetObjectLockConfigurationClient{
+				err: os.ErrPermission,
+			},
+			flavor:  FlavorB2,
+			wantErr: os.ErrPermission,
+		},
+		{
+			name: "error",
+			client: fakeGetObjectLockConfigurationClient{
+				err: os.ErrPermission,
+			},
+			wantErr: os.ErrPermission,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := objectLockEnabledImpl(t.Context(), &tc.client, tc.flavor, "bucket")
+
+			if diff := cmp.Diff(tc.wantErr, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("Error diff (-want +got):\n%s", diff)
+			}
+
+			if got != tc.want {
+				t.Errorf("ObjectLockEnabled() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIsThrottling(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil"},
+		{
+			name: "invalid",
+			err:  os.ErrInvalid,
+		},
+		{
+			name: "SlowDown",
+			err: &smithy.GenericAPIError{
+				Code: "SlowDown",
+			},
+			want: true,
+		},
+		{
+			name: "unrelated API error",
+			err: &smithy.GenericAPIError{
+				Code: errorCodeNoSuchKey,
+			},
+		},
+		{
+			name: "service unavailable",
+			err: &smithyhttp.ResponseError{
+				Response: &smithyhttp.Response{
+					Response: &http.Response{
+						StatusCode: http.StatusServiceUnavailable,
+					},
+				},
+				Err: os.ErrDeadlineExceeded,
+			},
+			want: true,
+		},
+		{
+			name: "internal error",
+			err: &smithyhttp.ResponseError{
+				Response: &smithyhttp.Response{
+					Response: &http.Response{
+						StatusCode: http.StatusInternalServerError,
+					},
+				},
+				Err: os.ErrInvalid,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := IsThrottling(tc.err)
+
+			if got != tc.want {
+				t.Errorf("IsThrottling(%#v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
 func TestNewFromName(t *testing.T) {
 	for _, tc := range []struct {
 		name         string
@@ -108,6 +527,52 @@ func TestNewFromName(t *testing.T) {
 			input:      "hello-world",
 			wantBucket: "hello-world",
 		},
+		{
+			name:       "bucket arn",
+			input:      "arn:aws:s3:::my-bucket",
+			wantBucket: "my-bucket",
+		},
+		{
+			name:       "bucket arn in other partition",
+			input:      "arn:aws-cn:s3:::my-bucket",
+			wantBucket: "my-bucket",
+		},
+		{
+			name:       "bucket arn with prefix",
+			input:      "arn:aws:s3:::my-bucket/backups/db/",
+			wantBucket: "my-bucket",
+			wantPrefix: "backups/db/",
+		},
+		{
+			name:    "bucket arn without name",
+			input:   "arn:aws:s3:::",
+			wantErr: os.ErrInvalid,
+		},
+		{
+			name:       "access point arn",
+			input:      "arn:aws:s3:eu-west-1:123456789012:accesspoint/reports",
+			wantBucket: "arn:aws:s3:eu-west-1:123456789012:accesspoint/reports",
+		},
+		{
+			name:       "outposts access point arn",
+			input:      "arn:aws:s3-outposts:us-west-2:123456789012:outpost/op-01ac5d28a6a232904/accesspoint/reports",
+			wantBucket: "arn:aws:s3-outposts:us-west-2:123456789012:outpost/op-01ac5d28a6a232904/accesspoint/reports",
+		},
+		{
+			name:    "outposts bucket arn",
+			input:   "arn:aws:s3-outposts:us-west-2:123456789012:outpost/op-01ac5d28a6a232904/bucket/reports",
+			wantErr: os.ErrInvalid,
+		},
+		{
+			name:    "other service",
+			input:   "arn:aws:sqs:us-east-1:123456789012:queue",
+			wantErr: os.ErrInvalid,
+		},
+		{
+			name:    "malformed arn",
+			input:   "arn:aws:s3",
+			wantErr: os.ErrInvalid,
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			var cfg aws.Config
@@ -136,3 +601,204 @@ func TestNewFromName(t *testing.T) {
 		})
 	}
 }
+
+func TestParseUploadEncryption(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		algorithm     string
+		kmsKeyID      string
+		wantAlgorithm types.ServerSideEncryption
+		wantKMSKeyID  *string
+		wantErr       error
+	}{
+		{name: "default"},
+		{
+			name:          "AES256",
+			algorithm:     "AES256",
+			wantAlgorithm: types.ServerSideEncryptionAes256,
+		},
+		{
+			name:          "KMS with default key",
+			algorithm:     "aws:kms",
+			wantAlgorithm: types.ServerSideEncryptionAwsKms,
+		},
+		{
+			name:          "KMS key only",
+			kmsKeyID:      "alias/state",
+			wantAlgorithm: types.ServerSideEncryptionAwsKms,
+			wantKMSKeyID:  aws.String("alias/state"),
+		},
+		{
+			name:          "DSSE",
+			algorithm:     "aws:kms:dsse",
+			kmsKeyID:      "key",
+			wantAlgorithm: types.ServerSideEncryptionAwsKmsDsse,
+			wantKMSKeyID:  aws.String("key"),
+		},
+		{
+			name:      "AES256 with key",
+			algorithm: "AES256",
+			kmsKeyID:  "key",
+			wantErr:   os.ErrInvalid,
+		},
+		{
+			name:      "unknown",
+			algorithm: "rot13",
+			wantErr:   os.ErrInvalid,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseUploadEncryption(tc.algorithm, tc.kmsKeyID)
+
+			if diff := cmp.Diff(tc.wantErr, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("Error diff (-want +got):\n%s", diff)
+			}
+
+			if err != nil {
+				return
+			}
+
+			var input s3.PutObjectInput
+
+			got.apply(&input)
+
+			if input.ServerSideEncryption != tc.wantAlgorithm {
+				t.Errorf("ServerSideEncryption = %q, want %q", input.ServerSideEncryption, tc.wantAlgorithm)
+			}
+
+			if diff := cmp.Diff(tc.wantKMSKeyID, input.SSEKMSKeyId); diff != "" {
+				t.Errorf("SSEKMSKeyId diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestIsPreconditionFailed(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil"},
+		{
+			name: "invalid",
+			err:  os.ErrInvalid,
+		},
+		{
+			name: "PreconditionFailed",
+			err: &smithy.GenericAPIError{
+				Code: errorCodePreconditionFailed,
+			},
+			want: true,
+		},
+		{
+			name: "ConditionalRequestConflict",
+			err: &smithy.GenericAPIError{
+				Code: errorCodeConditionalRequestConflict,
+			},
+			want: true,
+		},
+		{
+			name: "unrelated API error",
+			err: &smithy.GenericAPIError{
+				Code: errorCodeNoSuchKey,
+			},
+		},
+		{
+			name: "status 412",
+			err: &smithyhttp.ResponseError{
+				Response: &smithyhttp.Response{
+					Response: &http.Response{
+						StatusCode: http.StatusPreconditionFailed,
+					},
+				},
+				Err: os.ErrInvalid,
+			},
+			want: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := IsPreconditionFailed(tc.err)
+
+			if got != tc.want {
+				t.Errorf("IsPreconditionFailed(%#v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUploadCondition(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		cond            UploadCondition
+		wantIfMatch     *string
+		wantIfNoneMatch *string
+	}{
+		{name: "unconditional"},
+		{
+			name:        "if match",
+			cond:        UploadCondition{IfMatch: `"abc"`},
+			wantIfMatch: aws.String(`"abc"`),
+		},
+		{
+			name:            "if none match",
+			cond:            UploadCondition{IfNoneMatch: true},
+			wantIfNoneMatch: aws.String("*"),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var input s3.PutObjectInput
+
+			tc.cond.apply(&input)
+
+			if diff := cmp.Diff(tc.wantIfMatch, input.IfMatch); diff != "" {
+				t.Errorf("IfMatch diff (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tc.wantIfNoneMatch, input.IfNoneMatch); diff != "" {
+				t.Errorf("IfNoneMatch diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewFromNameEndpointVariants(t *testing.T) {
+	cfg := aws.Config{
+		ConfigSources: []any{config.LoadOptions{
+			UseDualStackEndpoint: aws.DualStackEndpointStateEnabled,
+			UseFIPSEndpoint:      aws.FIPSEndpointStateEnabled,
+		}},
+	}
+
+	for _, tc := range []struct {
+		input         string
+		wantDualStack aws.DualStackEndpointState
+		wantFIPS      aws.FIPSEndpointState
+	}{
+		{
+			input:         "bucket",
+			wantDualStack: aws.DualStackEndpointStateEnabled,
+			wantFIPS:      aws.FIPSEndpointStateEnabled,
+		},
+		{
+			input: "https://localhost/bucket",
+		},
+	} {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := NewFromName(cfg, tc.input)
+			if err != nil {
+				t.Fatalf("NewFromName() failed: %v", err)
+			}
+
+			opts := got.client.Options().EndpointOptions
+
+			if opts.UseDualStackEndpoint != tc.wantDualStack {
+				t.Errorf("UseDualStackEndpoint = %v, want %v", opts.UseDualStackEndpoint, tc.wantDualStack)
+			}
+
+			if opts.UseFIPSEndpoint != tc.wantFIPS {
+				t.Errorf("UseFIPSEndpoint = %v, want %v", opts.UseFIPSEndpoint, tc.wantFIPS)
+			}
+		})
+	}
+}
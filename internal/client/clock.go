@@ -0,0 +1,43 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+var errNoServerTime = errors.New("response without server time")
+
+func clockSkewImpl(ctx context.Context, c getBucketVersioningClient, bucket string) (_ time.Duration, err error) {
+	defer annotateError(&err, "bucket %q", bucket)
+
+	result, err := c.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	serverTime, ok := awsmiddleware.GetServerTime(result.ResultMetadata)
+	if !ok {
+		return 0, errNoServerTime
+	}
+
+	responseAt, ok := awsmiddleware.GetResponseAt(result.ResultMetadata)
+	if !ok {
+		responseAt = time.Now()
+	}
+
+	return serverTime.Sub(responseAt), nil
+}
+
+// ClockSkew returns the difference between the time of the server according
+// to the Date header of a response and the local time. A positive value means
+// that the local clock is behind. The header has a resolution of one second.
+func (c *Client) ClockSkew(ctx context.Context) (time.Duration, error) {
+	return clockSkewImpl(ctx, c.client, c.name)
+}
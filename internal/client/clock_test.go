@@ -0,0 +1,42 @@
+package client
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/hansmi/s3-object-cleanup/internal/fakes3"
+)
+
+func TestClockSkew(t *testing.T) {
+	for _, offset := range []time.Duration{0, -time.Hour, 10 * time.Minute} {
+		t.Run(offset.String(), func(t *testing.T) {
+			server := httptest.NewServer(fakes3.New(fakes3.Options{
+				Bucket: "bucket",
+				Now: func() time.Time {
+					return time.Now().Add(offset)
+				},
+			}))
+			t.Cleanup(server.Close)
+
+			c, err := NewFromName(aws.Config{
+				Region:      "us-east-1",
+				Credentials: aws.AnonymousCredentials{},
+			}, server.URL+"/bucket")
+			if err != nil {
+				t.Fatalf("NewFromName() failed: %v", err)
+			}
+
+			got, err := c.ClockSkew(t.Context())
+			if err != nil {
+				t.Errorf("ClockSkew() failed: %v", err)
+			}
+
+			// The Date header is truncated to seconds.
+			if diff := (got - offset).Abs(); diff > 2*time.Second {
+				t.Errorf("ClockSkew() = %v, want %v", got, offset)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// ErrorClass is a coarse classification of request errors for statistics.
+type ErrorClass int
+
+const (
+	ErrorClassOther ErrorClass = iota
+	ErrorClassThrottling
+	ErrorClassAccessDenied
+	ErrorClassNotFound
+	ErrorClassLockViolation
+	ErrorClassNetwork
+)
+
+// ErrorClasses lists all classes in a stable order.
+var ErrorClasses = []ErrorClass{
+	ErrorClassThrottling,
+	ErrorClassAccessDenied,
+	ErrorClassNotFound,
+	ErrorClassLockViolation,
+	ErrorClassNetwork,
+	ErrorClassOther,
+}
+
+var errorClassNames = []string{
+	ErrorClassOther:         "other",
+	ErrorClassThrottling:    "throttling",
+	ErrorClassAccessDenied:  "access_denied",
+	ErrorClassNotFound:      "not_found",
+	ErrorClassLockViolation: "lock_violation",
+	ErrorClassNetwork:       "network",
+}
+
+func (c ErrorClass) String() string {
+	if int(c) < len(errorClassNames) {
+		return errorClassNames[c]
+	}
+
+	return errorClassNames[ErrorClassOther]
+}
+
+var accessDeniedCodes = []string{
+	"AccessDenied",
+	"AllAccessDisabled",
+	"InvalidAccessKeyId",
+	"SignatureDoesNotMatch",
+	"ExpiredToken",
+	"InvalidToken",
+}
+
+var notFoundCodes = []string{
+	errorCodeNoSuchKey,
+	errorCodeNotFound,
+	"NoSuchVersion",
+	"NoSuchBucket",
+}
+
+// Services reject modifications of versions under retention with varying
+// codes, e.g. AWS S3 with "AccessDenied", so the message is consulted as well.
+var lockViolationCodes = []string{
+	"ObjectLocked",
+	"InvalidRetentionPeriod",
+}
+
+// Messages of AWS S3 ("Access Denied because object protected by object
+// lock.") and MinIO ("Object is WORM protected and cannot be overwritten").
+var lockViolationMessages = []string{
+	"protected by object lock",
+	"object is worm protected",
+}
+
+// IAM denials name the missing action, which may mention retention, e.g.
+// "User: ... is not authorized to perform: s3:BypassGovernanceRetention".
+const accessDeniedMessage = "not authorized to perform"
+
+// ClassifyErrorCode classifies the error code and message reported by S3,
+// e.g. for an individual key of a DeleteObjects request.
+func ClassifyErrorCode(code, message string) ErrorClass {
+	lowerMessage := strings.ToLower(message)
+
+	switch {
+	case slices.Contains(lockViolationCodes, code) ||
+		((code == "AccessDenied" || code == "InvalidRequest") &&
+			containsAny(lowerMessage, lockViolationMessages) && !strings.Contains(lowerMessage, accessDeniedMessage)):
+		return ErrorClassLockViolation
+
+	case isThrottleCode(code):
+		return ErrorClassThrottling
+
+	case slices.Contains(accessDeniedCodes, code):
+		return ErrorClassAccessDenied
+
+	case slices.Contains(notFoundCodes, code):
+		return ErrorClassNotFound
+
+	case code == "RequestTimeout":
+		return ErrorClassNetwork
+	}
+
+	return ErrorClassOther
+}
+
+// ClassifyError classifies an error returned by a request.
+func ClassifyError(err error) ErrorClass {
+	var errApi smithy.APIError
+	var errResponse *smithyhttp.ResponseError
+	var errSend *smithyhttp.RequestSendError
+	var errNet net.Error
+
+	if err == nil {
+		return ErrorClassOther
+	}
+
+	if errors.As(err, &errApi) {
+		if class := ClassifyErrorCode(errApi.ErrorCode(), errApi.ErrorMessage()); class != ErrorClassOther {
+			return class
+		}
+	}
+
+	switch {
+	case IsThrottling(err):
+		return ErrorClassThrottling
+
+	case IsNotFound(err):
+		return ErrorClassNotFound
+
+	case errors.As(err, &errResponse):
+		switch errResponse.HTTPStatusCode() {
+		case http.StatusForbidden:
+			return ErrorClassAccessDenied
+		case http.StatusNotFound:
+			return ErrorClassNotFound
+		}
+
+	case errors.As(err, &errSend), errors.As(err, &errNet),
+		errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED):
+		return ErrorClassNetwork
+	}
+
+	return ErrorClassOther
+}
+
+func containsAny(s string, substrings []string) bool {
+	for _, i := range substrings {
+		if strings.Contains(s, i) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isThrottleCode(code string) bool {
+	_, ok := retry.DefaultThrottleErrorCodes[code]
+
+	return ok
+}
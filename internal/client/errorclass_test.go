@@ -0,0 +1,134 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+func TestClassifyError(t *testing.T) {
+	responseError := func(status int) error {
+		return &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{
+				Response: &http.Response{
+					StatusCode: status,
+				},
+			},
+			Err: os.ErrInvalid,
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		err  error
+		want ErrorClass
+	}{
+		{name: "nil", want: ErrorClassOther},
+		{name: "invalid", err: os.ErrInvalid, want: ErrorClassOther},
+		{
+			name: "SlowDown",
+			err:  &smithy.GenericAPIError{Code: "SlowDown"},
+			want: ErrorClassThrottling,
+		},
+		{
+			name: "service unavailable",
+			err:  responseError(http.StatusServiceUnavailable),
+			want: ErrorClassThrottling,
+		},
+		{
+			name: "access denied",
+			err:  fmt.Errorf("wrapped: %w", &smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied"}),
+			want: ErrorClassAccessDenied,
+		},
+		{
+			name: "forbidden",
+			err:  responseError(http.StatusForbidden),
+			want: ErrorClassAccessDenied,
+		},
+		{
+			name: "object lock",
+			err: &smithy.GenericAPIError{
+				Code:    "AccessDenied",
+				Message: "Access Denied because object protected by object lock.",
+			},
+			want: ErrorClassLockViolation,
+		},
+		{
+			name: "no such key",
+			err:  &types.NoSuchKey{},
+			want: ErrorClassNotFound,
+		},
+		{
+			name: "no such version",
+			err:  &smithy.GenericAPIError{Code: "NoSuchVersion"},
+			want: ErrorClassNotFound,
+		},
+		{
+			name: "not found status",
+			err:  responseError(http.StatusNotFound),
+			want: ErrorClassNotFound,
+		},
+		{
+			name: "internal error",
+			err:  responseError(http.StatusInternalServerError),
+			want: ErrorClassOther,
+		},
+		{
+			name: "send",
+			err:  &smithyhttp.RequestSendError{Err: syscall.ECONNREFUSED},
+			want: ErrorClassNetwork,
+		},
+		{
+			name: "connection reset",
+			err:  fmt.Errorf("read: %w", syscall.ECONNRESET),
+			want: ErrorClassNetwork,
+		},
+		{
+			name: "unexpected EOF",
+			err:  io.ErrUnexpectedEOF,
+			want: ErrorClassNetwork,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ClassifyError(tc.err); got != tc.want {
+				t.Errorf("ClassifyError(%v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestClassifyErrorCode(t *testing.T) {
+	for _, tc := range []struct {
+		code    string
+		message string
+		want    ErrorClass
+	}{
+		{want: ErrorClassOther},
+		{code: "InternalError", want: ErrorClassOther},
+		{code: "SlowDown", want: ErrorClassThrottling},
+		{code: "AccessDenied", message: "Access Denied", want: ErrorClassAccessDenied},
+		{code: "AccessDenied", message: "Access Denied because object protected by object lock.", want: ErrorClassLockViolation},
+		{code: "AccessDenied", message: "Object is WORM protected and cannot be overwritten", want: ErrorClassLockViolation},
+		{code: "AccessDenied", message: "User: arn:aws:iam::123456789012:user/cleanup is not authorized to perform: s3:PutObjectRetention on resource: \"arn:aws:s3:::bucket/key\" because no identity-based policy allows the s3:PutObjectRetention action", want: ErrorClassAccessDenied},
+		{code: "AccessDenied", message: "User: arn:aws:iam::123456789012:user/cleanup is not authorized to perform: s3:BypassGovernanceRetention on resource: \"arn:aws:s3:::bucket/key\" because no identity-based policy allows the s3:BypassGovernanceRetention action", want: ErrorClassAccessDenied},
+		{code: "AccessDenied", message: "User: arn:aws:sts::123456789012:assumed-role/cleanup/session is not authorized to perform: s3:DeleteObjectVersion on resource: \"arn:aws:s3:::object-lock/key\" with an explicit deny in a resource-based policy", want: ErrorClassAccessDenied},
+		{code: "InvalidRequest", message: "Bucket is missing ObjectLockConfiguration", want: ErrorClassOther},
+		{code: "InvalidRequest", message: "Invalid argument", want: ErrorClassOther},
+		{code: "ObjectLocked", want: ErrorClassLockViolation},
+		{code: "NoSuchVersion", want: ErrorClassNotFound},
+		{code: "RequestTimeout", want: ErrorClassNetwork},
+	} {
+		t.Run(tc.code, func(t *testing.T) {
+			if got := ClassifyErrorCode(tc.code, tc.message); got != tc.want {
+				t.Errorf("ClassifyErrorCode(%q, %q) = %v, want %v", tc.code, tc.message, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/aws/smithy-go"
+)
+
+// Flavor describes how an S3-compatible service deviates from AWS S3.
+type Flavor struct {
+	Name string
+
+	// Errors returned by the Object Lock APIs when the service, the plan or
+	// the credentials don't support Object Lock. They're treated like a
+	// missing Object Lock configuration.
+	objectLockUnsupported []errorMatch
+
+	// Error codes returned by GetObjectRetention for versions without
+	// retention in addition to NoSuchObjectLockConfiguration.
+	retentionNotFoundCodes []string
+
+	// ListObjectVersions may flag more than one entry of a key as the latest.
+	duplicateLatest bool
+
+	// Maximum number of versions per DeleteObjects request. Defaults to the
+	// AWS S3 limit if zero.
+	maxDeleteObjects int
+}
+
+// errorMatch selects API errors by code and, if any are given, by one of
+// several lowercase substrings of the message.
+type errorMatch struct {
+	code     string
+	messages []string
+}
+
+func (m errorMatch) matches(code, message string) bool {
+	if code != m.code {
+		return false
+	}
+
+	return len(m.messages) == 0 || containsAny(strings.ToLower(message), m.messages)
+}
+
+var (
+	FlavorAWS = Flavor{Name: "aws"}
+
+	// Backblaze B2 rejects Object Lock requests for buckets without File
+	// Lock or on plans without support for it instead of reporting a missing
+	// configuration. InvalidRequest is also returned for unrelated problems,
+	// so only those mentioning the lock configuration are matched.
+	FlavorB2 = Flavor{
+		Name: "b2",
+		objectLockUnsupported: []errorMatch{
+			{code: "NotImplemented"},
+			{code: "InvalidRequest", messages: []string{
+				"objectlockconfiguration",
+				"object lock configuration",
+				"file lock",
+			}},
+		},
+	}
+
+	// Legacy MinIO deployments in filesystem or gateway mode don't implement
+	// versioning and Object Lock.
+	FlavorMinIO = Flavor{
+		Name: "minio",
+		objectLockUnsupported: []errorMatch{
+			{code: "NotImplemented"},
+		},
+	}
+
+	// Ceph RADOS Gateway reports versions without retention like buckets
+	// without Object Lock. Its bucket index can transiently flag an older
+	// entry of a key as the latest in addition to the actual one, e.g. while
+	// a delete marker is being written.
+	FlavorCeph = Flavor{
+		Name: "ceph",
+		retentionNotFoundCodes: []string{
+			errorCodeObjectLockConfigurationNotFound,
+		},
+		duplicateLatest: true,
+	}
+)
+
+var flavors = []Flavor{
+	FlavorAWS,
+	FlavorB2,
+	FlavorMinIO,
+	FlavorCeph,
+}
+
+// FlavorNames returns the names of all known flavors.
+func FlavorNames() []string {
+	var names []string
+
+	for _, f := range flavors {
+		names = append(names, f.Name)
+	}
+
+	return names
+}
+
+// MaxDeleteObjects returns the maximum number of versions per DeleteObjects
+// request.
+func (f Flavor) MaxDeleteObjects() int {
+	if f.maxDeleteObjects < 1 {
+		return defaultMaxDeleteObjects
+	}
+
+	return f.maxDeleteObjects
+}
+
+// ParseFlavor returns the flavor with the given name. An empty name selects
+// AWS S3.
+func ParseFlavor(name string) (Flavor, error) {
+	if name == "" {
+		return FlavorAWS, nil
+	}
+
+	for _, f := range flavors {
+		if strings.EqualFold(f.Name, name) {
+			return f, nil
+		}
+	}
+
+	return Flavor{}, fmt.Errorf("%w: unknown S3 flavor %q (known: %s)", os.ErrInvalid, name, strings.Join(FlavorNames(), ", "))
+}
+
+func hasErrorCode(err error, codes []string) bool {
+	var errApi smithy.APIError
+
+	return errors.As(err, &errApi) && slices.Contains(codes, errApi.ErrorCode())
+}
+
+// isObjectLockUnsupported reports whether the error signals that Object Lock
+// isn't available.
+func (f Flavor) isObjectLockUnsupported(err error) bool {
+	var errApi smithy.APIError
+
+	if !errors.As(err, &errApi) {
+		return false
+	}
+
+	return slices.ContainsFunc(f.objectLockUnsupported, func(m errorMatch) bool {
+		return m.matches(errApi.ErrorCode(), errApi.ErrorMessage())
+	})
+}
+
+// isRetentionNotFound reports whether the error signals that an object
+// version has no retention configured.
+func (f Flavor) isRetentionNotFound(err error) bool {
+	return IsNoObjectLockConfiguration(err) || hasErrorCode(err, f.retentionNotFoundCodes)
+}
+
+// DuplicateLatest reports whether listings may flag more than one entry of a
+// key as the latest. Only the most recent of them is the actual latest
+// version.
+func (f Flavor) DuplicateLatest() bool {
+	return f.duplicateLatest
+}
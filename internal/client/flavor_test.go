@@ -0,0 +1,36 @@
+package client
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestParseFlavor(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		want    string
+		wantErr error
+	}{
+		{name: "", want: "aws"},
+		{name: "aws", want: "aws"},
+		{name: "B2", want: "b2"},
+		{name: "minio", want: "minio"},
+		{name: "ceph", want: "ceph"},
+		{name: "unknown", wantErr: os.ErrInvalid},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseFlavor(tc.name)
+
+			if diff := cmp.Diff(tc.wantErr, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("Error diff (-want +got):\n%s", diff)
+			}
+
+			if got.Name != tc.want {
+				t.Errorf("ParseFlavor(%q) = %q, want %q", tc.name, got.Name, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package client
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+const errorCodeNoSuchLifecycleConfiguration = "NoSuchLifecycleConfiguration"
+
+type getBucketLifecycleConfigurationClient interface {
+	GetBucketLifecycleConfiguration(context.Context, *s3.GetBucketLifecycleConfigurationInput, ...func(*s3.Options)) (*s3.GetBucketLifecycleConfigurationOutput, error)
+}
+
+func lifecycleRulesImpl(ctx context.Context, c getBucketLifecycleConfigurationClient, bucket string) (_ []types.LifecycleRule, err error) {
+	defer annotateError(&err, "bucket %q", bucket)
+
+	result, err := c.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		var errApi smithy.APIError
+
+		if errors.As(err, &errApi) && errApi.ErrorCode() == errorCodeNoSuchLifecycleConfiguration {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return result.Rules, nil
+}
+
+// LifecycleRules returns the lifecycle rules configured for the bucket. Nil is
+// returned if there are none.
+func (c *Client) LifecycleRules(ctx context.Context) ([]types.LifecycleRule, error) {
+	return lifecycleRulesImpl(ctx, c.client, c.name)
+}
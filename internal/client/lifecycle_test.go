@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+type fakeGetBucketLifecycleConfigurationClient struct {
+	output *s3.GetBucketLifecycleConfigurationOutput
+	err    error
+}
+
+func (c *fakeGetBucketLifecycleConfigurationClient) GetBucketLifecycleConfiguration(context.Context, *s3.GetBucketLifecycleConfigurationInput, ...func(*s3.Options)) (*s3.GetBucketLifecycleConfigurationOutput, error) {
+	return c.output, c.err
+}
+
+func TestLifecycleRules(t *testing.T) {
+	rules := []types.LifecycleRule{
+		{ID: aws.String("expire"), Status: types.ExpirationStatusEnabled},
+	}
+
+	for _, tc := range []struct {
+		name    string
+		client  fakeGetBucketLifecycleConfigurationClient
+		want    []types.LifecycleRule
+		wantErr error
+	}{
+		{
+			name: "rules",
+			client: fakeGetBucketLifecycleConfigurationClient{
+				output: &s3.GetBucketLifecycleConfigurationOutput{Rules: rules},
+			},
+			want: rules,
+		},
+		{
+			name: "not configured",
+			client: fakeGetBucketLifecycleConfigurationClient{
+				err: &smithy.GenericAPIError{Code: "NoSuchLifecycleConfiguration"},
+			},
+		},
+		{
+			name: "error",
+			client: fakeGetBucketLifecycleConfigurationClient{
+				err: os.ErrPermission,
+			},
+			wantErr: os.ErrPermission,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := lifecycleRulesImpl(t.Context(), &tc.client, "bucket")
+
+			if diff := cmp.Diff(tc.wantErr, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("Error diff (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tc.want, got, cmpopts.IgnoreUnexported(types.LifecycleRule{})); diff != "" {
+				t.Errorf("LifecycleRules() diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+const errorCodeAccessDenied = "AccessDenied"
+
+// Directory below the prefix of the bucket for keys used by probes.
+const probeKeyPrefix = ".s3-object-cleanup-probe/"
+
+var errPreflightNoVersion = errors.New("no object version to probe")
+
+// IsAccessDenied reports whether the request was rejected for lack of
+// permissions, either with "AccessDenied" or an HTTP 403 response.
+func IsAccessDenied(err error) bool {
+	var errApi smithy.APIError
+	var errResponse *smithyhttp.ResponseError
+
+	switch {
+	case errors.As(err, &errApi) && errApi.ErrorCode() == errorCodeAccessDenied:
+		return true
+	case errors.As(err, &errResponse) && errResponse.HTTPStatusCode() == http.StatusForbidden:
+		return true
+	}
+
+	return false
+}
+
+// errorMentions reports whether the message of an API error contains the
+// given text, e.g. the IAM action in "User: ... is not authorized to perform:
+// s3:PutObjectRetention ...".
+func errorMentions(err error, text string) bool {
+	var errApi smithy.APIError
+
+	return errors.As(err, &errApi) && strings.Contains(errApi.ErrorMessage(), text)
+}
+
+// PermissionStatus is the outcome of probing a permission.
+type PermissionStatus int
+
+const (
+	// The probe was inconclusive, e.g. because the service validated the
+	// request before checking permissions.
+	PermissionUnknown PermissionStatus = iota
+	PermissionGranted
+	PermissionDenied
+)
+
+func (s PermissionStatus) String() string {
+	switch s {
+	case PermissionGranted:
+		return "granted"
+	case PermissionDenied:
+		return "denied"
+	}
+
+	return "unknown"
+}
+
+// PermissionProbe describes whether the credentials were granted an action
+// on the bucket.
+type PermissionProbe struct {
+	// IAM action, e.g. "s3:ListBucketVersions".
+	Action string
+
+	Status PermissionStatus
+
+	// Error returned by the probe request, if any.
+	Err error
+}
+
+func newPermissionProbe(action string, err error) PermissionProbe {
+	result := PermissionProbe{
+		Action: action,
+		Err:    err,
+	}
+
+	switch {
+	case err == nil:
+		result.Status = PermissionGranted
+	case IsAccessDenied(err):
+		result.Status = PermissionDenied
+	}
+
+	return result
+}
+
+type PreflightOptions struct {
+	// Probe the permission for deleting versions. DeleteObjects is sent
+	// without any entries, making the request a no-op.
+	Delete bool
+
+	// Probe the permission for extending retention in buckets with Object
+	// Lock. PutObjectRetention is sent for a random key which doesn't exist,
+	// so a granted permission results in a "not found" error. Without
+	// s3:ListBucket, S3 rejects requests for missing keys as denied, so only
+	// denials naming the action are conclusive.
+	ExtendRetention bool
+}
+
+type preflightClient interface {
+	getObjectLockConfigurationClient
+	GetObjectRetentionClient
+	putObjectRetentionClient
+
+	ListObjectVersions(context.Context, *s3.ListObjectVersionsInput, ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error)
+	DeleteObjects(context.Context, *s3.DeleteObjectsInput, ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+}
+
+func preflightImpl(ctx context.Context, c preflightClient, flavor Flavor, bucket, prefix string, opts PreflightOptions) []PermissionProbe {
+	var result []PermissionProbe
+
+	listing, err := c.ListObjectVersions(ctx, &s3.ListObjectVersionsInput{
+		Bucket:  aws.String(bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int32(1),
+	})
+
+	result = append(result, newPermissionProbe("s3:ListBucketVersions", err))
+
+	objectLock, err := objectLockEnabledImpl(ctx, c, flavor, bucket)
+
+	result = append(result, newPermissionProbe("s3:GetBucketObjectLockConfiguration", err))
+
+	// Retention is only looked up in buckets with Object Lock. The check is
+	// assumed to succeed if the configuration can't be retrieved.
+	if err != nil || objectLock {
+		probe := PermissionProbe{
+			Action: "s3:GetObjectRetention",
+			Err:    errPreflightNoVersion,
+		}
+
+		if listing != nil && len(listing.Versions) > 0 {
+			version := listing.Versions[0]
+
+			_, err := getObjectRetentionImpl(ctx, c, flavor, bucket, aws.ToString(version.Key), aws.ToString(version.VersionId))
+
+			probe = newPermissionProbe(probe.Action, err)
+		}
+
+		result = append(result, probe)
+	}
+
+	if opts.ExtendRetention && (err != nil || objectLock) {
+		_, err := c.PutObjectRetention(ctx, &s3.PutObjectRetentionInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(prefix + probeKeyPrefix + rand.Text()),
+			Retention: &types.ObjectLockRetention{
+				Mode:            types.ObjectLockRetentionModeGovernance,
+				RetainUntilDate: aws.Time(time.Now().Add(time.Hour)),
+			},
+		})
+
+		probe := newPermissionProbe("s3:PutObjectRetention", err)
+
+		switch {
+		case ClassifyError(err) == ErrorClassNotFound:
+			probe.Status = PermissionGranted
+		case probe.Status == PermissionDenied && !errorMentions(err, probe.Action):
+			probe.Status = PermissionUnknown
+		}
+
+		result = append(result, probe)
+	}
+
+	if opts.Delete {
+		_, err := c.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &types.Delete{
+				Objects: []types.ObjectIdentifier{},
+				Quiet:   aws.Bool(true),
+			},
+		})
+
+		// Services commonly reject the empty request as malformed, leaving
+		// the outcome unknown. Only an explicit denial is conclusive.
+		result = append(result, newPermissionProbe("s3:DeleteObjectVersion", err))
+	}
+
+	return result
+}
+
+// Preflight probes the permissions needed for cleaning up the bucket using
+// cheap requests. Only denied permissions are conclusive; probes may fail for
+// other reasons. The results are cached, so repeated calls with the same
+// options don't issue further requests.
+func (c *Client) Preflight(ctx context.Context, opts PreflightOptions) []PermissionProbe {
+	c.probeMu.Lock()
+	defer c.probeMu.Unlock()
+
+	if result, ok := c.probes[opts]; ok {
+		return result
+	}
+
+	result := preflightImpl(ctx, c.client, c.flavor, c.name, c.prefix, opts)
+
+	if ctx.Err() == nil {
+		if c.probes == nil {
+			c.probes = map[PreflightOptions][]PermissionProbe{}
+		}
+
+		c.probes[opts] = result
+	}
+
+	return result
+}
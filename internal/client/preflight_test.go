@@ -0,0 +1,317 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/hansmi/s3-object-cleanup/internal/fakes3"
+)
+
+type fakePreflightClient struct {
+	fakeGetObjectLockConfigurationClient
+	fakeGetObjectRetentionClient
+
+	versions  []types.ObjectVersion
+	listErr   error
+	deleteErr error
+	deletes   int
+	putErr    error
+	putKeys   []string
+}
+
+func (c *fakePreflightClient) ListObjectVersions(context.Context, *s3.ListObjectVersionsInput, ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+	if c.listErr != nil {
+		return nil, c.listErr
+	}
+
+	return &s3.ListObjectVersionsOutput{Versions: c.versions}, nil
+}
+
+func (c *fakePreflightClient) DeleteObjects(_ context.Context, input *s3.DeleteObjectsInput, _ ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	c.deletes += len(input.Delete.Objects)
+
+	if c.deleteErr != nil {
+		return nil, c.deleteErr
+	}
+
+	return &s3.DeleteObjectsOutput{}, nil
+}
+
+func (c *fakePreflightClient) PutObjectRetention(_ context.Context, input *s3.PutObjectRetentionInput, _ ...func(*s3.Options)) (*s3.PutObjectRetentionOutput, error) {
+	c.putKeys = append(c.putKeys, aws.ToString(input.Key))
+
+	if c.putErr != nil {
+		return nil, c.putErr
+	}
+
+	return &s3.PutObjectRetentionOutput{}, nil
+}
+
+func TestIsAccessDenied(t *testing.T) {
+	if !IsAccessDenied(&smithy.GenericAPIError{Code: "AccessDenied"}) {
+		t.Error("IsAccessDenied(AccessDenied) = false")
+	}
+
+	if IsAccessDenied(&smithy.GenericAPIError{Code: "MalformedXML"}) {
+		t.Error("IsAccessDenied(MalformedXML) = true")
+	}
+
+	if IsAccessDenied(nil) {
+		t.Error("IsAccessDenied(nil) = true")
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	errDenied := &smithy.GenericAPIError{Code: "AccessDenied"}
+	errMalformed := &smithy.GenericAPIError{Code: "MalformedXML"}
+
+	lockEnabled := fakeGetObjectLockConfigurationClient{
+		output: &s3.GetObjectLockConfigurationOutput{
+			ObjectLockConfiguration: &types.ObjectLockConfiguration{
+				ObjectLockEnabled: types.ObjectLockEnabledEnabled,
+			},
+		},
+	}
+
+	noRetention := fakeGetObjectRetentionClient{
+		err: &smithy.GenericAPIError{Code: "NoSuchObjectLockConfiguration"},
+	}
+
+	versions := []types.ObjectVersion{
+		{Key: aws.String("key"), VersionId: aws.String("v1")},
+	}
+
+	type result struct {
+		Action string
+		Status PermissionStatus
+	}
+
+	for _, tc := range []struct {
+		name   string
+		client fakePreflightClient
+		opts   PreflightOptions
+		want   []result
+	}{
+		{
+			name: "without object lock",
+			client: fakePreflightClient{
+				fakeGetObjectLockConfigurationClient: fakeGetObjectLockConfigurationClient{
+					output: &s3.GetObjectLockConfigurationOutput{},
+				},
+				versions: versions,
+			},
+			want: []result{
+				{"s3:ListBucketVersions", PermissionGranted},
+				{"s3:GetBucketObjectLockConfiguration", PermissionGranted},
+			},
+		},
+		{
+			name: "retention granted",
+			client: fakePreflightClient{
+				fakeGetObjectLockConfigurationClient: lockEnabled,
+				fakeGetObjectRetentionClient: fakeGetObjectRetentionClient{
+					err: &smithy.GenericAPIError{Code: "NoSuchObjectLockConfiguration"},
+				},
+				versions:  versions,
+				deleteErr: errMalformed,
+			},
+			opts: PreflightOptions{Delete: true},
+			want: []result{
+				{"s3:ListBucketVersions", PermissionGranted},
+				{"s3:GetBucketObjectLockConfiguration", PermissionGranted},
+				{"s3:GetObjectRetention", PermissionGranted},
+				{"s3:DeleteObjectVersion", PermissionUnknown},
+			},
+		},
+		{
+			name: "extend retention granted",
+			client: fakePreflightClient{
+				fakeGetObjectLockConfigurationClient: lockEnabled,
+				fakeGetObjectRetentionClient:         noRetention,
+				versions:                             versions,
+				putErr:                               &types.NoSuchKey{},
+			},
+			opts: PreflightOptions{ExtendRetention: true},
+			want: []result{
+				{"s3:ListBucketVersions", PermissionGranted},
+				{"s3:GetBucketObjectLockConfiguration", PermissionGranted},
+				{"s3:GetObjectRetention", PermissionGranted},
+				{"s3:PutObjectRetention", PermissionGranted},
+			},
+		},
+		{
+			name: "extend retention denied",
+			client: fakePreflightClient{
+				fakeGetObjectLockConfigurationClient: lockEnabled,
+				fakeGetObjectRetentionClient:         noRetention,
+				versions:                             versions,
+				putErr: &smithy.GenericAPIError{
+					Code:    "AccessDenied",
+					Message: "User: arn:aws:iam::123456789012:user/cleanup is not authorized to perform: s3:PutObjectRetention on resource: \"arn:aws:s3:::bucket/key\" because no identity-based policy allows the s3:PutObjectRetention action",
+				},
+			},
+			opts: PreflightOptions{ExtendRetention: true},
+			want: []result{
+				{"s3:ListBucketVersions", PermissionGranted},
+				{"s3:GetBucketObjectLockConfiguration", PermissionGranted},
+				{"s3:GetObjectRetention", PermissionGranted},
+				{"s3:PutObjectRetention", PermissionDenied},
+			},
+		},
+		{
+			// S3 rejects requests for missing keys without
+			// s3:ListBucket.
+			name: "extend retention missing key denied",
+			client: fakePreflightClient{
+				fakeGetObjectLockConfigurationClient: lockEnabled,
+				fakeGetObjectRetentionClient:         noRetention,
+				versions:                             versions,
+				putErr:                               &smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied"},
+			},
+			opts: PreflightOptions{ExtendRetention: true},
+			want: []result{
+				{"s3:ListBucketVersions", PermissionGranted},
+				{"s3:GetBucketObjectLockConfiguration", PermissionGranted},
+				{"s3:GetObjectRetention", PermissionGranted},
+				{"s3:PutObjectRetention", PermissionUnknown},
+			},
+		},
+		{
+			name: "extend retention without object lock",
+			client: fakePreflightClient{
+				fakeGetObjectLockConfigurationClient: fakeGetObjectLockConfigurationClient{
+					output: &s3.GetObjectLockConfigurationOutput{},
+				},
+			},
+			opts: PreflightOptions{ExtendRetention: true},
+			want: []result{
+				{"s3:ListBucketVersions", PermissionGranted},
+				{"s3:GetBucketObjectLockConfiguration", PermissionGranted},
+			},
+		},
+		{
+			name: "empty bucket",
+			client: fakePreflightClient{
+				fakeGetObjectLockConfigurationClient: lockEnabled,
+			},
+			want: []result{
+				{"s3:ListBucketVersions", PermissionGranted},
+				{"s3:GetBucketObjectLockConfiguration", PermissionGranted},
+				{"s3:GetObjectRetention", PermissionUnknown},
+			},
+		},
+		{
+			name: "denied",
+			client: fakePreflightClient{
+				fakeGetObjectLockConfigurationClient: fakeGetObjectLockConfigurationClient{
+					err: errDenied,
+				},
+				fakeGetObjectRetentionClient: fakeGetObjectRetentionClient{
+					err: errDenied,
+				},
+				versions:  versions,
+				deleteErr: errDenied,
+			},
+			opts: PreflightOptions{Delete: true},
+			want: []result{
+				{"s3:ListBucketVersions", PermissionGranted},
+				{"s3:GetBucketObjectLockConfiguration", PermissionDenied},
+				{"s3:GetObjectRetention", PermissionDenied},
+				{"s3:DeleteObjectVersion", PermissionDenied},
+			},
+		},
+		{
+			name: "listing failed",
+			client: fakePreflightClient{
+				fakeGetObjectLockConfigurationClient: lockEnabled,
+				listErr:                              os.ErrDeadlineExceeded,
+			},
+			want: []result{
+				{"s3:ListBucketVersions", PermissionUnknown},
+				{"s3:GetBucketObjectLockConfiguration", PermissionGranted},
+				{"s3:GetObjectRetention", PermissionUnknown},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []result
+
+			for _, i := range preflightImpl(t.Context(), &tc.client, FlavorAWS, "bucket", "", tc.opts) {
+				got = append(got, result{i.Action, i.Status})
+			}
+
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Probes diff (-want +got):\n%s", diff)
+			}
+
+			if tc.client.deletes != 0 {
+				t.Errorf("Probe requested deletion of %d versions", tc.client.deletes)
+			}
+
+			for _, key := range tc.client.putKeys {
+				if !strings.HasPrefix(key, probeKeyPrefix) || key == probeKeyPrefix {
+					t.Errorf("Retention probe for key %q outside of %q", key, probeKeyPrefix)
+				}
+			}
+		})
+	}
+}
+
+func TestClientPreflightCached(t *testing.T) {
+	var requests atomic.Int32
+
+	fake := fakes3.New(fakes3.Options{
+		Bucket: "bucket",
+		Deny:   []string{"PutObjectRetention"},
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fake.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	c, err := NewFromName(aws.Config{
+		Region:      "us-east-1",
+		Credentials: aws.AnonymousCredentials{},
+	}, server.URL+"/bucket")
+	if err != nil {
+		t.Fatalf("NewFromName() failed: %v", err)
+	}
+
+	opts := PreflightOptions{ExtendRetention: true}
+
+	first := c.Preflight(t.Context(), opts)
+	count := requests.Load()
+
+	if diff := cmp.Diff(first, c.Preflight(t.Context(), opts), cmpopts.EquateErrors()); diff != "" {
+		t.Errorf("Cached probes diff (-first +second):\n%s", diff)
+	}
+
+	if got := requests.Load(); got != count {
+		t.Errorf("Repeated probe issued %d requests, want none", got-count)
+	}
+
+	var denied []string
+
+	for _, probe := range first {
+		if probe.Status == PermissionDenied {
+			denied = append(denied, probe.Action)
+		}
+	}
+
+	if diff := cmp.Diff([]string{"s3:PutObjectRetention"}, denied); diff != "" {
+		t.Errorf("Denied actions diff (-want +got):\n%s", diff)
+	}
+}
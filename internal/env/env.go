@@ -57,3 +57,54 @@ func GetDuration(key string, fallback time.Duration) (time.Duration, error) {
 func MustGetDuration(key string, fallback time.Duration) time.Duration {
 	return successOrDie(GetDuration(key, fallback))
 }
+
+func GetFloat(key string, fallback float64) (float64, error) {
+	if raw := os.Getenv(key); raw != "" {
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return 0, fmt.Errorf("environment variable %q: %w", key, err)
+		}
+
+		return parsed, nil
+	}
+
+	return fallback, nil
+}
+
+func MustGetFloat(key string, fallback float64) float64 {
+	return successOrDie(GetFloat(key, fallback))
+}
+
+func GetInt(key string, fallback int) (int, error) {
+	if raw := os.Getenv(key); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			return 0, fmt.Errorf("environment variable %q: %w", key, err)
+		}
+
+		return parsed, nil
+	}
+
+	return fallback, nil
+}
+
+func MustGetInt(key string, fallback int) int {
+	return successOrDie(GetInt(key, fallback))
+}
+
+func GetUint64(key string, fallback uint64) (uint64, error) {
+	if raw := os.Getenv(key); raw != "" {
+		parsed, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("environment variable %q: %w", key, err)
+		}
+
+		return parsed, nil
+	}
+
+	return fallback, nil
+}
+
+func MustGetUint64(key string, fallback uint64) uint64 {
+	return successOrDie(GetUint64(key, fallback))
+}
@@ -115,3 +115,150 @@ func TestGetDuration(t *testing.T) {
 		})
 	}
 }
+
+func TestGetFloat(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		value    *string
+		fallback float64
+		want     float64
+		wantErr  error
+	}{
+		{name: "unset"},
+		{
+			name:  "empty",
+			value: ref.Ref(""),
+		},
+		{
+			name:  "fraction",
+			value: ref.Ref("12.5"),
+			want:  12.5,
+		},
+		{
+			name:     "fallback",
+			fallback: 3,
+			want:     3,
+		},
+		{
+			name:    "error",
+			value:   ref.Ref("nope"),
+			wantErr: strconv.ErrSyntax,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Unsetenv(envVarName)
+
+			if tc.value != nil {
+				os.Setenv(envVarName, *tc.value)
+			}
+
+			got, err := GetFloat(envVarName, tc.fallback)
+
+			if diff := cmp.Diff(tc.wantErr, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("Error diff (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("GetFloat diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetInt(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		value    *string
+		fallback int
+		want     int
+		wantErr  error
+	}{
+		{name: "unset"},
+		{
+			name:  "empty",
+			value: ref.Ref(""),
+		},
+		{
+			name:  "negative",
+			value: ref.Ref("-17"),
+			want:  -17,
+		},
+		{
+			name:     "fallback",
+			fallback: 100,
+			want:     100,
+		},
+		{
+			name:    "error",
+			value:   ref.Ref("1.5"),
+			wantErr: strconv.ErrSyntax,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Unsetenv(envVarName)
+
+			if tc.value != nil {
+				os.Setenv(envVarName, *tc.value)
+			}
+
+			got, err := GetInt(envVarName, tc.fallback)
+
+			if diff := cmp.Diff(tc.wantErr, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("Error diff (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("GetInt diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetUint64(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		value    *string
+		fallback uint64
+		want     uint64
+		wantErr  error
+	}{
+		{name: "unset"},
+		{
+			name:  "empty",
+			value: ref.Ref(""),
+		},
+		{
+			name:  "large",
+			value: ref.Ref("18446744073709551615"),
+			want:  18446744073709551615,
+		},
+		{
+			name:     "fallback",
+			fallback: 100,
+			want:     100,
+		},
+		{
+			name:    "negative",
+			value:   ref.Ref("-1"),
+			wantErr: strconv.ErrSyntax,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Unsetenv(envVarName)
+
+			if tc.value != nil {
+				os.Setenv(envVarName, *tc.value)
+			}
+
+			got, err := GetUint64(envVarName, tc.fallback)
+
+			if diff := cmp.Diff(tc.wantErr, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("Error diff (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("GetUint64 diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,496 @@
+// Package fakes3 implements an in-memory subset of the S3 API sufficient for
+// running the cleanup pipeline against a single versioned bucket with Object
+// Lock. Requests are served path-style.
+package fakes3
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+const timeFormat = "2006-01-02T15:04:05.000Z"
+
+const defaultMaxKeys = 1000
+
+// Version is an object version or delete marker.
+type Version struct {
+	Key          string
+	VersionID    string
+	LastModified time.Time
+	Size         int64
+	DeleteMarker bool
+
+	// Deletion fails before the retention ended. Zero if no retention is
+	// configured.
+	RetainUntil time.Time
+}
+
+type Options struct {
+	Bucket string
+
+	// Delay added to every request.
+	Latency time.Duration
+
+	// Report Object Lock as not configured.
+	NoObjectLock bool
+
+	// Used to check retention when deleting and for the Date header of
+	// responses. Defaults to time.Now.
+	Now func() time.Time
+
+	// Operations answered with AccessDenied, e.g. "PutObjectRetention".
+	Deny []string
+}
+
+// Server is an http.Handler serving a single bucket.
+type Server struct {
+	opts Options
+
+	mu sync.Mutex
+
+	// Sorted keys with at least one version.
+	keys []string
+
+	// Versions of each key, most recent first.
+	versions map[string][]*Version
+}
+
+func New(opts Options) *Server {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+
+	return &Server{
+		opts:     opts,
+		versions: map[string][]*Version{},
+	}
+}
+
+// Add stores a version. Versions of a key must be added in chronological
+// order.
+func (s *Server) Add(v Version) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.versions[v.Key]
+	if !ok {
+		idx, _ := slices.BinarySearch(s.keys, v.Key)
+		s.keys = slices.Insert(s.keys, idx, v.Key)
+	}
+
+	s.versions[v.Key] = append([]*Version{&v}, existing...)
+}
+
+// Versions returns all stored versions sorted by key and in reverse
+// chronological order.
+func (s *Server) Versions() []Version {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []Version
+
+	for _, key := range s.keys {
+		for _, v := range s.versions[key] {
+			result = append(result, *v)
+		}
+	}
+
+	return result
+}
+
+func (s *Server) find(key, versionID string) *Version {
+	for _, v := range s.versions[key] {
+		if v.VersionID == versionID {
+			return v
+		}
+	}
+
+	return nil
+}
+
+type errorResponse struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+func writeXML(w http.ResponseWriter, status int, value any) {
+	body, err := xml.Marshal(value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Length", strconv.Itoa(len(xml.Header)+len(body)))
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	w.Write(body)
+}
+
+func writeError(w http.ResponseWriter, status int, code, format string, args ...any) {
+	writeXML(w, status, errorResponse{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.opts.Latency > 0 {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(s.opts.Latency):
+		}
+	}
+
+	w.Header().Set("Date", s.opts.Now().UTC().Format(http.TimeFormat))
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+
+	if bucket != s.opts.Bucket {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", "bucket %q does not exist", bucket)
+		return
+	}
+
+	query := r.URL.Query()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var operation string
+	var handler func()
+
+	switch {
+	case key == "" && r.Method == http.MethodGet && query.Has("versioning"):
+		operation, handler = "GetBucketVersioning", func() { s.getBucketVersioning(w) }
+	case key == "" && r.Method == http.MethodGet && query.Has("object-lock"):
+		operation, handler = "GetObjectLockConfiguration", func() { s.getObjectLockConfiguration(w) }
+	case key == "" && r.Method == http.MethodGet && query.Has("versions"):
+		operation, handler = "ListObjectVersions", func() { s.listObjectVersions(w, r) }
+	case key == "" && r.Method == http.MethodPost && query.Has("delete"):
+		operation, handler = "DeleteObjects", func() { s.deleteObjects(w, r) }
+	case key != "" && r.Method == http.MethodGet && query.Has("retention"):
+		operation, handler = "GetObjectRetention", func() { s.getObjectRetention(w, key, query.Get("versionId")) }
+	case key != "" && r.Method == http.MethodPut && query.Has("retention"):
+		operation, handler = "PutObjectRetention", func() { s.putObjectRetention(w, r, key, query.Get("versionId")) }
+	case key != "" && r.Method == http.MethodHead:
+		operation, handler = "HeadObject", func() { s.headObject(w, key, query.Get("versionId")) }
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "%s %s is not implemented", r.Method, r.URL)
+		return
+	}
+
+	if slices.Contains(s.opts.Deny, operation) {
+		writeError(w, http.StatusForbidden, "AccessDenied", "User: anonymous is not authorized to perform: s3:%s", operation)
+		return
+	}
+
+	handler()
+}
+
+func (s *Server) getBucketVersioning(w http.ResponseWriter) {
+	writeXML(w, http.StatusOK, struct {
+		XMLName xml.Name `xml:"VersioningConfiguration"`
+		Xmlns   string   `xml:"xmlns,attr"`
+		Status  string   `xml:"Status"`
+	}{
+		Xmlns:  xmlns,
+		Status: "Enabled",
+	})
+}
+
+func (s *Server) getObjectLockConfiguration(w http.ResponseWriter) {
+	if s.opts.NoObjectLock {
+		writeError(w, http.StatusNotFound, "ObjectLockConfigurationNotFoundError", "Object Lock configuration does not exist for this bucket")
+		return
+	}
+
+	writeXML(w, http.StatusOK, struct {
+		XMLName           xml.Name `xml:"ObjectLockConfiguration"`
+		Xmlns             string   `xml:"xmlns,attr"`
+		ObjectLockEnabled string   `xml:"ObjectLockEnabled"`
+	}{
+		Xmlns:             xmlns,
+		ObjectLockEnabled: "Enabled",
+	})
+}
+
+type listVersionEntry struct {
+	XMLName      xml.Name
+	Key          string `xml:"Key"`
+	VersionID    string `xml:"VersionId"`
+	IsLatest     bool   `xml:"IsLatest"`
+	LastModified string `xml:"LastModified"`
+	Size         *int64 `xml:"Size,omitempty"`
+	StorageClass string `xml:"StorageClass,omitempty"`
+}
+
+type listVersionsResult struct {
+	XMLName             xml.Name `xml:"ListVersionsResult"`
+	Xmlns               string   `xml:"xmlns,attr"`
+	Name                string   `xml:"Name"`
+	Prefix              string   `xml:"Prefix"`
+	KeyMarker           string   `xml:"KeyMarker"`
+	VersionIDMarker     string   `xml:"VersionIdMarker"`
+	NextKeyMarker       string   `xml:"NextKeyMarker,omitempty"`
+	NextVersionIDMarker string   `xml:"NextVersionIdMarker,omitempty"`
+	MaxKeys             int      `xml:"MaxKeys"`
+	IsTruncated         bool     `xml:"IsTruncated"`
+	Entries             []listVersionEntry
+}
+
+func (s *Server) listObjectVersions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	result := listVersionsResult{
+		Xmlns:           xmlns,
+		Name:            s.opts.Bucket,
+		Prefix:          query.Get("prefix"),
+		KeyMarker:       query.Get("key-marker"),
+		VersionIDMarker: query.Get("version-id-marker"),
+		MaxKeys:         defaultMaxKeys,
+	}
+
+	if value := query.Get("max-keys"); value != "" {
+		maxKeys, err := strconv.Atoi(value)
+		if err != nil || maxKeys < 0 {
+			writeError(w, http.StatusBadRequest, "InvalidArgument", "invalid max-keys %q", value)
+			return
+		}
+
+		result.MaxKeys = min(maxKeys, defaultMaxKeys)
+	}
+
+	idx, _ := slices.BinarySearch(s.keys, max(result.KeyMarker, result.Prefix))
+
+	for ; idx < len(s.keys); idx++ {
+		key := s.keys[idx]
+
+		if !strings.HasPrefix(key, result.Prefix) {
+			break
+		}
+
+		versions := s.versions[key]
+
+		if key == result.KeyMarker {
+			if result.VersionIDMarker == "" {
+				continue
+			}
+
+			pos := slices.IndexFunc(versions, func(v *Version) bool {
+				return v.VersionID == result.VersionIDMarker
+			})
+			versions = versions[pos+1:]
+		}
+
+		for _, v := range versions {
+			if len(result.Entries) >= result.MaxKeys {
+				result.IsTruncated = true
+				break
+			}
+
+			entry := listVersionEntry{
+				Key:          v.Key,
+				VersionID:    v.VersionID,
+				IsLatest:     v == s.versions[key][0],
+				LastModified: v.LastModified.UTC().Format(timeFormat),
+			}
+
+			if v.DeleteMarker {
+				entry.XMLName.Local = "DeleteMarker"
+			} else {
+				entry.XMLName.Local = "Version"
+				entry.Size = &v.Size
+				entry.StorageClass = "STANDARD"
+			}
+
+			result.Entries = append(result.Entries, entry)
+			result.NextKeyMarker = v.Key
+			result.NextVersionIDMarker = v.VersionID
+		}
+
+		if result.IsTruncated {
+			break
+		}
+	}
+
+	if !result.IsTruncated {
+		result.NextKeyMarker = ""
+		result.NextVersionIDMarker = ""
+	}
+
+	writeXML(w, http.StatusOK, result)
+}
+
+type deleteRequest struct {
+	Objects []struct {
+		Key       string `xml:"Key"`
+		VersionID string `xml:"VersionId"`
+	} `xml:"Object"`
+	Quiet bool `xml:"Quiet"`
+}
+
+type deletedEntry struct {
+	XMLName   xml.Name `xml:"Deleted"`
+	Key       string   `xml:"Key"`
+	VersionID string   `xml:"VersionId,omitempty"`
+}
+
+type deleteErrorEntry struct {
+	XMLName   xml.Name `xml:"Error"`
+	Key       string   `xml:"Key"`
+	VersionID string   `xml:"VersionId,omitempty"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+}
+
+func (s *Server) remove(key, versionID string) {
+	versions := slices.DeleteFunc(s.versions[key], func(v *Version) bool {
+		return v.VersionID == versionID
+	})
+
+	if len(versions) > 0 {
+		s.versions[key] = versions
+		return
+	}
+
+	delete(s.versions, key)
+
+	if idx, found := slices.BinarySearch(s.keys, key); found {
+		s.keys = slices.Delete(s.keys, idx, idx+1)
+	}
+}
+
+func (s *Server) deleteObjects(w http.ResponseWriter, r *http.Request) {
+	var req deleteRequest
+
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "MalformedXML", "%v", err)
+		return
+	}
+
+	var result struct {
+		XMLName xml.Name `xml:"DeleteResult"`
+		Xmlns   string   `xml:"xmlns,attr"`
+		Entries []any
+	}
+
+	result.Xmlns = xmlns
+
+	now := s.opts.Now()
+
+	for _, obj := range req.Objects {
+		if v := s.find(obj.Key, obj.VersionID); v != nil && v.RetainUntil.After(now) {
+			result.Entries = append(result.Entries, deleteErrorEntry{
+				Key:       obj.Key,
+				VersionID: obj.VersionID,
+				Code:      "AccessDenied",
+				Message:   "Access Denied because object protected by object lock.",
+			})
+			continue
+		}
+
+		s.remove(obj.Key, obj.VersionID)
+
+		if !req.Quiet {
+			result.Entries = append(result.Entries, deletedEntry{
+				Key:       obj.Key,
+				VersionID: obj.VersionID,
+			})
+		}
+	}
+
+	writeXML(w, http.StatusOK, result)
+}
+
+type retention struct {
+	XMLName         xml.Name `xml:"Retention"`
+	Xmlns           string   `xml:"xmlns,attr,omitempty"`
+	Mode            string   `xml:"Mode"`
+	RetainUntilDate string   `xml:"RetainUntilDate"`
+}
+
+func (s *Server) lookup(w http.ResponseWriter, key, versionID string) *Version {
+	v := s.find(key, versionID)
+	if v == nil {
+		writeError(w, http.StatusNotFound, "NoSuchVersion", "version %q of key %q does not exist", versionID, key)
+	}
+
+	return v
+}
+
+func (s *Server) getObjectRetention(w http.ResponseWriter, key, versionID string) {
+	v := s.lookup(w, key, versionID)
+	if v == nil {
+		return
+	}
+
+	if v.RetainUntil.IsZero() {
+		writeError(w, http.StatusNotFound, "NoSuchObjectLockConfiguration", "The specified object does not have a ObjectLock configuration")
+		return
+	}
+
+	writeXML(w, http.StatusOK, retention{
+		Xmlns:           xmlns,
+		Mode:            "COMPLIANCE",
+		RetainUntilDate: v.RetainUntil.UTC().Format(timeFormat),
+	})
+}
+
+func (s *Server) putObjectRetention(w http.ResponseWriter, r *http.Request, key, versionID string) {
+	v := s.lookup(w, key, versionID)
+	if v == nil {
+		return
+	}
+
+	var req retention
+
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "MalformedXML", "%v", err)
+		return
+	}
+
+	until, err := time.Parse(time.RFC3339, req.RetainUntilDate)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", "retain until date: %v", err)
+		return
+	}
+
+	if until.Before(v.RetainUntil) {
+		writeError(w, http.StatusForbidden, "AccessDenied", "retention can't be shortened in compliance mode")
+		return
+	}
+
+	v.RetainUntil = until
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) headObject(w http.ResponseWriter, key, versionID string) {
+	v := s.find(key, versionID)
+	if v == nil || v.DeleteMarker {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	h := w.Header()
+	h.Set("Content-Length", strconv.FormatInt(v.Size, 10))
+	h.Set("Last-Modified", v.LastModified.UTC().Format(http.TimeFormat))
+	h.Set("x-amz-version-id", v.VersionID)
+
+	if !v.RetainUntil.IsZero() {
+		h.Set("x-amz-object-lock-mode", "COMPLIANCE")
+		h.Set("x-amz-object-lock-retain-until-date", v.RetainUntil.UTC().Format(timeFormat))
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,203 @@
+package fakes3
+
+import (
+	stdcmp "cmp"
+	"fmt"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+func newTestClient(t *testing.T, s *Server) *s3.Client {
+	t.Helper()
+
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+
+	return s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(ts.URL),
+		UsePathStyle: true,
+		Credentials:  aws.AnonymousCredentials{},
+	})
+}
+
+func TestListObjectVersions(t *testing.T) {
+	base := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	s := New(Options{Bucket: "bucket"})
+
+	var want []string
+
+	for i := range 5 {
+		key := fmt.Sprintf("key%d", 4-i)
+
+		for j := range 3 {
+			s.Add(Version{
+				Key:          key,
+				VersionID:    fmt.Sprintf("v%d", j),
+				LastModified: base.Add(time.Duration(j) * time.Hour),
+				DeleteMarker: j == 2 && i%2 == 0,
+			})
+		}
+	}
+
+	for i := range 5 {
+		for j := range 3 {
+			want = append(want, fmt.Sprintf("key%d/v%d latest=%t", i, 2-j, j == 0))
+		}
+	}
+
+	c := newTestClient(t, s)
+
+	var got []string
+
+	paginator := s3.NewListObjectVersionsPaginator(c, &s3.ListObjectVersionsInput{
+		Bucket:  aws.String("bucket"),
+		MaxKeys: aws.Int32(4),
+	})
+
+	var pages int
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(t.Context())
+		if err != nil {
+			t.Fatalf("NextPage() failed: %v", err)
+		}
+
+		pages++
+
+		var entries []string
+
+		for _, v := range page.Versions {
+			entries = append(entries, fmt.Sprintf("%s/%s latest=%t", aws.ToString(v.Key), aws.ToString(v.VersionId), aws.ToBool(v.IsLatest)))
+		}
+
+		for _, m := range page.DeleteMarkers {
+			entries = append(entries, fmt.Sprintf("%s/%s latest=%t", aws.ToString(m.Key), aws.ToString(m.VersionId), aws.ToBool(m.IsLatest)))
+		}
+
+		// Versions and delete markers are returned separately. Version IDs
+		// are chronological within a key.
+		slices.SortFunc(entries, func(a, b string) int {
+			keyA, _, _ := strings.Cut(a, "/")
+			keyB, _, _ := strings.Cut(b, "/")
+
+			return stdcmp.Or(strings.Compare(keyA, keyB), strings.Compare(b, a))
+		})
+
+		got = append(got, entries...)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Listing diff (-want +got):\n%s", diff)
+	}
+
+	if pages != 4 {
+		t.Errorf("Listing took %d pages, want 4", pages)
+	}
+}
+
+func TestRetentionAndDelete(t *testing.T) {
+	now := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+	s := New(Options{
+		Bucket: "bucket",
+		Now:    func() time.Time { return now },
+	})
+	s.Add(Version{Key: "a", VersionID: "1"})
+	s.Add(Version{Key: "b", VersionID: "1", RetainUntil: now.Add(time.Hour)})
+
+	c := newTestClient(t, s)
+
+	if _, err := c.GetObjectRetention(t.Context(), &s3.GetObjectRetentionInput{
+		Bucket:    aws.String("bucket"),
+		Key:       aws.String("a"),
+		VersionId: aws.String("1"),
+	}); err == nil {
+		t.Errorf("GetObjectRetention() without retention succeeded")
+	}
+
+	until := now.Add(24 * time.Hour)
+
+	if _, err := c.PutObjectRetention(t.Context(), &s3.PutObjectRetentionInput{
+		Bucket:    aws.String("bucket"),
+		Key:       aws.String("b"),
+		VersionId: aws.String("1"),
+		Retention: &types.ObjectLockRetention{
+			Mode:            types.ObjectLockRetentionModeCompliance,
+			RetainUntilDate: aws.Time(until),
+		},
+	}); err != nil {
+		t.Errorf("PutObjectRetention() failed: %v", err)
+	}
+
+	output, err := c.GetObjectRetention(t.Context(), &s3.GetObjectRetentionInput{
+		Bucket:    aws.String("bucket"),
+		Key:       aws.String("b"),
+		VersionId: aws.String("1"),
+	})
+	if err != nil {
+		t.Errorf("GetObjectRetention() failed: %v", err)
+	} else if got := aws.ToTime(output.Retention.RetainUntilDate); !got.Equal(until) {
+		t.Errorf("Retention is %v, want %v", got, until)
+	}
+
+	deleted, err := c.DeleteObjects(t.Context(), &s3.DeleteObjectsInput{
+		Bucket: aws.String("bucket"),
+		Delete: &types.Delete{
+			Objects: []types.ObjectIdentifier{
+				{Key: aws.String("a"), VersionId: aws.String("1")},
+				{Key: aws.String("b"), VersionId: aws.String("1")},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("DeleteObjects() failed: %v", err)
+	}
+
+	if len(deleted.Deleted) != 1 || len(deleted.Errors) != 1 {
+		t.Errorf("DeleteObjects() deleted %d and failed %d versions, want 1 each", len(deleted.Deleted), len(deleted.Errors))
+	}
+
+	if diff := cmp.Diff([]Version{{Key: "b", VersionID: "1", RetainUntil: until}}, s.Versions()); diff != "" {
+		t.Errorf("Remaining versions diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestDeny(t *testing.T) {
+	s := New(Options{
+		Bucket: "bucket",
+		Deny:   []string{"PutObjectRetention"},
+	})
+	s.Add(Version{Key: "a", VersionID: "1"})
+
+	c := newTestClient(t, s)
+
+	if _, err := c.GetObjectRetention(t.Context(), &s3.GetObjectRetentionInput{
+		Bucket:    aws.String("bucket"),
+		Key:       aws.String("missing"),
+		VersionId: aws.String("1"),
+	}); err == nil || strings.Contains(err.Error(), "AccessDenied") {
+		t.Errorf("GetObjectRetention() returned %v, want NoSuchVersion", err)
+	}
+
+	if _, err := c.PutObjectRetention(t.Context(), &s3.PutObjectRetentionInput{
+		Bucket:    aws.String("bucket"),
+		Key:       aws.String("a"),
+		VersionId: aws.String("1"),
+		Retention: &types.ObjectLockRetention{
+			Mode:            types.ObjectLockRetentionModeCompliance,
+			RetainUntilDate: aws.Time(time.Now().Add(time.Hour)),
+		},
+	}); err == nil || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Errorf("PutObjectRetention() returned %v, want AccessDenied", err)
+	}
+}
@@ -0,0 +1,117 @@
+package state
+
+import (
+	"errors"
+	"time"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+// DeleteAudit is the outcome of deleting an object version.
+type DeleteAudit struct {
+	Key          string
+	VersionID    string
+	LastModified time.Time
+	Size         int64
+	DeleteMarker bool
+
+	// Time of the deletion attempt.
+	At time.Time
+
+	// Error reported for the version. Both are empty if the deletion
+	// succeeded.
+	ErrorCode    string
+	ErrorMessage string
+}
+
+func (a DeleteAudit) Success() bool {
+	return a.ErrorCode == "" && a.ErrorMessage == ""
+}
+
+type deleteAuditRecord struct {
+	PK           objectRetentionRecordKey
+	LastModified time.Time
+	Size         int64
+	DeleteMarker bool
+	At           time.Time
+	ErrorCode    string
+	ErrorMessage string
+}
+
+func (r *deleteAuditRecord) audit() DeleteAudit {
+	return DeleteAudit{
+		Key:          r.PK.Key,
+		VersionID:    r.PK.VersionID,
+		LastModified: r.LastModified,
+		Size:         r.Size,
+		DeleteMarker: r.DeleteMarker,
+		At:           r.At,
+		ErrorCode:    r.ErrorCode,
+		ErrorMessage: r.ErrorMessage,
+	}
+}
+
+// PutDeleteAudit records the outcome of deleting a version, replacing the
+// outcome of an earlier attempt.
+func (b *Bucket) PutDeleteAudit(a DeleteAudit) error {
+	record := deleteAuditRecord{
+		PK: objectRetentionRecordKey{
+			Key:       a.Key,
+			VersionID: a.VersionID,
+		},
+		LastModified: a.LastModified,
+		Size:         a.Size,
+		DeleteMarker: a.DeleteMarker,
+		At:           a.At,
+		ErrorCode:    a.ErrorCode,
+		ErrorMessage: a.ErrorMessage,
+	}
+
+	return b.db.Bolt().Update(func(tx *bolt.Tx) error {
+		bucket := b.get(tx)
+
+		return b.db.UpsertBucket(bucket, record.PK, record)
+	})
+}
+
+// ForEachDeleteAudit invokes a function for all recorded deletion outcomes in
+// order of key and version ID.
+func (b *Bucket) ForEachDeleteAudit(fn func(DeleteAudit) error) error {
+	return b.db.Bolt().View(func(tx *bolt.Tx) error {
+		bucket := b.get(tx)
+
+		return b.db.ForEachInBucket(bucket, &bolthold.Query{}, func(record *deleteAuditRecord) error {
+			return fn(record.audit())
+		})
+	})
+}
+
+// PruneDeleteAudit removes the outcomes of deletions attempted before the
+// given time and returns their number.
+func (b *Bucket) PruneDeleteAudit(before time.Time) (int, error) {
+	var expired []objectRetentionRecordKey
+
+	if err := b.db.Bolt().Update(func(tx *bolt.Tx) error {
+		bucket := b.get(tx)
+
+		if err := b.db.ForEachInBucket(bucket, bolthold.Where("At").Lt(before), func(record *deleteAuditRecord) error {
+			expired = append(expired, record.PK)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, pk := range expired {
+			if err := b.db.DeleteFromBucket(bucket, pk, deleteAuditRecord{}); err != nil && !errors.Is(err, bolthold.ErrNotFound) {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	return len(expired), nil
+}
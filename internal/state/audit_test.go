@@ -0,0 +1,91 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func collectDeleteAudit(t *testing.T, b *Bucket) []DeleteAudit {
+	t.Helper()
+
+	var got []DeleteAudit
+
+	if err := b.ForEachDeleteAudit(func(a DeleteAudit) error {
+		got = append(got, a)
+		return nil
+	}); err != nil {
+		t.Errorf("ForEachDeleteAudit() failed: %v", err)
+	}
+
+	return got
+}
+
+func TestBucketDeleteAudit(t *testing.T) {
+	b := newBucketForTest(t)
+
+	if got := collectDeleteAudit(t, b); len(got) != 0 {
+		t.Errorf("ForEachDeleteAudit() returned %v for empty state", got)
+	}
+
+	first := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	second := first.Add(24 * time.Hour)
+
+	failed := DeleteAudit{
+		Key:          "key",
+		VersionID:    "v1",
+		LastModified: time.Date(2019, time.June, 1, 0, 0, 0, 0, time.UTC),
+		Size:         123,
+		At:           first,
+		ErrorCode:    "AccessDenied",
+		ErrorMessage: "Access Denied",
+	}
+
+	deleted := DeleteAudit{
+		Key:          "key",
+		VersionID:    "v0",
+		DeleteMarker: true,
+		At:           first,
+	}
+
+	for _, a := range []DeleteAudit{failed, deleted} {
+		if err := b.PutDeleteAudit(a); err != nil {
+			t.Errorf("PutDeleteAudit() failed: %v", err)
+		}
+	}
+
+	if diff := cmp.Diff([]DeleteAudit{deleted, failed}, collectDeleteAudit(t, b)); diff != "" {
+		t.Errorf("Delete audit diff (-want +got):\n%s", diff)
+	}
+
+	if failed.Success() {
+		t.Errorf("Failed deletion reported as success")
+	}
+
+	// Successful retry in a later run.
+	retried := failed
+	retried.At = second
+	retried.ErrorCode = ""
+	retried.ErrorMessage = ""
+
+	if err := b.PutDeleteAudit(retried); err != nil {
+		t.Errorf("PutDeleteAudit() failed: %v", err)
+	}
+
+	if count, err := b.PruneDeleteAudit(second); err != nil {
+		t.Errorf("PruneDeleteAudit() failed: %v", err)
+	} else if count != 1 {
+		t.Errorf("PruneDeleteAudit() removed %d records, want 1", count)
+	}
+
+	got := collectDeleteAudit(t, b)
+
+	if diff := cmp.Diff([]DeleteAudit{retried}, got); diff != "" {
+		t.Errorf("Delete audit diff (-want +got):\n%s", diff)
+	}
+
+	if !got[0].Success() {
+		t.Errorf("Successful deletion reported as failure")
+	}
+}
@@ -61,29 +61,41 @@ type objectRetentionRecord struct {
 	RetainUntil time.Time
 }
 
-func (b *Bucket) GetObjectRetention(key, versionID string) (time.Time, error) {
+// GetObjectRetention returns the recorded retention of a version. A zero time
+// with the second return value being true means that the version has no
+// retention. The second return value is false if no retention was recorded.
+func (b *Bucket) GetObjectRetention(key, versionID string) (time.Time, bool, error) {
 	pk := objectRetentionRecordKey{
 		Key:       key,
 		VersionID: versionID,
 	}
 
 	var record objectRetentionRecord
+	var found bool
 
 	if err := b.db.Bolt().View(func(tx *bolt.Tx) error {
 		bucket := b.get(tx)
 
-		if err := b.db.GetFromBucket(bucket, pk, &record); err != nil && !errors.Is(err, bolthold.ErrNotFound) {
+		if err := b.db.GetFromBucket(bucket, pk, &record); err != nil {
+			if errors.Is(err, bolthold.ErrNotFound) {
+				return nil
+			}
+
 			return err
 		}
 
+		found = true
+
 		return nil
 	}); err != nil {
-		return time.Time{}, err
+		return time.Time{}, false, err
 	}
 
-	return record.RetainUntil, nil
+	return record.RetainUntil, found, nil
 }
 
+// SetObjectRetention records the retention of a version. A zero time records
+// that the version has no retention.
 func (b *Bucket) SetObjectRetention(key, versionID string, until time.Time) error {
 	record := objectRetentionRecord{
 		PK: objectRetentionRecordKey{
@@ -117,3 +129,160 @@ func (b *Bucket) DeleteObjectRetention(key, versionID string) error {
 		return nil
 	})
 }
+
+// PruneObjectRetention removes retention records which are no longer useful:
+// retention periods which ended before the given time and records without
+// retention which haven't been refreshed since then. The number of removed
+// records is returned.
+func (b *Bucket) PruneObjectRetention(before time.Time) (int, error) {
+	var expired []objectRetentionRecordKey
+
+	if err := b.db.Bolt().Update(func(tx *bolt.Tx) error {
+		bucket := b.get(tx)
+
+		if err := b.db.ForEachInBucket(bucket, &bolthold.Query{}, func(record *objectRetentionRecord) error {
+			if record.RetainUntil.IsZero() {
+				if record.MTime.Before(before) {
+					expired = append(expired, record.PK)
+				}
+			} else if record.RetainUntil.Before(before) {
+				expired = append(expired, record.PK)
+			}
+
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, pk := range expired {
+			if err := b.db.DeleteFromBucket(bucket, pk, objectRetentionRecord{}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	return len(expired), nil
+}
+
+type deletionScheduleRecord struct {
+	PK          objectRetentionRecordKey
+	ScheduledAt time.Time
+}
+
+// GetDeletionSchedule returns the time at which an object version was first
+// found to be eligible for deletion. The zero time is returned if the version
+// isn't scheduled.
+func (b *Bucket) GetDeletionSchedule(key, versionID string) (time.Time, error) {
+	pk := objectRetentionRecordKey{
+		Key:       key,
+		VersionID: versionID,
+	}
+
+	var record deletionScheduleRecord
+
+	if err := b.db.Bolt().View(func(tx *bolt.Tx) error {
+		bucket := b.get(tx)
+
+		if err := b.db.GetFromBucket(bucket, pk, &record); err != nil && !errors.Is(err, bolthold.ErrNotFound) {
+			return err
+		}
+
+		return nil
+	}); err != nil {
+		return time.Time{}, err
+	}
+
+	return record.ScheduledAt, nil
+}
+
+func (b *Bucket) SetDeletionSchedule(key, versionID string, at time.Time) error {
+	record := deletionScheduleRecord{
+		PK: objectRetentionRecordKey{
+			Key:       key,
+			VersionID: versionID,
+		},
+		ScheduledAt: at,
+	}
+
+	return b.db.Bolt().Update(func(tx *bolt.Tx) error {
+		bucket := b.get(tx)
+
+		return b.db.UpsertBucket(bucket, record.PK, record)
+	})
+}
+
+func (b *Bucket) DeleteDeletionSchedule(key, versionID string) error {
+	pk := objectRetentionRecordKey{
+		Key:       key,
+		VersionID: versionID,
+	}
+
+	return b.db.Bolt().Update(func(tx *bolt.Tx) error {
+		bucket := b.get(tx)
+
+		if err := b.db.DeleteFromBucket(bucket, pk, deletionScheduleRecord{}); err != nil && !errors.Is(err, bolthold.ErrNotFound) {
+			return err
+		}
+
+		return nil
+	})
+}
+
+const listingMarkerKey = "listing-marker:v1"
+
+// ListingMarker is the position from which listing object versions resumes.
+type ListingMarker struct {
+	KeyMarker       string
+	VersionIDMarker string
+	MTime           time.Time
+}
+
+func (m ListingMarker) IsZero() bool {
+	return m.KeyMarker == "" && m.VersionIDMarker == ""
+}
+
+// GetListingMarker returns the position at which a previous listing stopped.
+// The zero value is returned if no marker is stored.
+func (b *Bucket) GetListingMarker() (ListingMarker, error) {
+	var record ListingMarker
+
+	if err := b.db.Bolt().View(func(tx *bolt.Tx) error {
+		bucket := b.get(tx)
+
+		if err := b.db.GetFromBucket(bucket, listingMarkerKey, &record); err != nil && !errors.Is(err, bolthold.ErrNotFound) {
+			return err
+		}
+
+		return nil
+	}); err != nil {
+		return ListingMarker{}, err
+	}
+
+	return record, nil
+}
+
+func (b *Bucket) SetListingMarker(m ListingMarker) error {
+	m.MTime = time.Now()
+
+	return b.db.Bolt().Update(func(tx *bolt.Tx) error {
+		bucket := b.get(tx)
+
+		return b.db.UpsertBucket(bucket, listingMarkerKey, m)
+	})
+}
+
+func (b *Bucket) DeleteListingMarker() error {
+	return b.db.Bolt().Update(func(tx *bolt.Tx) error {
+		bucket := b.get(tx)
+
+		if err := b.db.DeleteFromBucket(bucket, listingMarkerKey, ListingMarker{}); err != nil && !errors.Is(err, bolthold.ErrNotFound) {
+			return err
+		}
+
+		return nil
+	})
+}
@@ -24,13 +24,27 @@ func newBucketForTest(t *testing.T) *Bucket {
 func TestBucketGetObjectRetention(t *testing.T) {
 	b := newBucketForTest(t)
 
-	ts, err := b.GetObjectRetention("", "")
+	ts, found, err := b.GetObjectRetention("", "")
 	if err != nil {
 		t.Errorf("GetObjectRetention() failed: %v", err)
 	}
 
-	if !ts.IsZero() {
-		t.Errorf("GetObjectRetention() returned non-zero time")
+	if !ts.IsZero() || found {
+		t.Errorf("GetObjectRetention() = (%v, %v), want zero and not found", ts, found)
+	}
+}
+
+func TestBucketObjectRetentionWithout(t *testing.T) {
+	b := newBucketForTest(t)
+
+	if err := b.SetObjectRetention("key", "v", time.Time{}); err != nil {
+		t.Errorf("SetObjectRetention() failed: %v", err)
+	}
+
+	if got, found, err := b.GetObjectRetention("key", "v"); err != nil {
+		t.Errorf("GetObjectRetention() failed: %v", err)
+	} else if !got.IsZero() || !found {
+		t.Errorf("GetObjectRetention() = (%v, %v), want zero and found", got, found)
 	}
 }
 
@@ -49,7 +63,7 @@ func TestBucketSetObjectRetention(t *testing.T) {
 		t.Errorf("SetObjectRetention() failed: %v", err)
 	}
 
-	got, err := b.GetObjectRetention(key, version)
+	got, _, err := b.GetObjectRetention(key, version)
 	if err != nil {
 		t.Errorf("GetObjectRetention() failed: %v", err)
 	}
@@ -76,7 +90,7 @@ func TestBucketDeleteObjectRetention(t *testing.T) {
 		t.Errorf("SetObjectRetention() failed: %v", err)
 	}
 
-	if _, err := b.GetObjectRetention(key, version); err != nil {
+	if _, _, err := b.GetObjectRetention(key, version); err != nil {
 		t.Errorf("GetObjectRetention() failed: %v", err)
 	}
 
@@ -84,9 +98,131 @@ func TestBucketDeleteObjectRetention(t *testing.T) {
 		t.Errorf("DeleteObjectRetention() failed: %v", err)
 	}
 
-	if got, err := b.GetObjectRetention(key, version); err != nil {
+	if got, found, err := b.GetObjectRetention(key, version); err != nil {
+		t.Errorf("GetObjectRetention() failed: %v", err)
+	} else if found {
+		t.Errorf("GetObjectRetention() returned %v after delete", got)
+	}
+}
+
+func TestBucketDeletionSchedule(t *testing.T) {
+	const (
+		key     = "key"
+		version = "ver"
+	)
+
+	b := newBucketForTest(t)
+
+	if got, err := b.GetDeletionSchedule(key, version); err != nil {
+		t.Errorf("GetDeletionSchedule() failed: %v", err)
+	} else if !got.IsZero() {
+		t.Errorf("GetDeletionSchedule() returned non-zero time: %v", got)
+	}
+
+	want := time.Date(2001, time.February, 3, 4, 5, 6, 0, time.UTC)
+
+	if err := b.SetDeletionSchedule(key, version, want); err != nil {
+		t.Errorf("SetDeletionSchedule() failed: %v", err)
+	}
+
+	// Retention records are independent.
+	if got, _, err := b.GetObjectRetention(key, version); err != nil {
 		t.Errorf("GetObjectRetention() failed: %v", err)
 	} else if !got.IsZero() {
-		t.Errorf("GetObjectRetention() returned non-zero value after delete: %v", got)
+		t.Errorf("GetObjectRetention() returned non-zero time: %v", got)
+	}
+
+	if got, err := b.GetDeletionSchedule(key, version); err != nil {
+		t.Errorf("GetDeletionSchedule() failed: %v", err)
+	} else if !want.Equal(got) {
+		t.Errorf("GetDeletionSchedule() returned %v, want %v", got, want)
+	}
+
+	if err := b.DeleteDeletionSchedule(key, version); err != nil {
+		t.Errorf("DeleteDeletionSchedule() failed: %v", err)
+	}
+
+	if got, err := b.GetDeletionSchedule(key, version); err != nil {
+		t.Errorf("GetDeletionSchedule() failed: %v", err)
+	} else if !got.IsZero() {
+		t.Errorf("GetDeletionSchedule() returned non-zero value after delete: %v", got)
+	}
+}
+
+func TestBucketListingMarker(t *testing.T) {
+	b := newBucketForTest(t)
+
+	if got, err := b.GetListingMarker(); err != nil {
+		t.Errorf("GetListingMarker() failed: %v", err)
+	} else if !got.IsZero() {
+		t.Errorf("GetListingMarker() returned non-zero marker: %+v", got)
+	}
+
+	if err := b.SetListingMarker(ListingMarker{KeyMarker: "key", VersionIDMarker: "ver"}); err != nil {
+		t.Errorf("SetListingMarker() failed: %v", err)
+	}
+
+	if got, err := b.GetListingMarker(); err != nil {
+		t.Errorf("GetListingMarker() failed: %v", err)
+	} else if got.KeyMarker != "key" || got.VersionIDMarker != "ver" || got.MTime.IsZero() {
+		t.Errorf("GetListingMarker() returned %+v", got)
+	}
+
+	if err := b.DeleteListingMarker(); err != nil {
+		t.Errorf("DeleteListingMarker() failed: %v", err)
+	}
+
+	if got, err := b.GetListingMarker(); err != nil {
+		t.Errorf("GetListingMarker() failed: %v", err)
+	} else if !got.IsZero() {
+		t.Errorf("GetListingMarker() returned non-zero marker after delete: %+v", got)
+	}
+
+	if err := b.DeleteListingMarker(); err != nil {
+		t.Errorf("DeleteListingMarker() failed: %v", err)
+	}
+}
+
+func TestBucketPruneObjectRetention(t *testing.T) {
+	b := newBucketForTest(t)
+
+	now := time.Now()
+
+	for _, i := range []struct {
+		version string
+		until   time.Time
+	}{
+		{"expired", now.Add(-48 * time.Hour)},
+		{"active", now.Add(48 * time.Hour)},
+		{"recent-none", time.Time{}},
+	} {
+		if err := b.SetObjectRetention("key", i.version, i.until); err != nil {
+			t.Errorf("SetObjectRetention() failed: %v", err)
+		}
+	}
+
+	if count, err := b.PruneObjectRetention(now.Add(-time.Hour)); err != nil {
+		t.Errorf("PruneObjectRetention() failed: %v", err)
+	} else if count != 1 {
+		t.Errorf("PruneObjectRetention() removed %d records, want 1", count)
+	}
+
+	if got, found, err := b.GetObjectRetention("key", "expired"); err != nil {
+		t.Errorf("GetObjectRetention() failed: %v", err)
+	} else if found {
+		t.Errorf("GetObjectRetention() returned %v for pruned record", got)
+	}
+
+	if got, _, err := b.GetObjectRetention("key", "active"); err != nil {
+		t.Errorf("GetObjectRetention() failed: %v", err)
+	} else if got.IsZero() {
+		t.Errorf("GetObjectRetention() returned zero time for active record")
+	}
+
+	// Records without retention are pruned once they're no longer refreshed.
+	if count, err := b.PruneObjectRetention(time.Now().Add(time.Hour)); err != nil {
+		t.Errorf("PruneObjectRetention() failed: %v", err)
+	} else if count != 1 {
+		t.Errorf("PruneObjectRetention() removed %d records, want 1", count)
 	}
 }
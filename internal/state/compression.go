@@ -1,6 +1,7 @@
 package state
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"io"
@@ -9,6 +10,14 @@ import (
 	"github.com/klauspost/compress/gzip"
 )
 
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
 func CreateUnlinkedTemp(dir, pattern string) (*os.File, error) {
 	f, err := os.CreateTemp(dir, pattern)
 	if err != nil {
@@ -23,17 +32,26 @@ func CreateUnlinkedTemp(dir, pattern string) (*os.File, error) {
 	return f, nil
 }
 
-// WriteCompressed writes a compressed database snapshot. Callers must close
+// WriteCompressed writes a compressed database snapshot, encrypted if a key is
+// given. Databases with many free pages are compacted first. Callers must close
 // the returned reader.
-func (s *Store) WriteCompressed(tmpdir string) (io.ReadCloser, error) {
+func (s *Store) WriteCompressed(tmpdir string, key *EncryptionKey) (io.ReadSeekCloser, error) {
 	tmpfile, err := CreateUnlinkedTemp(tmpdir, "compressed*")
 	if err != nil {
 		return nil, err
 	}
 
-	zw := gzip.NewWriter(tmpfile)
+	var w io.WriteCloser = nopWriteCloser{tmpfile}
 
-	if _, err := s.WriteTo(zw); err != nil {
+	if key != nil {
+		if w, err = newEncryptWriter(tmpfile, key); err != nil {
+			return nil, errors.Join(fmt.Errorf("encryption: %w", err), tmpfile.Close())
+		}
+	}
+
+	zw := gzip.NewWriter(w)
+
+	if _, err := s.writeSnapshot(tmpdir, zw); err != nil {
 		return nil, errors.Join(fmt.Errorf("database snapshot: %w", err), tmpfile.Close())
 	}
 
@@ -41,6 +59,10 @@ func (s *Store) WriteCompressed(tmpdir string) (io.ReadCloser, error) {
 		return nil, errors.Join(fmt.Errorf("compression: %w", err), tmpfile.Close())
 	}
 
+	if err := w.Close(); err != nil {
+		return nil, errors.Join(fmt.Errorf("encryption: %w", err), tmpfile.Close())
+	}
+
 	if _, err := tmpfile.Seek(0, os.SEEK_SET); err != nil {
 		return nil, errors.Join(err, tmpfile.Close())
 	}
@@ -49,28 +71,50 @@ func (s *Store) WriteCompressed(tmpdir string) (io.ReadCloser, error) {
 }
 
 // OpenCompressed decompresses the contents of a state database before opening
-// it.
-func OpenCompressed(tmpdir string, r io.Reader) (_ *Store, err error) {
+// it. Encrypted snapshots require a key. Unencrypted snapshots are accepted
+// regardless of the key to allow enabling encryption.
+func OpenCompressed(tmpdir string, r io.Reader, key *EncryptionKey) (_ *Store, err error) {
+	br := bufio.NewReader(r)
+	r = br
+
+	if isEncrypted(br) {
+		if key == nil {
+			return nil, ErrEncrypted
+		}
+
+		if r, err = newDecryptReader(br, key); err != nil {
+			return nil, err
+		}
+	}
+
 	zr, err := gzip.NewReader(r)
 	if err != nil {
 		return nil, fmt.Errorf("decompression: %w", err)
 	}
 
+	// The snapshot is decompressed directly into the database file without
+	// an intermediate copy.
 	f, err := os.CreateTemp(tmpdir, "state*")
 	if err != nil {
 		return nil, err
 	}
 
 	defer func() {
-		err = errors.Join(err, f.Close())
+		if err != nil {
+			err = errors.Join(err, os.Remove(f.Name()))
+		}
 	}()
 
 	if _, err := io.Copy(f, zr); err != nil {
-		return nil, fmt.Errorf("copying: %w", err)
+		return nil, errors.Join(fmt.Errorf("copying: %w", err), f.Close())
 	}
 
 	if err := zr.Close(); err != nil {
-		return nil, fmt.Errorf("decompression: %w", err)
+		return nil, errors.Join(fmt.Errorf("decompression: %w", err), f.Close())
+	}
+
+	if err := f.Close(); err != nil {
+		return nil, err
 	}
 
 	return Open(f.Name())
@@ -17,7 +17,7 @@ func TestWriteCompressed(t *testing.T) {
 		t.Errorf("New() failed: %v", err)
 	}
 
-	r, err := s.WriteCompressed(t.TempDir())
+	r, err := s.WriteCompressed(t.TempDir(), nil)
 	if err != nil {
 		t.Errorf("WriteCompressed() failed: %v", err)
 	}
@@ -71,7 +71,7 @@ func TestOpenCompressed(t *testing.T) {
 				t.Errorf("Close() failed: %v", err)
 			}
 
-			_, err := OpenCompressed(t.TempDir(), &buf)
+			_, err := OpenCompressed(t.TempDir(), &buf, nil)
 
 			if diff := cmp.Diff(tc.wantErr, err, cmpopts.EquateErrors()); diff != "" {
 				t.Errorf("Error diff (-want +got):\n%s", diff)
@@ -86,12 +86,12 @@ func TestCompressionRoundTrip(t *testing.T) {
 		t.Errorf("New() failed: %v", err)
 	}
 
-	r, err := s.WriteCompressed(t.TempDir())
+	r, err := s.WriteCompressed(t.TempDir(), nil)
 	if err != nil {
 		t.Errorf("WriteCompressed() failed: %v", err)
 	}
 
-	s2, err := OpenCompressed(t.TempDir(), r)
+	s2, err := OpenCompressed(t.TempDir(), r, nil)
 	if err != nil {
 		t.Errorf("OpenCompressed() failed: %v", err)
 	}
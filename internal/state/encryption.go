@@ -0,0 +1,241 @@
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Encrypted snapshots start with a magic value followed by a random nonce
+// prefix. The payload is split into chunks sealed individually with AES-GCM.
+// The nonce of each chunk consists of the prefix, a chunk counter and a flag
+// marking the final chunk, preventing reordering and truncation.
+const encryptionMagic = "S3OCENC1"
+
+const (
+	encryptionKeySize     = 32
+	encryptionChunkSize   = 64 * 1024
+	encryptionPrefixSize  = 7
+	encryptionCounterSize = 4
+)
+
+var ErrEncrypted = errors.New("state snapshot is encrypted")
+
+// EncryptionKey is an AES-256 key for state snapshots.
+type EncryptionKey struct {
+	aead cipher.AEAD
+}
+
+func NewEncryptionKey(raw []byte) (*EncryptionKey, error) {
+	if len(raw) != encryptionKeySize {
+		return nil, fmt.Errorf("%w: encryption key must be %d bytes, got %d", os.ErrInvalid, encryptionKeySize, len(raw))
+	}
+
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EncryptionKey{aead: aead}, nil
+}
+
+// ParseEncryptionKey decodes a base64-encoded key, e.g. as generated by
+// "openssl rand -base64 32".
+func ParseEncryptionKey(encoded string) (*EncryptionKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("decoding encryption key: %w", err)
+	}
+
+	return NewEncryptionKey(raw)
+}
+
+func ReadEncryptionKeyFile(path string) (*EncryptionKey, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseEncryptionKey(string(content))
+}
+
+func (k *EncryptionKey) nonce(prefix []byte, counter uint32, final bool) []byte {
+	nonce := make([]byte, k.aead.NonceSize())
+
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[encryptionPrefixSize:], counter)
+
+	if final {
+		nonce[encryptionPrefixSize+encryptionCounterSize] = 1
+	}
+
+	return nonce
+}
+
+type encryptWriter struct {
+	key     *EncryptionKey
+	w       io.Writer
+	prefix  []byte
+	counter uint32
+	buf     []byte
+}
+
+// newEncryptWriter returns a writer encrypting all data written to it. The
+// final chunk is only written when the writer is closed.
+func newEncryptWriter(w io.Writer, key *EncryptionKey) (io.WriteCloser, error) {
+	prefix := make([]byte, encryptionPrefixSize)
+
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+
+	if _, err := io.WriteString(w, encryptionMagic); err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(prefix); err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{
+		key:    key,
+		w:      w,
+		prefix: prefix,
+		buf:    make([]byte, 0, encryptionChunkSize),
+	}, nil
+}
+
+func (e *encryptWriter) seal(final bool) error {
+	if e.counter == ^uint32(0) {
+		return errors.New("too many chunks for encryption")
+	}
+
+	out := e.key.aead.Seal(nil, e.key.nonce(e.prefix, e.counter, final), e.buf, nil)
+
+	e.counter++
+	e.buf = e.buf[:0]
+
+	_, err := e.w.Write(out)
+
+	return err
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	var n int
+
+	for len(p) > 0 {
+		if len(e.buf) == encryptionChunkSize {
+			if err := e.seal(false); err != nil {
+				return n, err
+			}
+		}
+
+		count := copy(e.buf[len(e.buf):cap(e.buf)], p)
+
+		e.buf = e.buf[:len(e.buf)+count]
+		p = p[count:]
+		n += count
+	}
+
+	return n, nil
+}
+
+func (e *encryptWriter) Close() error {
+	return e.seal(true)
+}
+
+type decryptReader struct {
+	key     *EncryptionKey
+	r       *bufio.Reader
+	prefix  []byte
+	counter uint32
+	buf     []byte
+	done    bool
+}
+
+// isEncrypted reports whether the reader starts with an encrypted snapshot.
+func isEncrypted(r *bufio.Reader) bool {
+	magic, _ := r.Peek(len(encryptionMagic))
+
+	return bytes.Equal(magic, []byte(encryptionMagic))
+}
+
+func newDecryptReader(r *bufio.Reader, key *EncryptionKey) (io.Reader, error) {
+	header := make([]byte, len(encryptionMagic)+encryptionPrefixSize)
+
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("reading encryption header: %w", err)
+	}
+
+	if !bytes.Equal(header[:len(encryptionMagic)], []byte(encryptionMagic)) {
+		return nil, fmt.Errorf("%w: missing encryption header", os.ErrInvalid)
+	}
+
+	return &decryptReader{
+		key:    key,
+		r:      r,
+		prefix: header[len(encryptionMagic):],
+	}, nil
+}
+
+func (d *decryptReader) next() error {
+	chunk := make([]byte, encryptionChunkSize+d.key.aead.Overhead())
+
+	n, err := io.ReadFull(d.r, chunk)
+
+	switch {
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		d.done = true
+	case err != nil:
+		return err
+	default:
+		// A full chunk is only final if no data follows.
+		if _, err := d.r.Peek(1); errors.Is(err, io.EOF) {
+			d.done = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	plain, err := d.key.aead.Open(chunk[:0], d.key.nonce(d.prefix, d.counter, d.done), chunk[:n], nil)
+	if err != nil {
+		return fmt.Errorf("decrypting chunk %d: %w", d.counter, err)
+	}
+
+	d.counter++
+	d.buf = plain
+
+	return nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, d.buf)
+
+	d.buf = d.buf[n:]
+
+	return n, nil
+}
@@ -0,0 +1,191 @@
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func newEncryptionKeyForTest(t *testing.T) *EncryptionKey {
+	t.Helper()
+
+	key, err := NewEncryptionKey(bytes.Repeat([]byte{0x42}, encryptionKeySize))
+	if err != nil {
+		t.Fatalf("NewEncryptionKey() failed: %v", err)
+	}
+
+	return key
+}
+
+func encryptForTest(t *testing.T, key *EncryptionKey, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	w, err := newEncryptWriter(&buf, key)
+	if err != nil {
+		t.Fatalf("newEncryptWriter() failed: %v", err)
+	}
+
+	if _, err := w.Write(data); err != nil {
+		t.Errorf("Write() failed: %v", err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Errorf("Close() failed: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+func decryptForTest(key *EncryptionKey, data []byte) ([]byte, error) {
+	r, err := newDecryptReader(bufio.NewReader(bytes.NewReader(data)), key)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(r)
+}
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	key := newEncryptionKeyForTest(t)
+
+	for _, size := range []int{0, 1, 1000, encryptionChunkSize - 1, encryptionChunkSize, encryptionChunkSize + 1, 3*encryptionChunkSize + 17} {
+		data := make([]byte, size)
+		rand.Read(data)
+
+		encrypted := encryptForTest(t, key, data)
+
+		if size > 16 && bytes.Contains(encrypted, data[:16]) {
+			t.Errorf("Encrypted data of size %d contains plaintext", size)
+		}
+
+		got, err := decryptForTest(key, encrypted)
+		if err != nil {
+			t.Errorf("Decrypting %d bytes failed: %v", size, err)
+		}
+
+		if !bytes.Equal(data, got) {
+			t.Errorf("Round trip of %d bytes returned different data", size)
+		}
+	}
+}
+
+func TestEncryptionTampering(t *testing.T) {
+	key := newEncryptionKeyForTest(t)
+
+	data := make([]byte, 2*encryptionChunkSize+100)
+	rand.Read(data)
+
+	encrypted := encryptForTest(t, key, data)
+
+	chunk := encryptionChunkSize + key.aead.Overhead()
+	header := len(encryptionMagic) + encryptionPrefixSize
+
+	otherKey, err := NewEncryptionKey(bytes.Repeat([]byte{0x17}, encryptionKeySize))
+	if err != nil {
+		t.Fatalf("NewEncryptionKey() failed: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		key  *EncryptionKey
+		data []byte
+	}{
+		{
+			name: "truncated at chunk boundary",
+			key:  key,
+			data: encrypted[:header+2*chunk],
+		},
+		{
+			name: "truncated within chunk",
+			key:  key,
+			data: encrypted[:header+chunk+100],
+		},
+		{
+			name: "modified",
+			key:  key,
+			data: func() []byte {
+				modified := bytes.Clone(encrypted)
+				modified[header+10] ^= 1
+				return modified
+			}(),
+		},
+		{
+			name: "wrong key",
+			key:  otherKey,
+			data: encrypted,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := decryptForTest(tc.key, tc.data); err == nil {
+				t.Errorf("Decryption succeeded")
+			}
+		})
+	}
+}
+
+func TestParseEncryptionKey(t *testing.T) {
+	valid := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, encryptionKeySize))
+
+	if _, err := ParseEncryptionKey(valid + "\n"); err != nil {
+		t.Errorf("ParseEncryptionKey() failed: %v", err)
+	}
+
+	short := base64.StdEncoding.EncodeToString([]byte("short"))
+
+	if _, err := ParseEncryptionKey(short); !cmp.Equal(os.ErrInvalid, err, cmpopts.EquateErrors()) {
+		t.Errorf("ParseEncryptionKey() returned %v, want %v", err, os.ErrInvalid)
+	}
+
+	if _, err := ParseEncryptionKey("not base64!"); err == nil {
+		t.Errorf("ParseEncryptionKey() succeeded for invalid input")
+	}
+
+	path := filepath.Join(t.TempDir(), "key")
+
+	if err := os.WriteFile(path, []byte(valid), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadEncryptionKeyFile(path); err != nil {
+		t.Errorf("ReadEncryptionKeyFile() failed: %v", err)
+	}
+}
+
+func TestEncryptedCompressionRoundTrip(t *testing.T) {
+	key := newEncryptionKeyForTest(t)
+
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	r, err := s.WriteCompressed(t.TempDir(), key)
+	if err != nil {
+		t.Fatalf("WriteCompressed() failed: %v", err)
+	}
+
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		t.Errorf("ReadAll() failed: %v", err)
+	}
+
+	r.Close()
+
+	if _, err := OpenCompressed(t.TempDir(), bytes.NewReader(buf), nil); !cmp.Equal(ErrEncrypted, err, cmpopts.EquateErrors()) {
+		t.Errorf("OpenCompressed() without key returned %v, want %v", err, ErrEncrypted)
+	}
+
+	if _, err := OpenCompressed(t.TempDir(), bytes.NewReader(buf), key); err != nil {
+		t.Errorf("OpenCompressed() failed: %v", err)
+	}
+}
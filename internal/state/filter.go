@@ -0,0 +1,217 @@
+package state
+
+import (
+	"hash/maphash"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+// VersionFilter is a Bloom filter of object versions. It may report versions
+// as present which were never added, but never the reverse. Safe for
+// concurrent use.
+//
+// Filters built from the state additionally hold the retention and inventory
+// records of the versions at the time, answering lookups for them without
+// reading the database.
+type VersionFilter struct {
+	seed1, seed2 maphash.Seed
+	bits         []atomic.Uint64
+	hashes       int
+
+	// Records loaded from the state. Not modified after construction.
+	versions map[versionDigest]cachedVersion
+}
+
+// versionDigest identifies a version by two independent hashes.
+type versionDigest struct {
+	h1, h2 uint64
+}
+
+const (
+	cachedRetention uint8 = 1 << iota
+	cachedInventory
+	cachedLatest
+)
+
+// cachedVersion holds the fields of the state records of a version needed
+// for annotating it. Times are stored as Unix nanoseconds, with zero for the
+// zero time.
+type cachedVersion struct {
+	retainUntil  int64
+	lastModified int64
+	flags        uint8
+}
+
+func timeToNanos(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.UnixNano()
+}
+
+func nanosToTime(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, n).UTC()
+}
+
+// NewVersionFilter returns a filter sized for the given number of versions
+// with the given false positive rate. Adding more versions is possible, but
+// increases the false positive rate.
+func NewVersionFilter(capacity int, falsePositiveRate float64) *VersionFilter {
+	capacity = max(1, capacity)
+	falsePositiveRate = min(max(falsePositiveRate, 1e-9), 0.5)
+
+	bits := math.Ceil(-float64(capacity) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+
+	return &VersionFilter{
+		seed1:  maphash.MakeSeed(),
+		seed2:  maphash.MakeSeed(),
+		bits:   make([]atomic.Uint64, max(1, int(math.Ceil(bits/64)))),
+		hashes: max(1, int(math.Round(bits/float64(capacity)*math.Ln2))),
+	}
+}
+
+func (f *VersionFilter) digest(key, versionID string) versionDigest {
+	return versionDigest{
+		h1: versionFilterHash(f.seed1, key, versionID),
+		h2: versionFilterHash(f.seed2, key, versionID),
+	}
+}
+
+func versionFilterHash(seed maphash.Seed, key, versionID string) uint64 {
+	var h maphash.Hash
+
+	h.SetSeed(seed)
+	h.WriteString(key)
+	h.WriteByte(0)
+	h.WriteString(versionID)
+
+	return h.Sum64()
+}
+
+// positions invokes a function for each bit of a version using double
+// hashing.
+func (f *VersionFilter) positions(key, versionID string, fn func(word int, mask uint64) bool) {
+	d := f.digest(key, versionID)
+
+	h1 := d.h1
+	h2 := d.h2 | 1
+
+	size := uint64(len(f.bits)) * 64
+
+	for i := range uint64(f.hashes) {
+		pos := (h1 + i*h2) % size
+
+		if !fn(int(pos/64), 1<<(pos%64)) {
+			return
+		}
+	}
+}
+
+// Add records a version in the filter.
+func (f *VersionFilter) Add(key, versionID string) {
+	f.positions(key, versionID, func(word int, mask uint64) bool {
+		f.bits[word].Or(mask)
+		return true
+	})
+}
+
+// MayContain reports whether a version may have been added. False is only
+// returned for versions which were definitely not added.
+func (f *VersionFilter) MayContain(key, versionID string) bool {
+	result := true
+
+	f.positions(key, versionID, func(word int, mask uint64) bool {
+		result = f.bits[word].Load()&mask != 0
+		return result
+	})
+
+	return result
+}
+
+// ObjectRetention returns the retention recorded in the state when the filter
+// was built like [Bucket.GetObjectRetention]. The second return value is false
+// if no record was loaded, e.g. because the version was added afterwards.
+func (f *VersionFilter) ObjectRetention(key, versionID string) (time.Time, bool) {
+	v, ok := f.versions[f.digest(key, versionID)]
+	if !ok || v.flags&cachedRetention == 0 {
+		return time.Time{}, false
+	}
+
+	return nanosToTime(v.retainUntil), true
+}
+
+// InventoryVersion returns the modification time and latest status recorded
+// in the inventory when the filter was built. All other fields are empty. The
+// second return value is false if no record was loaded.
+func (f *VersionFilter) InventoryVersion(key, versionID string) (InventoryVersion, bool) {
+	v, ok := f.versions[f.digest(key, versionID)]
+	if !ok || v.flags&cachedInventory == 0 {
+		return InventoryVersion{}, false
+	}
+
+	return InventoryVersion{
+		Key:          key,
+		VersionID:    versionID,
+		LastModified: nanosToTime(v.lastModified),
+		IsLatest:     v.flags&cachedLatest != 0,
+	}, true
+}
+
+// VersionFilter returns a filter containing all versions with a retention or
+// inventory record in the state, along with the records. Headroom for the
+// given number of additional versions is reserved. The returned count is the
+// number of loaded versions.
+func (b *Bucket) VersionFilter(headroom int, falsePositiveRate float64) (*VersionFilter, int, error) {
+	// The seeds are only known once the filter is sized.
+	loaded := map[objectRetentionRecordKey]cachedVersion{}
+
+	if err := b.db.Bolt().View(func(tx *bolt.Tx) error {
+		bucket := b.get(tx)
+
+		if err := b.db.ForEachInBucket(bucket, &bolthold.Query{}, func(record *objectRetentionRecord) error {
+			v := loaded[record.PK]
+			v.retainUntil = timeToNanos(record.RetainUntil)
+			v.flags |= cachedRetention
+			loaded[record.PK] = v
+
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		return b.db.ForEachInBucket(bucket, &bolthold.Query{}, func(record *inventoryRecord) error {
+			v := loaded[record.PK]
+			v.lastModified = timeToNanos(record.LastModified)
+			v.flags |= cachedInventory
+
+			if record.IsLatest {
+				v.flags |= cachedLatest
+			}
+
+			loaded[record.PK] = v
+
+			return nil
+		})
+	}); err != nil {
+		return nil, 0, err
+	}
+
+	f := NewVersionFilter(len(loaded)+headroom, falsePositiveRate)
+	f.versions = make(map[versionDigest]cachedVersion, len(loaded))
+
+	for pk, v := range loaded {
+		f.Add(pk.Key, pk.VersionID)
+		f.versions[f.digest(pk.Key, pk.VersionID)] = v
+	}
+
+	return f, len(loaded), nil
+}
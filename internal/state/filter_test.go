@@ -0,0 +1,124 @@
+package state
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestVersionFilter(t *testing.T) {
+	const count = 10000
+
+	f := NewVersionFilter(count, 0.01)
+
+	for i := range count {
+		f.Add(fmt.Sprintf("key%d", i), "v1")
+	}
+
+	for i := range count {
+		if key := fmt.Sprintf("key%d", i); !f.MayContain(key, "v1") {
+			t.Fatalf("MayContain(%q) returned false for added version", key)
+		}
+	}
+
+	var falsePositives int
+
+	for i := range count {
+		if f.MayContain(fmt.Sprintf("key%d", i), "v2") {
+			falsePositives++
+		}
+	}
+
+	// Generous margin over the configured rate.
+	if falsePositives > count/20 {
+		t.Errorf("Got %d false positives for %d versions", falsePositives, count)
+	}
+
+}
+
+func TestBucketVersionFilter(t *testing.T) {
+	b := newBucketForTest(t)
+
+	if err := b.SetObjectRetention("retention", "v1", time.Time{}); err != nil {
+		t.Errorf("SetObjectRetention() failed: %v", err)
+	}
+
+	if err := b.PutInventoryVersion(InventoryVersion{Key: "inventory", VersionID: "v1"}, time.Now()); err != nil {
+		t.Errorf("PutInventoryVersion() failed: %v", err)
+	}
+
+	f, count, err := b.VersionFilter(100, 0.001)
+	if err != nil {
+		t.Fatalf("VersionFilter() failed: %v", err)
+	}
+
+	if count != 2 {
+		t.Errorf("VersionFilter() loaded %d versions, want 2", count)
+	}
+
+	for _, key := range []string{"retention", "inventory"} {
+		if !f.MayContain(key, "v1") {
+			t.Errorf("MayContain(%q) returned false", key)
+		}
+	}
+}
+
+func TestBucketVersionFilterRecords(t *testing.T) {
+	b := newBucketForTest(t)
+
+	until := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	modified := time.Date(2020, time.June, 1, 2, 3, 4, 5, time.UTC)
+
+	if err := b.SetObjectRetention("key", "v1", until); err != nil {
+		t.Errorf("SetObjectRetention() failed: %v", err)
+	}
+
+	if err := b.SetObjectRetention("key", "v2", time.Time{}); err != nil {
+		t.Errorf("SetObjectRetention() failed: %v", err)
+	}
+
+	if err := b.PutInventoryVersion(InventoryVersion{
+		Key:          "key",
+		VersionID:    "v1",
+		LastModified: modified,
+		IsLatest:     true,
+	}, time.Now()); err != nil {
+		t.Errorf("PutInventoryVersion() failed: %v", err)
+	}
+
+	f, count, err := b.VersionFilter(100, 0.001)
+	if err != nil {
+		t.Fatalf("VersionFilter() failed: %v", err)
+	}
+
+	if count != 2 {
+		t.Errorf("VersionFilter() loaded %d versions, want 2", count)
+	}
+
+	if got, found := f.ObjectRetention("key", "v1"); !found || !got.Equal(until) {
+		t.Errorf("ObjectRetention(v1) = (%v, %v), want (%v, true)", got, found, until)
+	}
+
+	if got, found := f.ObjectRetention("key", "v2"); !found || !got.IsZero() {
+		t.Errorf("ObjectRetention(v2) = (%v, %v), want zero time", got, found)
+	}
+
+	if _, found := f.ObjectRetention("key", "v3"); found {
+		t.Errorf("ObjectRetention(v3) found unknown version")
+	}
+
+	if got, found := f.InventoryVersion("key", "v1"); !found || !got.LastModified.Equal(modified) || !got.IsLatest {
+		t.Errorf("InventoryVersion(v1) = (%+v, %v), want modification time %v and latest", got, found, modified)
+	}
+
+	if _, found := f.InventoryVersion("key", "v2"); found {
+		t.Errorf("InventoryVersion(v2) found version without inventory record")
+	}
+
+	// Versions added later are only known to the filter.
+	f.Add("key", "v3")
+
+	if _, found := f.ObjectRetention("key", "v3"); found {
+		t.Errorf("ObjectRetention(v3) found added version")
+	}
+}
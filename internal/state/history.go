@@ -0,0 +1,93 @@
+package state
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+// RunStats are the statistics of a single run for a bucket.
+type RunStats struct {
+	StartedAt  time.Time
+	FinishedAt time.Time
+	DryRun     bool
+	Failed     bool
+
+	// Set if the run succeeded and listed all keys, i.e. it wasn't stopped
+	// early, incremental, sharded or limited to specific keys. Runs recorded
+	// by older versions are never complete.
+	Complete bool
+
+	// Statistics counters by name.
+	Counters map[string]int64
+}
+
+type runStatsRecord struct {
+	RunStats
+}
+
+// AppendRunStats adds the statistics of a run to the history. Only the given
+// number of most recent runs are kept. The history isn't limited if keep is
+// zero or negative.
+func (b *Bucket) AppendRunStats(s RunStats, keep int) error {
+	return b.db.Bolt().Update(func(tx *bolt.Tx) error {
+		bucket := b.get(tx)
+
+		if err := b.db.UpsertBucket(bucket, s.StartedAt, runStatsRecord{s}); err != nil {
+			return err
+		}
+
+		if keep <= 0 {
+			return nil
+		}
+
+		var started []time.Time
+
+		if err := b.db.ForEachInBucket(bucket, &bolthold.Query{}, func(record *runStatsRecord) error {
+			started = append(started, record.StartedAt)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		if len(started) <= keep {
+			return nil
+		}
+
+		slices.SortFunc(started, time.Time.Compare)
+
+		for _, t := range started[:len(started)-keep] {
+			if err := b.db.DeleteFromBucket(bucket, t, runStatsRecord{}); err != nil && !errors.Is(err, bolthold.ErrNotFound) {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// RunStatsHistory returns the statistics of recorded runs ordered by their
+// start time.
+func (b *Bucket) RunStatsHistory() ([]RunStats, error) {
+	var result []RunStats
+
+	if err := b.db.Bolt().View(func(tx *bolt.Tx) error {
+		bucket := b.get(tx)
+
+		return b.db.ForEachInBucket(bucket, &bolthold.Query{}, func(record *runStatsRecord) error {
+			result = append(result, record.RunStats)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(result, func(a, b RunStats) int {
+		return a.StartedAt.Compare(b.StartedAt)
+	})
+
+	return result, nil
+}
@@ -0,0 +1,45 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBucketRunStats(t *testing.T) {
+	b := newBucketForTest(t)
+
+	if got, err := b.RunStatsHistory(); err != nil {
+		t.Errorf("RunStatsHistory() failed: %v", err)
+	} else if len(got) != 0 {
+		t.Errorf("RunStatsHistory() = %v, want empty", got)
+	}
+
+	base := time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	var want []RunStats
+
+	for i := range 5 {
+		s := RunStats{
+			StartedAt:  base.Add(time.Duration(i) * 24 * time.Hour),
+			FinishedAt: base.Add(time.Duration(i)*24*time.Hour + time.Minute),
+			DryRun:     i%2 == 0,
+			Counters: map[string]int64{
+				"total.count": int64(100 * i),
+			},
+		}
+
+		if err := b.AppendRunStats(s, 3); err != nil {
+			t.Errorf("AppendRunStats() failed: %v", err)
+		}
+
+		want = append(want, s)
+	}
+
+	if got, err := b.RunStatsHistory(); err != nil {
+		t.Errorf("RunStatsHistory() failed: %v", err)
+	} else if diff := cmp.Diff(want[2:], got); diff != "" {
+		t.Errorf("RunStatsHistory() diff (-want +got):\n%s", diff)
+	}
+}
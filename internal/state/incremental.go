@@ -0,0 +1,124 @@
+package state
+
+import (
+	"errors"
+	"time"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+const lastFullRunKey = "last-full-run:v1"
+
+type lastFullRunRecord struct {
+	StartedAt time.Time
+}
+
+// GetLastFullRun returns the start time of the last successful run which
+// evaluated all keys of the bucket. The zero time is returned if there was no
+// such run.
+func (b *Bucket) GetLastFullRun() (time.Time, error) {
+	var record lastFullRunRecord
+
+	if err := b.db.Bolt().View(func(tx *bolt.Tx) error {
+		bucket := b.get(tx)
+
+		if err := b.db.GetFromBucket(bucket, lastFullRunKey, &record); err != nil && !errors.Is(err, bolthold.ErrNotFound) {
+			return err
+		}
+
+		return nil
+	}); err != nil {
+		return time.Time{}, err
+	}
+
+	return record.StartedAt, nil
+}
+
+func (b *Bucket) SetLastFullRun(startedAt time.Time) error {
+	return b.db.Bolt().Update(func(tx *bolt.Tx) error {
+		bucket := b.get(tx)
+
+		return b.db.UpsertBucket(bucket, lastFullRunKey, lastFullRunRecord{
+			StartedAt: startedAt,
+		})
+	})
+}
+
+type keyDueRecord struct {
+	Key    string
+	DueAt  time.Time
+	SeenAt time.Time
+}
+
+// GetKeyDue returns the time from which the versions of a key need to be
+// evaluated again. The second return value is false if the key isn't known.
+func (b *Bucket) GetKeyDue(key string) (time.Time, bool, error) {
+	var record keyDueRecord
+	var found bool
+
+	if err := b.db.Bolt().View(func(tx *bolt.Tx) error {
+		bucket := b.get(tx)
+
+		if err := b.db.GetFromBucket(bucket, key, &record); err != nil {
+			if errors.Is(err, bolthold.ErrNotFound) {
+				return nil
+			}
+
+			return err
+		}
+
+		found = true
+
+		return nil
+	}); err != nil {
+		return time.Time{}, false, err
+	}
+
+	return record.DueAt, found, nil
+}
+
+// SetKeyDue records when the versions of a key need to be evaluated again. A
+// zero due time requires evaluation on every run.
+func (b *Bucket) SetKeyDue(key string, dueAt, seenAt time.Time) error {
+	record := keyDueRecord{
+		Key:    key,
+		DueAt:  dueAt,
+		SeenAt: seenAt,
+	}
+
+	return b.db.Bolt().Update(func(tx *bolt.Tx) error {
+		bucket := b.get(tx)
+
+		return b.db.UpsertBucket(bucket, key, record)
+	})
+}
+
+// PruneKeyDue removes the due times of keys last seen before the given time
+// and returns their number.
+func (b *Bucket) PruneKeyDue(seenBefore time.Time) (int, error) {
+	var gone []string
+
+	if err := b.db.Bolt().Update(func(tx *bolt.Tx) error {
+		bucket := b.get(tx)
+
+		if err := b.db.ForEachInBucket(bucket, bolthold.Where("SeenAt").Lt(seenBefore), func(record *keyDueRecord) error {
+			gone = append(gone, record.Key)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, key := range gone {
+			if err := b.db.DeleteFromBucket(bucket, key, keyDueRecord{}); err != nil && !errors.Is(err, bolthold.ErrNotFound) {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	return len(gone), nil
+}
@@ -0,0 +1,73 @@
+package state
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketLastFullRun(t *testing.T) {
+	b := newBucketForTest(t)
+
+	if got, err := b.GetLastFullRun(); err != nil {
+		t.Errorf("GetLastFullRun() failed: %v", err)
+	} else if !got.IsZero() {
+		t.Errorf("GetLastFullRun() = %v, want zero", got)
+	}
+
+	want := time.Date(2001, time.February, 3, 4, 5, 6, 0, time.UTC)
+
+	if err := b.SetLastFullRun(want); err != nil {
+		t.Errorf("SetLastFullRun() failed: %v", err)
+	}
+
+	if got, err := b.GetLastFullRun(); err != nil {
+		t.Errorf("GetLastFullRun() failed: %v", err)
+	} else if !got.Equal(want) {
+		t.Errorf("GetLastFullRun() = %v, want %v", got, want)
+	}
+}
+
+func TestBucketKeyDue(t *testing.T) {
+	b := newBucketForTest(t)
+
+	base := time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	if _, found, err := b.GetKeyDue("a"); err != nil {
+		t.Errorf("GetKeyDue() failed: %v", err)
+	} else if found {
+		t.Errorf("GetKeyDue() found unknown key")
+	}
+
+	for _, key := range []string{"a", "b"} {
+		if err := b.SetKeyDue(key, base.Add(time.Hour), base); err != nil {
+			t.Errorf("SetKeyDue(%q) failed: %v", key, err)
+		}
+	}
+
+	// Refresh a key.
+	if err := b.SetKeyDue("b", time.Time{}, base.Add(time.Minute)); err != nil {
+		t.Errorf("SetKeyDue() failed: %v", err)
+	}
+
+	if got, found, err := b.GetKeyDue("a"); err != nil {
+		t.Errorf("GetKeyDue() failed: %v", err)
+	} else if !found || !got.Equal(base.Add(time.Hour)) {
+		t.Errorf("GetKeyDue() = (%v, %v), want (%v, true)", got, found, base.Add(time.Hour))
+	}
+
+	if count, err := b.PruneKeyDue(base.Add(time.Second)); err != nil {
+		t.Errorf("PruneKeyDue() failed: %v", err)
+	} else if count != 1 {
+		t.Errorf("PruneKeyDue() removed %d records, want 1", count)
+	}
+
+	if _, found, err := b.GetKeyDue("a"); err != nil || found {
+		t.Errorf("GetKeyDue() after pruning = (%v, %v), want not found", found, err)
+	}
+
+	if got, found, err := b.GetKeyDue("b"); err != nil {
+		t.Errorf("GetKeyDue() failed: %v", err)
+	} else if !found || !got.IsZero() {
+		t.Errorf("GetKeyDue() = (%v, %v), want (zero, true)", got, found)
+	}
+}
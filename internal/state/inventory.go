@@ -0,0 +1,132 @@
+package state
+
+import (
+	"errors"
+	"time"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+// InventoryVersion describes an object version as listed during a previous
+// run.
+type InventoryVersion struct {
+	Key          string
+	VersionID    string
+	LastModified time.Time
+	Size         int64
+	DeleteMarker bool
+	IsLatest     bool
+
+	// Retention as determined during the run. Zero if the version had no
+	// retention.
+	RetainUntil time.Time
+}
+
+type inventoryRecord struct {
+	PK           objectRetentionRecordKey
+	LastModified time.Time
+	Size         int64
+	DeleteMarker bool
+	IsLatest     bool
+	RetainUntil  time.Time
+	SeenAt       time.Time
+}
+
+// GetInventoryVersion looks up a version in the inventory. The second return
+// value is false if the version isn't known.
+func (b *Bucket) GetInventoryVersion(key, versionID string) (InventoryVersion, bool, error) {
+	pk := objectRetentionRecordKey{
+		Key:       key,
+		VersionID: versionID,
+	}
+
+	var record inventoryRecord
+	var found bool
+
+	if err := b.db.Bolt().View(func(tx *bolt.Tx) error {
+		bucket := b.get(tx)
+
+		if err := b.db.GetFromBucket(bucket, pk, &record); err != nil {
+			if errors.Is(err, bolthold.ErrNotFound) {
+				return nil
+			}
+
+			return err
+		}
+
+		found = true
+
+		return nil
+	}); err != nil || !found {
+		return InventoryVersion{}, false, err
+	}
+
+	return InventoryVersion{
+		Key:          record.PK.Key,
+		VersionID:    record.PK.VersionID,
+		LastModified: record.LastModified,
+		Size:         record.Size,
+		DeleteMarker: record.DeleteMarker,
+		IsLatest:     record.IsLatest,
+		RetainUntil:  record.RetainUntil,
+	}, true, nil
+}
+
+// PutInventoryVersion records a version as seen at the given time.
+func (b *Bucket) PutInventoryVersion(v InventoryVersion, seenAt time.Time) error {
+	record := inventoryRecord{
+		PK: objectRetentionRecordKey{
+			Key:       v.Key,
+			VersionID: v.VersionID,
+		},
+		LastModified: v.LastModified,
+		Size:         v.Size,
+		DeleteMarker: v.DeleteMarker,
+		IsLatest:     v.IsLatest,
+		RetainUntil:  v.RetainUntil,
+		SeenAt:       seenAt,
+	}
+
+	return b.db.Bolt().Update(func(tx *bolt.Tx) error {
+		bucket := b.get(tx)
+
+		return b.db.UpsertBucket(bucket, record.PK, record)
+	})
+}
+
+// PruneInventory removes all versions last seen before the given time,
+// together with their retention and deletion schedule records, and returns
+// their number.
+func (b *Bucket) PruneInventory(seenBefore time.Time) (int, error) {
+	var gone []objectRetentionRecordKey
+
+	if err := b.db.Bolt().Update(func(tx *bolt.Tx) error {
+		bucket := b.get(tx)
+
+		if err := b.db.ForEachInBucket(bucket, bolthold.Where("SeenAt").Lt(seenBefore), func(record *inventoryRecord) error {
+			gone = append(gone, record.PK)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, pk := range gone {
+			for _, dataType := range []any{
+				inventoryRecord{},
+				objectRetentionRecord{},
+				deletionScheduleRecord{},
+			} {
+				if err := b.db.DeleteFromBucket(bucket, pk, dataType); err != nil && !errors.Is(err, bolthold.ErrNotFound) {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	return len(gone), nil
+}
@@ -0,0 +1,79 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBucketInventory(t *testing.T) {
+	b := newBucketForTest(t)
+
+	if _, found, err := b.GetInventoryVersion("key", "v1"); err != nil {
+		t.Errorf("GetInventoryVersion() failed: %v", err)
+	} else if found {
+		t.Errorf("GetInventoryVersion() found version in empty inventory")
+	}
+
+	first := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	second := first.Add(24 * time.Hour)
+
+	want := InventoryVersion{
+		Key:          "key",
+		VersionID:    "v1",
+		LastModified: time.Date(2019, time.June, 1, 0, 0, 0, 0, time.UTC),
+		Size:         123,
+		RetainUntil:  time.Date(2021, time.June, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	for _, v := range []InventoryVersion{
+		want,
+		{Key: "key", VersionID: "v0", DeleteMarker: true},
+	} {
+		if err := b.PutInventoryVersion(v, first); err != nil {
+			t.Errorf("PutInventoryVersion() failed: %v", err)
+		}
+	}
+
+	if got, found, err := b.GetInventoryVersion("key", "v1"); err != nil {
+		t.Errorf("GetInventoryVersion() failed: %v", err)
+	} else if !found {
+		t.Errorf("GetInventoryVersion() didn't find version")
+	} else if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("GetInventoryVersion() diff (-want +got):\n%s", diff)
+	}
+
+	if err := b.SetObjectRetention("key", "v0", time.Now()); err != nil {
+		t.Errorf("SetObjectRetention() failed: %v", err)
+	}
+
+	// Seen again in a later run.
+	if err := b.PutInventoryVersion(want, second); err != nil {
+		t.Errorf("PutInventoryVersion() failed: %v", err)
+	}
+
+	if count, err := b.PruneInventory(second); err != nil {
+		t.Errorf("PruneInventory() failed: %v", err)
+	} else if count != 1 {
+		t.Errorf("PruneInventory() removed %d versions, want 1", count)
+	}
+
+	if _, found, err := b.GetInventoryVersion("key", "v0"); err != nil {
+		t.Errorf("GetInventoryVersion() failed: %v", err)
+	} else if found {
+		t.Errorf("GetInventoryVersion() found pruned version")
+	}
+
+	if got, found, err := b.GetObjectRetention("key", "v0"); err != nil {
+		t.Errorf("GetObjectRetention() failed: %v", err)
+	} else if found {
+		t.Errorf("GetObjectRetention() returned %v for pruned version", got)
+	}
+
+	if _, found, err := b.GetInventoryVersion("key", "v1"); err != nil {
+		t.Errorf("GetInventoryVersion() failed: %v", err)
+	} else if !found {
+		t.Errorf("GetInventoryVersion() didn't find version seen in later run")
+	}
+}
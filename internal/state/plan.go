@@ -0,0 +1,80 @@
+package state
+
+import (
+	"errors"
+	"time"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+const reviewedPlanKey = "reviewed-plan:v1"
+
+// ReviewedPlan is the set of deletions planned by a dry run. Runs making
+// changes compare their deletions against it.
+type ReviewedPlan struct {
+	// Digest of the whole set.
+	Digest string
+
+	// Hashes of the planned deletions.
+	Deletions []uint64
+
+	// State of the planned versions by deletion hash, verified again before
+	// they're deleted. Missing in plans recorded by older releases.
+	Versions map[uint64]ReviewedVersion
+
+	CreatedAt time.Time
+}
+
+// ReviewedVersion is the state of a version when its deletion was planned.
+type ReviewedVersion struct {
+	LastModified time.Time
+	RetainUntil  time.Time
+}
+
+// GetReviewedPlan returns the plan recorded by a previous dry run. The second
+// return value is false if no plan is stored.
+func (b *Bucket) GetReviewedPlan() (ReviewedPlan, bool, error) {
+	var record ReviewedPlan
+	var found bool
+
+	if err := b.db.Bolt().View(func(tx *bolt.Tx) error {
+		bucket := b.get(tx)
+
+		if err := b.db.GetFromBucket(bucket, reviewedPlanKey, &record); err != nil {
+			if errors.Is(err, bolthold.ErrNotFound) {
+				return nil
+			}
+
+			return err
+		}
+
+		found = true
+
+		return nil
+	}); err != nil {
+		return ReviewedPlan{}, false, err
+	}
+
+	return record, found, nil
+}
+
+func (b *Bucket) SetReviewedPlan(p ReviewedPlan) error {
+	return b.db.Bolt().Update(func(tx *bolt.Tx) error {
+		bucket := b.get(tx)
+
+		return b.db.UpsertBucket(bucket, reviewedPlanKey, p)
+	})
+}
+
+func (b *Bucket) DeleteReviewedPlan() error {
+	return b.db.Bolt().Update(func(tx *bolt.Tx) error {
+		bucket := b.get(tx)
+
+		if err := b.db.DeleteFromBucket(bucket, reviewedPlanKey, ReviewedPlan{}); err != nil && !errors.Is(err, bolthold.ErrNotFound) {
+			return err
+		}
+
+		return nil
+	})
+}
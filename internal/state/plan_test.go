@@ -0,0 +1,53 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBucketReviewedPlan(t *testing.T) {
+	b := newBucketForTest(t)
+
+	if _, found, err := b.GetReviewedPlan(); err != nil {
+		t.Errorf("GetReviewedPlan() failed: %v", err)
+	} else if found {
+		t.Errorf("GetReviewedPlan() found plan in empty state")
+	}
+
+	want := ReviewedPlan{
+		Digest:    "digest",
+		Deletions: []uint64{1, 2, 3},
+		Versions: map[uint64]ReviewedVersion{
+			1: {LastModified: time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)},
+			2: {
+				LastModified: time.Date(2000, time.January, 2, 0, 0, 0, 0, time.UTC),
+				RetainUntil:  time.Date(2000, time.February, 2, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		CreatedAt: time.Date(2001, time.February, 3, 4, 5, 6, 0, time.UTC),
+	}
+
+	if err := b.SetReviewedPlan(want); err != nil {
+		t.Errorf("SetReviewedPlan() failed: %v", err)
+	}
+
+	if got, found, err := b.GetReviewedPlan(); err != nil {
+		t.Errorf("GetReviewedPlan() failed: %v", err)
+	} else if !found {
+		t.Errorf("GetReviewedPlan() didn't find plan")
+	} else if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("GetReviewedPlan() diff (-want +got):\n%s", diff)
+	}
+
+	if err := b.DeleteReviewedPlan(); err != nil {
+		t.Errorf("DeleteReviewedPlan() failed: %v", err)
+	}
+
+	if _, found, err := b.GetReviewedPlan(); err != nil {
+		t.Errorf("GetReviewedPlan() failed: %v", err)
+	} else if found {
+		t.Errorf("GetReviewedPlan() found deleted plan")
+	}
+}
@@ -0,0 +1,116 @@
+package state
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// schemaBucketName is a top-level bucket holding database-wide metadata. S3
+// bucket names can't contain underscores, so it can't collide with per-bucket
+// data.
+var schemaBucketName = []byte("_schema")
+
+var schemaVersionKey = []byte("version")
+
+var ErrSchemaTooNew = errors.New("state schema is newer than supported")
+
+type migration struct {
+	// Schema version after applying the migration.
+	version int
+
+	description string
+
+	apply func(*bolt.Tx) error
+}
+
+// migrations upgrade databases written by older releases. They must be sorted
+// by version and numbered consecutively. Databases without a version record
+// have version zero.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "record schema version",
+		apply:       func(*bolt.Tx) error { return nil },
+	},
+}
+
+func latestSchemaVersion(migrations []migration) int {
+	if len(migrations) == 0 {
+		return 0
+	}
+
+	return migrations[len(migrations)-1].version
+}
+
+func readSchemaVersion(tx *bolt.Tx) (int, error) {
+	bucket := tx.Bucket(schemaBucketName)
+	if bucket == nil {
+		return 0, nil
+	}
+
+	value := bucket.Get(schemaVersionKey)
+	if value == nil {
+		return 0, nil
+	}
+
+	if len(value) != 8 {
+		return 0, fmt.Errorf("invalid schema version record of %d bytes", len(value))
+	}
+
+	return int(binary.BigEndian.Uint64(value)), nil
+}
+
+func writeSchemaVersion(tx *bolt.Tx, version int) error {
+	bucket, err := tx.CreateBucketIfNotExists(schemaBucketName)
+	if err != nil {
+		return err
+	}
+
+	return bucket.Put(schemaVersionKey, binary.BigEndian.AppendUint64(nil, uint64(version)))
+}
+
+// migrate applies all migrations newer than the schema version of the
+// database within a single transaction. The versions before and after
+// migrating are returned.
+func migrate(db *bolt.DB, migrations []migration) (from, to int, err error) {
+	latest := latestSchemaVersion(migrations)
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if from, err = readSchemaVersion(tx); err != nil {
+			return err
+		}
+
+		if from > latest {
+			return fmt.Errorf("%w: version %d, supported up to %d", ErrSchemaTooNew, from, latest)
+		}
+
+		to = from
+
+		for _, m := range migrations {
+			if m.version <= from {
+				continue
+			}
+
+			if m.version != to+1 {
+				return fmt.Errorf("migration to version %d follows version %d", m.version, to)
+			}
+
+			if err := m.apply(tx); err != nil {
+				return fmt.Errorf("migration to version %d (%s): %w", m.version, m.description, err)
+			}
+
+			to = m.version
+		}
+
+		if to == from && tx.Bucket(schemaBucketName) != nil {
+			return nil
+		}
+
+		return writeSchemaVersion(tx, to)
+	})
+
+	return from, to, err
+}
@@ -0,0 +1,161 @@
+package state
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	bolt "go.etcd.io/bbolt"
+)
+
+func openBoltForTest(t *testing.T) *bolt.DB {
+	t.Helper()
+
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "db"), 0o600, nil)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	return db
+}
+
+func TestMigrate(t *testing.T) {
+	errTest := errors.New("test error")
+
+	var applied []int
+
+	record := func(version int) migration {
+		return migration{
+			version: version,
+			apply: func(*bolt.Tx) error {
+				applied = append(applied, version)
+				return nil
+			},
+		}
+	}
+
+	for _, tc := range []struct {
+		name        string
+		initial     int
+		migrations  []migration
+		wantFrom    int
+		wantTo      int
+		wantApplied []int
+		wantErr     error
+	}{
+		{
+			name:        "fresh",
+			initial:     -1,
+			migrations:  []migration{record(1), record(2)},
+			wantTo:      2,
+			wantApplied: []int{1, 2},
+		},
+		{
+			name:        "partial",
+			initial:     1,
+			migrations:  []migration{record(1), record(2), record(3)},
+			wantFrom:    1,
+			wantTo:      3,
+			wantApplied: []int{2, 3},
+		},
+		{
+			name:       "current",
+			initial:    2,
+			migrations: []migration{record(1), record(2)},
+			wantFrom:   2,
+			wantTo:     2,
+		},
+		{
+			name:       "too new",
+			initial:    3,
+			migrations: []migration{record(1), record(2)},
+			wantFrom:   3,
+			wantErr:    ErrSchemaTooNew,
+		},
+		{
+			name:    "failure",
+			initial: -1,
+			migrations: []migration{record(1), {
+				version: 2,
+				apply:   func(*bolt.Tx) error { return errTest },
+			}},
+			wantTo:      1,
+			wantApplied: []int{1},
+			wantErr:     errTest,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			applied = nil
+
+			db := openBoltForTest(t)
+
+			if tc.initial >= 0 {
+				if err := db.Update(func(tx *bolt.Tx) error {
+					return writeSchemaVersion(tx, tc.initial)
+				}); err != nil {
+					t.Fatalf("writeSchemaVersion() failed: %v", err)
+				}
+			}
+
+			from, to, err := migrate(db, tc.migrations)
+
+			if diff := cmp.Diff(tc.wantErr, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("Error diff (-want +got):\n%s", diff)
+			}
+
+			if from != tc.wantFrom || to != tc.wantTo {
+				t.Errorf("migrate() = (%d, %d), want (%d, %d)", from, to, tc.wantFrom, tc.wantTo)
+			}
+
+			if diff := cmp.Diff(tc.wantApplied, applied); diff != "" {
+				t.Errorf("Applied migrations diff (-want +got):\n%s", diff)
+			}
+
+			var got int
+
+			if err := db.View(func(tx *bolt.Tx) (err error) {
+				got, err = readSchemaVersion(tx)
+				return err
+			}); err != nil {
+				t.Errorf("readSchemaVersion() failed: %v", err)
+			}
+
+			want := tc.wantTo
+
+			if err != nil {
+				// Failed migrations are rolled back.
+				want = max(0, tc.initial)
+			}
+
+			if got != want {
+				t.Errorf("Stored schema version is %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestOpenRecordsSchemaVersion(t *testing.T) {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	var got int
+
+	if err := s.db.Bolt().View(func(tx *bolt.Tx) (err error) {
+		got, err = readSchemaVersion(tx)
+		return err
+	}); err != nil {
+		t.Errorf("readSchemaVersion() failed: %v", err)
+	}
+
+	if want := latestSchemaVersion(migrations); got != want {
+		t.Errorf("Schema version is %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,157 @@
+package state
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/timshannon/bolthold"
+	bolt "go.etcd.io/bbolt"
+)
+
+// DataSize returns the total size of all keys and values in the database.
+// Unlike the database file it excludes free space and page overhead.
+func (s *Store) DataSize() (int64, error) {
+	var size int64
+
+	err := s.db.Bolt().View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			size += int64(len(name)) + boltBucketDataSize(b)
+			return nil
+		})
+	})
+
+	return size, err
+}
+
+// RecordCount returns the number of key/value pairs in the database.
+func (s *Store) RecordCount() (int64, error) {
+	var count int64
+
+	err := s.db.Bolt().View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(_ []byte, b *bolt.Bucket) error {
+			count += boltBucketRecordCount(b)
+			return nil
+		})
+	})
+
+	return count, err
+}
+
+func boltBucketRecordCount(b *bolt.Bucket) int64 {
+	var count int64
+
+	b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			count += boltBucketRecordCount(b.Bucket(k))
+		} else {
+			count++
+		}
+
+		return nil
+	})
+
+	return count
+}
+
+func boltBucketDataSize(b *bolt.Bucket) int64 {
+	var size int64
+
+	b.ForEach(func(k, v []byte) error {
+		size += int64(len(k) + len(v))
+
+		if v == nil {
+			size += boltBucketDataSize(b.Bucket(k))
+		}
+
+		return nil
+	})
+
+	return size
+}
+
+// PruneSummary describes the records removed by pruning.
+type PruneSummary struct {
+	Count int
+
+	// Size of the removed keys and values.
+	Size int64
+
+	// Range of modification times of the removed records.
+	OldestMTime time.Time
+	NewestMTime time.Time
+}
+
+// PruneObjectRetentionBySize removes retention records, starting with the
+// least recently modified, until the removed records account for at least the
+// given amount of data.
+func (b *Bucket) PruneObjectRetentionBySize(size int64) (PruneSummary, error) {
+	type candidate struct {
+		pk    objectRetentionRecordKey
+		mtime time.Time
+		size  int64
+	}
+
+	var summary PruneSummary
+
+	if size <= 0 {
+		return summary, nil
+	}
+
+	err := b.db.Bolt().Update(func(tx *bolt.Tx) error {
+		bucket := b.get(tx)
+
+		var candidates []candidate
+
+		if err := b.db.ForEachInBucket(bucket, &bolthold.Query{}, func(record *objectRetentionRecord) error {
+			key, err := json.Marshal(record.PK)
+			if err != nil {
+				return err
+			}
+
+			value, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+
+			candidates = append(candidates, candidate{
+				pk:    record.PK,
+				mtime: record.MTime,
+				size:  int64(len(key) + len(value)),
+			})
+
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		slices.SortStableFunc(candidates, func(a, b candidate) int {
+			return a.mtime.Compare(b.mtime)
+		})
+
+		for _, c := range candidates {
+			if summary.Size >= size {
+				break
+			}
+
+			if err := b.db.DeleteFromBucket(bucket, c.pk, objectRetentionRecord{}); err != nil {
+				return err
+			}
+
+			if summary.Count == 0 {
+				summary.OldestMTime = c.mtime
+			}
+
+			summary.Count++
+			summary.Size += c.size
+			summary.NewestMTime = c.mtime
+		}
+
+		return nil
+	})
+	if err != nil {
+		return PruneSummary{}, err
+	}
+
+	return summary, nil
+}
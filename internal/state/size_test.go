@@ -0,0 +1,94 @@
+package state
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestPruneObjectRetentionBySize(t *testing.T) {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	b, err := s.Bucket("test")
+	if err != nil {
+		t.Fatalf("Bucket() failed: %v", err)
+	}
+
+	base := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	// Insert records in reverse order of their modification time.
+	for i := range 10 {
+		record := objectRetentionRecord{
+			PK: objectRetentionRecordKey{
+				Key:       fmt.Sprintf("key%02d", i),
+				VersionID: "v",
+			},
+			MTime:       base.Add(time.Duration(10-i) * time.Hour),
+			RetainUntil: base.Add(1000 * time.Hour),
+		}
+
+		if err := s.db.Bolt().Update(func(tx *bolt.Tx) error {
+			return s.db.UpsertBucket(b.get(tx), record.PK, record)
+		}); err != nil {
+			t.Fatalf("UpsertBucket() failed: %v", err)
+		}
+	}
+
+	if got, err := s.RecordCount(); err != nil {
+		t.Errorf("RecordCount() failed: %v", err)
+	} else if want := int64(12); got != want {
+		// Retention records plus bucket metadata and schema version.
+		t.Errorf("RecordCount() = %d, want %d", got, want)
+	}
+
+	before, err := s.DataSize()
+	if err != nil {
+		t.Fatalf("DataSize() failed: %v", err)
+	}
+
+	summary, err := b.PruneObjectRetentionBySize(1)
+	if err != nil {
+		t.Errorf("PruneObjectRetentionBySize() failed: %v", err)
+	}
+
+	if diff := cmp.Diff(PruneSummary{
+		Count:       1,
+		Size:        summary.Size,
+		OldestMTime: base.Add(time.Hour),
+		NewestMTime: base.Add(time.Hour),
+	}, summary); diff != "" {
+		t.Errorf("PruneObjectRetentionBySize() diff (-want +got):\n%s", diff)
+	}
+
+	if _, found, err := b.GetObjectRetention("key09", "v"); err != nil {
+		t.Errorf("GetObjectRetention() failed: %v", err)
+	} else if found {
+		t.Errorf("Oldest record wasn't removed")
+	}
+
+	if got, _, err := b.GetObjectRetention("key08", "v"); err != nil {
+		t.Errorf("GetObjectRetention() failed: %v", err)
+	} else if got.IsZero() {
+		t.Errorf("Second oldest record was removed")
+	}
+
+	if after, err := s.DataSize(); err != nil {
+		t.Errorf("DataSize() failed: %v", err)
+	} else if after != before-summary.Size {
+		t.Errorf("DataSize() = %d after pruning, want %d", after, before-summary.Size)
+	}
+
+	if summary, err := b.PruneObjectRetentionBySize(before); err != nil {
+		t.Errorf("PruneObjectRetentionBySize() failed: %v", err)
+	} else if summary.Count != 9 {
+		t.Errorf("PruneObjectRetentionBySize() removed %d records, want 9", summary.Count)
+	} else if want := base.Add(10 * time.Hour); !summary.NewestMTime.Equal(want) {
+		t.Errorf("Newest removed record was modified at %v, want %v", summary.NewestMTime, want)
+	}
+}
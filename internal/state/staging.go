@@ -0,0 +1,137 @@
+package state
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var stagingBucketName = []byte("staging")
+
+// Staging is a temporary on-disk store for values grouped by key. It isn't
+// part of the persisted state.
+type Staging struct {
+	db  *bolt.DB
+	seq uint64
+}
+
+// NewStaging creates an empty staging database in the given directory.
+func NewStaging(tmpdir string) (*Staging, error) {
+	f, err := os.CreateTemp(tmpdir, "staging*")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(f.Name(), 0o600, &bolt.Options{
+		// Data is ephemeral anyway
+		NoSync:         true,
+		NoFreelistSync: true,
+	})
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("opening staging database: %w", err), os.Remove(f.Name()))
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucket(stagingBucketName)
+		return err
+	}); err != nil {
+		return nil, errors.Join(err, db.Close(), os.Remove(f.Name()))
+	}
+
+	return &Staging{db: db}, nil
+}
+
+// Close closes the database and removes its file.
+func (s *Staging) Close() error {
+	path := s.db.Path()
+
+	return errors.Join(s.db.Close(), os.Remove(path))
+}
+
+// stagingPrefix returns the prefix shared by all entries of a key. The length
+// is included so that no key's prefix is a prefix of another key's.
+func stagingPrefix(key string) []byte {
+	buf := binary.AppendUvarint(nil, uint64(len(key)))
+
+	return append(buf, key...)
+}
+
+// Append adds a value to a key.
+func (s *Staging) Append(key string, value []byte) error {
+	s.seq++
+
+	k := binary.BigEndian.AppendUint64(stagingPrefix(key), s.seq)
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(stagingBucketName).Put(k, value)
+	})
+}
+
+// Take removes and returns all values of a key in the order they were
+// appended.
+func (s *Staging) Take(key string) ([][]byte, error) {
+	prefix := stagingPrefix(key)
+
+	var values [][]byte
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(stagingBucketName).Cursor()
+
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Seek(prefix) {
+			values = append(values, bytes.Clone(v))
+
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return values, err
+}
+
+// ForEach invokes a function with the values of every key. Keys are visited in
+// no particular order.
+func (s *Staging) ForEach(fn func(key string, values [][]byte) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(stagingBucketName).Cursor()
+
+		var current string
+		var values [][]byte
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			length, n := binary.Uvarint(k)
+			if n <= 0 || uint64(len(k)-n) < length {
+				return fmt.Errorf("invalid staging key %q", k)
+			}
+
+			key := string(k[n : n+int(length)])
+
+			if len(values) > 0 && key != current {
+				if err := fn(current, values); err != nil {
+					return err
+				}
+
+				values = nil
+			}
+
+			current = key
+			values = append(values, bytes.Clone(v))
+		}
+
+		if len(values) > 0 {
+			return fn(current, values)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,79 @@
+package state
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStaging(t *testing.T) {
+	tmpdir := t.TempDir()
+
+	s, err := NewStaging(tmpdir)
+	if err != nil {
+		t.Fatalf("NewStaging() failed: %v", err)
+	}
+
+	for _, i := range []struct{ key, value string }{
+		{"a", "a1"},
+		{"ab", "ab1"},
+		{"a", "a2"},
+		{"", "empty"},
+		{"b", "b1"},
+		{"a", "a3"},
+	} {
+		if err := s.Append(i.key, []byte(i.value)); err != nil {
+			t.Errorf("Append(%q) failed: %v", i.key, err)
+		}
+	}
+
+	toStrings := func(values [][]byte) []string {
+		var result []string
+
+		for _, v := range values {
+			result = append(result, string(v))
+		}
+
+		return result
+	}
+
+	if got, err := s.Take("a"); err != nil {
+		t.Errorf("Take() failed: %v", err)
+	} else if diff := cmp.Diff([]string{"a1", "a2", "a3"}, toStrings(got)); diff != "" {
+		t.Errorf("Take() diff (-want +got):\n%s", diff)
+	}
+
+	if got, err := s.Take("a"); err != nil {
+		t.Errorf("Take() failed: %v", err)
+	} else if len(got) != 0 {
+		t.Errorf("Take() returned %q for taken key", got)
+	}
+
+	remaining := map[string][]string{}
+
+	if err := s.ForEach(func(key string, values [][]byte) error {
+		remaining[key] = toStrings(values)
+		return nil
+	}); err != nil {
+		t.Errorf("ForEach() failed: %v", err)
+	}
+
+	if diff := cmp.Diff(map[string][]string{
+		"":   {"empty"},
+		"ab": {"ab1"},
+		"b":  {"b1"},
+	}, remaining); diff != "" {
+		t.Errorf("ForEach() diff (-want +got):\n%s", diff)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Errorf("Close() failed: %v", err)
+	}
+
+	if entries, err := os.ReadDir(tmpdir); err != nil {
+		t.Errorf("ReadDir() failed: %v", err)
+	} else if len(entries) != 0 {
+		t.Errorf("Files remain after closing: %v", entries)
+	}
+}
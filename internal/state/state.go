@@ -2,6 +2,7 @@ package state
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -10,6 +11,14 @@ import (
 	bolt "go.etcd.io/bbolt"
 )
 
+// compactionThreshold is the fraction of free pages above which snapshots are
+// written from a compacted copy of the database.
+const compactionThreshold = 0.25
+
+// compactionTxMaxSize limits the size of the transactions used for copying
+// data during compaction.
+const compactionTxMaxSize = 64 * 1024 * 1024
+
 type Store struct {
 	db *bolthold.Store
 }
@@ -43,6 +52,10 @@ func Open(path string) (*Store, error) {
 		return nil, fmt.Errorf("opening state %q: %w", path, err)
 	}
 
+	if _, _, err := migrate(db.Bolt(), migrations); err != nil {
+		return nil, errors.Join(fmt.Errorf("state schema: %w", err), db.Close())
+	}
+
 	if err := db.ReIndex(&objectRetentionRecord{}, nil); err != nil {
 		return nil, fmt.Errorf("store indexing: %w", err)
 	}
@@ -56,6 +69,13 @@ func (s *Store) Close() error {
 	return s.db.Close()
 }
 
+// Discard closes the database and removes its file.
+func (s *Store) Discard() error {
+	path := s.db.Bolt().Path()
+
+	return errors.Join(s.db.Close(), os.Remove(path))
+}
+
 // WriteTo writes the entire database to a writer.
 func (s *Store) WriteTo(w io.Writer) (int64, error) {
 	var n int64
@@ -69,3 +89,115 @@ func (s *Store) WriteTo(w io.Writer) (int64, error) {
 
 	return n, err
 }
+
+// freeFraction returns the fraction of the database file consisting of free
+// pages, e.g. after records have been deleted.
+func (s *Store) freeFraction() (float64, error) {
+	bdb := s.db.Bolt()
+	stats := bdb.Stats()
+
+	var size int64
+
+	if err := bdb.View(func(tx *bolt.Tx) error {
+		size = tx.Size()
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	if size == 0 {
+		return 0, nil
+	}
+
+	free := int64(stats.FreePageN+stats.PendingPageN) * int64(bdb.Info().PageSize)
+
+	return float64(free) / float64(size), nil
+}
+
+// writeSnapshot writes the database to a writer. A database with many free
+// pages is compacted into a temporary file first so the snapshot doesn't
+// contain them.
+func (s *Store) writeSnapshot(tmpdir string, w io.Writer) (_ int64, err error) {
+	fraction, err := s.freeFraction()
+	if err != nil {
+		return 0, err
+	}
+
+	if fraction < compactionThreshold {
+		return s.WriteTo(w)
+	}
+
+	f, err := os.CreateTemp(tmpdir, "compact*")
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		err = errors.Join(err, os.Remove(f.Name()))
+	}()
+
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+
+	dst, err := bolt.Open(f.Name(), 0o600, &bolt.Options{
+		NoSync: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		err = errors.Join(err, dst.Close())
+	}()
+
+	if err := bolt.Compact(dst, s.db.Bolt(), compactionTxMaxSize); err != nil {
+		return 0, fmt.Errorf("compaction: %w", err)
+	}
+
+	var n int64
+
+	err = dst.View(func(tx *bolt.Tx) error {
+		n, err = tx.WriteTo(w)
+
+		return err
+	})
+
+	return n, err
+}
+
+// CopyBucket copies all records of a bucket into another store. Nothing is
+// copied if the bucket doesn't exist.
+func (s *Store) CopyBucket(dst *Store, name string) error {
+	return s.db.Bolt().View(func(srcTx *bolt.Tx) error {
+		src := srcTx.Bucket([]byte(name))
+		if src == nil {
+			return nil
+		}
+
+		return dst.db.Bolt().Update(func(dstTx *bolt.Tx) error {
+			bucket, err := dstTx.CreateBucketIfNotExists([]byte(name))
+			if err != nil {
+				return err
+			}
+
+			return copyBoltBucket(bucket, src)
+		})
+	})
+}
+
+func copyBoltBucket(dst, src *bolt.Bucket) error {
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+
+		// Nested bucket
+		child, err := dst.CreateBucketIfNotExists(k)
+		if err != nil {
+			return err
+		}
+
+		return copyBoltBucket(child, src.Bucket(k))
+	})
+}
@@ -2,8 +2,11 @@ package state
 
 import (
 	"bytes"
+	"fmt"
+	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestNew(t *testing.T) {
@@ -39,3 +42,128 @@ func TestWriteTo(t *testing.T) {
 		t.Errorf("%d bytes written, want at least %d", got, want)
 	}
 }
+
+func TestWriteSnapshotCompaction(t *testing.T) {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	b, err := s.Bucket("test")
+	if err != nil {
+		t.Fatalf("Bucket() failed: %v", err)
+	}
+
+	until := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := range 2000 {
+		if err := b.SetObjectRetention(fmt.Sprintf("key%04d", i), "v", until); err != nil {
+			t.Fatalf("SetObjectRetention() failed: %v", err)
+		}
+	}
+
+	for i := range 1990 {
+		if err := b.DeleteObjectRetention(fmt.Sprintf("key%04d", i), "v"); err != nil {
+			t.Fatalf("DeleteObjectRetention() failed: %v", err)
+		}
+	}
+
+	if fraction, err := s.freeFraction(); err != nil {
+		t.Errorf("freeFraction() failed: %v", err)
+	} else if fraction < compactionThreshold {
+		t.Errorf("freeFraction() = %v, want at least %v", fraction, compactionThreshold)
+	}
+
+	var full, compacted bytes.Buffer
+
+	if _, err := s.WriteTo(&full); err != nil {
+		t.Errorf("WriteTo() failed: %v", err)
+	}
+
+	if n, err := s.writeSnapshot(t.TempDir(), &compacted); err != nil {
+		t.Errorf("writeSnapshot() failed: %v", err)
+	} else if int64(compacted.Len()) != n {
+		t.Errorf("writeSnapshot() wrote %d bytes, want %d", compacted.Len(), n)
+	}
+
+	if compacted.Len() >= full.Len() {
+		t.Errorf("Compacted snapshot has %d bytes, want less than %d", compacted.Len(), full.Len())
+	}
+
+	path := filepath.Join(t.TempDir(), "compacted")
+
+	if err := os.WriteFile(path, compacted.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+
+	rb, err := restored.Bucket("test")
+	if err != nil {
+		t.Fatalf("Bucket() failed: %v", err)
+	}
+
+	for _, key := range []string{"key0000", "key1999"} {
+		got, _, err := rb.GetObjectRetention(key, "v")
+		if err != nil {
+			t.Errorf("GetObjectRetention(%q) failed: %v", key, err)
+		}
+
+		if want := key == "key1999"; got.Equal(until) != want {
+			t.Errorf("GetObjectRetention(%q) = %v", key, got)
+		}
+	}
+}
+
+func TestCopyBucket(t *testing.T) {
+	src, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	until := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, name := range []string{"first", "second"} {
+		b, err := src.Bucket(name)
+		if err != nil {
+			t.Fatalf("Bucket() failed: %v", err)
+		}
+
+		if err := b.SetObjectRetention(name, "v", until); err != nil {
+			t.Fatalf("SetObjectRetention() failed: %v", err)
+		}
+	}
+
+	dst, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	for _, name := range []string{"first", "missing"} {
+		if err := src.CopyBucket(dst, name); err != nil {
+			t.Errorf("CopyBucket(%q) failed: %v", name, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		bucket, key string
+		want        time.Time
+	}{
+		{bucket: "first", key: "first", want: until},
+		{bucket: "second", key: "second"},
+	} {
+		b, err := dst.Bucket(tc.bucket)
+		if err != nil {
+			t.Fatalf("Bucket() failed: %v", err)
+		}
+
+		if got, _, err := b.GetObjectRetention(tc.key, "v"); err != nil {
+			t.Errorf("GetObjectRetention() failed: %v", err)
+		} else if !got.Equal(tc.want) {
+			t.Errorf("GetObjectRetention(%q) in bucket %q = %v, want %v", tc.key, tc.bucket, got, tc.want)
+		}
+	}
+}
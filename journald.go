@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const journaldSocket = "/run/systemd/journal/socket"
+
+// journalStreamConnected reports whether standard error is connected to the
+// journal. systemd sets $JOURNAL_STREAM to the device and inode number of the
+// stream, which child processes may have inherited with stderr redirected.
+func journalStreamConnected() bool {
+	value := os.Getenv("JOURNAL_STREAM")
+	if value == "" {
+		return false
+	}
+
+	dev, ino, ok := stderrDeviceInode()
+
+	return ok && value == dev+":"+ino
+}
+
+// journalFieldName converts an attribute key to a journal field name
+// consisting of uppercase letters, digits and underscores. Names starting
+// with an underscore are reserved for trusted fields.
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+
+		return '_'
+	}, key)
+
+	name = strings.TrimLeft(name, "_")
+
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "F_" + name
+	}
+
+	if len(name) > 64 {
+		name = name[:64]
+	}
+
+	return name
+}
+
+// appendJournalField encodes a field using the native journal protocol.
+// Values spanning multiple lines are prefixed with their length.
+func appendJournalField(buf []byte, name, value string) []byte {
+	buf = append(buf, name...)
+
+	if strings.Contains(value, "\n") {
+		buf = append(buf, '\n')
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(len(value)))
+	} else {
+		buf = append(buf, '=')
+	}
+
+	buf = append(buf, value...)
+
+	return append(buf, '\n')
+}
+
+// appendJournalAttr adds an attribute, flattening groups into names joined
+// with an underscore, e.g. "OBJECT_VERSION_ID".
+func appendJournalAttr(buf []byte, prefix string, a slog.Attr) []byte {
+	a.Value = a.Value.Resolve()
+
+	if a.Equal(slog.Attr{}) {
+		return buf
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		if a.Key != "" {
+			prefix += a.Key + "_"
+		}
+
+		for _, i := range a.Value.Group() {
+			buf = appendJournalAttr(buf, prefix, i)
+		}
+
+		return buf
+
+	case slog.KindTime:
+		return appendJournalField(buf, journalFieldName(prefix+a.Key), a.Value.Time().Format(time.RFC3339Nano))
+	}
+
+	return appendJournalField(buf, journalFieldName(prefix+a.Key), a.Value.String())
+}
+
+type journaldHandlerOptions struct {
+	level      slog.Leveler
+	identifier string
+
+	// Path of the journal socket. Uses the systemd default if empty.
+	socket string
+}
+
+// journaldHandler sends records to the systemd journal using its native
+// protocol. Attributes become separate fields, retained by "journalctl -o
+// json".
+type journaldHandler struct {
+	opts journaldHandlerOptions
+	conn *net.UnixConn
+
+	// Encoded attributes added via WithAttrs.
+	fields []byte
+
+	// Name prefix of attributes within groups.
+	prefix string
+}
+
+var _ slog.Handler = (*journaldHandler)(nil)
+
+func newJournaldHandler(opts journaldHandlerOptions) (*journaldHandler, error) {
+	if opts.level == nil {
+		opts.level = slog.LevelInfo
+	}
+
+	if opts.socket == "" {
+		opts.socket = journaldSocket
+	}
+
+	// The socket is held by systemd and survives restarts of the journal
+	// daemon.
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{
+		Name: opts.socket,
+		Net:  "unixgram",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &journaldHandler{
+		opts: opts,
+		conn: conn,
+	}, nil
+}
+
+func (h *journaldHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.opts.level.Level()
+}
+
+func (h *journaldHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	result := *h
+	result.fields = bytes.Clone(h.fields)
+
+	for _, a := range attrs {
+		result.fields = appendJournalAttr(result.fields, h.prefix, a)
+	}
+
+	return &result
+}
+
+func (h *journaldHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	result := *h
+	result.prefix += name + "_"
+
+	return &result
+}
+
+func (h *journaldHandler) format(r slog.Record) []byte {
+	buf := appendJournalField(nil, "MESSAGE", r.Message)
+	buf = appendJournalField(buf, "PRIORITY", strconv.Itoa(syslogSeverity(r.Level)))
+
+	if h.opts.identifier != "" {
+		buf = appendJournalField(buf, "SYSLOG_IDENTIFIER", h.opts.identifier)
+	}
+
+	buf = append(buf, h.fields...)
+
+	r.Attrs(func(a slog.Attr) bool {
+		buf = appendJournalAttr(buf, h.prefix, a)
+		return true
+	})
+
+	return buf
+}
+
+func (h *journaldHandler) Handle(_ context.Context, r slog.Record) error {
+	_, err := h.conn.Write(h.format(r))
+
+	return err
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// stderrDeviceInode isn't supported on this platform.
+func stderrDeviceInode() (string, string, bool) {
+	return "", "", false
+}
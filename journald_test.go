@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestJournalFieldName(t *testing.T) {
+	for key, want := range map[string]string{
+		"bucket":            "BUCKET",
+		"object_version_id": "OBJECT_VERSION_ID",
+		"dry-run":           "DRY_RUN",
+		"_hidden":           "HIDDEN",
+		"1st":               "F_1ST",
+		"":                  "F_",
+	} {
+		if got := journalFieldName(key); got != want {
+			t.Errorf("journalFieldName(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestAppendJournalField(t *testing.T) {
+	got := appendJournalField(nil, "A", "single line")
+	got = appendJournalField(got, "B", "two\nlines")
+
+	want := []byte("A=single line\nB\n")
+	want = binary.LittleEndian.AppendUint64(want, 9)
+	want = append(want, "two\nlines\n"...)
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Encoding diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestJournaldHandler(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "socket")
+
+	server, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("Listening on Unix datagram socket failed: %v", err)
+	}
+
+	t.Cleanup(func() { server.Close() })
+
+	h, err := newJournaldHandler(journaldHandlerOptions{
+		identifier: "app",
+		socket:     socket,
+	})
+	if err != nil {
+		t.Fatalf("newJournaldHandler() failed: %v", err)
+	}
+
+	logger := slog.New(h)
+
+	logger.Debug("Hidden")
+	logger.With(slog.String("bucket", "b")).WithGroup("object").Warn("Delete",
+		slog.String("key", "a\nb"),
+		slog.Bool("dry_run", true),
+		slog.Time("until", time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)))
+
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	buf := make([]byte, 4096)
+
+	n, err := server.Read(buf)
+	if err != nil {
+		t.Fatalf("Read() failed: %v", err)
+	}
+
+	var want bytes.Buffer
+
+	want.WriteString("MESSAGE=Delete\nPRIORITY=4\nSYSLOG_IDENTIFIER=app\nBUCKET=b\nOBJECT_KEY\n")
+	binary.Write(&want, binary.LittleEndian, uint64(3))
+	want.WriteString("a\nb\nOBJECT_DRY_RUN=true\nOBJECT_UNTIL=2024-03-01T00:00:00Z\n")
+
+	if diff := cmp.Diff(want.String(), string(buf[:n])); diff != "" {
+		t.Errorf("Datagram diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestJournalStreamConnected(t *testing.T) {
+	t.Setenv("JOURNAL_STREAM", "")
+
+	if journalStreamConnected() {
+		t.Error("journalStreamConnected() without $JOURNAL_STREAM")
+	}
+
+	t.Setenv("JOURNAL_STREAM", "0:0")
+
+	if journalStreamConnected() {
+		t.Error("journalStreamConnected() for other stream")
+	}
+
+	if dev, ino, ok := stderrDeviceInode(); ok {
+		t.Setenv("JOURNAL_STREAM", dev+":"+ino)
+
+		if !journalStreamConnected() {
+			t.Error("journalStreamConnected() = false for standard error")
+		}
+	}
+}
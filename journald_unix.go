@@ -0,0 +1,24 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// stderrDeviceInode returns the device and inode number of standard error.
+func stderrDeviceInode() (string, string, bool) {
+	fi, err := os.Stderr.Stat()
+	if err != nil {
+		return "", "", false
+	}
+
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", "", false
+	}
+
+	return strconv.FormatUint(uint64(st.Dev), 10), strconv.FormatUint(st.Ino, 10), true
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/hansmi/s3-object-cleanup/internal/client"
+)
+
+const runLockAttempts = 3
+
+var errRunLocked = errors.New("locked by another run")
+var errRunLockLost = errors.New("run lock lost")
+
+type runLockClient interface {
+	GetObject(context.Context, *s3.GetObjectInput, ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	PutObject(context.Context, *s3.PutObjectInput, ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	DeleteObject(context.Context, *s3.DeleteObjectInput, ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	ListObjectsV2(context.Context, *s3.ListObjectsV2Input, ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+}
+
+// runLockInfo is the content of the lock object.
+type runLockInfo struct {
+	Owner    string    `json:"owner"`
+	Acquired time.Time `json:"acquired"`
+	Expires  time.Time `json:"expires"`
+}
+
+type runLockOptions struct {
+	logger *slog.Logger
+	client runLockClient
+	bucket string
+	key    string
+
+	// Identification of the lock holder for error messages.
+	owner string
+
+	// The lock expires if not refreshed within the given duration.
+	ttl time.Duration
+
+	// Locks of other runs excluding this one, e.g. those of runs processing
+	// overlapping shards, are found below the prefix and selected by the
+	// function. Checked after acquiring the lock. Disabled if nil.
+	conflictPrefix string
+	conflicts      func(key string) bool
+
+	now func() time.Time
+}
+
+// runLock is a lock object in the persistence bucket preventing concurrent
+// runs. All modifications are conditional writes, so only one run can create
+// or take over an expired lock.
+type runLock struct {
+	runLockOptions
+
+	mu   sync.Mutex
+	etag string
+	info runLockInfo
+}
+
+func defaultRunLockOwner() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return fmt.Sprintf("%s[%d]", hostname, os.Getpid())
+}
+
+func acquireRunLock(ctx context.Context, opts runLockOptions) (*runLock, error) {
+	if opts.now == nil {
+		opts.now = time.Now
+	}
+
+	l := &runLock{
+		runLockOptions: opts,
+	}
+
+	for range runLockAttempts {
+		// Try to create the lock first.
+		if err := l.put(ctx, client.UploadCondition{IfNoneMatch: true}, time.Time{}); err == nil {
+			return l.checkConflicts(ctx)
+		} else if !client.IsPreconditionFailed(err) {
+			return nil, err
+		}
+
+		existing, etag, err := l.get(ctx, l.key)
+		if err != nil {
+			if client.IsNotFound(err) {
+				// Released in the meantime.
+				continue
+			}
+
+			return nil, err
+		}
+
+		if opts.now().Before(existing.Expires) {
+			return nil, fmt.Errorf("%w: held by %s since %s until %s", errRunLocked,
+				existing.Owner, existing.Acquired.Format(time.RFC3339), existing.Expires.Format(time.RFC3339))
+		}
+
+		opts.logger.Warn("Taking over expired run lock",
+			slog.String("owner", existing.Owner),
+			slog.Time("expires", existing.Expires))
+
+		if err := l.put(ctx, client.UploadCondition{IfMatch: etag}, time.Time{}); err == nil {
+			return l.checkConflicts(ctx)
+		} else if !client.IsPreconditionFailed(err) {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("%w: lock changed repeatedly while acquiring", errRunLocked)
+}
+
+// checkConflicts releases the newly acquired lock if a conflicting lock is
+// held by another run. Both runs may fail if they acquire their locks at the
+// same time, but never both succeed.
+func (l *runLock) checkConflicts(ctx context.Context) (*runLock, error) {
+	if l.conflicts == nil {
+		return l, nil
+	}
+
+	err := l.findConflict(ctx)
+	if err == nil {
+		return l, nil
+	}
+
+	return nil, errors.Join(err, l.release(ctx))
+}
+
+func (l *runLock) findConflict(ctx context.Context) error {
+	paginator := s3.NewListObjectsV2Paginator(l.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(l.bucket),
+		Prefix: aws.String(l.conflictPrefix),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("listing conflicting locks: %w", err)
+		}
+
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+
+			if key == l.key || !l.conflicts(key) {
+				continue
+			}
+
+			existing, _, err := l.get(ctx, key)
+			if err != nil {
+				if client.IsNotFound(err) {
+					continue
+				}
+
+				return err
+			}
+
+			if l.now().Before(existing.Expires) {
+				return fmt.Errorf("%w: conflicting lock %q held by %s since %s until %s", errRunLocked,
+					key, existing.Owner, existing.Acquired.Format(time.RFC3339), existing.Expires.Format(time.RFC3339))
+			}
+		}
+	}
+
+	return nil
+}
+
+func (l *runLock) get(ctx context.Context, key string) (runLockInfo, string, error) {
+	var info runLockInfo
+
+	output, err := l.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(l.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return info, "", err
+	}
+
+	defer output.Body.Close()
+
+	if err := json.NewDecoder(output.Body).Decode(&info); err != nil {
+		return info, "", fmt.Errorf("decoding lock %q: %w", key, err)
+	}
+
+	return info, aws.ToString(output.ETag), nil
+}
+
+func (l *runLock) put(ctx context.Context, cond client.UploadCondition, acquired time.Time) error {
+	now := l.now()
+
+	if acquired.IsZero() {
+		acquired = now
+	}
+
+	info := runLockInfo{
+		Owner:    l.owner,
+		Acquired: acquired,
+		Expires:  now.Add(l.ttl),
+	}
+
+	content, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(l.bucket),
+		Key:         aws.String(l.key),
+		Body:        bytes.NewReader(content),
+		ContentType: aws.String("application/json"),
+	}
+
+	if cond.IfMatch != "" {
+		input.IfMatch = aws.String(cond.IfMatch)
+	}
+
+	if cond.IfNoneMatch {
+		input.IfNoneMatch = aws.String("*")
+	}
+
+	output, err := l.client.PutObject(ctx, input)
+	if err != nil {
+		return fmt.Errorf("writing lock %q: %w", l.key, err)
+	}
+
+	l.etag = aws.ToString(output.ETag)
+	l.info = info
+
+	return nil
+}
+
+// refresh extends the expiry of a held lock.
+func (l *runLock) refresh(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.put(ctx, client.UploadCondition{IfMatch: l.etag}, l.info.Acquired); err != nil {
+		if client.IsPreconditionFailed(err) {
+			err = fmt.Errorf("%w: %w", errRunLockLost, err)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// keepAlive refreshes the lock until the context is cancelled. An error is
+// returned if the lock can't be refreshed before it expires.
+func (l *runLock) keepAlive(ctx context.Context) error {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		if err := l.refresh(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			if errors.Is(err, errRunLockLost) {
+				return err
+			}
+
+			l.mu.Lock()
+			expires := l.info.Expires
+			l.mu.Unlock()
+
+			if !l.now().Before(expires) {
+				return fmt.Errorf("%w: %w", errRunLockLost, err)
+			}
+
+			l.logger.Warn("Refreshing run lock failed", slog.Any("error", err))
+		}
+	}
+}
+
+// release removes the lock object if it's still held.
+func (l *runLock) release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket:  aws.String(l.bucket),
+		Key:     aws.String(l.key),
+		IfMatch: aws.String(l.etag),
+	}); err != nil {
+		if client.IsPreconditionFailed(err) {
+			err = fmt.Errorf("%w: %w", errRunLockLost, err)
+		}
+
+		return fmt.Errorf("releasing lock %q: %w", l.key, err)
+	}
+
+	return nil
+}
+
+// hold keeps the lock alive in the background. The returned context is
+// cancelled if the lock is lost. The returned function stops refreshing and
+// releases the lock.
+func (l *runLock) hold(ctx context.Context) (context.Context, func() error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		if err := l.keepAlive(ctx); err != nil {
+			l.logger.Error("Aborting run", slog.Any("error", err))
+			cancel(err)
+		}
+	}()
+
+	return ctx, func() error {
+		cancel(nil)
+		<-done
+
+		releaseCtx, cancelRelease := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+		defer cancelRelease()
+
+		return l.release(releaseCtx)
+	}
+}
+
+// holdRunLock acquires the lock and keeps it alive until the returned function
+// is invoked. The returned context is cancelled if the lock is lost. The
+// release function joins a failure into the given error, usually the named
+// return value of the caller.
+func holdRunLock(ctx context.Context, opts runLockOptions) (context.Context, func(*error), error) {
+	lock, err := acquireRunLock(ctx, opts)
+	if err != nil {
+		return ctx, nil, err
+	}
+
+	ctx, release := lock.hold(ctx)
+
+	return ctx, func(err *error) {
+		*err = errors.Join(*err, release())
+	}, nil
+}
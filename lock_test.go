@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/hansmi/s3-object-cleanup/cleanup"
+)
+
+type fakeRunLockObject struct {
+	content []byte
+	etag    string
+}
+
+type fakeRunLockClient struct {
+	mu      sync.Mutex
+	objects map[string]*fakeRunLockObject
+	serial  int
+	putErr  error
+	delErr  error
+}
+
+func (c *fakeRunLockClient) GetObject(_ context.Context, input *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	obj := c.objects[aws.ToString(input.Key)]
+	if obj == nil {
+		return nil, &types.NoSuchKey{}
+	}
+
+	return &s3.GetObjectOutput{
+		Body: io.NopCloser(bytes.NewReader(obj.content)),
+		ETag: aws.String(obj.etag),
+	}, nil
+}
+
+func (c *fakeRunLockClient) checkCondition(key string, ifMatch, ifNoneMatch *string) error {
+	var etag string
+
+	if obj := c.objects[key]; obj != nil {
+		etag = obj.etag
+	}
+
+	if (ifMatch != nil && aws.ToString(ifMatch) != etag) || (ifNoneMatch != nil && etag != "") {
+		return &smithy.GenericAPIError{Code: "PreconditionFailed"}
+	}
+
+	return nil
+}
+
+func (c *fakeRunLockClient) PutObject(_ context.Context, input *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.putErr != nil {
+		return nil, c.putErr
+	}
+
+	key := aws.ToString(input.Key)
+
+	if err := c.checkCondition(key, input.IfMatch, input.IfNoneMatch); err != nil {
+		return nil, err
+	}
+
+	content, err := io.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.objects == nil {
+		c.objects = map[string]*fakeRunLockObject{}
+	}
+
+	c.serial++
+	c.objects[key] = &fakeRunLockObject{
+		content: content,
+		etag:    fmt.Sprintf(`"%d"`, c.serial),
+	}
+
+	return &s3.PutObjectOutput{ETag: aws.String(c.objects[key].etag)}, nil
+}
+
+func (c *fakeRunLockClient) DeleteObject(_ context.Context, input *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.delErr != nil {
+		return nil, c.delErr
+	}
+
+	key := aws.ToString(input.Key)
+
+	if err := c.checkCondition(key, input.IfMatch, nil); err != nil {
+		return nil, err
+	}
+
+	delete(c.objects, key)
+
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (c *fakeRunLockClient) ListObjectsV2(_ context.Context, input *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	output := &s3.ListObjectsV2Output{}
+
+	for _, key := range slices.Sorted(maps.Keys(c.objects)) {
+		if strings.HasPrefix(key, aws.ToString(input.Prefix)) {
+			output.Contents = append(output.Contents, types.Object{Key: aws.String(key)})
+		}
+	}
+
+	return output, nil
+}
+
+// setETag replaces the entity tag of an object, e.g. to simulate another run
+// taking over a lock.
+func (c *fakeRunLockClient) setETag(key, etag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.objects[key].etag = etag
+}
+
+func TestRunLock(t *testing.T) {
+	now := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+	var fc fakeRunLockClient
+
+	opts := func(owner string) runLockOptions {
+		return runLockOptions{
+			logger: slog.Default(),
+			client: &fc,
+			bucket: "bucket",
+			key:    "lock.json",
+			owner:  owner,
+			ttl:    time.Hour,
+			now:    func() time.Time { return now },
+		}
+	}
+
+	first, err := acquireRunLock(t.Context(), opts("first"))
+	if err != nil {
+		t.Fatalf("acquireRunLock() failed: %v", err)
+	}
+
+	if _, err := acquireRunLock(t.Context(), opts("second")); !errors.Is(err, errRunLocked) {
+		t.Errorf("acquireRunLock() on held lock returned %v, want %v", err, errRunLocked)
+	}
+
+	now = now.Add(30 * time.Minute)
+
+	if err := first.refresh(t.Context()); err != nil {
+		t.Errorf("refresh() failed: %v", err)
+	}
+
+	if want := now.Add(time.Hour); !first.info.Expires.Equal(want) {
+		t.Errorf("Lock expires at %v, want %v", first.info.Expires, want)
+	}
+
+	// Still held after the original expiry.
+	now = now.Add(45 * time.Minute)
+
+	if _, err := acquireRunLock(t.Context(), opts("second")); !errors.Is(err, errRunLocked) {
+		t.Errorf("acquireRunLock() on refreshed lock returned %v, want %v", err, errRunLocked)
+	}
+
+	now = now.Add(time.Hour)
+
+	second, err := acquireRunLock(t.Context(), opts("second"))
+	if err != nil {
+		t.Fatalf("acquireRunLock() on expired lock failed: %v", err)
+	}
+
+	if err := first.refresh(t.Context()); !errors.Is(err, errRunLockLost) {
+		t.Errorf("refresh() of taken over lock returned %v, want %v", err, errRunLockLost)
+	}
+
+	if err := first.release(t.Context()); !errors.Is(err, errRunLockLost) {
+		t.Errorf("release() of taken over lock returned %v, want %v", err, errRunLockLost)
+	}
+
+	if err := second.release(t.Context()); err != nil {
+		t.Errorf("release() failed: %v", err)
+	}
+
+	third, err := acquireRunLock(t.Context(), opts("third"))
+	if err != nil {
+		t.Fatalf("acquireRunLock() after release failed: %v", err)
+	}
+
+	if err := third.release(t.Context()); err != nil {
+		t.Errorf("release() failed: %v", err)
+	}
+}
+
+func TestRunLockError(t *testing.T) {
+	fc := fakeRunLockClient{
+		putErr: errors.New("test error"),
+	}
+
+	if _, err := acquireRunLock(t.Context(), runLockOptions{
+		logger: slog.Default(),
+		client: &fc,
+		key:    "lock.json",
+		ttl:    time.Hour,
+	}); !errors.Is(err, fc.putErr) {
+		t.Errorf("acquireRunLock() returned %v, want %v", err, fc.putErr)
+	}
+}
+
+func TestRunLockHold(t *testing.T) {
+	var fc fakeRunLockClient
+
+	lock, err := acquireRunLock(t.Context(), runLockOptions{
+		logger: slog.Default(),
+		client: &fc,
+		key:    "lock.json",
+		ttl:    30 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("acquireRunLock() failed: %v", err)
+	}
+
+	ctx, release := lock.hold(t.Context())
+
+	// Take over the lock.
+	fc.setETag("lock.json", `"other"`)
+
+	<-ctx.Done()
+
+	if err := context.Cause(ctx); !errors.Is(err, errRunLockLost) {
+		t.Errorf("Context cause is %v, want %v", err, errRunLockLost)
+	}
+
+	if err := release(); !errors.Is(err, errRunLockLost) {
+		t.Errorf("release() returned %v, want %v", err, errRunLockLost)
+	}
+}
+
+func TestHoldRunLockReleaseError(t *testing.T) {
+	fc := fakeRunLockClient{
+		delErr: errors.New("delete failed"),
+	}
+
+	err := func() (err error) {
+		_, release, err := holdRunLock(t.Context(), runLockOptions{
+			logger: slog.Default(),
+			client: &fc,
+			bucket: "bucket",
+			key:    "lock.json",
+			owner:  "test",
+			ttl:    time.Hour,
+		})
+		if err != nil {
+			t.Fatalf("holdRunLock() failed: %v", err)
+		}
+
+		defer release(&err)
+
+		return nil
+	}()
+
+	if !errors.Is(err, fc.delErr) {
+		t.Errorf("Release returned %v, want %v", err, fc.delErr)
+	}
+}
+
+func TestRunLockConflicts(t *testing.T) {
+	now := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+	var fc fakeRunLockClient
+
+	opts := func(spec string) runLockOptions {
+		shard, err := cleanup.ParseKeyShard(spec)
+		if err != nil {
+			t.Fatalf("ParseKeyShard(%q) failed: %v", spec, err)
+		}
+
+		return runLockOptions{
+			logger:         slog.Default(),
+			client:         &fc,
+			bucket:         "bucket",
+			key:            shard.ObjectKey("lock.json"),
+			owner:          spec,
+			ttl:            time.Hour,
+			conflictPrefix: shard.ObjectKeyPrefix("lock.json"),
+			conflicts: func(key string) bool {
+				return shard.OverlapsObjectKey("lock.json", key)
+			},
+			now: func() time.Time { return now },
+		}
+	}
+
+	first, err := acquireRunLock(t.Context(), opts("0/2"))
+	if err != nil {
+		t.Fatalf("acquireRunLock() failed: %v", err)
+	}
+
+	second, err := acquireRunLock(t.Context(), opts("1/2"))
+	if err != nil {
+		t.Fatalf("acquireRunLock() for other shard failed: %v", err)
+	}
+
+	for _, spec := range []string{"", "1/4"} {
+		if _, err := acquireRunLock(t.Context(), opts(spec)); !errors.Is(err, errRunLocked) {
+			t.Errorf("acquireRunLock(%q) returned %v, want %v", spec, err, errRunLocked)
+		}
+	}
+
+	// Conflicting locks are released again.
+	if _, err := fc.GetObject(t.Context(), &s3.GetObjectInput{Key: aws.String("lock.json")}); err == nil {
+		t.Errorf("Lock for whole bucket wasn't released")
+	}
+
+	for _, lock := range []*runLock{first, second} {
+		if err := lock.release(t.Context()); err != nil {
+			t.Errorf("release() failed: %v", err)
+		}
+	}
+
+	if _, err := acquireRunLock(t.Context(), opts("")); err != nil {
+		t.Fatalf("acquireRunLock() for whole bucket failed: %v", err)
+	}
+
+	if _, err := acquireRunLock(t.Context(), opts("0/2")); !errors.Is(err, errRunLocked) {
+		t.Errorf("acquireRunLock() for shard returned %v, want %v", err, errRunLocked)
+	}
+
+	// Expired locks don't conflict.
+	now = now.Add(2 * time.Hour)
+
+	if _, err := acquireRunLock(t.Context(), opts("0/2")); err != nil {
+		t.Errorf("acquireRunLock() with expired conflicting lock failed: %v", err)
+	}
+}
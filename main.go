@@ -9,12 +9,19 @@ import (
 	"log/slog"
 	"os"
 	"runtime"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/smithy-go/logging"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/hansmi/s3-object-cleanup/cleanup"
 	"github.com/hansmi/s3-object-cleanup/internal/client"
 	"github.com/hansmi/s3-object-cleanup/internal/env"
 	"github.com/hansmi/s3-object-cleanup/internal/state"
@@ -24,16 +31,142 @@ const minDeletionAgeDaysDefault = 32
 const defaultMinRetentionDays = 32
 const defaultMinRetentionThresholdDays = defaultMinRetentionDays / 4
 
+const defaultStateRecordTTLDays = 30
+
+const defaultListPageRetries = 3
+
+const defaultMaxRetentionHorizonYears = 10
+
+const defaultLargestDeletions = 10
+
+const defaultTrendRuns = 10
+
 type program struct {
-	dryRun bool
+	dryRun    bool
+	preflight bool
+
+	timeout    time.Duration
+	maxRuntime time.Duration
+
+	listCheckpointInterval time.Duration
+	listPageSize           int
+	listPageRetries        int
+	channelCapacity        int
+	spillVersions          bool
+	stateFilter            bool
+	retentionViaHead       bool
+	maxWorkers             int
+	progressInterval       time.Duration
+
+	inventory      bool
+	incremental    time.Duration
+	stateRecordTTL time.Duration
+	deleteAuditTTL time.Duration
+
+	minDeletionAge         time.Duration
+	minRetention           time.Duration
+	minRetentionThreshold  time.Duration
+	retentionJitter        time.Duration
+	seed                   uint64
+	maxRetentionHorizon    time.Duration
+	retentionHorizonAction string
+	quarantinePeriod       time.Duration
+	maxNoncurrentVersions  int
+	minSurvivingVersions   int
+	ageFromNoncurrent      bool
+	expireUnversioned      bool
+	deleteMarkerStrategy   string
+	allowUnlockedBuckets   bool
+
+	persistenceBucket      string
+	persistenceAccelerate  bool
+	stateEncryptionKeyFile string
+	persistenceSSE         string
+	persistenceSSEKMSKeyID string
+	unconditionalState     bool
+	maxStateSize           string
+	lockTTL                time.Duration
+	approvalToken          string
+	stateCheckpoint        time.Duration
+	planFile               string
+	planFormat             string
+	actionsNDJSON          string
+	largestDeletions       int
+	statsFile              string
+	traceDecisions         bool
+
+	maxDeleteRate float64
+	maxErrorRatio float64
+
+	maxDeleteFraction       float64
+	maxDeleteFractionAction string
+
+	requireReviewedPlan bool
+	maxPlanDeviation    float64
+
+	maxClockSkew    time.Duration
+	clockSkewAction string
+
+	excludeKeysFile   string
+	preset            string
+	protectedPrefixes string
+	onlyKeysFile      string
+	shard             string
+	excludeMetadata   string
+	onlyKMSKey        string
+
+	httpMaxIdleConns          int
+	httpConnectTimeout        time.Duration
+	httpResponseHeaderTimeout time.Duration
+	dnsServer                 string
+	addressFamily             string
+
+	dualStackEndpoint bool
+	fipsEndpoint      bool
+
+	s3Flavor string
+
+	webIdentityTokenFile       string
+	webIdentityRoleARN         string
+	webIdentitySessionName     string
+	webIdentitySessionDuration time.Duration
+
+	rcloneConfigFile string
+
+	bucketConfigFile string
 
-	timeout time.Duration
+	userAgent string
 
-	minDeletionAge        time.Duration
-	minRetention          time.Duration
-	minRetentionThreshold time.Duration
+	sqsQueueURL       string
+	sqsMaxMessages    int
+	sqsDiscardUnknown bool
 
-	persistenceBucket string
+	// Random identifier of the current invocation.
+	runID string
+
+	// Flag values parsed by validate.
+	parsed parsedFlags
+
+	retryMode        string
+	retryMaxAttempts int
+	retryMaxBackoff  time.Duration
+
+	benchKeys        int
+	benchMaxVersions int
+	benchLatency     time.Duration
+	benchSeed        int
+
+	trendRuns int
+
+	syslogAddress  string
+	syslogFacility string
+	journald       bool
+
+	pprofListen string
+	cpuProfile  string
+	memProfile  string
+
+	chaos string
 }
 
 func (p *program) registerFlags() {
@@ -41,15 +174,92 @@ func (p *program) registerFlags() {
 		env.MustGetBool("S3_OBJECT_CLEANUP_DRY_RUN", true),
 		"Perform a trial run without actually deleting objects. Defaults to $S3_OBJECT_CLEANUP_DRY_RUN.")
 
+	flag.BoolVar(&p.preflight, "preflight",
+		env.MustGetBool("S3_OBJECT_CLEANUP_PREFLIGHT", false),
+		"Probe the permissions for listing, retention lookups and, unless in a dry run, retention extensions and deletions with a few requests per bucket before processing any bucket. Stops with a report of the missing permissions if a probe is denied. Buckets are checked again against the cached results before they're processed. Useful when setting up or changing credentials. Defaults to $S3_OBJECT_CLEANUP_PREFLIGHT.")
+
 	flag.DurationVar(&p.timeout, "timeout",
 		env.MustGetDuration("S3_OBJECT_CLEANUP_TIMEOUT", 0),
 		"Maximum amount of time before giving up. Defaults to $S3_OBJECT_CLEANUP_TIMEOUT.")
 
+	flag.DurationVar(&p.maxRuntime, "max_runtime",
+		env.MustGetDuration("S3_OBJECT_CLEANUP_MAX_RUNTIME", 0),
+		"Stop listing object versions once the given amount of time has passed and finish processing the versions listed so far. The listing position is stored in the state and the next run resumes from there. Buckets not yet started are skipped. Disabled if zero. Defaults to $S3_OBJECT_CLEANUP_MAX_RUNTIME.")
+
+	flag.DurationVar(&p.listCheckpointInterval, "list_checkpoint_interval",
+		env.MustGetDuration("S3_OBJECT_CLEANUP_LIST_CHECKPOINT_INTERVAL", 0),
+		"Record the listing position in the state at the given interval. The position only advances past keys whose versions have been processed completely, including their deletions and retention extensions. A run failing or interrupted before completion resumes listing from the last checkpoint on the next run, provided the state was persisted. Disabled if zero. Defaults to $S3_OBJECT_CLEANUP_LIST_CHECKPOINT_INTERVAL.")
+
+	flag.IntVar(&p.listPageSize, "list_page_size",
+		env.MustGetInt("S3_OBJECT_CLEANUP_LIST_PAGE_SIZE", 0),
+		"Maximum number of entries returned per listing request. Smaller pages reduce the latency of individual requests at the cost of more requests; AWS S3 returns at most 1000 entries per page. Uses the server default if zero. Defaults to $S3_OBJECT_CLEANUP_LIST_PAGE_SIZE.")
+
+	flag.IntVar(&p.listPageRetries, "list_page_retries",
+		env.MustGetInt("S3_OBJECT_CLEANUP_LIST_PAGE_RETRIES", defaultListPageRetries),
+		fmt.Sprintf("Number of times a listing request failing with a transient error is retried, in addition to the SDK retries, before giving up on the bucket. The listing continues from the failed page. Defaults to $S3_OBJECT_CLEANUP_LIST_PAGE_RETRIES or %d.", defaultListPageRetries))
+
+	flag.IntVar(&p.channelCapacity, "channel_capacity",
+		env.MustGetInt("S3_OBJECT_CLEANUP_CHANNEL_CAPACITY", cleanup.DefaultChannelCapacity),
+		fmt.Sprintf("Number of object versions buffered between pipeline stages. Deeper buffers improve throughput when the latency of retention lookups or deletions varies a lot, at the cost of memory. Defaults to $S3_OBJECT_CLEANUP_CHANNEL_CAPACITY or %d.", cleanup.DefaultChannelCapacity))
+
+	flag.BoolVar(&p.spillVersions, "spill_versions",
+		env.MustGetBool("S3_OBJECT_CLEANUP_SPILL_VERSIONS", false),
+		"Stage the versions of keys not yet evaluated in a temporary database on disk instead of memory. Reduces memory use on small hosts processing very large buckets at the cost of speed. Defaults to $S3_OBJECT_CLEANUP_SPILL_VERSIONS.")
+
+	flag.DurationVar(&p.progressInterval, "progress_interval",
+		env.MustGetDuration("S3_OBJECT_CLEANUP_PROGRESS_INTERVAL", 0),
+		"Log the number of listed, processed and deleted object versions at the given interval. The remaining time is estimated from the number of versions processed by the previous complete run recorded in the state. Disabled if zero. Defaults to $S3_OBJECT_CLEANUP_PROGRESS_INTERVAL.")
+
+	flag.IntVar(&p.maxWorkers, "max_workers",
+		env.MustGetInt("S3_OBJECT_CLEANUP_MAX_WORKERS", 0),
+		fmt.Sprintf("Automatically adapt the number of concurrent API workers per stage between 1 and the given number, growing while latency stays low and shrinking on rising latency or throttling. Uses %d workers per stage if zero. Defaults to $S3_OBJECT_CLEANUP_MAX_WORKERS.", cleanup.DefaultWorkers))
+
+	flag.BoolVar(&p.retentionViaHead, "retention_via_head_object",
+		env.MustGetBool("S3_OBJECT_CLEANUP_RETENTION_VIA_HEAD_OBJECT", false),
+		"Determine the retention of object versions using HeadObject instead of GetObjectRetention. The response is reused for -exclude_metadata and -only_kms_key, saving one request per expired version. Defaults to $S3_OBJECT_CLEANUP_RETENTION_VIA_HEAD_OBJECT.")
+
+	flag.BoolVar(&p.stateFilter, "state_filter",
+		env.MustGetBool("S3_OBJECT_CLEANUP_STATE_FILTER", false),
+		"Keep a compact in-memory filter of the object versions recorded in the state along with their retention and inventory records. Versions not contained in the filter skip the state lookups and the records of known versions are read from memory, speeding up repeated runs at the cost of memory for each recorded version. Defaults to $S3_OBJECT_CLEANUP_STATE_FILTER.")
+
+	flag.BoolVar(&p.inventory, "inventory",
+		env.MustGetBool("S3_OBJECT_CLEANUP_INVENTORY", false),
+		"Keep an inventory of all object versions in the state. Used to find versions unchanged since a previous run. Increases the state size. Defaults to $S3_OBJECT_CLEANUP_INVENTORY.")
+
+	flag.DurationVar(&p.incremental, "incremental",
+		env.MustGetDuration("S3_OBJECT_CLEANUP_INCREMENTAL", 0),
+		"Only evaluate keys whose versions changed since the previous run according to the inventory or which are due for retention extension or deletion. All keys are evaluated if the last run doing so started longer ago than the given duration. Requires -inventory. Disabled if zero. Defaults to $S3_OBJECT_CLEANUP_INCREMENTAL.")
+
+	flag.DurationVar(&p.stateRecordTTL, "state_record_ttl",
+		env.MustGetDuration("S3_OBJECT_CLEANUP_STATE_RECORD_TTL", defaultStateRecordTTLDays*24*time.Hour),
+		fmt.Sprintf("Remove cached retention information from the state once the retention period ended or the record wasn't refreshed for the given amount of time. Disabled if zero. Defaults to $S3_OBJECT_CLEANUP_STATE_RECORD_TTL or %d days.",
+			defaultStateRecordTTLDays))
+
+	flag.DurationVar(&p.deleteAuditTTL, "delete_audit_ttl",
+		env.MustGetDuration("S3_OBJECT_CLEANUP_DELETE_AUDIT_TTL", 0),
+		"Record which object versions were deleted, when and with what result in the state and keep the records for the given amount of time. Disabled if zero. Defaults to $S3_OBJECT_CLEANUP_DELETE_AUDIT_TTL.")
+
 	flag.DurationVar(&p.minDeletionAge, "min_age",
 		env.MustGetDuration("S3_OBJECT_CLEANUP_MIN_AGE", minDeletionAgeDaysDefault*24*time.Hour),
 		fmt.Sprintf("Minimum object version age before considering for deletion. Defaults to $S3_OBJECT_CLEANUP_MIN_AGE or %d days.",
 			minDeletionAgeDaysDefault))
 
+	flag.BoolVar(&p.ageFromNoncurrent, "age_from_noncurrent",
+		env.MustGetBool("S3_OBJECT_CLEANUP_AGE_FROM_NONCURRENT", false),
+		"Measure the age of an object version for -min_age from the moment it became noncurrent, i.e. the creation of its successor, instead of its own creation. Matches the semantics of NoncurrentDays in S3 lifecycle rules. Defaults to $S3_OBJECT_CLEANUP_AGE_FROM_NONCURRENT.")
+
+	flag.BoolVar(&p.expireUnversioned, "expire_unversioned",
+		env.MustGetBool("S3_OBJECT_CLEANUP_EXPIRE_UNVERSIONED", false),
+		"In buckets without versioning enabled (never enabled or suspended) delete objects older than -min_age. Without this flag such buckets only have their existing noncurrent versions processed. Defaults to $S3_OBJECT_CLEANUP_EXPIRE_UNVERSIONED.")
+
+	flag.StringVar(&p.deleteMarkerStrategy, "delete_marker_strategy",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_DELETE_MARKER_STRATEGY", cleanup.DeleteMarkerDefault.String()),
+		`Handling of keys whose latest version is a delete marker. "default" retains the most recent version before the marker until the marker is older than -min_age, then deletes the marker along with the older versions. "expire" deletes the versions before the marker by their own age and the marker as soon as no older versions remain. "keep" never deletes the marker, but deletes the versions before it by age. "skip" leaves such keys untouched. Defaults to $S3_OBJECT_CLEANUP_DELETE_MARKER_STRATEGY.`)
+
+	flag.BoolVar(&p.allowUnlockedBuckets, "allow_unlocked_buckets",
+		env.MustGetBool("S3_OBJECT_CLEANUP_ALLOW_UNLOCKED_BUCKETS", false),
+		"Delete versions in buckets without Object Lock. Such buckets can't protect the remaining versions with retention and runs other than dry runs are refused without this flag. Defaults to $S3_OBJECT_CLEANUP_ALLOW_UNLOCKED_BUCKETS.")
+
 	flag.DurationVar(&p.minRetention, "min_retention",
 		env.MustGetDuration("S3_OBJECT_CLEANUP_MIN_RETENTION", defaultMinRetentionDays*24*time.Hour),
 		fmt.Sprintf("Set or extend the retention of object versions to be at least the given amount of time. Defaults to $S3_OBJECT_CLEANUP_MIN_RETENTION or %d days.",
@@ -60,39 +270,450 @@ func (p *program) registerFlags() {
 		fmt.Sprintf("Object version retention is set when it's missing or the remaining amount of time falls below the given value. Defaults to $S3_OBJECT_CLEANUP_MIN_RETENTION_THRESHOLD or %d days.",
 			defaultMinRetentionThresholdDays))
 
+	flag.Float64Var(&p.maxDeleteRate, "max_delete_rate",
+		env.MustGetFloat("S3_OBJECT_CLEANUP_MAX_DELETE_RATE", 0),
+		"Maximum number of object versions deleted per second across all workers. Zero disables the limit. Defaults to $S3_OBJECT_CLEANUP_MAX_DELETE_RATE.")
+
+	flag.Float64Var(&p.maxErrorRatio, "max_error_ratio",
+		env.MustGetFloat("S3_OBJECT_CLEANUP_MAX_ERROR_RATIO", 0),
+		"Abort the run when the ratio of errors to processed object versions in a bucket exceeds the given fraction (e.g. 0.05). Zero disables the check. Defaults to $S3_OBJECT_CLEANUP_MAX_ERROR_RATIO.")
+
+	flag.Float64Var(&p.maxDeleteFraction, "max_delete_fraction",
+		env.MustGetFloat("S3_OBJECT_CLEANUP_MAX_DELETE_FRACTION", 0),
+		"Stop deleting once the deletions in a bucket exceed the given fraction (e.g. 0.2) of its object versions, catching misconfigurations before they wipe most of a bucket. The versions discovered so far or those seen by the previous complete run are counted, whichever is more, regardless of the bucket size. Without a previous complete run all deletions are only logged. Zero disables the check. Defaults to $S3_OBJECT_CLEANUP_MAX_DELETE_FRACTION.")
+
+	flag.StringVar(&p.maxDeleteFractionAction, "max_delete_fraction_action",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_MAX_DELETE_FRACTION_ACTION", "abort"),
+		`What to do once -max_delete_fraction is exceeded: "abort" the bucket or continue with a "dry_run". Defaults to $S3_OBJECT_CLEANUP_MAX_DELETE_FRACTION_ACTION or "abort".`)
+
+	flag.IntVar(&p.maxNoncurrentVersions, "max_noncurrent_versions",
+		env.MustGetInt("S3_OBJECT_CLEANUP_MAX_NONCURRENT_VERSIONS", 0),
+		"Delete noncurrent object versions beyond the given number of most recent ones per key, even if they're younger than -min_age. Disabled if zero. Defaults to $S3_OBJECT_CLEANUP_MAX_NONCURRENT_VERSIONS.")
+
+	flag.IntVar(&p.minSurvivingVersions, "min_surviving_versions",
+		env.MustGetInt("S3_OBJECT_CLEANUP_MIN_SURVIVING_VERSIONS", 0),
+		"Skip the deletions for keys which would be left with fewer than the given number of versions, delete markers included. Skipped keys are counted in the statistics. Only applies to versioned buckets. Disabled if zero. Defaults to $S3_OBJECT_CLEANUP_MIN_SURVIVING_VERSIONS.")
+
+	flag.DurationVar(&p.retentionJitter, "retention_jitter",
+		env.MustGetDuration("S3_OBJECT_CLEANUP_RETENTION_JITTER", 0),
+		"Extend object version retention by an additional random amount of time up to the given duration to avoid many versions expiring at the same moment. Defaults to $S3_OBJECT_CLEANUP_RETENTION_JITTER.")
+
+	flag.Uint64Var(&p.seed, "seed",
+		env.MustGetUint64("S3_OBJECT_CLEANUP_SEED", 0),
+		"Seed for randomized decisions such as the retention jitter and injected faults. The seed of every run is logged at its start; passing it again reproduces the same decisions for the same versions. A random seed is selected if zero. Defaults to $S3_OBJECT_CLEANUP_SEED.")
+
+	flag.DurationVar(&p.maxRetentionHorizon, "max_retention_horizon",
+		env.MustGetDuration("S3_OBJECT_CLEANUP_MAX_RETENTION_HORIZON", defaultMaxRetentionHorizonYears*365*24*time.Hour),
+		fmt.Sprintf("Treat retention dates further than the given duration in the future as the result of a misconfiguration and act according to -retention_horizon_action. Guards against effectively permanent locks, which can't be shortened in compliance mode. Disabled if zero. Defaults to $S3_OBJECT_CLEANUP_MAX_RETENTION_HORIZON or %d years.",
+			defaultMaxRetentionHorizonYears))
+
+	flag.StringVar(&p.retentionHorizonAction, "retention_horizon_action",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_RETENTION_HORIZON_ACTION", "reject"),
+		`What to do with retention dates beyond -max_retention_horizon: "reject" the extension, counting it as an error, or "clamp" the date to the horizon. Defaults to $S3_OBJECT_CLEANUP_RETENTION_HORIZON_ACTION or "reject".`)
+
+	flag.DurationVar(&p.quarantinePeriod, "quarantine_period",
+		env.MustGetDuration("S3_OBJECT_CLEANUP_QUARANTINE_PERIOD", 0),
+		"Only delete object versions which have been eligible for deletion for at least the given amount of time. Versions are scheduled in the state on their first eligible run, so the state must be persisted across runs. Disabled if zero. Defaults to $S3_OBJECT_CLEANUP_QUARANTINE_PERIOD.")
+
 	flag.StringVar(&p.persistenceBucket, "persistence_bucket",
 		env.GetWithFallback("S3_OBJECT_CLEANUP_PERSISTENCE_BUCKET", ""),
 		`URL to an S3 bucket for storing a information reducing API calls. Defaults to $S3_OBJECT_CLEANUP_PERSISTENCE_BUCKET.`)
+
+	flag.BoolVar(&p.persistenceAccelerate, "persistence_accelerate",
+		env.MustGetBool("S3_OBJECT_CLEANUP_PERSISTENCE_ACCELERATE", false),
+		"Access the persistence bucket via S3 Transfer Acceleration, speeding up state transfers when the bucket is far from the runner. Acceleration must be enabled on the bucket. Not supported for buckets given as URL. Defaults to $S3_OBJECT_CLEANUP_PERSISTENCE_ACCELERATE.")
+
+	flag.StringVar(&p.stateEncryptionKeyFile, "state_encryption_key_file",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_STATE_ENCRYPTION_KEY_FILE", ""),
+		`File containing a base64-encoded 256-bit key (e.g. from "openssl rand -base64 32") used to encrypt the state stored in the persistence bucket with AES-GCM. Unencrypted state is still read. Defaults to $S3_OBJECT_CLEANUP_STATE_ENCRYPTION_KEY_FILE.`)
+
+	flag.StringVar(&p.persistenceSSE, "persistence_sse",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_PERSISTENCE_SSE", ""),
+		`Server-side encryption for objects written to the persistence bucket ("AES256", "aws:kms" or "aws:kms:dsse"). Uses the bucket default if empty. Defaults to $S3_OBJECT_CLEANUP_PERSISTENCE_SSE.`)
+
+	flag.StringVar(&p.persistenceSSEKMSKeyID, "persistence_sse_kms_key_id",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_PERSISTENCE_SSE_KMS_KEY_ID", ""),
+		`KMS key ID or ARN for encrypting objects written to the persistence bucket. Implies -persistence_sse=aws:kms if no algorithm is given. Defaults to $S3_OBJECT_CLEANUP_PERSISTENCE_SSE_KMS_KEY_ID.`)
+
+	flag.BoolVar(&p.unconditionalState, "unconditional_state_upload",
+		env.MustGetBool("S3_OBJECT_CLEANUP_UNCONDITIONAL_STATE_UPLOAD", false),
+		`Overwrite the state in the persistence bucket even if another run modified it in the meantime. By default the upload fails to avoid losing the other run's changes. Use for S3-compatible services without support for conditional writes. Defaults to $S3_OBJECT_CLEANUP_UNCONDITIONAL_STATE_UPLOAD.`)
+
+	flag.StringVar(&p.maxStateSize, "max_state_size",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_MAX_STATE_SIZE", ""),
+		`Maximum amount of data in the state of a bucket, e.g. "100MiB". When exceeded the least recently modified retention records are removed before persisting the state. Removed records only cost additional API requests on the next run. Disabled if empty. Defaults to $S3_OBJECT_CLEANUP_MAX_STATE_SIZE.`)
+
+	flag.DurationVar(&p.stateCheckpoint, "state_checkpoint_interval",
+		env.MustGetDuration("S3_OBJECT_CLEANUP_STATE_CHECKPOINT_INTERVAL", 0),
+		"Upload the state to the persistence bucket at the given interval while processing a bucket instead of only after finishing it, so a crashed run doesn't lose the information gathered so far. Disabled if zero. Defaults to $S3_OBJECT_CLEANUP_STATE_CHECKPOINT_INTERVAL.")
+
+	flag.DurationVar(&p.lockTTL, "lock_ttl",
+		env.MustGetDuration("S3_OBJECT_CLEANUP_LOCK_TTL", 0),
+		"Hold a lock object in the persistence bucket while running so overlapping runs fail instead of cleaning up the same buckets concurrently. The lock is refreshed while running and expires after the given duration if not released, e.g. after a crash. Disabled if zero. Defaults to $S3_OBJECT_CLEANUP_LOCK_TTL.")
+
+	flag.StringVar(&p.approvalToken, "approval_token",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_APPROVAL_TOKEN", ""),
+		`Token approving a run with -dry_run=false. Once an administrator stores the hex-encoded SHA-256 digest of a token in the "`+approvalTokenKey+`" object of the persistence bucket, runs without the matching token fail before processing any bucket. Defaults to $S3_OBJECT_CLEANUP_APPROVAL_TOKEN.`)
+
+	flag.DurationVar(&p.maxClockSkew, "max_clock_skew",
+		env.MustGetDuration("S3_OBJECT_CLEANUP_MAX_CLOCK_SKEW", 0),
+		"Compare the local clock with the Date header of an initial response for each bucket and act according to -clock_skew_action when they differ by more than the given duration (e.g. 1m). Retention and ages are computed from the local time, so a wrong clock silently shortens or extends them. Disabled if zero. Defaults to $S3_OBJECT_CLEANUP_MAX_CLOCK_SKEW.")
+
+	flag.StringVar(&p.clockSkewAction, "clock_skew_action",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_CLOCK_SKEW_ACTION", "abort"),
+		`What to do once -max_clock_skew is exceeded: "abort" the bucket or "adjust" the local time by the skew. Defaults to $S3_OBJECT_CLEANUP_CLOCK_SKEW_ACTION or "abort".`)
+
+	flag.BoolVar(&p.requireReviewedPlan, "require_reviewed_plan",
+		env.MustGetBool("S3_OBJECT_CLEANUP_REQUIRE_REVIEWED_PLAN", false),
+		"Dry runs record their deletions in the state for review. Runs with -dry_run=false require such a plan and abort a bucket once their deletions deviate from it by more than -max_plan_deviation. A successful run consumes the plan. Defaults to $S3_OBJECT_CLEANUP_REQUIRE_REVIEWED_PLAN.")
+
+	flag.Float64Var(&p.maxPlanDeviation, "max_plan_deviation",
+		env.MustGetFloat("S3_OBJECT_CLEANUP_MAX_PLAN_DEVIATION", 0.05),
+		"Deletions not part of the reviewed plan permitted with -require_reviewed_plan, as a fraction of the reviewed deletions. Versions becoming eligible between the review and the run count as deviations. Defaults to $S3_OBJECT_CLEANUP_MAX_PLAN_DEVIATION.")
+
+	flag.StringVar(&p.planFile, "plan_file",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_PLAN_FILE", ""),
+		`Write the object versions which would be deleted or have their retention extended to a file, or to standard output if "-". Requires -dry_run. Defaults to $S3_OBJECT_CLEANUP_PLAN_FILE.`)
+
+	flag.StringVar(&p.planFormat, "plan_format",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_PLAN_FORMAT", string(cleanup.PlanFormatCSV)),
+		`Format of the plan file, either "csv" or "json". JSON plans follow a versioned schema and include the number of deletions per bucket and in total. Defaults to $S3_OBJECT_CLEANUP_PLAN_FORMAT.`)
+
+	flag.StringVar(&p.actionsNDJSON, "actions_ndjson",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_ACTIONS_NDJSON", ""),
+		`Write every listed, skipped, deleted and extended object version as newline-delimited JSON to a file, or to standard output if "-". Each line carries the action, the reason for skips, deletions and extensions, the error of failed deletions and extensions, and the version attributes, for ingestion into log pipelines such as OpenSearch or Loki. Defaults to $S3_OBJECT_CLEANUP_ACTIONS_NDJSON.`)
+
+	flag.IntVar(&p.largestDeletions, "largest_deletions",
+		env.MustGetInt("S3_OBJECT_CLEANUP_LARGEST_DELETIONS", defaultLargestDeletions),
+		fmt.Sprintf("Number of the largest deleted object versions, or those to be deleted in a dry run, listed with bucket, key, version ID, size and age in the final statistics. Disabled if zero. Defaults to $S3_OBJECT_CLEANUP_LARGEST_DELETIONS or %d.", defaultLargestDeletions))
+
+	flag.StringVar(&p.statsFile, "stats_file",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_STATS_FILE", ""),
+		`Write the final statistics as a JSON document to a file, or to standard output if "-". The document follows a versioned schema independent of the log format and includes the counters of every bucket and the largest deletions, for ingestion by reporting jobs. Defaults to $S3_OBJECT_CLEANUP_STATS_FILE.`)
+
+	flag.BoolVar(&p.traceDecisions, "trace_decisions",
+		env.MustGetBool("S3_OBJECT_CLEANUP_TRACE_DECISIONS", false),
+		"Log the version timeline of every key at debug level, with the action for each version and the rule which decided it, e.g. the minimum age and the time it's reached. Requires -debug to be visible. Defaults to $S3_OBJECT_CLEANUP_TRACE_DECISIONS.")
+
+	flag.StringVar(&p.excludeKeysFile, "exclude_keys_file",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_EXCLUDE_KEYS_FILE", ""),
+		`File or S3 object ("s3://bucket/key") listing object keys which must never be touched, one per line. Entries ending in "*" match key prefixes. May be gzip-compressed. Defaults to $S3_OBJECT_CLEANUP_EXCLUDE_KEYS_FILE.`)
+
+	flag.StringVar(&p.preset, "preset",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_PRESET", ""),
+		fmt.Sprintf(`Comma-separated list of backup repository layouts whose structural keys (e.g. "config", "keys/" and "index/" for restic) must never be touched, at any depth below the bucket. Known presets: %s. Defaults to $S3_OBJECT_CLEANUP_PRESET.`,
+			strings.Join(cleanup.PresetNames(), ", ")))
+
+	flag.StringVar(&p.protectedPrefixes, "protected_prefixes",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_PROTECTED_PREFIXES", ""),
+		`Comma-separated list of key prefixes (e.g. "legal/,audit/") whose object versions are never deleted nor have their retention modified, regardless of any other setting. Counted as "excluded.protected_count" in the statistics. Defaults to $S3_OBJECT_CLEANUP_PROTECTED_PREFIXES.`)
+
+	flag.StringVar(&p.excludeMetadata, "exclude_metadata",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_EXCLUDE_METADATA", ""),
+		`Never delete object versions carrying the given user metadata, specified as "name=value" (e.g. "hold=true" for a "x-amz-meta-hold: true" header) or "name" to match any value. Requires one HeadObject request per expired version. Defaults to $S3_OBJECT_CLEANUP_EXCLUDE_METADATA.`)
+
+	flag.StringVar(&p.onlyKMSKey, "only_kms_key",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_ONLY_KMS_KEY", ""),
+		`Only delete object versions encrypted with the given KMS key, specified as key ARN or key ID. Useful for purging the data protected by a key being decommissioned. Requires one HeadObject request per expired version. Defaults to $S3_OBJECT_CLEANUP_ONLY_KMS_KEY.`)
+
+	flag.StringVar(&p.onlyKeysFile, "only_keys_file",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_ONLY_KEYS_FILE", ""),
+		`File or S3 object ("s3://bucket/key") listing the object keys to process; all other keys are ignored. Same format as -exclude_keys_file. Defaults to $S3_OBJECT_CLEANUP_ONLY_KEYS_FILE.`)
+
+	flag.IntVar(&p.httpMaxIdleConns, "http_max_idle_conns",
+		env.MustGetInt("S3_OBJECT_CLEANUP_HTTP_MAX_IDLE_CONNS", 0),
+		fmt.Sprintf("Maximum number of idle HTTP connections kept open per host for reuse. Raise when running many concurrent workers to avoid repeatedly establishing connections. Uses %d if zero. Defaults to $S3_OBJECT_CLEANUP_HTTP_MAX_IDLE_CONNS.", awshttp.DefaultHTTPTransportMaxIdleConnsPerHost))
+
+	flag.DurationVar(&p.httpConnectTimeout, "http_connect_timeout",
+		env.MustGetDuration("S3_OBJECT_CLEANUP_HTTP_CONNECT_TIMEOUT", 0),
+		fmt.Sprintf("Maximum amount of time for establishing an HTTP connection. Uses %v if zero. Defaults to $S3_OBJECT_CLEANUP_HTTP_CONNECT_TIMEOUT.", awshttp.DefaultDialConnectTimeout))
+
+	flag.DurationVar(&p.httpResponseHeaderTimeout, "http_response_header_timeout",
+		env.MustGetDuration("S3_OBJECT_CLEANUP_HTTP_RESPONSE_HEADER_TIMEOUT", 0),
+		"Maximum amount of time to wait for the response headers after sending an HTTP request. Timed out requests are retried. Unlimited if zero. Defaults to $S3_OBJECT_CLEANUP_HTTP_RESPONSE_HEADER_TIMEOUT.")
+
+	flag.StringVar(&p.dnsServer, "dns_server",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_DNS_SERVER", ""),
+		`DNS server ("host" or "host:port") resolving the endpoints of all AWS requests instead of the system resolver, e.g. in split-horizon DNS environments where the default resolution yields unreachable addresses. Defaults to $S3_OBJECT_CLEANUP_DNS_SERVER.`)
+
+	flag.StringVar(&p.addressFamily, "address_family",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_ADDRESS_FAMILY", "any"),
+		`IP address family used for connections: "any" (in the order returned by the resolver), "ipv4", "ipv6", "prefer_ipv4" or "prefer_ipv6" (falling back to the other family if connecting fails). Defaults to $S3_OBJECT_CLEANUP_ADDRESS_FAMILY or "any".`)
+
+	flag.BoolVar(&p.dualStackEndpoint, "dualstack_endpoint",
+		env.MustGetBool("S3_OBJECT_CLEANUP_DUALSTACK_ENDPOINT", false),
+		"Use the dual-stack S3 endpoints reachable via IPv4 and IPv6, e.g. from IPv6-only networks. Ignored for buckets given as URL. Defaults to $S3_OBJECT_CLEANUP_DUALSTACK_ENDPOINT.")
+
+	flag.BoolVar(&p.fipsEndpoint, "fips_endpoint",
+		env.MustGetBool("S3_OBJECT_CLEANUP_FIPS_ENDPOINT", false),
+		"Use the FIPS 140-validated S3 endpoints, e.g. as required in AWS GovCloud. Ignored for buckets given as URL. Defaults to $S3_OBJECT_CLEANUP_FIPS_ENDPOINT.")
+
+	flag.StringVar(&p.s3Flavor, "s3_flavor",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_S3_FLAVOR", client.FlavorAWS.Name),
+		fmt.Sprintf(`Flavor of the S3 API serving the cleaned up buckets (one of %s). Adapts to the deviations of S3-compatible services, e.g. "b2" treats Object Lock requests rejected by Backblaze B2 like buckets without Object Lock. Defaults to $S3_OBJECT_CLEANUP_S3_FLAVOR or %q.`, strings.Join(client.FlavorNames(), ", "), client.FlavorAWS.Name))
+
+	flag.StringVar(&p.webIdentityTokenFile, "web_identity_token_file",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_WEB_IDENTITY_TOKEN_FILE", ""),
+		"File containing an OIDC token exchanged for credentials of the role given with -web_identity_role_arn, e.g. the projected service account token on Kubernetes or a GitHub Actions ID token. The file is read again on every refresh. Takes precedence over the SDK credential chain, including $AWS_WEB_IDENTITY_TOKEN_FILE. Defaults to $S3_OBJECT_CLEANUP_WEB_IDENTITY_TOKEN_FILE.")
+
+	flag.StringVar(&p.webIdentityRoleARN, "web_identity_role_arn",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_WEB_IDENTITY_ROLE_ARN", ""),
+		"ARN of the role assumed with the token from -web_identity_token_file. Defaults to $S3_OBJECT_CLEANUP_WEB_IDENTITY_ROLE_ARN.")
+
+	flag.StringVar(&p.webIdentitySessionName, "web_identity_session_name",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_WEB_IDENTITY_SESSION_NAME", ""),
+		`Name of the role session, recorded in CloudTrail. Uses "s3-object-cleanup-<run ID>" if empty. Defaults to $S3_OBJECT_CLEANUP_WEB_IDENTITY_SESSION_NAME.`)
+
+	flag.DurationVar(&p.webIdentitySessionDuration, "web_identity_session_duration",
+		env.MustGetDuration("S3_OBJECT_CLEANUP_WEB_IDENTITY_SESSION_DURATION", 0),
+		"Requested lifetime of the role session. Credentials are refreshed before they expire. Uses the STS default of one hour if zero. Defaults to $S3_OBJECT_CLEANUP_WEB_IDENTITY_SESSION_DURATION.")
+
+	flag.StringVar(&p.bucketConfigFile, "bucket_config",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_BUCKET_CONFIG", ""),
+		`JSON file with connection settings per bucket ("endpoint", "region", "path_style", "access_key_id_env", "secret_access_key_env", "session_token_env" and "flavor" below "buckets.<name>"), allowing buckets on different services to be cleaned in one run. All configured buckets are cleaned if none are given as arguments. Defaults to $S3_OBJECT_CLEANUP_BUCKET_CONFIG.`)
+
+	flag.StringVar(&p.rcloneConfigFile, "rclone_config",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_RCLONE_CONFIG", defaultRcloneConfigPath()),
+		`rclone configuration file resolving buckets given as "remote:bucket/prefix". The endpoint, region, path style, credentials and provider of S3 remotes are used. Defaults to $S3_OBJECT_CLEANUP_RCLONE_CONFIG or the rclone default.`)
+
+	flag.StringVar(&p.userAgent, "user_agent",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_USER_AGENT", defaultUserAgent),
+		`Text appended to the User-Agent of all S3 requests, attributing them to this program in CloudTrail or server access logs. "{version}" and "{run_id}" are replaced with the program version and a random identifier of the run. Disabled if empty. Defaults to $S3_OBJECT_CLEANUP_USER_AGENT.`)
+
+	flag.StringVar(&p.sqsQueueURL, "sqs_queue_url",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_SQS_QUEUE_URL", ""),
+		"URL of an SQS queue receiving S3 event notifications for the buckets, directly or via SNS. Only the version series of keys referenced by received events are evaluated instead of listing whole buckets. Messages are deleted once their buckets were processed successfully. Dry runs leave all messages in the queue. Defaults to $S3_OBJECT_CLEANUP_SQS_QUEUE_URL.")
+
+	flag.IntVar(&p.sqsMaxMessages, "sqs_max_messages",
+		env.MustGetInt("S3_OBJECT_CLEANUP_SQS_MAX_MESSAGES", defaultEventQueueMaxMessages),
+		fmt.Sprintf("Maximum number of event messages received from the SQS queue per run. The visibility timeout of the queue must cover the duration of the run. Defaults to $S3_OBJECT_CLEANUP_SQS_MAX_MESSAGES or %d.", defaultEventQueueMaxMessages))
+
+	flag.BoolVar(&p.sqsDiscardUnknown, "sqs_discard_unknown",
+		env.MustGetBool("S3_OBJECT_CLEANUP_SQS_DISCARD_UNKNOWN", false),
+		"Delete event messages referring only to buckets not processed by the run from the SQS queue. By default they are left for other consumers. Defaults to $S3_OBJECT_CLEANUP_SQS_DISCARD_UNKNOWN.")
+
+	flag.StringVar(&p.retryMode, "retry_mode",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_RETRY_MODE", ""),
+		`Retry mode of the SDK for requests to the cleaned up buckets, either "standard" or "adaptive". The latter additionally rate-limits requests on throttling responses. Uses $AWS_RETRY_MODE or "standard" if empty. Defaults to $S3_OBJECT_CLEANUP_RETRY_MODE.`)
+
+	flag.IntVar(&p.retryMaxAttempts, "retry_max_attempts",
+		env.MustGetInt("S3_OBJECT_CLEANUP_RETRY_MAX_ATTEMPTS", 0),
+		fmt.Sprintf("Maximum number of attempts for each request to the cleaned up buckets, including the first. Uses $AWS_MAX_ATTEMPTS or %d if zero. Defaults to $S3_OBJECT_CLEANUP_RETRY_MAX_ATTEMPTS.", retry.DefaultMaxAttempts))
+
+	flag.DurationVar(&p.retryMaxBackoff, "retry_max_backoff",
+		env.MustGetDuration("S3_OBJECT_CLEANUP_RETRY_MAX_BACKOFF", 0),
+		fmt.Sprintf("Maximum delay between attempts of a request to the cleaned up buckets. Uses %v if zero. Defaults to $S3_OBJECT_CLEANUP_RETRY_MAX_BACKOFF.", retry.DefaultMaxBackoff))
+
+	flag.StringVar(&p.shard, "shard",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_SHARD", ""),
+		`Only process the object keys in shard "i/N" (zero-based, e.g. "0/4" to "3/4"). Keys are assigned to shards by hash, allowing N independent instances to divide very large buckets. The state, lock and reports in the persistence bucket are kept per shard; the lock also excludes runs of overlapping shards and runs without sharding. Every instance lists the whole bucket, so only the processing is divided while the listing requests grow with N. Disabled if empty. Defaults to $S3_OBJECT_CLEANUP_SHARD.`)
+
+	flag.IntVar(&p.benchKeys, "bench_keys",
+		env.MustGetInt("S3_OBJECT_CLEANUP_BENCH_KEYS", 10000),
+		"Number of object keys generated by the bench command. Defaults to $S3_OBJECT_CLEANUP_BENCH_KEYS or 10000.")
+
+	flag.IntVar(&p.benchMaxVersions, "bench_max_versions",
+		env.MustGetInt("S3_OBJECT_CLEANUP_BENCH_MAX_VERSIONS", 10),
+		"Maximum number of versions per key generated by the bench command. Defaults to $S3_OBJECT_CLEANUP_BENCH_MAX_VERSIONS or 10.")
+
+	flag.DurationVar(&p.benchLatency, "bench_latency",
+		env.MustGetDuration("S3_OBJECT_CLEANUP_BENCH_LATENCY", 0),
+		"Simulated latency of every request to the fake bucket used by the bench command. Defaults to $S3_OBJECT_CLEANUP_BENCH_LATENCY.")
+
+	flag.IntVar(&p.benchSeed, "bench_seed",
+		env.MustGetInt("S3_OBJECT_CLEANUP_BENCH_SEED", 1),
+		"Seed for generating the object versions of the bench command. Defaults to $S3_OBJECT_CLEANUP_BENCH_SEED or 1.")
+
+	flag.IntVar(&p.trendRuns, "trend_runs",
+		env.MustGetInt("S3_OBJECT_CLEANUP_TREND_RUNS", defaultTrendRuns),
+		fmt.Sprintf("Number of the most recent complete runs shown by the trend command. Defaults to $S3_OBJECT_CLEANUP_TREND_RUNS or %d.", defaultTrendRuns))
+
+	flag.StringVar(&p.syslogAddress, "syslog",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_SYSLOG", ""),
+		`Send log messages to a syslog server instead of standard error, given as URL with the transport as scheme (e.g. "udp://logs.example.com", "tcp://logs.example.com:601" or "tls://logs.example.com:6514"). Messages follow RFC 5424 with the attributes encoded as JSON in the message part. Defaults to $S3_OBJECT_CLEANUP_SYSLOG.`)
+
+	flag.StringVar(&p.syslogFacility, "syslog_facility",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_SYSLOG_FACILITY", "daemon"),
+		`Facility of syslog messages, e.g. "daemon" or "local0". Defaults to $S3_OBJECT_CLEANUP_SYSLOG_FACILITY or "daemon".`)
+
+	flag.BoolVar(&p.journald, "journald",
+		env.MustGetBool("S3_OBJECT_CLEANUP_JOURNALD", journalStreamConnected()),
+		"Send log messages to the systemd journal using its native protocol, keeping attributes such as the bucket, key and version ID as separate fields. Ignored if -syslog is given. Defaults to $S3_OBJECT_CLEANUP_JOURNALD or whether standard error is connected to the journal.")
+
+	flag.StringVar(&p.pprofListen, "pprof_listen",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_PPROF_LISTEN", ""),
+		`Serve the pprof profiling endpoints below "/debug/pprof/" on the given address (e.g. "localhost:6060") while running. Disabled if empty. Defaults to $S3_OBJECT_CLEANUP_PPROF_LISTEN.`)
+
+	flag.StringVar(&p.cpuProfile, "cpuprofile",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_CPUPROFILE", ""),
+		"Write a CPU profile of the whole run to the given file. Defaults to $S3_OBJECT_CLEANUP_CPUPROFILE.")
+
+	flag.StringVar(&p.memProfile, "memprofile",
+		env.GetWithFallback("S3_OBJECT_CLEANUP_MEMPROFILE", ""),
+		"Write a heap profile to the given file at the end of the run. Defaults to $S3_OBJECT_CLEANUP_MEMPROFILE.")
+
+	// Hidden from the usage message as it's only meant for rehearsals.
+	flag.StringVar(&p.chaos, chaosFlagName,
+		env.GetWithFallback("S3_OBJECT_CLEANUP_CHAOS", ""),
+		`Inject faults into S3 requests, e.g. "errors=0.05,latency=0.2,max_latency=2s". Defaults to $S3_OBJECT_CLEANUP_CHAOS.`)
 }
 
-func (p *program) run(ctx context.Context, bucketNames []string) (err error) {
-	cfg, err := config.LoadDefaultConfig(ctx,
+// loadConfig loads the SDK configuration. The flags must have been validated.
+func (p *program) loadConfig(ctx context.Context) (aws.Config, error) {
+	opts := []func(*config.LoadOptions) error{
+		config.WithHTTPClient(newHTTPClient(httpClientOptions{
+			maxIdleConns:          p.httpMaxIdleConns,
+			connectTimeout:        p.httpConnectTimeout,
+			responseHeaderTimeout: p.httpResponseHeaderTimeout,
+			dnsServer:             p.parsed.dnsServer,
+			networks:              p.parsed.networks,
+		})),
 		config.WithLogger(logging.StandardLogger{
 			Logger: slog.NewLogLogger(slog.Default().Handler(), slog.LevelDebug),
 		}),
 		config.WithClientLogMode(
-			aws.LogRequest|aws.LogResponse|aws.LogDeprecatedUsage,
+			aws.LogRequest | aws.LogResponse | aws.LogDeprecatedUsage,
 		),
-	)
+		config.WithCredentialsCacheOptions(setCredentialsCacheOptions),
+	}
+
+	if p.dualStackEndpoint {
+		opts = append(opts, config.WithUseDualStackEndpoint(aws.DualStackEndpointStateEnabled))
+	}
+
+	if p.fipsEndpoint {
+		opts = append(opts, config.WithUseFIPSEndpoint(aws.FIPSEndpointStateEnabled))
+	}
+
+	if p.userAgent != "" {
+		opts = append(opts, config.WithAPIOptions([]func(*middleware.Stack) error{
+			newUserAgentAppender(expandUserAgent(p.userAgent, p.runID)),
+		}))
+	}
 
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
 	if err != nil {
-		return err
+		return aws.Config{}, err
+	}
+
+	p.parsed.webIdentity.apply(&cfg)
+
+	return cfg, nil
+}
+
+// persistenceClient returns a client for the bucket storing the state.
+func (p *program) persistenceClient(cfg aws.Config) (*client.Client, error) {
+	return client.NewFromName(cfg, p.persistenceBucket, func(o *s3.Options) {
+		o.UseAccelerate = p.persistenceAccelerate
+	})
+}
+
+// bucketClients returns the clients of the given buckets, or those of the
+// bucket config file. Buckets are resolved via the bucket config file and the
+// rclone configuration.
+func (p *program) bucketClients(cfg aws.Config, bucketNames []string) ([]*client.Client, error) {
+	var buckets bucketConfigs
+
+	if p.bucketConfigFile != "" {
+		var err error
+
+		if buckets, err = loadBucketConfigs(p.bucketConfigFile); err != nil {
+			return nil, fmt.Errorf("bucket config: %w", err)
+		}
+
+		if len(bucketNames) == 0 {
+			bucketNames = buckets.names()
+		}
 	}
 
 	var clients []*client.Client
+	var remotes rcloneConfig
 
 	for _, i := range bucketNames {
-		c, err := client.NewFromName(cfg, i)
+		name, conf := i, buckets[i]
+
+		if remote, path, ok := parseRcloneSpec(i); ok {
+			var err error
+
+			if remotes == nil {
+				if remotes, err = loadRcloneConfig(p.rcloneConfigFile); err != nil {
+					return nil, fmt.Errorf("rclone config: %w", err)
+				}
+			}
+
+			if name, conf, err = remotes.resolve(remote, path); err != nil {
+				return nil, err
+			}
+		}
+
+		c, err := conf.newClient(cfg, name, p.parsed.flavor, p.parsed.retries.apply)
 		if err != nil {
-			return err
+			return nil, err
+		}
+
+		// State, reports and event messages are associated by name.
+		if slices.ContainsFunc(clients, func(other *client.Client) bool {
+			return other.Name() == c.Name()
+		}) {
+			return nil, fmt.Errorf("%w: bucket %q is given more than once, possibly on different endpoints", os.ErrInvalid, c.Name())
 		}
 
 		clients = append(clients, c)
 	}
 
-	if p.minRetentionThreshold > p.minRetention {
-		return fmt.Errorf("min_retention_threshold (%v) may not exceed min_retention (%v)",
-			p.minRetentionThreshold.String(), p.minRetention.String())
+	return clients, nil
+}
+
+// openActionLog creates the action log. A path of "-" refers to standard
+// output. The returned function flushes the log and closes the file.
+func openActionLog(path string) (*cleanup.ActionLog, func() error, error) {
+	if path == "-" {
+		l := cleanup.NewActionLog(os.Stdout)
+
+		return l, l.Flush, nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	l := cleanup.NewActionLog(f)
+
+	return l, func() error {
+		return errors.Join(l.Flush(), f.Close())
+	}, nil
+}
+
+func (p *program) run(ctx context.Context, bucketNames []string) (err error) {
+	if err := p.validate(slog.Default()); err != nil {
+		return err
+	}
+
+	cfg, err := p.loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	stats := cleanup.NewStats()
+
+	cfg.APIOptions = append(cfg.APIOptions, cleanup.NewRequestCounter(stats.AddAPIRequest))
+
+	if chaos := p.chaosOption(slog.Default()); chaos != nil {
+		cfg.APIOptions = append(cfg.APIOptions, chaos)
+	}
+
+	clients, err := p.bucketClients(cfg, bucketNames)
+	if err != nil {
+		return err
+	}
+
+	shard := p.parsed.shard
+
+	if p.preflight {
+		if err := checkPermissions(ctx, clients, p.dryRun); err != nil {
+			return fmt.Errorf("preflight: %w", err)
+		}
 	}
 
 	tmpdir, err := os.MkdirTemp("", "")
@@ -104,109 +725,449 @@ func (p *program) run(ctx context.Context, bucketNames []string) (err error) {
 		err = errors.Join(err, os.RemoveAll(tmpdir))
 	}()
 
-	var reports *reportGroup
+	var excludeKeys *cleanup.KeyManifest
+
+	if p.excludeKeysFile != "" {
+		if excludeKeys, err = cleanup.LoadKeyManifest(ctx, cfg, tmpdir, p.excludeKeysFile); err != nil {
+			return fmt.Errorf("exclude_keys_file: %w", err)
+		}
+	}
+
+	if p.preset != "" {
+		if excludeKeys == nil {
+			excludeKeys = cleanup.NewKeyManifest()
+		}
+
+		for _, name := range p.parsed.presets {
+			if err := excludeKeys.AddPreset(name); err != nil {
+				return fmt.Errorf("preset: %w", err)
+			}
+		}
+	}
+
+	var protectedPrefixes []string
+
+	for prefix := range strings.SplitSeq(p.protectedPrefixes, ",") {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			protectedPrefixes = append(protectedPrefixes, prefix)
+		}
+	}
+
+	var onlyKeys *cleanup.KeyManifest
+
+	if p.onlyKeysFile != "" {
+		if onlyKeys, err = cleanup.LoadKeyManifest(ctx, cfg, tmpdir, p.onlyKeysFile); err != nil {
+			return fmt.Errorf("only_keys_file: %w", err)
+		}
+	}
+
+	var stateKey *state.EncryptionKey
+
+	if p.stateEncryptionKeyFile != "" {
+		if stateKey, err = state.ReadEncryptionKeyFile(p.stateEncryptionKeyFile); err != nil {
+			return fmt.Errorf("state_encryption_key_file: %w", err)
+		}
+	}
+
+	var reports *cleanup.ReportGroup
+
+	stateOpts := stateManagerOptions{
+		logger:        slog.Default(),
+		tmpdir:        tmpdir,
+		encKey:        stateKey,
+		unconditional: p.unconditionalState,
+		maxSize:       int64(p.parsed.maxStateSize),
+		shard:         shard,
+	}
 
-	var s *state.Store
-	var persistState func(context.Context) error
 	var persistReports func(context.Context) error
 
 	if p.persistenceBucket != "" {
-		const keyState = "state.gz"
-		const keyReports = "reports.tar.gz"
+		const lockKey = "lock.json"
 
-		c, err := client.NewFromName(cfg, p.persistenceBucket)
-		if err != nil {
+		keyReports := shard.ObjectKey("reports.tar.gz")
+		keyLock := shard.ObjectKey(lockKey)
+
+		// Errors are assigned to the named return value for the deferred
+		// lock release to report them.
+		var c *client.Client
+
+		if c, err = p.persistenceClient(cfg); err != nil {
 			return err
 		}
 
-		if s, err = downloadStateFromBucket(ctx, tmpdir, c, keyState); err != nil {
-			slog.Warn("Restoring state failed", slog.Any("error", err))
-			s = nil
+		c.SetUploadEncryption(p.parsed.uploadEncryption)
+
+		if !p.dryRun {
+			if err := checkApproval(ctx, c, approvalTokenKey, p.approvalToken); err != nil {
+				return fmt.Errorf("approval token: %w", err)
+			}
 		}
 
-		persistState = func(ctx context.Context) error {
-			return uploadStateToBucket(ctx, s, tmpdir, c, keyState)
+		if p.lockTTL > 0 {
+			var release func(*error)
+
+			if ctx, release, err = holdRunLock(ctx, runLockOptions{
+				logger: slog.Default(),
+				client: c.S3(),
+				bucket: c.Name(),
+				key:    keyLock,
+				owner:  defaultRunLockOwner(),
+				ttl:    p.lockTTL,
+
+				// Runs of overlapping shards and runs covering
+				// the whole bucket exclude each other.
+				conflictPrefix: shard.ObjectKeyPrefix(lockKey),
+				conflicts: func(key string) bool {
+					return shard.OverlapsObjectKey(lockKey, key)
+				},
+			}); err != nil {
+				return fmt.Errorf("acquiring run lock: %w", err)
+			}
+
+			defer release(&err)
 		}
 
-		reports, err = newReportGroup(tmpdir)
+		stateOpts.client = c
+
+		reports, err = cleanup.NewReportGroup(tmpdir)
 		if err != nil {
 			return fmt.Errorf("report group: %w", err)
 		}
 
 		persistReports = func(ctx context.Context) error {
-			return uploadReportsToBucket(ctx, reports, tmpdir, c, keyReports)
+			return cleanup.UploadReportsToBucket(ctx, reports, tmpdir, c, keyReports)
 		}
 	}
 
-	if s == nil {
-		s, err = state.New(tmpdir)
-		if err != nil {
-			return fmt.Errorf("initializing state: %w", err)
+	states := newStateManager(stateOpts)
+
+	defer func() {
+		err = errors.Join(err, states.release())
+	}()
+
+	var runPlan *cleanup.Plan
+
+	if p.planFile != "" {
+		runPlan = cleanup.NewPlan()
+	}
+
+	var largest *cleanup.LargestDeletions
+
+	if p.largestDeletions > 0 {
+		largest = cleanup.NewLargestDeletions(p.largestDeletions)
+	}
+
+	var actionLog *cleanup.ActionLog
+
+	if p.actionsNDJSON != "" {
+		var closeActionLog func() error
+
+		if actionLog, closeActionLog, err = openActionLog(p.actionsNDJSON); err != nil {
+			return fmt.Errorf("actions_ndjson: %w", err)
 		}
+
+		defer func() {
+			if closeErr := closeActionLog(); closeErr != nil {
+				err = errors.Join(err, fmt.Errorf("actions_ndjson: %w", closeErr))
+			}
+		}()
 	}
 
-	stats := newCleanupStats()
+	// Number of errors by class for each bucket.
+	var bucketErrorAttrs []any
+
+	runStartedAt := time.Now()
+	bucketStats := map[string]cleanup.StatsBucket{}
+
+	// Statistics and state are still written after a termination signal.
+	shutdown := newShutdownHandler(ctx)
+	shutdown.notify()
+
+	defer shutdown.close()
 
 	defer func() {
 		attrs := []any{
 			slog.Bool("dry_run", p.dryRun),
+			slog.Bool("interrupted", shutdown.requested()),
+		}
+		attrs = append(attrs, stats.Attrs()...)
+		attrs = append(attrs, slog.Group("bucket_errors", bucketErrorAttrs...))
+
+		if largest != nil {
+			attrs = append(attrs, slog.Any("largest_deletions", largest))
 		}
-		attrs = append(attrs, stats.attrs()...)
 
 		slog.InfoContext(ctx, "Statistics", attrs...)
+
+		if p.statsFile != "" {
+			if statsErr := stats.WriteFile(p.statsFile, cleanup.StatsRun{
+				RunID:            p.runID,
+				DryRun:           p.dryRun,
+				Interrupted:      shutdown.requested(),
+				StartedAt:        runStartedAt,
+				FinishedAt:       time.Now(),
+				Buckets:          bucketStats,
+				LargestDeletions: largest,
+			}); statsErr != nil {
+				err = errors.Join(err, fmt.Errorf("stats_file: %w", statsErr))
+			}
+		}
 	}()
 
-	cleanupCtx := ctx
+	cleanupCtx := shutdown.context()
 
 	if p.timeout > 0 {
 		var cancel context.CancelFunc
 
-		cleanupCtx, cancel = context.WithTimeout(ctx, p.timeout)
+		cleanupCtx, cancel = context.WithTimeout(cleanupCtx, p.timeout)
 
 		defer cancel()
 	}
 
+	var listDeadline time.Time
+
+	if p.maxRuntime > 0 {
+		listDeadline = time.Now().Add(p.maxRuntime)
+	}
+
+	creds, err := inspectCredentials(ctx, cfg)
+	if err != nil {
+		// Buckets may be configured with their own credentials.
+		slog.DebugContext(ctx, "Inspecting default credentials failed", slog.Any("error", err))
+	} else if !creds.end.IsZero() {
+		// Stop listing in time for the remaining work to finish before the
+		// credentials can't be refreshed anymore. The next run resumes
+		// from the stored listing position.
+		listDeadline = creds.listDeadline(listDeadline)
+
+		slog.InfoContext(ctx, "Credentials can't be refreshed after the end of the SSO session",
+			slog.Time("session_end", creds.end),
+			slog.Duration("remaining", time.Until(creds.end)),
+			slog.Time("list_deadline", listDeadline))
+	}
+
+	var events *eventBatch
+	var queue *eventQueue
+
+	if p.sqsQueueURL != "" {
+		var names []string
+
+		for _, c := range clients {
+			names = append(names, c.Name())
+		}
+
+		queue = newEventQueue(eventQueueOptions{
+			logger:         slog.Default(),
+			client:         sqs.NewFromConfig(cfg),
+			url:            p.sqsQueueURL,
+			maxMessages:    p.sqsMaxMessages,
+			discardUnknown: p.sqsDiscardUnknown,
+			dryRun:         p.dryRun,
+		})
+
+		if events, err = queue.receive(ctx, names); err != nil {
+			return fmt.Errorf("event queue: %w", err)
+		}
+
+		slog.InfoContext(ctx, "Received event messages", slog.Int("count", len(events.messages)))
+	}
+
 	var bucketErrors []error
 
+	// Buckets processed without errors.
+	done := map[string]bool{}
+
 	for _, c := range clients {
 		logger := slog.With(slog.String("bucket", c.Name()))
 
-		opts := cleanupOptions{
-			logger:                logger,
-			stats:                 stats,
-			state:                 s,
-			client:                c,
-			dryRun:                p.dryRun,
-			minDeletionAge:        p.minDeletionAge,
-			minRetention:          p.minRetention,
-			minRetentionThreshold: p.minRetentionThreshold,
+		if !listDeadline.IsZero() && !time.Now().Before(listDeadline) {
+			logger.Warn("Skipping bucket after reaching runtime limit")
+			continue
+		}
+
+		if shutdown.requested() {
+			logger.Warn("Skipping bucket after shutdown request")
+			continue
+		}
+
+		var keys []string
+
+		if events != nil {
+			if keys = events.bucketKeys(c.Name()); len(keys) == 0 {
+				continue
+			}
+		}
+
+		errorCount := len(bucketErrors)
+
+		// Counters of this bucket alone, including its API requests. They're
+		// added to the run statistics once the bucket is done.
+		bucketRunStats := cleanup.NewStats()
+		bucketCtx := cleanup.WithRequestStats(ctx, bucketRunStats)
+
+		bucketState, err := states.open(bucketCtx, c.Name(), bucketRunStats)
+		if err != nil {
+			logger.Error("Opening state failed", slog.Any("error", err))
+
+			stats.Merge(bucketRunStats)
+			bucketErrors = append(bucketErrors, fmt.Errorf("%s: %w", c.Name(), err))
+			continue
+		}
+
+		if !creds.end.IsZero() {
+			if history, err := bucketRunStatsHistory(bucketState.store, c.Name()); err != nil {
+				logger.Warn("Reading statistics history failed", slog.Any("error", err))
+			} else {
+				creds.checkRunDuration(logger, history, time.Now())
+			}
+		}
+
+		opts := cleanup.Options{
+			Logger:                logger,
+			Stats:                 bucketRunStats,
+			State:                 bucketState.store,
+			Client:                c,
+			DryRun:                p.dryRun,
+			ExcludeKeys:           excludeKeys,
+			ProtectedPrefixes:     protectedPrefixes,
+			OnlyKeys:              onlyKeys,
+			Keys:                  keys,
+			Shard:                 shard,
+			MaxDeleteRate:         p.maxDeleteRate,
+			MaxErrorRatio:         p.maxErrorRatio,
+			MaxDeleteFraction:     p.maxDeleteFraction,
+			DeleteFractionDryRun:  p.parsed.deleteFractionDryRun,
+			RequireReviewedPlan:   p.requireReviewedPlan,
+			MaxPlanDeviation:      p.maxPlanDeviation,
+			MaxClockSkew:          p.maxClockSkew,
+			AdjustClockSkew:       p.parsed.adjustClockSkew,
+			MinDeletionAge:        p.minDeletionAge,
+			MinRetention:          p.minRetention,
+			MinRetentionThreshold: p.minRetentionThreshold,
+			RetentionJitter:       p.retentionJitter,
+			Seed:                  p.seed,
+			MaxRetentionHorizon:   p.maxRetentionHorizon,
+			ClampRetentionHorizon: p.parsed.clampRetentionHorizon,
+			MaxNoncurrentVersions: p.maxNoncurrentVersions,
+			MinSurvivingVersions:  p.minSurvivingVersions,
+			AgeFromNoncurrent:     p.ageFromNoncurrent,
+			ExpireUnversioned:     p.expireUnversioned,
+			DeleteMarkers:         p.parsed.deleteMarkers,
+			TraceDecisions:        p.traceDecisions,
+			AllowUnlocked:         p.allowUnlockedBuckets,
+			ProbePermissions:      p.preflight,
+			ListDeadline:          listDeadline,
+			Stop:                  shutdown.stopped(),
+			QuarantinePeriod:      p.quarantinePeriod,
+			ExcludeMetadata:       p.parsed.excludeMetadata,
+			OnlyKMSKey:            cleanup.NewKMSKeyMatcher(p.onlyKMSKey),
+
+			ListCheckpointInterval: p.listCheckpointInterval,
+			ListPageSize:           int32(p.listPageSize),
+			ListPageRetries:        p.listPageRetries,
+			ChannelCapacity:        p.channelCapacity,
+			Inventory:              p.inventory,
+			StateRecordTTL:         p.stateRecordTTL,
+			Incremental:            p.incremental,
+			DeleteAuditTTL:         p.deleteAuditTTL,
+			VersionFilter:          p.stateFilter,
+			RetentionViaHead:       p.retentionViaHead,
+			MaxWorkers:             p.maxWorkers,
+			ProgressInterval:       p.progressInterval,
+		}
+
+		if p.spillVersions {
+			opts.SpillDir = tmpdir
 		}
 
 		if reports != nil {
-			opts.report = newReportBuilder()
+			opts.Report = cleanup.NewReportBuilder()
+		}
+
+		if runPlan != nil {
+			opts.Plan = runPlan.ForBucket(c.Name())
+		}
+
+		if actionLog != nil {
+			opts.Actions = actionLog.ForBucket(c.Name())
+		}
+
+		if largest != nil {
+			opts.LargestDeletions = largest.ForBucket(c.Name())
+		}
+
+		startedAt := time.Now()
+
+		stopCheckpoints := states.checkpoint(bucketCtx, bucketState, p.stateCheckpoint)
+
+		cleanupErr := cleanup.Run(cleanup.WithRequestStats(cleanupCtx, bucketRunStats), opts)
+
+		stopCheckpoints()
+		if cleanupErr != nil {
+			logger.Error("Cleanup failed", slog.Any("error", cleanupErr))
+
+			bucketErrors = append(bucketErrors, fmt.Errorf("%s: %w", c.Name(), cleanupErr))
 		}
 
-		if err := cleanup(cleanupCtx, opts); err != nil {
-			logger.Error("Cleanup failed", slog.Any("error", err))
+		finishedAt := time.Now()
+
+		// The history is recorded once the state counters are final. Only
+		// the size of the snapshot containing the record is missing.
+		if err := states.close(bucketCtx, bucketState, func(s *state.Store) {
+			if err := recordRunStats(s, c.Name(), state.RunStats{
+				StartedAt:  startedAt,
+				FinishedAt: finishedAt,
+				DryRun:     p.dryRun,
+				Failed:     cleanupErr != nil,
+				Complete:   cleanupErr == nil && bucketRunStats.Complete(),
+				Counters:   bucketRunStats.Counters(),
+			}); err != nil {
+				logger.Error("Recording statistics failed", slog.Any("error", err))
+			}
+		}); err != nil {
+			logger.Error("Closing state failed", slog.Any("error", err))
 
 			bucketErrors = append(bucketErrors, fmt.Errorf("%s: %w", c.Name(), err))
 		}
 
+		stats.Merge(bucketRunStats)
+
+		counters := bucketRunStats.Counters()
+
+		if errorAttrs := cleanup.ErrorAttrs(counters); len(errorAttrs) > 0 {
+			bucketErrorAttrs = append(bucketErrorAttrs, slog.Group(c.Name(), errorAttrs...))
+		}
+
+		bucketStats[c.Name()] = cleanup.StatsBucket{
+			StartedAt:  startedAt,
+			FinishedAt: finishedAt,
+			Failed:     cleanupErr != nil,
+			Counters:   counters,
+		}
+
 		if reports != nil {
-			if err := reports.add(c.Name(), opts.report); err != nil {
+			if err := reports.Add(c.Name(), opts.Report); err != nil {
 				bucketErrors = append(bucketErrors, fmt.Errorf("%s: %w", c.Name(), err))
 			}
 
-			opts.report = nil
+			opts.Report = nil
 		}
 
+		done[c.Name()] = len(bucketErrors) == errorCount
+
 		// There may be plenty of unreferenced allocations.
 		runtime.GC()
+
+		if errors.Is(cleanupErr, cleanup.ErrErrorRatioExceeded) {
+			slog.Error("Skipping remaining buckets due to excessive errors")
+			break
+		}
 	}
 
-	if persistState != nil {
-		if err := persistState(ctx); err != nil {
-			bucketErrors = append(bucketErrors, fmt.Errorf("persisting state: %w", err))
+	if runPlan != nil {
+		if err := runPlan.WriteFile(p.planFile, p.parsed.planFormat); err != nil {
+			bucketErrors = append(bucketErrors, fmt.Errorf("writing plan: %w", err))
 		}
 	}
 
@@ -216,6 +1177,17 @@ func (p *program) run(ctx context.Context, bucketNames []string) (err error) {
 		}
 	}
 
+	// Events are kept until the deletions have actually been made.
+	if events != nil {
+		if err := queue.delete(ctx, events.completed(done)); err != nil {
+			bucketErrors = append(bucketErrors, fmt.Errorf("event queue: %w", err))
+		}
+	}
+
+	if shutdown.requested() {
+		bucketErrors = append(bucketErrors, errShutdown)
+	}
+
 	return errors.Join(bucketErrors...)
 }
 
@@ -224,12 +1196,32 @@ func main() {
 		w := flag.CommandLine.Output()
 
 		fmt.Fprintf(w, "Usage: %s [bucket...]\n", os.Args[0])
+		fmt.Fprintf(w, "       %s stats history [bucket...]\n", os.Args[0])
+		fmt.Fprintf(w, "       %s stats deletions [bucket...]\n", os.Args[0])
+		fmt.Fprintf(w, "       %s trend [bucket...]\n", os.Args[0])
+		fmt.Fprintf(w, "       %s bench\n", os.Args[0])
 		fmt.Fprintln(w, `
 Remove non-current object versions from S3 buckets. Buckets may be specified as
-arguments and via $S3_OBJECT_CLEANUP_BUCKETS (separated by whitespace).
+arguments and via $S3_OBJECT_CLEANUP_BUCKETS (separated by whitespace), either
+by name, as ARN, as URL of an S3-compatible endpoint or as rclone remote
+("remote:bucket/prefix").
+
+The "stats history" command prints the statistics of previous runs recorded in
+the state stored in the persistence bucket.
+
+The "stats deletions" command prints the deletion outcomes recorded in the
+persisted state when -delete_audit_ttl is set.
+
+The "trend" command prints the total and noncurrent size of each bucket over
+the last complete runs recorded in the state, showing whether the cleanup
+curbs the growth of the buckets.
+
+The "bench" command runs the cleanup against an in-process fake bucket filled
+with synthetic object versions and reports the throughput. Most cleanup flags
+apply; deletions only affect the fake bucket.
 
 Flags:`)
-		flag.PrintDefaults()
+		printVisibleDefaults(flag.CommandLine, chaosFlagName)
 	}
 
 	debug := flag.Bool("debug", false, "Enable debug logging.")
@@ -251,12 +1243,72 @@ Flags:`)
 		logLevel.Set(slog.LevelDebug)
 	}
 
+	if p.syslogAddress != "" {
+		handler, err := p.newSyslogHandler(&logLevel)
+		if err != nil {
+			log.Fatalf("Error: syslog: %v", err)
+		}
+
+		slog.SetDefault(slog.New(handler))
+	} else if p.journald {
+		handler, err := newJournaldHandler(journaldHandlerOptions{
+			level:      &logLevel,
+			identifier: "s3-object-cleanup",
+		})
+		if err != nil {
+			slog.Warn("Connecting to journal failed, logging to standard error", slog.Any("error", err))
+		} else {
+			slog.SetDefault(slog.New(handler))
+		}
+	}
+
 	logBuildInfo(slog.Default())
 
+	p.runID = newRunID()
+
+	if p.seed == 0 {
+		p.seed = newSeed()
+	}
+
+	slog.Info("Starting run", slog.String("run_id", p.runID), slog.Uint64("seed", p.seed))
+
+	args := flag.Args()
+	run := p.run
+
+	switch {
+	case len(args) >= 2 && args[0] == "stats" && args[1] == "history":
+		args = args[2:]
+		run = p.statsHistory
+
+	case len(args) >= 2 && args[0] == "stats" && args[1] == "deletions":
+		args = args[2:]
+		run = p.statsDeletions
+
+	case len(args) >= 1 && args[0] == "trend":
+		args = args[1:]
+		run = p.statsTrend
+
+	case len(args) >= 1 && args[0] == "bench":
+		args = args[1:]
+		run = p.bench
+	}
+
 	buckets := strings.Fields(os.Getenv("S3_OBJECT_CLEANUP_BUCKETS"))
-	buckets = append(buckets, flag.Args()...)
+	buckets = append(buckets, args...)
+
+	prof, err := newProfiler(profilerOptions{
+		listen:     p.pprofListen,
+		cpuProfile: p.cpuProfile,
+		memProfile: p.memProfile,
+	})
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
 
-	if err := p.run(context.Background(), buckets); err != nil {
+	err = run(context.Background(), buckets)
+	err = errors.Join(err, prof.stop())
+
+	if err != nil {
 		log.Fatalf("Error: %v", err)
 	}
 }
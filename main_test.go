@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/google/go-cmp/cmp"
+	"github.com/hansmi/s3-object-cleanup/internal/client"
+)
+
+func TestPersistenceClient(t *testing.T) {
+	for _, accelerate := range []bool{false, true} {
+		p := program{
+			persistenceBucket:     "state",
+			persistenceAccelerate: accelerate,
+		}
+
+		c, err := p.persistenceClient(aws.Config{})
+		if err != nil {
+			t.Fatalf("persistenceClient() failed: %v", err)
+		}
+
+		if got := c.S3().Options().UseAccelerate; got != accelerate {
+			t.Errorf("UseAccelerate = %t, want %t", got, accelerate)
+		}
+	}
+}
+
+func TestBucketClients(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rclone.conf")
+
+	if err := os.WriteFile(path, []byte(testRcloneConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p := program{rcloneConfigFile: path}
+	p.parsed.flavor = client.FlavorAWS
+
+	clients, err := p.bucketClients(aws.Config{}, []string{"minio:data/backups", "plain"})
+	if err != nil {
+		t.Fatalf("bucketClients() failed: %v", err)
+	}
+
+	var got []string
+
+	for _, c := range clients {
+		got = append(got, c.Name()+" "+c.Flavor().Name+" "+c.Prefix())
+	}
+
+	if diff := cmp.Diff([]string{"data minio backups", "plain aws "}, got); diff != "" {
+		t.Errorf("Clients diff (-want +got):\n%s", diff)
+	}
+
+	if _, err := p.bucketClients(aws.Config{}, []string{"bucket", "public:bucket"}); !errors.Is(err, os.ErrInvalid) {
+		t.Errorf("bucketClients() with a repeated bucket returned %v, want %v", err, os.ErrInvalid)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/hansmi/s3-object-cleanup/cleanup"
+	"github.com/hansmi/s3-object-cleanup/internal/client"
+)
+
+// checkPermissions probes the permissions of all buckets before processing
+// starts. Missing permissions would otherwise only show up as errors for
+// every affected object version, possibly hours into a run.
+func checkPermissions(ctx context.Context, clients []*client.Client, dryRun bool) error {
+	var errs []error
+
+	for _, c := range clients {
+		logger := slog.With(slog.String("bucket", c.Name()))
+
+		if err := cleanup.CheckPermissions(ctx, logger, c, dryRun); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.Name(), err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/hansmi/s3-object-cleanup/cleanup"
+	"github.com/hansmi/s3-object-cleanup/internal/client"
+	"github.com/hansmi/s3-object-cleanup/internal/fakes3"
+)
+
+func newPreflightClientForTest(t *testing.T, bucket string, deny ...string) *client.Client {
+	t.Helper()
+
+	server := httptest.NewServer(fakes3.New(fakes3.Options{
+		Bucket: bucket,
+		Deny:   deny,
+	}))
+	t.Cleanup(server.Close)
+
+	c, err := client.NewFromName(aws.Config{
+		Region:      "us-east-1",
+		Credentials: aws.AnonymousCredentials{},
+	}, server.URL+"/"+bucket)
+	if err != nil {
+		t.Fatalf("NewFromName() failed: %v", err)
+	}
+
+	return c
+}
+
+func TestCheckPermissions(t *testing.T) {
+	clients := []*client.Client{
+		newPreflightClientForTest(t, "first"),
+	}
+
+	if err := checkPermissions(t.Context(), clients, false); err != nil {
+		t.Errorf("checkPermissions() failed: %v", err)
+	}
+
+	clients = append(clients, newPreflightClientForTest(t, "second", "ListObjectVersions", "PutObjectRetention"))
+
+	// Retention extensions aren't probed in dry runs.
+	err := checkPermissions(t.Context(), clients, true)
+
+	if !errors.Is(err, cleanup.ErrPermissionDenied) {
+		t.Errorf("checkPermissions() returned %v, want %v", err, cleanup.ErrPermissionDenied)
+	} else if msg := err.Error(); !strings.Contains(msg, "second: ") || !strings.Contains(msg, "s3:ListBucketVersions") || strings.Contains(msg, "s3:PutObjectRetention") {
+		t.Errorf("checkPermissions() returned unexpected error: %v", err)
+	}
+
+	if err := checkPermissions(t.Context(), clients[1:], false); err == nil || !strings.Contains(err.Error(), "s3:PutObjectRetention") {
+		t.Errorf("checkPermissions() returned %v, want denied retention extension", err)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	runtimepprof "runtime/pprof"
+)
+
+type profilerOptions struct {
+	logger *slog.Logger
+
+	// Address for serving the pprof endpoints, e.g. "localhost:6060".
+	// Disabled if empty.
+	listen string
+
+	// Write a CPU profile covering the whole run to the given file. Disabled
+	// if empty.
+	cpuProfile string
+
+	// Write a heap profile to the given file when stopping. Disabled if
+	// empty.
+	memProfile string
+}
+
+type profiler struct {
+	logger     *slog.Logger
+	server     *http.Server
+	addr       net.Addr
+	cpuFile    *os.File
+	memProfile string
+}
+
+func newProfiler(opts profilerOptions) (_ *profiler, err error) {
+	if opts.logger == nil {
+		opts.logger = slog.Default()
+	}
+
+	p := &profiler{
+		logger:     opts.logger,
+		memProfile: opts.memProfile,
+	}
+
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, p.stop())
+		}
+	}()
+
+	if opts.cpuProfile != "" {
+		f, err := os.Create(opts.cpuProfile)
+		if err != nil {
+			return nil, fmt.Errorf("CPU profile: %w", err)
+		}
+
+		if err := runtimepprof.StartCPUProfile(f); err != nil {
+			return nil, errors.Join(fmt.Errorf("CPU profile: %w", err), f.Close())
+		}
+
+		p.cpuFile = f
+	}
+
+	if opts.listen != "" {
+		listener, err := net.Listen("tcp", opts.listen)
+		if err != nil {
+			return nil, fmt.Errorf("pprof listener: %w", err)
+		}
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+		p.server = &http.Server{Handler: mux}
+		p.addr = listener.Addr()
+
+		go func() {
+			if err := p.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				p.logger.Error("Serving pprof endpoints failed", slog.Any("error", err))
+			}
+		}()
+
+		p.logger.Info("Serving pprof endpoints", slog.String("address", p.addr.String()))
+	}
+
+	return p, nil
+}
+
+// stop shuts down the endpoints and writes the profiles.
+func (p *profiler) stop() error {
+	var err error
+
+	if p.server != nil {
+		err = errors.Join(err, p.server.Close())
+		p.server = nil
+	}
+
+	if p.cpuFile != nil {
+		runtimepprof.StopCPUProfile()
+
+		if closeErr := p.cpuFile.Close(); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("CPU profile: %w", closeErr))
+		}
+
+		p.cpuFile = nil
+	}
+
+	if p.memProfile != "" {
+		if writeErr := writeHeapProfile(p.memProfile); writeErr != nil {
+			err = errors.Join(err, fmt.Errorf("heap profile: %w", writeErr))
+		}
+
+		p.memProfile = ""
+	}
+
+	return err
+}
+
+func writeHeapProfile(path string) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err = errors.Join(err, f.Close())
+	}()
+
+	// Get up-to-date statistics.
+	runtime.GC()
+
+	return runtimepprof.WriteHeapProfile(f)
+}
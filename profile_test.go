@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProfiler(t *testing.T) {
+	tmpdir := t.TempDir()
+
+	cpuProfile := filepath.Join(tmpdir, "cpu.pprof")
+	memProfile := filepath.Join(tmpdir, "mem.pprof")
+
+	p, err := newProfiler(profilerOptions{
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		listen:     "127.0.0.1:0",
+		cpuProfile: cpuProfile,
+		memProfile: memProfile,
+	})
+	if err != nil {
+		t.Fatalf("newProfiler() failed: %v", err)
+	}
+
+	resp, err := http.Get("http://" + p.addr.String() + "/debug/pprof/")
+	if err != nil {
+		t.Errorf("Get() failed: %v", err)
+	} else {
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Index returned status %d", resp.StatusCode)
+		}
+	}
+
+	if err := p.stop(); err != nil {
+		t.Errorf("stop() failed: %v", err)
+	}
+
+	for _, path := range []string{cpuProfile, memProfile} {
+		if fi, err := os.Stat(path); err != nil {
+			t.Errorf("Stat() failed: %v", err)
+		} else if fi.Size() == 0 {
+			t.Errorf("Profile %s is empty", path)
+		}
+	}
+}
+
+func TestProfilerDisabled(t *testing.T) {
+	p, err := newProfiler(profilerOptions{})
+	if err != nil {
+		t.Fatalf("newProfiler() failed: %v", err)
+	}
+
+	if p.addr != nil {
+		t.Errorf("Listening on %v without address", p.addr)
+	}
+
+	if err := p.stop(); err != nil {
+		t.Errorf("stop() failed: %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/hansmi/s3-object-cleanup/internal/client"
+)
+
+// defaultRcloneConfigPath returns the location of the rclone configuration
+// file as determined by rclone itself on Unix-like systems.
+func defaultRcloneConfigPath() string {
+	if path := os.Getenv("RCLONE_CONFIG"); path != "" {
+		return path
+	}
+
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "rclone", "rclone.conf")
+	}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config", "rclone", "rclone.conf")
+	}
+
+	return ""
+}
+
+// parseRcloneSpec splits a bucket specification of the form
+// "remote:bucket/prefix". URLs are not rclone specifications.
+func parseRcloneSpec(spec string) (remote, path string, ok bool) {
+	if strings.Contains(spec, "://") || strings.HasPrefix(spec, "arn:") {
+		return "", "", false
+	}
+
+	remote, path, ok = strings.Cut(spec, ":")
+	if !ok {
+		return "", "", false
+	}
+
+	return remote, path, true
+}
+
+// rcloneRemote is a section of an rclone configuration file.
+type rcloneRemote map[string]string
+
+func (r rcloneRemote) boolValue(name string, def bool) (bool, error) {
+	value, ok := r[name]
+	if !ok || value == "" {
+		return def, nil
+	}
+
+	result, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return result, nil
+}
+
+// bucketConfig translates the settings of an S3 remote. Buckets with a prefix
+// on AWS S3 are addressed via the regional endpoint as only URLs can carry a
+// prefix.
+func (r rcloneRemote) bucketConfig(path string) (bucketConfig, error) {
+	if r["type"] != "s3" {
+		return bucketConfig{}, fmt.Errorf("%w: unsupported remote type %q", os.ErrInvalid, r["type"])
+	}
+
+	provider := r["provider"]
+
+	result := bucketConfig{
+		Endpoint: r["endpoint"],
+		Region:   r["region"],
+	}
+
+	// Like rclone, path-style requests are the default for all providers
+	// except AWS.
+	var err error
+
+	if result.PathStyle, err = r.boolValue("force_path_style", !strings.EqualFold(provider, "AWS")); err != nil {
+		return bucketConfig{}, err
+	}
+
+	if result.Endpoint != "" && !strings.Contains(result.Endpoint, "://") {
+		result.Endpoint = "https://" + result.Endpoint
+	}
+
+	if result.Endpoint == "" && strings.Contains(strings.Trim(path, "/"), "/") {
+		result.Endpoint = "https://s3." + cmp.Or(result.Region, "us-east-1") + ".amazonaws.com"
+		result.PathStyle = false
+	}
+
+	switch {
+	case strings.EqualFold(provider, "Minio"):
+		result.Flavor = client.FlavorMinIO.Name
+	case strings.EqualFold(provider, "Ceph"):
+		result.Flavor = client.FlavorCeph.Name
+	}
+
+	envAuth, err := r.boolValue("env_auth", false)
+	if err != nil {
+		return bucketConfig{}, err
+	}
+
+	switch {
+	case r["access_key_id"] != "" || r["secret_access_key"] != "":
+		result.credentialsProvider = aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(
+			r["access_key_id"], r["secret_access_key"], r["session_token"]))
+	case !envAuth:
+		// Without credentials rclone makes anonymous requests.
+		result.credentialsProvider = aws.AnonymousCredentials{}
+	}
+
+	if err := result.validate(); err != nil {
+		return bucketConfig{}, err
+	}
+
+	return result, nil
+}
+
+// rcloneConfig maps remote names to their settings.
+type rcloneConfig map[string]rcloneRemote
+
+// parseRcloneConfig reads the INI-style configuration file of rclone.
+func parseRcloneConfig(r io.Reader) (rcloneConfig, error) {
+	result := rcloneConfig{}
+
+	var section rcloneRemote
+
+	scanner := bufio.NewScanner(r)
+
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+			continue
+
+		case strings.HasPrefix(line, "RCLONE_ENCRYPT_"):
+			return nil, fmt.Errorf("%w: encrypted configurations are not supported", os.ErrInvalid)
+
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			name := strings.TrimSpace(line[1 : len(line)-1])
+
+			section = rcloneRemote{}
+			result[name] = section
+
+		default:
+			name, value, found := strings.Cut(line, "=")
+			if !found || section == nil {
+				return nil, fmt.Errorf("%w: line %d: expected section or key-value pair", os.ErrInvalid, lineno)
+			}
+
+			section[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func loadRcloneConfig(path string) (rcloneConfig, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer fh.Close()
+
+	result, err := parseRcloneConfig(fh)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return result, nil
+}
+
+// resolve returns the bucket name with prefix and the connection settings of
+// a "remote:bucket/prefix" specification.
+func (c rcloneConfig) resolve(remote, path string) (string, bucketConfig, error) {
+	r, ok := c[remote]
+	if !ok {
+		return "", bucketConfig{}, fmt.Errorf("%w: rclone remote %q not found", os.ErrNotExist, remote)
+	}
+
+	path = strings.Trim(path, "/")
+
+	if path == "" {
+		return "", bucketConfig{}, fmt.Errorf("%w: rclone remote %q: missing bucket name", os.ErrInvalid, remote)
+	}
+
+	conf, err := r.bucketConfig(path)
+	if err != nil {
+		return "", bucketConfig{}, fmt.Errorf("rclone remote %q: %w", remote, err)
+	}
+
+	return path, conf, nil
+}
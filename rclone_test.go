@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/hansmi/s3-object-cleanup/internal/client"
+)
+
+const testRcloneConfig = `# Comment
+[aws]
+type = s3
+provider = AWS
+env_auth = true
+region = eu-west-1
+
+[minio]
+type = s3
+provider = Minio
+access_key_id = id
+secret_access_key = secret
+endpoint = http://localhost:9000
+
+; Another comment
+[public]
+type = s3
+provider = Other
+endpoint = s3.example.com
+force_path_style = false
+
+[drive]
+type = drive
+`
+
+func TestParseRcloneSpec(t *testing.T) {
+	for _, tc := range []struct {
+		spec       string
+		wantRemote string
+		wantPath   string
+		wantOK     bool
+	}{
+		{spec: "bucket"},
+		{spec: "https://s3.example.com/bucket"},
+		{spec: "arn:aws:s3:::bucket"},
+		{spec: "remote:bucket", wantRemote: "remote", wantPath: "bucket", wantOK: true},
+		{spec: "remote:bucket/a/b", wantRemote: "remote", wantPath: "bucket/a/b", wantOK: true},
+	} {
+		remote, path, ok := parseRcloneSpec(tc.spec)
+
+		if remote != tc.wantRemote || path != tc.wantPath || ok != tc.wantOK {
+			t.Errorf("parseRcloneSpec(%q) = (%q, %q, %t), want (%q, %q, %t)",
+				tc.spec, remote, path, ok, tc.wantRemote, tc.wantPath, tc.wantOK)
+		}
+	}
+}
+
+func TestParseRcloneConfig(t *testing.T) {
+	got, err := parseRcloneConfig(strings.NewReader(testRcloneConfig))
+	if err != nil {
+		t.Fatalf("parseRcloneConfig() failed: %v", err)
+	}
+
+	want := rcloneConfig{
+		"aws":    {"type": "s3", "provider": "AWS", "env_auth": "true", "region": "eu-west-1"},
+		"minio":  {"type": "s3", "provider": "Minio", "access_key_id": "id", "secret_access_key": "secret", "endpoint": "http://localhost:9000"},
+		"public": {"type": "s3", "provider": "Other", "endpoint": "s3.example.com", "force_path_style": "false"},
+		"drive":  {"type": "drive"},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Config diff (-want +got):\n%s", diff)
+	}
+
+	for _, input := range []string{
+		"key = value\n",
+		"[remote]\nno separator\n",
+		"RCLONE_ENCRYPT_V0:\nabcdef\n",
+	} {
+		if _, err := parseRcloneConfig(strings.NewReader(input)); !errors.Is(err, os.ErrInvalid) {
+			t.Errorf("parseRcloneConfig(%q) returned %v, want %v", input, err, os.ErrInvalid)
+		}
+	}
+}
+
+func TestRcloneConfigResolve(t *testing.T) {
+	remotes, err := parseRcloneConfig(strings.NewReader(testRcloneConfig))
+	if err != nil {
+		t.Fatalf("parseRcloneConfig() failed: %v", err)
+	}
+
+	for _, tc := range []struct {
+		remote   string
+		path     string
+		wantName string
+		want     bucketConfig
+		wantErr  error
+	}{
+		{
+			remote:   "aws",
+			path:     "bucket/",
+			wantName: "bucket",
+			want:     bucketConfig{Region: "eu-west-1"},
+		},
+		{
+			remote:   "aws",
+			path:     "bucket/prefix",
+			wantName: "bucket/prefix",
+			want:     bucketConfig{Endpoint: "https://s3.eu-west-1.amazonaws.com", Region: "eu-west-1"},
+		},
+		{
+			remote:   "minio",
+			path:     "bucket/prefix",
+			wantName: "bucket/prefix",
+			want:     bucketConfig{Endpoint: "http://localhost:9000", PathStyle: true, Flavor: "minio"},
+		},
+		{
+			remote:   "public",
+			path:     "bucket",
+			wantName: "bucket",
+			want:     bucketConfig{Endpoint: "https://s3.example.com"},
+		},
+		{remote: "drive", path: "bucket", wantErr: os.ErrInvalid},
+		{remote: "aws", path: "/", wantErr: os.ErrInvalid},
+		{remote: "missing", path: "bucket", wantErr: os.ErrNotExist},
+	} {
+		t.Run(tc.remote+":"+tc.path, func(t *testing.T) {
+			name, got, err := remotes.resolve(tc.remote, tc.path)
+
+			if diff := cmp.Diff(tc.wantErr, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("Error diff (-want +got):\n%s", diff)
+			}
+
+			if name != tc.wantName {
+				t.Errorf("Name is %q, want %q", name, tc.wantName)
+			}
+
+			if diff := cmp.Diff(tc.want, got, cmpopts.IgnoreUnexported(bucketConfig{})); diff != "" {
+				t.Errorf("Config diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRcloneConfigCredentials(t *testing.T) {
+	remotes, err := loadRcloneConfig(writeTestFile(t, "rclone.conf", testRcloneConfig))
+	if err != nil {
+		t.Fatalf("loadRcloneConfig() failed: %v", err)
+	}
+
+	cfg := aws.Config{
+		Credentials: credentials.NewStaticCredentialsProvider("system", "secret", ""),
+	}
+
+	for _, tc := range []struct {
+		remote        string
+		wantKeyID     string
+		wantAnonymous bool
+	}{
+		{remote: "aws", wantKeyID: "system"},
+		{remote: "minio", wantKeyID: "id"},
+		{remote: "public", wantAnonymous: true},
+	} {
+		t.Run(tc.remote, func(t *testing.T) {
+			name, conf, err := remotes.resolve(tc.remote, "bucket/prefix")
+			if err != nil {
+				t.Fatalf("resolve() failed: %v", err)
+			}
+
+			var got s3.Options
+
+			c, err := conf.newClient(cfg, name, client.FlavorAWS, func(o *s3.Options) {
+				got = o.Copy()
+			})
+			if err != nil {
+				t.Fatalf("newClient() failed: %v", err)
+			}
+
+			if c.Name() != "bucket" || c.Prefix() != "prefix" {
+				t.Errorf("Client for bucket %q with prefix %q, want bucket/prefix", c.Name(), c.Prefix())
+			}
+
+			if _, anonymous := got.Credentials.(aws.AnonymousCredentials); anonymous != tc.wantAnonymous {
+				t.Fatalf("Anonymous credentials is %t, want %t", anonymous, tc.wantAnonymous)
+			} else if anonymous {
+				return
+			}
+
+			creds, err := got.Credentials.Retrieve(t.Context())
+			if err != nil {
+				t.Fatalf("Retrieving credentials failed: %v", err)
+			}
+
+			if creds.AccessKeyID != tc.wantKeyID {
+				t.Errorf("Access key ID %q, want %q", creds.AccessKeyID, tc.wantKeyID)
+			}
+		})
+	}
+}
+
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
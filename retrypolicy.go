@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// retryPolicy configures how the SDK retries failed requests. The zero value
+// keeps the SDK defaults, which also honour $AWS_RETRY_MODE and
+// $AWS_MAX_ATTEMPTS.
+type retryPolicy struct {
+	mode        aws.RetryMode
+	maxAttempts int
+	maxBackoff  time.Duration
+}
+
+func parseRetryPolicy(mode string, maxAttempts int, maxBackoff time.Duration) (retryPolicy, error) {
+	var p retryPolicy
+
+	if mode != "" {
+		parsed, err := aws.ParseRetryMode(mode)
+		if err != nil {
+			return p, err
+		}
+
+		p.mode = parsed
+	}
+
+	if maxAttempts < 0 {
+		return p, fmt.Errorf("max attempts (%d) must not be negative", maxAttempts)
+	}
+
+	if maxBackoff < 0 {
+		return p, fmt.Errorf("max backoff (%v) must not be negative", maxBackoff)
+	}
+
+	p.maxAttempts = maxAttempts
+	p.maxBackoff = maxBackoff
+
+	return p, nil
+}
+
+// apply replaces the retryer of an S3 client with one following the policy.
+func (p retryPolicy) apply(o *s3.Options) {
+	if p == (retryPolicy{}) {
+		return
+	}
+
+	mode := p.mode
+
+	if mode == "" {
+		mode = o.RetryMode
+	}
+
+	standardOptions := func(so *retry.StandardOptions) {
+		if p.maxAttempts > 0 {
+			so.MaxAttempts = p.maxAttempts
+		} else if o.RetryMaxAttempts > 0 {
+			so.MaxAttempts = o.RetryMaxAttempts
+		}
+
+		if p.maxBackoff > 0 {
+			so.MaxBackoff = p.maxBackoff
+		}
+	}
+
+	switch mode {
+	case aws.RetryModeAdaptive:
+		o.Retryer = retry.NewAdaptiveMode(func(ao *retry.AdaptiveModeOptions) {
+			ao.StandardOptions = append(ao.StandardOptions, standardOptions)
+		})
+
+	default:
+		o.Retryer = retry.NewStandard(standardOptions)
+	}
+
+	o.RetryMode = mode
+
+	if p.maxAttempts > 0 {
+		// Prevent the client from wrapping the retryer with the attempts
+		// configured in the environment.
+		o.RetryMaxAttempts = p.maxAttempts
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestParseRetryPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		mode        string
+		maxAttempts int
+		maxBackoff  time.Duration
+		want        retryPolicy
+		wantErr     bool
+	}{
+		{name: "defaults"},
+		{
+			name:        "adaptive",
+			mode:        "adaptive",
+			maxAttempts: 10,
+			maxBackoff:  time.Minute,
+			want: retryPolicy{
+				mode:        aws.RetryModeAdaptive,
+				maxAttempts: 10,
+				maxBackoff:  time.Minute,
+			},
+		},
+		{name: "unknown mode", mode: "eager", wantErr: true},
+		{name: "negative attempts", maxAttempts: -1, wantErr: true},
+		{name: "negative backoff", maxBackoff: -time.Second, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseRetryPolicy(tc.mode, tc.maxAttempts, tc.maxBackoff)
+
+			if (err != nil) != tc.wantErr {
+				t.Errorf("parseRetryPolicy() error = %v, want error %t", err, tc.wantErr)
+			}
+
+			if err == nil && got != tc.want {
+				t.Errorf("parseRetryPolicy() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyApply(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		c := s3.New(s3.Options{}, retryPolicy{}.apply)
+
+		if got := c.Options().Retryer.MaxAttempts(); got != retry.DefaultMaxAttempts {
+			t.Errorf("MaxAttempts() = %d, want %d", got, retry.DefaultMaxAttempts)
+		}
+	})
+
+	t.Run("standard", func(t *testing.T) {
+		p := retryPolicy{
+			maxAttempts: 7,
+			maxBackoff:  2 * time.Second,
+		}
+
+		c := s3.New(s3.Options{RetryMaxAttempts: 3}, p.apply)
+		r := c.Options().Retryer
+
+		if got := r.MaxAttempts(); got != p.maxAttempts {
+			t.Errorf("MaxAttempts() = %d, want %d", got, p.maxAttempts)
+		}
+
+		for attempt := range 20 {
+			delay, err := r.RetryDelay(attempt, errors.New("test"))
+			if err != nil {
+				t.Fatalf("RetryDelay() failed: %v", err)
+			}
+
+			if delay > p.maxBackoff {
+				t.Errorf("RetryDelay(%d) = %v, want at most %v", attempt, delay, p.maxBackoff)
+			}
+		}
+	})
+
+	t.Run("adaptive", func(t *testing.T) {
+		c := s3.New(s3.Options{}, retryPolicy{mode: aws.RetryModeAdaptive}.apply)
+
+		if _, ok := c.Options().Retryer.(*retry.AdaptiveMode); !ok {
+			t.Errorf("Retryer is %T, want adaptive mode", c.Options().Retryer)
+		}
+	})
+}
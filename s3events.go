@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// Maximum number of messages per ReceiveMessage and DeleteMessageBatch
+// request.
+const sqsBatchSize = 10
+
+const defaultEventQueueMaxMessages = 1000
+
+// s3EventNotification is the body of an S3 event notification. Only the
+// fields identifying the object are decoded.
+type s3EventNotification struct {
+	Records []struct {
+		EventSource string `json:"eventSource"`
+		S3          struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key string `json:"key"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+}
+
+type s3EventKey struct {
+	bucket string
+	key    string
+}
+
+// parseS3EventKeys returns the objects referenced by an S3 event notification.
+// Notifications delivered via SNS are unwrapped. Test events contain no
+// objects.
+func parseS3EventKeys(body string) ([]s3EventKey, error) {
+	var envelope struct {
+		Type    string `json:"Type"`
+		Message string `json:"Message"`
+	}
+
+	if err := json.Unmarshal([]byte(body), &envelope); err != nil {
+		return nil, err
+	}
+
+	if envelope.Type == "Notification" {
+		body = envelope.Message
+	}
+
+	var n s3EventNotification
+
+	if err := json.Unmarshal([]byte(body), &n); err != nil {
+		return nil, err
+	}
+
+	var result []s3EventKey
+
+	for _, r := range n.Records {
+		if r.EventSource != "aws:s3" {
+			continue
+		}
+
+		// Keys are URL-encoded with spaces as "+".
+		key, err := url.QueryUnescape(r.S3.Object.Key)
+		if err != nil {
+			return nil, fmt.Errorf("object key %q: %w", r.S3.Object.Key, err)
+		}
+
+		result = append(result, s3EventKey{
+			bucket: r.S3.Bucket.Name,
+			key:    key,
+		})
+	}
+
+	return result, nil
+}
+
+type eventQueueClient interface {
+	ReceiveMessage(context.Context, *sqs.ReceiveMessageInput, ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessageBatch(context.Context, *sqs.DeleteMessageBatchInput, ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error)
+}
+
+type eventQueueOptions struct {
+	logger *slog.Logger
+	client eventQueueClient
+	url    string
+
+	// Maximum number of messages received per run.
+	maxMessages int
+
+	// Delete messages referring only to buckets other than the processed
+	// ones instead of leaving them for other consumers.
+	discardUnknown bool
+
+	// Leave all messages in the queue.
+	dryRun bool
+}
+
+// eventQueue receives S3 event notifications from an SQS queue.
+type eventQueue struct {
+	logger         *slog.Logger
+	client         eventQueueClient
+	url            string
+	maxMessages    int
+	discardUnknown bool
+	dryRun         bool
+}
+
+func newEventQueue(opts eventQueueOptions) *eventQueue {
+	if opts.maxMessages < 1 {
+		opts.maxMessages = defaultEventQueueMaxMessages
+	}
+
+	return &eventQueue{
+		logger:         opts.logger,
+		client:         opts.client,
+		url:            opts.url,
+		maxMessages:    opts.maxMessages,
+		discardUnknown: opts.discardUnknown,
+		dryRun:         opts.dryRun,
+	}
+}
+
+type eventMessage struct {
+	receiptHandle string
+
+	// Buckets referenced by the message.
+	buckets []string
+
+	// The message also refers to buckets not being processed and must stay
+	// in the queue.
+	keep bool
+}
+
+// eventBatch holds the keys referenced by received messages.
+type eventBatch struct {
+	keys     map[string][]string
+	messages []eventMessage
+}
+
+// bucketKeys returns the sorted and deduplicated keys of a bucket.
+func (b *eventBatch) bucketKeys(bucket string) []string {
+	keys := slices.Clone(b.keys[bucket])
+
+	slices.Sort(keys)
+
+	return slices.Compact(keys)
+}
+
+// completed returns the receipt handles of the messages whose buckets have
+// all been processed successfully.
+func (b *eventBatch) completed(done map[string]bool) []string {
+	var result []string
+
+	for _, m := range b.messages {
+		if !m.keep && !slices.ContainsFunc(m.buckets, func(bucket string) bool { return !done[bucket] }) {
+			result = append(result, m.receiptHandle)
+		}
+	}
+
+	return result
+}
+
+// receive drains the queue until it's empty or the maximum number of messages
+// was received. Received messages stay invisible to other consumers for the
+// visibility timeout of the queue. Messages which can't be parsed are logged
+// and deleted. Messages referring to buckets other than the given ones are
+// left in the queue unless discarding them was requested. Nothing is deleted
+// in dry runs.
+func (q *eventQueue) receive(ctx context.Context, buckets []string) (*eventBatch, error) {
+	batch := &eventBatch{
+		keys: map[string][]string{},
+	}
+
+	var discard []string
+
+	for count := 0; count < q.maxMessages; {
+		output, err := q.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(q.url),
+			MaxNumberOfMessages: int32(min(sqsBatchSize, q.maxMessages-count)),
+
+			// Short polling only queries a subset of the servers and may
+			// return no messages despite the queue not being empty.
+			WaitTimeSeconds: 1,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("receiving messages: %w", err)
+		}
+
+		if len(output.Messages) == 0 {
+			break
+		}
+
+		count += len(output.Messages)
+
+		for _, msg := range output.Messages {
+			keys, err := parseS3EventKeys(aws.ToString(msg.Body))
+			if err != nil {
+				q.logger.WarnContext(ctx, "Discarding unparseable event message",
+					slog.String("message_id", aws.ToString(msg.MessageId)),
+					slog.Any("error", err))
+			}
+
+			m := eventMessage{
+				receiptHandle: aws.ToString(msg.ReceiptHandle),
+			}
+
+			unknown := false
+
+			for _, k := range keys {
+				if !slices.Contains(buckets, k.bucket) {
+					q.logger.WarnContext(ctx, "Ignoring event for unknown bucket",
+						slog.String("bucket", k.bucket),
+						slog.String("key", k.key))
+
+					if !q.discardUnknown {
+						// Unknown buckets are never processed, keeping
+						// the message in the queue.
+						unknown = true
+					}
+
+					continue
+				}
+
+				batch.keys[k.bucket] = append(batch.keys[k.bucket], k.key)
+
+				if !slices.Contains(m.buckets, k.bucket) {
+					m.buckets = append(m.buckets, k.bucket)
+				}
+			}
+
+			switch {
+			case unknown:
+				m.keep = true
+				batch.messages = append(batch.messages, m)
+
+			case len(m.buckets) == 0:
+				discard = append(discard, m.receiptHandle)
+
+			default:
+				batch.messages = append(batch.messages, m)
+			}
+		}
+	}
+
+	if err := q.delete(ctx, discard); err != nil {
+		return nil, err
+	}
+
+	return batch, nil
+}
+
+// delete removes processed messages from the queue. Dry runs don't delete
+// anything.
+func (q *eventQueue) delete(ctx context.Context, receiptHandles []string) error {
+	if q.dryRun {
+		return nil
+	}
+
+	for chunk := range slices.Chunk(receiptHandles, sqsBatchSize) {
+		input := &sqs.DeleteMessageBatchInput{
+			QueueUrl: aws.String(q.url),
+		}
+
+		for idx, handle := range chunk {
+			input.Entries = append(input.Entries, types.DeleteMessageBatchRequestEntry{
+				Id:            aws.String(fmt.Sprint(idx)),
+				ReceiptHandle: aws.String(handle),
+			})
+		}
+
+		output, err := q.client.DeleteMessageBatch(ctx, input)
+		if err != nil {
+			return fmt.Errorf("deleting messages: %w", err)
+		}
+
+		if len(output.Failed) > 0 {
+			var codes []string
+
+			for _, f := range output.Failed {
+				codes = append(codes, aws.ToString(f.Code))
+			}
+
+			// The messages are received again once their visibility
+			// timeout expires.
+			q.logger.WarnContext(ctx, "Deleting messages failed",
+				slog.Int("count", len(output.Failed)),
+				slog.String("codes", strings.Join(codes, ", ")))
+		}
+	}
+
+	return nil
+}
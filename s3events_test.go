@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+func s3EventBody(bucket string, keys ...string) string {
+	var records []any
+
+	for _, key := range keys {
+		records = append(records, map[string]any{
+			"eventSource": "aws:s3",
+			"eventName":   "ObjectCreated:Put",
+			"s3": map[string]any{
+				"bucket": map[string]any{"name": bucket},
+				"object": map[string]any{"key": key},
+			},
+		})
+	}
+
+	body, err := json.Marshal(map[string]any{"Records": records})
+	if err != nil {
+		panic(err)
+	}
+
+	return string(body)
+}
+
+func TestParseS3EventKeys(t *testing.T) {
+	sns, err := json.Marshal(map[string]string{
+		"Type":    "Notification",
+		"Message": s3EventBody("bucket", "via+sns"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		body    string
+		want    []s3EventKey
+		wantErr bool
+	}{
+		{
+			name: "direct",
+			body: s3EventBody("bucket", "a", "dir/file+name%3F.txt"),
+			want: []s3EventKey{
+				{bucket: "bucket", key: "a"},
+				{bucket: "bucket", key: "dir/file name?.txt"},
+			},
+		},
+		{
+			name: "sns",
+			body: string(sns),
+			want: []s3EventKey{
+				{bucket: "bucket", key: "via sns"},
+			},
+		},
+		{
+			name: "test event",
+			body: `{"Service":"Amazon S3","Event":"s3:TestEvent","Bucket":"bucket"}`,
+		},
+		{
+			name: "other source",
+			body: `{"Records":[{"eventSource":"aws:sqs"}]}`,
+		},
+		{
+			name:    "invalid",
+			body:    "not json",
+			wantErr: true,
+		},
+		{
+			name:    "invalid key",
+			body:    s3EventBody("bucket", "%zz"),
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseS3EventKeys(tc.body)
+
+			if (err != nil) != tc.wantErr {
+				t.Errorf("parseS3EventKeys() error = %v, want error %t", err, tc.wantErr)
+			}
+
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(s3EventKey{})); diff != "" {
+				t.Errorf("Keys diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+type fakeEventQueueClient struct {
+	messages []types.Message
+	deleted  []string
+}
+
+func (c *fakeEventQueueClient) ReceiveMessage(_ context.Context, input *sqs.ReceiveMessageInput, _ ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	count := min(len(c.messages), int(input.MaxNumberOfMessages))
+
+	output := &sqs.ReceiveMessageOutput{
+		Messages: c.messages[:count],
+	}
+
+	c.messages = c.messages[count:]
+
+	return output, nil
+}
+
+func (c *fakeEventQueueClient) DeleteMessageBatch(_ context.Context, input *sqs.DeleteMessageBatchInput, _ ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error) {
+	if len(input.Entries) > sqsBatchSize {
+		return nil, fmt.Errorf("too many entries: %d", len(input.Entries))
+	}
+
+	for _, e := range input.Entries {
+		c.deleted = append(c.deleted, aws.ToString(e.ReceiptHandle))
+	}
+
+	return &sqs.DeleteMessageBatchOutput{}, nil
+}
+
+func TestEventQueue(t *testing.T) {
+	var c fakeEventQueueClient
+
+	addMessage := func(body string) string {
+		handle := fmt.Sprintf("r%d", len(c.messages))
+
+		c.messages = append(c.messages, types.Message{
+			MessageId:     aws.String(fmt.Sprintf("m%d", len(c.messages))),
+			ReceiptHandle: aws.String(handle),
+			Body:          aws.String(body),
+		})
+
+		return handle
+	}
+
+	first := addMessage(s3EventBody("first", "b", "a"))
+	repeated := addMessage(s3EventBody("first", "a"))
+	addMessage("invalid")
+	addMessage(s3EventBody("unknown", "x"))
+
+	var second []string
+
+	for i := range 15 {
+		second = append(second, addMessage(s3EventBody("second", fmt.Sprint(i%3))))
+	}
+
+	q := newEventQueue(eventQueueOptions{
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		client: &c,
+		url:    "https://sqs.example.com/queue",
+	})
+
+	events, err := q.receive(t.Context(), []string{"first", "second"})
+	if err != nil {
+		t.Fatalf("receive() failed: %v", err)
+	}
+
+	if len(c.messages) != 0 {
+		t.Errorf("%d messages were not received", len(c.messages))
+	}
+
+	// Unparseable messages are discarded, those for unknown buckets are
+	// kept.
+	if diff := cmp.Diff([]string{"r2"}, c.deleted); diff != "" {
+		t.Errorf("Discarded messages diff (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]string{"a", "b"}, events.bucketKeys("first")); diff != "" {
+		t.Errorf("Keys diff (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]string{"0", "1", "2"}, events.bucketKeys("second")); diff != "" {
+		t.Errorf("Keys diff (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]string{first, repeated}, events.completed(map[string]bool{"first": true, "second": false})); diff != "" {
+		t.Errorf("Completed messages diff (-want +got):\n%s", diff)
+	}
+
+	c.deleted = nil
+
+	if err := q.delete(t.Context(), events.completed(map[string]bool{"second": true})); err != nil {
+		t.Errorf("delete() failed: %v", err)
+	}
+
+	if diff := cmp.Diff(second, c.deleted); diff != "" {
+		t.Errorf("Deleted messages diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestEventQueueUnknownBucket(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		discardUnknown bool
+		dryRun         bool
+		wantDiscarded  []string
+		wantCompleted  []string
+	}{
+		{
+			name:          "keep",
+			wantDiscarded: []string{"invalid"},
+		},
+		{
+			name:           "discard",
+			discardUnknown: true,
+			wantDiscarded:  []string{"invalid", "unknown"},
+			wantCompleted:  []string{"mixed"},
+		},
+		{
+			name:           "dry run",
+			discardUnknown: true,
+			dryRun:         true,
+			wantCompleted:  []string{"mixed"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := fakeEventQueueClient{
+				messages: []types.Message{
+					{ReceiptHandle: aws.String("invalid"), Body: aws.String("invalid")},
+					{ReceiptHandle: aws.String("unknown"), Body: aws.String(s3EventBody("unknown", "x"))},
+					{ReceiptHandle: aws.String("mixed"), Body: aws.String(`{"Records":[` +
+						`{"eventSource":"aws:s3","s3":{"bucket":{"name":"bucket"},"object":{"key":"a"}}},` +
+						`{"eventSource":"aws:s3","s3":{"bucket":{"name":"unknown"},"object":{"key":"b"}}}]}`)},
+				},
+			}
+
+			q := newEventQueue(eventQueueOptions{
+				logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+				client:         &c,
+				discardUnknown: tc.discardUnknown,
+				dryRun:         tc.dryRun,
+			})
+
+			events, err := q.receive(t.Context(), []string{"bucket"})
+			if err != nil {
+				t.Fatalf("receive() failed: %v", err)
+			}
+
+			if diff := cmp.Diff(tc.wantDiscarded, c.deleted); diff != "" {
+				t.Errorf("Discarded messages diff (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff([]string{"a"}, events.bucketKeys("bucket")); diff != "" {
+				t.Errorf("Keys diff (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tc.wantCompleted, events.completed(map[string]bool{"bucket": true})); diff != "" {
+				t.Errorf("Completed messages diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEventQueueMaxMessages(t *testing.T) {
+	var c fakeEventQueueClient
+
+	for i := range 25 {
+		c.messages = append(c.messages, types.Message{
+			ReceiptHandle: aws.String(fmt.Sprint(i)),
+			Body:          aws.String(s3EventBody("bucket", fmt.Sprint(i))),
+		})
+	}
+
+	q := newEventQueue(eventQueueOptions{
+		logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		client:      &c,
+		maxMessages: 12,
+	})
+
+	events, err := q.receive(t.Context(), []string{"bucket"})
+	if err != nil {
+		t.Fatalf("receive() failed: %v", err)
+	}
+
+	if got := len(events.messages); got != 12 {
+		t.Errorf("Received %d messages, want 12", got)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+var errShutdown = errors.New("shutdown requested")
+
+// shutdownHandler implements a graceful shutdown in stages. The first signal
+// stops listing and skips the remaining buckets while the versions listed so
+// far are still processed and the state is persisted. The second signal
+// cancels the cleanup context, abandoning in-flight requests. Any further
+// signal terminates the process immediately.
+type shutdownHandler struct {
+	mu     sync.Mutex
+	count  int
+	stop   chan struct{}
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	sigCh  chan os.Signal
+	done   chan struct{}
+}
+
+func newShutdownHandler(ctx context.Context) *shutdownHandler {
+	h := &shutdownHandler{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	h.ctx, h.cancel = context.WithCancelCause(ctx)
+
+	return h
+}
+
+// notify installs the handler for SIGINT and SIGTERM.
+func (h *shutdownHandler) notify() {
+	h.sigCh = make(chan os.Signal, 1)
+
+	signal.Notify(h.sigCh, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		for {
+			select {
+			case sig := <-h.sigCh:
+				h.trigger(sig)
+			case <-h.done:
+				return
+			}
+		}
+	}()
+}
+
+// trigger advances the shutdown by one stage.
+func (h *shutdownHandler) trigger(sig os.Signal) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.count++
+
+	switch h.count {
+	case 1:
+		slog.Warn("Received signal, finishing in-flight work and persisting state. Send again to abort immediately.",
+			slog.String("signal", sig.String()))
+
+		close(h.stop)
+
+	case 2:
+		slog.Warn("Received signal again, aborting in-flight work. Send again to terminate.",
+			slog.String("signal", sig.String()))
+
+		h.cancel(errShutdown)
+
+		if h.sigCh != nil {
+			// Restore the default behaviour.
+			signal.Stop(h.sigCh)
+		}
+	}
+}
+
+// stopped returns a channel closed once a shutdown has been requested.
+func (h *shutdownHandler) stopped() <-chan struct{} {
+	return h.stop
+}
+
+// requested reports whether a shutdown has been requested.
+func (h *shutdownHandler) requested() bool {
+	select {
+	case <-h.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// context returns a context cancelled upon the second signal.
+func (h *shutdownHandler) context() context.Context {
+	return h.ctx
+}
+
+func (h *shutdownHandler) close() {
+	if h.sigCh != nil {
+		signal.Stop(h.sigCh)
+		close(h.done)
+	}
+
+	h.cancel(context.Canceled)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestShutdownHandler(t *testing.T) {
+	h := newShutdownHandler(t.Context())
+
+	if h.requested() {
+		t.Errorf("Shutdown requested before any signal")
+	}
+
+	h.trigger(os.Interrupt)
+
+	if !h.requested() {
+		t.Errorf("Shutdown not requested after first signal")
+	}
+
+	select {
+	case <-h.stopped():
+	default:
+		t.Errorf("Stop channel not closed after first signal")
+	}
+
+	if err := h.context().Err(); err != nil {
+		t.Errorf("Context cancelled after first signal: %v", err)
+	}
+
+	h.trigger(syscall.SIGTERM)
+
+	if err := context.Cause(h.context()); !errors.Is(err, errShutdown) {
+		t.Errorf("Context cause %v, want %v", err, errShutdown)
+	}
+
+	// Further signals have no effect.
+	h.trigger(os.Interrupt)
+
+	h.close()
+}
+
+func TestShutdownHandlerClose(t *testing.T) {
+	h := newShutdownHandler(t.Context())
+	h.notify()
+	h.close()
+
+	if h.requested() {
+		t.Errorf("Shutdown requested after close")
+	}
+
+	if h.context().Err() == nil {
+		t.Errorf("Context not cancelled after close")
+	}
+}
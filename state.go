@@ -2,45 +2,548 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
 	"os"
+	"time"
 
+	"github.com/hansmi/s3-object-cleanup/cleanup"
 	"github.com/hansmi/s3-object-cleanup/internal/client"
 	"github.com/hansmi/s3-object-cleanup/internal/state"
 )
 
-// downloadStateFromBucket downloads a compressed state database snapshot from
-// an S3 bucket.
-func downloadStateFromBucket(ctx context.Context, tmpdir string, c *client.Client, key string) (_ *state.Store, err error) {
-	tmpfile, err := state.CreateUnlinkedTemp(tmpdir, "download*")
+var errStateConflict = errors.New("state modified by concurrent run")
+var errStateChecksumMismatch = errors.New("state checksum mismatch")
+var errStateInvalid = errors.New("invalid state snapshot")
+
+// Metadata key for the SHA-256 checksum of state snapshots.
+const stateChecksumMetadata = "sha256"
+
+// Number of download attempts for snapshots not matching their checksum.
+const stateDownloadAttempts = 3
+
+func stateChecksum(r io.Reader) (string, error) {
+	h := sha256.New()
+
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readErrorRecorder remembers the first error of the underlying reader. It
+// distinguishes failed downloads from invalid snapshots.
+type readErrorRecorder struct {
+	r   io.Reader
+	err error
+}
+
+func (r *readErrorRecorder) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+
+	if err != nil && err != io.EOF && r.err == nil {
+		r.err = err
+	}
+
+	return n, err
+}
+
+// readStateSnapshot decompresses a snapshot directly into a database file
+// while computing its checksum. The database is discarded if the checksum
+// doesn't match. The checksum isn't verified if empty.
+func readStateSnapshot(tmpdir string, r io.Reader, checksum string, encKey *state.EncryptionKey) (*state.Store, error) {
+	h := sha256.New()
+	rr := &readErrorRecorder{r: r}
+
+	s, openErr := state.OpenCompressed(tmpdir, io.TeeReader(rr, h), encKey)
+
+	discard := func(err error) error {
+		if s != nil {
+			err = errors.Join(err, s.Discard())
+		}
+
+		return err
+	}
+
+	// Data not consumed while opening, e.g. after an error, is still
+	// covered by the checksum.
+	io.Copy(h, rr)
+
+	if rr.err != nil {
+		return nil, discard(fmt.Errorf("reading snapshot: %w", rr.err))
+	}
+
+	if got := hex.EncodeToString(h.Sum(nil)); checksum != "" && got != checksum {
+		return nil, discard(fmt.Errorf("%w: got %s, want %s", errStateChecksumMismatch, got, checksum))
+	}
+
+	if openErr != nil {
+		return nil, fmt.Errorf("%w: %w", errStateInvalid, openErr)
+	}
+
+	return s, nil
+}
+
+// openStateSnapshot downloads a snapshot and opens it as a database.
+func openStateSnapshot(ctx context.Context, tmpdir string, c *client.Client, key string, encKey *state.EncryptionKey) (*state.Store, client.ObjectInfo, error) {
+	body, info, err := c.OpenObject(ctx, key)
+	if err != nil {
+		return nil, info, fmt.Errorf("object %q download: %w", key, err)
+	}
+
+	defer body.Close()
+
+	s, err := readStateSnapshot(tmpdir, body, info.Metadata[stateChecksumMetadata], encKey)
 	if err != nil {
-		return nil, err
+		return nil, info, fmt.Errorf("object %q: %w", key, err)
 	}
 
-	defer tmpfile.Close()
+	return s, info, nil
+}
+
+// downloadStateFromBucket downloads a compressed state database snapshot from
+// an S3 bucket. Downloads not matching the checksum recorded during upload are
+// retried; an error wrapping [errStateChecksumMismatch] is returned if they
+// keep failing. Snapshots which were downloaded correctly but can't be opened
+// result in an error wrapping [errStateInvalid].
+//
+// The returned condition only permits replacing the snapshot as it was
+// downloaded, or creating it if it didn't exist. It's unconditional if the
+// download failed for other reasons.
+func downloadStateFromBucket(ctx context.Context, tmpdir string, c *client.Client, key string, encKey *state.EncryptionKey) (s *state.Store, cond client.UploadCondition, err error) {
+	var info client.ObjectInfo
 
-	if err := c.DownloadObject(ctx, tmpfile, key); err != nil {
-		return nil, fmt.Errorf("object %q download: %w", key, err)
+	for attempt := 1; ; attempt++ {
+		s, info, err = openStateSnapshot(ctx, tmpdir, c, key, encKey)
+		if err == nil || !errors.Is(err, errStateChecksumMismatch) || attempt >= stateDownloadAttempts {
+			break
+		}
 	}
 
-	if _, err := tmpfile.Seek(0, os.SEEK_SET); err != nil {
-		return nil, err
+	if err != nil {
+		if client.IsNotFound(err) {
+			cond.IfNoneMatch = true
+		} else if info.ETag != "" {
+			cond.IfMatch = info.ETag
+		}
+
+		return nil, cond, err
 	}
 
-	return state.OpenCompressed(tmpdir, tmpfile)
+	cond.IfMatch = info.ETag
+
+	return s, cond, nil
 }
 
-// uploadStateToBucket uploads a compressed state database snapshot to an S3 bucket.
-func uploadStateToBucket(ctx context.Context, s *state.Store, tmpdir string, c *client.Client, key string) (err error) {
-	f, err := s.WriteCompressed(tmpdir)
+// uploadStateToBucket uploads a compressed state database snapshot to an S3
+// bucket together with its checksum and returns the entity tag and size of the
+// uploaded object. The snapshot is encrypted if a key is
+// given. An error wrapping [errStateConflict] is returned if the condition
+// isn't met, i.e. another run has written the snapshot in the meantime.
+func uploadStateToBucket(ctx context.Context, s *state.Store, tmpdir string, c *client.Client, key string, encKey *state.EncryptionKey, cond client.UploadCondition) (etag string, size int64, err error) {
+	f, err := s.WriteCompressed(tmpdir, encKey)
 	if err != nil {
-		return err
+		return "", 0, err
 	}
 
 	defer func() {
 		err = errors.Join(err, f.Close())
 	}()
 
-	return c.UploadObject(ctx, f, key)
+	checksum, err := stateChecksum(f)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if size, err = f.Seek(0, os.SEEK_CUR); err != nil {
+		return "", 0, err
+	}
+
+	if _, err := f.Seek(0, os.SEEK_SET); err != nil {
+		return "", 0, err
+	}
+
+	etag, err = c.UploadObjectConditional(ctx, f, key, cond, map[string]string{
+		stateChecksumMetadata: checksum,
+	})
+	if err != nil {
+		if client.IsPreconditionFailed(err) {
+			err = fmt.Errorf("%w: %w", errStateConflict, err)
+		}
+
+		return "", 0, err
+	}
+
+	return etag, size, nil
+}
+
+// Snapshot of the state of all buckets written by earlier releases.
+const legacyStateKey = "state.gz"
+
+// bucketStateKey returns the object key of the state snapshot of a bucket.
+// Access point ARNs contain slashes which are escaped to keep the snapshots
+// in a flat namespace. Plain bucket names are unchanged.
+func bucketStateKey(bucket string) string {
+	return "state/" + url.PathEscape(bucket) + ".gz"
+}
+
+type stateManagerOptions struct {
+	logger *slog.Logger
+	tmpdir string
+
+	// Bucket for persisting the state. The state is discarded at the end of
+	// the run if nil.
+	client *client.Client
+
+	encKey *state.EncryptionKey
+
+	// Overwrite snapshots even if they were modified concurrently.
+	unconditional bool
+
+	// Prune the least recently modified retention records before persisting
+	// a state whose data exceeds the given size. Disabled if zero.
+	maxSize int64
+
+	// Snapshots are specific to the shard of keys processed by the run.
+	shard cleanup.KeyShard
+}
+
+// stateManager provides a separate state database for each bucket. With a
+// persistence bucket each database is restored from and persisted to its own
+// snapshot object. Buckets without snapshot are initialized from the legacy
+// snapshot shared by all buckets if available.
+type stateManager struct {
+	stateManagerOptions
+
+	legacy       *state.Store
+	legacyLoaded bool
+}
+
+// bucketStateHandle is the state of a single bucket.
+type bucketStateHandle struct {
+	store  *state.Store
+	bucket string
+	key    string
+	cond   client.UploadCondition
+
+	// Receives state metrics. May be nil.
+	stats *cleanup.Stats
+}
+
+func newStateManager(opts stateManagerOptions) *stateManager {
+	return &stateManager{
+		stateManagerOptions: opts,
+	}
+}
+
+// fatalStateError returns a non-nil error if the snapshot which failed to load
+// must not be replaced with a fresh state.
+func fatalStateError(err error) error {
+	switch {
+	case errors.Is(err, state.ErrEncrypted):
+		return fmt.Errorf("%w (see -state_encryption_key_file)", err)
+	case errors.Is(err, state.ErrSchemaTooNew):
+		return err
+	}
+
+	return nil
+}
+
+// loadLegacy downloads the legacy snapshot once.
+func (m *stateManager) loadLegacy(ctx context.Context) (*state.Store, error) {
+	if !m.legacyLoaded {
+		m.legacyLoaded = true
+
+		s, _, err := downloadStateFromBucket(ctx, m.tmpdir, m.client, legacyStateKey, m.encKey)
+		if err != nil {
+			if client.IsNotFound(err) {
+				return nil, nil
+			}
+
+			if fatal := fatalStateError(err); fatal != nil {
+				return nil, fmt.Errorf("legacy state: %w", fatal)
+			}
+
+			if !errors.Is(err, errStateInvalid) {
+				return nil, fmt.Errorf("legacy state: %w", err)
+			}
+
+			m.logger.Warn("Ignoring invalid legacy state", slog.Any("error", err))
+
+			return nil, nil
+		}
+
+		m.legacy = s
+	}
+
+	return m.legacy, nil
+}
+
+// countLoaded records the number of records in a restored state.
+func (m *stateManager) countLoaded(h *bucketStateHandle) error {
+	if h.stats == nil {
+		return nil
+	}
+
+	count, err := h.store.RecordCount()
+	if err != nil {
+		return errors.Join(fmt.Errorf("counting state records: %w", err), h.store.Close())
+	}
+
+	h.stats.AddStateLoaded(count)
+
+	return nil
+}
+
+// open returns the state of a bucket. A fresh state is used if the snapshot
+// was downloaded intact, but isn't a valid database. Failed downloads and
+// snapshots which can't be replaced, e.g. because they're encrypted with an
+// unknown key, result in an error. State metrics are added to the given
+// statistics if not nil.
+func (m *stateManager) open(ctx context.Context, bucket string, stats *cleanup.Stats) (*bucketStateHandle, error) {
+	h := &bucketStateHandle{
+		bucket: bucket,
+		key:    m.shard.ObjectKey(bucketStateKey(bucket)),
+		stats:  stats,
+	}
+
+	if m.client != nil {
+		s, cond, err := downloadStateFromBucket(ctx, m.tmpdir, m.client, h.key, m.encKey)
+
+		if !m.unconditional {
+			h.cond = cond
+		}
+
+		switch {
+		case err == nil:
+			h.store = s
+
+			if err := m.countLoaded(h); err != nil {
+				return nil, err
+			}
+
+			return h, nil
+
+		case client.IsNotFound(err):
+			legacy, err := m.loadLegacy(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			if legacy != nil {
+				if h.store, err = state.New(m.tmpdir); err != nil {
+					return nil, fmt.Errorf("initializing state: %w", err)
+				}
+
+				if err := legacy.CopyBucket(h.store, bucket); err != nil {
+					return nil, errors.Join(fmt.Errorf("copying legacy state: %w", err), h.store.Close())
+				}
+
+				m.logger.Info("Initialized bucket state from legacy state", slog.String("bucket", bucket))
+
+				if err := m.countLoaded(h); err != nil {
+					return nil, err
+				}
+
+				return h, nil
+			}
+
+		default:
+			if fatal := fatalStateError(err); fatal != nil {
+				return nil, fmt.Errorf("restoring state: %w", fatal)
+			}
+
+			if !errors.Is(err, errStateInvalid) {
+				// Keep the snapshot instead of replacing it after a
+				// failed download.
+				return nil, fmt.Errorf("restoring state: %w", err)
+			}
+
+			m.logger.Warn("Rebuilding invalid state", slog.String("bucket", bucket), slog.Any("error", err))
+		}
+	}
+
+	s, err := state.New(m.tmpdir)
+	if err != nil {
+		return nil, fmt.Errorf("initializing state: %w", err)
+	}
+
+	h.store = s
+
+	return h, nil
+}
+
+// persist uploads a snapshot of the state of a bucket. Subsequent uploads are
+// conditional on the uploaded snapshot.
+func (m *stateManager) persist(ctx context.Context, h *bucketStateHandle) (int64, error) {
+	etag, size, err := uploadStateToBucket(ctx, h.store, m.tmpdir, m.client, h.key, m.encKey, h.cond)
+	if err != nil {
+		return 0, err
+	}
+
+	if !m.unconditional {
+		h.cond = client.UploadCondition{IfMatch: etag}
+	}
+
+	return size, nil
+}
+
+// checkpoint persists the state of a bucket at the given interval until the
+// returned function is called. Checkpoints allow a later run to benefit from
+// the work done by a run which didn't finish. Disabled without a persistence
+// bucket or if the interval is zero.
+func (m *stateManager) checkpoint(ctx context.Context, h *bucketStateHandle, interval time.Duration) (stop func()) {
+	if m.client == nil || interval <= 0 {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	logger := m.logger.With(slog.String("bucket", h.bucket))
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			// Uploads aren't interrupted as the entity tag of a
+			// completed upload is needed for the next one.
+			size, err := m.persist(context.WithoutCancel(ctx), h)
+			if err != nil {
+				logger.Error("Persisting intermediate state failed", slog.Any("error", err))
+
+				if errors.Is(err, errStateConflict) {
+					return
+				}
+
+				continue
+			}
+
+			logger.Info("Persisted intermediate state", slog.Int64("size", size))
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// close persists the state of a bucket if a persistence bucket is configured
+// and releases its resources. The finalize function, if not nil, is invoked
+// once the records to be written have been counted and before the state is
+// persisted, e.g. to record the statistics of the run in the state.
+func (m *stateManager) close(ctx context.Context, h *bucketStateHandle, finalize func(*state.Store)) (err error) {
+	defer func() {
+		err = errors.Join(err, h.store.Close())
+	}()
+
+	if m.client == nil {
+		if finalize != nil {
+			finalize(h.store)
+		}
+
+		return nil
+	}
+
+	if m.maxSize > 0 {
+		if err := enforceStateSizeLimit(m.logger, h.store, h.bucket, m.maxSize); err != nil {
+			return fmt.Errorf("limiting state size: %w", err)
+		}
+	}
+
+	count, err := h.store.RecordCount()
+	if err != nil {
+		return err
+	}
+
+	if h.stats != nil {
+		h.stats.AddStateWritten(count)
+	}
+
+	if finalize != nil {
+		finalize(h.store)
+	}
+
+	size, err := m.persist(ctx, h)
+	if err != nil {
+		return fmt.Errorf("persisting state: %w", err)
+	}
+
+	if h.stats != nil {
+		h.stats.AddStateSnapshot(size)
+	}
+
+	return nil
+}
+
+// enforceStateSizeLimit prunes the least recently modified retention records
+// if the state data exceeds the given size.
+func enforceStateSizeLimit(logger *slog.Logger, s *state.Store, bucket string, limit int64) error {
+	size, err := s.DataSize()
+	if err != nil {
+		return err
+	}
+
+	if size <= limit {
+		return nil
+	}
+
+	b, err := s.Bucket(bucket)
+	if err != nil {
+		return err
+	}
+
+	summary, err := b.PruneObjectRetentionBySize(size - limit)
+	if err != nil {
+		return err
+	}
+
+	logger = logger.With(
+		slog.String("bucket", bucket),
+		slog.Int64("size", size),
+		slog.Int64("limit", limit),
+	)
+
+	logger.Warn("Pruned retention records exceeding state size limit",
+		slog.Int("count", summary.Count),
+		slog.Int64("pruned_size", summary.Size),
+		slog.Time("oldest_mtime", summary.OldestMTime),
+		slog.Time("newest_mtime", summary.NewestMTime),
+	)
+
+	if size-summary.Size > limit {
+		logger.Warn("State exceeds size limit after pruning all retention records")
+	}
+
+	return nil
+}
+
+// discard releases the resources of a bucket state without persisting it.
+func (m *stateManager) discard(h *bucketStateHandle) error {
+	return h.store.Close()
+}
+
+// release closes the legacy state if it was loaded.
+func (m *stateManager) release() error {
+	if m.legacy == nil {
+		return nil
+	}
+
+	return m.legacy.Close()
 }
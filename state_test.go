@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/hansmi/s3-object-cleanup/internal/state"
+)
+
+func TestStateManagerWithoutPersistence(t *testing.T) {
+	m := newStateManager(stateManagerOptions{
+		logger: slog.Default(),
+		tmpdir: t.TempDir(),
+	})
+
+	until := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	for range 2 {
+		h, err := m.open(t.Context(), "bucket", nil)
+		if err != nil {
+			t.Fatalf("open() failed: %v", err)
+		}
+
+		if want := "state/bucket.gz"; h.key != want {
+			t.Errorf("State key is %q, want %q", h.key, want)
+		}
+
+		b, err := h.store.Bucket("bucket")
+		if err != nil {
+			t.Fatalf("Bucket() failed: %v", err)
+		}
+
+		// The state is discarded when closed.
+		if got, _, err := b.GetObjectRetention("key", "v"); err != nil {
+			t.Errorf("GetObjectRetention() failed: %v", err)
+		} else if !got.IsZero() {
+			t.Errorf("GetObjectRetention() = %v, want zero", got)
+		}
+
+		if err := b.SetObjectRetention("key", "v", until); err != nil {
+			t.Errorf("SetObjectRetention() failed: %v", err)
+		}
+
+		// Checkpoints are disabled without a persistence bucket.
+		m.checkpoint(t.Context(), h, time.Millisecond)()
+
+		finalized := false
+
+		if err := m.close(t.Context(), h, func(*state.Store) {
+			finalized = true
+		}); err != nil {
+			t.Errorf("close() failed: %v", err)
+		}
+
+		if !finalized {
+			t.Errorf("close() didn't finalize the state")
+		}
+	}
+
+	if err := m.release(); err != nil {
+		t.Errorf("release() failed: %v", err)
+	}
+}
+
+func TestFatalStateError(t *testing.T) {
+	for _, tc := range []struct {
+		err   error
+		fatal bool
+	}{
+		{err: errors.New("test")},
+		{err: state.ErrEncrypted, fatal: true},
+		{err: state.ErrSchemaTooNew, fatal: true},
+		{err: fmt.Errorf("%w: %w", errStateInvalid, state.ErrEncrypted), fatal: true},
+		{err: fmt.Errorf("%w: test", errStateInvalid)},
+	} {
+		if got := fatalStateError(tc.err); (got != nil) != tc.fatal || (got != nil && !errors.Is(got, tc.err)) {
+			t.Errorf("fatalStateError(%v) = %v, want fatal=%v", tc.err, got, tc.fatal)
+		}
+	}
+}
+
+func TestStateChecksum(t *testing.T) {
+	got, err := stateChecksum(strings.NewReader("hello world"))
+	if err != nil {
+		t.Errorf("stateChecksum() failed: %v", err)
+	}
+
+	if want := "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"; got != want {
+		t.Errorf("stateChecksum() = %q, want %q", got, want)
+	}
+}
+
+func TestEnforceStateSizeLimit(t *testing.T) {
+	s, err := state.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	t.Cleanup(func() {
+		s.Close()
+	})
+
+	b, err := s.Bucket("test")
+	if err != nil {
+		t.Fatalf("Bucket() failed: %v", err)
+	}
+
+	for i := range 100 {
+		if err := b.SetObjectRetention(fmt.Sprintf("key%03d", i), "v", time.Now()); err != nil {
+			t.Fatalf("SetObjectRetention() failed: %v", err)
+		}
+	}
+
+	before, err := s.DataSize()
+	if err != nil {
+		t.Fatalf("DataSize() failed: %v", err)
+	}
+
+	if err := enforceStateSizeLimit(slog.Default(), s, "test", before); err != nil {
+		t.Errorf("enforceStateSizeLimit() failed: %v", err)
+	}
+
+	if got, err := s.DataSize(); err != nil {
+		t.Errorf("DataSize() failed: %v", err)
+	} else if got != before {
+		t.Errorf("State within limit was pruned to %d bytes", got)
+	}
+
+	limit := before / 2
+
+	if err := enforceStateSizeLimit(slog.Default(), s, "test", limit); err != nil {
+		t.Errorf("enforceStateSizeLimit() failed: %v", err)
+	}
+
+	if got, err := s.DataSize(); err != nil {
+		t.Errorf("DataSize() failed: %v", err)
+	} else if got > limit {
+		t.Errorf("DataSize() = %d after pruning, want at most %d", got, limit)
+	}
+}
+
+func TestReadStateSnapshot(t *testing.T) {
+	errTest := errors.New("test error")
+
+	src, err := state.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	t.Cleanup(func() {
+		src.Close()
+	})
+
+	f, err := src.WriteCompressed(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("WriteCompressed() failed: %v", err)
+	}
+
+	snapshot, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("ReadAll() failed: %v", err)
+	}
+
+	f.Close()
+
+	checksum, err := stateChecksum(bytes.NewReader(snapshot))
+	if err != nil {
+		t.Fatalf("stateChecksum() failed: %v", err)
+	}
+
+	garbage := []byte("garbage")
+
+	garbageChecksum, err := stateChecksum(bytes.NewReader(garbage))
+	if err != nil {
+		t.Fatalf("stateChecksum() failed: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		r        io.Reader
+		checksum string
+		wantErr  error
+	}{
+		{
+			name:     "valid",
+			r:        bytes.NewReader(snapshot),
+			checksum: checksum,
+		},
+		{
+			name: "without checksum",
+			r:    bytes.NewReader(snapshot),
+		},
+		{
+			name:     "checksum mismatch",
+			r:        bytes.NewReader(snapshot),
+			checksum: garbageChecksum,
+			wantErr:  errStateChecksumMismatch,
+		},
+		{
+			name:     "invalid",
+			r:        bytes.NewReader(garbage),
+			checksum: garbageChecksum,
+			wantErr:  errStateInvalid,
+		},
+		{
+			name:     "read error",
+			r:        io.MultiReader(bytes.NewReader(snapshot[:len(snapshot)/2]), iotest.ErrReader(errTest)),
+			checksum: checksum,
+			wantErr:  errTest,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpdir := t.TempDir()
+
+			s, err := readStateSnapshot(tmpdir, tc.r, tc.checksum, nil)
+
+			if diff := cmp.Diff(tc.wantErr, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("Error diff (-want +got):\n%s", diff)
+			}
+
+			if err == nil {
+				if err := s.Close(); err != nil {
+					t.Errorf("Close() failed: %v", err)
+				}
+
+				return
+			}
+
+			if entries, err := os.ReadDir(tmpdir); err != nil {
+				t.Errorf("ReadDir() failed: %v", err)
+			} else if len(entries) != 0 {
+				t.Errorf("Temporary files remain after failure: %v", entries)
+			}
+		})
+	}
+}
+
+func TestBucketStateKey(t *testing.T) {
+	for _, tc := range []struct {
+		bucket string
+		want   string
+	}{
+		{bucket: "bucket", want: "state/bucket.gz"},
+		{bucket: "my.bucket-1", want: "state/my.bucket-1.gz"},
+		{
+			bucket: "arn:aws:s3:us-west-2:123456789012:accesspoint/ap",
+			want:   "state/arn:aws:s3:us-west-2:123456789012:accesspoint%2Fap.gz",
+		},
+	} {
+		if got := bucketStateKey(tc.bucket); got != tc.want {
+			t.Errorf("bucketStateKey(%q) = %q, want %q", tc.bucket, got, tc.want)
+		}
+	}
+}
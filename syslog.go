@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const syslogDialTimeout = 10 * time.Second
+
+// Facility codes as defined by RFC 5424.
+var syslogFacilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"authpriv": 10,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+func parseSyslogFacility(name string) (int, error) {
+	facility, ok := syslogFacilities[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown syslog facility %q", name)
+	}
+
+	return facility, nil
+}
+
+// syslogSeverity maps a log level to a severity of RFC 5424.
+func syslogSeverity(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3
+	case level >= slog.LevelWarn:
+		return 4
+	case level >= slog.LevelInfo:
+		return 6
+	}
+
+	return 7
+}
+
+// syslogConn sends messages to a syslog server, reconnecting after errors.
+// Messages sent via stream transports are framed using octet counting (RFC
+// 6587, RFC 5425); datagrams carry one message each (RFC 5426).
+type syslogConn struct {
+	mu     sync.Mutex
+	dial   func() (net.Conn, error)
+	stream bool
+	conn   net.Conn
+}
+
+// newSyslogConn connects to a syslog server given as URL with one of the
+// schemes "udp", "tcp" or "tls", e.g. "tls://logs.example.com:6514".
+func newSyslogConn(address string) (*syslogConn, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing host in %q", address)
+	}
+
+	dialer := &net.Dialer{
+		Timeout: syslogDialTimeout,
+	}
+
+	c := &syslogConn{}
+
+	switch u.Scheme {
+	case "udp":
+		c.dial = func() (net.Conn, error) {
+			return dialer.Dial("udp", withDefaultPort(u.Host, "514"))
+		}
+
+	case "tcp":
+		c.stream = true
+		c.dial = func() (net.Conn, error) {
+			return dialer.Dial("tcp", withDefaultPort(u.Host, "601"))
+		}
+
+	case "tls":
+		c.stream = true
+		c.dial = func() (net.Conn, error) {
+			return tls.DialWithDialer(dialer, "tcp", withDefaultPort(u.Host, "6514"), &tls.Config{
+				ServerName: u.Hostname(),
+				MinVersion: tls.VersionTLS12,
+			})
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported syslog transport %q (known: udp, tcp, tls)", u.Scheme)
+	}
+
+	if c.conn, err = c.dial(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func withDefaultPort(host, port string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
+}
+
+func (c *syslogConn) send(msg []byte) error {
+	if c.stream {
+		msg = fmt.Appendf(nil, "%d %s", len(msg), msg)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+
+	// Retry once on a new connection, e.g. after the server restarted.
+	for range 2 {
+		if c.conn == nil {
+			if c.conn, err = c.dial(); err != nil {
+				continue
+			}
+		}
+
+		if _, err = c.conn.Write(msg); err == nil {
+			return nil
+		}
+
+		c.conn.Close()
+		c.conn = nil
+	}
+
+	return err
+}
+
+func (c *syslogConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+
+	err := c.conn.Close()
+	c.conn = nil
+
+	return err
+}
+
+type syslogHandlerOptions struct {
+	conn     *syslogConn
+	level    slog.Leveler
+	facility int
+	appName  string
+	hostname string
+}
+
+// syslogHandler formats records as RFC 5424 messages. The attributes are
+// encoded as a JSON object in the message part, retaining their structure
+// for parsing by the receiving pipeline. Timestamp and severity are part of
+// the header.
+type syslogHandler struct {
+	opts syslogHandlerOptions
+
+	// Calls to WithAttrs and WithGroup, replayed on the JSON handler
+	// formatting each record.
+	chain []func(slog.Handler) slog.Handler
+}
+
+var _ slog.Handler = (*syslogHandler)(nil)
+
+func newSyslogHandler(opts syslogHandlerOptions) *syslogHandler {
+	if opts.level == nil {
+		opts.level = slog.LevelInfo
+	}
+
+	if opts.hostname == "" {
+		opts.hostname = "-"
+	}
+
+	return &syslogHandler{opts: opts}
+}
+
+func (h *syslogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.opts.level.Level()
+}
+
+func (h *syslogHandler) with(fn func(slog.Handler) slog.Handler) *syslogHandler {
+	return &syslogHandler{
+		opts:  h.opts,
+		chain: append(h.chain[:len(h.chain):len(h.chain)], fn),
+	}
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(inner slog.Handler) slog.Handler {
+		return inner.WithAttrs(attrs)
+	})
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(inner slog.Handler) slog.Handler {
+		return inner.WithGroup(name)
+	})
+}
+
+func (h *syslogHandler) format(ctx context.Context, w io.Writer, r slog.Record) error {
+	fmt.Fprintf(w, "<%d>1 %s %s %s %d - - ",
+		h.opts.facility*8+syslogSeverity(r.Level),
+		r.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		h.opts.hostname, h.opts.appName, os.Getpid())
+
+	var inner slog.Handler = slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey) {
+				return slog.Attr{}
+			}
+
+			return a
+		},
+	})
+
+	for _, fn := range h.chain {
+		inner = fn(inner)
+	}
+
+	return inner.Handle(ctx, r)
+}
+
+func (h *syslogHandler) Handle(ctx context.Context, r slog.Record) error {
+	var buf bytes.Buffer
+
+	if err := h.format(ctx, &buf, r); err != nil {
+		return err
+	}
+
+	return h.opts.conn.send(bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}))
+}
+
+// newSyslogHandler connects to the syslog server configured via flags.
+func (p *program) newSyslogHandler(level slog.Leveler) (*syslogHandler, error) {
+	facility, err := parseSyslogFacility(p.syslogFacility)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := newSyslogConn(p.syslogAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, _ := os.Hostname()
+
+	return newSyslogHandler(syslogHandlerOptions{
+		conn:     conn,
+		level:    level,
+		facility: facility,
+		appName:  "s3-object-cleanup",
+		hostname: hostname,
+	}), nil
+}
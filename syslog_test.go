@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseSyslogFacility(t *testing.T) {
+	if got, err := parseSyslogFacility("LOCAL3"); err != nil || got != 19 {
+		t.Errorf("parseSyslogFacility() = (%d, %v), want 19", got, err)
+	}
+
+	if _, err := parseSyslogFacility("local8"); err == nil {
+		t.Error("parseSyslogFacility() succeeded for unknown facility")
+	}
+}
+
+func TestSyslogSeverity(t *testing.T) {
+	for level, want := range map[slog.Level]int{
+		slog.LevelDebug:     7,
+		slog.LevelInfo:      6,
+		slog.LevelInfo + 1:  6,
+		slog.LevelWarn:      4,
+		slog.LevelError:     3,
+		slog.LevelError + 4: 3,
+	} {
+		if got := syslogSeverity(level); got != want {
+			t.Errorf("syslogSeverity(%v) = %d, want %d", level, got, want)
+		}
+	}
+}
+
+func TestNewSyslogConnInvalid(t *testing.T) {
+	for _, address := range []string{
+		"",
+		"logs.example.com:514",
+		"http://logs.example.com",
+	} {
+		if _, err := newSyslogConn(address); err == nil {
+			t.Errorf("newSyslogConn(%q) succeeded", address)
+		}
+	}
+}
+
+var syslogHeaderPattern = regexp.MustCompile(`^<(\d+)>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}(Z|[+-]\d\d:\d\d) host app \d+ - - `)
+
+func checkSyslogMessage(t *testing.T, msg string, wantPri int, wantBody string) {
+	t.Helper()
+
+	m := syslogHeaderPattern.FindStringSubmatch(msg)
+	if m == nil {
+		t.Fatalf("Message %q doesn't match %v", msg, syslogHeaderPattern)
+	}
+
+	if got, _ := strconv.Atoi(m[1]); got != wantPri {
+		t.Errorf("Priority %d, want %d", got, wantPri)
+	}
+
+	if diff := cmp.Diff(wantBody, strings.TrimPrefix(msg, m[0])); diff != "" {
+		t.Errorf("Message body diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestSyslogHandlerTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan string, 4)
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+
+		for {
+			length, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+
+			n, err := strconv.Atoi(strings.TrimSpace(length))
+			if err != nil {
+				t.Errorf("Invalid frame length %q", length)
+				return
+			}
+
+			buf := make([]byte, n)
+
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return
+			}
+
+			received <- string(buf)
+		}
+	}()
+
+	conn, err := newSyslogConn("tcp://" + ln.Addr().String())
+	if err != nil {
+		t.Fatalf("newSyslogConn() failed: %v", err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	logger := slog.New(newSyslogHandler(syslogHandlerOptions{
+		conn:     conn,
+		facility: 16,
+		appName:  "app",
+		hostname: "host",
+	}))
+
+	logger.Debug("Hidden")
+	logger.With(slog.String("bucket", "b")).WithGroup("object").Warn("Delete", slog.String("key", "a b"), slog.Int("size", 3))
+	logger.Error("Failed", slog.Any("error", context.Canceled))
+
+	for _, want := range []struct {
+		pri  int
+		body string
+	}{
+		{16*8 + 4, `{"msg":"Delete","bucket":"b","object":{"key":"a b","size":3}}`},
+		{16*8 + 3, `{"msg":"Failed","error":"context canceled"}`},
+	} {
+		select {
+		case msg := <-received:
+			checkSyslogMessage(t, msg, want.pri, want.body)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout waiting for message")
+		}
+	}
+}
+
+func TestSyslogHandlerUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("Listening on UDP failed: %v", err)
+	}
+
+	t.Cleanup(func() { pc.Close() })
+
+	conn, err := newSyslogConn("udp://" + pc.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("newSyslogConn() failed: %v", err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	slog.New(newSyslogHandler(syslogHandlerOptions{
+		conn:     conn,
+		facility: 3,
+		appName:  "app",
+		hostname: "host",
+	})).Info("Starting run", slog.String("run_id", "1234"))
+
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	buf := make([]byte, 2048)
+
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("ReadFrom() failed: %v", err)
+	}
+
+	checkSyslogMessage(t, string(buf[:n]), 3*8+6, `{"msg":"Starting run","run_id":"1234"}`)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/hansmi/s3-object-cleanup/internal/state"
+)
+
+// lastCompleteRuns returns the last complete runs of a statistics history.
+// Failed and partial runs, e.g. those reaching the list deadline, are left out
+// as they didn't list all versions.
+func lastCompleteRuns(history []state.RunStats, count int) []state.RunStats {
+	var result []state.RunStats
+
+	for _, i := range history {
+		if i.Complete {
+			result = append(result, i)
+		}
+	}
+
+	return result[max(0, len(result)-count):]
+}
+
+// writeStatsTrend prints the total and noncurrent size of the last complete
+// runs, followed by their change over the whole period. Sizes are those
+// listed by each run before any of its deletions.
+func writeStatsTrend(w io.Writer, history []state.RunStats, count int) error {
+	runs := lastCompleteRuns(history, count)
+
+	if len(runs) == 0 {
+		_, err := fmt.Fprintln(w, "No complete runs recorded.")
+		return err
+	}
+
+	// Runs recorded by older versions lack the noncurrent size.
+	noncurrent := func(i state.RunStats) (int64, bool) {
+		value, ok := i.Counters["total.noncurrent_bytes"]
+		return value, ok
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "Started\tMode\tSize\tChange\tNoncurrent\tChange")
+
+	for idx, i := range runs {
+		mode := "delete"
+
+		if i.DryRun {
+			mode = "dry-run"
+		}
+
+		sizeChange, noncurrentText, noncurrentChange := "-", "-", "-"
+
+		if idx > 0 {
+			sizeChange = formatSizeChange(i.Counters["total.bytes"] - runs[idx-1].Counters["total.bytes"])
+		}
+
+		if value, ok := noncurrent(i); ok {
+			noncurrentText = humanize.IBytes(uint64(max(0, value)))
+
+			if idx > 0 {
+				if previous, ok := noncurrent(runs[idx-1]); ok {
+					noncurrentChange = formatSizeChange(value - previous)
+				}
+			}
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			i.StartedAt.UTC().Format(time.DateTime),
+			mode,
+			humanize.IBytes(uint64(max(0, i.Counters["total.bytes"]))),
+			sizeChange,
+			noncurrentText,
+			noncurrentChange,
+		)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(runs) < 2 {
+		return nil
+	}
+
+	first, last := runs[0], runs[len(runs)-1]
+
+	summary := fmt.Sprintf("Change over %d runs since %s: size %s", len(runs),
+		first.StartedAt.UTC().Format(time.DateOnly),
+		formatSizeChange(last.Counters["total.bytes"]-first.Counters["total.bytes"]))
+
+	if firstValue, ok := noncurrent(first); ok {
+		if lastValue, ok := noncurrent(last); ok {
+			summary += ", noncurrent " + formatSizeChange(lastValue-firstValue)
+		}
+	}
+
+	_, err := fmt.Fprintln(w, summary)
+
+	return err
+}
+
+// statsTrend prints the size trend of the given buckets from the statistics
+// history in the persisted state.
+func (p *program) statsTrend(ctx context.Context, bucketNames []string) error {
+	return p.printBucketStates(ctx, "trend", bucketNames, func(w io.Writer, b *state.Bucket) error {
+		history, err := b.RunStatsHistory()
+		if err != nil {
+			return err
+		}
+
+		return writeStatsTrend(w, history, p.trendRuns)
+	})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hansmi/s3-object-cleanup/internal/state"
+)
+
+func TestWriteStatsTrend(t *testing.T) {
+	base := time.Date(2020, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	history := []state.RunStats{
+		{
+			StartedAt: base,
+			Complete:  true,
+			Counters: map[string]int64{
+				"total.bytes": 8192,
+			},
+		},
+		{
+			StartedAt: base.Add(24 * time.Hour),
+			DryRun:    true,
+			Complete:  true,
+			Counters: map[string]int64{
+				"total.bytes":            4096,
+				"total.noncurrent_bytes": 3072,
+			},
+		},
+		{
+			StartedAt: base.Add(48 * time.Hour),
+			Failed:    true,
+			Counters: map[string]int64{
+				"total.bytes":            10,
+				"total.noncurrent_bytes": 0,
+			},
+		},
+		{
+			StartedAt: base.Add(72 * time.Hour),
+			Complete:  true,
+			Counters: map[string]int64{
+				"total.bytes":            5120,
+				"total.noncurrent_bytes": 1024,
+			},
+		},
+		{
+			// Stopped at the list deadline.
+			StartedAt: base.Add(84 * time.Hour),
+			Counters: map[string]int64{
+				"total.bytes":            512,
+				"total.noncurrent_bytes": 128,
+			},
+		},
+		{
+			StartedAt: base.Add(96 * time.Hour),
+			Complete:  true,
+			Counters: map[string]int64{
+				"total.bytes":            6144,
+				"total.noncurrent_bytes": 1024,
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		name  string
+		count int
+		want  []string
+	}{
+		{
+			name:  "all",
+			count: 10,
+			want: []string{
+				"Started              Mode     Size     Change    Noncurrent  Change",
+				"2020-03-01 12:00:00  delete   8.0 KiB  -         -           -",
+				"2020-03-02 12:00:00  dry-run  4.0 KiB  -4.0 KiB  3.0 KiB     -",
+				"2020-03-04 12:00:00  delete   5.0 KiB  +1.0 KiB  1.0 KiB     -2.0 KiB",
+				"2020-03-05 12:00:00  delete   6.0 KiB  +1.0 KiB  1.0 KiB     +0 B",
+				"Change over 4 runs since 2020-03-01: size -2.0 KiB",
+			},
+		},
+		{
+			name:  "last",
+			count: 2,
+			want: []string{
+				"Started              Mode    Size     Change    Noncurrent  Change",
+				"2020-03-04 12:00:00  delete  5.0 KiB  -         1.0 KiB     -",
+				"2020-03-05 12:00:00  delete  6.0 KiB  +1.0 KiB  1.0 KiB     +0 B",
+				"Change over 2 runs since 2020-03-04: size +1.0 KiB, noncurrent +0 B",
+			},
+		},
+		{
+			name:  "single",
+			count: 1,
+			want: []string{
+				"Started              Mode    Size     Change  Noncurrent  Change",
+				"2020-03-05 12:00:00  delete  6.0 KiB  -       1.0 KiB     -",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf strings.Builder
+
+			if err := writeStatsTrend(&buf, history, tc.count); err != nil {
+				t.Errorf("writeStatsTrend() failed: %v", err)
+			}
+
+			var got []string
+
+			for _, line := range strings.Split(strings.TrimRight(buf.String(), "\n"), "\n") {
+				got = append(got, strings.TrimRight(line, " "))
+			}
+
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("writeStatsTrend() diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteStatsTrendEmpty(t *testing.T) {
+	var buf strings.Builder
+
+	if err := writeStatsTrend(&buf, []state.RunStats{{Failed: true}, {}}, 10); err != nil {
+		t.Errorf("writeStatsTrend() failed: %v", err)
+	}
+
+	if got, want := buf.String(), "No complete runs recorded.\n"; got != want {
+		t.Errorf("writeStatsTrend() = %q, want %q", got, want)
+	}
+}
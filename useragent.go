@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"runtime/debug"
+	"strings"
+
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Default User-Agent suffix attributing requests to the program and a single
+// run, e.g. in CloudTrail or server access logs.
+const defaultUserAgent = "s3-object-cleanup/{version} run={run_id}"
+
+// buildVersion returns the module version of the binary.
+func buildVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+
+	return "devel"
+}
+
+// newRunID returns a random identifier for a single run.
+func newRunID() string {
+	buf := make([]byte, 8)
+
+	// Never returns an error.
+	rand.Read(buf)
+
+	return hex.EncodeToString(buf)
+}
+
+// newSeed returns a random non-zero seed for a single run.
+func newSeed() uint64 {
+	buf := make([]byte, 8)
+
+	for {
+		// Never returns an error.
+		rand.Read(buf)
+
+		if seed := binary.LittleEndian.Uint64(buf); seed != 0 {
+			return seed
+		}
+	}
+}
+
+// expandUserAgent replaces the "{version}" and "{run_id}" placeholders.
+func expandUserAgent(template, runID string) string {
+	return strings.NewReplacer(
+		"{version}", buildVersion(),
+		"{run_id}", runID,
+	).Replace(template)
+}
+
+// newUserAgentAppender returns an API option appending the given text to the
+// User-Agent header built by the SDK. Unlike the SDK helpers the text is used
+// verbatim.
+func newUserAgentAppender(suffix string) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Build.Add(middleware.BuildMiddlewareFunc("AppendUserAgent",
+			func(ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler) (middleware.BuildOutput, middleware.Metadata, error) {
+				req, ok := in.Request.(*smithyhttp.Request)
+				if !ok {
+					return middleware.BuildOutput{}, middleware.Metadata{}, fmt.Errorf("unknown transport type %T", in.Request)
+				}
+
+				if current := req.Header.Get("User-Agent"); current != "" {
+					req.Header.Set("User-Agent", current+" "+suffix)
+				} else {
+					req.Header.Set("User-Agent", suffix)
+				}
+
+				return next.HandleBuild(ctx, in)
+			}), middleware.After)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// recordingHTTPClient answers all requests successfully and records them.
+type recordingHTTPClient struct {
+	requests []*http.Request
+}
+
+func (c *recordingHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	c.requests = append(c.requests, req)
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
+
+func TestNewRunID(t *testing.T) {
+	first := newRunID()
+
+	if !regexp.MustCompile(`^[0-9a-f]{16}$`).MatchString(first) {
+		t.Errorf("newRunID() = %q, want 16 hex digits", first)
+	}
+
+	if second := newRunID(); first == second {
+		t.Errorf("newRunID() returned %q twice", first)
+	}
+}
+
+func TestExpandUserAgent(t *testing.T) {
+	got := expandUserAgent(defaultUserAgent, "abc123")
+
+	if want := "s3-object-cleanup/" + buildVersion() + " run=abc123"; got != want {
+		t.Errorf("expandUserAgent() = %q, want %q", got, want)
+	}
+
+	if got := expandUserAgent("static", "abc123"); got != "static" {
+		t.Errorf("expandUserAgent() = %q, want %q", got, "static")
+	}
+}
+
+func TestUserAgentAppender(t *testing.T) {
+	httpClient := &recordingHTTPClient{}
+
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String("http://localhost"),
+		UsePathStyle: true,
+		Credentials:  aws.AnonymousCredentials{},
+		HTTPClient:   httpClient,
+		APIOptions: []func(*middleware.Stack) error{
+			newUserAgentAppender("s3-object-cleanup/v1.0.0 run=abc123"),
+		},
+	})
+
+	if _, err := client.DeleteObject(t.Context(), &s3.DeleteObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("key"),
+	}); err != nil {
+		t.Fatalf("DeleteObject() failed: %v", err)
+	}
+
+	if len(httpClient.requests) != 1 {
+		t.Fatalf("Received %d requests, want 1", len(httpClient.requests))
+	}
+
+	got := httpClient.requests[0].Header.Get("User-Agent")
+
+	if !strings.HasPrefix(got, "aws-sdk-go-v2/") || !strings.HasSuffix(got, " s3-object-cleanup/v1.0.0 run=abc123") {
+		t.Errorf("User-Agent %q doesn't end with the suffix", got)
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/hansmi/s3-object-cleanup/cleanup"
+	"github.com/hansmi/s3-object-cleanup/internal/client"
+)
+
+// flagError reports all problems found in the flags at once.
+type flagError struct {
+	problems []error
+}
+
+func (e *flagError) Error() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "invalid flags (%d problems):", len(e.problems))
+
+	for _, err := range e.problems {
+		sb.WriteString("\n  ")
+		sb.WriteString(err.Error())
+	}
+
+	return sb.String()
+}
+
+func (e *flagError) Unwrap() []error {
+	return e.problems
+}
+
+// flagValidator collects problems instead of stopping at the first one, so a
+// misconfiguration needn't be fixed one flag at a time.
+type flagValidator struct {
+	problems []error
+	warnings []string
+}
+
+// check records a problem unless the condition holds.
+func (v *flagValidator) check(ok bool, format string, args ...any) {
+	if !ok {
+		v.problems = append(v.problems, fmt.Errorf(format, args...))
+	}
+}
+
+// add records a non-nil error as a problem.
+func (v *flagValidator) add(err error) {
+	if err != nil {
+		v.problems = append(v.problems, err)
+	}
+}
+
+// parse records the error of parsing the value of the named flag.
+func (v *flagValidator) parse(name string, err error) {
+	if err != nil {
+		v.add(fmt.Errorf("%s: %w", name, err))
+	}
+}
+
+// warn records a setting which is valid, but likely not what was intended.
+func (v *flagValidator) warn(format string, args ...any) {
+	v.warnings = append(v.warnings, fmt.Sprintf(format, args...))
+}
+
+func (v *flagValidator) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+
+	return &flagError{problems: v.problems}
+}
+
+// validate checks the values of the flags and their interplay before any
+// request is made. Settings which are valid, but likely mistakes are logged as
+// warnings.
+func (p *program) validate(logger *slog.Logger) error {
+	var v flagValidator
+
+	p.validateRetention(&v)
+	p.validateBudgets(&v)
+	p.validateModes(&v)
+	p.validateValues(&v)
+
+	for _, msg := range v.warnings {
+		logger.Warn("Questionable flag setting", slog.String("problem", msg))
+	}
+
+	return v.err()
+}
+
+func (p *program) validateRetention(v *flagValidator) {
+	v.check(p.minDeletionAge >= 0, "min_age (%v) must not be negative", p.minDeletionAge)
+	v.check(p.minRetention >= 0, "min_retention (%v) must not be negative", p.minRetention)
+	v.check(p.minRetentionThreshold >= 0, "min_retention_threshold (%v) must not be negative", p.minRetentionThreshold)
+	v.check(p.minRetentionThreshold <= p.minRetention,
+		"min_retention_threshold (%v) may not exceed min_retention (%v); lower the threshold or raise the retention",
+		p.minRetentionThreshold, p.minRetention)
+	v.check(p.retentionJitter >= 0, "retention_jitter (%v) must not be negative", p.retentionJitter)
+	v.check(p.maxRetentionHorizon >= 0, "max_retention_horizon (%v) must not be negative", p.maxRetentionHorizon)
+
+	if p.maxRetentionHorizon > 0 {
+		v.check(p.minRetention+p.retentionJitter <= p.maxRetentionHorizon,
+			"min_retention (%v) plus retention_jitter (%v) exceed max_retention_horizon (%v); every extension would be beyond the horizon",
+			p.minRetention, p.retentionJitter, p.maxRetentionHorizon)
+	}
+	v.check(p.maxNoncurrentVersions >= 0, "max_noncurrent_versions (%d) may not be negative", p.maxNoncurrentVersions)
+	v.check(p.minSurvivingVersions >= 0, "min_surviving_versions (%d) may not be negative", p.minSurvivingVersions)
+
+	if p.minRetention > p.minDeletionAge {
+		v.warn("min_retention (%v) exceeds min_age (%v): versions stay locked beyond their minimum age and are only deleted once their retention ends; "+
+			"lower min_retention or raise min_age", p.minRetention, p.minDeletionAge)
+	}
+}
+
+func (p *program) validateBudgets(v *flagValidator) {
+	v.check(p.timeout >= 0, "timeout (%v) must not be negative", p.timeout)
+	v.check(p.maxRuntime >= 0, "max_runtime (%v) must not be negative", p.maxRuntime)
+
+	if p.timeout > 0 && p.maxRuntime > 0 {
+		v.check(p.maxRuntime < p.timeout,
+			"max_runtime (%v) must be shorter than timeout (%v) to leave time for processing the listed versions",
+			p.maxRuntime, p.timeout)
+	}
+
+	v.check(p.maxDeleteRate >= 0, "max_delete_rate (%v) must not be negative; use zero to disable the limit", p.maxDeleteRate)
+	v.check(p.maxErrorRatio >= 0 && p.maxErrorRatio <= 1, "max_error_ratio (%v) must be between 0 and 1", p.maxErrorRatio)
+	v.check(p.maxDeleteFraction >= 0 && p.maxDeleteFraction <= 1, "max_delete_fraction (%v) must be between 0 and 1", p.maxDeleteFraction)
+	v.check(p.maxPlanDeviation >= 0 && p.maxPlanDeviation <= 1, "max_plan_deviation (%v) must be between 0 and 1", p.maxPlanDeviation)
+	v.check(p.maxClockSkew >= 0, "max_clock_skew (%v) must not be negative", p.maxClockSkew)
+
+	v.check(p.listPageSize >= 0 && p.listPageSize <= math.MaxInt32,
+		"list_page_size (%d) must be between 0 and %d", p.listPageSize, math.MaxInt32)
+	v.check(p.listPageRetries >= 0, "list_page_retries (%d) must not be negative", p.listPageRetries)
+	v.check(p.channelCapacity >= 1, "channel_capacity (%d) must be at least 1", p.channelCapacity)
+	v.check(p.maxWorkers >= 0, "max_workers (%d) must not be negative", p.maxWorkers)
+	v.check(p.sqsMaxMessages >= 1, "sqs_max_messages (%d) must be at least 1", p.sqsMaxMessages)
+	v.check(p.largestDeletions >= 0, "largest_deletions (%d) must not be negative", p.largestDeletions)
+	v.check(p.httpMaxIdleConns >= 0, "http_max_idle_conns (%d) must not be negative", p.httpMaxIdleConns)
+	v.check(p.trendRuns >= 1, "trend_runs (%d) must be at least 1", p.trendRuns)
+}
+
+func (p *program) validateModes(v *flagValidator) {
+	for _, i := range []struct {
+		name string
+		set  bool
+	}{
+		{"quarantine_period", p.quarantinePeriod > 0},
+		{"delete_audit_ttl", p.deleteAuditTTL > 0},
+		{"state_checkpoint_interval", p.stateCheckpoint > 0},
+		{"lock_ttl", p.lockTTL > 0},
+		{"approval_token", p.approvalToken != ""},
+		{"require_reviewed_plan", p.requireReviewedPlan},
+		{"persistence_sse", p.persistenceSSE != "" || p.persistenceSSEKMSKeyID != ""},
+		{"state_encryption_key_file", p.stateEncryptionKeyFile != ""},
+		{"persistence_accelerate", p.persistenceAccelerate},
+	} {
+		v.check(!i.set || p.persistenceBucket != "", "%s requires persistence_bucket", i.name)
+	}
+
+	v.check(!p.persistenceAccelerate || !client.IsEndpointURL(p.persistenceBucket),
+		"persistence_accelerate is not supported for a persistence_bucket given as URL")
+
+	v.check(p.incremental <= 0 || p.inventory, "incremental requires inventory")
+	v.check(p.planFile == "" || p.dryRun, "plan_file requires dry_run")
+
+	var stdout []string
+
+	for _, i := range []struct {
+		name, path string
+	}{
+		{"plan_file", p.planFile},
+		{"actions_ndjson", p.actionsNDJSON},
+		{"stats_file", p.statsFile},
+	} {
+		if i.path == "-" {
+			stdout = append(stdout, i.name)
+		}
+	}
+
+	v.check(len(stdout) < 2, "%s can't share standard output; write all but one of them to a file", strings.Join(stdout, ", "))
+
+	v.check(!(p.syslogAddress != "" && p.journald), "syslog and journald are mutually exclusive")
+}
+
+// parsedFlags holds the values of the flags parsed into other types. It's
+// filled in by validate.
+type parsedFlags struct {
+	retries          retryPolicy
+	flavor           client.Flavor
+	deleteMarkers    cleanup.DeleteMarkerStrategy
+	shard            cleanup.KeyShard
+	planFormat       cleanup.PlanFormat
+	dnsServer        string
+	networks         []string
+	chaos            client.ChaosOptions
+	webIdentity      webIdentityOptions
+	uploadEncryption client.UploadEncryption
+	maxStateSize     uint64
+	excludeMetadata  *cleanup.MetadataMatcher
+	presets          []string
+
+	adjustClockSkew       bool
+	clampRetentionHorizon bool
+	deleteFractionDryRun  bool
+}
+
+// validateValues parses the flags of other types into p.parsed.
+func (p *program) validateValues(v *flagValidator) {
+	var f parsedFlags
+	var err error
+
+	f.retries, err = parseRetryPolicy(p.retryMode, p.retryMaxAttempts, p.retryMaxBackoff)
+	v.parse("retry policy", err)
+
+	f.flavor, err = client.ParseFlavor(p.s3Flavor)
+	v.parse("s3_flavor", err)
+
+	if err == nil && p.maxDeleteRate > 0 && p.timeout > 0 {
+		// The rate limiter permits one batch at once and refills it at the
+		// given rate.
+		batchSize := f.flavor.MaxDeleteObjects()
+		refill := time.Duration(float64(batchSize) / p.maxDeleteRate * float64(time.Second))
+
+		if refill > p.timeout {
+			v.warn("max_delete_rate (%v) takes %v to permit a batch of %d deletions, longer than timeout (%v); "+
+				"at most one batch per bucket is deleted",
+				p.maxDeleteRate, refill, batchSize, p.timeout)
+		}
+	}
+
+	f.deleteMarkers, err = cleanup.ParseDeleteMarkerStrategy(p.deleteMarkerStrategy)
+	v.parse("delete_marker_strategy", err)
+
+	f.shard, err = cleanup.ParseKeyShard(p.shard)
+	v.parse("shard", err)
+
+	f.planFormat, err = cleanup.ParsePlanFormat(p.planFormat)
+	v.parse("plan_format", err)
+
+	f.dnsServer, err = parseDNSServer(p.dnsServer)
+	v.parse("dns_server", err)
+
+	f.networks, err = parseAddressFamily(p.addressFamily)
+	v.parse("address_family", err)
+
+	f.chaos, err = client.ParseChaos(p.chaos)
+	v.parse(chaosFlagName, err)
+
+	f.webIdentity = webIdentityOptions{
+		tokenFile:   p.webIdentityTokenFile,
+		roleARN:     p.webIdentityRoleARN,
+		sessionName: cmp.Or(p.webIdentitySessionName, "s3-object-cleanup-"+p.runID),
+		duration:    p.webIdentitySessionDuration,
+	}
+	v.add(f.webIdentity.validate())
+
+	if p.persistenceBucket != "" {
+		f.uploadEncryption, err = client.ParseUploadEncryption(p.persistenceSSE, p.persistenceSSEKMSKeyID)
+		v.parse("persistence_sse", err)
+	}
+
+	if p.maxStateSize != "" {
+		f.maxStateSize, err = humanize.ParseBytes(p.maxStateSize)
+		v.parse("max_state_size", err)
+	}
+
+	if p.excludeMetadata != "" {
+		f.excludeMetadata, err = cleanup.ParseMetadataMatcher(p.excludeMetadata)
+		v.parse("exclude_metadata", err)
+	}
+
+	if p.preset != "" {
+		presets := cleanup.NewKeyManifest()
+
+		for name := range strings.SplitSeq(p.preset, ",") {
+			name = strings.TrimSpace(name)
+
+			if err := presets.AddPreset(name); err != nil {
+				v.parse("preset", err)
+			} else {
+				f.presets = append(f.presets, name)
+			}
+		}
+	}
+
+	v.check(p.clockSkewAction == "abort" || p.clockSkewAction == "adjust",
+		`clock_skew_action (%q) must be "abort" or "adjust"`, p.clockSkewAction)
+	v.check(p.retentionHorizonAction == "reject" || p.retentionHorizonAction == "clamp",
+		`retention_horizon_action (%q) must be "reject" or "clamp"`, p.retentionHorizonAction)
+	v.check(p.maxDeleteFractionAction == "abort" || p.maxDeleteFractionAction == "dry_run",
+		`max_delete_fraction_action (%q) must be "abort" or "dry_run"`, p.maxDeleteFractionAction)
+
+	f.adjustClockSkew = p.clockSkewAction == "adjust"
+	f.clampRetentionHorizon = p.retentionHorizonAction == "clamp"
+	f.deleteFractionDryRun = p.maxDeleteFractionAction == "dry_run"
+
+	p.parsed = f
+}
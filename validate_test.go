@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hansmi/s3-object-cleanup/cleanup"
+)
+
+func newValidProgram() program {
+	return program{
+		dryRun:                  true,
+		minDeletionAge:          32 * 24 * time.Hour,
+		minRetention:            32 * 24 * time.Hour,
+		minRetentionThreshold:   8 * 24 * time.Hour,
+		channelCapacity:         1,
+		sqsMaxMessages:          1,
+		clockSkewAction:         "abort",
+		retentionHorizonAction:  "reject",
+		maxDeleteFractionAction: "abort",
+		planFormat:              "csv",
+		trendRuns:               defaultTrendRuns,
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		modify func(*program)
+		want   []string
+	}{
+		{name: "defaults"},
+		{
+			name: "retention",
+			modify: func(p *program) {
+				p.minDeletionAge = -time.Hour
+				p.minRetentionThreshold = 40 * 24 * time.Hour
+				p.maxRetentionHorizon = 30 * 24 * time.Hour
+			},
+			want: []string{
+				"min_age (-1h0m0s) must not be negative",
+				"min_retention_threshold (960h0m0s) may not exceed min_retention (768h0m0s); lower the threshold or raise the retention",
+				"min_retention (768h0m0s) plus retention_jitter (0s) exceed max_retention_horizon (720h0m0s); every extension would be beyond the horizon",
+			},
+		},
+		{
+			name: "budgets",
+			modify: func(p *program) {
+				p.timeout = time.Hour
+				p.maxRuntime = 2 * time.Hour
+				p.maxDeleteRate = -1
+				p.maxErrorRatio = 2
+				p.channelCapacity = 0
+				p.largestDeletions = -1
+				p.trendRuns = 0
+			},
+			want: []string{
+				"max_runtime (2h0m0s) must be shorter than timeout (1h0m0s) to leave time for processing the listed versions",
+				"max_delete_rate (-1) must not be negative; use zero to disable the limit",
+				"max_error_ratio (2) must be between 0 and 1",
+				"channel_capacity (0) must be at least 1",
+				"largest_deletions (-1) must not be negative",
+				"trend_runs (0) must be at least 1",
+			},
+		},
+		{
+			name: "modes",
+			modify: func(p *program) {
+				p.dryRun = false
+				p.lockTTL = time.Minute
+				p.stateEncryptionKeyFile = "key"
+				p.incremental = time.Hour
+				p.planFile = "-"
+				p.actionsNDJSON = "-"
+				p.statsFile = "-"
+				p.syslogAddress = "localhost:514"
+				p.journald = true
+			},
+			want: []string{
+				"lock_ttl requires persistence_bucket",
+				"state_encryption_key_file requires persistence_bucket",
+				"incremental requires inventory",
+				"plan_file requires dry_run",
+				"plan_file, actions_ndjson, stats_file can't share standard output; write all but one of them to a file",
+				"syslog and journald are mutually exclusive",
+			},
+		},
+		{
+			name: "persistence endpoint",
+			modify: func(p *program) {
+				p.persistenceBucket = "https://s3.example.com/state"
+				p.persistenceAccelerate = true
+			},
+			want: []string{
+				"persistence_accelerate is not supported for a persistence_bucket given as URL",
+			},
+		},
+		{
+			name: "values",
+			modify: func(p *program) {
+				p.s3Flavor = "unknown"
+				p.shard = "1"
+				p.maxStateSize = "lots"
+				p.chaos = "errors=2"
+				p.preset = "restic,nonexistent"
+				p.clockSkewAction = "ignore"
+			},
+			want: []string{
+				`s3_flavor: invalid argument: unknown S3 flavor "unknown" (known: aws, b2, minio, ceph)`,
+				`shard: shard "1" is not of the form i/N`,
+				"chaos: errors (2) must be between 0 and 1",
+				`max_state_size: strconv.ParseFloat: parsing "": invalid syntax`,
+				`preset: invalid argument: unknown preset "nonexistent" (known: restic, borg, velero, pgbackrest)`,
+				`clock_skew_action ("ignore") must be "abort" or "adjust"`,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newValidProgram()
+
+			if tc.modify != nil {
+				tc.modify(&p)
+			}
+
+			err := p.validate(slog.New(slog.DiscardHandler))
+
+			var got []string
+
+			if err != nil {
+				var flagErr *flagError
+
+				if !errors.As(err, &flagErr) {
+					t.Fatalf("validate() returned %#v, want *flagError", err)
+				}
+
+				for _, i := range flagErr.problems {
+					got = append(got, i.Error())
+				}
+			}
+
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Problems diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestValidateWarnings(t *testing.T) {
+	var buf bytes.Buffer
+
+	p := newValidProgram()
+	p.minRetention = 90 * 24 * time.Hour
+	p.maxDeleteRate = 0.1
+	p.timeout = time.Hour
+
+	if err := p.validate(slog.New(slog.NewTextHandler(&buf, nil))); err != nil {
+		t.Errorf("validate() failed: %v", err)
+	}
+
+	for _, want := range []string{
+		"min_retention (2160h0m0s) exceeds min_age (768h0m0s)",
+		"max_delete_rate (0.1) takes 2h46m40s to permit a batch of 1000 deletions",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Warnings %q don't contain %q", buf.String(), want)
+		}
+	}
+}
+
+func TestValidateParsed(t *testing.T) {
+	p := newValidProgram()
+	p.runID = "abc"
+	p.shard = "1/4"
+	p.maxStateSize = "1 MiB"
+	p.deleteMarkerStrategy = "keep"
+	p.preset = " restic , borg"
+	p.clockSkewAction = "adjust"
+	p.maxDeleteFractionAction = "dry_run"
+	p.webIdentityTokenFile = "token"
+	p.webIdentityRoleARN = "arn:aws:iam::123456789012:role/cleanup"
+
+	if err := p.validate(slog.New(slog.DiscardHandler)); err != nil {
+		t.Fatalf("validate() failed: %v", err)
+	}
+
+	got := p.parsed
+
+	if got.shard.String() != "1/4" {
+		t.Errorf("shard = %q, want %q", got.shard.String(), "1/4")
+	}
+
+	if got.maxStateSize != 1<<20 {
+		t.Errorf("maxStateSize = %d, want %d", got.maxStateSize, 1<<20)
+	}
+
+	if got.deleteMarkers != cleanup.DeleteMarkerKeep {
+		t.Errorf("deleteMarkers = %v, want %v", got.deleteMarkers, cleanup.DeleteMarkerKeep)
+	}
+
+	if diff := cmp.Diff([]string{"restic", "borg"}, got.presets); diff != "" {
+		t.Errorf("presets diff (-want +got):\n%s", diff)
+	}
+
+	if !got.adjustClockSkew || got.clampRetentionHorizon || !got.deleteFractionDryRun {
+		t.Errorf("Actions adjust clock skew %t, clamp retention horizon %t, delete fraction dry run %t; want true, false, true",
+			got.adjustClockSkew, got.clampRetentionHorizon, got.deleteFractionDryRun)
+	}
+
+	if got, want := got.webIdentity.sessionName, "s3-object-cleanup-abc"; got != want {
+		t.Errorf("Web identity session name = %q, want %q", got, want)
+	}
+}
+
+func TestFlagError(t *testing.T) {
+	err := &flagError{problems: []error{os.ErrInvalid, os.ErrNotExist}}
+
+	if got, want := err.Error(), "invalid flags (2 problems):\n  invalid argument\n  file does not exist"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Error %v doesn't wrap %v", err, os.ErrNotExist)
+	}
+}
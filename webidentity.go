@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// webIdentityOptions configures credentials obtained by exchanging an OIDC
+// token for a role session, e.g. the projected service account token of
+// Kubernetes (IRSA) or the ID token of a GitHub Actions workflow. The zero
+// value keeps the SDK credential chain.
+type webIdentityOptions struct {
+	tokenFile   string
+	roleARN     string
+	sessionName string
+
+	// Lifetime of the role session. Uses the STS default if zero.
+	duration time.Duration
+}
+
+func (o webIdentityOptions) enabled() bool {
+	return o.tokenFile != "" || o.roleARN != ""
+}
+
+func (o webIdentityOptions) validate() error {
+	if !o.enabled() {
+		return nil
+	}
+
+	if o.tokenFile == "" {
+		return errors.New("web_identity_role_arn requires web_identity_token_file")
+	}
+
+	if o.roleARN == "" {
+		return errors.New("web_identity_token_file requires web_identity_role_arn")
+	}
+
+	if o.duration < 0 {
+		return fmt.Errorf("web identity session duration (%v) must not be negative", o.duration)
+	}
+
+	return nil
+}
+
+// apply replaces the credentials of the configuration. The token file is
+// read again whenever the credentials are refreshed as issuers rotate the
+// tokens.
+func (o webIdentityOptions) apply(cfg *aws.Config, optFns ...func(*sts.Options)) {
+	if !o.enabled() {
+		return
+	}
+
+	stsClient := sts.NewFromConfig(*cfg, append([]func(*sts.Options){
+		func(so *sts.Options) {
+			if so.Region == "" {
+				// Use the global endpoint.
+				so.Region = "us-east-1"
+			}
+		},
+	}, optFns...)...)
+
+	cfg.Credentials = aws.NewCredentialsCache(stscreds.NewWebIdentityRoleProvider(
+		stsClient, o.roleARN, stscreds.IdentityTokenFile(o.tokenFile),
+		func(wo *stscreds.WebIdentityRoleOptions) {
+			wo.RoleSessionName = o.sessionName
+			wo.Duration = o.duration
+		}), setCredentialsCacheOptions)
+}
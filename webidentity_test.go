@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWebIdentityOptionsValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		opts    webIdentityOptions
+		wantErr bool
+	}{
+		{name: "disabled"},
+		{
+			name: "complete",
+			opts: webIdentityOptions{tokenFile: "token", roleARN: "arn:aws:iam::123456789012:role/cleanup"},
+		},
+		{
+			name:    "missing role",
+			opts:    webIdentityOptions{tokenFile: "token"},
+			wantErr: true,
+		},
+		{
+			name:    "missing token file",
+			opts:    webIdentityOptions{roleARN: "arn:aws:iam::123456789012:role/cleanup"},
+			wantErr: true,
+		},
+		{
+			name: "negative duration",
+			opts: webIdentityOptions{
+				tokenFile: "token",
+				roleARN:   "arn:aws:iam::123456789012:role/cleanup",
+				duration:  -time.Hour,
+			},
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.opts.validate()
+
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("validate() error = %v, want error %t", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebIdentityOptionsApply(t *testing.T) {
+	tokenFile := writeTestFile(t, "token", "first-token")
+
+	var gotTokens []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm() failed: %v", err)
+		}
+
+		if diff := cmp.Diff(map[string]string{
+			"Action":          "AssumeRoleWithWebIdentity",
+			"RoleArn":         "arn:aws:iam::123456789012:role/cleanup",
+			"RoleSessionName": "session",
+			"DurationSeconds": "900",
+		}, map[string]string{
+			"Action":          r.PostForm.Get("Action"),
+			"RoleArn":         r.PostForm.Get("RoleArn"),
+			"RoleSessionName": r.PostForm.Get("RoleSessionName"),
+			"DurationSeconds": r.PostForm.Get("DurationSeconds"),
+		}); diff != "" {
+			t.Errorf("Request diff (-want +got):\n%s", diff)
+		}
+
+		gotTokens = append(gotTokens, r.PostForm.Get("WebIdentityToken"))
+
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(`<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>AKIDEXAMPLE</AccessKeyId>
+      <SecretAccessKey>secret</SecretAccessKey>
+      <SessionToken>token</SessionToken>
+      <Expiration>2000-01-01T00:00:00Z</Expiration>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := aws.Config{
+		Credentials: aws.AnonymousCredentials{},
+	}
+
+	webIdentityOptions{
+		tokenFile:   tokenFile,
+		roleARN:     "arn:aws:iam::123456789012:role/cleanup",
+		sessionName: "session",
+		duration:    15 * time.Minute,
+	}.apply(&cfg, func(o *sts.Options) {
+		o.BaseEndpoint = aws.String(server.URL)
+	})
+
+	got, err := cfg.Credentials.Retrieve(t.Context())
+	if err != nil {
+		t.Fatalf("Retrieve() failed: %v", err)
+	}
+
+	if got.AccessKeyID != "AKIDEXAMPLE" {
+		t.Errorf("Access key ID %q, want AKIDEXAMPLE", got.AccessKeyID)
+	}
+
+	// The returned credentials are already expired and the token was
+	// rotated in the meantime.
+	if err := os.WriteFile(tokenFile, []byte("second-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cfg.Credentials.Retrieve(t.Context()); err != nil {
+		t.Fatalf("Retrieve() failed: %v", err)
+	}
+
+	if diff := cmp.Diff([]string{"first-token", "second-token"}, gotTokens); diff != "" {
+		t.Errorf("Tokens diff (-want +got):\n%s", diff)
+	}
+}